@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/util"
+)
+
+// benchmarkCompressions the compressions that benchmark compares, unless given others
+var benchmarkCompressions = []string{"gzip", "bzip2", "zstd", "none"}
+
+func benchmarkCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
+	if cmdConfig == nil {
+		return nil, fmt.Errorf("cmdConfig is nil")
+	}
+	var v *viper.Viper
+	var cmd = &cobra.Command{
+		Use:   "benchmark",
+		Short: "compare the size and speed of each compression and level",
+		Long: `Compress a sample of a dump with each compression, at each of its levels, and report how large it is
+		compressed, and how long it takes to compress, uncompress and encrypt, to choose the compression and level
+		that suit the hardware. The sample is --sample, a dump or a file of SQL, or if not given, the start of a dump
+		of the databases of the database server. Only the first --sample-size of it is used, in memory, so that the
+		disk is not what is timed.`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			bindFlags(cmd, v)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmdConfig.logger.Debug("starting benchmark")
+			output := v.GetString("output")
+			if err := validateOutput(output); err != nil {
+				return err
+			}
+			sample := v.GetString("sample")
+			if sample == "" && cmdConfig.dbconn.Host == "" && cmdConfig.dbconn.DefaultsFile == "" {
+				return fmt.Errorf("requires --sample, or a database server from which to dump a sample")
+			}
+			var sampleSize int64
+			if sampleSizeVar := v.GetString("sample-size"); sampleSizeVar != "" {
+				var err error
+				if sampleSize, err = util.ParseSize(sampleSizeVar); err != nil {
+					return fmt.Errorf("invalid sample size: %v", err)
+				}
+				if sampleSize <= 0 {
+					return fmt.Errorf("invalid sample size %d, must be more than 0", sampleSize)
+				}
+			}
+			include := v.GetStringSlice("include")
+			if len(include) == 0 && cmdConfig.configuration != nil {
+				include = cmdConfig.configuration.Dump.Include
+			}
+			compressionThreads := v.GetInt("compression-threads")
+			if !v.IsSet("compression-threads") && cmdConfig.configuration != nil && cmdConfig.configuration.Dump.CompressionThreads != 0 {
+				compressionThreads = cmdConfig.configuration.Dump.CompressionThreads
+			}
+			levels, err := cmd.Flags().GetIntSlice("compression-level")
+			if err != nil {
+				return fmt.Errorf("invalid compression level: %v", err)
+			}
+
+			var executor execs
+			executor = &core.Executor{}
+			if passedExecs != nil {
+				executor = passedExecs
+			}
+			executor.SetLogger(cmdConfig.logger)
+
+			// at this point, any errors should not have usage
+			cmd.SilenceUsage = true
+			uid := uuid.New()
+			results, err := executor.Benchmark(cmd.Context(), core.BenchmarkOptions{
+				Sample:             sample,
+				DBConn:             cmdConfig.dbconn,
+				DBNames:            include,
+				SampleSize:         sampleSize,
+				Compressions:       v.GetStringSlice("compression"),
+				CompressionLevels:  levels,
+				CompressionThreads: compressionThreads,
+				Run:                uid,
+			})
+			if err != nil {
+				return fmt.Errorf("error benchmarking: %v", err)
+			}
+			if output == outputJSON {
+				return printJSON(cmd.OutOrStdout(), newBenchmarkOutput(uid.String(), results))
+			}
+			printBenchmark(cmd.OutOrStdout(), results)
+			return nil
+		},
+	}
+	v = viper.New()
+	v.SetEnvPrefix("db_benchmark")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+
+	flags := cmd.Flags()
+	flags.String("sample", "", "Dump, compressed or not, or file of SQL, with which to benchmark. If not set, the sample is dumped from the database server.")
+	flags.String("sample-size", "", "The most of the sample to use, from its start, uncompressed, e.g. 256MB, with a unit of K, M, G or T, each 1024 times the one before. The sample is held in memory. Defaults to 64MB.")
+	flags.StringSlice("include", []string{}, "names of databases from which to dump the sample, if there is no --sample; empty to do all")
+	flags.StringSlice("compression", benchmarkCompressions, "Compressions to compare. Supported are: `gzip`, `bzip2`, `zstd`, `none`")
+	flags.IntSlice("compression-level", []int{}, "Levels at which to compare each compression, of those that it has, e.g. 1,6,9. Defaults to every level that compresses differently: 1 to 9 for `gzip` and `bzip2`, and 1, 3, 6 and 19 for `zstd`.")
+	flags.Int("compression-threads", 0, "How many threads compress at once, for `gzip` and `zstd`, as for dump. 0 for the default of the compression.")
+	flags.String("output", outputText, "Format of the results: `text` for a table, or `json` for a JSON summary, on stdout.")
+
+	return cmd, nil
+}
+
+// printBenchmark write the results as a table, with a row for each compression and level
+func printBenchmark(out io.Writer, results core.BenchmarkResults) {
+	source := results.Sample
+	if source == "" {
+		source = "a dump of " + strings.Join(results.Databases, ", ")
+	}
+	fmt.Fprintf(out, "sample of %s from %s\n", util.FormatSize(results.SampleSize), source)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COMPRESSION\tLEVEL\tSIZE\tRATIO\tCOMPRESS\tSPEED\tUNCOMPRESS\tENCRYPT")
+	for _, b := range results.Compressions {
+		level := "-"
+		if b.Level != 0 {
+			level = fmt.Sprint(b.Level)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.1f%%\t%s\t%s/s\t%s\t%s\n", b.Compression, level, util.FormatSize(b.Size), b.Ratio(results.SampleSize)*100,
+			b.Compress.Round(time.Millisecond), util.FormatSize(bytesPerSecond(results.SampleSize, b.Compress)),
+			b.Uncompress.Round(time.Millisecond), b.Encrypt.Round(time.Millisecond))
+	}
+	w.Flush()
+}
+
+// bytesPerSecond the rate at which n bytes were processed in d
+func bytesPerSecond(n int64, d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(float64(n) / d.Seconds())
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/database"
+)
+
+func TestBenchmarkCmd(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name                     string
+		args                     []string // "benchmark" will be prepended automatically
+		wantErr                  bool
+		expectedBenchmarkOptions core.BenchmarkOptions
+	}{
+		{"no sample or server", []string{}, true, core.BenchmarkOptions{}},
+		{"invalid sample size", []string{"--sample", "dump.tgz", "--sample-size", "lots"}, true, core.BenchmarkOptions{}},
+		{"invalid output", []string{"--sample", "dump.tgz", "--output", "xml"}, true, core.BenchmarkOptions{}},
+		{"sample", []string{"--sample", "dump.tgz"}, false, core.BenchmarkOptions{
+			Sample:            "dump.tgz",
+			DBConn:            database.Connection{Port: defaultPort},
+			DBNames:           []string{},
+			Compressions:      benchmarkCompressions,
+			CompressionLevels: []int{},
+		}},
+		{"compressions and levels", []string{"--sample", "dump.sql", "--sample-size", "16M", "--compression", "gzip,zstd", "--compression-level", "1,9", "--compression-threads", "4"}, false, core.BenchmarkOptions{
+			Sample:             "dump.sql",
+			DBConn:             database.Connection{Port: defaultPort},
+			DBNames:            []string{},
+			SampleSize:         16 << 20,
+			Compressions:       []string{"gzip", "zstd"},
+			CompressionLevels:  []int{1, 9},
+			CompressionThreads: 4,
+		}},
+		{"server", []string{"--server", "abc", "--include", "app"}, false, core.BenchmarkOptions{
+			DBConn:            database.Connection{Host: "abc", Port: defaultPort},
+			DBNames:           []string{"app"},
+			Compressions:      benchmarkCompressions,
+			CompressionLevels: []int{},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockExecs()
+			m.On("Benchmark", mock.MatchedBy(func(benchmarkOpts core.BenchmarkOptions) bool {
+				if equalIgnoreFields(benchmarkOpts, tt.expectedBenchmarkOptions, []string{"Run"}) {
+					return true
+				}
+				t.Errorf("benchmarkOpts compare failed: %#v %#v", benchmarkOpts, tt.expectedBenchmarkOptions)
+				return false
+			})).Return(core.BenchmarkResults{}, nil)
+			cmd, err := rootCmd(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd.SetOutput(io.Discard)
+			cmd.SetArgs(append([]string{"benchmark"}, tt.args...))
+			err = cmd.Execute()
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			case err == nil:
+				m.AssertExpectations(t)
+			}
+		})
+	}
+}
+
+func TestBenchmarkCmdOutput(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	results := core.BenchmarkResults{
+		Start:      start,
+		End:        start.Add(5 * time.Second),
+		Sample:     "dump.tgz",
+		SampleSize: 1 << 20,
+		Compressions: []core.CompressionBenchmark{
+			{Compression: "gzip", Level: 1, Size: 256 << 10, Compress: 500 * time.Millisecond, Uncompress: 100 * time.Millisecond, Encrypt: 2 * time.Millisecond},
+			{Compression: "none", Size: 1 << 20, Compress: 10 * time.Millisecond, Uncompress: 5 * time.Millisecond, Encrypt: 8 * time.Millisecond},
+		},
+	}
+	tests := []struct {
+		name   string
+		output string
+		check  func(t *testing.T, out string)
+	}{
+		{"text", "text", func(t *testing.T, out string) {
+			assert.Equal(t, `sample of 1.0 MiB from dump.tgz
+COMPRESSION  LEVEL  SIZE       RATIO   COMPRESS  SPEED        UNCOMPRESS  ENCRYPT
+gzip         1      256.0 KiB  25.0%   500ms     2.0 MiB/s    100ms       2ms
+none         -      1.0 MiB    100.0%  10ms      100.0 MiB/s  5ms         8ms
+`, out)
+		}},
+		{"json", "json", func(t *testing.T, out string) {
+			var parsed benchmarkOutput
+			require.NoError(t, json.Unmarshal([]byte(out), &parsed))
+			assert.Equal(t, "dump.tgz", parsed.Sample)
+			assert.Equal(t, 5.0, parsed.DurationSeconds)
+			require.Len(t, parsed.Compressions, 2)
+			assert.Equal(t, compressionBenchmarkOutput{Compression: "gzip", Level: 1, Size: 256 << 10, Ratio: 0.25, CompressSeconds: 0.5, CompressBytesPerSecond: 2 << 20, UncompressSeconds: 0.1, EncryptSeconds: 0.002}, parsed.Compressions[0])
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockExecs()
+			m.On("Benchmark", mock.Anything).Return(results, nil)
+			cmd, err := rootCmd(m)
+			require.NoError(t, err)
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetErr(io.Discard)
+			cmd.SetArgs([]string{"benchmark", "--sample", "dump.tgz", "--output", tt.output})
+			require.NoError(t, cmd.Execute())
+			tt.check(t, out.String())
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/storage"
+)
+
+func checkCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
+	if cmdConfig == nil {
+		return nil, fmt.Errorf("cmdConfig is nil")
+	}
+	var v *viper.Viper
+	var cmd = &cobra.Command{
+		Use:     "check",
+		Aliases: []string{"validate"},
+		Short:   "check that dumps can be written to targets",
+		Long: `Check that dumps can be written to each target, by writing a tiny probe file to it and removing it again.
+		The targets are not listed, so that the check works with credentials that may write, but not list, as a
+		least-privilege policy may grant. Without --target, checks the targets that dump writes to in the configuration file.
+		Fails if any target cannot be written; one that can be written, but not removed from, is reported, as dumps
+		cannot be pruned from it.`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			bindFlags(cmd, v)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmdConfig.logger.Debug("starting check")
+			targetURLs := v.GetStringSlice("target")
+			var targets []storage.Storage
+			if len(targetURLs) > 0 {
+				for _, t := range targetURLs {
+					store, err := parseTarget(t, cmdConfig)
+					if err != nil {
+						return err
+					}
+					targets = append(targets, store)
+				}
+			} else if cmdConfig.configuration != nil {
+				for _, t := range cmdConfig.configuration.DumpTargets() {
+					target, ok := cmdConfig.configuration.Targets[t]
+					if !ok {
+						return fmt.Errorf("target %s from dump configuration not found in targets configuration", t)
+					}
+					store, err := target.Storage.Storage()
+					if err != nil {
+						return fmt.Errorf("target %s from dump configuration has invalid URL: %v", t, err)
+					}
+					targets = append(targets, store)
+				}
+			}
+			if len(targets) == 0 {
+				return fmt.Errorf("no targets to check, neither --target nor in the configuration file")
+			}
+
+			var executor execs
+			executor = &core.Executor{}
+			if passedExecs != nil {
+				executor = passedExecs
+			}
+			executor.SetLogger(cmdConfig.logger)
+
+			// at this point, any errors should not have usage
+			cmd.SilenceUsage = true
+			uid := uuid.New()
+			if _, err := executor.CheckTargets(cmd.Context(), core.CheckOptions{Targets: targets, Run: uid}); err != nil {
+				return fmt.Errorf("error checking targets: %v", err)
+			}
+			executor.GetLogger().WithField("run", uid.String()).Info("Check complete")
+			return nil
+		},
+	}
+	// target - where the backups are to be saved
+	v = viper.New()
+	v.SetEnvPrefix("db_check")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+
+	flags := cmd.Flags()
+	flags.StringSlice("target", []string{}, "full URL target to check, or a reference to a target in the configuration file, e.g. `config://targetname`. Accepts multiple targets. Defaults to the targets of dump in the configuration file.")
+
+	return cmd, nil
+}
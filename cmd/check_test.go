@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"io"
+	"net/url"
+	"testing"
+
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCheckCmd(t *testing.T) {
+	t.Parallel()
+	fileTarget := "file:///foo/bar"
+	fileTargetURL, _ := url.Parse(fileTarget)
+	otherTarget := "file:///foo/baz"
+	otherTargetURL, _ := url.Parse(otherTarget)
+
+	tests := []struct {
+		name                 string
+		args                 []string // "check" will be prepended automatically
+		wantErr              bool
+		expectedCheckOptions core.CheckOptions
+	}{
+		{"no targets", []string{}, true, core.CheckOptions{}},
+		{"invalid target URL", []string{"--target", "def"}, true, core.CheckOptions{}},
+		{"file URL", []string{"--target", fileTarget}, false, core.CheckOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}}},
+		{"multiple targets", []string{"--target", fileTarget, "--target", otherTarget}, false, core.CheckOptions{Targets: []storage.Storage{file.New(*fileTargetURL), file.New(*otherTargetURL)}}},
+		{"config file", []string{"--config-file", "testdata/config.yml"}, false, core.CheckOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockExecs()
+			m.On("CheckTargets", mock.MatchedBy(func(checkOpts core.CheckOptions) bool {
+				if equalIgnoreFields(checkOpts, tt.expectedCheckOptions, []string{"Run"}) {
+					return true
+				}
+				t.Errorf("checkOpts compare failed: %#v %#v", checkOpts, tt.expectedCheckOptions)
+				return false
+			})).Return(nil)
+			cmd, err := rootCmd(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd.SetOutput(io.Discard)
+			cmd.SetArgs(append([]string{"check"}, tt.args...))
+			err = cmd.Execute()
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			case err == nil:
+				m.AssertExpectations(t)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"reflect"
 
 	"github.com/databacker/mysql-backup/pkg/core"
@@ -19,27 +20,52 @@ func newMockExecs() *mockExecs {
 	return m
 }
 
-func (m *mockExecs) Dump(opts core.DumpOptions) (core.DumpResults, error) {
+func (m *mockExecs) Dump(ctx context.Context, opts core.DumpOptions) (core.DumpResults, error) {
 	args := m.Called(opts)
 	return core.DumpResults{}, args.Error(0)
 }
 
-func (m *mockExecs) Restore(opts core.RestoreOptions) error {
+func (m *mockExecs) Restore(ctx context.Context, opts core.RestoreOptions) (core.RestoreResults, error) {
+	args := m.Called(opts)
+	return core.RestoreResults{}, args.Error(0)
+}
+
+func (m *mockExecs) Fetch(ctx context.Context, opts core.FetchOptions) (core.FetchResults, error) {
+	args := m.Called(opts)
+	return core.FetchResults{}, args.Error(0)
+}
+
+func (m *mockExecs) Prune(ctx context.Context, opts core.PruneOptions) error {
+	args := m.Called(opts)
+	return args.Error(0)
+}
+func (m *mockExecs) CheckTargets(ctx context.Context, opts core.CheckOptions) (core.CheckResults, error) {
+	args := m.Called(opts)
+	return core.CheckResults{}, args.Error(0)
+}
+
+func (m *mockExecs) Benchmark(ctx context.Context, opts core.BenchmarkOptions) (core.BenchmarkResults, error) {
+	args := m.Called(opts)
+	return args.Get(0).(core.BenchmarkResults), args.Error(1)
+}
+
+func (m *mockExecs) Protect(ctx context.Context, opts core.ProtectOptions) error {
 	args := m.Called(opts)
 	return args.Error(0)
 }
 
-func (m *mockExecs) Prune(opts core.PruneOptions) error {
+func (m *mockExecs) WaitForDatabase(ctx context.Context, opts core.WaitOptions) error {
 	args := m.Called(opts)
 	return args.Error(0)
 }
-func (m *mockExecs) Timer(timerOpts core.TimerOptions, cmd func() error) error {
+
+func (m *mockExecs) Timer(ctx context.Context, timerOpts core.TimerOptions, cmd func(ctx context.Context) error) error {
 	args := m.Called(timerOpts)
 	err := args.Error(0)
 	if err != nil {
 		return err
 	}
-	return cmd()
+	return cmd(ctx)
 }
 
 func (m *mockExecs) SetLogger(logger *log.Logger) {
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/databacker/mysql-backup/pkg/config"
+)
+
+func configCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
+	var cmd = &cobra.Command{
+		Use:   "config",
+		Short: "work with the config file",
+		Long:  `Work with the config file, e.g. print the JSON Schema against which editors can validate it.`,
+		Args:  cobra.NoArgs,
+		// needs neither the database nor the config, which the root command would otherwise load; the same for
+		// each of its subcommands
+		PersistentPreRunE: func(c *cobra.Command, args []string) error {
+			return nil
+		},
+	}
+	var schema = &cobra.Command{
+		Use:   "schema",
+		Short: "print the JSON Schema of the config file",
+		Long: `Print the JSON Schema of the config file, derived from the config types of this version of mysql-backup,
+		so that editors can validate and complete it. Each target is checked against the settings of its type,
+		and the spec against the kind of config.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := config.Schema()
+			if err != nil {
+				return fmt.Errorf("unable to generate the schema: %v", err)
+			}
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+			return err
+		},
+	}
+	cmd.AddCommand(schema)
+	return cmd, nil
+}
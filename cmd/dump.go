@@ -1,16 +1,27 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/databacker/mysql-backup/pkg/backup"
 	"github.com/databacker/mysql-backup/pkg/compression"
+	"github.com/databacker/mysql-backup/pkg/config"
 	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/database"
+	"github.com/databacker/mysql-backup/pkg/notify"
 	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/storage/stdio"
+	"github.com/databacker/mysql-backup/pkg/util"
 )
 
 const (
@@ -19,6 +30,7 @@ const (
 	defaultFrequency        = 1440
 	defaultMaxAllowedPacket = 4194304
 	defaultFilenamePattern  = core.DefaultFilenamePattern
+	defaultRetryDelay       = time.Minute
 )
 
 func dumpCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
@@ -33,7 +45,7 @@ func dumpCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, er
 		Long: `Backup a database to a target location, once or on a schedule.
 		Can choose to dump all databases, only some by name, or all but excluding some.
 		The databases "information_schema", "performance_schema", "sys" and "mysql" are
-		excluded by default, unless you explicitly list them.`,
+		excluded by default, unless you explicitly list them or set --include-system-databases.`,
 		PreRun: func(cmd *cobra.Command, args []string) {
 			bindFlags(cmd, v)
 		},
@@ -42,114 +54,341 @@ func dumpCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, er
 			// check targets
 			targetURLs := v.GetStringSlice("target")
 			var (
-				targets []storage.Storage
-				err     error
+				targets        []storage.Storage
+				targetPolicies map[string]core.PrunePolicy
+				err            error
 			)
 			if len(targetURLs) > 0 {
 				for _, t := range targetURLs {
+					// stdout, for piping the dump to another program
+					if t == stdio.Name {
+						if slices.ContainsFunc(targets, storage.IsStream) {
+							return fmt.Errorf("stdout (-) can only be a target once")
+						}
+						targets = append(targets, stdio.New(nil, cmd.OutOrStdout()))
+						continue
+					}
 					store, err := storage.ParseURL(t, cmdConfig.creds)
 					if err != nil {
 						return fmt.Errorf("invalid target url: %v", err)
 					}
 					targets = append(targets, store)
 				}
-			} else {
-				// try the config file
-				if cmdConfig.configuration != nil {
-					// parse the target objects, then the ones listed for the backup
-					targetStructures := cmdConfig.configuration.Targets
-					dumpTargets := cmdConfig.configuration.Dump.Targets
-					for _, t := range dumpTargets {
-						var store storage.Storage
-						if target, ok := targetStructures[t]; !ok {
-							return fmt.Errorf("target %s from dump configuration not found in targets configuration", t)
-						} else {
-							store, err = target.Storage.Storage()
-							if err != nil {
-								return fmt.Errorf("target %s from dump configuration has invalid URL: %v", t, err)
-							}
-						}
-						targets = append(targets, store)
-					}
+			} else if cmdConfig.configuration != nil {
+				// try the config file: the targets listed for the backup, and the settings of each
+				configuration := *cmdConfig.configuration
+				if _, targets, err = backup.DumpTargets(configuration); err != nil {
+					return err
+				}
+				if targetPolicies, err = backup.TargetPrunePolicies(configuration); err != nil {
+					return err
 				}
 			}
 			if len(targets) == 0 {
 				return fmt.Errorf("no targets specified")
 			}
-			safechars := v.GetBool("safechars")
-			if !v.IsSet("safechars") && cmdConfig.configuration != nil {
-				safechars = cmdConfig.configuration.Dump.Safechars
+			// the dump options of the config file, if any, with each of the flags that is set on top
+			var cfg config.ConfigSpec
+			if cmdConfig.configuration != nil {
+				cfg = *cmdConfig.configuration
 			}
-			include := v.GetStringSlice("include")
-			if len(include) == 0 && cmdConfig.configuration != nil {
-				include = cmdConfig.configuration.Dump.Include
+			if len(targetURLs) > 0 {
+				// the targets of the flags replace those of the config file, along with their settings
+				cfg.Dump.Targets, cfg.DefaultTargets = nil, nil
 			}
-			// make this slice nil if it's empty, so it is consistent; used mainly for test consistency
-			if len(include) == 0 {
-				include = nil
+			dumpOpts, err := backup.DumpOptions(cfg, targets)
+			if err != nil {
+				return err
 			}
-			exclude := v.GetStringSlice("exclude")
-			if len(exclude) == 0 && cmdConfig.configuration != nil {
-				exclude = cmdConfig.configuration.Dump.Exclude
+			if v.IsSet("safechars") {
+				dumpOpts.Safechars = v.GetBool("safechars")
 			}
-			// make this slice nil if it's empty, so it is consistent; used mainly for test consistency
-			if len(exclude) == 0 {
-				exclude = nil
+			if include := v.GetStringSlice("include"); len(include) > 0 {
+				dumpOpts.DBNames = include
 			}
-			preBackupScripts := v.GetString("pre-backup-scripts")
-			if preBackupScripts == "" && cmdConfig.configuration != nil {
-				preBackupScripts = cmdConfig.configuration.Dump.Scripts.PreBackup
+			if exclude := v.GetStringSlice("exclude"); len(exclude) > 0 {
+				dumpOpts.Exclude = exclude
 			}
-			postBackupScripts := v.GetString("post-backup-scripts")
-			if postBackupScripts == "" && cmdConfig.configuration != nil {
-				postBackupScripts = cmdConfig.configuration.Dump.Scripts.PostBackup
+			if v.IsSet("include-system-databases") {
+				dumpOpts.IncludeSystemDatabases = v.GetBool("include-system-databases")
 			}
-			noDatabaseName := v.GetBool("no-database-name")
-			if !v.IsSet("no-database-name") && cmdConfig.configuration != nil {
-				noDatabaseName = cmdConfig.configuration.Dump.NoDatabaseName
+			if separateTables := v.GetStringSlice("separate-tables"); len(separateTables) > 0 {
+				dumpOpts.SeparateTables = separateTables
 			}
-			compact := v.GetBool("compact")
-			if !v.IsSet("compact") && cmdConfig.configuration != nil {
-				compact = cmdConfig.configuration.Dump.Compact
+			if v.IsSet("skip-duplicates") {
+				dumpOpts.SkipDuplicates = v.GetBool("skip-duplicates")
 			}
-			maxAllowedPacket := v.GetInt("max-allowed-packet")
-			if !v.IsSet("max-allowed-packet") && cmdConfig.configuration != nil && cmdConfig.configuration.Dump.MaxAllowedPacket != 0 {
-				maxAllowedPacket = cmdConfig.configuration.Dump.MaxAllowedPacket
+			if stateFile := v.GetString("state-file"); stateFile != "" {
+				dumpOpts.StateFile = stateFile
 			}
-
-			// compression algorithm: check config, then CLI/env var overrides
-			var (
-				compressionAlgo string
-				compressor      compression.Compressor
-			)
-			if cmdConfig.configuration != nil {
-				compressionAlgo = cmdConfig.configuration.Dump.Compression
+			if skipUnchanged := v.GetString("skip-unchanged"); skipUnchanged != "" {
+				if err := database.ValidateChanges(skipUnchanged); err != nil {
+					return err
+				}
+				dumpOpts.SkipUnchanged = skipUnchanged
 			}
-			compressionVar := v.GetString("compression")
-			if compressionVar != "" {
-				compressionAlgo = compressionVar
+			if dumpOpts.SkipUnchanged != "" && dumpOpts.StateFile == "" {
+				return fmt.Errorf("skip-unchanged requires a state file")
 			}
-			if compressionAlgo != "" {
-				compressor, err = compression.GetCompressor(compressionAlgo)
-				if err != nil {
-					return fmt.Errorf("failure to get compression '%s': %v", compressionAlgo, err)
+			if v.IsSet("link-unchanged") {
+				dumpOpts.LinkUnchanged = v.GetBool("link-unchanged")
+			}
+			if lockFile := v.GetString("lock-file"); lockFile != "" {
+				if dumpOpts.Lock.File == "" {
+					dumpOpts.Lock = core.LockOptions{Stale: v.GetDuration("lock-stale")}
+				}
+				dumpOpts.Lock.File = lockFile
+			}
+			if dumpOpts.Lock.File != "" {
+				if v.IsSet("lock-wait") {
+					dumpOpts.Lock.Wait = v.GetDuration("lock-wait")
+				}
+				if v.IsSet("lock-stale") {
+					dumpOpts.Lock.Stale = v.GetDuration("lock-stale")
+				}
+				if dumpOpts.Lock.Wait < 0 || dumpOpts.Lock.Stale < 0 {
+					return fmt.Errorf("invalid lock wait %s or stale %s, must not be negative", dumpOpts.Lock.Wait, dumpOpts.Lock.Stale)
 				}
 			}
+			if v.IsSet("report-history") {
+				dumpOpts.Report.History = v.GetInt("report-history")
+			}
+			if v.IsSet("report-format") {
+				dumpOpts.Report.Format = v.GetString("report-format")
+			}
+			if err := core.ValidateReport(dumpOpts.Report); err != nil {
+				return err
+			}
+			if v.IsSet("nice") {
+				dumpOpts.Priority.Nice = v.GetInt("nice")
+			}
+			if ionice := v.GetString("ionice"); ionice != "" {
+				dumpOpts.Priority.IONice = ionice
+			}
+			if err := core.ValidatePriority(dumpOpts.Priority); err != nil {
+				return err
+			}
+			// the replica of the server given by the flags, or of the one in the config file
+			if dumpOpts.Replica, err = backup.Replica(cfg.Database, cmdConfig.dbconn); err != nil {
+				return err
+			}
+			// each of multiple servers has its own replica, if any, which only the config file can set
+			for _, d := range cfg.Databases {
+				if _, err := backup.Replica(d.Database, database.Connection{}); err != nil {
+					return fmt.Errorf("server %s: %v", d.Server, err)
+				}
+			}
+			replica := dumpOpts.Replica
+			if replicaServer := v.GetString("replica-server"); replicaServer != "" {
+				if replica == nil {
+					replica = &core.ReplicaOptions{DBConn: cmdConfig.dbconn}
+				}
+				replica.DBConn.Host = replicaServer
+			}
+			if replica != nil {
+				if replicaPort := v.GetInt("replica-port"); replicaPort != 0 {
+					replica.DBConn.Port = replicaPort
+				}
+				if v.IsSet("replica-max-lag") {
+					replica.MaxLag = v.GetDuration("replica-max-lag")
+				}
+				if v.IsSet("replica-fallback") {
+					replica.Fallback = v.GetBool("replica-fallback")
+				}
+				if replica.MaxLag < 0 {
+					return fmt.Errorf("invalid replica max lag %s, must not be negative", replica.MaxLag)
+				}
+			}
+			if latest := v.GetString("latest"); latest != "" {
+				dumpOpts.Latest = latest
+			}
+			if compressionDictionary := v.GetString("compression-dictionary"); compressionDictionary != "" {
+				dumpOpts.CompressionDictionary = compressionDictionary
+			}
+			if v.IsSet("skip-compression-if-incompressible") {
+				dumpOpts.SkipCompressionIfIncompressible = v.GetBool("skip-compression-if-incompressible")
+			}
+			output := v.GetString("output")
+			if err := validateOutput(output); err != nil {
+				return err
+			}
+			if preBackupScripts := v.GetString("pre-backup-scripts"); preBackupScripts != "" {
+				dumpOpts.PreBackupScripts = preBackupScripts
+			}
+			if postBackupScripts := v.GetString("post-backup-scripts"); postBackupScripts != "" {
+				dumpOpts.PostBackupScripts = postBackupScripts
+			}
+			// the command that runs the scripts, split on whitespace, as the config file has it as a list
+			if scriptsExec := strings.Fields(v.GetString("scripts-exec")); len(scriptsExec) > 0 {
+				dumpOpts.ScriptsExec = scriptsExec
+			}
+			if v.IsSet("no-database-name") {
+				dumpOpts.SuppressUseDatabase = v.GetBool("no-database-name")
+			}
+			if v.IsSet("compact") {
+				dumpOpts.Compact = v.GetBool("compact")
+			}
+			if v.IsSet("hex-blob") {
+				dumpOpts.HexBlob = v.GetBool("hex-blob")
+			}
+			// the character set and collation are of the connection to each server, so are set on it for each dump
+			characterSet, collation := dumpOpts.DBConn.Charset, dumpOpts.DBConn.Collation
+			if flagCharacterSet := v.GetString("character-set"); flagCharacterSet != "" {
+				if err := database.ValidateCharset(flagCharacterSet); err != nil {
+					return err
+				}
+				characterSet = flagCharacterSet
+			}
+			if flagCollation := v.GetString("collation"); flagCollation != "" {
+				collation = flagCollation
+			}
+			if collation != "" {
+				if err := database.ValidateCollation(characterSet, collation); err != nil {
+					return err
+				}
+			}
+			if v.IsSet("skip-set-charset") {
+				dumpOpts.SkipSetCharset = v.GetBool("skip-set-charset")
+			}
+			if err := database.ValidateSkipSetCharset(dumpOpts.SkipSetCharset, characterSet); err != nil {
+				return err
+			}
+			if v.IsSet("order-by-primary") {
+				dumpOpts.OrderByPrimary = v.GetBool("order-by-primary")
+			}
+			if v.IsSet("skip-tz-utc") {
+				dumpOpts.SkipTzUtc = v.GetBool("skip-tz-utc")
+			}
+			if objectTypes := v.GetStringSlice("object-types"); len(objectTypes) > 0 {
+				if err := database.ValidateObjectTypes(objectTypes); err != nil {
+					return err
+				}
+				dumpOpts.ObjectTypes = objectTypes
+			}
+			// from the flag itself, as viper would split the clauses, which have spaces and commas
+			whereClauses, err := cmd.Flags().GetStringArray("where")
+			if err != nil {
+				return err
+			}
+			where, err := database.ParseWhere(whereClauses)
+			if err != nil {
+				return err
+			}
+			if where != nil {
+				dumpOpts.Where = where
+			}
+			// from the flag itself as well, as viper would split the partitions of a table
+			partitionSelections, err := cmd.Flags().GetStringArray("partitions")
+			if err != nil {
+				return err
+			}
+			partitions, err := database.ParsePartitions(partitionSelections)
+			if err != nil {
+				return err
+			}
+			if partitions != nil {
+				dumpOpts.Partitions = partitions
+			}
+			if v.IsSet("verify-upload") {
+				dumpOpts.VerifyUpload = v.GetBool("verify-upload")
+			}
+			if v.IsSet("consistent-across-databases") {
+				dumpOpts.ConsistentAcrossDatabases = v.GetBool("consistent-across-databases")
+			}
+			if keepSQL := v.GetString("keep-sql"); keepSQL != "" {
+				dumpOpts.KeepSQL = keepSQL
+			}
+			if maxDumpSize := v.GetString("max-dump-size"); maxDumpSize != "" {
+				if dumpOpts.MaxDumpSize, err = util.ParseSize(maxDumpSize); err != nil {
+					return fmt.Errorf("invalid max dump size: %v", err)
+				}
+			}
+			if v.IsSet("max-allowed-packet") {
+				dumpOpts.MaxAllowedPacket = v.GetInt("max-allowed-packet")
+			}
+			if v.IsSet("rows-per-insert") {
+				dumpOpts.RowsPerInsert = v.GetInt("rows-per-insert")
+			}
+			if v.IsSet("skip-extended-insert") {
+				dumpOpts.SkipExtendedInsert = v.GetBool("skip-extended-insert")
+			}
+			if err := database.ValidateRowsPerInsert(dumpOpts.RowsPerInsert, dumpOpts.SkipExtendedInsert); err != nil {
+				return err
+			}
+			if v.IsSet("compression-threads") {
+				dumpOpts.CompressionThreads = v.GetInt("compression-threads")
+				if err := compression.ValidateThreads(dumpOpts.CompressionThreads); err != nil {
+					return err
+				}
+			}
+			if label := v.GetString("label"); label != "" {
+				if err := core.ValidateLabel(label); err != nil {
+					return err
+				}
+				dumpOpts.Label = label
+			}
+			if tmpPath := v.GetString("tmp-path"); tmpPath != "" {
+				dumpOpts.Tmp.Path = tmpPath
+			}
+			if v.IsSet("private-tmp") {
+				dumpOpts.Tmp.Private = v.GetBool("private-tmp")
+			}
+			if v.IsSet("filename-pattern") {
+				dumpOpts.FilenamePattern = v.GetString("filename-pattern")
+			}
+			if dumpOpts.FilenamePattern == "" {
+				dumpOpts.FilenamePattern = defaultFilenamePattern
+			}
 
+			// compression algorithm, and the level, which is in the scale of the algorithm, so is parsed again
+			// with the flags for either
+			if v.IsSet("compression") {
+				compressionAlgo := v.GetString("compression")
+				if dumpOpts.Compressor, err = compression.GetCompressor(compressionAlgo); err != nil {
+					return fmt.Errorf("failure to get compression '%s': %v", compressionAlgo, err)
+				}
+			}
+			compressionLevel := cfg.Dump.CompressionLevel
+			if compressionLevelVar := v.GetString("compression-level"); compressionLevelVar != "" {
+				compressionLevel = compressionLevelVar
+			}
+			compressionLevelAuto := cfg.Dump.CompressionLevelAuto
+			if small := v.GetString("compression-level-small"); small != "" {
+				compressionLevelAuto.Small = small
+			}
+			if large := v.GetString("compression-level-large"); large != "" {
+				compressionLevelAuto.Large = large
+			}
+			if dumpOpts.CompressionLevel, dumpOpts.AutoCompressionLevel, err = compression.ParseLevel(compressionLevel, compressionLevelAuto.Small, compressionLevelAuto.Large, dumpOpts.Compressor); err != nil {
+				return err
+			}
 			// retention, if enabled
 			retention := v.GetString("retention")
 			if retention == "" && cmdConfig.configuration != nil {
 				retention = cmdConfig.configuration.Prune.Retention
 			}
-			filenamePattern := v.GetString("filename-pattern")
-
-			if !v.IsSet("filename-pattern") && cmdConfig.configuration != nil {
-				filenamePattern = cmdConfig.configuration.Dump.FilenamePattern
+			keepLast := v.GetInt("keep-last")
+			if !v.IsSet("keep-last") && cmdConfig.configuration != nil {
+				keepLast = cmdConfig.configuration.Prune.KeepLast
 			}
-			if filenamePattern == "" {
-				filenamePattern = defaultFilenamePattern
+			keepWithin := v.GetString("keep-within")
+			if keepWithin == "" && cmdConfig.configuration != nil {
+				keepWithin = cmdConfig.configuration.Prune.KeepWithin
+			}
+			pruning := retention != "" || keepLast != 0 || keepWithin != "" || len(targetPolicies) > 0
+			// prune cron, to prune on a schedule of its own rather than after each dump
+			pruneCron := v.GetString("prune-cron")
+			if pruneCron == "" && cmdConfig.configuration != nil {
+				pruneCron = cmdConfig.configuration.Prune.Cron
+			}
+			if pruneCron != "" {
+				if err := core.ValidateCron(pruneCron); err != nil {
+					return fmt.Errorf("invalid prune cron schedule %q: %v", pruneCron, err)
+				}
+				if !pruning {
+					return fmt.Errorf("a prune cron schedule requires retention, keep-last or keep-within, to know what to prune")
+				}
 			}
-
 			// timer options
 			once := v.GetBool("once")
 			if !v.IsSet("once") && cmdConfig.configuration != nil {
@@ -159,6 +398,11 @@ func dumpCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, er
 			if cron == "" && cmdConfig.configuration != nil {
 				cron = cmdConfig.configuration.Dump.Schedule.Cron
 			}
+			if cron != "" {
+				if err := core.ValidateCron(cron); err != nil {
+					return fmt.Errorf("invalid cron schedule %q: %v", cron, err)
+				}
+			}
 			begin := v.GetString("begin")
 			if begin == "" && cmdConfig.configuration != nil {
 				begin = cmdConfig.configuration.Dump.Schedule.Begin
@@ -167,11 +411,88 @@ func dumpCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, er
 			if frequency == 0 && cmdConfig.configuration != nil {
 				frequency = cmdConfig.configuration.Dump.Schedule.Frequency
 			}
+			triggerListen := v.GetString("trigger-listen")
+			if triggerListen == "" && cmdConfig.configuration != nil {
+				triggerListen = cmdConfig.configuration.Dump.Schedule.TriggerListen
+			}
+			runOnStart := v.GetBool("run-on-start")
+			if !v.IsSet("run-on-start") && cmdConfig.configuration != nil {
+				runOnStart = cmdConfig.configuration.Dump.Schedule.RunOnStart
+			}
+			// from the flag itself, as viper would split the windows, which have spaces and commas
+			blackout, err := cmd.Flags().GetStringArray("blackout")
+			if err != nil {
+				return err
+			}
+			if len(blackout) == 0 && cmdConfig.configuration != nil {
+				blackout = cmdConfig.configuration.Dump.Schedule.Blackout
+			}
+			// make this slice nil if it's empty, so it is consistent; used mainly for test consistency
+			if len(blackout) == 0 {
+				blackout = nil
+			}
+			if err := core.ValidateBlackout(blackout); err != nil {
+				return err
+			}
+			triggerOverridesBlackout := v.GetBool("trigger-overrides-blackout")
+			if !v.IsSet("trigger-overrides-blackout") && cmdConfig.configuration != nil {
+				triggerOverridesBlackout = cmdConfig.configuration.Dump.Schedule.TriggerOverridesBlackout
+			}
+			retryAttempts := v.GetInt("retry-attempts")
+			if !v.IsSet("retry-attempts") && cmdConfig.configuration != nil {
+				retryAttempts = cmdConfig.configuration.Dump.Schedule.Retry.Attempts
+			}
+			retryDelay := v.GetDuration("retry-delay")
+			if !v.IsSet("retry-delay") && cmdConfig.configuration != nil && cmdConfig.configuration.Dump.Schedule.Retry.Delay != 0 {
+				retryDelay = time.Duration(cmdConfig.configuration.Dump.Schedule.Retry.Delay)
+			}
+			retryOpts := core.RetryOptions{Attempts: retryAttempts, Delay: retryDelay}
+			waitForDB := v.GetDuration("wait-for-db")
+			if !v.IsSet("wait-for-db") && cmdConfig.configuration != nil && cmdConfig.configuration.Dump.Schedule.WaitForDatabase.Timeout != 0 {
+				waitForDB = time.Duration(cmdConfig.configuration.Dump.Schedule.WaitForDatabase.Timeout)
+			}
+			waitForDBInterval := v.GetDuration("wait-for-db-interval")
+			if !v.IsSet("wait-for-db-interval") && cmdConfig.configuration != nil && cmdConfig.configuration.Dump.Schedule.WaitForDatabase.Interval != 0 {
+				waitForDBInterval = time.Duration(cmdConfig.configuration.Dump.Schedule.WaitForDatabase.Interval)
+			}
+			if waitForDB < 0 {
+				return fmt.Errorf("invalid wait for db %s, must be at least 0", waitForDB)
+			}
+			// notifications and metrics, which only can be set in the config file
+			var notifiers []notify.Notifier
+			if cmdConfig.configuration != nil {
+				if notifiers, err = cmdConfig.configuration.Notifications.Notifiers(); err != nil {
+					return fmt.Errorf("invalid notifications configuration: %v", err)
+				}
+				metrics, err := cmdConfig.configuration.Metrics.Notifiers()
+				if err != nil {
+					return fmt.Errorf("invalid metrics configuration: %v", err)
+				}
+				notifiers = append(notifiers, metrics...)
+			}
+			// stdout has room for just the one file of one dump, and nothing else, so it is written once
+			if slices.ContainsFunc(targets, storage.IsStream) {
+				switch {
+				case output == outputJSON:
+					return fmt.Errorf("cannot dump to stdout (-) with --output json, which also writes to stdout")
+				case len(dumpOpts.SeparateTables) > 0:
+					return fmt.Errorf("cannot dump to stdout (-) with separate tables, which are files of their own")
+				case cmdConfig.dbconn.Host == "" && cmdConfig.configuration != nil && len(cmdConfig.configuration.Databases) > 1:
+					return fmt.Errorf("cannot dump to stdout (-) with multiple servers, each of which is a dump of its own")
+				}
+				once = true
+			}
+			// a single dump has no schedule on which to prune, so prunes after it as without one
+			schedulePrune := pruneCron != "" && !once
 			timerOpts := core.TimerOptions{
-				Once:      once,
-				Cron:      cron,
-				Begin:     begin,
-				Frequency: frequency,
+				Once:                     once,
+				Cron:                     cron,
+				Begin:                    begin,
+				Frequency:                frequency,
+				TriggerListen:            triggerListen,
+				RunOnStart:               runOnStart,
+				Blackout:                 blackout,
+				TriggerOverridesBlackout: triggerOverridesBlackout,
 			}
 			var executor execs
 			executor = &core.Executor{}
@@ -182,33 +503,121 @@ func dumpCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, er
 
 			// at this point, any errors should not have usage
 			cmd.SilenceUsage = true
-			if err := executor.Timer(timerOpts, func() error {
+			// the servers that the dumps connect to, which must be ready before the first one, rather than fail it
+			if waitForDB > 0 {
+				waitOpts := core.WaitOptions{DBConns: []database.Connection{cmdConfig.dbconn}, Timeout: waitForDB, Interval: waitForDBInterval}
+				if cmdConfig.dbconn.Host == "" && cmdConfig.configuration != nil && len(cmdConfig.configuration.Databases) > 0 {
+					waitOpts.DBConns = nil
+					for _, d := range cmdConfig.configuration.Databases {
+						waitOpts.DBConns = append(waitOpts.DBConns, newDumpServer(d, dumpOpts.DBNames, dumpOpts.Exclude).conn)
+					}
+				}
+				if err := executor.WaitForDatabase(cmd.Context(), waitOpts); err != nil {
+					return fmt.Errorf("error waiting for database: %w", err)
+				}
+			}
+			// held by each dump, and each scheduled prune, so that they never run at once
+			var runs sync.Mutex
+			if schedulePrune {
+				pruneCtx, cancelPrune := context.WithCancel(cmd.Context())
+				pruned := make(chan struct{})
+				go func() {
+					defer close(pruned)
+					pruneOpts := core.PruneOptions{Targets: targets, Retention: retention, KeepLast: keepLast, KeepWithin: keepWithin, TargetPolicies: targetPolicies, TargetFilenamePatterns: dumpOpts.TargetFilenamePatterns, Label: dumpOpts.Label}
+					_ = runPruneSchedule(pruneCtx, executor, pruneCron, &runs, pruneOpts, notifiers)
+				}()
+				defer func() {
+					cancelPrune()
+					<-pruned
+				}()
+			}
+			if err := executor.Timer(cmd.Context(), timerOpts, func(ctx context.Context) error {
+				runs.Lock()
+				defer runs.Unlock()
 				uid := uuid.New()
-				dumpOpts := core.DumpOptions{
-					Targets:             targets,
-					Safechars:           safechars,
-					DBNames:             include,
-					DBConn:              cmdConfig.dbconn,
-					Compressor:          compressor,
-					Exclude:             exclude,
-					PreBackupScripts:    preBackupScripts,
-					PostBackupScripts:   postBackupScripts,
-					SuppressUseDatabase: noDatabaseName,
-					Compact:             compact,
-					MaxAllowedPacket:    maxAllowedPacket,
-					Run:                 uid,
-					FilenamePattern:     filenamePattern,
-				}
-				_, err := executor.Dump(dumpOpts)
-				if err != nil {
-					return fmt.Errorf("error running dump: %w", err)
+				notifyLogger := executor.GetLogger().WithField("run", uid.String())
+				// with --output json, report the outcome of the run, whether or not it succeeded
+				out := dumpOutput{Run: uid.String(), Trigger: core.TriggeredBy(ctx), Servers: []dumpServerOutput{}}
+				finish := func(err error) error {
+					if output != outputJSON {
+						return err
+					}
+					out.Success = err == nil
+					if err != nil {
+						out.Error = err.Error()
+					}
+					if printErr := printJSON(cmd.OutOrStdout(), out); printErr != nil {
+						notifyLogger.Warnf("unable to print output: %v", printErr)
+					}
+					return err
 				}
-				if retention != "" {
-					if err := executor.Prune(core.PruneOptions{Targets: targets, Retention: retention}); err != nil {
-						return fmt.Errorf("error running prune: %w", err)
+				// each server to dump; normally just the one, but the config file can list several
+				servers := []dumpServer{{conn: cmdConfig.dbconn, replica: replica, include: dumpOpts.DBNames, exclude: dumpOpts.Exclude}}
+				if cmdConfig.dbconn.Host == "" && cmdConfig.configuration != nil && len(cmdConfig.configuration.Databases) > 0 {
+					servers = nil
+					for _, d := range cmdConfig.configuration.Databases {
+						servers = append(servers, newDumpServer(d, dumpOpts.DBNames, dumpOpts.Exclude))
 					}
 				}
-				return nil
+				var errs []error
+				for _, server := range servers {
+					server.conn.Charset = characterSet
+					server.conn.Collation = collation
+					if server.replica != nil {
+						server.replica.DBConn.Charset = characterSet
+						server.replica.DBConn.Collation = collation
+					}
+					// the options of the run, for the server
+					serverOpts := dumpOpts
+					serverOpts.Run = uid
+					serverOpts.Server = server.name
+					serverOpts.DBConn = server.conn
+					serverOpts.Replica = server.replica
+					serverOpts.DBNames = server.include
+					serverOpts.Exclude = server.exclude
+					start := time.Now()
+					// only the last attempt is notified, once there is no retry left
+					var results core.DumpResults
+					err := core.WithRetries(ctx, retryOpts, notifyLogger, func() (err error) {
+						results, err = executor.Dump(ctx, serverOpts)
+						return err
+					})
+					event := notify.Event{
+						Run:             uid,
+						Operation:       notify.OperationDump,
+						Server:          server.name,
+						Databases:       results.Databases,
+						Start:           start,
+						End:             time.Now(),
+						Err:             err,
+						Trigger:         core.TriggeredBy(ctx),
+						PreviousSuccess: notify.EarliestSuccess(results.PreviousSuccess),
+					}
+					if len(event.Databases) == 0 {
+						event.Databases = server.include
+					}
+					notify.Send(ctx, notifiers, event, notifyLogger)
+					// the main dump, plus one per separate table, goes to each target
+					out.Servers = append(out.Servers, newDumpServerOutput(server.name, targets, 1+len(dumpOpts.SeparateTables), results, err))
+					if err != nil && len(servers) == 1 {
+						return finish(fmt.Errorf("error running dump: %w", err))
+					}
+					// with multiple servers, one failing should not stop the others
+					if err != nil {
+						executor.GetLogger().Errorf("error running dump of server %s: %v", server.name, err)
+						errs = append(errs, fmt.Errorf("server %s: %w", server.name, err))
+					}
+				}
+				if pruning && !schedulePrune {
+					if err := executor.Prune(ctx, core.PruneOptions{Targets: targets, Retention: retention, KeepLast: keepLast, KeepWithin: keepWithin, TargetPolicies: targetPolicies, TargetFilenamePatterns: dumpOpts.TargetFilenamePatterns, Label: dumpOpts.Label}); err != nil {
+						notify.Send(ctx, notifiers, notify.Event{Run: uid, Operation: notify.OperationPrune, Err: err}, notifyLogger)
+						return finish(fmt.Errorf("error running prune: %w", err))
+					}
+				}
+				if len(errs) > 0 {
+					return finish(fmt.Errorf("error running dump: %w", errors.Join(errs...)))
+				}
+				return finish(nil)
 			}); err != nil {
 				return fmt.Errorf("error running command: %w", err)
 			}
@@ -227,7 +636,8 @@ func dumpCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, er
 	flags.StringSlice("target", []string{}, `full URL target to where the backups should be saved. Should be a directory. Accepts multiple targets. Supports three formats:
 Local: If if starts with a "/" character of "file:///", will dump to a local path, which should be volume-mounted.
 SMB: If it is a URL of the format smb://hostname/share/path/ then it will connect via SMB.
-S3: If it is a URL of the format s3://bucketname/path then it will connect via S3 protocol.`)
+S3: If it is a URL of the format s3://bucketname/path then it will connect via S3 protocol.
+Stdout: If it is "-", will write the dump to stdout, to pipe it to another program; implies --once.`)
 
 	// include - include of databases to back up
 	flags.StringSlice("include", []string{}, "names of databases to dump; empty to do all")
@@ -235,6 +645,47 @@ S3: If it is a URL of the format s3://bucketname/path then it will connect via S
 	// exclude
 	flags.StringSlice("exclude", []string{}, "databases to exclude from the dump.")
 
+	// include-system-databases - when dumping all databases, include the system ones
+	flags.Bool("include-system-databases", false, "When dumping all databases, i.e. include is empty, also dump the system databases information_schema, performance_schema, sys and mysql.")
+
+	// separate-tables - tables to dump to their own files
+	flags.StringSlice("separate-tables", []string{}, "tables to dump to their own files, separate from the main dump, in the format <database>.<table>.")
+
+	// skip-duplicates - do not upload a dump identical to one already on the target
+	flags.Bool("skip-duplicates", false, "Do not upload a dump if the target already has a dump with identical content; alias to the existing one where the target supports it.")
+
+	// state-file - record of successful dumps
+	flags.String("state-file", "", "Local file in which to record the time of each successful dump to each target, to report the time since the previous success. Empty to not record.")
+
+	// skip-unchanged - skip dumps of data that has not changed
+	flags.String("skip-unchanged", "", "Skip the dump if the databases have not changed since the last dump, as detected by `update-time`, the update times of the tables, `checksum`, a CHECKSUM TABLE of each table, or `binlog`, the binary log position. Requires --state-file, in which the last dump is recorded. Empty to dump every time.")
+	flags.Bool("link-unchanged", false, "When a dump is skipped as unchanged, link the name it would have had to the last dump, on targets that can link.")
+
+	// report - of the recent runs, on each target
+	flags.Int("report-history", 0, "Keep a report of this many of the most recent runs on each target, with their sizes, durations and failures, updated after each run, for those without access to the logs. 0 for no report.")
+	flags.String("report-format", "", "Format of the report on each target: `text`, as report.txt, or `html`, as report.html. Empty for text.")
+
+	// nice and ionice - so that dumps compete less with the database
+	flags.Int("nice", 0, "Niceness, from 1 to 19, the lowest priority, at which to dump, as for nice, so that dumps compete less with the database for CPU. Applies to the whole process, including compression, uploads and scripts, from the first dump on. Linux only; skipped elsewhere. 0 to leave it as it is.")
+	flags.String("ionice", "", "I/O scheduling class in which to dump, as for ionice: idle, to use the disk only when nothing else does, or best-effort, at its lowest level, so that dumps compete less with the database for I/O. Applies to the whole process from the first dump on. Linux only; skipped elsewhere. Empty to leave it as it is.")
+
+	// lock-file - so that dumps do not overlap
+	flags.String("lock-file", "", "Local file to hold as a lock for each dump, so that two dumps, e.g. from overlapping cron jobs, do not run at once. A dump that finds the lock held waits for --lock-wait, then fails. Empty for no lock.")
+	flags.Duration("lock-wait", 0, "How long a dump waits for the lock held by another dump to be released, e.g. `10m`. 0 to fail at once.")
+	flags.Duration("lock-stale", core.DefaultLockStale, "How old a lock may be before it is taken to be left by a dump that crashed, when its process cannot be checked, e.g. as it was on another host or container. A lock of a process on this host that is no longer running is always stale. 0 to only check the process.")
+
+	// replica - dump from a read replica of the server, rather than the server itself
+	flags.String("replica-server", "", "Hostname of a read replica of the server from which to dump, to spare the server the load, as long as the replica is replicating, and not more than --replica-max-lag behind. Uses the port and credentials of the server. Empty to dump from the server.")
+	flags.Int("replica-port", 0, "Port of the replica, if not that of the server.")
+	flags.Duration("replica-max-lag", 0, "The most that the replica may be behind the server for the dump to use it, e.g. `5m`. 0 for any amount, as long as it is replicating.")
+	flags.Bool("replica-fallback", false, "Dump from the server if the replica is too far behind, or its lag cannot be checked, rather than failing the dump.")
+
+	// output - format of the summary of each run
+	flags.String("output", outputText, "Format of the summary of each run: `text` for just the logs, or `json` to also print a JSON summary of each run, with the outcome for each target, on stdout, one line per run.")
+
+	// latest - alias for the most recent dump
+	flags.String("latest", "", "Filename pattern of an alias to point at the most recent dump on each target, e.g. `latest.{{ .compression }}`. A symlink for file targets, and a copy for others. Empty for no alias.")
+
 	// single database, do not include `USE database;` in dump
 	flags.Bool("no-database-name", false, "Omit `USE <database>;` in the dump, so it can be restored easily to a different database.")
 
@@ -245,16 +696,51 @@ S3: If it is a URL of the format s3://bucketname/path then it will connect via S
 	flags.String("begin", defaultBegin, "What time to do the first dump. Must be in one of two formats: Absolute: HHMM, e.g. `2330` or `0415`; or Relative: +MM, i.e. how many minutes after starting the container, e.g. `+0` (immediate), `+10` (in 10 minutes), or `+90` in an hour and a half")
 
 	// cron
-	flags.String("cron", "", "Set the dump schedule using standard [crontab syntax](https://en.wikipedia.org/wiki/Cron), a single line.")
+	flags.String("cron", "", "Set the dump schedule using standard [crontab syntax](https://en.wikipedia.org/wiki/Cron), a single line, with an optional seconds field first, e.g. `0 30 2 * * *`.")
 
 	// once
 	flags.Bool("once", false, "Override all other settings and run the dump once immediately and exit. Useful if you use an external scheduler (e.g. as part of an orchestration solution like Cattle or Docker Swarm or [kubernetes cron jobs](https://kubernetes.io/docs/concepts/workloads/controllers/cron-jobs/)) and don't want the container to do the scheduling internally.")
 
+	// retry-attempts and retry-delay
+	flags.Int("retry-attempts", 0, "How many more times to try a dump that fails, e.g. because a target is unreachable, before giving up and notifying. Failures that a retry cannot fix, such as invalid options or rejected credentials, are not retried.")
+	flags.Duration("retry-delay", defaultRetryDelay, "How long to wait before each retry of a failed dump, e.g. `30s` or `5m`.")
+
+	// wait-for-db and wait-for-db-interval
+	flags.Duration("wait-for-db", 0, "How long to wait for the database to be ready before the first dump, e.g. `2m` when both start at once, checking it with SELECT 1. A database that rejects the connection, such as for its credentials, fails at once. 0 to not wait.")
+	flags.Duration("wait-for-db-interval", core.DefaultWaitInterval, "How long to wait between each check of whether the database is ready, with --wait-for-db, e.g. `5s`.")
+
+	// run-on-start
+	flags.Bool("run-on-start", false, "Run a dump immediately on start, and then on the schedule, e.g. for a fresh backup after every deploy.")
+
+	// blackout and trigger-overrides-blackout
+	flags.StringArray("blackout", []string{}, "Window of time, in UTC, in which scheduled dumps are skipped, in the format `[<days> ]HH:MM-HH:MM`, e.g. `22:30-02:00` or `Mon-Fri 01:00-05:00`. May be repeated, once for each window.")
+	flags.Bool("trigger-overrides-blackout", false, "Run dumps triggered by HTTP or signal even in a blackout window, rather than skip them as well.")
+
+	// trigger-listen
+	flags.String("trigger-listen", "", "Address on which to listen for `POST /trigger` HTTP requests to run a dump immediately, outside of the schedule, e.g. `:8080`. Sending the process SIGUSR1 does the same. Ignored with --once.")
+
 	// safechars
 	flags.Bool("safechars", false, "The dump filename usually includes the character `:` in the date, to comply with RFC3339. Some systems and shells don't like that character. If true, will replace all `:` with `-`.")
 
+	// label
+	flags.String("label", "", "Label for the kind of dump, e.g. `pre-deploy`, of letters, digits and `-`. It is part of the filename, and any prune after the dump prunes only the dumps with the same label, so that each label can have its own retention.")
+
 	// compression
-	flags.String("compression", defaultCompression, "Compression to use. Supported are: `gzip`, `bzip2`")
+	flags.String("compression", defaultCompression, "Compression to use. Supported are: `gzip`, `bzip2`, `zstd`, `none`, or its alias `store`, for a plain tar archive")
+
+	// compression-level
+	flags.String("compression-level", "", "Level at which to compress, in the scale of the compression, e.g. 1 to 9 for `gzip` and `bzip2`, or 1 to 22 for `zstd`; or `auto` to choose by the estimated size of the databases: the best level below compression-level-small, the fastest from compression-level-large, and the default in between. Empty for the default of the compression.")
+	flags.String("compression-level-small", "", "With compression-level `auto`, databases estimated to be smaller than this, e.g. `500MB`, are compressed at the best level. Default 1GB.")
+	flags.String("compression-level-large", "", "With compression-level `auto`, databases estimated to be at least this large, e.g. `50GB`, are compressed at the fastest level. Default 20GB.")
+
+	// compression-threads
+	flags.Int("compression-threads", 0, "How many threads compress the dump at once, for `gzip` and `zstd`, e.g. the number of CPUs. The dump is still a single stream, that restores as usual. 0 for the default of the compression: one for gzip, and the number of CPUs for zstd.")
+
+	// compression-dictionary
+	flags.String("compression-dictionary", "", "zstd dictionary file with which to compress, e.g. from `zstd --train`. Only with `zstd` compression. Restoring requires the same dictionary.")
+
+	// skip-compression-if-incompressible
+	flags.Bool("skip-compression-if-incompressible", false, "Sample each dump before compressing it, and if the sample hardly compresses, e.g. as the tables hold blobs that are compressed already, archive it without compression, as with `none`, for every target.")
 
 	// source filename pattern
 	flags.String("filename-pattern", defaultFilenamePattern, "Pattern to use for filename in target. See documentation.")
@@ -265,16 +751,123 @@ S3: If it is a URL of the format s3://bucketname/path then it will connect via S
 	// post-backup scripts
 	flags.String("post-backup-scripts", "", "Directory wherein any file ending in `.sh` will be run post-backup but pre-send to target.")
 
+	// scripts-exec - run the scripts by a wrapper, e.g. in another container
+	flags.String("scripts-exec", "", "Command, with its arguments separated by spaces, that runs each pre- and post-backup script, rather than running it directly, e.g. 'docker exec -i db sh -s' to run it in the database container. The script is written to its stdin, after an export of each of the environment variables of the scripts.")
+
+	// hex-blob
+	flags.Bool("hex-blob", false, "Dump binary columns, such as BLOB and VARBINARY, as hex literals, like mysqldump --hex-blob, so they restore byte for byte whatever the character sets. Up to twice the size before compression.")
+
+	// character-set
+	flags.String("character-set", "", "Character set of the connection to the database, in which the dump is written, like mysqldump --default-character-set. Defaults to `utf8mb4`.")
+
+	// collation
+	flags.String("collation", "", "Collation of the connection to the database, set with SET NAMES <charset> COLLATE <collation>, e.g. utf8mb4_0900_ai_ci, which must be one of the character set. Defaults to the default collation of the character set.")
+
+	// order-by-primary - for reproducible dumps
+	flags.Bool("order-by-primary", false, "Dump the rows of each table in the order of its primary key, or else of its first unique index of NOT NULL columns, like mysqldump --order-by-primary, so that dumps of the same data are the same, e.g. to diff them or skip duplicates. Slower for large tables; those with neither key are dumped unordered.")
+
+	// skip-set-charset
+	flags.Bool("skip-set-charset", false, "Do not set the character set in which the dump is written, with SET NAMES, nor that of each CREATE TABLE, like mysqldump --skip-set-charset, so that it is restored in the character set of the restore connection. Only for servers that need it, and not with --character-set.")
+
+	// skip-tz-utc
+	flags.Bool("skip-tz-utc", false, "Dump TIMESTAMP columns in the time zone of the server, and do not set the time zone of the restore, like mysqldump --skip-tz-utc, rather than dump and restore them in UTC. They then restore the same only on a server, or in a session, with the same time zone.")
+
+	// object-types
+	flags.StringSlice("object-types", []string{}, "Types of object to dump in each database, of `tables` and `views`, e.g. `views` for only the view definitions. Defaults to all of them.")
+
+	// consistent-across-databases
+	flags.Bool("consistent-across-databases", false, "Dump all of the databases in a single transaction, so that they are consistent with each other, and not only each within itself. Only InnoDB tables are consistent; the transaction is held open for the whole dump.")
+
+	// where
+	flags.StringArray("where", []string{}, "WHERE clause to dump only some of the rows of a table, in the format `<database>.<table>=<clause>`, e.g. `shop.orders=created_at > NOW() - INTERVAL 30 DAY`. May be repeated, once for each table.")
+
+	// partitions
+	flags.StringArray("partitions", []string{}, "Partitions of a partitioned table to dump, and no others, in the format `<database>.<table>=<partition>,<partition>...`, e.g. `shop.events=p2026_09,p2026_10`. A restore replaces only those partitions of the table. May be repeated, once for each table.")
+
+	// verify-upload
+	flags.Bool("verify-upload", false, "After each upload, read it back from the target, and fail if it is not the same size, or, on targets that can check it, content, as the dump. For a single target in the config file, set `verifyUpload` on the target instead.")
+
+	// keep-sql
+	flags.String("keep-sql", "", "Local directory in which to keep an uncompressed copy of the SQL files of each dump, each in a directory of its own, as well as uploading it compressed. Never pruned.")
+
+	// max-dump-size
+	flags.String("max-dump-size", "", "The most that the uncompressed SQL of each dump may take, all of its databases together, e.g. 20GB, with a unit of K, M, G or T, each 1024 times the one before. A dump that grows beyond it is aborted as it is written, before anything is uploaded, and not retried. Unlimited if not set.")
+
 	// max-allowed-packet size
 	flags.Int("max-allowed-packet", defaultMaxAllowedPacket, "Maximum size of the buffer for client/server communication, similar to mysqldump's max_allowed_packet. 0 means to use the default size.")
 
+	// rows-per-insert and skip-extended-insert
+	flags.Int("rows-per-insert", 0, "Most rows in each INSERT statement of the dump, however small they are. 0 means as many as fit in max-allowed-packet.")
+	flags.Bool("skip-extended-insert", false, "One row per INSERT statement, like mysqldump's --skip-extended-insert, for the most compatible, but slowest, restore.")
+
+	// temporary files
+	flags.String("tmp-path", "", "Directory in which to create the temporary files of each dump, which hold it uncompressed, e.g. an encrypted tmpfs. Defaults to the system temporary directory, usually `/tmp`.")
+	flags.Bool("private-tmp", false, "Create the temporary files of each dump readable only by the user running it, in a directory of its own, which is removed when the dump is done.")
+
 	cmd.MarkFlagsMutuallyExclusive("once", "cron")
 	cmd.MarkFlagsMutuallyExclusive("once", "begin")
 	cmd.MarkFlagsMutuallyExclusive("once", "frequency")
+	cmd.MarkFlagsMutuallyExclusive("once", "run-on-start")
 	cmd.MarkFlagsMutuallyExclusive("cron", "begin")
 	cmd.MarkFlagsMutuallyExclusive("cron", "frequency")
 	// retention
 	flags.String("retention", "", "Retention period for backups. Optional. If not specified, no pruning will be done. Can be number of backups or time-based. For time-based, the format is: 1d, 1w, 1m, 1y for days, weeks, months, years, respectively. For number-based, the format is: 1c, 2c, 3c, etc. for the count of backups to keep.")
 
+	// combined retention
+	flags.Int("keep-last", 0, "Keep at least this many of the most recent backups when pruning. Can be combined with keep-within, in which case a backup is kept if either keeps it. Cannot be combined with retention.")
+	flags.String("keep-within", "", "Keep all backups within this age when pruning, in the same time-based format as retention, e.g. 30d. Can be combined with keep-last, in which case a backup is kept if either keeps it. Cannot be combined with retention.")
+
+	// prune-cron - prune on a schedule of its own
+	flags.String("prune-cron", "", "Prune on this schedule, in the same crontab syntax as cron, e.g. `0 0 3 * * *` for once a day, rather than after each dump. Requires retention, keep-last or keep-within. Ignored with once, which prunes after the dump.")
+
 	return cmd, nil
 }
+
+// runPruneSchedule prune on the schedule cron until ctx is done, holding runs for each prune so that none runs at
+// the same time as a dump. A prune that fails is logged and notified, and tried again at the next time on the
+// schedule, rather than stopping the dumps.
+func runPruneSchedule(ctx context.Context, executor execs, cron string, runs *sync.Mutex, opts core.PruneOptions, notifiers []notify.Notifier) error {
+	return executor.Timer(ctx, core.TimerOptions{Cron: cron}, func(ctx context.Context) error {
+		runs.Lock()
+		defer runs.Unlock()
+		opts.Run = uuid.New()
+		logger := executor.GetLogger().WithField("run", opts.Run.String())
+		if err := executor.Prune(ctx, opts); err != nil {
+			logger.Errorf("error running scheduled prune: %v", err)
+			notify.Send(ctx, notifiers, notify.Event{Run: opts.Run, Operation: notify.OperationPrune, Err: err}, logger)
+		}
+		return nil
+	})
+}
+
+// dumpServer one database server to dump
+type dumpServer struct {
+	name    string
+	conn    database.Connection
+	replica *core.ReplicaOptions
+	include []string
+	exclude []string
+}
+
+// newDumpServer the server to dump from its configuration, with the include and exclude lists
+// from the dump configuration, unless the server sets its own
+func newDumpServer(d config.DatabaseServer, include, exclude []string) dumpServer {
+	server := dumpServer{
+		name:    d.Name,
+		conn:    backup.Connection(d.Database),
+		include: include,
+		exclude: exclude,
+	}
+	if server.name == "" {
+		server.name = d.Server
+	}
+	// checked before the first run
+	server.replica, _ = backup.Replica(d.Database, server.conn)
+	if len(d.Include) > 0 {
+		server.include = d.Include
+	}
+	if len(d.Exclude) > 0 {
+		server.exclude = d.Exclude
+	}
+	return server
+}
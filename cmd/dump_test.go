@@ -1,16 +1,21 @@
 package cmd
 
 import (
+	"errors"
 	"io"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/databacker/mysql-backup/pkg/compression"
+	"github.com/databacker/mysql-backup/pkg/config"
 	"github.com/databacker/mysql-backup/pkg/core"
 	"github.com/databacker/mysql-backup/pkg/database"
 	"github.com/databacker/mysql-backup/pkg/storage"
 	"github.com/databacker/mysql-backup/pkg/storage/file"
+	"github.com/databacker/mysql-backup/pkg/storage/stdio"
 	"github.com/go-test/deep"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -87,6 +92,44 @@ func TestDumpCmd(t *testing.T) {
 			FilenamePattern:  "foo_{{ .now }}.{{ .compression }}",
 		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, &core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "1h"}},
 
+		{"config file with dump options", []string{"--config-file", "testdata/dumpoptions.yml"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.Bzip2Compressor{},
+			DBConn:           database.Connection{Host: "abcd", Port: 3306, User: "user2", Pass: "xxxx2"},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			Label:            "nightly",
+			HexBlob:          true,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"config file with dump options overridden by flags", []string{"--config-file", "testdata/dumpoptions.yml", "--compression", "zstd", "--label", "pre-deploy", "--hex-blob=false"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.ZstdCompressor{},
+			DBConn:           database.Connection{Host: "abcd", Port: 3306, User: "user2", Pass: "xxxx2"},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			Label:            "pre-deploy",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"config file with target filename pattern", []string{"--config-file", "testdata/targetpattern.yml"}, "", false, core.DumpOptions{
+			Targets:                []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket:       defaultMaxAllowedPacket,
+			Compressor:             &compression.GzipCompressor{},
+			DBConn:                 database.Connection{Host: "abcd", Port: 3306, User: "user2", Pass: "xxxx2"},
+			FilenamePattern:        "db_backup_{{ .now }}.{{ .compression }}",
+			TargetFilenamePatterns: map[string]string{fileTarget: "{{ .year }}/{{ .month }}/db_backup_{{ .now }}.{{ .compression }}"},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, &core.PruneOptions{
+			Targets:                []storage.Storage{file.New(*fileTargetURL)},
+			Retention:              "1h",
+			TargetFilenamePatterns: map[string]string{fileTarget: "{{ .year }}/{{ .month }}/db_backup_{{ .now }}.{{ .compression }}"},
+		}},
+		{"config file with dump profile", []string{"--config-file", "testdata/profile.yml"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abcd", Port: 3306, User: "user2", Pass: "xxxx2"},
+			FilenamePattern:  "staging_{{ .now }}.{{ .compression }}",
+			Exclude:          []string{"scratch"},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+
 		// timer options
 		{"once flag", []string{"--server", "abc", "--target", "file:///foo/bar", "--once"}, "", false, core.DumpOptions{
 			Targets:          []storage.Storage{file.New(*fileTargetURL)},
@@ -95,6 +138,49 @@ func TestDumpCmd(t *testing.T) {
 			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
 			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
 		}, core.TimerOptions{Once: true, Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"stdout target", []string{"--server", "abc", "--target", "-"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{stdio.New(nil, io.Discard)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+		}, core.TimerOptions{Once: true, Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"stdout target twice", []string{"--server", "abc", "--target", "-", "--target", "-"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"stdout target with json output", []string{"--server", "abc", "--target", "-", "--output", "json"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"stdout target with separate tables", []string{"--server", "abc", "--target", "-", "--separate-tables", "db.t"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"lock file", []string{"--server", "abc", "--target", "file:///foo/bar", "--lock-file", "/var/run/dump.lock", "--lock-wait", "10m"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			Lock:             core.LockOptions{File: "/var/run/dump.lock", Wait: 10 * time.Minute, Stale: core.DefaultLockStale},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid lock wait", []string{"--server", "abc", "--target", "file:///foo/bar", "--lock-file", "/var/run/dump.lock", "--lock-wait", "-1m"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"replica", []string{"--server", "abc", "--target", "file:///foo/bar", "--replica-server", "def", "--replica-port", "3307", "--replica-max-lag", "5m", "--replica-fallback"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			Replica:          &core.ReplicaOptions{DBConn: database.Connection{Host: "def", Port: 3307}, MaxLag: 5 * time.Minute, Fallback: true},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid replica max lag", []string{"--server", "abc", "--target", "file:///foo/bar", "--replica-server", "def", "--replica-max-lag", "-1m"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"skip compression if incompressible", []string{"--server", "abc", "--target", "file:///foo/bar", "--skip-compression-if-incompressible"}, "", false, core.DumpOptions{
+			Targets:                         []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket:                defaultMaxAllowedPacket,
+			Compressor:                      &compression.GzipCompressor{},
+			DBConn:                          database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:                 "db_backup_{{ .now }}.{{ .compression }}",
+			SkipCompressionIfIncompressible: true,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"store compression", []string{"--server", "abc", "--target", "file:///foo/bar", "--compression", "store"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.NoneCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
 		{"cron flag", []string{"--server", "abc", "--target", "file:///foo/bar", "--cron", "0 0 * * *"}, "", false, core.DumpOptions{
 			Targets:          []storage.Storage{file.New(*fileTargetURL)},
 			MaxAllowedPacket: defaultMaxAllowedPacket,
@@ -102,6 +188,14 @@ func TestDumpCmd(t *testing.T) {
 			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
 			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
 		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin, Cron: "0 0 * * *"}, nil},
+		{"cron flag with seconds", []string{"--server", "abc", "--target", "file:///foo/bar", "--cron", "30 0 0 * * *"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin, Cron: "30 0 0 * * *"}, nil},
+		{"invalid cron flag", []string{"--server", "abc", "--target", "file:///foo/bar", "--cron", "0 25 * * *"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
 		{"begin flag", []string{"--server", "abc", "--target", "file:///foo/bar", "--begin", "1234"}, "", false, core.DumpOptions{
 			Targets:          []storage.Storage{file.New(*fileTargetURL)},
 			MaxAllowedPacket: defaultMaxAllowedPacket,
@@ -116,14 +210,320 @@ func TestDumpCmd(t *testing.T) {
 			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
 			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
 		}, core.TimerOptions{Frequency: 10, Begin: defaultBegin}, nil},
+		{"trigger listen flag", []string{"--server", "abc", "--target", "file:///foo/bar", "--trigger-listen", ":8080"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin, TriggerListen: ":8080"}, nil},
+		{"run on start with cron", []string{"--server", "abc", "--target", "file:///foo/bar", "--run-on-start", "--cron", "0 0 * * *"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin, Cron: "0 0 * * *", RunOnStart: true}, nil},
+		{"blackout", []string{"--server", "abc", "--target", "file:///foo/bar", "--blackout", "Mon-Fri 01:00-05:00", "--blackout", "22:30-23:30", "--trigger-overrides-blackout"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin, Blackout: []string{"Mon-Fri 01:00-05:00", "22:30-23:30"}, TriggerOverridesBlackout: true}, nil},
+		{"invalid blackout", []string{"--server", "abc", "--target", "file:///foo/bar", "--blackout", "1am-5am"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
 		{"incompatible flags: once/cron", []string{"--server", "abc", "--target", "file:///foo/bar", "--once", "--cron", "0 0 * * *"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
 		{"incompatible flags: once/begin", []string{"--server", "abc", "--target", "file:///foo/bar", "--once", "--begin", "1234"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"incompatible flags: once/run-on-start", []string{"--server", "abc", "--target", "file:///foo/bar", "--once", "--run-on-start"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
 		{"incompatible flags: once/frequency", []string{"--server", "abc", "--target", "file:///foo/bar", "--once", "--frequency", "10"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
 		{"incompatible flags: cron/begin", []string{"--server", "abc", "--target", "file:///foo/bar", "--cron", "0 0 * * *", "--begin", "1234"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
 		{"incompatible flags: cron/frequency", []string{"--server", "abc", "--target", "file:///foo/bar", "--cron", "0 0 * * *", "--frequency", "10"}, "", true, core.DumpOptions{
 			DBConn: database.Connection{Host: "abcd", Port: 3306, User: "user2", Pass: "xxxx2"},
 		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, &core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "1h"}},
 
+		// separate tables
+		{"separate tables", []string{"--server", "abc", "--target", "file:///foo/bar", "--separate-tables", "db1.t1,db2.t2"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			SeparateTables:   []string{"db1.t1", "db2.t2"},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+
+		// skip duplicates
+		{"skip duplicates", []string{"--server", "abc", "--target", "file:///foo/bar", "--skip-duplicates"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			SkipDuplicates:   true,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+
+		// system databases
+		{"include system databases", []string{"--server", "abc", "--target", "file:///foo/bar", "--include-system-databases"}, "", false, core.DumpOptions{
+			Targets:                []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket:       defaultMaxAllowedPacket,
+			Compressor:             &compression.GzipCompressor{},
+			DBConn:                 database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:        "db_backup_{{ .now }}.{{ .compression }}",
+			IncludeSystemDatabases: true,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+
+		// state file
+		{"state file", []string{"--server", "abc", "--target", "file:///foo/bar", "--state-file", "/var/lib/mysql-backup/state.json"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			StateFile:        "/var/lib/mysql-backup/state.json",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+
+		// latest alias
+		{"latest", []string{"--server", "abc", "--target", "file:///foo/bar", "--latest", "latest.{{ .compression }}"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			Latest:           "latest.{{ .compression }}",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"hex blob", []string{"--server", "abc", "--target", "file:///foo/bar", "--hex-blob"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			HexBlob:          true,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"skip set charset", []string{"--server", "abc", "--target", "file:///foo/bar", "--skip-set-charset"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			SkipSetCharset:   true,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"order by primary", []string{"--server", "abc", "--target", "file:///foo/bar", "--order-by-primary"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			OrderByPrimary:   true,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"skip tz utc", []string{"--server", "abc", "--target", "file:///foo/bar", "--skip-tz-utc"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			SkipTzUtc:        true,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"skip set charset with character set", []string{"--server", "abc", "--target", "file:///foo/bar", "--skip-set-charset", "--character-set", "latin1"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"consistent across databases", []string{"--server", "abc", "--target", "file:///foo/bar", "--consistent-across-databases"}, "", false, core.DumpOptions{
+			Targets:                   []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket:          defaultMaxAllowedPacket,
+			Compressor:                &compression.GzipCompressor{},
+			DBConn:                    database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:           "db_backup_{{ .now }}.{{ .compression }}",
+			ConsistentAcrossDatabases: true,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"verify upload", []string{"--server", "abc", "--target", "file:///foo/bar", "--verify-upload"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			VerifyUpload:     true,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"rows per insert", []string{"--server", "abc", "--target", "file:///foo/bar", "--rows-per-insert", "500"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			RowsPerInsert:    500,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"skip extended insert", []string{"--server", "abc", "--target", "file:///foo/bar", "--skip-extended-insert"}, "", false, core.DumpOptions{
+			Targets:            []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket:   defaultMaxAllowedPacket,
+			Compressor:         &compression.GzipCompressor{},
+			DBConn:             database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:    "db_backup_{{ .now }}.{{ .compression }}",
+			SkipExtendedInsert: true,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"rows per insert with skip extended insert", []string{"--server", "abc", "--target", "file:///foo/bar", "--rows-per-insert", "500", "--skip-extended-insert"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"compression threads", []string{"--server", "abc", "--target", "file:///foo/bar", "--compression-threads", "8"}, "", false, core.DumpOptions{
+			Targets:            []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket:   defaultMaxAllowedPacket,
+			Compressor:         &compression.GzipCompressor{},
+			DBConn:             database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:    "db_backup_{{ .now }}.{{ .compression }}",
+			CompressionThreads: 8,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid compression threads", []string{"--server", "abc", "--target", "file:///foo/bar", "--compression-threads", "-1"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"label", []string{"--server", "abc", "--target", "file:///foo/bar", "--label", "pre-deploy"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			Label:            "pre-deploy",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid label", []string{"--server", "abc", "--target", "file:///foo/bar", "--label", "pre_deploy"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"compression level", []string{"--server", "abc", "--target", "file:///foo/bar", "--compression-level", "9"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			CompressionLevel: 9,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"auto compression level", []string{"--server", "abc", "--target", "file:///foo/bar", "--compression-level", "auto", "--compression-level-small", "100MB"}, "", false, core.DumpOptions{
+			Targets:              []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket:     defaultMaxAllowedPacket,
+			Compressor:           &compression.GzipCompressor{},
+			DBConn:               database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:      "db_backup_{{ .now }}.{{ .compression }}",
+			AutoCompressionLevel: &compression.AutoLevel{Small: 100 << 20, Large: compression.DefaultAutoLevelLarge},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid compression level", []string{"--server", "abc", "--target", "file:///foo/bar", "--compression-level", "19"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"private tmp", []string{"--server", "abc", "--target", "file:///foo/bar", "--tmp-path", "/dev/shm", "--private-tmp"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			Tmp:              core.TmpOptions{Path: "/dev/shm", Private: true},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"keep sql", []string{"--server", "abc", "--target", "file:///foo/bar", "--keep-sql", "/var/backups/sql"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			KeepSQL:          "/var/backups/sql",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"max dump size", []string{"--server", "abc", "--target", "file:///foo/bar", "--max-dump-size", "500MB"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			MaxDumpSize:      500 << 20,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid max dump size", []string{"--server", "abc", "--target", "file:///foo/bar", "--max-dump-size", "500 apples"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"object types", []string{"--server", "abc", "--target", "file:///foo/bar", "--object-types", "views"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			ObjectTypes:      []string{"views"},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"where", []string{"--server", "abc", "--target", "file:///foo/bar", "--where", "shop.orders=created_at > NOW() - INTERVAL 30 DAY", "--where", "shop.events=id IN (1,2)"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			Where:            map[string]string{"shop.orders": "created_at > NOW() - INTERVAL 30 DAY", "shop.events": "id IN (1,2)"},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid where", []string{"--server", "abc", "--target", "file:///foo/bar", "--where", "orders=id > 1"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"partitions", []string{"--server", "abc", "--target", "file:///foo/bar", "--partitions", "shop.events=p2026_09,p2026_10", "--partitions", "shop.logs=p2026_10"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			Partitions:       map[string][]string{"shop.events": {"p2026_09", "p2026_10"}, "shop.logs": {"p2026_10"}},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid partitions", []string{"--server", "abc", "--target", "file:///foo/bar", "--partitions", "shop.events="}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"report", []string{"--server", "abc", "--target", "file:///foo/bar", "--report-history", "30", "--report-format", "html"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			Report:           core.ReportOptions{History: 30, Format: core.ReportHTML},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid report format", []string{"--server", "abc", "--target", "file:///foo/bar", "--report-history", "30", "--report-format", "pdf"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"priority", []string{"--server", "abc", "--target", "file:///foo/bar", "--nice", "10", "--ionice", "idle"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			Priority:         core.PriorityOptions{Nice: 10, IONice: core.IONiceIdle},
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid nice", []string{"--server", "abc", "--target", "file:///foo/bar", "--nice", "20"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"invalid ionice", []string{"--server", "abc", "--target", "file:///foo/bar", "--ionice", "realtime"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"skip unchanged", []string{"--server", "abc", "--target", "file:///foo/bar", "--state-file", "/var/lib/state.json", "--skip-unchanged", "update-time", "--link-unchanged"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+			StateFile:        "/var/lib/state.json",
+			SkipUnchanged:    database.ChangesUpdateTime,
+			LinkUnchanged:    true,
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"skip unchanged without state file", []string{"--server", "abc", "--target", "file:///foo/bar", "--skip-unchanged", "binlog"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"invalid skip unchanged", []string{"--server", "abc", "--target", "file:///foo/bar", "--state-file", "/var/lib/state.json", "--skip-unchanged", "gtid"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"invalid object types", []string{"--server", "abc", "--target", "file:///foo/bar", "--object-types", "routines"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"character set", []string{"--server", "abc", "--target", "file:///foo/bar", "--character-set", "latin1"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort, Charset: "latin1"},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"invalid character set", []string{"--server", "abc", "--target", "file:///foo/bar", "--character-set", "utf-8"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"collation", []string{"--server", "abc", "--target", "file:///foo/bar", "--character-set", "latin1", "--collation", "latin1_bin"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort, Charset: "latin1", Collation: "latin1_bin"},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"collation of another character set", []string{"--server", "abc", "--target", "file:///foo/bar", "--collation", "latin1_bin"}, "", true, core.DumpOptions{}, core.TimerOptions{}, nil},
+		{"zstd with compression dictionary", []string{"--server", "abc", "--target", "file:///foo/bar", "--compression", "zstd", "--compression-dictionary", "/dicts/v1.dict"}, "", false, core.DumpOptions{
+			Targets:               []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket:      defaultMaxAllowedPacket,
+			Compressor:            &compression.ZstdCompressor{},
+			DBConn:                database.Connection{Host: "abc", Port: defaultPort},
+			FilenamePattern:       "db_backup_{{ .now }}.{{ .compression }}",
+			CompressionDictionary: "/dicts/v1.dict",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+
+		// metadata query timeouts and retries
+		{"query timeouts", []string{"--server", "abc", "--target", "file:///foo/bar", "--connect-timeout", "5s", "--query-timeout", "30s", "--max-retries", "3"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort, ConnectTimeout: 5 * time.Second, QueryTimeout: 30 * time.Second, MaxRetries: 3},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+
+		// credentials from a MySQL option file, leaving the port to the file
+		{"defaults file", []string{"--target", "file:///foo/bar", "--defaults-file", "/etc/mysql/backup.cnf"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{DefaultsFile: "/etc/mysql/backup.cnf"},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"defaults file explicit port", []string{"--server", "abc", "--port", "3307", "--target", "file:///foo/bar", "--defaults-file", "/etc/mysql/backup.cnf"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: 3307, DefaultsFile: "/etc/mysql/backup.cnf"},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+
 		// pre- and post-backup scripts
 		{"prebackup scripts", []string{"--server", "abc", "--target", "file:///foo/bar", "--pre-backup-scripts", "/prebackup"}, "", false, core.DumpOptions{
 			Targets:          []storage.Storage{file.New(*fileTargetURL)},
@@ -141,6 +541,15 @@ func TestDumpCmd(t *testing.T) {
 			PostBackupScripts: "/postbackup",
 			FilenamePattern:   "db_backup_{{ .now }}.{{ .compression }}",
 		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
+		{"scripts exec", []string{"--server", "abc", "--target", "file:///foo/bar", "--pre-backup-scripts", "/prebackup", "--scripts-exec", "docker exec -i db sh -s"}, "", false, core.DumpOptions{
+			Targets:          []storage.Storage{file.New(*fileTargetURL)},
+			MaxAllowedPacket: defaultMaxAllowedPacket,
+			Compressor:       &compression.GzipCompressor{},
+			DBConn:           database.Connection{Host: "abc", Port: defaultPort},
+			PreBackupScripts: "/prebackup",
+			ScriptsExec:      []string{"docker", "exec", "-i", "db", "sh", "-s"},
+			FilenamePattern:  "db_backup_{{ .now }}.{{ .compression }}",
+		}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}, nil},
 		{"prebackup and postbackup scripts", []string{"--server", "abc", "--target", "file:///foo/bar", "--post-backup-scripts", "/postbackup", "--pre-backup-scripts", "/prebackup"}, "", false, core.DumpOptions{
 			Targets:           []storage.Storage{file.New(*fileTargetURL)},
 			MaxAllowedPacket:  defaultMaxAllowedPacket,
@@ -199,3 +608,142 @@ func TestDumpCmd(t *testing.T) {
 		})
 	}
 }
+
+func TestNewDumpServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   config.DatabaseServer
+		include  []string
+		exclude  []string
+		expected dumpServer
+	}{
+		{"defaults", config.DatabaseServer{Database: config.Database{Server: "db1"}}, []string{"a"}, []string{"b"},
+			dumpServer{name: "db1", conn: database.Connection{Host: "db1", Port: defaultPort}, include: []string{"a"}, exclude: []string{"b"}}},
+		{"overrides", config.DatabaseServer{
+			Database: config.Database{Server: "db2", Port: 3307, Credentials: config.DBCredentials{Username: "user", Password: "pass"}},
+			Name:     "second",
+			Include:  []string{"c"},
+			Exclude:  []string{"d"},
+		}, []string{"a"}, []string{"b"},
+			dumpServer{name: "second", conn: database.Connection{Host: "db2", Port: 3307, User: "user", Pass: "pass"}, include: []string{"c"}, exclude: []string{"d"}}},
+		{"tls", config.DatabaseServer{Database: config.Database{Server: "db4", TLS: database.TLSRequired}}, nil, nil,
+			dumpServer{name: "db4", conn: database.Connection{Host: "db4", Port: defaultPort, TLS: database.TLSRequired}}},
+		{"replica", config.DatabaseServer{Database: config.Database{
+			Server: "db3", Credentials: config.DBCredentials{Username: "user", Password: "pass"},
+			PreferReplica: true, Replica: config.Replica{Server: "db3-replica", Credentials: config.DBCredentials{Password: "other"}, MaxLag: config.Duration(time.Minute)},
+		}}, nil, nil,
+			dumpServer{name: "db3", conn: database.Connection{Host: "db3", Port: defaultPort, User: "user", Pass: "pass"},
+				replica: &core.ReplicaOptions{DBConn: database.Connection{Host: "db3-replica", Port: defaultPort, User: "user", Pass: "other"}, MaxLag: time.Minute}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, newDumpServer(tt.server, tt.include, tt.exclude))
+		})
+	}
+}
+
+func TestDumpCmdPruneCron(t *testing.T) {
+	t.Parallel()
+
+	fileTarget := "file:///foo/bar"
+	fileTargetURL, _ := url.Parse(fileTarget)
+	pruneOpts := core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "7d"}
+	tests := []struct {
+		name    string
+		args    []string // "dump" will be prepended automatically
+		wantErr bool
+		// expectedTimerOptions the timers that should be started, the dump's first
+		expectedTimerOptions []core.TimerOptions
+	}{
+		{"scheduled", []string{"--server", "abc", "--target", fileTarget, "--retention", "7d", "--prune-cron", "0 0 3 * * *"}, false, []core.TimerOptions{{Frequency: defaultFrequency, Begin: defaultBegin}, {Cron: "0 0 3 * * *"}}},
+		{"once prunes after the dump", []string{"--server", "abc", "--target", fileTarget, "--retention", "7d", "--prune-cron", "0 0 3 * * *", "--once"}, false, []core.TimerOptions{{Once: true, Frequency: defaultFrequency, Begin: defaultBegin}}},
+		{"config file", []string{"--config-file", "testdata/prunecron.yml"}, false, []core.TimerOptions{{Cron: "0 0 * * * *", Frequency: defaultFrequency, Begin: defaultBegin}, {Cron: "0 0 3 * * *"}}},
+		{"without retention", []string{"--server", "abc", "--target", fileTarget, "--prune-cron", "0 0 3 * * *"}, true, nil},
+		{"invalid", []string{"--server", "abc", "--target", fileTarget, "--retention", "7d", "--prune-cron", "daily"}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockExecs()
+			m.On("Dump", mock.Anything).Return(nil)
+			for _, timerOpts := range tt.expectedTimerOptions {
+				m.On("Timer", timerOpts).Return(nil)
+			}
+			// once, whether after the dump or on the schedule
+			m.On("Prune", mock.MatchedBy(func(opts core.PruneOptions) bool {
+				if equalIgnoreFields(opts, pruneOpts, []string{"Run"}) {
+					return true
+				}
+				t.Errorf("pruneOpts compare failed: %#v %#v", opts, pruneOpts)
+				return false
+			})).Return(nil).Once()
+
+			cmd, err := rootCmd(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd.SetOutput(io.Discard)
+			cmd.SetArgs(append([]string{"dump"}, tt.args...))
+			err = cmd.Execute()
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			case err == nil:
+				m.AssertExpectations(t)
+			}
+		})
+	}
+}
+
+func TestDumpCmdWaitForDB(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		args    []string // "dump" will be prepended automatically
+		waitErr error
+		wantErr bool
+		// expectedWaitOptions how to wait for the database before the first dump; nil for not to wait
+		expectedWaitOptions *core.WaitOptions
+	}{
+		{"not waiting", []string{"--server", "abc", "--target", "file:///foo/bar"}, nil, false, nil},
+		{"flag", []string{"--server", "abc", "--target", "file:///foo/bar", "--wait-for-db", "90s"}, nil, false,
+			&core.WaitOptions{DBConns: []database.Connection{{Host: "abc", Port: defaultPort}}, Timeout: 90 * time.Second, Interval: core.DefaultWaitInterval}},
+		{"config file", []string{"--config-file", "testdata/waitfordb.yml"}, nil, false,
+			&core.WaitOptions{DBConns: []database.Connection{{Host: "abcd", Port: 3306, User: "user2", Pass: "xxxx2"}}, Timeout: 2 * time.Minute, Interval: 5 * time.Second}},
+		{"config file overridden by flag", []string{"--config-file", "testdata/waitfordb.yml", "--wait-for-db-interval", "1s"}, nil, false,
+			&core.WaitOptions{DBConns: []database.Connection{{Host: "abcd", Port: 3306, User: "user2", Pass: "xxxx2"}}, Timeout: 2 * time.Minute, Interval: time.Second}},
+		{"not ready", []string{"--server", "abc", "--target", "file:///foo/bar", "--wait-for-db", "90s"}, errors.New("database abc was not ready after 1m30s"), true,
+			&core.WaitOptions{DBConns: []database.Connection{{Host: "abc", Port: defaultPort}}, Timeout: 90 * time.Second, Interval: core.DefaultWaitInterval}},
+		{"negative", []string{"--server", "abc", "--target", "file:///foo/bar", "--wait-for-db", "-1s"}, nil, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockExecs()
+			if tt.expectedWaitOptions != nil {
+				m.On("WaitForDatabase", *tt.expectedWaitOptions).Return(tt.waitErr).Once()
+			}
+			// only once the database is ready
+			if !tt.wantErr {
+				m.On("Dump", mock.Anything).Return(nil)
+				m.On("Timer", mock.Anything).Return(nil)
+			}
+
+			cmd, err := rootCmd(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd.SetOutput(io.Discard)
+			cmd.SetArgs(append([]string{"dump"}, tt.args...))
+			err = cmd.Execute()
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			}
+			m.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/databacker/mysql-backup/pkg/compression"
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/storage/stdio"
+)
+
+func fetchCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
+	if cmdConfig == nil {
+		return nil, fmt.Errorf("cmdConfig is nil")
+	}
+	var v *viper.Viper
+	var cmd = &cobra.Command{
+		Use:     "fetch",
+		Aliases: []string{"download"},
+		Short:   "fetch a dump without restoring it",
+		Long: `Download a database dump from a given location to a local path, without restoring it, e.g. for offline analysis.
+		The dump is selected as for restore: by its name, the newest that matches a pattern with --newest, or the newest
+		with a label with --label. It is written as it is on the target, unless --uncompress is given.`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			bindFlags(cmd, v)
+		},
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmdConfig.logger.Debug("starting fetch")
+			target := v.GetString("target")
+			if target == stdio.Name {
+				return fmt.Errorf("cannot fetch from stdin (-), which can be read as it is")
+			}
+			// the file to fetch, unless fetching the newest with a label
+			label := v.GetString("label")
+			// how many older than the newest, as for restore
+			offset := v.GetInt("offset")
+			newest := v.GetBool("newest")
+			var targetFile string
+			switch {
+			case len(args) == 1 && label != "":
+				return fmt.Errorf("either the file to fetch or --label, not both")
+			case len(args) == 1 && offset != 0 && !newest:
+				return fmt.Errorf("--offset with a file requires --newest, so that the file is a pattern")
+			case len(args) == 1:
+				targetFile = args[0]
+			case label == "" && offset == 0:
+				return fmt.Errorf("requires the file to fetch, --label to fetch the newest dump with the label, or --offset to fetch one older than the newest")
+			}
+			if err := core.ValidateLabel(label); err != nil {
+				return err
+			}
+			if err := core.ValidateOffset(offset); err != nil {
+				return err
+			}
+
+			// compression algorithm: check config, then CLI/env var overrides
+			var (
+				compressionAlgo string
+				compressor      compression.Compressor
+				err             error
+			)
+			if cmdConfig.configuration != nil {
+				compressionAlgo = cmdConfig.configuration.Dump.Compression
+			}
+			compressionVar := v.GetString("compression")
+			if compressionVar != "" {
+				compressionAlgo = compressionVar
+			}
+			if compressionAlgo != "" {
+				compressor, err = compression.GetCompressor(compressionAlgo)
+				if err != nil {
+					return fmt.Errorf("failure to get compression '%s': %v", compressionAlgo, err)
+				}
+			}
+			store, err := parseTarget(target, cmdConfig)
+			if err != nil {
+				return err
+			}
+			var compressionDictionaries []string
+			if cmdConfig.configuration != nil {
+				compressionDictionaries = cmdConfig.configuration.Restore.CompressionDictionaries
+			}
+			if v.IsSet("compression-dictionary") {
+				compressionDictionaries = v.GetStringSlice("compression-dictionary")
+			}
+			var executor execs
+			executor = &core.Executor{}
+			if passedExecs != nil {
+				executor = passedExecs
+			}
+			executor.SetLogger(cmdConfig.logger)
+
+			// at this point, any errors should not have usage
+			cmd.SilenceUsage = true
+			uid := uuid.New()
+			fetchOpts := core.FetchOptions{
+				Target:                  store,
+				TargetFile:              targetFile,
+				Newest:                  newest,
+				Label:                   label,
+				Offset:                  offset,
+				Path:                    v.GetString("to"),
+				Uncompress:              v.GetBool("uncompress"),
+				Raw:                     v.GetBool("raw"),
+				Compressor:              compressor,
+				CompressionDictionaries: compressionDictionaries,
+				Run:                     uid,
+			}
+			if _, err := executor.Fetch(cmd.Context(), fetchOpts); err != nil {
+				return fmt.Errorf("error fetching: %v", err)
+			}
+			executor.GetLogger().WithField("run", uid.String()).Info("Fetch complete")
+			return nil
+		},
+	}
+	// target - where the backup is
+	v = viper.New()
+	v.SetEnvPrefix("db_fetch")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+
+	flags := cmd.Flags()
+	flags.String("target", "", "full URL target to the backup that you wish to fetch, or a reference to a target in the configuration file, e.g. `config://targetname`.")
+	if err := cmd.MarkFlagRequired("target"); err != nil {
+		return nil, err
+	}
+
+	// to - where to write it
+	flags.String("to", "", "Local path to which to write the dump: a file, or an existing directory in which to write it with its own name. With --uncompress, and not --raw, the directory into which to extract the files of the dump, created if it does not exist. Defaults to the current directory.")
+
+	// uncompress - rather than as it is
+	flags.Bool("uncompress", false, "Uncompress the dump as it is written, rather than write it as it is on the target. An archive created by `dump` is extracted into the directory.")
+
+	// raw - a single SQL dump, rather than an archive from dump
+	flags.Bool("raw", false, "The file is a single compressed SQL dump, e.g. a `.sql.gz` from mysqldump or another tool, rather than an archive created by `dump`, so that with --uncompress it is written as a single SQL file.")
+
+	// compression
+	flags.String("compression", defaultCompression, "Compression to use with --uncompress if it cannot be detected from the file header or name. Supported are: `gzip`, `bzip2`, `zstd`, `none`")
+
+	// compression-dictionary
+	flags.StringSlice("compression-dictionary", nil, "zstd dictionary files with which the dump may have been compressed, comma-separated or repeated, for --uncompress.")
+
+	// label - fetch the newest dump with the label
+	flags.String("label", "", "Fetch the newest dump on the target with this label, e.g. `pre-deploy`, by the time in its filename, instead of a given file.")
+
+	// offset - an older dump than the newest
+	flags.Int("offset", 0, "Fetch the dump this many older than the newest, e.g. `1` for the second newest, as for restore: with --label, of the dumps with the label; with --newest, of the files that match the pattern; with neither, and no file, of the dumps without a label.")
+
+	// newest - the filename is a pattern
+	flags.Bool("newest", false, "The filename is a pattern, e.g. `backups/db1/*.sql.gz`, and the newest file on the target that matches it is fetched. On S3, wildcards can be anywhere in it; on other targets, only in the filename.")
+
+	return cmd, nil
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"testing"
+
+	"github.com/databacker/mysql-backup/pkg/compression"
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFetchCmd(t *testing.T) {
+	t.Parallel()
+
+	fileTarget := "file:///foo/bar"
+	fileTargetURL, _ := url.Parse(fileTarget)
+
+	tests := []struct {
+		name                 string
+		args                 []string // "fetch" will be prepended automatically
+		wantErr              bool
+		expectedFetchOptions core.FetchOptions
+	}{
+		{"missing target", []string{"filename.tgz"}, true, core.FetchOptions{}},
+		{"invalid target URL", []string{"--target", "def", "filename.tgz"}, true, core.FetchOptions{}},
+		{"missing dump filename", []string{"--target", fileTarget}, true, core.FetchOptions{}},
+		{"valid file URL", []string{"--target", fileTarget, "filename.tgz"}, false, core.FetchOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", Compressor: &compression.GzipCompressor{}}},
+		{"to", []string{"--target", fileTarget, "filename.tgz", "--to", "/tmp/dumps"}, false, core.FetchOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", Path: "/tmp/dumps", Compressor: &compression.GzipCompressor{}}},
+		{"newest", []string{"--target", fileTarget, "backups/db1/*.tgz", "--newest"}, false, core.FetchOptions{Target: file.New(*fileTargetURL), TargetFile: "backups/db1/*.tgz", Newest: true, Compressor: &compression.GzipCompressor{}}},
+		{"label", []string{"--target", fileTarget, "--label", "pre-deploy"}, false, core.FetchOptions{Target: file.New(*fileTargetURL), Label: "pre-deploy", Compressor: &compression.GzipCompressor{}}},
+		{"offset", []string{"--target", fileTarget, "--label", "pre-deploy", "--offset", "1"}, false, core.FetchOptions{Target: file.New(*fileTargetURL), Label: "pre-deploy", Offset: 1, Compressor: &compression.GzipCompressor{}}},
+		{"offset with filename", []string{"--target", fileTarget, "filename.tgz", "--offset", "1"}, true, core.FetchOptions{}},
+		{"label and filename", []string{"--target", fileTarget, "filename.tgz", "--label", "pre-deploy"}, true, core.FetchOptions{}},
+		{"invalid label", []string{"--target", fileTarget, "--label", "pre_deploy"}, true, core.FetchOptions{}},
+		{"uncompress", []string{"--target", fileTarget, "filename.tgz", "--uncompress", "--compression-dictionary", "/dicts/v1.dict"}, false, core.FetchOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", Uncompress: true, Compressor: &compression.GzipCompressor{}, CompressionDictionaries: []string{"/dicts/v1.dict"}}},
+		{"raw", []string{"--target", fileTarget, "legacy.sql.bz2", "--uncompress", "--raw", "--compression", "bzip2"}, false, core.FetchOptions{Target: file.New(*fileTargetURL), TargetFile: "legacy.sql.bz2", Uncompress: true, Raw: true, Compressor: &compression.Bzip2Compressor{}}},
+		{"stdin", []string{"--target", "-"}, true, core.FetchOptions{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockExecs()
+			m.On("Fetch", mock.MatchedBy(func(fetchOpts core.FetchOptions) bool {
+				if equalIgnoreFields(fetchOpts, tt.expectedFetchOptions, []string{"Run"}) {
+					return true
+				}
+				t.Errorf("fetchOpts compare failed: %#v %#v", fetchOpts, tt.expectedFetchOptions)
+				return false
+			})).Return(nil)
+			cmd, err := rootCmd(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd.SetOutput(io.Discard)
+			cmd.SetIn(&bytes.Buffer{})
+			cmd.SetArgs(append([]string{"fetch"}, tt.args...))
+			err = cmd.Execute()
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			case err == nil:
+				m.AssertExpectations(t)
+			}
+		})
+	}
+}
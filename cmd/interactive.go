@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/util"
+)
+
+// interactiveShown how many of the newest dumps the menu shows at first
+const interactiveShown = 20
+
+// isTerminal whether r is a terminal, at which someone can answer a prompt. A terminal is a character device,
+// but so is the null device, which is stdin of many jobs that are not run from a terminal, e.g. by cron.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(fi, null)
+}
+
+// selectDump list the dumps on target in a menu on out, newest first, and read the choice of one of them from in
+func selectDump(ctx context.Context, target storage.Storage, in io.Reader, out io.Writer, logger *log.Entry) (string, error) {
+	files, err := core.ListDumps(ctx, target, logger)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no dumps on %s to restore", target.URL())
+	}
+	shown := min(len(files), interactiveShown)
+	printMenu := func() {
+		fmt.Fprintf(out, "dumps on %s, newest first:\n", target.URL())
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for i, f := range files[:shown] {
+			fmt.Fprintf(w, "%4d)\t%s\t%s\t%s\n", i+1, f.Name(), f.ModTime().UTC().Format(time.DateTime+" MST"), util.FormatSize(f.Size()))
+		}
+		w.Flush()
+		if shown < len(files) {
+			fmt.Fprintf(out, "and %d older; enter 'all' to list them\n", len(files)-shown)
+		}
+	}
+	printMenu()
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "dump to restore, 1-%d, or 'q' to quit: ", shown)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", fmt.Errorf("failed to read the dump to restore: %v", err)
+			}
+			return "", fmt.Errorf("no dump selected")
+		}
+		answer := strings.TrimSpace(scanner.Text())
+		switch answer {
+		case "q", "quit":
+			return "", fmt.Errorf("no dump selected")
+		case "all":
+			shown = len(files)
+			printMenu()
+			continue
+		}
+		n, err := strconv.Atoi(answer)
+		if err != nil || n < 1 || n > shown {
+			fmt.Fprintf(out, "invalid choice %q\n", answer)
+			continue
+		}
+		name := files[n-1].Name()
+		fmt.Fprintf(out, "restoring %s\n", name)
+		return name, nil
+	}
+}
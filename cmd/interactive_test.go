@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+)
+
+func TestSelectDump(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i := 0; i < interactiveShown+5; i++ {
+		p := filepath.Join(dir, fmt.Sprintf("dump%02d.tgz", i))
+		require.NoError(t, os.WriteFile(p, []byte("dump"), 0o644))
+		mtime := now.Add(-time.Duration(i) * time.Hour)
+		require.NoError(t, os.Chtimes(p, mtime, mtime))
+	}
+	target := file.New(url.URL{Scheme: "file", Path: dir})
+	logger := log.NewEntry(log.New())
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		err   string
+	}{
+		{"newest", "1\n", "dump00.tgz", ""},
+		{"invalid then valid", "x\n0\n3\n", "dump02.tgz", ""},
+		{"older only after all", "25\nall\n25\n", "dump24.tgz", ""},
+		{"quit", "q\n", "", "no dump selected"},
+		{"end of input", "", "", "no dump selected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			got, err := selectDump(context.Background(), target, strings.NewReader(tt.input), &out, logger)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Contains(t, out.String(), "and 5 older")
+		})
+	}
+}
+
+func TestSelectDumpEmpty(t *testing.T) {
+	target := file.New(url.URL{Scheme: "file", Path: t.TempDir()})
+	_, err := selectDump(context.Background(), target, strings.NewReader("1\n"), &bytes.Buffer{}, log.NewEntry(log.New()))
+	assert.ErrorContains(t, err, "no dumps on")
+}
+
+func TestIsTerminal(t *testing.T) {
+	assert.False(t, isTerminal(strings.NewReader("")))
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	require.NoError(t, err)
+	defer f.Close()
+	assert.False(t, isTerminal(f))
+	null, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer null.Close()
+	assert.False(t, isTerminal(null))
+}
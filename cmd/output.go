@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/storage"
+)
+
+const (
+	// outputText the default, with just the logs, for people
+	outputText = "text"
+	// outputJSON a JSON summary of each run on stdout, for scripts
+	outputJSON = "json"
+)
+
+// validateOutput check the format passed to --output
+func validateOutput(format string) error {
+	switch format {
+	case outputText, outputJSON:
+		return nil
+	default:
+		return fmt.Errorf("invalid output format %q, must be one of: %s, %s", format, outputText, outputJSON)
+	}
+}
+
+// dumpOutput the outcome of a single dump run, printed with --output json
+type dumpOutput struct {
+	Run string `json:"run"`
+	// Trigger how the run was started outside of the schedule, e.g. http; empty if on schedule
+	Trigger string             `json:"trigger,omitempty"`
+	Success bool               `json:"success"`
+	Error   string             `json:"error,omitempty"`
+	Servers []dumpServerOutput `json:"servers"`
+}
+
+// dumpServerOutput the outcome of the dump of one database server
+type dumpServerOutput struct {
+	Server string `json:"server,omitempty"`
+	// Replica the read replica from which the server was dumped, if it was not dumped from the server itself
+	Replica string `json:"replica,omitempty"`
+	// Unchanged whether the dump was skipped, as the databases had not changed since the last one
+	Unchanged       bool           `json:"unchanged,omitempty"`
+	Databases       []string       `json:"databases"`
+	Start           time.Time      `json:"start"`
+	End             time.Time      `json:"end"`
+	DurationSeconds float64        `json:"durationSeconds"`
+	Success         bool           `json:"success"`
+	Error           string         `json:"error,omitempty"`
+	Targets         []targetOutput `json:"targets"`
+}
+
+// targetOutput the outcome of the uploads of a dump to one target
+type targetOutput struct {
+	URL     string       `json:"url"`
+	Success bool         `json:"success"`
+	Error   string       `json:"error,omitempty"`
+	Files   []fileOutput `json:"files"`
+}
+
+// fileOutput a single file uploaded to a target
+type fileOutput struct {
+	Filename        string  `json:"filename"`
+	Size            int64   `json:"size"`
+	SHA256          string  `json:"sha256,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	DuplicateOf     string  `json:"duplicateOf,omitempty"`
+}
+
+// newDumpServerOutput the outcome of the dump of one server to targets, each of which should have received
+// expected files. If the dump failed, the targets that did not receive all of them failed.
+func newDumpServerOutput(server string, targets []storage.Storage, expected int, results core.DumpResults, err error) dumpServerOutput {
+	out := dumpServerOutput{
+		Server:          server,
+		Replica:         results.Replica,
+		Unchanged:       results.Unchanged,
+		Databases:       results.Databases,
+		Start:           results.Start,
+		End:             results.End,
+		DurationSeconds: results.End.Sub(results.Start).Seconds(),
+		Success:         err == nil,
+		Targets:         []targetOutput{},
+	}
+	if err != nil {
+		out.Error = err.Error()
+	}
+	for _, t := range targets {
+		target := targetOutput{URL: t.URL(), Success: true, Files: []fileOutput{}}
+		for _, u := range results.Uploads {
+			if u.Target != t.URL() {
+				continue
+			}
+			target.Files = append(target.Files, fileOutput{
+				Filename:        u.Filename,
+				Size:            u.Size,
+				SHA256:          u.SHA256,
+				DurationSeconds: u.End.Sub(u.Start).Seconds(),
+				DuplicateOf:     u.DuplicateOf,
+			})
+		}
+		if err != nil && len(target.Files) < expected {
+			target.Success = false
+			target.Error = err.Error()
+		}
+		out.Targets = append(out.Targets, target)
+	}
+	return out
+}
+
+// restoreOutput the outcome of a restore, printed with --output json
+type restoreOutput struct {
+	Run             string    `json:"run"`
+	Target          string    `json:"target"`
+	File            string    `json:"file"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Size            int64     `json:"size"`
+	SHA256          string    `json:"sha256,omitempty"`
+	Compression     string    `json:"compression,omitempty"`
+	Statements      int       `json:"statements"`
+	// FailedStatements statements that failed, but were skipped with --force
+	FailedStatements int `json:"failedStatements"`
+	// Files the outcome of each of the files in the dump, e.g. one per database, if there is more than one
+	Files []restoreFileOutput `json:"files,omitempty"`
+	// RowCounts the tables whose rows were verified, with --verify-row-counts
+	RowCounts []rowCountOutput `json:"rowCounts,omitempty"`
+	Success   bool             `json:"success"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// restoreFileOutput the outcome of restoring one of the files in a dump
+type restoreFileOutput struct {
+	Name             string   `json:"name"`
+	Databases        []string `json:"databases,omitempty"`
+	Statements       int      `json:"statements"`
+	FailedStatements int      `json:"failedStatements"`
+	// Restored whether the file was restored; false if it failed, or was not tried as an earlier one failed
+	Restored bool   `json:"restored"`
+	Error    string `json:"error,omitempty"`
+}
+
+// rowCountOutput the rows of a table that the dump records, and that it has once restored
+type rowCountOutput struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Expected int64  `json:"expected"`
+	Actual   int64  `json:"actual"`
+	// Matched whether the table has the rows that the dump records
+	Matched bool   `json:"matched"`
+	Error   string `json:"error,omitempty"`
+}
+
+// newRestoreOutput the outcome of the restore of file from target, or of the file in the results, if it is set,
+// e.g. the newest that matched the pattern file
+func newRestoreOutput(run, target, file string, results core.RestoreResults, err error) restoreOutput {
+	if results.File != "" {
+		file = results.File
+	}
+	out := restoreOutput{
+		Run:              run,
+		Target:           target,
+		File:             file,
+		Start:            results.Start,
+		End:              results.End,
+		DurationSeconds:  results.End.Sub(results.Start).Seconds(),
+		Size:             results.Size,
+		SHA256:           results.SHA256,
+		Compression:      results.Compression,
+		Statements:       results.Statements,
+		FailedStatements: results.Failed,
+		Success:          err == nil,
+	}
+	if len(results.Files) > 1 {
+		for _, f := range results.Files {
+			out.Files = append(out.Files, restoreFileOutput{
+				Name:             f.Name,
+				Databases:        f.Databases,
+				Statements:       f.Statements,
+				FailedStatements: f.Failed,
+				Restored:         f.Error == "" && !f.Skipped,
+				Error:            f.Error,
+			})
+		}
+	}
+	for _, c := range results.RowCounts {
+		out.RowCounts = append(out.RowCounts, rowCountOutput{
+			Database: c.Database,
+			Table:    c.Table,
+			Expected: c.Expected,
+			Actual:   c.Actual,
+			Matched:  !c.Mismatched(),
+			Error:    c.Error,
+		})
+	}
+	if err != nil {
+		out.Error = err.Error()
+	}
+	return out
+}
+
+// benchmarkOutput the results of a benchmark, printed with --output json
+type benchmarkOutput struct {
+	Run             string                       `json:"run"`
+	Sample          string                       `json:"sample,omitempty"`
+	Databases       []string                     `json:"databases,omitempty"`
+	SampleSize      int64                        `json:"sampleSize"`
+	Start           time.Time                    `json:"start"`
+	End             time.Time                    `json:"end"`
+	DurationSeconds float64                      `json:"durationSeconds"`
+	Compressions    []compressionBenchmarkOutput `json:"compressions"`
+}
+
+// compressionBenchmarkOutput the benchmark of one compression at one level
+type compressionBenchmarkOutput struct {
+	Compression string `json:"compression"`
+	// Level the level of the compression; 0 if it has no levels
+	Level int   `json:"level"`
+	Size  int64 `json:"size"`
+	// Ratio the compressed size as a fraction of the size of the sample
+	Ratio                  float64 `json:"ratio"`
+	CompressSeconds        float64 `json:"compressSeconds"`
+	CompressBytesPerSecond int64   `json:"compressBytesPerSecond"`
+	UncompressSeconds      float64 `json:"uncompressSeconds"`
+	EncryptSeconds         float64 `json:"encryptSeconds"`
+}
+
+// newBenchmarkOutput the results of the benchmark run
+func newBenchmarkOutput(run string, results core.BenchmarkResults) benchmarkOutput {
+	out := benchmarkOutput{
+		Run:             run,
+		Sample:          results.Sample,
+		Databases:       results.Databases,
+		SampleSize:      results.SampleSize,
+		Start:           results.Start,
+		End:             results.End,
+		DurationSeconds: results.End.Sub(results.Start).Seconds(),
+		Compressions:    []compressionBenchmarkOutput{},
+	}
+	for _, b := range results.Compressions {
+		out.Compressions = append(out.Compressions, compressionBenchmarkOutput{
+			Compression:            b.Compression,
+			Level:                  b.Level,
+			Size:                   b.Size,
+			Ratio:                  b.Ratio(results.SampleSize),
+			CompressSeconds:        b.Compress.Seconds(),
+			CompressBytesPerSecond: bytesPerSecond(results.SampleSize, b.Compress),
+			UncompressSeconds:      b.Uncompress.Seconds(),
+			EncryptSeconds:         b.Encrypt.Seconds(),
+		})
+	}
+	return out
+}
+
+// printJSON write v as a single line of JSON, so that the outputs of successive runs can be read one at a time
+func printJSON(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpServerOutput(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	targets := []storage.Storage{file.New(url.URL{Scheme: "file", Path: "/a"}), file.New(url.URL{Scheme: "file", Path: "/b"})}
+	results := core.DumpResults{
+		Start:     start,
+		End:       start.Add(10 * time.Second),
+		Databases: []string{"app"},
+		Uploads: []core.UploadResult{
+			{Target: "file:///a", Filename: "db_backup.tgz", Start: start.Add(5 * time.Second), End: start.Add(7 * time.Second), Size: 1234, SHA256: "abc"},
+		},
+	}
+
+	// the first target got its file before the dump failed; the second did not
+	out := newDumpServerOutput("db1", targets, 1, results, errors.New("connection lost"))
+	assert.False(t, out.Success)
+	assert.Equal(t, 10.0, out.DurationSeconds)
+	if assert.Len(t, out.Targets, 2) {
+		assert.True(t, out.Targets[0].Success)
+		assert.Equal(t, []fileOutput{{Filename: "db_backup.tgz", Size: 1234, SHA256: "abc", DurationSeconds: 2}}, out.Targets[0].Files)
+		assert.False(t, out.Targets[1].Success)
+		assert.Equal(t, "connection lost", out.Targets[1].Error)
+		assert.Empty(t, out.Targets[1].Files)
+	}
+
+	var b bytes.Buffer
+	assert.NoError(t, printJSON(&b, dumpOutput{Run: "r1", Success: true, Servers: []dumpServerOutput{newDumpServerOutput("", targets[:1], 1, results, nil)}}))
+	assert.Contains(t, b.String(), `"files":[{"filename":"db_backup.tgz","size":1234,"sha256":"abc","durationSeconds":2}]`)
+	assert.Equal(t, 1, bytes.Count(b.Bytes(), []byte("\n")))
+	assert.NotContains(t, b.String(), `"replica"`)
+
+	results.Replica = "replica1"
+	assert.Equal(t, "replica1", newDumpServerOutput("db1", targets, 1, results, nil).Replica)
+	results.Unchanged = true
+	assert.True(t, newDumpServerOutput("db1", targets, 1, results, nil).Unchanged)
+}
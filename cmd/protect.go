@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/storage/stdio"
+)
+
+func protectCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
+	return protection(passedExecs, cmdConfig, false)
+}
+
+func unprotectCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
+	return protection(passedExecs, cmdConfig, true)
+}
+
+// protection the command to protect a dump from pruning or, with unprotect, to remove its protection
+func protection(passedExecs execs, cmdConfig *cmdConfiguration, unprotect bool) (*cobra.Command, error) {
+	if cmdConfig == nil {
+		return nil, fmt.Errorf("cmdConfig is nil")
+	}
+	var v *viper.Viper
+	var cmd = &cobra.Command{
+		Use:   "protect",
+		Short: "protect a dump from pruning",
+		Long: `Protect a dump on a target from pruning, e.g. a known-good backup from before a migration, so that no prune
+		removes it, whatever the retention policy, nor counts it towards how many to keep. The protection is a small
+		marker file on the target, beside the dumps. The dump is selected as for restore: by its name, the newest that
+		matches a pattern with --newest, or the newest with a label with --label. Use unprotect to remove the protection.`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			bindFlags(cmd, v)
+		},
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmdConfig.logger.Debugf("starting %s", cmd.Name())
+			target := v.GetString("target")
+			if target == stdio.Name {
+				return fmt.Errorf("cannot %s a dump on stdout (-), which keeps no dumps", cmd.Name())
+			}
+			label := v.GetString("label")
+			var targetFile string
+			switch {
+			case len(args) == 1 && label != "":
+				return fmt.Errorf("either the dump to %s or --label, not both", cmd.Name())
+			case len(args) == 1:
+				targetFile = args[0]
+			case label == "":
+				return fmt.Errorf("requires the dump to %s, or --label to %s the newest dump with the label", cmd.Name(), cmd.Name())
+			}
+			if err := core.ValidateLabel(label); err != nil {
+				return err
+			}
+			store, err := parseTarget(target, cmdConfig)
+			if err != nil {
+				return err
+			}
+			var executor execs
+			executor = &core.Executor{}
+			if passedExecs != nil {
+				executor = passedExecs
+			}
+			executor.SetLogger(cmdConfig.logger)
+
+			// at this point, any errors should not have usage
+			cmd.SilenceUsage = true
+			uid := uuid.New()
+			protectOpts := core.ProtectOptions{
+				Target:     store,
+				TargetFile: targetFile,
+				Newest:     v.GetBool("newest"),
+				Label:      label,
+				Unprotect:  unprotect,
+				Run:        uid,
+			}
+			if !unprotect {
+				protectOpts.Reason = v.GetString("reason")
+			}
+			if err := executor.Protect(cmd.Context(), protectOpts); err != nil {
+				return fmt.Errorf("error running %s: %v", cmd.Name(), err)
+			}
+			complete := "Protect complete"
+			if unprotect {
+				complete = "Unprotect complete"
+			}
+			executor.GetLogger().WithField("run", uid.String()).Info(complete)
+			return nil
+		},
+	}
+	if unprotect {
+		cmd.Use = "unprotect"
+		cmd.Short = "remove the protection of a dump from pruning"
+		cmd.Long = `Remove the protection of a dump on a target from pruning, given by protect, so that it is pruned as any
+		other. The dump is selected as for protect, and need no longer be on the target.`
+	}
+	// target - where the dump is
+	v = viper.New()
+	v.SetEnvPrefix("db_protect")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+
+	flags := cmd.Flags()
+	flags.String("target", "", "full URL target to the dump, or a reference to a target in the configuration file, e.g. `config://targetname`.")
+	if err := cmd.MarkFlagRequired("target"); err != nil {
+		return nil, err
+	}
+
+	// label - the newest dump with the label
+	flags.String("label", "", "The newest dump on the target with this label, e.g. `pre-deploy`, by the time in its filename, instead of a given dump.")
+
+	// newest - the filename is a pattern
+	flags.Bool("newest", false, "The filename is a pattern, e.g. `backups/db1/*.sql.gz`, and the newest file on the target that matches it is the dump. On S3, wildcards can be anywhere in it; on other targets, only in the filename.")
+
+	// reason - why it is protected
+	if !unprotect {
+		flags.String("reason", "", "Why the dump is protected, e.g. `before the 2.0 migration`, recorded in the marker for whoever reads it.")
+	}
+
+	return cmd, nil
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"io"
+	"net/url"
+	"testing"
+
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestProtectCmd(t *testing.T) {
+	t.Parallel()
+
+	fileTarget := "file:///foo/bar"
+	fileTargetURL, _ := url.Parse(fileTarget)
+
+	tests := []struct {
+		name                   string
+		args                   []string // the command, "protect" or "unprotect", is the first
+		wantErr                bool
+		expectedProtectOptions core.ProtectOptions
+	}{
+		{"missing target", []string{"protect", "filename.tgz"}, true, core.ProtectOptions{}},
+		{"missing dump", []string{"protect", "--target", fileTarget}, true, core.ProtectOptions{}},
+		{"protect", []string{"protect", "--target", fileTarget, "filename.tgz", "--reason", "before the migration"}, false, core.ProtectOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", Reason: "before the migration"}},
+		{"label", []string{"protect", "--target", fileTarget, "--label", "pre-migration"}, false, core.ProtectOptions{Target: file.New(*fileTargetURL), Label: "pre-migration"}},
+		{"newest", []string{"protect", "--target", fileTarget, "db_backup_*.tgz", "--newest"}, false, core.ProtectOptions{Target: file.New(*fileTargetURL), TargetFile: "db_backup_*.tgz", Newest: true}},
+		{"label and dump", []string{"protect", "--target", fileTarget, "filename.tgz", "--label", "pre-migration"}, true, core.ProtectOptions{}},
+		{"invalid label", []string{"protect", "--target", fileTarget, "--label", "pre migration"}, true, core.ProtectOptions{}},
+		{"stdout", []string{"protect", "--target", "-", "filename.tgz"}, true, core.ProtectOptions{}},
+		{"unprotect", []string{"unprotect", "--target", fileTarget, "filename.tgz"}, false, core.ProtectOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", Unprotect: true}},
+		{"unprotect has no reason", []string{"unprotect", "--target", fileTarget, "filename.tgz", "--reason", "done"}, true, core.ProtectOptions{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockExecs()
+			m.On("Protect", mock.MatchedBy(func(protectOpts core.ProtectOptions) bool {
+				if equalIgnoreFields(protectOpts, tt.expectedProtectOptions, []string{"Run"}) {
+					return true
+				}
+				t.Errorf("protectOpts compare failed: %#v %#v", protectOpts, tt.expectedProtectOptions)
+				return false
+			})).Return(nil)
+			cmd, err := rootCmd(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd.SetOutput(io.Discard)
+			cmd.SetArgs(tt.args)
+			err = cmd.Execute()
+			switch {
+			case err == nil && tt.wantErr:
+				t.Fatal("missing error")
+			case err != nil && !tt.wantErr:
+				t.Fatal(err)
+			case err == nil:
+				m.AssertExpectations(t)
+			}
+		})
+	}
+}
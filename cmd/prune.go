@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -24,6 +25,9 @@ func pruneCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, e
 		For time-based, the format is: 1d, 1w, 1m, 1y for days, weeks, months, years, respectively.
 		For number-based, the format is: 1c, 2c, 3c, etc. for the count of backups to keep.
 		
+		To keep a minimum number of backups as well as everything within a time, use keep-last and keep-within
+		together; a backup is kept if either keeps it. Use dry-run to see what would be pruned, without removing anything.
+
 		For time-based, prune always converts the time to hours, and then rounds up. This means that 2d is treated as 48h, and
 		any backups must be at least 48 full hours ago to be pruned.
 		`,
@@ -35,8 +39,10 @@ func pruneCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, e
 			retention := v.GetString("retention")
 			targetURLs := v.GetStringSlice("target")
 			var (
-				targets []storage.Storage
-				err     error
+				targets        []storage.Storage
+				targetPolicies map[string]core.PrunePolicy
+				targetPatterns map[string]string
+				err            error
 			)
 
 			if len(targetURLs) > 0 {
@@ -52,7 +58,7 @@ func pruneCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, e
 				if cmdConfig.configuration != nil {
 					// parse the target objects, then the ones listed for the backup
 					targetStructures := cmdConfig.configuration.Targets
-					dumpTargets := cmdConfig.configuration.Dump.Targets
+					dumpTargets := cmdConfig.configuration.DumpTargets()
 					for _, t := range dumpTargets {
 						var store storage.Storage
 						if target, ok := targetStructures[t]; !ok {
@@ -62,6 +68,18 @@ func pruneCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, e
 							if err != nil {
 								return fmt.Errorf("target %s from dump configuration has invalid URL: %v", t, err)
 							}
+							if target.Prune != nil {
+								if targetPolicies == nil {
+									targetPolicies = map[string]core.PrunePolicy{}
+								}
+								targetPolicies[store.URL()] = core.PrunePolicy{Retention: target.Prune.Retention, KeepLast: target.Prune.KeepLast, KeepWithin: target.Prune.KeepWithin}
+							}
+							if target.FilenamePattern != "" {
+								if targetPatterns == nil {
+									targetPatterns = map[string]string{}
+								}
+								targetPatterns[store.URL()] = target.FilenamePattern
+							}
 						}
 						targets = append(targets, store)
 					}
@@ -71,16 +89,41 @@ func pruneCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, e
 			if retention == "" && cmdConfig.configuration != nil {
 				retention = cmdConfig.configuration.Prune.Retention
 			}
+			keepLast := v.GetInt("keep-last")
+			if !v.IsSet("keep-last") && cmdConfig.configuration != nil {
+				keepLast = cmdConfig.configuration.Prune.KeepLast
+			}
+			keepWithin := v.GetString("keep-within")
+			if keepWithin == "" && cmdConfig.configuration != nil {
+				keepWithin = cmdConfig.configuration.Prune.KeepWithin
+			}
+			label := v.GetString("label")
+			if label == "" && cmdConfig.configuration != nil {
+				label = cmdConfig.configuration.Dump.Label
+			}
+			if err := core.ValidateLabel(label); err != nil {
+				return err
+			}
+			dryRun := v.GetBool("dry-run")
 
 			// timer options
 			once := v.GetBool("once")
 			if !v.IsSet("once") && cmdConfig.configuration != nil {
 				once = cmdConfig.configuration.Dump.Schedule.Once
 			}
+			// the prune schedule of its own, if there is one, else that of the dumps
 			cron := v.GetString("cron")
+			if cron == "" && cmdConfig.configuration != nil {
+				cron = cmdConfig.configuration.Prune.Cron
+			}
 			if cron == "" && cmdConfig.configuration != nil {
 				cron = cmdConfig.configuration.Dump.Schedule.Cron
 			}
+			if cron != "" {
+				if err := core.ValidateCron(cron); err != nil {
+					return fmt.Errorf("invalid cron schedule %q: %v", cron, err)
+				}
+			}
 			begin := v.GetString("begin")
 			if begin == "" && cmdConfig.configuration != nil {
 				begin = cmdConfig.configuration.Dump.Schedule.Begin
@@ -103,9 +146,9 @@ func pruneCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, e
 			}
 			executor.SetLogger(cmdConfig.logger)
 
-			if err := executor.Timer(timerOpts, func() error {
+			if err := executor.Timer(cmd.Context(), timerOpts, func(ctx context.Context) error {
 				uid := uuid.New()
-				return executor.Prune(core.PruneOptions{Targets: targets, Retention: retention, Run: uid})
+				return executor.Prune(ctx, core.PruneOptions{Targets: targets, Retention: retention, KeepLast: keepLast, KeepWithin: keepWithin, TargetPolicies: targetPolicies, TargetFilenamePatterns: targetPatterns, Label: label, DryRun: dryRun, Run: uid})
 			}); err != nil {
 				return fmt.Errorf("error running prune: %w", err)
 			}
@@ -125,6 +168,16 @@ func pruneCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, e
 	// retention
 	flags.String("retention", "", "Retention period for backups. REQUIRED. Can be number of backups or time-based. For time-based, the format is: 1d, 1w, 1m, 1y for days, weeks, months, years, respectively. For number-based, the format is: 1c, 2c, 3c, etc. for the count of backups to keep.")
 
+	// combined retention
+	flags.Int("keep-last", 0, "Keep at least this many of the most recent backups. Can be combined with keep-within, in which case a backup is kept if either keeps it. Cannot be combined with retention.")
+	flags.String("keep-within", "", "Keep all backups within this age, in the same time-based format as retention, e.g. 30d. Can be combined with keep-last, in which case a backup is kept if either keeps it. Cannot be combined with retention.")
+
+	// label
+	flags.String("label", "", "Prune only the backups with this label, e.g. `pre-deploy`, as if there were no others. Without it, only the backups without a label are pruned.")
+
+	// dry run
+	flags.Bool("dry-run", false, "Log the backups that would be pruned, without removing them.")
+
 	// frequency
 	flags.Int("frequency", defaultFrequency, "how often to run prunes, in minutes")
 
@@ -132,7 +185,7 @@ func pruneCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command, e
 	flags.String("begin", defaultBegin, "What time to do the first prune. Must be in one of two formats: Absolute: HHMM, e.g. `2330` or `0415`; or Relative: +MM, i.e. how many minutes after starting the container, e.g. `+0` (immediate), `+10` (in 10 minutes), or `+90` in an hour and a half")
 
 	// cron
-	flags.String("cron", "", "Set the prune schedule using standard [crontab syntax](https://en.wikipedia.org/wiki/Cron), a single line.")
+	flags.String("cron", "", "Set the prune schedule using standard [crontab syntax](https://en.wikipedia.org/wiki/Cron), a single line, with an optional seconds field first, e.g. `0 30 2 * * *`.")
 
 	// once
 	flags.Bool("once", false, "Override all other settings and run the prune once immediately and exit. Useful if you use an external scheduler (e.g. as part of an orchestration solution like Cattle or Docker Swarm or [kubernetes cron jobs](https://kubernetes.io/docs/concepts/workloads/controllers/cron-jobs/)) and don't want the container to do the scheduling internally.")
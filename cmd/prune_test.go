@@ -26,7 +26,13 @@ func TestPruneCmd(t *testing.T) {
 	}{
 		{"invalid target URL", []string{"--target", "def"}, "", true, core.PruneOptions{}, core.TimerOptions{}},
 		{"file URL", []string{"--target", fileTarget, "--retention", "1h"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "1h"}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}},
+		{"combined retention dry run", []string{"--target", fileTarget, "--keep-last", "7", "--keep-within", "30d", "--dry-run"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, KeepLast: 7, KeepWithin: "30d", DryRun: true}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}},
+		{"label", []string{"--target", fileTarget, "--retention", "90d", "--label", "pre-deploy"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "90d", Label: "pre-deploy"}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}},
+		{"invalid label", []string{"--target", fileTarget, "--retention", "90d", "--label", "pre deploy"}, "", true, core.PruneOptions{}, core.TimerOptions{}},
 		{"config file", []string{"--config-file", "testdata/config.yml"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "1h"}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}},
+		{"config file with target filename pattern", []string{"--config-file", "testdata/targetpattern.yml"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "1h", TargetFilenamePatterns: map[string]string{fileTarget: "{{ .year }}/{{ .month }}/db_backup_{{ .now }}.{{ .compression }}"}}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}},
+		{"config file target policy", []string{"--config-file", "testdata/prune.yml", "--dry-run"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "1h", TargetPolicies: map[string]core.PrunePolicy{fileTarget: {KeepLast: 7, KeepWithin: "30d"}}, DryRun: true}, core.TimerOptions{Frequency: defaultFrequency, Begin: defaultBegin}},
+		{"config file prune cron", []string{"--config-file", "testdata/prunecron.yml"}, "", false, core.PruneOptions{Targets: []storage.Storage{file.New(*fileTargetURL)}, Retention: "7d"}, core.TimerOptions{Cron: "0 0 3 * * *", Frequency: defaultFrequency, Begin: defaultBegin}},
 	}
 
 	for _, tt := range tests {
@@ -3,14 +3,18 @@ package cmd
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/databacker/mysql-backup/pkg/compression"
 	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/database"
 	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/storage/stdio"
 	"github.com/databacker/mysql-backup/pkg/util"
 )
 
@@ -26,11 +30,50 @@ func restoreCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command,
 		PreRun: func(cmd *cobra.Command, args []string) {
 			bindFlags(cmd, v)
 		},
-		Args: cobra.MinimumNArgs(1),
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cmdConfig.logger.Debug("starting restore")
-			targetFile := args[0]
 			target := v.GetString("target")
+			// a dump piped to stdin is the one file to restore
+			fromStdin := target == stdio.Name
+			if fromStdin && isTerminal(cmd.InOrStdin()) {
+				return fmt.Errorf("restoring from stdin (-), which is a terminal; pipe the dump to it")
+			}
+			// the file to restore, unless restoring the newest with a label
+			label := v.GetString("label")
+			// choosing from a menu needs someone to answer it; otherwise it is as if not interactive
+			interactive := v.GetBool("interactive")
+			if interactive && !fromStdin && !isTerminal(cmd.InOrStdin()) {
+				cmdConfig.logger.Warn("stdin is not a terminal, so not selecting the dump to restore interactively")
+				interactive = false
+			}
+			// how many older than the newest, of the dumps with the label, those that match the pattern, or those
+			// without a label
+			offset := v.GetInt("offset")
+			newest := v.GetBool("newest")
+			var targetFile string
+			switch {
+			case fromStdin && (len(args) == 1 || label != "" || interactive || offset != 0):
+				return fmt.Errorf("restoring from stdin (-), so cannot restore a file, --label, --offset or --interactive as well")
+			case fromStdin:
+				targetFile = stdio.Name
+			case interactive && (len(args) == 1 || label != "" || offset != 0):
+				return fmt.Errorf("either --interactive or the file to restore, --label or --offset, not more than one")
+			case len(args) == 1 && label != "":
+				return fmt.Errorf("either the file to restore or --label, not both")
+			case len(args) == 1 && offset != 0 && !newest:
+				return fmt.Errorf("--offset with a file requires --newest, so that the file is a pattern")
+			case len(args) == 1:
+				targetFile = args[0]
+			case label == "" && !interactive && offset == 0:
+				return fmt.Errorf("requires the file to restore, --label to restore the newest dump with the label, --offset to restore one older than the newest, or --interactive to select one")
+			}
+			if err := core.ValidateLabel(label); err != nil {
+				return err
+			}
+			if err := core.ValidateOffset(offset); err != nil {
+				return err
+			}
 			// get databases namesand mappings
 			databasesMap := make(map[string]string)
 			databases := strings.TrimSpace(v.GetString("database"))
@@ -57,6 +100,10 @@ func restoreCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command,
 			if compressionVar != "" {
 				compressionAlgo = compressionVar
 			}
+			// stdin has no filename from which to tell the compression, so it must be given
+			if fromStdin && !v.IsSet("compression") && (cmdConfig.configuration == nil || cmdConfig.configuration.Dump.Compression == "") {
+				return fmt.Errorf("restoring from stdin (-) requires --compression, as there is no filename to tell it from")
+			}
 			if compressionAlgo != "" {
 				compressor, err = compression.GetCompressor(compressionAlgo)
 				if err != nil {
@@ -64,36 +111,115 @@ func restoreCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command,
 				}
 			}
 
-			// target URL can reference one from the config file, or an absolute one
-			// if it's not in the config file, it's an absolute one
-			// if it is in the config file, it's a reference to one of the targets in the config file
-			u, err := util.SmartParse(target)
-			if err != nil {
-				return fmt.Errorf("invalid target url: %v", err)
-			}
 			var store storage.Storage
-			if u.Scheme == "config" {
-				// get the target name
-				targetName := u.Host
-				// get the target from the config file
-				if cmdConfig.configuration == nil {
-					return fmt.Errorf("no configuration file found")
+			if fromStdin {
+				store = stdio.New(cmd.InOrStdin(), nil)
+			} else if store, err = parseTarget(target, cmdConfig); err != nil {
+				return err
+			}
+			if interactive {
+				if targetFile, err = selectDump(cmd.Context(), store, cmd.InOrStdin(), cmd.ErrOrStderr(), log.NewEntry(cmdConfig.logger)); err != nil {
+					return err
 				}
-				if target, ok := cmdConfig.configuration.Targets[targetName]; !ok {
-					return fmt.Errorf("target %s not found in configuration", targetName)
-				} else {
-					if store, err = target.Storage.Storage(); err != nil {
-						return fmt.Errorf("error creating storage for target %s: %v", targetName, err)
-					}
+			}
+			force := v.GetBool("force")
+			if !v.IsSet("force") && cmdConfig.configuration != nil {
+				force = cmdConfig.configuration.Restore.Force
+			}
+			raw := v.GetBool("raw")
+			if newest && fromStdin {
+				return fmt.Errorf("restoring from stdin (-), so there is no newest file to find")
+			}
+			var compressionDictionaries []string
+			if cmdConfig.configuration != nil {
+				compressionDictionaries = cmdConfig.configuration.Restore.CompressionDictionaries
+			}
+			if v.IsSet("compression-dictionary") {
+				compressionDictionaries = v.GetStringSlice("compression-dictionary")
+			}
+			characterSet := v.GetString("character-set")
+			if characterSet == "" && cmdConfig.configuration != nil {
+				characterSet = cmdConfig.configuration.Restore.CharacterSet
+			}
+			if characterSet != "" {
+				if err := database.ValidateCharset(characterSet); err != nil {
+					return err
 				}
-				// need to add the path to the specific target file
-			} else {
-				// parse the target URL
-				store, err = storage.ParseURL(target, cmdConfig.creds)
-				if err != nil {
-					return fmt.Errorf("invalid target url: %v", err)
+			}
+			collation := v.GetString("collation")
+			if collation == "" && cmdConfig.configuration != nil {
+				collation = cmdConfig.configuration.Restore.Collation
+			}
+			if collation != "" {
+				if err := database.ValidateCollation(characterSet, collation); err != nil {
+					return err
 				}
 			}
+			// the server to restore to, which the config may set apart from the one that is dumped
+			dbconn := cmdConfig.restoreDBConn
+			dbconn.Charset = characterSet
+			dbconn.Collation = collation
+			maxAllowedPacket := v.GetInt("max-allowed-packet")
+			if !v.IsSet("max-allowed-packet") && cmdConfig.configuration != nil {
+				maxAllowedPacket = cmdConfig.configuration.Restore.MaxAllowedPacket
+			}
+			if err := database.ValidateMaxAllowedPacket(maxAllowedPacket); err != nil {
+				return err
+			}
+			dbconn.MaxAllowedPacket = maxAllowedPacket
+			progressInterval := v.GetDuration("progress-interval")
+			if !v.IsSet("progress-interval") && cmdConfig.configuration != nil && cmdConfig.configuration.Restore.ProgressInterval != 0 {
+				progressInterval = time.Duration(cmdConfig.configuration.Restore.ProgressInterval)
+			}
+			tmpPath := v.GetString("tmp-path")
+			if tmpPath == "" && cmdConfig.configuration != nil {
+				tmpPath = cmdConfig.configuration.Restore.TmpPath
+			}
+			privateTmp := v.GetBool("private-tmp")
+			if !v.IsSet("private-tmp") && cmdConfig.configuration != nil {
+				privateTmp = cmdConfig.configuration.Restore.PrivateTmp
+			}
+			dropBeforeRestore := v.GetBool("drop-before-restore")
+			if !v.IsSet("drop-before-restore") && cmdConfig.configuration != nil {
+				dropBeforeRestore = cmdConfig.configuration.Restore.DropBeforeRestore
+			}
+			dropAllowed := v.GetStringSlice("drop-allowed")
+			if len(dropAllowed) == 0 && cmdConfig.configuration != nil {
+				dropAllowed = cmdConfig.configuration.Restore.DropAllowed
+			}
+			// make this slice nil if it's empty, so it is consistent; used mainly for test consistency
+			if len(dropAllowed) == 0 {
+				dropAllowed = nil
+			}
+			if err := database.ValidateDropAllowed(dropBeforeRestore, dropAllowed); err != nil {
+				return err
+			}
+			concurrency := v.GetInt("concurrency")
+			if !v.IsSet("concurrency") && cmdConfig.configuration != nil {
+				concurrency = cmdConfig.configuration.Restore.Concurrency
+			}
+			if err := core.ValidateRestoreConcurrency(concurrency); err != nil {
+				return err
+			}
+			normalizeLineEndings := v.GetBool("normalize-line-endings")
+			if !v.IsSet("normalize-line-endings") && cmdConfig.configuration != nil {
+				normalizeLineEndings = cmdConfig.configuration.Restore.NormalizeLineEndings
+			}
+			gtidMode := v.GetString("gtid-mode")
+			if gtidMode == "" && cmdConfig.configuration != nil {
+				gtidMode = cmdConfig.configuration.Restore.GTIDMode
+			}
+			if err := database.ValidateGTIDMode(gtidMode); err != nil {
+				return err
+			}
+			verifyRowCounts := v.GetBool("verify-row-counts")
+			if !v.IsSet("verify-row-counts") && cmdConfig.configuration != nil {
+				verifyRowCounts = cmdConfig.configuration.Restore.VerifyRowCounts
+			}
+			output := v.GetString("output")
+			if err := validateOutput(output); err != nil {
+				return err
+			}
 			var executor execs
 			executor = &core.Executor{}
 			if passedExecs != nil {
@@ -105,17 +231,38 @@ func restoreCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command,
 			cmd.SilenceUsage = true
 			uid := uuid.New()
 			restoreOpts := core.RestoreOptions{
-				Target:       store,
-				TargetFile:   targetFile,
-				Compressor:   compressor,
-				DatabasesMap: databasesMap,
-				DBConn:       cmdConfig.dbconn,
-				Run:          uid,
-			}
-			if err := executor.Restore(restoreOpts); err != nil {
+				Target:                  store,
+				TargetFile:              targetFile,
+				Compressor:              compressor,
+				DatabasesMap:            databasesMap,
+				DBConn:                  dbconn,
+				Run:                     uid,
+				Force:                   force,
+				Raw:                     raw,
+				CompressionDictionaries: compressionDictionaries,
+				ProgressInterval:        progressInterval,
+				Newest:                  newest,
+				Tmp:                     core.TmpOptions{Path: tmpPath, Private: privateTmp},
+				DropBeforeRestore:       dropBeforeRestore,
+				DropAllowed:             dropAllowed,
+				Label:                   label,
+				Offset:                  offset,
+				Concurrency:             concurrency,
+				NormalizeLineEndings:    normalizeLineEndings,
+				GTIDMode:                gtidMode,
+				VerifyRowCounts:         verifyRowCounts,
+			}
+			results, err := executor.Restore(cmd.Context(), restoreOpts)
+			runLogger := executor.GetLogger().WithField("run", uid.String())
+			if output == outputJSON {
+				if printErr := printJSON(cmd.OutOrStdout(), newRestoreOutput(uid.String(), store.URL(), targetFile, results, err)); printErr != nil {
+					runLogger.Warnf("unable to print output: %v", printErr)
+				}
+			}
+			if err != nil {
 				return fmt.Errorf("error restoring: %v", err)
 			}
-			passedExecs.GetLogger().Info("Restore complete")
+			runLogger.Info("Restore complete")
 			return nil
 		},
 	}
@@ -126,17 +273,73 @@ func restoreCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command,
 	v.AutomaticEnv()
 
 	flags := cmd.Flags()
-	flags.String("target", "", "full URL target to the backup that you wish to restore")
+	flags.String("target", "", "full URL target to the backup that you wish to restore, or `-` to restore the dump piped to stdin, which requires --compression")
 	if err := cmd.MarkFlagRequired("target"); err != nil {
 		return nil, err
 	}
 
 	// compression
-	flags.String("compression", defaultCompression, "Compression to use. Supported are: `gzip`, `bzip2`")
+	flags.String("compression", defaultCompression, "Compression to use if it cannot be detected from the file header or name. Supported are: `gzip`, `bzip2`, `zstd`, `none`")
+
+	// compression-dictionary
+	flags.StringSlice("compression-dictionary", nil, "zstd dictionary files with which the dump may have been compressed, comma-separated or repeated. Each zstd dump names the dictionary it needs, so give older dictionaries too when restoring older dumps.")
 
 	// specific database to which to restore
 	flags.String("database", "", "Mapping of from:to database names to which to restore, comma-separated, e.g. foo:bar,buz:qux. Replaces the `USE <database>` clauses in a backup file. If blank, uses the file as is.")
 
+	// force - continue past errors
+	flags.Bool("force", false, "Continue restoring past statements that fail, rather than aborting. Failed statements are reported at the end. Use with care, as it can leave the database partially restored.")
+
+	// raw - a single SQL dump, rather than an archive from dump
+	flags.Bool("raw", false, "The file is a single compressed SQL dump, e.g. a `.sql.gz` from mysqldump or another tool, rather than an archive created by `dump`. The compression is detected from the file.")
+
+	// label - restore the newest dump with the label
+	flags.String("label", "", "Restore the newest dump on the target with this label, e.g. `pre-deploy`, by the time in its filename, instead of a given file.")
+
+	// offset - an older dump than the newest
+	flags.Int("offset", 0, "Restore the dump this many older than the newest, e.g. `1` for the second newest, when the newest is no good: with --label, of the dumps with the label; with --newest, of the files that match the pattern; with neither, and no file, of the dumps without a label, by the time in their filenames.")
+
+	// interactive - choose the dump from a menu
+	flags.Bool("interactive", false, "Select the dump to restore from a menu of those on the target, newest first, instead of giving the file. Only if stdin is a terminal; otherwise it is ignored, and the file or --label is required as usual.")
+
+	// newest - the filename is a pattern
+	flags.Bool("newest", false, "The filename is a pattern, e.g. `backups/db1/*.sql.gz`, and the newest file on the target that matches it is restored. On S3, wildcards can be anywhere in it; on other targets, only in the filename.")
+
+	// character-set
+	flags.String("character-set", "", "Character set of the connection to the database, like mysql --default-character-set. Should be that of the dump, which dumps from `dump` set themselves. Defaults to `utf8mb4`.")
+
+	// collation
+	flags.String("collation", "", "Collation of the connection to the database, set with SET NAMES <charset> COLLATE <collation>, which must be one of the character set. A dump that sets its own character set, as one from dump does, sets the collation too. Defaults to the default collation of the character set.")
+
+	// max-allowed-packet - for statements with huge rows
+	flags.Int("max-allowed-packet", 0, "Largest statement, in bytes, that the restore may send to the database, e.g. for a dump with huge rows. The server's max_allowed_packet must allow it too. 0 for the default of 64MiB.")
+
+	// progress-interval - how often to log progress
+	flags.Duration("progress-interval", core.DefaultRestoreProgressInterval, "How often to log how far the restore has got, in bytes read after decompression and statements applied, e.g. `1m`. 0 to not log progress.")
+
+	// drop-before-restore - for a clean restore
+	flags.Bool("drop-before-restore", false, "Drop each database that the dump uses, and create it again, before restoring it, so that no tables that are not in the dump are left. Requires --drop-allowed.")
+	flags.StringSlice("drop-allowed", []string{}, "Databases, after any renaming with --database, that --drop-before-restore may drop, comma-separated or repeated. The restore fails, without dropping anything, if the dump uses any other.")
+
+	// concurrency - restore the file of each database at once
+	flags.Int("concurrency", 0, "How many of the files in the dump, one per database, to restore at once, each in its own transaction. Only if each file is of databases that no other file is, as in dumps from `dump`; otherwise they are restored one at a time. 0 or 1 to restore one at a time.")
+
+	// gtid-mode - for dumps that set GTID_PURGED, e.g. from mysqldump
+	flags.String("gtid-mode", "", "How to handle the SET @@GLOBAL.GTID_PURGED of a dump, e.g. from mysqldump: warn, to check before restoring whether the server can take it and warn if not; strip, to restore without it, leaving the GTIDs of the server as they are; reset, to reset the binary logs and GTIDs of the server first if it could not otherwise take it. Empty to restore it as it is.")
+
+	// verify-row-counts - check the restore against the dump
+	flags.Bool("verify-row-counts", false, "Once restored, count the rows of each table and compare them with those that the dump records it dumped, failing the restore if any differ. Only dumps from dump record them, and only of tables dumped whole, without --where and not by partition. Off by default, as counting scans every table.")
+
+	// normalize-line-endings - for dumps written on Windows
+	flags.Bool("normalize-line-endings", false, "Convert the line endings of the SQL in the dump, CRLF or a lone CR, to LF as it is restored, e.g. of dumps written on Windows. Off by default, as it reads every byte of the dump once more.")
+
+	// temporary files
+	flags.String("tmp-path", "", "Directory in which to create the temporary files of the restore, which hold the dump uncompressed, e.g. an encrypted tmpfs. Defaults to the system temporary directory, usually `/tmp`.")
+	flags.Bool("private-tmp", false, "Create the temporary files of the restore readable only by the user running it, in a directory of its own, which is removed when the restore is done.")
+
+	// output - format of the summary of the restore
+	flags.String("output", outputText, "Format of the summary of the restore: `text` for just the logs, or `json` to also print a JSON summary on stdout.")
+
 	// pre-restore scripts
 	flags.String("pre-restore-scripts", "", "Directory wherein any file ending in `.sh` will be run after retrieving the dump file but pre-restore.")
 
@@ -145,3 +348,33 @@ func restoreCmd(passedExecs execs, cmdConfig *cmdConfiguration) (*cobra.Command,
 
 	return cmd, nil
 }
+
+// parseTarget the storage of the target URL, which can reference one from the config file, as config://name, or
+// be an absolute one. If it is not in the config file, it's an absolute one.
+func parseTarget(target string, cmdConfig *cmdConfiguration) (storage.Storage, error) {
+	u, err := util.SmartParse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target url: %v", err)
+	}
+	if u.Scheme != "config" {
+		store, err := storage.ParseURL(target, cmdConfig.creds)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target url: %v", err)
+		}
+		return store, nil
+	}
+	// get the target from the config file, by its name
+	targetName := u.Host
+	if cmdConfig.configuration == nil {
+		return nil, fmt.Errorf("no configuration file found")
+	}
+	t, ok := cmdConfig.configuration.Targets[targetName]
+	if !ok {
+		return nil, fmt.Errorf("target %s not found in configuration", targetName)
+	}
+	store, err := t.Storage.Storage()
+	if err != nil {
+		return nil, fmt.Errorf("error creating storage for target %s: %v", targetName, err)
+	}
+	return store, nil
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bytes"
 	"io"
 	"net/url"
 	"testing"
@@ -9,6 +10,7 @@ import (
 	"github.com/databacker/mysql-backup/pkg/core"
 	"github.com/databacker/mysql-backup/pkg/database"
 	"github.com/databacker/mysql-backup/pkg/storage/file"
+	"github.com/databacker/mysql-backup/pkg/storage/stdio"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -33,7 +35,46 @@ func TestRestoreCmd(t *testing.T) {
 		{"missing server and target options", []string{""}, "", true, core.RestoreOptions{}},
 		{"invalid target URL", []string{"--server", "abc", "--target", "def"}, "", true, core.RestoreOptions{}},
 		{"valid URL missing dump filename", []string{"--server", "abc", "--target", "file:///foo/bar"}, "", true, core.RestoreOptions{}},
-		{"valid file URL", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--verbose", "2"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, Compressor: &compression.GzipCompressor{}}},
+		{"valid file URL", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--verbose", "2"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}}},
+		{"force", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--force"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}, Force: true}},
+		{"newest", []string{"--server", "abc", "--target", fileTarget, "backups/db1/*.tgz", "--newest"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "backups/db1/*.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}, Newest: true}},
+		{"label", []string{"--server", "abc", "--target", fileTarget, "--label", "pre-deploy"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}, Label: "pre-deploy"}},
+		{"offset with label", []string{"--server", "abc", "--target", fileTarget, "--label", "pre-deploy", "--offset", "1"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}, Label: "pre-deploy", Offset: 1}},
+		{"offset with newest", []string{"--server", "abc", "--target", fileTarget, "backups/db1/*.tgz", "--newest", "--offset", "2"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "backups/db1/*.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}, Newest: true, Offset: 2}},
+		{"offset alone", []string{"--server", "abc", "--target", fileTarget, "--offset", "1"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}, Offset: 1}},
+		{"offset with filename", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--offset", "1"}, "", true, core.RestoreOptions{}},
+		{"negative offset", []string{"--server", "abc", "--target", fileTarget, "--label", "pre-deploy", "--offset", "-1"}, "", true, core.RestoreOptions{}},
+		{"stdin and offset", []string{"--server", "abc", "--target", "-", "--compression", "gzip", "--offset", "1"}, "", true, core.RestoreOptions{}},
+		{"label and filename", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--label", "pre-deploy"}, "", true, core.RestoreOptions{}},
+		{"invalid label", []string{"--server", "abc", "--target", fileTarget, "--label", "pre_deploy"}, "", true, core.RestoreOptions{}},
+		{"raw", []string{"--server", "abc", "--target", fileTarget, "legacy.sql.bz2", "--raw", "--compression", "bzip2"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "legacy.sql.bz2", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.Bzip2Compressor{}, Raw: true}},
+		{"compression dictionaries", []string{"--server", "abc", "--target", fileTarget, "filename.tzst", "--compression-dictionary", "/dicts/v2.dict", "--compression-dictionary", "/dicts/v1.dict"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tzst", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}, CompressionDictionaries: []string{"/dicts/v2.dict", "/dicts/v1.dict"}}},
+		{"character set", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--character-set", "latin1"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort, Charset: "latin1"}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}}},
+		{"invalid character set", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--character-set", "utf16"}, "", true, core.RestoreOptions{}},
+		{"collation", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--collation", "utf8mb4_unicode_ci"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort, Collation: "utf8mb4_unicode_ci"}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}}},
+		{"collation of another character set", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--character-set", "latin1", "--collation", "utf8mb4_unicode_ci"}, "", true, core.RestoreOptions{}},
+		{"progress interval", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--progress-interval", "0"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, Compressor: &compression.GzipCompressor{}}},
+		{"concurrency", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--concurrency", "4"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}, Concurrency: 4}},
+		{"normalize line endings", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--normalize-line-endings"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}, NormalizeLineEndings: true}},
+		{"gtid mode", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--gtid-mode", "strip"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}, GTIDMode: database.GTIDStrip}},
+		{"invalid gtid mode", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--gtid-mode", "off"}, "", true, core.RestoreOptions{}},
+		{"verify row counts", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--verify-row-counts"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}, VerifyRowCounts: true}},
+		{"invalid concurrency", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--concurrency", "-1"}, "", true, core.RestoreOptions{}},
+		{"max allowed packet", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--max-allowed-packet", "1073741824"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort, MaxAllowedPacket: 1 << 30}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}}},
+		{"invalid max allowed packet", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--max-allowed-packet", "-1"}, "", true, core.RestoreOptions{}},
+		{"interactive without a terminal", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--interactive"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}}},
+		{"interactive without a terminal or file", []string{"--server", "abc", "--target", fileTarget, "--interactive"}, "", true, core.RestoreOptions{}},
+		{"stdin", []string{"--server", "abc", "--target", "-", "--compression", "gzip"}, "", false, core.RestoreOptions{Target: stdio.New(&bytes.Buffer{}, nil), TargetFile: "-", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}}},
+		{"stdin without compression", []string{"--server", "abc", "--target", "-"}, "", true, core.RestoreOptions{}},
+		{"stdin and filename", []string{"--server", "abc", "--target", "-", "--compression", "gzip", "filename.tgz"}, "", true, core.RestoreOptions{}},
+		{"stdin and label", []string{"--server", "abc", "--target", "-", "--compression", "gzip", "--label", "pre-deploy"}, "", true, core.RestoreOptions{}},
+		{"drop before restore", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--drop-before-restore", "--drop-allowed", "app,app_test"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}, DropBeforeRestore: true, DropAllowed: []string{"app", "app_test"}}},
+		{"tls", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--tls", "true"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort, TLS: database.TLSRequired}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}}},
+		{"invalid tls", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--tls", "required"}, "", true, core.RestoreOptions{}},
+		{"restore database from config", []string{"--config-file", "testdata/restoredatabase.yml", "--target", fileTarget, "filename.tgz"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "staging", Port: 3307, User: "backup", Pass: "yyyy", TLS: database.TLSSkipVerify}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}}},
+		{"restore database overridden by flag", []string{"--config-file", "testdata/restoredatabase.yml", "--server", "abc", "--target", fileTarget, "filename.tgz"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: 3307, User: "backup", Pass: "yyyy", TLS: database.TLSSkipVerify}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}}},
+		{"drop before restore without allowed", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--drop-before-restore"}, "", true, core.RestoreOptions{}},
+		{"private tmp", []string{"--server", "abc", "--target", fileTarget, "filename.tgz", "--tmp-path", "/dev/shm", "--private-tmp"}, "", false, core.RestoreOptions{Target: file.New(*fileTargetURL), TargetFile: "filename.tgz", DBConn: database.Connection{Host: "abc", Port: defaultPort}, DatabasesMap: map[string]string{}, ProgressInterval: core.DefaultRestoreProgressInterval, Compressor: &compression.GzipCompressor{}, Tmp: core.TmpOptions{Path: "/dev/shm", Private: true}}},
 	}
 
 	for _, tt := range tests {
@@ -51,6 +92,7 @@ func TestRestoreCmd(t *testing.T) {
 				t.Fatal(err)
 			}
 			cmd.SetOutput(io.Discard)
+			cmd.SetIn(&bytes.Buffer{})
 			cmd.SetArgs(append([]string{"restore"}, tt.args...))
 			err = cmd.Execute()
 			switch {
@@ -1,15 +1,21 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/databacker/mysql-backup/pkg/config"
 	"github.com/databacker/mysql-backup/pkg/core"
 	"github.com/databacker/mysql-backup/pkg/database"
 	databacklog "github.com/databacker/mysql-backup/pkg/log"
 	"github.com/databacker/mysql-backup/pkg/storage/credentials"
+	"github.com/databacker/mysql-backup/pkg/tracing"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -19,18 +25,25 @@ import (
 type execs interface {
 	SetLogger(logger *log.Logger)
 	GetLogger() *log.Logger
-	Dump(opts core.DumpOptions) (core.DumpResults, error)
-	Restore(opts core.RestoreOptions) error
-	Prune(opts core.PruneOptions) error
-	Timer(timerOpts core.TimerOptions, cmd func() error) error
+	Dump(ctx context.Context, opts core.DumpOptions) (core.DumpResults, error)
+	Restore(ctx context.Context, opts core.RestoreOptions) (core.RestoreResults, error)
+	Fetch(ctx context.Context, opts core.FetchOptions) (core.FetchResults, error)
+	Prune(ctx context.Context, opts core.PruneOptions) error
+	CheckTargets(ctx context.Context, opts core.CheckOptions) (core.CheckResults, error)
+	Benchmark(ctx context.Context, opts core.BenchmarkOptions) (core.BenchmarkResults, error)
+	Protect(ctx context.Context, opts core.ProtectOptions) error
+	WaitForDatabase(ctx context.Context, opts core.WaitOptions) error
+	Timer(ctx context.Context, timerOpts core.TimerOptions, cmd func(ctx context.Context) error) error
 }
 
 type subCommand func(execs, *cmdConfiguration) (*cobra.Command, error)
 
-var subCommands = []subCommand{dumpCmd, restoreCmd, pruneCmd}
+var subCommands = []subCommand{dumpCmd, restoreCmd, fetchCmd, pruneCmd, checkCmd, benchmarkCmd, protectCmd, unprotectCmd, configCmd, versionCmd}
 
 type cmdConfiguration struct {
-	dbconn        database.Connection
+	dbconn database.Connection
+	// restoreDBConn the connection to restore to, which is dbconn unless the config has a restore database
+	restoreDBConn database.Connection
 	creds         credentials.Creds
 	configuration *config.ConfigSpec
 	logger        *log.Logger
@@ -38,6 +51,8 @@ type cmdConfiguration struct {
 
 const (
 	defaultPort = 3306
+	// tracingShutdownTimeout how long to wait, when exiting, to export the remaining spans
+	tracingShutdownTimeout = 10 * time.Second
 )
 
 func rootCmd(execs execs) (*cobra.Command, error) {
@@ -58,23 +73,16 @@ func rootCmd(execs execs) (*cobra.Command, error) {
 		AWS_REGION: Region in which the bucket resides
 		AWS_ENDPOINT_URL: Endpoint URL to use instead of default s3.<region>.amazonaws.com
 		AWS_PATH_STYLE: Use path-style URLs for S3 requests instead of virtual-hosted-style URLs
+		AWS_PROXY: URL of the HTTP proxy for S3 requests instead of the one from HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+		AWS_RESUME_DIR: Local directory in which to keep large S3 uploads in progress, so that they can be resumed
 		`,
 		PersistentPreRunE: func(c *cobra.Command, args []string) error {
 			bindFlags(cmd, v)
-			var logger = log.New()
-			logLevel := v.GetInt("verbose")
-			debugSet := v.IsSet("debug")
-			if !v.IsSet("verbose") && (v.GetBool("debug") || (debugSet && v.GetString("debug") == "true")) {
-				logLevel = 1
-			}
-			switch logLevel {
-			case 0:
-				logger.SetLevel(log.InfoLevel)
-			case 1:
-				logger.SetLevel(log.DebugLevel)
-			case 2:
-				logger.SetLevel(log.TraceLevel)
+			// only checked by RunE, without retrieving a remote config
+			if c == cmd && v.GetBool("config-check") {
+				return nil
 			}
+			var logger = log.New()
 
 			// read the config file, if needed; the structure of the config differs quite some
 			// from the necessarily flat env vars/CLI flags, so we can't just use viper's
@@ -96,6 +104,13 @@ func rootCmd(execs execs) (*cobra.Command, error) {
 				}
 			}
 
+			// the CLI flags and env vars take precedence over the level in the config file, for a single run
+			level, err := logLevel(v, actualConfig)
+			if err != nil {
+				return err
+			}
+			logger.SetLevel(level)
+
 			// the structure of our config file is more complex and with relationships than our config/env var
 			// so we cannot use a single viper structure, as described above.
 
@@ -113,6 +128,11 @@ func rootCmd(execs execs) (*cobra.Command, error) {
 				if actualConfig.Database.Credentials.Password != "" {
 					cmdConfig.dbconn.Pass = actualConfig.Database.Credentials.Password
 				}
+				cmdConfig.dbconn.ConnectTimeout = time.Duration(actualConfig.Database.ConnectTimeout)
+				cmdConfig.dbconn.QueryTimeout = time.Duration(actualConfig.Database.QueryTimeout)
+				cmdConfig.dbconn.MaxRetries = actualConfig.Database.MaxRetries
+				cmdConfig.dbconn.DefaultsFile = actualConfig.Database.DefaultsFile
+				cmdConfig.dbconn.TLS = actualConfig.Database.TLS
 				cmdConfig.configuration = actualConfig
 
 				if actualConfig.Telemetry.URL != "" {
@@ -123,24 +143,70 @@ func rootCmd(execs execs) (*cobra.Command, error) {
 					}
 					logger.AddHook(loggerHook)
 				}
+				if actualConfig.Tracing.Endpoint != "" {
+					// set up tracing, flushing the spans of the run once it completes, even if it failed
+					shutdown, err := tracing.Setup(c.Context(), tracing.Options{
+						Endpoint:    actualConfig.Tracing.Endpoint,
+						Headers:     actualConfig.Tracing.Headers,
+						ServiceName: actualConfig.Tracing.ServiceName,
+						Version:     getBuildInfo().Version,
+					})
+					if err != nil {
+						return fmt.Errorf("unable to set up tracing: %w", err)
+					}
+					cobra.OnFinalize(func() {
+						ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+						defer cancel()
+						if err := shutdown(ctx); err != nil {
+							logger.Warnf("unable to export traces: %v", err)
+						}
+					})
+				}
 			}
 
-			// override config with env var or CLI flag, if set
-			dbHost := v.GetString("server")
-			if dbHost != "" && v.IsSet("server") {
-				cmdConfig.dbconn.Host = dbHost
-			}
-			dbPort := v.GetInt("port")
-			if dbPort != 0 && (v.IsSet("port") || cmdConfig.dbconn.Port == 0) {
-				cmdConfig.dbconn.Port = dbPort
-			}
-			dbUser := v.GetString("user")
-			if dbUser != "" && v.IsSet("user") {
-				cmdConfig.dbconn.User = dbUser
+			cmdConfig.restoreDBConn = cmdConfig.dbconn
+			if actualConfig != nil {
+				cmdConfig.restoreDBConn = restoreConnection(cmdConfig.dbconn, actualConfig.Restore.Database)
 			}
-			dbPass := v.GetString("pass")
-			if dbPass != "" && v.IsSet("pass") {
-				cmdConfig.dbconn.Pass = dbPass
+
+			// override config with env var or CLI flag, if set, for both the database to dump and that to restore to,
+			// as the flags are for this run
+			for _, conn := range []*database.Connection{&cmdConfig.dbconn, &cmdConfig.restoreDBConn} {
+				dbHost := v.GetString("server")
+				if dbHost != "" && v.IsSet("server") {
+					conn.Host = dbHost
+				}
+				if v.IsSet("defaults-file") {
+					conn.DefaultsFile = v.GetString("defaults-file")
+				}
+				// with a defaults file, leave the port unset, so that the port in the file, if any, is used
+				dbPort := v.GetInt("port")
+				if dbPort != 0 && (v.IsSet("port") || (conn.Port == 0 && conn.DefaultsFile == "")) {
+					conn.Port = dbPort
+				}
+				dbUser := v.GetString("user")
+				if dbUser != "" && v.IsSet("user") {
+					conn.User = dbUser
+				}
+				dbPass := v.GetString("pass")
+				if dbPass != "" && v.IsSet("pass") {
+					conn.Pass = dbPass
+				}
+				if v.IsSet("connect-timeout") {
+					conn.ConnectTimeout = v.GetDuration("connect-timeout")
+				}
+				if v.IsSet("query-timeout") {
+					conn.QueryTimeout = v.GetDuration("query-timeout")
+				}
+				if v.IsSet("max-retries") {
+					conn.MaxRetries = v.GetInt("max-retries")
+				}
+				if v.IsSet("tls") {
+					conn.TLS = v.GetString("tls")
+				}
+				if err := database.ValidateTLS(conn.TLS); err != nil {
+					return err
+				}
 			}
 
 			// these are not from the config file, as they are generic credentials, used across all targets.
@@ -152,16 +218,42 @@ func rootCmd(execs execs) (*cobra.Command, error) {
 					AccessKeyID:     v.GetString("aws-access-key-id"),
 					SecretAccessKey: v.GetString("aws-secret-access-key"),
 					Region:          v.GetString("aws-region"),
+					Proxy:           v.GetString("aws-proxy"),
+					ResumeDir:       v.GetString("aws-resume-dir"),
 				},
 				SMB: credentials.SMBCreds{
 					Username: v.GetString("smb-user"),
 					Password: v.GetString("smb-pass"),
 					Domain:   v.GetString("smb-domain"),
 				},
+				B2: credentials.B2Creds{
+					KeyID:          v.GetString("b2-key-id"),
+					ApplicationKey: v.GetString("b2-application-key"),
+				},
 			}
 			cmdConfig.logger = logger
 			return nil
 		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if !v.GetBool("config-check") {
+				return c.Help()
+			}
+			configFilePath := v.GetString("config-file")
+			if configFilePath == "" {
+				return fmt.Errorf("config-check requires a config file")
+			}
+			c.SilenceUsage = true
+			f, err := os.Open(configFilePath)
+			if err != nil {
+				return fmt.Errorf("fatal error config file: %w", err)
+			}
+			defer f.Close()
+			if err := config.CheckConfig(f); err != nil {
+				return fmt.Errorf("invalid config file %s: %w", configFilePath, err)
+			}
+			fmt.Fprintf(c.OutOrStdout(), "config file %s is valid\n", configFilePath)
+			return nil
+		},
 	}
 
 	v = viper.New()
@@ -175,6 +267,13 @@ func rootCmd(execs execs) (*cobra.Command, error) {
 
 	pflags.String("config-file", "", "config file to use, if any; individual CLI flags override config file")
 
+	// only for the root command, not persistent, so that it never runs a subcommand without the config
+	// --version, handled by cobra before anything else runs, the same as the version command
+	cmd.Version = getBuildInfo().Version
+	cmd.SetVersionTemplate(getBuildInfo().String())
+
+	cmd.Flags().Bool("config-check", false, "check that the config file is valid, with a known version and kind, and exit, without connecting to the database, the targets, or a remote config server")
+
 	// server port via CLI or env var or default
 	pflags.Int("port", defaultPort, "port for database server")
 
@@ -184,9 +283,21 @@ func rootCmd(execs execs) (*cobra.Command, error) {
 	// pass via CLI or env var
 	pflags.String("pass", "", "password for database server")
 
+	// MySQL option file with credentials, e.g. ~/.my.cnf
+	pflags.String("defaults-file", "", "MySQL option file, e.g. ~/.my.cnf, from which to read the user, password, host and port, from its [client] and [mysqldump] sections; explicit settings take precedence over the file")
+
+	// TLS to the database server via CLI or env var
+	pflags.String("tls", "", "whether and how to encrypt the connection to the database server: `true` to require TLS, verifying the certificate of the server; `skip-verify` to require it without verifying; `preferred` to use it if the server supports it; `false` for none, the default. Ignored for a unix socket.")
+
+	// timeouts and retries for metadata queries, e.g. listing databases, but not the dump or restore itself
+	pflags.Duration("connect-timeout", 0, "how long to wait to connect to the database server, e.g. 10s; 0 for the driver default")
+	pflags.Duration("query-timeout", 0, "how long to wait for each metadata query, such as listing the databases, e.g. 30s; 0 for no limit. Does not limit the dump or restore itself.")
+	pflags.Int("max-retries", 0, "how many times to retry a metadata query that fails with a transient connection error or times out")
+
 	// debug via CLI or env var or default
-	pflags.IntP("verbose", "v", 0, "set log level, 1 is debug, 2 is trace")
-	pflags.Bool("debug", false, "set log level to debug, equivalent of --verbose=1; if both set, --version always overrides")
+	pflags.IntP("verbose", "v", 0, "set log level, 1 is debug, 2 is trace; overrides logging in the config file")
+	pflags.Bool("debug", false, "set log level to debug, equivalent of --verbose=1; if both set, --verbose always overrides")
+	pflags.BoolP("quiet", "q", false, "set log level to error, so that only errors are logged; overrides logging in the config file. Cannot be combined with verbose or debug.")
 
 	// aws options
 	pflags.String("aws-endpoint-url", "", "Specify an alternative endpoint for s3 interoperable systems e.g. Digitalocean; ignored if not using s3.")
@@ -194,12 +305,18 @@ func rootCmd(execs execs) (*cobra.Command, error) {
 	pflags.String("aws-access-key-id", "", "Access Key for s3 and s3 interoperable systems; ignored if not using s3.")
 	pflags.String("aws-secret-access-key", "", "Secret Access Key for s3 and s3 interoperable systems; ignored if not using s3.")
 	pflags.String("aws-region", "", "Region for s3 and s3 interoperable systems; ignored if not using s3.")
+	pflags.String("aws-proxy", "", "URL of the HTTP proxy for s3 requests, e.g. http://proxy.example.com:3128, instead of the one from HTTP_PROXY, HTTPS_PROXY and NO_PROXY; ignored if not using s3.")
+	pflags.String("aws-resume-dir", "", "local directory in which to keep large s3 uploads in progress, along with a copy of each file, so that an upload that is interrupted is resumed by the next dump, rather than started again; ignored if not using s3.")
 
 	// smb options
 	pflags.String("smb-user", "", "SMB username")
 	pflags.String("smb-pass", "", "SMB username")
 	pflags.String("smb-domain", "", "SMB domain")
 
+	// b2 options
+	pflags.String("b2-key-id", "", "ID of the application key for b2; ignored if not using b2.")
+	pflags.String("b2-application-key", "", "Application key for b2; ignored if not using b2.")
+
 	for _, subCmd := range subCommands {
 		if sc, err := subCmd(execs, cmdConfig); err != nil {
 			return nil, err
@@ -225,13 +342,73 @@ func bindFlags(cmd *cobra.Command, v *viper.Viper) {
 	})
 }
 
+// logLevel the log level: from quiet, verbose or debug, if set, else logging in the config file cfg, if any,
+// else info
+func logLevel(v *viper.Viper, cfg *config.ConfigSpec) (log.Level, error) {
+	debug := v.GetBool("debug") || (v.IsSet("debug") && v.GetString("debug") == "true")
+	if v.GetBool("quiet") {
+		if v.GetInt("verbose") > 0 || debug {
+			return log.InfoLevel, errors.New("quiet cannot be combined with verbose or debug")
+		}
+		return log.ErrorLevel, nil
+	}
+	switch {
+	case v.IsSet("verbose"):
+		switch level := v.GetInt("verbose"); {
+		case level <= 0:
+			return log.InfoLevel, nil
+		case level == 1:
+			return log.DebugLevel, nil
+		default:
+			return log.TraceLevel, nil
+		}
+	case debug:
+		return log.DebugLevel, nil
+	case cfg != nil:
+		return cfg.Logging.Level(), nil
+	default:
+		return log.InfoLevel, nil
+	}
+}
+
+// restoreConnection the connection to the server to restore to: conn, that of the database configuration, with
+// each of the settings of the restore database d that is set in place of its own
+func restoreConnection(conn database.Connection, d config.RestoreDatabase) database.Connection {
+	if d.Server != "" {
+		conn.Host = d.Server
+	}
+	if d.Port != 0 {
+		conn.Port = d.Port
+	}
+	if d.Credentials.Username != "" {
+		conn.User = d.Credentials.Username
+	}
+	if d.Credentials.Password != "" {
+		conn.Pass = d.Credentials.Password
+	}
+	if d.TLS != "" {
+		conn.TLS = d.TLS
+	}
+	if d.ConnectTimeout != 0 {
+		conn.ConnectTimeout = time.Duration(d.ConnectTimeout)
+	}
+	if d.DefaultsFile != "" {
+		conn.DefaultsFile = d.DefaultsFile
+	}
+	return conn
+}
+
 // Execute primary function for cobra
 func Execute() {
 	rootCmd, err := rootCmd(nil)
 	if err != nil {
 		log.Fatal(err)
 	}
-	if err := rootCmd.Execute(); err != nil {
+	// cancel any dump, upload or restore in progress on interrupt or termination
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err = rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	"github.com/databacker/mysql-backup/pkg/config"
+)
+
+func TestConfigCheck(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	files := map[string]string{
+		"version.yml":           "version: config.databack.io/v0\nkind: local\nspec: {}\n",
+		"kind.yml":              "version: config.databack.io/v1\nkind: other\nspec: {}\n",
+		"syntax.yml":            "version: config.databack.io/v1\nkind: local\nspec: [\n",
+		"cron.yml":              "version: config.databack.io/v1\nkind: local\nspec:\n  dump:\n    schedule:\n      cron: \"61 * * * *\"\n",
+		"logging.yml":           "version: config.databack.io/v1\nkind: local\nspec:\n  logging: verbose\n",
+		"prune-cron.yml":        "version: config.databack.io/v1\nkind: local\nspec:\n  prune:\n    retention: 7d\n    cron: \"61 * * * *\"\n",
+		"target-prune-cron.yml": "version: config.databack.io/v1\nkind: local\nspec:\n  targets:\n    local:\n      type: file\n      url: file:///foo/bar\n      prune:\n        retention: 7d\n        cron: \"0 0 3 * * *\"\n",
+		"unknown-profile.yml":   "version: config.databack.io/v1\nkind: local\nspec:\n  profiles:\n    nightly:\n      compression: zstd\n  dump:\n    profile: weekly\n",
+		"target-pattern.yml":    "version: config.databack.io/v1\nkind: local\nspec:\n  targets:\n    local:\n      type: file\n      url: file:///foo/bar\n      filenamePattern: \"{{ .now \"\n",
+		// never retrieved, so the server need not exist
+		"remote.yml":                "version: config.databack.io/v1\nkind: remote\nspec:\n  url: https://config.example.invalid\n",
+		"credentials.yml":           "targets:\n  offsite:\n    accessKeyId: abc\n    secretAccessKey: def\n",
+		"credentials-unknown.yml":   "targets:\n  missing:\n    accessKeyId: abc\n",
+		"credentials-typo.yml":      "targets:\n  offsite:\n    accessKeyID: abc\n",
+		"with-credentials.yml":      "version: config.databack.io/v1\nkind: local\nspec:\n  credentialsFile: " + filepath.Join(dir, "credentials.yml") + "\n  targets:\n    offsite:\n      type: s3\n      url: s3://bucket/path\n",
+		"with-unknown-target.yml":   "version: config.databack.io/v1\nkind: local\nspec:\n  credentialsFile: " + filepath.Join(dir, "credentials-unknown.yml") + "\n  targets:\n    offsite:\n      type: s3\n      url: s3://bucket/path\n",
+		"with-credentials-typo.yml": "version: config.databack.io/v1\nkind: local\nspec:\n  credentialsFile: " + filepath.Join(dir, "credentials-typo.yml") + "\n  targets:\n    offsite:\n      type: s3\n      url: s3://bucket/path\n",
+		"with-missing-file.yml":     "version: config.databack.io/v1\nkind: local\nspec:\n  credentialsFile: " + filepath.Join(dir, "missing.yml") + "\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{"valid", []string{"--config-check", "--config-file", "testdata/config.yml"}, false},
+		{"remote", []string{"--config-check", "--config-file", filepath.Join(dir, "remote.yml")}, false},
+		{"no config file", []string{"--config-check"}, true},
+		{"missing config file", []string{"--config-check", "--config-file", filepath.Join(dir, "missing.yml")}, true},
+		{"unknown version", []string{"--config-check", "--config-file", filepath.Join(dir, "version.yml")}, true},
+		{"unknown kind", []string{"--config-check", "--config-file", filepath.Join(dir, "kind.yml")}, true},
+		{"invalid yaml", []string{"--config-check", "--config-file", filepath.Join(dir, "syntax.yml")}, true},
+		{"invalid cron", []string{"--config-check", "--config-file", filepath.Join(dir, "cron.yml")}, true},
+		{"invalid logging", []string{"--config-check", "--config-file", filepath.Join(dir, "logging.yml")}, true},
+		{"invalid prune cron", []string{"--config-check", "--config-file", filepath.Join(dir, "prune-cron.yml")}, true},
+		{"target prune cron", []string{"--config-check", "--config-file", filepath.Join(dir, "target-prune-cron.yml")}, true},
+		{"prune cron", []string{"--config-check", "--config-file", "testdata/prunecron.yml"}, false},
+		{"dump profile", []string{"--config-check", "--config-file", "testdata/profile.yml"}, false},
+		{"unknown dump profile", []string{"--config-check", "--config-file", filepath.Join(dir, "unknown-profile.yml")}, true},
+		{"invalid target filename pattern", []string{"--config-check", "--config-file", filepath.Join(dir, "target-pattern.yml")}, true},
+		{"credentials file", []string{"--config-check", "--config-file", filepath.Join(dir, "with-credentials.yml")}, false},
+		{"credentials for unknown target", []string{"--config-check", "--config-file", filepath.Join(dir, "with-unknown-target.yml")}, true},
+		{"credentials with unknown field", []string{"--config-check", "--config-file", filepath.Join(dir, "with-credentials-typo.yml")}, true},
+		{"missing credentials file", []string{"--config-check", "--config-file", filepath.Join(dir, "with-missing-file.yml")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := rootCmd(newMockExecs())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetErr(&out)
+			cmd.SetArgs(tt.args)
+			err = cmd.Execute()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, out.String(), "is valid")
+		})
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	var debugConfig config.ConfigSpec
+	if err := yaml.Unmarshal([]byte("logging: debug\n"), &debugConfig); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		flags    map[string]any
+		cfg      *config.ConfigSpec
+		expected log.Level
+		wantErr  bool
+	}{
+		{"default", nil, nil, log.InfoLevel, false},
+		{"config", nil, &debugConfig, log.DebugLevel, false},
+		{"config without logging", nil, &config.ConfigSpec{}, log.InfoLevel, false},
+		{"verbose", map[string]any{"verbose": 2}, nil, log.TraceLevel, false},
+		{"debug", map[string]any{"debug": true}, nil, log.DebugLevel, false},
+		{"verbose overrides debug", map[string]any{"verbose": 2, "debug": true}, nil, log.TraceLevel, false},
+		{"verbose overrides config", map[string]any{"verbose": 0}, &debugConfig, log.InfoLevel, false},
+		{"quiet", map[string]any{"quiet": true}, nil, log.ErrorLevel, false},
+		{"quiet overrides config", map[string]any{"quiet": true}, &debugConfig, log.ErrorLevel, false},
+		{"quiet and verbose", map[string]any{"quiet": true, "verbose": 1}, nil, 0, true},
+		{"quiet and debug", map[string]any{"quiet": true, "debug": true}, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			for k, val := range tt.flags {
+				v.Set(k, val)
+			}
+			level, err := logLevel(v, tt.cfg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, level)
+		})
+	}
+}
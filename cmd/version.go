@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/databacker/mysql-backup/pkg/config"
+)
+
+// set at build time, e.g. -ldflags "-X github.com/databacker/mysql-backup/cmd.version=v1.0.0"; see the Makefile
+var (
+	version = ""
+	commit  = ""
+	date    = ""
+)
+
+// buildInfo what exactly is running, for support and to match behaviour to releases
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+	// ConfigVersion the version of config file that this build supports
+	ConfigVersion string `json:"configVersion"`
+}
+
+// getBuildInfo the build info, from the ldflags, or, for what they do not set, from what the go toolchain
+// embeds, e.g. with go install or go build in a git checkout
+func getBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:       version,
+		Commit:        commit,
+		Date:          date,
+		GoVersion:     runtime.Version(),
+		ConfigVersion: config.ConfigVersion,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		var modified bool
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if modified && commit == "" && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+	return info
+}
+
+// String the build info, one item to a line
+func (b buildInfo) String() string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "version: %s\n", b.Version)
+	fmt.Fprintf(&s, "commit: %s\n", b.Commit)
+	fmt.Fprintf(&s, "build date: %s\n", b.Date)
+	fmt.Fprintf(&s, "go version: %s\n", b.GoVersion)
+	fmt.Fprintf(&s, "config version: %s\n", b.ConfigVersion)
+	return s.String()
+}
+
+func printVersion(w io.Writer, output string) error {
+	info := getBuildInfo()
+	if output == outputJSON {
+		return printJSON(w, info)
+	}
+	_, err := io.WriteString(w, info.String())
+	return err
+}
+
+func versionCmd(execs execs, cmdConfig *cmdConfiguration) (*cobra.Command, error) {
+	var v *viper.Viper
+	var cmd = &cobra.Command{
+		Use:   "version",
+		Short: "show the version and build information",
+		Long: `Show the version of mysql-backup, the git commit and date from which it was built, the version of
+		Go with which it was built, and the version of config file that it supports.`,
+		Args: cobra.NoArgs,
+		// needs neither the database nor the config, which the root command would otherwise load
+		PersistentPreRunE: func(c *cobra.Command, args []string) error {
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bindFlags(cmd, v)
+			output := v.GetString("output")
+			if err := validateOutput(output); err != nil {
+				return err
+			}
+			return printVersion(cmd.OutOrStdout(), output)
+		},
+	}
+	v = viper.New()
+	cmd.Flags().String("output", outputText, "Format of the version information: `text`, one item to a line, or `json`.")
+	return cmd, nil
+}
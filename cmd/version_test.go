@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/databacker/mysql-backup/pkg/config"
+)
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"command", []string{"version"}},
+		{"flag", []string{"--version"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := rootCmd(newMockExecs())
+			require.NoError(t, err)
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetErr(&out)
+			cmd.SetArgs(tt.args)
+			require.NoError(t, cmd.Execute())
+			assert.Contains(t, out.String(), "go version: "+runtime.Version()+"\n")
+			assert.Contains(t, out.String(), "config version: "+config.ConfigVersion+"\n")
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		cmd, err := rootCmd(newMockExecs())
+		require.NoError(t, err)
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetArgs([]string{"version", "--output", "json"})
+		require.NoError(t, cmd.Execute())
+		var info buildInfo
+		require.NoError(t, json.Unmarshal(out.Bytes(), &info))
+		assert.Equal(t, runtime.Version(), info.GoVersion)
+		assert.Equal(t, config.ConfigVersion, info.ConfigVersion)
+		assert.NotEmpty(t, info.Version)
+		assert.NotEmpty(t, info.Commit)
+	})
+}
@@ -0,0 +1,507 @@
+// Package backup runs a backup from a configuration, for use as a library, with no
+// command-line parsing or global state.
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/databacker/mysql-backup/pkg/compression"
+	"github.com/databacker/mysql-backup/pkg/config"
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/database"
+	"github.com/databacker/mysql-backup/pkg/notify"
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/util"
+)
+
+const (
+	defaultCompression      = "gzip"
+	defaultPort             = 3306
+	defaultMaxAllowedPacket = 4194304
+)
+
+// Result the outcome of a backup run
+type Result struct {
+	Start     time.Time
+	End       time.Time
+	Timestamp string
+	// DumpStart and DumpEnd the time spent dumping the database, excluding uploads
+	DumpStart time.Time
+	DumpEnd   time.Time
+	// Targets the outcome for each target, in the order of the dump targets in the configuration
+	Targets []TargetResult
+}
+
+// TargetResult the outcome of a backup run for a single target
+type TargetResult struct {
+	// Name the name of the target in the configuration
+	Name    string
+	URL     string
+	Uploads []core.UploadResult
+	// Err the reason the target did not receive all of its files, nil on success
+	Err error
+}
+
+type options struct {
+	logger *log.Logger
+}
+
+// Option an option for Run
+type Option func(*options)
+
+// WithLogger log to the given logger; the default is to discard all logs
+func WithLogger(logger *log.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// Run run a single backup of the database in cfg to each of the dump targets in cfg,
+// followed by a prune if cfg has a retention policy, notifying any providers in cfg of the outcome.
+// Cancelling ctx aborts the run.
+func Run(ctx context.Context, cfg config.ConfigSpec, opts ...Option) (Result, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.logger == nil {
+		o.logger = log.New()
+		o.logger.SetOutput(io.Discard)
+	}
+
+	var result Result
+	// only the single server in database is dumped, as each of a list of them needs a dump of its own
+	if len(cfg.Databases) > 0 {
+		return result, fmt.Errorf("%d servers in databases, but only the single server in database can be dumped; set database, or run once for each server", len(cfg.Databases))
+	}
+	names, targets, err := DumpTargets(cfg)
+	if err != nil {
+		return result, err
+	}
+	for i, t := range targets {
+		result.Targets = append(result.Targets, TargetResult{Name: names[i], URL: t.URL()})
+	}
+	dumpOpts, err := DumpOptions(cfg, targets)
+	if err != nil {
+		return result, err
+	}
+	notifiers, err := cfg.Notifications.Notifiers()
+	if err != nil {
+		return result, fmt.Errorf("invalid notifications configuration: %v", err)
+	}
+	metrics, err := cfg.Metrics.Notifiers()
+	if err != nil {
+		return result, fmt.Errorf("invalid metrics configuration: %v", err)
+	}
+	notifiers = append(notifiers, metrics...)
+	notifyLogger := o.logger.WithField("run", dumpOpts.Run.String())
+
+	executor := &core.Executor{Logger: o.logger}
+	start := time.Now()
+	dumpResults, dumpErr := executor.Dump(ctx, dumpOpts)
+	event := notify.Event{
+		Run:             dumpOpts.Run,
+		Operation:       notify.OperationDump,
+		Server:          dumpOpts.DBConn.Host,
+		Databases:       dumpResults.Databases,
+		Start:           start,
+		End:             time.Now(),
+		Err:             dumpErr,
+		PreviousSuccess: notify.EarliestSuccess(dumpResults.PreviousSuccess),
+	}
+	if len(event.Databases) == 0 {
+		event.Databases = dumpOpts.DBNames
+	}
+	notify.Send(ctx, notifiers, event, notifyLogger)
+	result.Start, result.End = dumpResults.Start, dumpResults.End
+	result.Timestamp = dumpResults.Timestamp
+	result.DumpStart, result.DumpEnd = dumpResults.DumpStart, dumpResults.DumpEnd
+
+	// the main dump, plus one per separate table, goes to each target
+	expected := 1 + len(dumpOpts.SeparateTables)
+	for i := range result.Targets {
+		for _, u := range dumpResults.Uploads {
+			if u.Target == result.Targets[i].URL {
+				result.Targets[i].Uploads = append(result.Targets[i].Uploads, u)
+			}
+		}
+		if dumpErr != nil && len(result.Targets[i].Uploads) < expected {
+			result.Targets[i].Err = dumpErr
+		}
+	}
+	if dumpErr != nil {
+		return result, dumpErr
+	}
+
+	targetPolicies, err := TargetPrunePolicies(cfg)
+	if err != nil {
+		return result, err
+	}
+	if cfg.Prune.Retention != "" || cfg.Prune.KeepLast != 0 || cfg.Prune.KeepWithin != "" || len(targetPolicies) > 0 {
+		pruneOpts := core.PruneOptions{
+			Targets:                targets,
+			Retention:              cfg.Prune.Retention,
+			KeepLast:               cfg.Prune.KeepLast,
+			KeepWithin:             cfg.Prune.KeepWithin,
+			TargetPolicies:         targetPolicies,
+			TargetFilenamePatterns: dumpOpts.TargetFilenamePatterns,
+			Label:                  dumpOpts.Label,
+			Run:                    dumpOpts.Run,
+		}
+		if err := executor.Prune(ctx, pruneOpts); err != nil {
+			notify.Send(ctx, notifiers, notify.Event{Run: dumpOpts.Run, Operation: notify.OperationPrune, Err: err}, notifyLogger)
+			return result, fmt.Errorf("error running prune: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// DumpTargets the storage for each of the dump targets in cfg, along with their names
+func DumpTargets(cfg config.ConfigSpec) ([]string, []storage.Storage, error) {
+	var (
+		names   []string
+		targets []storage.Storage
+	)
+	for _, name := range cfg.DumpTargets() {
+		target, ok := cfg.Targets[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("target %s from dump configuration not found in targets configuration", name)
+		}
+		store, err := target.Storage.Storage()
+		if err != nil {
+			return nil, nil, fmt.Errorf("target %s from dump configuration has invalid URL: %v", name, err)
+		}
+		names = append(names, name)
+		targets = append(targets, store)
+	}
+	if len(targets) == 0 {
+		return nil, nil, fmt.Errorf("no targets specified")
+	}
+	return names, targets, nil
+}
+
+// TargetCompressors the compression of each of the dump targets in cfg that overrides the dump compression,
+// by the URL of the target
+func TargetCompressors(cfg config.ConfigSpec) (map[string]compression.Compressor, error) {
+	var compressors map[string]compression.Compressor
+	for _, name := range cfg.DumpTargets() {
+		target, ok := cfg.Targets[name]
+		if !ok {
+			continue
+		}
+		compressor, err := target.Compressor()
+		if err != nil {
+			return nil, fmt.Errorf("target %s from dump configuration has invalid compression: %v", name, err)
+		}
+		if compressor == nil {
+			continue
+		}
+		store, err := target.Storage.Storage()
+		if err != nil {
+			return nil, fmt.Errorf("target %s from dump configuration has invalid URL: %v", name, err)
+		}
+		if compressors == nil {
+			compressors = map[string]compression.Compressor{}
+		}
+		compressors[store.URL()] = compressor
+	}
+	return compressors, nil
+}
+
+// TargetPrunePolicies the retention policy of each of the dump targets in cfg that overrides the prune policy,
+// by the URL of the target
+func TargetPrunePolicies(cfg config.ConfigSpec) (map[string]core.PrunePolicy, error) {
+	var policies map[string]core.PrunePolicy
+	for _, name := range cfg.DumpTargets() {
+		target, ok := cfg.Targets[name]
+		if !ok || target.Prune == nil {
+			continue
+		}
+		store, err := target.Storage.Storage()
+		if err != nil {
+			return nil, fmt.Errorf("target %s from dump configuration has invalid URL: %v", name, err)
+		}
+		if policies == nil {
+			policies = map[string]core.PrunePolicy{}
+		}
+		policies[store.URL()] = core.PrunePolicy{Retention: target.Prune.Retention, KeepLast: target.Prune.KeepLast, KeepWithin: target.Prune.KeepWithin}
+	}
+	return policies, nil
+}
+
+// TargetFilenamePatterns the filename pattern of each of the dump targets in cfg that overrides the dump filename
+// pattern, by the URL of the target
+func TargetFilenamePatterns(cfg config.ConfigSpec) (map[string]string, error) {
+	var patterns map[string]string
+	for _, name := range cfg.DumpTargets() {
+		target, ok := cfg.Targets[name]
+		if !ok || target.FilenamePattern == "" {
+			continue
+		}
+		store, err := target.Storage.Storage()
+		if err != nil {
+			return nil, fmt.Errorf("target %s from dump configuration has invalid URL: %v", name, err)
+		}
+		if patterns == nil {
+			patterns = map[string]string{}
+		}
+		patterns[store.URL()] = target.FilenamePattern
+	}
+	return patterns, nil
+}
+
+// TargetVerifyUploads the dump targets in cfg to which uploads are read back to verify them, by the URL of the target
+func TargetVerifyUploads(cfg config.ConfigSpec) (map[string]bool, error) {
+	var verify map[string]bool
+	for _, name := range cfg.DumpTargets() {
+		target, ok := cfg.Targets[name]
+		if !ok || !target.VerifyUpload {
+			continue
+		}
+		store, err := target.Storage.Storage()
+		if err != nil {
+			return nil, fmt.Errorf("target %s from dump configuration has invalid URL: %v", name, err)
+		}
+		if verify == nil {
+			verify = map[string]bool{}
+		}
+		verify[store.URL()] = true
+	}
+	return verify, nil
+}
+
+// TargetTimeouts the timeouts of each of the dump targets in cfg that has any, by the URL of the target
+func TargetTimeouts(cfg config.ConfigSpec) (map[string]core.TargetTimeouts, error) {
+	var timeouts map[string]core.TargetTimeouts
+	for _, name := range cfg.DumpTargets() {
+		target, ok := cfg.Targets[name]
+		if !ok || target.Timeouts == (config.TargetTimeouts{}) {
+			continue
+		}
+		store, err := target.Storage.Storage()
+		if err != nil {
+			return nil, fmt.Errorf("target %s from dump configuration has invalid URL: %v", name, err)
+		}
+		if timeouts == nil {
+			timeouts = map[string]core.TargetTimeouts{}
+		}
+		timeouts[store.URL()] = core.TargetTimeouts{Connect: time.Duration(target.Timeouts.Connect), Upload: time.Duration(target.Timeouts.Upload)}
+	}
+	return timeouts, nil
+}
+
+// DumpOptions the options for a single dump of the database in cfg to targets. A list of servers in databases
+// is left to the caller, as each server needs a dump of its own, from these options with its connection.
+func DumpOptions(cfg config.ConfigSpec, targets []storage.Storage) (core.DumpOptions, error) {
+	compressionAlgo := cfg.Dump.Compression
+	if compressionAlgo == "" {
+		compressionAlgo = defaultCompression
+	}
+	compressor, err := compression.GetCompressor(compressionAlgo)
+	if err != nil {
+		return core.DumpOptions{}, fmt.Errorf("failure to get compression '%s': %v", compressionAlgo, err)
+	}
+	targetCompressors, err := TargetCompressors(cfg)
+	if err != nil {
+		return core.DumpOptions{}, err
+	}
+	targetVerifyUploads, err := TargetVerifyUploads(cfg)
+	if err != nil {
+		return core.DumpOptions{}, err
+	}
+	targetTimeouts, err := TargetTimeouts(cfg)
+	if err != nil {
+		return core.DumpOptions{}, err
+	}
+	targetPatterns, err := TargetFilenamePatterns(cfg)
+	if err != nil {
+		return core.DumpOptions{}, err
+	}
+	filenamePattern := cfg.Dump.FilenamePattern
+	if filenamePattern == "" {
+		filenamePattern = core.DefaultFilenamePattern
+	}
+	maxAllowedPacket := cfg.Dump.MaxAllowedPacket
+	if maxAllowedPacket == 0 {
+		maxAllowedPacket = defaultMaxAllowedPacket
+	}
+	dbconn := Connection(cfg.Database)
+	if err := database.ValidateTLS(dbconn.TLS); err != nil {
+		return core.DumpOptions{}, err
+	}
+	replica, err := Replica(cfg.Database, dbconn)
+	if err != nil {
+		return core.DumpOptions{}, err
+	}
+	if err := database.ValidateSkipSetCharset(cfg.Dump.SkipSetCharset, cfg.Dump.CharacterSet); err != nil {
+		return core.DumpOptions{}, err
+	}
+	if cfg.Dump.CharacterSet != "" {
+		if err := database.ValidateCharset(cfg.Dump.CharacterSet); err != nil {
+			return core.DumpOptions{}, err
+		}
+		dbconn.Charset = cfg.Dump.CharacterSet
+	}
+	if cfg.Dump.Collation != "" {
+		if err := database.ValidateCollation(cfg.Dump.CharacterSet, cfg.Dump.Collation); err != nil {
+			return core.DumpOptions{}, err
+		}
+		dbconn.Collation = cfg.Dump.Collation
+	}
+	// the replica is dumped from in the same character set and collation
+	if replica != nil {
+		replica.DBConn.Charset = dbconn.Charset
+		replica.DBConn.Collation = dbconn.Collation
+	}
+	if err := database.ValidateObjectTypes(cfg.Dump.ObjectTypes); err != nil {
+		return core.DumpOptions{}, err
+	}
+	if err := database.ValidateRowsPerInsert(cfg.Dump.RowsPerInsert, cfg.Dump.SkipExtendedInsert); err != nil {
+		return core.DumpOptions{}, err
+	}
+	if err := database.ValidateWhere(cfg.Dump.Where); err != nil {
+		return core.DumpOptions{}, err
+	}
+	if err := database.ValidatePartitions(cfg.Dump.Partitions); err != nil {
+		return core.DumpOptions{}, err
+	}
+	if err := compression.ValidateThreads(cfg.Dump.CompressionThreads); err != nil {
+		return core.DumpOptions{}, err
+	}
+	if err := core.ValidateLabel(cfg.Dump.Label); err != nil {
+		return core.DumpOptions{}, err
+	}
+	compressionLevel, autoLevel, err := compression.ParseLevel(cfg.Dump.CompressionLevel, cfg.Dump.CompressionLevelAuto.Small, cfg.Dump.CompressionLevelAuto.Large, compressor)
+	if err != nil {
+		return core.DumpOptions{}, err
+	}
+	if err := database.ValidateChanges(cfg.Dump.SkipUnchanged); err != nil {
+		return core.DumpOptions{}, err
+	}
+	var maxDumpSize int64
+	if cfg.Dump.MaxDumpSize != "" {
+		if maxDumpSize, err = util.ParseSize(cfg.Dump.MaxDumpSize); err != nil {
+			return core.DumpOptions{}, fmt.Errorf("invalid max dump size: %v", err)
+		}
+	}
+	report := core.ReportOptions{History: cfg.Dump.Report.History, Format: cfg.Dump.Report.Format}
+	if err := core.ValidateReport(report); err != nil {
+		return core.DumpOptions{}, err
+	}
+	priority := core.PriorityOptions{Nice: cfg.Dump.Nice, IONice: cfg.Dump.IONice}
+	if err := core.ValidatePriority(priority); err != nil {
+		return core.DumpOptions{}, err
+	}
+	var lock core.LockOptions
+	if cfg.Dump.Lock.File != "" {
+		lock = core.LockOptions{File: cfg.Dump.Lock.File, Wait: time.Duration(cfg.Dump.Lock.Wait), Stale: time.Duration(cfg.Dump.Lock.Stale)}
+		if lock.Stale == 0 {
+			lock.Stale = core.DefaultLockStale
+		}
+		if lock.Wait < 0 || lock.Stale < 0 {
+			return core.DumpOptions{}, fmt.Errorf("invalid lock wait %s or stale %s, must not be negative", lock.Wait, lock.Stale)
+		}
+	}
+	return core.DumpOptions{
+		Targets:                         targets,
+		Safechars:                       cfg.Dump.Safechars,
+		DBNames:                         cfg.Dump.Include,
+		DBConn:                          dbconn,
+		Compressor:                      compressor,
+		Exclude:                         cfg.Dump.Exclude,
+		PreBackupScripts:                cfg.Dump.Scripts.PreBackup,
+		PostBackupScripts:               cfg.Dump.Scripts.PostBackup,
+		ScriptsExec:                     cfg.Dump.Scripts.Exec,
+		Compact:                         cfg.Dump.Compact,
+		SuppressUseDatabase:             cfg.Dump.NoDatabaseName,
+		MaxAllowedPacket:                maxAllowedPacket,
+		RowsPerInsert:                   cfg.Dump.RowsPerInsert,
+		SkipExtendedInsert:              cfg.Dump.SkipExtendedInsert,
+		Tmp:                             core.TmpOptions{Path: cfg.Dump.TmpPath, Private: cfg.Dump.PrivateTmp},
+		CompressionThreads:              cfg.Dump.CompressionThreads,
+		Label:                           cfg.Dump.Label,
+		CompressionLevel:                compressionLevel,
+		AutoCompressionLevel:            autoLevel,
+		Run:                             uuid.New(),
+		FilenamePattern:                 filenamePattern,
+		SeparateTables:                  cfg.Dump.SeparateTables,
+		SkipDuplicates:                  cfg.Dump.SkipDuplicates,
+		IncludeSystemDatabases:          cfg.Dump.IncludeSystemDatabases,
+		StateFile:                       cfg.Dump.StateFile,
+		Latest:                          cfg.Dump.Latest,
+		TargetCompressors:               targetCompressors,
+		TargetFilenamePatterns:          targetPatterns,
+		CompressionDictionary:           cfg.Dump.CompressionDictionary,
+		HexBlob:                         cfg.Dump.HexBlob,
+		SkipSetCharset:                  cfg.Dump.SkipSetCharset,
+		OrderByPrimary:                  cfg.Dump.OrderByPrimary,
+		SkipTzUtc:                       cfg.Dump.SkipTzUtc,
+		ObjectTypes:                     cfg.Dump.ObjectTypes,
+		KeepSQL:                         cfg.Dump.KeepSQL,
+		MaxDumpSize:                     maxDumpSize,
+		ConsistentAcrossDatabases:       cfg.Dump.ConsistentAcrossDatabases,
+		Where:                           cfg.Dump.Where,
+		Partitions:                      cfg.Dump.Partitions,
+		VerifyUpload:                    cfg.Dump.VerifyUpload,
+		TargetVerifyUploads:             targetVerifyUploads,
+		Lock:                            lock,
+		TargetTimeouts:                  targetTimeouts,
+		Replica:                         replica,
+		SkipCompressionIfIncompressible: cfg.Dump.SkipCompressionIfIncompressible,
+		Report:                          report,
+		SkipUnchanged:                   cfg.Dump.SkipUnchanged,
+		LinkUnchanged:                   cfg.Dump.LinkUnchanged,
+		Priority:                        priority,
+	}, nil
+}
+
+// Connection the database connection for the database configuration
+func Connection(db config.Database) database.Connection {
+	conn := database.Connection{
+		Host:           db.Server,
+		Port:           db.Port,
+		User:           db.Credentials.Username,
+		Pass:           db.Credentials.Password,
+		ConnectTimeout: time.Duration(db.ConnectTimeout),
+		QueryTimeout:   time.Duration(db.QueryTimeout),
+		MaxRetries:     db.MaxRetries,
+		DefaultsFile:   db.DefaultsFile,
+		TLS:            db.TLS,
+	}
+	if conn.Port == 0 && conn.DefaultsFile == "" {
+		conn.Port = defaultPort
+	}
+	return conn
+}
+
+// Replica the read replica of the database from which to dump, if it prefers one; nil if not. The replica has the
+// connection settings of the database, conn, other than those it sets.
+func Replica(db config.Database, conn database.Connection) (*core.ReplicaOptions, error) {
+	if !db.PreferReplica {
+		return nil, nil
+	}
+	if db.Replica.Server == "" {
+		return nil, fmt.Errorf("preferReplica requires a replica server")
+	}
+	if db.Replica.MaxLag < 0 {
+		return nil, fmt.Errorf("invalid replica maxLag %s, must not be negative", time.Duration(db.Replica.MaxLag))
+	}
+	replica := conn
+	replica.Host = db.Replica.Server
+	if db.Replica.Port != 0 {
+		replica.Port = db.Replica.Port
+	}
+	if db.Replica.Credentials.Username != "" {
+		replica.User = db.Replica.Credentials.Username
+	}
+	if db.Replica.Credentials.Password != "" {
+		replica.Pass = db.Replica.Credentials.Password
+	}
+	return &core.ReplicaOptions{DBConn: replica, MaxLag: time.Duration(db.Replica.MaxLag), Fallback: db.Replica.Fallback}, nil
+}
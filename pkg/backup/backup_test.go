@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/databacker/mysql-backup/pkg/compression"
+	"github.com/databacker/mysql-backup/pkg/config"
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+const testConfig = `
+dump:
+  include:
+  - db1
+  compression: bzip2
+  targets:
+  - local
+database:
+  server: abc
+  credentials:
+    username: user
+    password: pass
+targets:
+  local:
+    type: file
+    url: file:///backups
+    compression: none
+    filenamePattern: "{{ .year }}/{{ .month }}/db_backup_{{ .now }}.{{ .compression }}"
+    timeouts:
+      upload: 10m
+  unused:
+    type: file
+    url: file:///other
+`
+
+func TestDumpOptions(t *testing.T) {
+	var cfg config.ConfigSpec
+	if err := yaml.Unmarshal([]byte(testConfig), &cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	names, targets, err := DumpTargets(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"local"}, names)
+	if assert.Len(t, targets, 1) {
+		assert.Equal(t, "file:///backups", targets[0].URL())
+	}
+
+	opts, err := DumpOptions(cfg, targets)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"db1"}, opts.DBNames)
+	assert.Equal(t, &compression.Bzip2Compressor{}, opts.Compressor)
+	assert.Equal(t, database.Connection{Host: "abc", Port: defaultPort, User: "user", Pass: "pass"}, opts.DBConn)
+	assert.Equal(t, defaultMaxAllowedPacket, opts.MaxAllowedPacket)
+	assert.Equal(t, map[string]compression.Compressor{"file:///backups": &compression.NoneCompressor{}}, opts.TargetCompressors)
+	assert.Equal(t, map[string]core.TargetTimeouts{"file:///backups": {Upload: 10 * time.Minute}}, opts.TargetTimeouts)
+	assert.Equal(t, map[string]string{"file:///backups": "{{ .year }}/{{ .month }}/db_backup_{{ .now }}.{{ .compression }}"}, opts.TargetFilenamePatterns)
+	assert.Nil(t, opts.Replica)
+	assert.False(t, opts.SkipCompressionIfIncompressible)
+
+	cfg.Database.PreferReplica = true
+	_, err = DumpOptions(cfg, targets)
+	assert.Error(t, err, "a replica needs its server")
+	cfg.Database.Replica.Server = "replica"
+	cfg.Database.Replica.MaxLag = config.Duration(time.Minute)
+	opts, err = DumpOptions(cfg, targets)
+	assert.NoError(t, err)
+	assert.Equal(t, &core.ReplicaOptions{DBConn: database.Connection{Host: "replica", Port: defaultPort, User: "user", Pass: "pass"}, MaxLag: time.Minute}, opts.Replica)
+	cfg.Database.PreferReplica = false
+
+	cfg.Dump.MaxDumpSize = "20GB"
+	opts, err = DumpOptions(cfg, targets)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20<<30), opts.MaxDumpSize)
+	cfg.Dump.MaxDumpSize = "lots"
+	_, err = DumpOptions(cfg, targets)
+	assert.Error(t, err)
+	cfg.Dump.MaxDumpSize = ""
+
+	// the default targets only apply when the dump lists none
+	cfg.DefaultTargets = []string{"unused"}
+	names, _, err = DumpTargets(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"local"}, names)
+	cfg.Dump.Targets = nil
+	names, targets, err = DumpTargets(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"unused"}, names)
+	if assert.Len(t, targets, 1) {
+		assert.Equal(t, "file:///other", targets[0].URL())
+	}
+	cfg.DefaultTargets = nil
+	_, _, err = DumpTargets(cfg)
+	assert.Error(t, err, "no targets")
+
+	cfg.Dump.Targets = []string{"missing"}
+	_, _, err = DumpTargets(cfg)
+	assert.Error(t, err)
+}
+
+func TestDumpOptionsDatabases(t *testing.T) {
+	var cfg config.ConfigSpec
+	if err := yaml.Unmarshal([]byte(testConfig), &cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	_, targets, err := DumpTargets(cfg)
+	assert.NoError(t, err)
+	cfg.Database = config.Database{}
+	cfg.Databases = []config.DatabaseServer{{Database: config.Database{Server: "db1"}}, {Database: config.Database{Server: "db2"}}}
+	// the options are those of each of the servers, which the caller dumps one at a time
+	opts, err := DumpOptions(cfg, targets)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"db1"}, opts.DBNames)
+	_, err = Run(context.Background(), cfg)
+	assert.ErrorContains(t, err, "2 servers in databases")
+}
+
+func TestReplica(t *testing.T) {
+	conn := database.Connection{Host: "db1", Port: defaultPort, User: "user", Pass: "pass"}
+	replica, err := Replica(config.Database{Replica: config.Replica{Server: "db1-replica"}}, conn)
+	assert.NoError(t, err)
+	assert.Nil(t, replica, "not preferred")
+	_, err = Replica(config.Database{PreferReplica: true}, conn)
+	assert.Error(t, err, "no replica server")
+	_, err = Replica(config.Database{PreferReplica: true, Replica: config.Replica{Server: "db1-replica", MaxLag: config.Duration(-time.Minute)}}, conn)
+	assert.Error(t, err, "negative max lag")
+	replica, err = Replica(config.Database{PreferReplica: true, Replica: config.Replica{Server: "db1-replica", Port: 3307, Credentials: config.DBCredentials{Password: "other"}, MaxLag: config.Duration(time.Minute)}}, conn)
+	assert.NoError(t, err)
+	assert.Equal(t, &core.ReplicaOptions{DBConn: database.Connection{Host: "db1-replica", Port: 3307, User: "user", Pass: "other"}, MaxLag: time.Minute}, replica)
+}
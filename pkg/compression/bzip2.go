@@ -7,6 +7,8 @@ import (
 )
 
 type Bzip2Compressor struct {
+	// level the bzip2 level at which to compress; 0 for the default; see WithLevel
+	level int
 }
 
 func (b *Bzip2Compressor) Uncompress(in io.Reader) (io.Reader, error) {
@@ -14,8 +16,11 @@ func (b *Bzip2Compressor) Uncompress(in io.Reader) (io.Reader, error) {
 }
 
 func (b *Bzip2Compressor) Compress(out io.Writer) (io.WriteCloser, error) {
-	return bzip2.NewWriter(out, nil)
+	return bzip2.NewWriter(out, &bzip2.WriterConfig{Level: b.level})
 }
 func (b *Bzip2Compressor) Extension() string {
 	return "tbz2"
 }
+func (b *Bzip2Compressor) Magic() []byte {
+	return []byte("BZh")
+}
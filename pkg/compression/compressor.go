@@ -1,14 +1,18 @@
 package compression
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"strings"
 )
 
 type Compressor interface {
 	Uncompress(in io.Reader) (io.Reader, error)
 	Compress(out io.Writer) (io.WriteCloser, error)
 	Extension() string
+	// Magic the bytes with which every stream in this format begins
+	Magic() []byte
 }
 
 func GetCompressor(name string) (Compressor, error) {
@@ -17,7 +21,83 @@ func GetCompressor(name string) (Compressor, error) {
 		return &GzipCompressor{}, nil
 	case "bzip2":
 		return &Bzip2Compressor{}, nil
+	case "zstd":
+		return &ZstdCompressor{}, nil
+	case "none", "store":
+		// store is the name of no compression in zip and some other archivers
+		return &NoneCompressor{}, nil
 	default:
 		return nil, fmt.Errorf("unknown compression format: %s", name)
 	}
 }
+
+// Verify check that the stream in r begins with the header of the compressor's format, leaving r
+// at the start of the stream
+func Verify(c Compressor, r io.ReadSeeker) error {
+	magic := c.Magic()
+	header := make([]byte, len(magic))
+	n, err := io.ReadFull(r, header)
+	if _, seekErr := r.Seek(0, io.SeekStart); seekErr != nil {
+		return fmt.Errorf("unable to rewind stream: %v", seekErr)
+	}
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return fmt.Errorf("unable to read stream header: %v", err)
+	}
+	if !bytes.Equal(header[:n], magic) {
+		return fmt.Errorf("stream does not match the compression, expected header %x, found %x", magic, header[:n])
+	}
+	return nil
+}
+
+// compressors every supported compression format that has a header, for detection
+var compressors = []Compressor{&GzipCompressor{}, &Bzip2Compressor{}, &ZstdCompressor{}}
+
+// unsupported the headers of compression formats that are not supported, to report them clearly
+var unsupported = map[string][]byte{
+	"xz": {0xfd, '7', 'z', 'X', 'Z', 0x00},
+}
+
+// Detect the compressor for the stream in r, from the header with which it begins, leaving r at the
+// start of the stream. Returns nil if the header is not that of any known format, and an error if it
+// is a known format that is not supported.
+//
+// Only compression is detected; an encrypted stream has no recognizable header, and so returns nil.
+func Detect(r io.ReadSeeker) (Compressor, error) {
+	header := make([]byte, 8)
+	n, err := io.ReadFull(r, header)
+	if _, seekErr := r.Seek(0, io.SeekStart); seekErr != nil {
+		return nil, fmt.Errorf("unable to rewind stream: %v", seekErr)
+	}
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("unable to read stream header: %v", err)
+	}
+	header = header[:n]
+	for _, c := range compressors {
+		if bytes.HasPrefix(header, c.Magic()) {
+			return c, nil
+		}
+	}
+	for name, magic := range unsupported {
+		if bytes.HasPrefix(header, magic) {
+			return nil, fmt.Errorf("stream is compressed with %s, which is not supported", name)
+		}
+	}
+	return nil, nil
+}
+
+// ForFilename the compressor for the filename, from its extension, e.g. .tgz or .sql.gz; nil if the
+// extension is not that of any supported format
+func ForFilename(filename string) Compressor {
+	switch {
+	case strings.HasSuffix(filename, ".tgz"), strings.HasSuffix(filename, ".gz"):
+		return &GzipCompressor{}
+	case strings.HasSuffix(filename, ".tbz2"), strings.HasSuffix(filename, ".bz2"):
+		return &Bzip2Compressor{}
+	case strings.HasSuffix(filename, ".tzst"), strings.HasSuffix(filename, ".zst"):
+		return &ZstdCompressor{}
+	case strings.HasSuffix(filename, ".tar"):
+		return &NoneCompressor{}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,73 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	var gz bytes.Buffer
+	w, _ := (&GzipCompressor{}).Compress(&gz)
+	_, _ = w.Write([]byte("select 1;"))
+	_ = w.Close()
+	tests := []struct {
+		name    string
+		data    []byte
+		want    Compressor
+		wantErr bool
+	}{
+		{"gzip", gz.Bytes(), &GzipCompressor{}, false},
+		{"bzip2", []byte("BZh91AY&SY"), &Bzip2Compressor{}, false},
+		{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, &ZstdCompressor{}, false},
+		{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}, nil, true},
+		{"plain", []byte("select 1;"), nil, false},
+		{"short", []byte{0x1f}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.data)
+			got, err := Detect(r)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+			// the stream is left at the start
+			assert.Equal(t, int64(len(tt.data)), int64(r.Len()))
+		})
+	}
+}
+
+func TestZstd(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := (&ZstdCompressor{}).Compress(&buf)
+	assert.NoError(t, err)
+	_, _ = w.Write([]byte("select 1;"))
+	assert.NoError(t, w.Close())
+
+	r, err := (&ZstdCompressor{}).Uncompress(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "select 1;", string(data))
+}
+
+func TestWithDictionaries(t *testing.T) {
+	// other compressors do not use dictionaries
+	c, err := WithDictionaries(&GzipCompressor{}, []byte("not a dictionary"))
+	assert.NoError(t, err)
+	assert.Equal(t, &GzipCompressor{}, c)
+
+	// no dictionaries is no change
+	c, err = WithDictionaries(&ZstdCompressor{})
+	assert.NoError(t, err)
+	assert.Equal(t, &ZstdCompressor{}, c)
+
+	// only dictionaries from zstd --train, not raw content
+	_, err = WithDictionaries(&ZstdCompressor{}, []byte("not a dictionary"))
+	assert.Error(t, err)
+}
@@ -6,6 +6,10 @@ import (
 )
 
 type GzipCompressor struct {
+	// threads how many blocks to compress at once; 0 or 1 to compress the stream as a whole; see WithThreads
+	threads int
+	// level the gzip level at which to compress; 0 for the default; see WithLevel
+	level int
 }
 
 func (g *GzipCompressor) Uncompress(in io.Reader) (io.Reader, error) {
@@ -13,8 +17,18 @@ func (g *GzipCompressor) Uncompress(in io.Reader) (io.Reader, error) {
 }
 
 func (g *GzipCompressor) Compress(out io.Writer) (io.WriteCloser, error) {
-	return gzip.NewWriter(out), nil
+	level := gzip.DefaultCompression
+	if g.level > 0 {
+		level = g.level
+	}
+	if g.threads > 1 {
+		return newParallelGzipWriter(out, g.threads, level), nil
+	}
+	return gzip.NewWriterLevel(out, level)
 }
 func (g *GzipCompressor) Extension() string {
 	return "tgz"
 }
+func (g *GzipCompressor) Magic() []byte {
+	return []byte{0x1f, 0x8b}
+}
@@ -0,0 +1,178 @@
+package compression
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/databacker/mysql-backup/pkg/util"
+)
+
+const (
+	// DefaultAutoLevelSmall dumps estimated to be smaller than this are compressed at the best level
+	DefaultAutoLevelSmall int64 = 1 << 30
+	// DefaultAutoLevelLarge dumps estimated to be at least this large are compressed at the fastest level
+	DefaultAutoLevelLarge int64 = 20 << 30
+)
+
+// LevelAuto the level that chooses the level by the estimated size of the dump; see AutoLevel
+const LevelAuto = "auto"
+
+// ParseLevel parse a compression level: empty for the default, a number in the scale of the compressor c, or auto
+// to choose by size, in which case the level is 0, and the AutoLevel has the thresholds small and large, sizes as
+// for util.ParseSize, e.g. 1GB, each the default if empty
+func ParseLevel(level, small, large string, c Compressor) (int, *AutoLevel, error) {
+	switch level {
+	case "":
+		return 0, nil, nil
+	case LevelAuto:
+		a, err := NewAutoLevel(small, large)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, &a, nil
+	}
+	n, err := strconv.Atoi(level)
+	if err != nil || n < 0 {
+		return 0, nil, fmt.Errorf("invalid compression level %q, must be a number or %s", level, LevelAuto)
+	}
+	if c != nil {
+		if err := ValidateLevel(c, n); err != nil {
+			return 0, nil, err
+		}
+	}
+	return n, nil, nil
+}
+
+// Levels the fastest, default and best levels of the compressor c, in the scale of its format, e.g. 1, 6 and 9
+// for gzip; false if it has no levels
+func Levels(c Compressor) (fastest, def, best int, ok bool) {
+	switch c.(type) {
+	case *GzipCompressor, *Bzip2Compressor:
+		return 1, 6, 9, true
+	case *ZstdCompressor:
+		// the encoder has four levels, 1, 3, 6 and 10 or more; 19 is the best of the zstd command
+		return 1, 3, 19, true
+	default:
+		return 0, 0, 0, false
+	}
+}
+
+// DistinctLevels the levels of the compressor c that each compress differently, fastest first: every level of
+// gzip and bzip2, and one for each of the four levels of the zstd encoder; nil if it has no levels
+func DistinctLevels(c Compressor) []int {
+	switch c.(type) {
+	case *GzipCompressor, *Bzip2Compressor:
+		return []int{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	case *ZstdCompressor:
+		return []int{1, 3, 6, 19}
+	default:
+		return nil
+	}
+}
+
+// ValidateLevel check that level is a level of the compressor c, or 0 for its default
+func ValidateLevel(c Compressor, level int) error {
+	if level == 0 {
+		return nil
+	}
+	fastest, _, best, ok := Levels(c)
+	if !ok {
+		return fmt.Errorf("compression %s does not have levels", c.Extension())
+	}
+	maxLevel := best
+	if _, ok := c.(*ZstdCompressor); ok {
+		maxLevel = 22
+	}
+	if level < fastest || level > maxLevel {
+		return fmt.Errorf("invalid compression level %d, must be from %d to %d", level, fastest, maxLevel)
+	}
+	return nil
+}
+
+// WithLevel the compressor c compressing at level, in the scale of its format; 0 for its default. Compressors
+// without levels are returned unchanged.
+func WithLevel(c Compressor, level int) (Compressor, error) {
+	if level == 0 {
+		return c, nil
+	}
+	if _, _, _, ok := Levels(c); !ok {
+		return c, nil
+	}
+	if err := ValidateLevel(c, level); err != nil {
+		return nil, err
+	}
+	switch c := c.(type) {
+	case *GzipCompressor:
+		g := *c
+		g.level = level
+		return &g, nil
+	case *Bzip2Compressor:
+		b := *c
+		b.level = level
+		return &b, nil
+	case *ZstdCompressor:
+		z := *c
+		z.level = level
+		return &z, nil
+	default:
+		return c, nil
+	}
+}
+
+// AutoLevel choose the level at which to compress a dump by its estimated size, so that small dumps are compressed
+// hard, and large ones fast
+type AutoLevel struct {
+	// Small dumps estimated to be smaller than this, in bytes, are compressed at the best level
+	Small int64
+	// Large dumps estimated to be at least this large, in bytes, are compressed at the fastest level; those in
+	// between at the default level
+	Large int64
+}
+
+// DefaultAutoLevel the thresholds of AutoLevel when none are set
+var DefaultAutoLevel = AutoLevel{Small: DefaultAutoLevelSmall, Large: DefaultAutoLevelLarge}
+
+// NewAutoLevel the AutoLevel with the thresholds small and large, sizes as for util.ParseSize, e.g. 1GB; either
+// may be empty for its default
+func NewAutoLevel(small, large string) (AutoLevel, error) {
+	a := DefaultAutoLevel
+	var err error
+	if small != "" {
+		if a.Small, err = util.ParseSize(small); err != nil {
+			return AutoLevel{}, fmt.Errorf("invalid small size for auto compression level: %v", err)
+		}
+	}
+	if large != "" {
+		if a.Large, err = util.ParseSize(large); err != nil {
+			return AutoLevel{}, fmt.Errorf("invalid large size for auto compression level: %v", err)
+		}
+	}
+	return a, a.Validate()
+}
+
+// Validate check that the thresholds are positive, and Small is no larger than Large
+func (a AutoLevel) Validate() error {
+	if a.Small <= 0 || a.Large <= 0 {
+		return fmt.Errorf("invalid auto compression level thresholds %d and %d, must be positive", a.Small, a.Large)
+	}
+	if a.Small > a.Large {
+		return fmt.Errorf("invalid auto compression level thresholds, small %d is larger than large %d", a.Small, a.Large)
+	}
+	return nil
+}
+
+// Level the level at which the compressor c is to compress a dump estimated to be size bytes; 0, for the
+// default, if it has no levels
+func (a AutoLevel) Level(c Compressor, size int64) int {
+	fastest, def, best, ok := Levels(c)
+	switch {
+	case !ok:
+		return 0
+	case size < a.Small:
+		return best
+	case size >= a.Large:
+		return fastest
+	default:
+		return def
+	}
+}
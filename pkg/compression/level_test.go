@@ -0,0 +1,153 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		c        Compressor
+		level    int
+		expected Compressor
+		err      bool
+	}{
+		{"default", &GzipCompressor{}, 0, &GzipCompressor{}, false},
+		{"gzip", &GzipCompressor{threads: 4}, 9, &GzipCompressor{threads: 4, level: 9}, false},
+		{"gzip too high", &GzipCompressor{}, 10, nil, true},
+		{"bzip2", &Bzip2Compressor{}, 1, &Bzip2Compressor{level: 1}, false},
+		{"zstd", &ZstdCompressor{threads: 2}, 19, &ZstdCompressor{threads: 2, level: 19}, false},
+		{"zstd too high", &ZstdCompressor{}, 23, nil, true},
+		{"none", &NoneCompressor{}, 9, &NoneCompressor{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := WithLevel(tt.c, tt.level)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, c)
+		})
+	}
+}
+
+func TestLevelRoundTrip(t *testing.T) {
+	data := sqlDump(2 * parallelBlockSize)
+	for _, c := range []Compressor{&GzipCompressor{}, &GzipCompressor{threads: 2}, &Bzip2Compressor{}, &ZstdCompressor{}} {
+		fastest, _, best, _ := Levels(c)
+		sizes := map[int]int{}
+		for _, level := range []int{fastest, best} {
+			lc, err := WithLevel(c, level)
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			w, err := lc.Compress(&buf)
+			require.NoError(t, err)
+			_, err = w.Write(data)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+			sizes[level] = buf.Len()
+
+			r, err := lc.Uncompress(&buf)
+			require.NoError(t, err)
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, string(data), string(got), "%s level %d", c.Extension(), level)
+		}
+		assert.LessOrEqual(t, sizes[best], sizes[fastest], "%s best level no smaller than fastest", c.Extension())
+	}
+}
+
+func TestDistinctLevels(t *testing.T) {
+	for _, c := range []Compressor{&GzipCompressor{}, &Bzip2Compressor{}, &ZstdCompressor{}} {
+		levels := DistinctLevels(c)
+		fastest, _, best, _ := Levels(c)
+		assert.Equal(t, fastest, levels[0], c.Extension())
+		assert.Equal(t, best, levels[len(levels)-1], c.Extension())
+		for _, level := range levels {
+			assert.NoError(t, ValidateLevel(c, level), c.Extension())
+		}
+	}
+	assert.Nil(t, DistinctLevels(&NoneCompressor{}))
+}
+
+func TestAutoLevel(t *testing.T) {
+	a := AutoLevel{Small: 100, Large: 1000}
+	tests := []struct {
+		name     string
+		c        Compressor
+		size     int64
+		expected int
+	}{
+		{"small gzip", &GzipCompressor{}, 99, 9},
+		{"medium gzip", &GzipCompressor{}, 100, 6},
+		{"large gzip", &GzipCompressor{}, 1000, 1},
+		{"small zstd", &ZstdCompressor{}, 0, 19},
+		{"medium zstd", &ZstdCompressor{}, 500, 3},
+		{"none", &NoneCompressor{}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, a.Level(tt.c, tt.size))
+		})
+	}
+
+	assert.NoError(t, DefaultAutoLevel.Validate())
+	assert.Error(t, AutoLevel{Small: 0, Large: 10}.Validate())
+	assert.Error(t, AutoLevel{Small: 10, Large: 5}.Validate())
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		level string
+		small string
+		c     Compressor
+		n     int
+		auto  *AutoLevel
+		err   bool
+	}{
+		{"default", "", "", &GzipCompressor{}, 0, nil, false},
+		{"number", "9", "", &GzipCompressor{}, 9, nil, false},
+		{"out of range", "19", "", &GzipCompressor{}, 0, nil, true},
+		{"zstd range", "19", "", &ZstdCompressor{}, 19, nil, false},
+		{"auto", "auto", "", &GzipCompressor{}, 0, &DefaultAutoLevel, false},
+		{"auto small", "auto", "1MB", &GzipCompressor{}, 0, &AutoLevel{Small: 1 << 20, Large: DefaultAutoLevelLarge}, false},
+		{"auto invalid small", "auto", "lots", &GzipCompressor{}, 0, nil, true},
+		{"negative", "-1", "", &GzipCompressor{}, 0, nil, true},
+		{"word", "best", "", &GzipCompressor{}, 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, auto, err := ParseLevel(tt.level, tt.small, "", tt.c)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.n, n)
+			assert.Equal(t, tt.auto, auto)
+		})
+	}
+}
+
+func TestNewAutoLevel(t *testing.T) {
+	a, err := NewAutoLevel("", "")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultAutoLevel, a)
+
+	a, err = NewAutoLevel("100MB", "")
+	require.NoError(t, err)
+	assert.Equal(t, AutoLevel{Small: 100 << 20, Large: DefaultAutoLevelLarge}, a)
+
+	_, err = NewAutoLevel("50GB", "")
+	assert.Error(t, err, "small larger than the default large")
+	_, err = NewAutoLevel("big", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,34 @@
+package compression
+
+import (
+	"io"
+)
+
+// NoneCompressor does not compress at all, so the dump is a plain tar archive
+type NoneCompressor struct {
+}
+
+func (n *NoneCompressor) Uncompress(in io.Reader) (io.Reader, error) {
+	return in, nil
+}
+
+func (n *NoneCompressor) Compress(out io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{out}, nil
+}
+func (n *NoneCompressor) Extension() string {
+	return "tar"
+}
+
+// Magic uncompressed data can begin with anything
+func (n *NoneCompressor) Magic() []byte {
+	return nil
+}
+
+// nopWriteCloser does nothing on close, leaving the underlying writer open, as the other compressors do
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
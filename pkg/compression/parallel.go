@@ -0,0 +1,203 @@
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+const (
+	// parallelBlockSize how much of the stream each goroutine compresses at a time
+	parallelBlockSize = 1 << 20
+	// dictionarySize how much of the end of the previous block each block uses as its dictionary, which is
+	// as far back as deflate can refer
+	dictionarySize = 32 << 10
+)
+
+// gzipHeader the header of a gzip stream with no name, time or extra fields, the same as gzip.NewWriter writes
+var gzipHeader = []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 0xff}
+
+// ValidateThreads check the number of threads with which to compress, which must not be negative
+func ValidateThreads(threads int) error {
+	if threads < 0 {
+		return fmt.Errorf("invalid compression threads %d, must be at least 0", threads)
+	}
+	return nil
+}
+
+// WithThreads the compressor c compressing with up to threads goroutines at once, rather than the default for
+// its format. Only gzip and zstd can compress in parallel; others are returned unchanged. 0 for the default.
+func WithThreads(c Compressor, threads int) (Compressor, error) {
+	if err := ValidateThreads(threads); err != nil {
+		return nil, err
+	}
+	if threads == 0 {
+		return c, nil
+	}
+	switch c := c.(type) {
+	case *GzipCompressor:
+		g := *c
+		g.threads = threads
+		return &g, nil
+	case *ZstdCompressor:
+		z := *c
+		z.threads = threads
+		return &z, nil
+	default:
+		return c, nil
+	}
+}
+
+// parallelGzipWriter compresses the stream into a single gzip stream, a block at a time, with up to threads
+// blocks compressing at once, the same way as pigz. Each block ends on a byte boundary with a sync flush, and
+// uses the end of the one before as its dictionary, so that together they are a single deflate stream, which
+// any gzip reader can uncompress, and compress nearly as well as compressing the whole stream at once.
+type parallelGzipWriter struct {
+	out io.Writer
+	// level the flate level of every block
+	level int
+	// queue the blocks in the order in which they are to be written; its capacity limits how many are
+	// compressing at once
+	queue chan *parallelBlock
+	done  chan struct{}
+	buf   []byte
+	dict  []byte
+	crc   uint32
+	size  uint32
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+// parallelBlock a block of the stream, compressed once done is closed
+type parallelBlock struct {
+	out  bytes.Buffer
+	err  error
+	done chan struct{}
+}
+
+func newParallelGzipWriter(out io.Writer, threads, level int) *parallelGzipWriter {
+	w := &parallelGzipWriter{
+		out:   out,
+		level: level,
+		queue: make(chan *parallelBlock, threads),
+		done:  make(chan struct{}),
+		buf:   make([]byte, 0, parallelBlockSize),
+	}
+	go w.write()
+	return w
+}
+
+// write write the header, and then each block as it is finished, in order
+func (w *parallelGzipWriter) write() {
+	defer close(w.done)
+	_, err := w.out.Write(gzipHeader)
+	w.setErr(err)
+	for b := range w.queue {
+		<-b.done
+		if w.getErr() != nil {
+			continue
+		}
+		if b.err != nil {
+			w.setErr(b.err)
+			continue
+		}
+		_, err := w.out.Write(b.out.Bytes())
+		w.setErr(err)
+	}
+}
+
+func (w *parallelGzipWriter) setErr(err error) {
+	if err == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *parallelGzipWriter) getErr() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *parallelGzipWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("write to closed gzip writer")
+	}
+	if err := w.getErr(); err != nil {
+		return 0, err
+	}
+	w.crc = crc32.Update(w.crc, crc32.IEEETable, p)
+	w.size += uint32(len(p))
+	n := len(p)
+	for len(p) > 0 {
+		m := min(len(p), parallelBlockSize-len(w.buf))
+		w.buf = append(w.buf, p[:m]...)
+		p = p[m:]
+		if len(w.buf) == parallelBlockSize {
+			w.compress(false)
+		}
+	}
+	return n, nil
+}
+
+// compress start compressing the buffered data as the next block, waiting if as many blocks as there are threads
+// already are
+func (w *parallelGzipWriter) compress(last bool) {
+	data, dict := w.buf, w.dict
+	b := &parallelBlock{done: make(chan struct{})}
+	w.queue <- b
+	go func() {
+		defer close(b.done)
+		fw, err := flate.NewWriterDict(&b.out, w.level, dict)
+		if err != nil {
+			b.err = err
+			return
+		}
+		if _, err := fw.Write(data); err != nil {
+			b.err = err
+			return
+		}
+		// only the last block is final; the others end on a byte boundary, so the next can follow directly
+		if last {
+			b.err = fw.Close()
+		} else {
+			b.err = fw.Flush()
+		}
+	}()
+	if len(data) > dictionarySize {
+		w.dict = data[len(data)-dictionarySize:]
+	} else {
+		w.dict = data
+	}
+	// data belongs to the block now
+	w.buf = make([]byte, 0, parallelBlockSize)
+}
+
+// Close finish the stream, waiting for every block to be compressed and written, and write the trailer
+func (w *parallelGzipWriter) Close() error {
+	if w.closed {
+		return w.getErr()
+	}
+	w.closed = true
+	w.compress(true)
+	close(w.queue)
+	<-w.done
+	if err := w.getErr(); err != nil {
+		return err
+	}
+	trailer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(trailer[:4], w.crc)
+	binary.LittleEndian.PutUint32(trailer[4:], w.size)
+	_, err := w.out.Write(trailer)
+	return err
+}
@@ -0,0 +1,141 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sqlDump SQL that compresses about as well as a real dump, of size bytes
+func sqlDump(size int) []byte {
+	r := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	for buf.Len() < size {
+		fmt.Fprintf(&buf, "INSERT INTO `users` VALUES (%d,'user%d','%x@example.com',%d);\n", buf.Len(), r.Intn(100000), r.Int63(), r.Intn(2))
+	}
+	return buf.Bytes()[:size]
+}
+
+func TestParallelGzip(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"small", 100},
+		{"one block", parallelBlockSize},
+		{"several blocks", 3*parallelBlockSize + 12345},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := sqlDump(tt.size)
+			c, err := WithThreads(&GzipCompressor{}, 4)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			w, err := c.Compress(&buf)
+			require.NoError(t, err)
+			// in uneven writes, as the archive writes
+			for p := data; len(p) > 0; {
+				n := min(len(p), 7777)
+				_, err := w.Write(p[:n])
+				require.NoError(t, err)
+				p = p[n:]
+			}
+			require.NoError(t, w.Close())
+
+			// a single stream, which the standard reader uncompresses as a whole, checking the CRC and size
+			r, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+			r.Multistream(false)
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, string(data), string(got))
+			assert.NoError(t, Verify(c, bytes.NewReader(buf.Bytes())))
+		})
+	}
+}
+
+func TestParallelGzipRatio(t *testing.T) {
+	data := sqlDump(4 * parallelBlockSize)
+	compressed := func(c Compressor) int {
+		var buf bytes.Buffer
+		w, err := c.Compress(&buf)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		return buf.Len()
+	}
+	parallel, err := WithThreads(&GzipCompressor{}, 4)
+	require.NoError(t, err)
+	single, multi := compressed(&GzipCompressor{}), compressed(parallel)
+	// the dictionaries keep it within a fraction of a percent
+	assert.Less(t, float64(multi), float64(single)*1.01, "single %d, parallel %d", single, multi)
+}
+
+func TestWithThreads(t *testing.T) {
+	_, err := WithThreads(&GzipCompressor{}, -1)
+	assert.Error(t, err)
+
+	c, err := WithThreads(&GzipCompressor{}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, &GzipCompressor{}, c)
+
+	c, err = WithThreads(&Bzip2Compressor{}, 4)
+	require.NoError(t, err)
+	assert.Equal(t, &Bzip2Compressor{}, c)
+
+	// keeps the dictionaries
+	z := &ZstdCompressor{dictionaries: [][]byte{[]byte("dict")}}
+	c, err = WithThreads(z, 4)
+	require.NoError(t, err)
+	assert.Equal(t, &ZstdCompressor{dictionaries: z.dictionaries, threads: 4}, c)
+
+	data := sqlDump(2 * parallelBlockSize)
+	var buf bytes.Buffer
+	c, err = WithThreads(&ZstdCompressor{}, 4)
+	require.NoError(t, err)
+	w, err := c.Compress(&buf)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	r, err := c.Uncompress(&buf)
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+}
+
+// BenchmarkGzip compare compressing with a single thread, as gzip.Writer does, to compressing in parallel
+func BenchmarkGzip(b *testing.B) {
+	data := sqlDump(16 * parallelBlockSize)
+	for _, threads := range []int{0, 2, 4, 8} {
+		c, err := WithThreads(&GzipCompressor{}, threads)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("threads=%d", threads), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				w, err := c.Compress(io.Discard)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := w.Write(data); err != nil {
+					b.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package compression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DefaultIncompressibleRatio a dump whose sample compresses to more than this fraction of its size is not worth
+// compressing, e.g. as most of it is blobs that are compressed already
+const DefaultIncompressibleRatio = 0.9
+
+const (
+	// sampleChunkSize the size of each of the chunks of a sample
+	sampleChunkSize = 64 << 10
+	// sampleChunks how many chunks a sample has, spread evenly through the files
+	sampleChunks = 16
+)
+
+// SampleRatio the size to which a sample of the files at paths compresses, as a fraction of the size of the
+// sample, along with the size of the sample. The sample is chunks spread evenly through the files, as though they
+// were one, compressed at the fastest gzip level, which is a guide to how well any of the compressions would do.
+// Files that are smaller than the sample would be are sampled whole. The size is 0 if the files are empty.
+func SampleRatio(paths []string) (float64, int64, error) {
+	files := make([]*os.File, 0, len(paths))
+	sizes := make([]int64, 0, len(paths))
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	var total int64
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unable to open %s to sample it: %v", p, err)
+		}
+		files = append(files, f)
+		info, err := f.Stat()
+		if err != nil {
+			return 0, 0, fmt.Errorf("unable to stat %s to sample it: %v", p, err)
+		}
+		sizes = append(sizes, info.Size())
+		total += info.Size()
+	}
+
+	var compressed countingWriter
+	gz, err := gzip.NewWriterLevel(&compressed, gzip.BestSpeed)
+	if err != nil {
+		return 0, 0, err
+	}
+	var sampled int64
+	// read size bytes from offset, as though all of the files were one, stopping at the end of the file it is in
+	read := func(offset, size int64) error {
+		for i, f := range files {
+			if offset >= sizes[i] {
+				offset -= sizes[i]
+				continue
+			}
+			n, err := io.Copy(gz, io.NewSectionReader(f, offset, min(size, sizes[i]-offset)))
+			sampled += n
+			if err != nil {
+				return fmt.Errorf("unable to read %s to sample it: %v", f.Name(), err)
+			}
+			return nil
+		}
+		return nil
+	}
+	if total <= sampleChunks*sampleChunkSize {
+		for offset := int64(0); offset < total; offset += sampleChunkSize {
+			if err := read(offset, sampleChunkSize); err != nil {
+				return 0, 0, err
+			}
+		}
+	} else {
+		for i := int64(0); i < sampleChunks; i++ {
+			if err := read(total*i/sampleChunks, sampleChunkSize); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return 0, 0, err
+	}
+	if sampled == 0 {
+		return 0, 0, nil
+	}
+	return float64(compressed.n) / float64(sampled), sampled, nil
+}
+
+// countingWriter discards what is written to it, counting the bytes
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,48 @@
+package compression
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampleRatio(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, data, 0o600))
+		return p
+	}
+	random := make([]byte, 2*sampleChunks*sampleChunkSize)
+	_, _ = rand.Read(random)
+	text := bytes.Repeat([]byte("INSERT INTO `t` VALUES (1,'abc'),(2,'def');\n"), 50000)
+
+	tests := []struct {
+		name    string
+		paths   []string
+		sampled int64
+		above   bool
+	}{
+		{"empty", []string{write("empty.sql", nil)}, 0, false},
+		{"text, sampled whole", []string{write("small.sql", text[:1000])}, 1000, false},
+		{"text", []string{write("text.sql", text)}, sampleChunks * sampleChunkSize, false},
+		{"random", []string{write("random.sql", random)}, sampleChunks * sampleChunkSize, true},
+		{"random across files", []string{write("a.sql", random[:len(random)/2]), write("b.sql", random[len(random)/2:])}, sampleChunks * sampleChunkSize, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratio, sampled, err := SampleRatio(tt.paths)
+			require.NoError(t, err)
+			assert.Equal(t, tt.sampled, sampled)
+			assert.Equal(t, tt.above, ratio > DefaultIncompressibleRatio, "ratio %f", ratio)
+		})
+	}
+
+	_, _, err := SampleRatio([]string{filepath.Join(dir, "missing.sql")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package compression
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ZstdCompressor compresses with zstd, optionally with dictionaries; see WithDictionaries
+type ZstdCompressor struct {
+	// dictionaries the first is used to compress, and all of them to uncompress, so that dumps compressed
+	// with an earlier dictionary can still be uncompressed
+	dictionaries [][]byte
+	// threads the concurrency of the encoder; 0 for the default of the number of CPUs; see WithThreads
+	threads int
+	// level the zstd level at which to compress; 0 for the default; see WithLevel
+	level int
+}
+
+func (z *ZstdCompressor) Uncompress(in io.Reader) (io.Reader, error) {
+	// a single goroutine, as the reader is never closed
+	d, err := zstd.NewReader(in, zstd.WithDecoderConcurrency(1), zstd.WithDecoderDicts(z.dictionaries...))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+func (z *ZstdCompressor) Compress(out io.Writer) (io.WriteCloser, error) {
+	var opts []zstd.EOption
+	if len(z.dictionaries) > 0 {
+		opts = append(opts, zstd.WithEncoderDict(z.dictionaries[0]))
+	}
+	if z.threads > 0 {
+		opts = append(opts, zstd.WithEncoderConcurrency(z.threads))
+	}
+	if z.level > 0 {
+		opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(z.level)))
+	}
+	return zstd.NewWriter(out, opts...)
+}
+func (z *ZstdCompressor) Extension() string {
+	return "tzst"
+}
+func (z *ZstdCompressor) Magic() []byte {
+	return []byte{0x28, 0xb5, 0x2f, 0xfd}
+}
+
+// WithDictionaries the compressor c using the zstd dictionaries, e.g. from zstd --train. The first dictionary
+// is used to compress; all of them are available to uncompress, each frame naming the dictionary it needs by
+// its ID. Compressors other than zstd do not use dictionaries, and are returned unchanged.
+func WithDictionaries(c Compressor, dictionaries ...[]byte) (Compressor, error) {
+	z, ok := c.(*ZstdCompressor)
+	if !ok || len(dictionaries) == 0 {
+		return c, nil
+	}
+	for i, dict := range dictionaries {
+		d, err := zstd.InspectDictionary(dict)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd dictionary %d: %v", i+1, err)
+		}
+		if d.ID() == 0 {
+			return nil, fmt.Errorf("invalid zstd dictionary %d: it must have an ID", i+1)
+		}
+	}
+	withDicts := *z
+	withDicts.dictionaries = dictionaries
+	return &withDicts, nil
+}
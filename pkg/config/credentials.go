@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CredentialsSpec the credentials of the database servers and the targets, read from the CredentialsFile of the
+// config, so that the config can be kept, e.g. in version control, without its secrets. Each one that is set
+// replaces the one in the config.
+type CredentialsSpec struct {
+	// Database credentials of the database server
+	Database DBCredentials `yaml:"database"`
+	// Replica credentials of the read replica of the database server
+	Replica DBCredentials `yaml:"replica"`
+	// Restore credentials of the database server to restore to, if it is not the one that is dumped
+	Restore DBCredentials `yaml:"restore"`
+	// Databases credentials of each of the multiple database servers, by their name, or their server if they have
+	// none
+	Databases map[string]DBCredentials `yaml:"databases"`
+	// Targets credentials of each target, by its name, in the form of the credentials of its type
+	Targets map[string]yaml.Node `yaml:"targets"`
+}
+
+// MergeCredentialsFile read the credentials from the file at path, and merge them into the config, as by
+// MergeCredentials
+func (c *ConfigSpec) MergeCredentialsFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open credentials file: %w", err)
+	}
+	defer f.Close()
+	if err := c.MergeCredentials(f); err != nil {
+		return fmt.Errorf("invalid credentials file %s: %w", path, err)
+	}
+	return nil
+}
+
+// MergeCredentials read the credentials from r, and merge them into the config, replacing each that is set. Each
+// database server and target that they are for must be in the config, with a type that has credentials, and each
+// field must be one of its credentials, so that a typo is an error, rather than a secret that is silently unused.
+func (c *ConfigSpec) MergeCredentials(r io.Reader) error {
+	var creds CredentialsSpec
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&creds); err != nil && err != io.EOF {
+		return fmt.Errorf("unable to parse credentials: %w", err)
+	}
+	mergeDBCredentials(&c.Database.Credentials, creds.Database)
+	mergeDBCredentials(&c.Database.Replica.Credentials, creds.Replica)
+	mergeDBCredentials(&c.Restore.Database.Credentials, creds.Restore)
+	for _, name := range sortedKeys(creds.Databases) {
+		i := slices.IndexFunc(c.Databases, func(s DatabaseServer) bool { return s.serverName() == name })
+		if i < 0 {
+			return fmt.Errorf("credentials for database server %s, which is not in the config", name)
+		}
+		mergeDBCredentials(&c.Databases[i].Credentials, creds.Databases[name])
+	}
+	for _, name := range sortedKeys(creds.Targets) {
+		target, ok := c.Targets[name]
+		if !ok {
+			return fmt.Errorf("credentials for target %s, which is not in the config", name)
+		}
+		node := creds.Targets[name]
+		switch s := target.Storage.(type) {
+		case S3Target:
+			var tc AWSCredentials
+			if err := decodeKnown(&node, &tc); err != nil {
+				return fmt.Errorf("invalid credentials for target %s: %w", name, err)
+			}
+			setIfSet(&s.Credentials.AccessKeyId, tc.AccessKeyId)
+			setIfSet(&s.Credentials.SecretAccessKey, tc.SecretAccessKey)
+			target.Storage = s
+		case SMBTarget:
+			var tc SMBCredentials
+			if err := decodeKnown(&node, &tc); err != nil {
+				return fmt.Errorf("invalid credentials for target %s: %w", name, err)
+			}
+			setIfSet(&s.Credentials.Domain, tc.Domain)
+			setIfSet(&s.Credentials.Username, tc.Username)
+			setIfSet(&s.Credentials.Password, tc.Password)
+			target.Storage = s
+		case B2Target:
+			var tc B2Credentials
+			if err := decodeKnown(&node, &tc); err != nil {
+				return fmt.Errorf("invalid credentials for target %s: %w", name, err)
+			}
+			setIfSet(&s.Credentials.KeyId, tc.KeyId)
+			setIfSet(&s.Credentials.ApplicationKey, tc.ApplicationKey)
+			target.Storage = s
+		default:
+			return fmt.Errorf("credentials for target %s, whose type has no credentials", name)
+		}
+		c.Targets[name] = target
+	}
+	return nil
+}
+
+// decodeKnown decode node into v, failing on any field that v does not have, as the decoder of the credentials
+// does for the rest of the file
+func decodeKnown(node *yaml.Node, v any) error {
+	b, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	return decoder.Decode(v)
+}
+
+func mergeDBCredentials(dst *DBCredentials, src DBCredentials) {
+	setIfSet(&dst.Username, src.Username)
+	setIfSet(&dst.Password, src.Password)
+}
+
+func setIfSet(dst *string, src string) {
+	if src != "" {
+		*dst = src
+	}
+}
+
+// serverName the name of the database server, which defaults to its address, as in the dump filenames
+func (s DatabaseServer) serverName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Server
+}
+
+// sortedKeys the keys of m in order, so that the first of several errors is always the same one
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
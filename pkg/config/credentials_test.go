@@ -0,0 +1,92 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const credentialsTestConfig = `
+database:
+  server: abc
+  credentials:
+    username: user
+databases:
+- name: primary
+  server: db1
+- server: db2
+targets:
+  offsite:
+    type: s3
+    url: s3://bucket/path
+    credentials:
+      accessKeyId: inconfig
+  share:
+    type: smb
+    url: smb://nas/share
+  local:
+    type: file
+    url: file:///backups
+`
+
+func TestMergeCredentials(t *testing.T) {
+	load := func(t *testing.T) ConfigSpec {
+		var cfg ConfigSpec
+		require.NoError(t, yaml.Unmarshal([]byte(credentialsTestConfig), &cfg))
+		return cfg
+	}
+
+	t.Run("merged", func(t *testing.T) {
+		cfg := load(t)
+		creds := `
+database:
+  password: secret
+databases:
+  primary:
+    password: secret1
+  db2:
+    username: user2
+restore:
+  password: stagingsecret
+targets:
+  offsite:
+    secretAccessKey: s3secret
+  share:
+    username: smbuser
+    password: smbpass
+`
+		require.NoError(t, cfg.MergeCredentials(strings.NewReader(creds)))
+		// set in the config, and not in the credentials, so kept
+		assert.Equal(t, DBCredentials{Username: "user", Password: "secret"}, cfg.Database.Credentials)
+		assert.Equal(t, DBCredentials{Password: "secret1"}, cfg.Databases[0].Credentials)
+		assert.Equal(t, DBCredentials{Username: "user2"}, cfg.Databases[1].Credentials)
+		assert.Equal(t, DBCredentials{Password: "stagingsecret"}, cfg.Restore.Database.Credentials)
+		assert.Equal(t, AWSCredentials{AccessKeyId: "inconfig", SecretAccessKey: "s3secret"}, cfg.Targets["offsite"].Storage.(S3Target).Credentials)
+		assert.Equal(t, SMBCredentials{Username: "smbuser", Password: "smbpass"}, cfg.Targets["share"].Storage.(SMBTarget).Credentials)
+	})
+	t.Run("replaces the config", func(t *testing.T) {
+		cfg := load(t)
+		require.NoError(t, cfg.MergeCredentials(strings.NewReader("targets:\n  offsite:\n    accessKeyId: fromfile\n")))
+		assert.Equal(t, "fromfile", cfg.Targets["offsite"].Storage.(S3Target).Credentials.AccessKeyId)
+	})
+	t.Run("empty", func(t *testing.T) {
+		cfg := load(t)
+		assert.NoError(t, cfg.MergeCredentials(strings.NewReader("")))
+	})
+
+	for name, creds := range map[string]string{
+		"unknown target":          "targets:\n  missing:\n    accessKeyId: abc\n",
+		"unknown database server": "databases:\n  other:\n    password: abc\n",
+		"target without creds":    "targets:\n  local:\n    username: abc\n",
+		"field of another type":   "targets:\n  offsite:\n    password: abc\n",
+		"unknown section":         "target:\n  offsite:\n    accessKeyId: abc\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := load(t)
+			assert.Error(t, cfg.MergeCredentials(strings.NewReader(creds)))
+		})
+	}
+}
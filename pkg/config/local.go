@@ -2,10 +2,18 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"time"
 
+	"github.com/databacker/mysql-backup/pkg/compression"
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/notify"
 	"github.com/databacker/mysql-backup/pkg/remote"
 	"github.com/databacker/mysql-backup/pkg/storage"
-	"github.com/databacker/mysql-backup/pkg/storage/credentials"
+	"github.com/databacker/mysql-backup/pkg/storage/b2"
+	"github.com/databacker/mysql-backup/pkg/storage/exec"
+	"github.com/databacker/mysql-backup/pkg/storage/file"
 	"github.com/databacker/mysql-backup/pkg/storage/s3"
 	"github.com/databacker/mysql-backup/pkg/storage/smb"
 	"github.com/databacker/mysql-backup/pkg/util"
@@ -13,18 +21,42 @@ import (
 )
 
 type ConfigSpec struct {
-	Logging   logLevel  `yaml:"logging"`
-	Dump      Dump      `yaml:"dump"`
-	Restore   Restore   `yaml:"restore"`
-	Database  Database  `yaml:"database"`
-	Targets   Targets   `yaml:"targets"`
-	Prune     Prune     `yaml:"prune"`
-	Telemetry Telemetry `yaml:"telemetry"`
+	Logging       logLevel         `yaml:"logging"`
+	Dump          Dump             `yaml:"dump"`
+	Restore       Restore          `yaml:"restore"`
+	Database      Database         `yaml:"database"`
+	Databases     []DatabaseServer `yaml:"databases"`
+	Targets       Targets          `yaml:"targets"`
+	Prune         Prune            `yaml:"prune"`
+	Telemetry     Telemetry        `yaml:"telemetry"`
+	Notifications Notifications    `yaml:"notifications"`
+	Tracing       Tracing          `yaml:"tracing"`
+	Metrics       Metrics          `yaml:"metrics"`
+	// DefaultTargets names of the targets to which to dump, and so to prune, when the dump configuration lists none
+	DefaultTargets []string `yaml:"defaultTargets"`
+	// CredentialsFile path to a file with the credentials of the database servers and targets, which replace those
+	// in the config; see CredentialsSpec
+	CredentialsFile string `yaml:"credentialsFile"`
+	// Profiles named dump settings, which the dump uses as its own by naming one in its Profile
+	Profiles map[string]Dump `yaml:"profiles"`
+}
+
+// DumpTargets names of the targets of the dump: those of the dump configuration, or DefaultTargets if it lists none
+func (c ConfigSpec) DumpTargets() []string {
+	if len(c.Dump.Targets) > 0 {
+		return c.Dump.Targets
+	}
+	return c.DefaultTargets
 }
 
 type Dump struct {
+	// Profile name of the profile whose settings the dump starts from, each of its own that is set replacing that
+	// of the profile; resolved when the config is loaded
+	Profile          string        `yaml:"profile"`
 	Include          []string      `yaml:"include"`
 	Exclude          []string      `yaml:"exclude"`
+	SeparateTables   []string      `yaml:"separateTables"`
+	SkipDuplicates   bool          `yaml:"skipDuplicates"`
 	Safechars        bool          `yaml:"safechars"`
 	NoDatabaseName   bool          `yaml:"noDatabaseName"`
 	Schedule         Schedule      `yaml:"schedule"`
@@ -34,26 +66,226 @@ type Dump struct {
 	FilenamePattern  string        `yaml:"filenamePattern"`
 	Scripts          BackupScripts `yaml:"scripts"`
 	Targets          []string      `yaml:"targets"`
+
+	// IncludeSystemDatabases dump the system databases too, when Include is empty
+	IncludeSystemDatabases bool `yaml:"includeSystemDatabases"`
+	// StateFile local file in which to record successful dumps, to report the time since the previous one
+	StateFile string `yaml:"stateFile"`
+	// SkipUnchanged skip the dump if the databases have not changed since the last one, as detected by the method
+	SkipUnchanged string `yaml:"skipUnchanged"`
+	// LinkUnchanged link a dump that is skipped as unchanged to the last one
+	LinkUnchanged bool `yaml:"linkUnchanged"`
+	// Lock local lock file to hold for each dump, so that dumps do not run at once
+	Lock Lock `yaml:"lock"`
+	// Latest filename pattern of an alias to point at the most recent dump on each target, e.g. latest.{{ .compression }}
+	Latest string `yaml:"latest"`
+	// CompressionDictionary path to a zstd dictionary with which to compress
+	CompressionDictionary string `yaml:"compressionDictionary"`
+	// HexBlob dump binary columns as hex literals
+	HexBlob bool `yaml:"hexBlob"`
+	// CharacterSet character set of the connection to dump, and so of the dump; utf8mb4 if empty
+	CharacterSet string `yaml:"characterSet"`
+	// Collation collation of the connection to dump, which must be one of CharacterSet; its default if empty
+	Collation string `yaml:"collation"`
+	// SkipSetCharset do not set the character set in which the dump is written, like mysqldump --skip-set-charset
+	SkipSetCharset bool `yaml:"skipSetCharset"`
+	// OrderByPrimary dump the rows of each table in the order of its primary key, like mysqldump --order-by-primary
+	OrderByPrimary bool `yaml:"orderByPrimary"`
+	// SkipTzUtc dump TIMESTAMP values in the time zone of the server, like mysqldump --skip-tz-utc, rather than in UTC
+	SkipTzUtc bool `yaml:"skipTzUtc"`
+	// ObjectTypes the types of object to dump in each database, of tables and views; all if empty
+	ObjectTypes []string `yaml:"objectTypes"`
+	// KeepSQL local directory in which to keep an uncompressed copy of each dump
+	KeepSQL string `yaml:"keepSQL"`
+	// MaxDumpSize the most that the uncompressed SQL of each dump may take, e.g. 20GB, beyond which it is aborted
+	MaxDumpSize string `yaml:"maxDumpSize"`
+	// ConsistentAcrossDatabases dump all of the databases in a single transaction
+	ConsistentAcrossDatabases bool `yaml:"consistentAcrossDatabases"`
+	// VerifyUpload read back each upload to every target, to check that it is complete
+	VerifyUpload bool `yaml:"verifyUpload"`
+	// RowsPerInsert the most rows in each INSERT statement; 0 for as many as fit in maxAllowedPacket
+	RowsPerInsert int `yaml:"rowsPerInsert"`
+	// SkipExtendedInsert one row per INSERT statement
+	SkipExtendedInsert bool `yaml:"skipExtendedInsert"`
+	// Where WHERE clauses, by table in the format <database>.<table>, to dump only some of their rows
+	Where map[string]string `yaml:"where"`
+	// TmpPath directory in which to create the temporary files of each dump, e.g. an encrypted tmpfs
+	TmpPath string `yaml:"tmpPath"`
+	// PrivateTmp create the temporary files of each dump readable only by the user, in a directory of their own
+	PrivateTmp bool `yaml:"privateTmp"`
+	// CompressionThreads how many threads compress each dump at once, for gzip and zstd; 0 for the default
+	CompressionThreads int `yaml:"compressionThreads"`
+	// CompressionLevel level at which to compress: a number, in the scale of the compression, or auto to choose
+	// by the estimated size of the databases; the default of the compression if empty
+	CompressionLevel string `yaml:"compressionLevel"`
+	// CompressionLevelAuto the sizes at which the auto compression level changes
+	CompressionLevelAuto CompressionLevelAuto `yaml:"compressionLevelAuto"`
+	// Label names the kind of dump, e.g. nightly or pre-deploy, in the filename, so that each kind can be pruned on its own
+	Label string `yaml:"label"`
+	// SkipCompressionIfIncompressible do not compress a dump of which a sample hardly compresses
+	SkipCompressionIfIncompressible bool `yaml:"skipCompressionIfIncompressible"`
+	// Partitions partitions, by table in the format <database>.<table>, to dump only those partitions of the tables
+	Partitions map[string][]string `yaml:"partitions"`
+	// Report a report of the recent runs, kept on each target
+	Report Report `yaml:"report"`
+	// Nice the niceness, from 1 to 19, at which to dump, to lower its CPU priority
+	Nice int `yaml:"nice"`
+	// IONice the I/O scheduling class in which to dump, idle or best-effort, to lower its I/O priority
+	IONice string `yaml:"ionice"`
+}
+
+// CompressionLevelAuto the estimated sizes of the databases, e.g. 1GB, below which dumps are compressed at the best
+// level, and from which at the fastest; in between at the default level
+type CompressionLevelAuto struct {
+	Small string `yaml:"small"`
+	Large string `yaml:"large"`
+}
+
+// Report a report of the recent runs, kept on each target
+type Report struct {
+	// History the most runs that the report lists; no report if 0
+	History int `yaml:"history"`
+	// Format of the report, text or html
+	Format string `yaml:"format"`
+}
+
+// Lock a lock file, so that two dumps, e.g. from overlapping cron jobs, do not run at once
+type Lock struct {
+	// File local path of the lock file; no lock if empty
+	File string `yaml:"file"`
+	// Wait how long to wait for a lock held by another dump; 0 to fail at once
+	Wait Duration `yaml:"wait"`
+	// Stale how old a lock may be before it is taken to be left by a dump that crashed
+	Stale Duration `yaml:"stale"`
 }
 
 type Prune struct {
-	Retention string `yaml:"retention"`
+	Retention  string `yaml:"retention"`
+	KeepLast   int    `yaml:"keepLast"`
+	KeepWithin string `yaml:"keepWithin"`
+	// Cron the schedule on which to prune, rather than after each dump; only of the prune of the whole
+	// configuration, not of a target
+	Cron string `yaml:"cron"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface, so that an invalid cron schedule fails when the
+// configuration is loaded, as for Schedule
+func (p *Prune) UnmarshalYAML(n *yaml.Node) error {
+	type plain Prune
+	if err := n.Decode((*plain)(p)); err != nil {
+		return err
+	}
+	if p.Cron != "" {
+		if err := core.ValidateCron(p.Cron); err != nil {
+			return fmt.Errorf("invalid prune cron schedule %q: %v", p.Cron, err)
+		}
+	}
+	return nil
 }
 
 type Schedule struct {
-	Once      bool   `yaml:"once"`
-	Cron      string `yaml:"cron"`
-	Frequency int    `yaml:"frequency"`
-	Begin     string `yaml:"begin"`
+	Once          bool   `yaml:"once"`
+	Cron          string `yaml:"cron"`
+	Frequency     int    `yaml:"frequency"`
+	Begin         string `yaml:"begin"`
+	TriggerListen string `yaml:"triggerListen"`
+	// RunOnStart run a dump immediately on start, in addition to the schedule
+	RunOnStart bool `yaml:"runOnStart"`
+	// Retry how to retry a run that fails
+	Retry Retry `yaml:"retry"`
+	// Blackout windows, e.g. "Sat,Sun 01:00-05:00", in which scheduled dumps are skipped
+	Blackout []string `yaml:"blackout"`
+	// TriggerOverridesBlackout run triggered dumps even in a blackout window
+	TriggerOverridesBlackout bool `yaml:"triggerOverridesBlackout"`
+	// WaitForDatabase how long to wait for the database to be ready, before the first dump
+	WaitForDatabase WaitForDatabase `yaml:"waitForDatabase"`
+}
+
+// WaitForDatabase wait for the database to be ready before the first dump, e.g. when both start at once
+type WaitForDatabase struct {
+	// Timeout how long to wait for the database, altogether; 0 to not wait
+	Timeout Duration `yaml:"timeout"`
+	// Interval how long to wait between each check of the database; 2s if 0
+	Interval Duration `yaml:"interval"`
+}
+
+// Retry how to retry a run that fails, rather than wait for the next one on the schedule
+type Retry struct {
+	// Attempts how many more times to try; 0 to not retry
+	Attempts int `yaml:"attempts"`
+	// Delay how long to wait before each retry
+	Delay Duration `yaml:"delay"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface, so that an invalid cron schedule fails when the
+// configuration is loaded, rather than when it is first scheduled
+func (s *Schedule) UnmarshalYAML(n *yaml.Node) error {
+	type plain Schedule
+	if err := n.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	if s.Cron != "" {
+		if err := core.ValidateCron(s.Cron); err != nil {
+			return fmt.Errorf("invalid cron schedule %q: %v", s.Cron, err)
+		}
+	}
+	return core.ValidateBlackout(s.Blackout)
 }
 
 type BackupScripts struct {
 	PreBackup  string `yaml:"preBackup"`
 	PostBackup string `yaml:"postBackup"`
+	// Exec the command, with its arguments, that runs each script, e.g. docker exec -i db sh -s to run them in the
+	// database container, with the script on its stdin; empty to run them directly
+	Exec []string `yaml:"exec"`
 }
 
 type Restore struct {
 	Scripts RestoreScripts `yaml:"scripts"`
+	Force   bool           `yaml:"force"`
+	// CompressionDictionaries paths to the zstd dictionaries with which dumps may have been compressed
+	CompressionDictionaries []string `yaml:"compressionDictionaries"`
+	// ProgressInterval how often to log how far a restore has got
+	ProgressInterval Duration `yaml:"progressInterval"`
+	// CharacterSet character set of the connection to restore; utf8mb4 if empty
+	CharacterSet string `yaml:"characterSet"`
+	// Collation collation of the connection to restore, which must be one of CharacterSet; its default if empty
+	Collation string `yaml:"collation"`
+	// TmpPath directory in which to create the temporary files of each restore, e.g. an encrypted tmpfs
+	TmpPath string `yaml:"tmpPath"`
+	// PrivateTmp create the temporary files of each restore readable only by the user, in a directory of their own
+	PrivateTmp bool `yaml:"privateTmp"`
+	// DropBeforeRestore drop each database that the dump uses before restoring it; only those in DropAllowed
+	DropBeforeRestore bool `yaml:"dropBeforeRestore"`
+	// DropAllowed the databases that DropBeforeRestore may drop
+	DropAllowed []string `yaml:"dropAllowed"`
+	// Concurrency how many of the files of a dump, one per database, to restore at once
+	Concurrency int `yaml:"concurrency"`
+	// MaxAllowedPacket the largest statement, in bytes, that a restore may send to the database
+	MaxAllowedPacket int `yaml:"maxAllowedPacket"`
+	// NormalizeLineEndings convert the line endings of the SQL of a dump, CRLF or a lone CR, to LF as it is restored
+	NormalizeLineEndings bool `yaml:"normalizeLineEndings"`
+	// GTIDMode how to handle the GTID_PURGED of a dump: warn, strip or reset; restored as it is if empty
+	GTIDMode string `yaml:"gtidMode"`
+	// VerifyRowCounts once restored, compare the rows of each table with those that the dump records it dumped
+	VerifyRowCounts bool `yaml:"verifyRowCounts"`
+	// Database the server to restore to, when it is not the one that is dumped, e.g. to restore the dumps of
+	// production into staging
+	Database RestoreDatabase `yaml:"database"`
+}
+
+// RestoreDatabase the server to restore to. Each setting that is set replaces that of the database configuration,
+// and each that is not is the same as there.
+type RestoreDatabase struct {
+	Server      string        `yaml:"server"`
+	Port        int           `yaml:"port"`
+	Credentials DBCredentials `yaml:"credentials"`
+	// TLS whether and how to encrypt the connection, as for the database configuration
+	TLS string `yaml:"tls"`
+	// ConnectTimeout how long to wait to connect to the server
+	ConnectTimeout Duration `yaml:"connectTimeout"`
+	// DefaultsFile a MySQL option file with credentials for the server, as for the database configuration
+	DefaultsFile string `yaml:"defaultsFile"`
 }
 
 type RestoreScripts struct {
@@ -65,6 +297,46 @@ type Database struct {
 	Server      string        `yaml:"server"`
 	Port        int           `yaml:"port"`
 	Credentials DBCredentials `yaml:"credentials"`
+	// ConnectTimeout how long to wait to connect to the database
+	ConnectTimeout Duration `yaml:"connectTimeout"`
+	// QueryTimeout how long to wait for each metadata query, e.g. listing the databases, but not the dump itself
+	QueryTimeout Duration `yaml:"queryTimeout"`
+	// MaxRetries how many times to retry a metadata query that fails with a transient connection error
+	MaxRetries int `yaml:"maxRetries"`
+	// DefaultsFile a MySQL option file, e.g. ~/.my.cnf, with credentials for the server. Any of the server,
+	// port and credentials that are set here take precedence over the file.
+	DefaultsFile string `yaml:"defaultsFile"`
+	// PreferReplica dump from the Replica, rather than this server, as long as it is not too far behind
+	PreferReplica bool `yaml:"preferReplica"`
+	// Replica a read replica of this server, from which to dump when PreferReplica is set
+	Replica Replica `yaml:"replica"`
+	// TLS whether and how to encrypt the connection: true to require it, verifying the certificate of the server;
+	// skip-verify to require it without verifying; preferred to use it if the server supports it; false or empty
+	// for none
+	TLS string `yaml:"tls"`
+}
+
+// Replica a read replica of a database server. The port and credentials default to those of the server.
+type Replica struct {
+	Server      string        `yaml:"server"`
+	Port        int           `yaml:"port"`
+	Credentials DBCredentials `yaml:"credentials"`
+	// MaxLag the most that the replica may be behind the server for a dump to use it; 0 for any amount, as long
+	// as it is replicating
+	MaxLag Duration `yaml:"maxLag"`
+	// Fallback dump from the server if the replica is too far behind, or its lag cannot be checked; otherwise
+	// the dump fails
+	Fallback bool `yaml:"fallback"`
+}
+
+// DatabaseServer one of multiple servers to back up, each to the same targets
+type DatabaseServer struct {
+	Database `yaml:",inline"`
+	// Name identifies the server in the dump filenames; defaults to the server address
+	Name string `yaml:"name"`
+	// Include and Exclude databases on this server, overriding the ones in the dump configuration
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
 }
 
 type DBCredentials struct {
@@ -79,28 +351,236 @@ type Telemetry struct {
 	BufferSize int `yaml:"bufferSize"`
 }
 
+// Tracing export OpenTelemetry spans of each dump, upload, restore and prune to an OTLP/HTTP collector; disabled
+// unless Endpoint is set
+type Tracing struct {
+	// Endpoint URL of the collector, e.g. http://otel-collector:4318; the path defaults to /v1/traces
+	Endpoint string `yaml:"endpoint"`
+	// Headers sent with each export, e.g. for authentication
+	Headers map[string]string `yaml:"headers"`
+	// ServiceName the service.name of the spans; defaults to mysql-backup
+	ServiceName string `yaml:"serviceName"`
+}
+
+// Metrics where to export the metrics of each run
+type Metrics struct {
+	Pushgateway *PushgatewayMetrics `yaml:"pushgateway"`
+}
+
+// PushgatewayMetrics push the metrics of each run to a Prometheus Pushgateway, when it is too short-lived, e.g.
+// from cron, to be scraped
+type PushgatewayMetrics struct {
+	// URL of the Pushgateway, e.g. http://pushgateway:9091
+	URL string `yaml:"url"`
+	// Job the job label of the metrics; defaults to mysql-backup
+	Job string `yaml:"job"`
+	// Instance the instance label of the metrics, e.g. the host that runs the dumps; none if not set
+	Instance string `yaml:"instance"`
+	// Labels more labels of the metrics, e.g. the environment
+	Labels map[string]string `yaml:"labels"`
+}
+
+// Notifiers convert to the notify.Notifier for each enabled exporter, which is sent the same events as the
+// notifications
+func (m Metrics) Notifiers() ([]notify.Notifier, error) {
+	var notifiers []notify.Notifier
+	if m.Pushgateway != nil {
+		if m.Pushgateway.URL == "" {
+			return nil, fmt.Errorf("pushgateway metrics require url")
+		}
+		if err := notify.ValidatePushgatewayLabels(m.Pushgateway.Labels); err != nil {
+			return nil, fmt.Errorf("invalid pushgateway labels: %v", err)
+		}
+		var opts []notify.PushgatewayOption
+		if m.Pushgateway.Job != "" {
+			opts = append(opts, notify.WithPushgatewayJob(m.Pushgateway.Job))
+		}
+		if m.Pushgateway.Instance != "" {
+			opts = append(opts, notify.WithPushgatewayInstance(m.Pushgateway.Instance))
+		}
+		if len(m.Pushgateway.Labels) > 0 {
+			opts = append(opts, notify.WithPushgatewayLabels(m.Pushgateway.Labels))
+		}
+		notifiers = append(notifiers, notify.NewPushgateway(m.Pushgateway.URL, opts...))
+	}
+	return notifiers, nil
+}
+
+// Notifications providers to notify of the outcome of each run; any number can be enabled at once
+type Notifications struct {
+	Telegram *TelegramNotification `yaml:"telegram"`
+	SMTP     *SMTPNotification     `yaml:"smtp"`
+}
+
+// TelegramNotification send messages from a Telegram bot to a chat
+type TelegramNotification struct {
+	// Token the bot token, as provided by @BotFather
+	Token string `yaml:"token"`
+	// ChatID the chat to which to send messages
+	ChatID string `yaml:"chatID"`
+}
+
+// SMTPNotification send email through an SMTP server
+type SMTPNotification struct {
+	Host string `yaml:"host"`
+	// Port defaults to 587
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	// TLS how to secure the connection, one of: none, starttls, tls; default is starttls
+	TLS                string `yaml:"tls"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+	// Format of the email, one of: plain, html; default is plain
+	Format string `yaml:"format"`
+	// On when to send email, one of: always, failure; default is always
+	On string `yaml:"on"`
+	// AttachEvent attach the details of the run as JSON
+	AttachEvent bool `yaml:"attachEvent"`
+}
+
+// Notifiers convert to the notify.Notifier for each enabled provider
+func (n Notifications) Notifiers() ([]notify.Notifier, error) {
+	var notifiers []notify.Notifier
+	if n.Telegram != nil {
+		if n.Telegram.Token == "" || n.Telegram.ChatID == "" {
+			return nil, fmt.Errorf("telegram notifications require both token and chatID")
+		}
+		notifiers = append(notifiers, notify.NewTelegram(n.Telegram.Token, n.Telegram.ChatID))
+	}
+	if n.SMTP != nil {
+		notifier, err := n.SMTP.notifier()
+		if err != nil {
+			return nil, fmt.Errorf("invalid smtp notifications: %v", err)
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	return notifiers, nil
+}
+
+func (s SMTPNotification) notifier() (notify.Notifier, error) {
+	if s.Host == "" || s.From == "" || len(s.To) == 0 {
+		return nil, fmt.Errorf("host, from and to are required")
+	}
+	port := s.Port
+	if port == 0 {
+		port = 587
+	}
+	var opts []notify.SMTPOption
+	if s.Username != "" {
+		opts = append(opts, notify.WithSMTPAuth(s.Username, s.Password))
+	}
+	if s.TLS != "" {
+		if !notify.ValidSMTPTLS(s.TLS) {
+			return nil, fmt.Errorf("invalid tls %q, must be one of: none, starttls, tls", s.TLS)
+		}
+		opts = append(opts, notify.WithSMTPTLS(s.TLS))
+	}
+	if s.InsecureSkipVerify {
+		opts = append(opts, notify.WithSMTPInsecureSkipVerify())
+	}
+	switch s.Format {
+	case "", "plain":
+	case "html":
+		opts = append(opts, notify.WithSMTPHTML())
+	default:
+		return nil, fmt.Errorf("invalid format %q, must be one of: plain, html", s.Format)
+	}
+	switch s.On {
+	case "", "always":
+	case "failure":
+		opts = append(opts, notify.WithSMTPOnlyOnFailure())
+	default:
+		return nil, fmt.Errorf("invalid on %q, must be one of: always, failure", s.On)
+	}
+	if s.AttachEvent {
+		opts = append(opts, notify.WithSMTPAttachEvent())
+	}
+	return notify.NewSMTP(s.Host, port, s.From, s.To, opts...), nil
+}
+
 var _ yaml.Unmarshaler = &Target{}
 
 type Targets map[string]Target
 
 type Target struct {
 	Storage
+	// Compression overrides the dump compression for this target, if set
+	Compression string
+	// Prune overrides the retention policy for this target, if set
+	Prune *Prune
+	// VerifyUpload read back each upload to this target, to check that it is complete
+	VerifyUpload bool
+	// Timeouts how long the operations on this target may take
+	Timeouts TargetTimeouts
+	// FilenamePattern overrides the dump filename pattern for this target, if set; also how prune finds the dumps
+	// on it
+	FilenamePattern string
+}
+
+// TargetTimeouts how long the operations on a target may take, so that it does not hold up the others; 0 for no limit
+type TargetTimeouts struct {
+	// Connect how long to connect to the target, for SMB and S3 targets
+	Connect Duration `yaml:"connect"`
+	// Upload how long the upload of each file of a dump may take
+	Upload Duration `yaml:"upload"`
+}
+
+// Compressor the compression for the target, if it overrides the dump compression; nil if not
+func (t Target) Compressor() (compression.Compressor, error) {
+	if t.Compression == "" {
+		return nil, nil
+	}
+	return compression.GetCompressor(t.Compression)
 }
 
 type Storage interface {
 	Storage() (storage.Storage, error) // convert to a storage.Storage instance
 }
 
+// targetCommon the settings common to all types of target, decoded before those of its type
+type targetCommon struct {
+	Type         string         `yaml:"type"`
+	URL          string         `yaml:"url"`
+	Compression  string         `yaml:"compression"`
+	Prune        *Prune         `yaml:"prune"`
+	VerifyUpload bool           `yaml:"verifyUpload"`
+	Timeouts     TargetTimeouts `yaml:"timeouts"`
+	// FilenamePattern the pattern of the filenames of the dumps on the target, instead of that of the dump
+	FilenamePattern string `yaml:"filenamePattern"`
+}
+
 func (t *Target) UnmarshalYAML(n *yaml.Node) error {
 	type T struct {
-		Type    string    `yaml:"type"`
-		URL     string    `yaml:"url"`
-		Details yaml.Node `yaml:",inline"`
+		targetCommon `yaml:",inline"`
+		Details      yaml.Node `yaml:",inline"`
 	}
 	obj := &T{}
 	if err := n.Decode(obj); err != nil {
 		return err
 	}
+	if obj.Compression != "" {
+		if _, err := compression.GetCompressor(obj.Compression); err != nil {
+			return fmt.Errorf("invalid compression for target %s: %v", obj.URL, err)
+		}
+	}
+	t.Compression = obj.Compression
+	if obj.Prune != nil && obj.Prune.Cron != "" {
+		return fmt.Errorf("invalid prune for target %s: a target cannot have a prune cron schedule of its own, only the prune of the configuration", obj.URL)
+	}
+	t.Prune = obj.Prune
+	t.VerifyUpload = obj.VerifyUpload
+	if obj.Timeouts.Connect < 0 || obj.Timeouts.Upload < 0 {
+		return fmt.Errorf("invalid timeouts for target %s, must not be negative", obj.URL)
+	}
+	t.Timeouts = obj.Timeouts
+	if obj.FilenamePattern != "" {
+		if err := core.ValidateFilenamePattern(obj.FilenamePattern); err != nil {
+			return fmt.Errorf("invalid filename pattern for target %s: %v", obj.URL, err)
+		}
+	}
+	t.FilenamePattern = obj.FilenamePattern
 	// based on the type, load the rest of the data
 	switch obj.Type {
 	case "s3":
@@ -108,6 +588,9 @@ func (t *Target) UnmarshalYAML(n *yaml.Node) error {
 		if err := n.Decode(&s3Target); err != nil {
 			return err
 		}
+		if err := s3Target.validate(); err != nil {
+			return fmt.Errorf("invalid s3 target %s: %v", obj.URL, err)
+		}
 		t.Storage = s3Target
 	case "smb":
 		var smbTarget SMBTarget
@@ -115,6 +598,18 @@ func (t *Target) UnmarshalYAML(n *yaml.Node) error {
 			return err
 		}
 		t.Storage = smbTarget
+	case "b2":
+		var b2Target B2Target
+		if err := n.Decode(&b2Target); err != nil {
+			return err
+		}
+		t.Storage = b2Target
+	case "exec":
+		var execTarget ExecTarget
+		if err := n.Decode(&execTarget); err != nil {
+			return err
+		}
+		t.Storage = execTarget
 	case "file":
 		var fileTarget FileTarget
 		if err := n.Decode(&fileTarget); err != nil {
@@ -134,7 +629,81 @@ type S3Target struct {
 	Region      string         `yaml:"region"`
 	Endpoint    string         `yaml:"endpoint"`
 	PathStyle   bool           `yaml:"pathStyle"`
+	Profile     string         `yaml:"profile"`
+	ObjectLock  S3ObjectLock   `yaml:"objectLock"`
 	Credentials AWSCredentials `yaml:"credentials"`
+	// ContentType, Metadata and Tags set on each uploaded object; each value can be a template
+	// using the date and databases of the dump
+	ContentType string            `yaml:"contentType"`
+	Metadata    map[string]string `yaml:"metadata"`
+	Tags        map[string]string `yaml:"tags"`
+	// Proxy URL of the HTTP proxy for all requests to the target, overriding the HTTP_PROXY, HTTPS_PROXY and
+	// NO_PROXY environment variables
+	Proxy string `yaml:"proxy"`
+	// Accelerate use S3 Transfer Acceleration, for faster uploads to distant regions; only for AWS
+	Accelerate bool `yaml:"accelerate"`
+	// DualStack use the AWS endpoints that accept both IPv4 and IPv6
+	DualStack bool `yaml:"dualStack"`
+	// Resume keep large uploads in progress, so that they can be resumed if they are interrupted
+	Resume S3Resume `yaml:"resume"`
+	// Prefix template for the folder, below the path in the URL, in which to keep each dump, using the date of
+	// the dump, e.g. {{ .year }}/{{ .month }}/{{ .day }}
+	Prefix string `yaml:"prefix"`
+}
+
+// S3Resume where to keep uploads in progress, and for how long
+type S3Resume struct {
+	// Dir local directory in which to keep each upload in progress, along with a copy of the file
+	Dir string `yaml:"dir"`
+	// AbandonAfter how long after it started to abort an upload that is not resumed; defaults to 7 days
+	AbandonAfter Duration `yaml:"abandonAfter"`
+}
+
+// validate check the settings that can be checked without connecting
+func (s S3Target) validate() error {
+	if s.Accelerate || s.DualStack {
+		u, err := util.SmartParse(s.URL)
+		if err != nil {
+			return fmt.Errorf("invalid target url: %v", err)
+		}
+		if err := s3.ValidateEndpointOptions(u.Hostname(), s.Endpoint, s.PathStyle, s.Accelerate, s.DualStack); err != nil {
+			return err
+		}
+	}
+	if s.ContentType != "" {
+		if err := s3.ValidateContentType(s.ContentType); err != nil {
+			return err
+		}
+	}
+	if err := s3.ValidateMetadata(s.Metadata); err != nil {
+		return err
+	}
+	if s.Proxy != "" {
+		if err := s3.ValidateProxy(s.Proxy); err != nil {
+			return err
+		}
+	}
+	if s.Resume.AbandonAfter < 0 {
+		return fmt.Errorf("invalid resume abandonAfter, must not be negative")
+	}
+	if s.Resume.AbandonAfter != 0 && s.Resume.Dir == "" {
+		return fmt.Errorf("resume abandonAfter requires a resume dir")
+	}
+	if s.Prefix != "" {
+		if err := s3.ValidatePrefix(s.Prefix); err != nil {
+			return err
+		}
+	}
+	return s3.ValidateTags(s.Tags)
+}
+
+// S3ObjectLock settings to lock uploaded objects with S3 Object Lock
+type S3ObjectLock struct {
+	// Mode retention mode, one of: governance, compliance
+	Mode string `yaml:"mode"`
+	// RetainFor how long to retain each object from the time it is uploaded, in the format <integer><unit>,
+	// where unit is one of: h, d, w, m, y
+	RetainFor string `yaml:"retainFor"`
 }
 
 func (s S3Target) Storage() (storage.Storage, error) {
@@ -152,6 +721,46 @@ func (s S3Target) Storage() (storage.Storage, error) {
 	if s.PathStyle {
 		opts = append(opts, s3.WithPathStyle())
 	}
+	if s.Profile != "" {
+		opts = append(opts, s3.WithProfile(s.Profile))
+	}
+	if s.ObjectLock.Mode != "" || s.ObjectLock.RetainFor != "" {
+		if !s3.ValidObjectLockMode(s.ObjectLock.Mode) {
+			return nil, fmt.Errorf("invalid object lock mode %q, must be one of: governance, compliance", s.ObjectLock.Mode)
+		}
+		retain, err := parsePeriod(s.ObjectLock.RetainFor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid object lock retainFor: %v", err)
+		}
+		opts = append(opts, s3.WithObjectLock(s.ObjectLock.Mode, retain))
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	if s.ContentType != "" {
+		opts = append(opts, s3.WithContentType(s.ContentType))
+	}
+	if len(s.Metadata) > 0 {
+		opts = append(opts, s3.WithMetadata(s.Metadata))
+	}
+	if len(s.Tags) > 0 {
+		opts = append(opts, s3.WithTags(s.Tags))
+	}
+	if s.Proxy != "" {
+		opts = append(opts, s3.WithProxy(s.Proxy))
+	}
+	if s.Accelerate {
+		opts = append(opts, s3.WithAccelerate(true))
+	}
+	if s.DualStack {
+		opts = append(opts, s3.WithDualStack(true))
+	}
+	if s.Resume.Dir != "" {
+		opts = append(opts, s3.WithResume(s.Resume.Dir, time.Duration(s.Resume.AbandonAfter)))
+	}
+	if s.Prefix != "" {
+		opts = append(opts, s3.WithPrefix(s.Prefix))
+	}
 	if s.Credentials.AccessKeyId != "" {
 		opts = append(opts, s3.WithAccessKeyId(s.Credentials.AccessKeyId))
 	}
@@ -198,11 +807,120 @@ type SMBCredentials struct {
 	Password string `yaml:"password"`
 }
 
+type B2Target struct {
+	Type        string        `yaml:"type"`
+	URL         string        `yaml:"url"`
+	Credentials B2Credentials `yaml:"credentials"`
+}
+
+func (b B2Target) Storage() (storage.Storage, error) {
+	u, err := util.SmartParse(b.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target url%v", err)
+	}
+	opts := []b2.Option{}
+	if b.Credentials.KeyId != "" {
+		opts = append(opts, b2.WithKeyID(b.Credentials.KeyId))
+	}
+	if b.Credentials.ApplicationKey != "" {
+		opts = append(opts, b2.WithApplicationKey(b.Credentials.ApplicationKey))
+	}
+	store := b2.New(*u, opts...)
+	return store, nil
+}
+
+type B2Credentials struct {
+	KeyId          string `yaml:"keyId"`
+	ApplicationKey string `yaml:"applicationKey"`
+}
+
+// ExecTarget a target backed by an external program, run for each operation; see the exec package for the protocol
+type ExecTarget struct {
+	Type string `yaml:"type"`
+	// URL exec:///path/to/program
+	URL string `yaml:"url"`
+	// Args arguments passed to the program before the operation
+	Args []string `yaml:"args"`
+	// Env environment variables set for the program
+	Env map[string]string `yaml:"env"`
+}
+
+func (e ExecTarget) Storage() (storage.Storage, error) {
+	u, err := util.SmartParse(e.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target url%v", err)
+	}
+	if err := exec.Validate(*u); err != nil {
+		return nil, err
+	}
+	opts := []exec.Option{}
+	if len(e.Args) > 0 {
+		opts = append(opts, exec.WithArgs(e.Args...))
+	}
+	if len(e.Env) > 0 {
+		opts = append(opts, exec.WithEnv(e.Env))
+	}
+	return exec.New(*u, opts...), nil
+}
+
 type FileTarget struct {
 	Type string `yaml:"type"`
 	URL  string `yaml:"url"`
+	// Mode permissions of the dump files, in octal, e.g. "0600"
+	Mode string `yaml:"mode"`
+	// DirMode permissions, in octal, with which to create the destination directory if it does not exist
+	DirMode string `yaml:"dirMode"`
+	// UID and GID owner and group of the dump files
+	UID *int `yaml:"uid"`
+	GID *int `yaml:"gid"`
+	// HardLinks hard link dumps identical to an existing one, rather than storing them again
+	HardLinks bool `yaml:"hardLinks"`
 }
 
 func (f FileTarget) Storage() (storage.Storage, error) {
-	return storage.ParseURL(f.URL, credentials.Creds{})
+	u, err := util.SmartParse(f.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target url%v", err)
+	}
+	if u.Scheme != "file" {
+		return nil, fmt.Errorf("invalid file target url scheme %q", u.Scheme)
+	}
+	opts := []file.Option{}
+	if f.Mode != "" {
+		mode, err := parseFileMode(f.Mode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mode: %v", err)
+		}
+		opts = append(opts, file.WithMode(mode))
+	}
+	if f.DirMode != "" {
+		mode, err := parseFileMode(f.DirMode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dirMode: %v", err)
+		}
+		opts = append(opts, file.WithDirMode(mode))
+	}
+	if f.UID != nil || f.GID != nil {
+		uid, gid := -1, -1
+		if f.UID != nil {
+			uid = *f.UID
+		}
+		if f.GID != nil {
+			gid = *f.GID
+		}
+		opts = append(opts, file.WithOwner(uid, gid))
+	}
+	if f.HardLinks {
+		opts = append(opts, file.WithHardLinks())
+	}
+	return file.New(*u, opts...), nil
+}
+
+// parseFileMode parse an octal file mode, e.g. "0600"
+func parseFileMode(mode string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0o777 {
+		return 0, fmt.Errorf("%q is not an octal file mode", mode)
+	}
+	return os.FileMode(m), nil
 }
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected os.FileMode
+		err      bool
+	}{
+		{"0600", 0o600, false},
+		{"0777", 0o777, false},
+		{"640", 0o640, false},
+		// setuid, setgid and sticky bits are not permissions
+		{"1777", 0, true},
+		{"rw", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			mode, err := parseFileMode(tt.mode)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, mode)
+		})
+	}
+}
+
+func TestS3TargetObjectLock(t *testing.T) {
+	tests := []struct {
+		name       string
+		objectLock S3ObjectLock
+		err        bool
+	}{
+		{"none", S3ObjectLock{}, false},
+		{"governance", S3ObjectLock{Mode: "governance", RetainFor: "30d"}, false},
+		{"compliance upper case", S3ObjectLock{Mode: "COMPLIANCE", RetainFor: "1y"}, false},
+		{"invalid mode", S3ObjectLock{Mode: "legal-hold", RetainFor: "30d"}, true},
+		{"missing mode", S3ObjectLock{RetainFor: "30d"}, true},
+		{"missing retainFor", S3ObjectLock{Mode: "governance"}, true},
+		{"zero retainFor", S3ObjectLock{Mode: "governance", RetainFor: "0d"}, true},
+		{"invalid retainFor", S3ObjectLock{Mode: "governance", RetainFor: "30 days"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := S3Target{Type: "s3", URL: "s3://bucket/path", ObjectLock: tt.objectLock}
+			_, err := target.Storage()
+			if tt.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var periodRE = regexp.MustCompile(`^(\d+)([hdwmy])$`)
+
+// parsePeriod takes a string with format "<integer><unit>" and converts it to a duration.
+// The unit can be 'h' (hours), 'd' (days), 'w' (weeks), 'm' (months), 'y' (years).
+// Assumes 30 days in a month and 365 days in a year, the same as retention.
+func parsePeriod(input string) (time.Duration, error) {
+	matches := periodRE.FindStringSubmatch(input)
+	if matches == nil {
+		return 0, fmt.Errorf("invalid format: %q", input)
+	}
+	value, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %s", matches[1])
+	}
+	if value == 0 {
+		return 0, fmt.Errorf("period must be greater than zero: %q", input)
+	}
+	hours := map[string]int{"h": 1, "d": 24, "w": 24 * 7, "m": 24 * 30, "y": 24 * 365}[matches[2]]
+	return time.Duration(value*hours) * time.Hour, nil
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		err      bool
+	}{
+		{"2h", 2 * time.Hour, false},
+		{"3d", 3 * 24 * time.Hour, false},
+		{"1w", 7 * 24 * time.Hour, false},
+		{"2m", 60 * 24 * time.Hour, false},
+		{"1y", 365 * 24 * time.Hour, false},
+		{"0d", 0, true},
+		{"7", 0, true},
+		{"7x", 0, true},
+		{"-1d", 0, true},
+		{"1.5d", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			period, err := parsePeriod(tt.input)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, period)
+		})
+	}
+}
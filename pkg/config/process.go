@@ -33,6 +33,11 @@ func ProcessConfig(r io.Reader) (actualConfig *ConfigSpec, err error) {
 			if !ok {
 				return nil, fmt.Errorf("parsed yaml had kind local, but spec invalid")
 			}
+			if spec.CredentialsFile != "" {
+				if err := spec.MergeCredentialsFile(spec.CredentialsFile); err != nil {
+					return nil, err
+				}
+			}
 			actualConfig = &spec
 		case KindRemote:
 			spec, ok := conf.Spec.(RemoteSpec)
@@ -72,3 +77,22 @@ func getRemoteConfig(spec RemoteSpec) (conf Config, err error) {
 
 	return baseConf, nil
 }
+
+// CheckConfig check that the config in r is valid, as far as can be told without connecting to anything: that it
+// parses, and has a known version and kind, with a spec of that kind, and that the credentials of its credentials
+// file, if any, are for what is in it. Unlike ProcessConfig, a remote config is not retrieved.
+func CheckConfig(r io.Reader) error {
+	var conf Config
+	decoder := yaml.NewDecoder(r)
+	if err := decoder.Decode(&conf); err != nil {
+		return fmt.Errorf("fatal error reading config file: %w", err)
+	}
+	if conf.Version != ConfigVersion {
+		return fmt.Errorf("unknown config version: %s", conf.Version)
+	}
+	// the kind and its spec are already checked by Config.UnmarshalYAML
+	if spec, ok := conf.Spec.(ConfigSpec); ok && spec.CredentialsFile != "" {
+		return spec.MergeCredentialsFile(spec.CredentialsFile)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+var _ yaml.Unmarshaler = &ConfigSpec{}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface, so that a dump that names a profile is resolved, when
+// the config is loaded, into the settings of the profile with those of the dump in their place
+func (c *ConfigSpec) UnmarshalYAML(n *yaml.Node) error {
+	type plain ConfigSpec
+	if err := n.Decode((*plain)(c)); err != nil {
+		return err
+	}
+	for name, profile := range c.Profiles {
+		if profile.Profile != "" {
+			return fmt.Errorf("invalid dump profile %s: a profile cannot name a profile of its own", name)
+		}
+	}
+	if c.Dump.Profile == "" {
+		return nil
+	}
+	profile := mappingValue(mappingValue(n, "profiles"), c.Dump.Profile)
+	if profile == nil {
+		return fmt.Errorf("unknown dump profile %q", c.Dump.Profile)
+	}
+	// the dump is decoded over the profile, so that only the settings that it has replace those of the profile,
+	// including those in nested sections, such as the schedule
+	var dump Dump
+	if err := profile.Decode(&dump); err != nil {
+		return err
+	}
+	if err := mappingValue(n, "dump").Decode(&dump); err != nil {
+		return err
+	}
+	c.Dump = dump
+	return nil
+}
+
+// mappingValue the value of key in the mapping node n; nil if n is not a mapping, or has no such key
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDumpProfile(t *testing.T) {
+	const profiles = `
+profiles:
+  nightly:
+    compression: zstd
+    compressionLevel: "19"
+    exclude:
+    - scratch
+    schedule:
+      cron: "0 2 * * *"
+      retry:
+        attempts: 3
+`
+	t.Run("resolved", func(t *testing.T) {
+		var cfg ConfigSpec
+		require.NoError(t, yaml.Unmarshal([]byte(profiles+`
+dump:
+  profile: nightly
+  compressionLevel: "3"
+  schedule:
+    cron: "0 3 * * *"
+`), &cfg))
+		// set in the dump, and so in place of the profile
+		assert.Equal(t, "3", cfg.Dump.CompressionLevel)
+		assert.Equal(t, "0 3 * * *", cfg.Dump.Schedule.Cron)
+		// only in the profile, and so kept, including in the nested schedule
+		assert.Equal(t, "zstd", cfg.Dump.Compression)
+		assert.Equal(t, []string{"scratch"}, cfg.Dump.Exclude)
+		assert.Equal(t, 3, cfg.Dump.Schedule.Retry.Attempts)
+		assert.Equal(t, "nightly", cfg.Dump.Profile)
+		// the profile itself is unchanged
+		assert.Equal(t, "19", cfg.Profiles["nightly"].CompressionLevel)
+	})
+	t.Run("without a profile", func(t *testing.T) {
+		var cfg ConfigSpec
+		require.NoError(t, yaml.Unmarshal([]byte(profiles+"dump:\n  compression: gzip\n"), &cfg))
+		assert.Equal(t, Dump{Compression: "gzip"}, cfg.Dump)
+	})
+	t.Run("unknown profile", func(t *testing.T) {
+		var cfg ConfigSpec
+		assert.ErrorContains(t, yaml.Unmarshal([]byte(profiles+"dump:\n  profile: weekly\n"), &cfg), `unknown dump profile "weekly"`)
+	})
+	t.Run("profile of a profile", func(t *testing.T) {
+		var cfg ConfigSpec
+		assert.Error(t, yaml.Unmarshal([]byte(profiles+"  weekly:\n    profile: nightly\n"), &cfg))
+	})
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/database"
+	"github.com/databacker/mysql-backup/pkg/notify"
+)
+
+// schemaDraft the version of JSON Schema in which the schema of the config file is written, the latest that
+// the common editors support
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// targetTypes the type of the settings of each type of target, as decoded by Target.UnmarshalYAML
+var targetTypes = []struct {
+	name string
+	typ  reflect.Type
+}{
+	{"s3", reflect.TypeOf(S3Target{})},
+	{"smb", reflect.TypeOf(SMBTarget{})},
+	{"b2", reflect.TypeOf(B2Target{})},
+	{"exec", reflect.TypeOf(ExecTarget{})},
+	{"file", reflect.TypeOf(FileTarget{})},
+}
+
+// schemaEnums the values that a string field may take, by the name of its type and its key, for those that
+// are checked against a fixed list when they are used
+var schemaEnums = map[string][]string{
+	"Dump.compression":         {"gzip", "bzip2", "zstd", "none", "store"},
+	"Dump.skipUnchanged":       {database.ChangesChecksum, database.ChangesBinlog},
+	"Dump.ionice":              {core.IONiceIdle, core.IONiceBestEffort},
+	"Report.format":            {core.ReportText, core.ReportHTML},
+	"Restore.gtidMode":         {database.GTIDWarn, database.GTIDStrip, database.GTIDReset},
+	"Database.tls":             {database.TLSRequired, database.TLSSkipVerify, database.TLSPreferred, database.TLSDisabled},
+	"RestoreDatabase.tls":      {database.TLSRequired, database.TLSSkipVerify, database.TLSPreferred, database.TLSDisabled},
+	"SMTPNotification.tls":     {notify.SMTPTLSNone, notify.SMTPTLSStartTLS, notify.SMTPTLSImplicit},
+	"SMTPNotification.format":  {"plain", "html"},
+	"SMTPNotification.on":      {"always", "failure"},
+	"targetCommon.compression": {"gzip", "bzip2", "zstd", "none", "store"},
+	"ConfigSpec.logging":       {string(logLevelError), string(logLevelWarning), string(logLevelInfo), string(logLevelDebug), string(logLevelTrace)},
+}
+
+var (
+	durationType = reflect.TypeOf(Duration(0))
+	targetType   = reflect.TypeOf(Target{})
+)
+
+// Schema the JSON Schema of the config file, derived from its Go types, with which editors can validate and
+// complete it. Each target is checked against the settings of its type, and the spec against its kind.
+func Schema() ([]byte, error) {
+	b := &schemaBuilder{definitions: map[string]any{}}
+	var kinds []any
+	for _, k := range []struct {
+		kind string
+		typ  reflect.Type
+	}{
+		{KindLocal, reflect.TypeOf(ConfigSpec{})},
+		{KindRemote, reflect.TypeOf(RemoteSpec{})},
+	} {
+		kinds = append(kinds, map[string]any{
+			"if":   map[string]any{"properties": map[string]any{"kind": map[string]any{"const": k.kind}}},
+			"then": map[string]any{"properties": map[string]any{"spec": b.of(k.typ)}},
+		})
+	}
+	schema := map[string]any{
+		"$schema":     schemaDraft,
+		"title":       "mysql-backup configuration",
+		"type":        "object",
+		"required":    []string{"version", "kind"},
+		"definitions": b.definitions,
+		"properties": map[string]any{
+			"version":  map[string]any{"const": ConfigVersion},
+			"kind":     map[string]any{"enum": []string{KindLocal, KindRemote}},
+			"metadata": b.of(reflect.TypeOf(Metadata{})),
+			"spec":     map[string]any{},
+		},
+		"additionalProperties": false,
+		"allOf":                kinds,
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// schemaBuilder build the schema of Go types, keeping that of each struct once, in its definitions
+type schemaBuilder struct {
+	definitions map[string]any
+}
+
+// of the schema of a value of type t, as yaml.v3 decodes it
+func (b *schemaBuilder) of(t reflect.Type) map[string]any {
+	switch t {
+	case durationType:
+		return map[string]any{"type": "string", "description": "a Go duration, e.g. 30s or 2m"}
+	case targetType:
+		return b.ref(t.Name(), b.target)
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.of(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": b.of(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.of(t.Elem())}
+	case reflect.Struct:
+		return b.ref(t.Name(), func() map[string]any { return object(b.properties(t, nil)) })
+	}
+	// anything at all, e.g. an interface
+	return map[string]any{}
+}
+
+// ref a reference to the definition with the name, which is built the first time that it is referenced
+func (b *schemaBuilder) ref(name string, build func() map[string]any) map[string]any {
+	if _, ok := b.definitions[name]; !ok {
+		// reserved before it is built, for types that refer to themselves
+		b.definitions[name] = nil
+		b.definitions[name] = build()
+	}
+	return map[string]any{"$ref": "#/definitions/" + name}
+}
+
+// properties add the schema of each of the fields of the struct type t to props, by the key under which yaml.v3
+// decodes it: its yaml tag, or its name in lower case, and those of inline fields as part of t
+func (b *schemaBuilder) properties(t reflect.Type, props map[string]any) map[string]any {
+	if props == nil {
+		props = map[string]any{}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(","+opts+",", ",inline,") {
+			b.properties(f.Type, props)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		prop := b.of(f.Type)
+		if enum := schemaEnums[t.Name()+"."+name]; len(enum) > 0 {
+			prop["enum"] = enum
+		}
+		props[name] = prop
+	}
+	return props
+}
+
+// target the schema of a target: the settings common to all targets, and those of its type
+func (b *schemaBuilder) target() map[string]any {
+	var (
+		names []string
+		types []any
+	)
+	for _, tt := range targetTypes {
+		props := b.properties(reflect.TypeOf(targetCommon{}), nil)
+		b.properties(tt.typ, props)
+		props["type"] = map[string]any{"const": tt.name}
+		ref := b.ref(tt.typ.Name(), func() map[string]any { return object(props) })
+		names = append(names, tt.name)
+		types = append(types, map[string]any{
+			"if":   map[string]any{"properties": map[string]any{"type": map[string]any{"const": tt.name}}},
+			"then": ref,
+		})
+	}
+	return map[string]any{
+		"type":     "object",
+		"required": []string{"type"},
+		"properties": map[string]any{
+			"type": map[string]any{"enum": names},
+		},
+		"allOf": types,
+	}
+}
+
+// object the schema of an object with the properties, and no others
+func object(props map[string]any) map[string]any {
+	return map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+}
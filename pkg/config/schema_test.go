@@ -0,0 +1,66 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema(t *testing.T) {
+	b, err := Schema()
+	require.NoError(t, err)
+	var schema struct {
+		Schema      string                     `json:"$schema"`
+		Properties  map[string]json.RawMessage `json:"properties"`
+		Definitions map[string]struct {
+			Properties map[string]struct {
+				Ref   string   `json:"$ref"`
+				Type  string   `json:"type"`
+				Const string   `json:"const"`
+				Enum  []string `json:"enum"`
+			} `json:"properties"`
+			AllOf []struct {
+				If struct {
+					Properties struct {
+						Type struct {
+							Const string `json:"const"`
+						} `json:"type"`
+					} `json:"properties"`
+				} `json:"if"`
+				Then struct {
+					Ref string `json:"$ref"`
+				} `json:"then"`
+			} `json:"allOf"`
+		} `json:"definitions"`
+	}
+	require.NoError(t, json.Unmarshal(b, &schema))
+	assert.Equal(t, schemaDraft, schema.Schema)
+	assert.JSONEq(t, `{"const":"`+ConfigVersion+`"}`, string(schema.Properties["version"]))
+
+	spec := schema.Definitions["ConfigSpec"]
+	assert.Equal(t, "#/definitions/Dump", spec.Properties["dump"].Ref)
+	assert.Equal(t, []string{"error", "warning", "info", "debug", "trace"}, spec.Properties["logging"].Enum)
+	// inline fields are keys of the struct in which they are inlined
+	server := schema.Definitions["DatabaseServer"]
+	assert.Equal(t, "#/definitions/DBCredentials", server.Properties["credentials"].Ref)
+	assert.Equal(t, "string", schema.Definitions["Lock"].Properties["wait"].Type)
+
+	// each type of target is chosen by its type, with both the common settings and its own
+	target := schema.Definitions["Target"]
+	assert.Equal(t, []string{"s3", "smb", "b2", "exec", "file"}, target.Properties["type"].Enum)
+	require.Len(t, target.AllOf, len(targetTypes))
+	for i, tt := range targetTypes {
+		assert.Equal(t, tt.name, target.AllOf[i].If.Properties.Type.Const)
+		assert.Equal(t, "#/definitions/"+tt.typ.Name(), target.AllOf[i].Then.Ref)
+		props := schema.Definitions[tt.typ.Name()].Properties
+		assert.Equal(t, tt.name, props["type"].Const)
+		for _, key := range []string{"url", "compression", "prune", "verifyUpload", "timeouts", "filenamePattern"} {
+			assert.Contains(t, props, key, tt.name)
+		}
+	}
+	assert.Contains(t, schema.Definitions["S3Target"].Properties, "objectLock")
+	assert.NotContains(t, schema.Definitions["SMBTarget"].Properties, "objectLock")
+	assert.Equal(t, "integer", schema.Definitions["FileTarget"].Properties["uid"].Type)
+}
@@ -2,13 +2,14 @@ package config
 
 import (
 	"fmt"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
 
 type logLevel string
 
-//nolint:unused // we expect to use these going forward
 const (
 	logLevelError   logLevel = "error"
 	logLevelWarning logLevel = "warning"
@@ -22,6 +23,38 @@ const (
 	KindRemote    = "remote"
 )
 
+// logLevels the logrus level of each log level
+var logLevels = map[logLevel]log.Level{
+	logLevelError:   log.ErrorLevel,
+	logLevelWarning: log.WarnLevel,
+	logLevelInfo:    log.InfoLevel,
+	logLevelDebug:   log.DebugLevel,
+	logLevelTrace:   log.TraceLevel,
+}
+
+var _ yaml.Unmarshaler = new(logLevel)
+
+// UnmarshalYAML check that the log level is one of the known levels
+func (l *logLevel) UnmarshalYAML(n *yaml.Node) error {
+	var s string
+	if err := n.Decode(&s); err != nil {
+		return err
+	}
+	if _, ok := logLevels[logLevel(s)]; !ok && s != "" {
+		return fmt.Errorf("invalid logging %q, must be one of: %s, %s, %s, %s, %s", s, logLevelError, logLevelWarning, logLevelInfo, logLevelDebug, logLevelTrace)
+	}
+	*l = logLevel(s)
+	return nil
+}
+
+// Level the logrus level of the log level; that of the default, info, if it is empty
+func (l logLevel) Level() log.Level {
+	if level, ok := logLevels[l]; ok {
+		return level
+	}
+	return logLevels[logLevelDefault]
+}
+
 type Config struct {
 	Kind     string   `yaml:"kind"`
 	Version  string   `yaml:"version"`
@@ -71,3 +104,22 @@ func (c *Config) UnmarshalYAML(n *yaml.Node) error {
 	c.Metadata = obj.Metadata
 	return nil
 }
+
+// Duration a time.Duration that is written in the config file as a Go duration string, e.g. "30s" or "2m"
+type Duration time.Duration
+
+var _ yaml.Unmarshaler = new(Duration)
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface, parsing the duration string
+func (d *Duration) UnmarshalYAML(n *yaml.Node) error {
+	var s string
+	if err := n.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
@@ -0,0 +1,235 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/databacker/mysql-backup/pkg/compression"
+	"github.com/databacker/mysql-backup/pkg/database"
+	"github.com/databacker/mysql-backup/pkg/tracing"
+	"github.com/databacker/mysql-backup/pkg/util"
+)
+
+// encryptChunkSize how much of the compressed sample is encrypted at a time
+const encryptChunkSize = 64 << 10
+
+// Benchmark compress a sample of a dump with each of the compressions, at each of their levels, timing how long it
+// takes to compress, uncompress and encrypt, and how large it is compressed, to choose the compression and level
+// that suit the hardware. The sample is held in memory, so that what is timed is the compression, not the disk.
+func (e *Executor) Benchmark(ctx context.Context, opts BenchmarkOptions) (results BenchmarkResults, err error) {
+	results.Start = time.Now()
+	defer func() { results.End = time.Now() }()
+	logger := e.Logger.WithField("run", opts.Run.String())
+	logger.Level = e.Logger.Level
+
+	ctx, span := tracing.Start(ctx, "benchmark", attribute.String("run", opts.Run.String()))
+	defer func() { tracing.End(span, err) }()
+
+	if len(opts.Compressions) == 0 {
+		return results, fmt.Errorf("no compressions to benchmark")
+	}
+	compressors := make([]compression.Compressor, 0, len(opts.Compressions))
+	for _, name := range opts.Compressions {
+		c, err := compression.GetCompressor(name)
+		if err != nil {
+			return results, err
+		}
+		if c, err = compression.WithThreads(c, opts.CompressionThreads); err != nil {
+			return results, err
+		}
+		compressors = append(compressors, c)
+	}
+	size := opts.SampleSize
+	if size <= 0 {
+		size = DefaultBenchmarkSampleSize
+	}
+
+	var sample []byte
+	if opts.Sample != "" {
+		results.Sample = opts.Sample
+		sample, err = readSample(opts.Sample, size, logger)
+	} else {
+		sample, results.Databases, err = dumpSample(ctx, opts.DBConn, opts.DBNames, size)
+	}
+	if err != nil {
+		return results, err
+	}
+	if len(sample) == 0 {
+		return results, fmt.Errorf("the sample is empty, so there is nothing to benchmark with")
+	}
+	results.SampleSize = int64(len(sample))
+	span.SetAttributes(attribute.Int64("sample.bytes", results.SampleSize))
+	logger.Infof("benchmarking with a sample of %s", util.FormatSize(results.SampleSize))
+
+	for i, c := range compressors {
+		name := opts.Compressions[i]
+		levels := benchmarkLevels(c, opts.CompressionLevels)
+		if len(levels) == 0 {
+			logger.Warnf("none of the levels %v are levels of compression %s, skipping it", opts.CompressionLevels, name)
+			continue
+		}
+		for _, level := range levels {
+			if err := ctx.Err(); err != nil {
+				return results, err
+			}
+			b, err := benchmarkCompression(c, level, sample)
+			if err != nil {
+				return results, fmt.Errorf("compression %s at level %d: %v", name, level, err)
+			}
+			b.Compression = name
+			logger.Debugf("compression %s at level %d: %s in %s", name, level, util.FormatSize(b.Size), b.Compress)
+			results.Compressions = append(results.Compressions, b)
+		}
+	}
+	if len(results.Compressions) == 0 {
+		return results, fmt.Errorf("none of the levels %v are levels of any of the compressions", opts.CompressionLevels)
+	}
+	return results, nil
+}
+
+// benchmarkLevels the levels at which to benchmark the compressor c: those of levels that it has, or if there are
+// none, each of its distinct levels. A compressor without levels is benchmarked once, at 0, whatever the levels.
+func benchmarkLevels(c compression.Compressor, levels []int) []int {
+	distinct := compression.DistinctLevels(c)
+	if distinct == nil {
+		return []int{0}
+	}
+	if len(levels) == 0 {
+		return distinct
+	}
+	var valid []int
+	for _, level := range levels {
+		if level > 0 && compression.ValidateLevel(c, level) == nil {
+			valid = append(valid, level)
+		}
+	}
+	return valid
+}
+
+// readSample up to size bytes of the file at path, uncompressed, if it is compressed with a compression that is
+// detected from its header. One that is not is used as it is, e.g. SQL or a tar archive.
+func readSample(path string, size int64, logger *log.Entry) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open sample %s: %v", path, err)
+	}
+	defer f.Close()
+	compressor, err := compression.Detect(f)
+	if err != nil {
+		return nil, fmt.Errorf("sample %s: %v", path, err)
+	}
+	var r io.Reader = f
+	if compressor != nil {
+		logger.Debugf("sample %s is compressed as %s, uncompressing it", path, compressor.Extension())
+		if r, err = compressor.Uncompress(f); err != nil {
+			return nil, fmt.Errorf("unable to uncompress sample %s: %v", path, err)
+		}
+	}
+	sample, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read sample %s: %v", path, err)
+	}
+	return sample, nil
+}
+
+// dumpSample dump the databases dbnames, or all but the system databases if there are none, from dbconn, until
+// the dump would be larger than size, returning what was dumped until then, and the databases
+func dumpSample(ctx context.Context, dbconn database.Connection, dbnames []string, size int64) ([]byte, []string, error) {
+	var err error
+	if len(dbnames) == 0 {
+		if dbnames, err = database.GetSchemas(ctx, dbconn, false); err != nil {
+			return nil, nil, fmt.Errorf("failed to list database schemas: %v", err)
+		}
+	}
+	if len(dbnames) == 0 {
+		return nil, nil, fmt.Errorf("no databases from which to dump a sample")
+	}
+	var buf bytes.Buffer
+	budget := newDumpBudget(size)
+	err = database.Dump(ctx, dbconn, database.DumpOpts{}, []database.DumpWriter{{Schemas: dbnames, Writer: budget.writer(&buf)}})
+	// a dump that fills the sample is stopped by the budget, which is not a failure
+	if exceeded, _ := budget.exceeded(); err != nil && !exceeded {
+		return nil, nil, fmt.Errorf("failed to dump the sample: %v", err)
+	}
+	return buf.Bytes(), dbnames, nil
+}
+
+// benchmarkCompression compress the sample with the compressor c at level, and uncompress and encrypt it, timing
+// each of them
+func benchmarkCompression(c compression.Compressor, level int, sample []byte) (CompressionBenchmark, error) {
+	b := CompressionBenchmark{Level: level}
+	c, err := compression.WithLevel(c, level)
+	if err != nil {
+		return b, err
+	}
+	var compressed bytes.Buffer
+	start := time.Now()
+	w, err := c.Compress(&compressed)
+	if err != nil {
+		return b, fmt.Errorf("unable to create a compressor: %v", err)
+	}
+	if _, err := w.Write(sample); err != nil {
+		return b, fmt.Errorf("unable to compress: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return b, fmt.Errorf("unable to compress: %v", err)
+	}
+	b.Compress = time.Since(start)
+	b.Size = int64(compressed.Len())
+
+	start = time.Now()
+	r, err := c.Uncompress(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		return b, fmt.Errorf("unable to create an uncompressor: %v", err)
+	}
+	n, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return b, fmt.Errorf("unable to uncompress: %v", err)
+	}
+	b.Uncompress = time.Since(start)
+	if n != int64(len(sample)) {
+		return b, fmt.Errorf("uncompressed to %d bytes, rather than the %d of the sample", n, len(sample))
+	}
+
+	if b.Encrypt, err = encryptDuration(compressed.Bytes()); err != nil {
+		return b, err
+	}
+	return b, nil
+}
+
+// encryptDuration how long it takes to encrypt data with AES-256 in CBC mode, as openssl smime -aes256 in the
+// example encryption script does, with a random key; what is encrypted is discarded
+func encryptDuration(data []byte) (time.Duration, error) {
+	key := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(key); err != nil {
+		return 0, fmt.Errorf("unable to generate an encryption key: %v", err)
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return 0, fmt.Errorf("unable to generate an encryption IV: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return 0, fmt.Errorf("unable to create a cipher: %v", err)
+	}
+	mode := cipher.NewCBCEncrypter(block, iv)
+	chunk := make([]byte, encryptChunkSize)
+	start := time.Now()
+	for offset := 0; offset < len(data); offset += len(chunk) {
+		n := copy(chunk, data[offset:])
+		// the last chunk is padded to a whole block, with whatever is there, as only how long it takes matters
+		n = (n + aes.BlockSize - 1) / aes.BlockSize * aes.BlockSize
+		mode.CryptBlocks(chunk[:n], chunk[:n])
+	}
+	return time.Since(start), nil
+}
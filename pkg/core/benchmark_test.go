@@ -0,0 +1,90 @@
+package core
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBenchmark(t *testing.T) {
+	var sql strings.Builder
+	for i := 0; sql.Len() < 1<<20; i++ {
+		fmt.Fprintf(&sql, "INSERT INTO `users` VALUES (%d,'user%d','user%d@example.com');\n", i, i, i%97)
+	}
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "sample.sql")
+	require.NoError(t, os.WriteFile(plain, []byte(sql.String()), 0o600))
+	compressed := filepath.Join(dir, "sample.tgz")
+	f, err := os.Create(compressed)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	_, err = gz.Write([]byte(sql.String()))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, f.Close())
+
+	type run struct {
+		compression string
+		level       int
+	}
+	tests := []struct {
+		name         string
+		sample       string
+		sampleSize   int64
+		compressions []string
+		levels       []int
+		expected     []run
+		size         int64
+		err          string
+	}{
+		{"distinct levels", plain, 0, []string{"zstd", "none"}, nil, []run{{"zstd", 1}, {"zstd", 3}, {"zstd", 6}, {"zstd", 19}, {"none", 0}}, int64(sql.Len()), ""},
+		{"given levels", plain, 0, []string{"gzip", "zstd"}, []int{1, 12}, []run{{"gzip", 1}, {"zstd", 1}, {"zstd", 12}}, int64(sql.Len()), ""},
+		{"compressed sample", compressed, 0, []string{"gzip"}, []int{9}, []run{{"gzip", 9}}, int64(sql.Len()), ""},
+		{"sample size", compressed, 1000, []string{"bzip2"}, []int{1}, []run{{"bzip2", 1}}, 1000, ""},
+		{"no valid levels", plain, 0, []string{"gzip"}, []int{12}, nil, 0, "none of the levels [12] are levels of any of the compressions"},
+		{"unknown compression", plain, 0, []string{"xz"}, nil, nil, 0, "unknown compression format: xz"},
+		{"no compressions", plain, 0, nil, nil, nil, 0, "no compressions to benchmark"},
+		{"missing sample", filepath.Join(dir, "missing.sql"), 0, []string{"gzip"}, nil, nil, 0, "unable to open sample"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &Executor{Logger: log.New()}
+			results, err := executor.Benchmark(context.Background(), BenchmarkOptions{
+				Sample:            tt.sample,
+				SampleSize:        tt.sampleSize,
+				Compressions:      tt.compressions,
+				CompressionLevels: tt.levels,
+				Run:               uuid.New(),
+			})
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.sample, results.Sample)
+			assert.Equal(t, tt.size, results.SampleSize)
+			var runs []run
+			for _, b := range results.Compressions {
+				runs = append(runs, run{b.Compression, b.Level})
+				assert.Positive(t, b.Size, b.Compression)
+				assert.Positive(t, b.Compress, b.Compression)
+				assert.Positive(t, b.Encrypt, b.Compression)
+				if b.Compression == "none" {
+					assert.GreaterOrEqual(t, b.Size, results.SampleSize)
+				} else {
+					assert.Less(t, b.Ratio(results.SampleSize), 0.5, b.Compression)
+				}
+			}
+			assert.Equal(t, tt.expected, runs)
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package core
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/databacker/mysql-backup/pkg/database"
+)
+
+// DefaultBenchmarkSampleSize how much of the sample Benchmark uses, unless another size is given
+const DefaultBenchmarkSampleSize int64 = 64 << 20
+
+// BenchmarkOptions the sample with which to benchmark, and the compressions and levels to benchmark
+type BenchmarkOptions struct {
+	// Sample path of a dump, or of a file of SQL, with which to benchmark; a compressed dump is uncompressed first.
+	// If empty, the sample is dumped from DBConn.
+	Sample string
+	// DBConn the database server from which to dump the sample, if there is no Sample file
+	DBConn database.Connection
+	// DBNames the databases from which to dump the sample; all but the system databases if empty
+	DBNames []string
+	// SampleSize the most of the sample to use, in bytes, from its start; DefaultBenchmarkSampleSize if 0
+	SampleSize int64
+	// Compressions the names of the compressions to benchmark, e.g. gzip, as for compression.GetCompressor
+	Compressions []string
+	// CompressionLevels the levels at which to benchmark each compression, of those of them that it has; each of
+	// its compression.DistinctLevels if empty
+	CompressionLevels []int
+	// CompressionThreads how many threads compress at once, as for DumpOptions
+	CompressionThreads int
+	Run                uuid.UUID
+}
@@ -0,0 +1,41 @@
+package core
+
+import "time"
+
+// BenchmarkResults the results of the benchmark of each compression and level with a sample
+type BenchmarkResults struct {
+	Start time.Time
+	End   time.Time
+	// Sample the file of the sample; empty if it was dumped from the databases
+	Sample string
+	// Databases the databases from which the sample was dumped, if it was not a file
+	Databases []string
+	// SampleSize the size of the sample, uncompressed, in bytes
+	SampleSize int64
+	// Compressions the result for each compression, at each of its levels, in the order in which they were run
+	Compressions []CompressionBenchmark
+}
+
+// CompressionBenchmark the result of the benchmark of a single compression at a single level
+type CompressionBenchmark struct {
+	// Compression the name of the compression, e.g. gzip
+	Compression string
+	// Level the level at which it compressed; 0 if it has no levels
+	Level int
+	// Size the size of the sample, compressed, in bytes
+	Size int64
+	// Compress how long it took to compress the sample
+	Compress time.Duration
+	// Uncompress how long it took to uncompress the sample, as a restore would
+	Uncompress time.Duration
+	// Encrypt how long it took to encrypt the compressed sample with AES-256, the overhead of encrypting the dump
+	Encrypt time.Duration
+}
+
+// Ratio the size of the compressed sample as a fraction of that of the sample
+func (c CompressionBenchmark) Ratio(sampleSize int64) float64 {
+	if sampleSize == 0 {
+		return 0
+	}
+	return float64(c.Size) / float64(sampleSize)
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errBlackout a run was skipped because it would have started in a blackout window
+var errBlackout = errors.New("in blackout window")
+
+// blackoutRE the format of a blackout window: optional days, followed by the start and end times, e.g.
+// "Sat,Sun 01:00-05:00" or "22:30-02:00"
+var blackoutRE = regexp.MustCompile(`^(?:(\S+)\s+)?([0-9]{2}):([0-9]{2})-([0-9]{2}):([0-9]{2})$`)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// blackoutWindow a window of time, in UTC, on some days of the week, in which scheduled runs are skipped
+type blackoutWindow struct {
+	spec string
+	// days the days on which the window starts; every day if empty
+	days []time.Weekday
+	// start and end from midnight; if end is before start, the window ends the next day
+	start, end time.Duration
+}
+
+// ValidateBlackout check that each of the windows is a valid blackout window, in the format
+// "[<days> ]HH:MM-HH:MM", where days is a comma-separated list of days or ranges of them, e.g. "Mon-Fri,Sun"
+func ValidateBlackout(windows []string) error {
+	_, err := parseBlackout(windows)
+	return err
+}
+
+func parseBlackout(windows []string) ([]blackoutWindow, error) {
+	var parsed []blackoutWindow
+	for _, w := range windows {
+		parts := blackoutRE.FindStringSubmatch(strings.TrimSpace(w))
+		if parts == nil {
+			return nil, fmt.Errorf("invalid blackout window %q, must be in the format [<days> ]HH:MM-HH:MM", w)
+		}
+		window := blackoutWindow{spec: w}
+		var err error
+		if parts[1] != "" {
+			if window.days, err = parseWeekdays(parts[1]); err != nil {
+				return nil, fmt.Errorf("invalid blackout window %q: %v", w, err)
+			}
+		}
+		if window.start, err = parseTimeOfDay(parts[2], parts[3]); err != nil {
+			return nil, fmt.Errorf("invalid blackout window %q: %v", w, err)
+		}
+		if window.end, err = parseTimeOfDay(parts[4], parts[5]); err != nil {
+			return nil, fmt.Errorf("invalid blackout window %q: %v", w, err)
+		}
+		if window.start == window.end {
+			return nil, fmt.Errorf("invalid blackout window %q: start and end are the same", w)
+		}
+		parsed = append(parsed, window)
+	}
+	return parsed, nil
+}
+
+// parseWeekdays parse a comma-separated list of days, or ranges of them, e.g. "Mon-Fri,Sun"
+func parseWeekdays(s string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, item := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(item, "-")
+		first, ok := weekdays[strings.ToLower(from)]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[strings.ToLower(to)]; !ok {
+				return nil, fmt.Errorf("unknown day %q", to)
+			}
+		}
+		// a range can wrap around the end of the week, e.g. Sat-Mon
+		for d := first; ; d = (d + 1) % 7 {
+			days = append(days, d)
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseTimeOfDay(hours, minutes string) (time.Duration, error) {
+	h, _ := strconv.Atoi(hours)
+	m, _ := strconv.Atoi(minutes)
+	if h > 23 || m > 59 {
+		return 0, fmt.Errorf("invalid time %s:%s", hours, minutes)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// contains whether t is in the window. A window that ends the next day belongs to the day it starts, so that
+// "Fri 23:00-02:00" includes early on Saturday, but not early on Friday.
+func (w blackoutWindow) contains(t time.Time) bool {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	sinceMidnight := t.Sub(midnight)
+	if w.start < w.end {
+		return w.onDay(t.Weekday()) && sinceMidnight >= w.start && sinceMidnight < w.end
+	}
+	if sinceMidnight >= w.start {
+		return w.onDay(t.Weekday())
+	}
+	return sinceMidnight < w.end && w.onDay((t.Weekday()+6)%7)
+}
+
+func (w blackoutWindow) onDay(d time.Weekday) bool {
+	if len(w.days) == 0 {
+		return true
+	}
+	for _, day := range w.days {
+		if day == d {
+			return true
+		}
+	}
+	return false
+}
+
+// inBlackout the first of the windows that t is in, if any
+func inBlackout(windows []blackoutWindow, t time.Time) (string, bool) {
+	for _, w := range windows {
+		if w.contains(t) {
+			return w.spec, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBlackout(t *testing.T) {
+	tests := []struct {
+		window string
+		err    bool
+	}{
+		{"01:00-05:00", false},
+		{"22:30-02:00", false},
+		{"Sat,Sun 01:00-05:00", false},
+		{"mon-fri 01:00-05:00", false},
+		{"Sat-Mon,Wed 01:00-05:00", false},
+		{"1:00-5:00", true},
+		{"01:00-24:00", true},
+		{"01:60-05:00", true},
+		{"01:00-01:00", true},
+		{"Someday 01:00-05:00", true},
+		{"Mon-Funday 01:00-05:00", true},
+		{"0 1 * * *", true},
+	}
+	for _, tt := range tests {
+		err := ValidateBlackout([]string{tt.window})
+		if tt.err {
+			assert.Error(t, err, tt.window)
+		} else {
+			assert.NoError(t, err, tt.window)
+		}
+	}
+}
+
+func TestBlackoutContains(t *testing.T) {
+	// 2024-01-05 is a Friday
+	friday := func(hour, minute int) time.Time { return time.Date(2024, 1, 5, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		window string
+		t      time.Time
+		in     bool
+	}{
+		{"01:00-05:00", friday(3, 0), true},
+		{"01:00-05:00", friday(1, 0), true},
+		{"01:00-05:00", friday(5, 0), false},
+		{"01:00-05:00", friday(0, 59), false},
+		{"22:30-02:00", friday(23, 0), true},
+		{"22:30-02:00", friday(1, 0), true},
+		{"22:30-02:00", friday(2, 0), false},
+		{"Fri 01:00-05:00", friday(3, 0), true},
+		{"Sat,Sun 01:00-05:00", friday(3, 0), false},
+		{"Mon-Fri 01:00-05:00", friday(3, 0), true},
+		{"Sat-Mon 01:00-05:00", friday(3, 0).Add(3 * 24 * time.Hour), true},
+		// a window that ends the next day belongs to the day it starts
+		{"Fri 23:00-02:00", friday(1, 0), false},
+		{"Fri 23:00-02:00", friday(1, 0).Add(24 * time.Hour), true},
+		{"Thu 23:00-02:00", friday(1, 0), true},
+		// times are in UTC, whatever the zone of the time checked
+		{"01:00-05:00", friday(3, 0).In(time.FixedZone("UTC+10", 10*60*60)), true},
+	}
+	for _, tt := range tests {
+		windows, err := parseBlackout([]string{tt.window})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.window, err)
+		}
+		_, in := inBlackout(windows, tt.t)
+		assert.Equal(t, tt.in, in, "%s at %s", tt.window, tt.t)
+	}
+}
+
+func TestTimerBlackout(t *testing.T) {
+	// together, the windows cover the whole day, so the run at startup is always skipped
+	opts := TimerOptions{Begin: "+1440", Frequency: 1440, RunOnStart: true, Blackout: []string{"00:00-12:00", "12:00-00:00"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var runs int
+	e := &Executor{Logger: log.New()}
+	err := e.Timer(ctx, opts, func(ctx context.Context) error {
+		runs++
+		return nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, runs)
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/databacker/mysql-backup/pkg/util"
+)
+
+// dumpBudget the most bytes that the SQL files of a dump may take, shared by all of them, so that a dump that
+// grows beyond it is aborted as it is written, rather than once it has filled the disk or the target
+type dumpBudget struct {
+	max     int64
+	mu      sync.Mutex
+	written int64
+	over    bool
+}
+
+// newDumpBudget a budget of max bytes, or nil, for no limit, if max is 0
+func newDumpBudget(max int64) *dumpBudget {
+	if max <= 0 {
+		return nil
+	}
+	return &dumpBudget{max: max}
+}
+
+// writer w, counting what is written to it against the budget, which fails a write that would exceed it
+func (b *dumpBudget) writer(w io.Writer) io.Writer {
+	if b == nil {
+		return w
+	}
+	return &budgetWriter{w: w, budget: b}
+}
+
+// claim n more bytes of the budget, whether they fit
+func (b *dumpBudget) claim(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.over || b.written+int64(n) > b.max {
+		b.over = true
+		return false
+	}
+	b.written += int64(n)
+	return true
+}
+
+// exceeded whether a write would have exceeded the budget, and how much was written until then
+func (b *dumpBudget) exceeded() (bool, int64) {
+	if b == nil {
+		return false, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.over, b.written
+}
+
+type budgetWriter struct {
+	w      io.Writer
+	budget *dumpBudget
+}
+
+func (bw *budgetWriter) Write(p []byte) (int, error) {
+	if !bw.budget.claim(len(p)) {
+		return 0, fmt.Errorf("dump exceeds the maximum dump size of %s", util.FormatSize(bw.budget.max))
+	}
+	return bw.w.Write(p)
+}
+
+// ValidateMaxDumpSize check the maximum size of a dump, which must not be negative
+func ValidateMaxDumpSize(size int64) error {
+	if size < 0 {
+		return fmt.Errorf("invalid maximum dump size %d, must be at least 0", size)
+	}
+	return nil
+}
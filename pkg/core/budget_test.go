@@ -0,0 +1,45 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpBudget(t *testing.T) {
+	budget := newDumpBudget(10)
+	var a, b bytes.Buffer
+	wa, wb := budget.writer(&a), budget.writer(&b)
+
+	_, err := wa.Write([]byte("12345"))
+	require.NoError(t, err)
+	_, err = wb.Write([]byte("1234"))
+	require.NoError(t, err)
+	exceeded, _ := budget.exceeded()
+	assert.False(t, exceeded)
+
+	// shared by the writers, so the second one exceeds it, and nothing more is written to either
+	_, err = wb.Write([]byte("12"))
+	assert.ErrorContains(t, err, "maximum dump size")
+	_, err = wa.Write([]byte("1"))
+	assert.Error(t, err)
+	exceeded, written := budget.exceeded()
+	assert.True(t, exceeded)
+	assert.Equal(t, int64(9), written)
+	assert.Equal(t, "12345", a.String())
+	assert.Equal(t, "1234", b.String())
+
+	// no budget, no limit
+	var c bytes.Buffer
+	assert.Equal(t, &c, newDumpBudget(0).writer(&c))
+	exceeded, _ = newDumpBudget(0).exceeded()
+	assert.False(t, exceeded)
+}
+
+func TestValidateMaxDumpSize(t *testing.T) {
+	assert.NoError(t, ValidateMaxDumpSize(0))
+	assert.NoError(t, ValidateMaxDumpSize(1<<30))
+	assert.Error(t, ValidateMaxDumpSize(-1))
+}
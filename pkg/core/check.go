@@ -0,0 +1,80 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/tracing"
+)
+
+// probePrefix the prefix of the name of the probe file that CheckTargets writes to each target
+const probePrefix = ".databacker_probe_"
+
+// CheckTargets check that dumps can be written to each target, by writing a tiny probe file to it and removing it
+// again. It does not list the target, so that it works with credentials that may write but not list, as a
+// least-privilege policy may grant. A target that cannot be written is an error; one that can be written, but not
+// removed from, is reported, as it can still store dumps, but not be pruned. Streams are skipped.
+func (e *Executor) CheckTargets(ctx context.Context, opts CheckOptions) (results CheckResults, err error) {
+	results.Start = time.Now()
+	defer func() { results.End = time.Now() }()
+	logger := e.Logger.WithField("run", opts.Run.String())
+	logger.Level = e.Logger.Level
+
+	ctx, span := tracing.Start(ctx, "check", attribute.String("run", opts.Run.String()))
+	defer func() { tracing.End(span, err) }()
+
+	probe, err := os.CreateTemp("", probePrefix)
+	if err != nil {
+		return results, fmt.Errorf("unable to create probe file: %v", err)
+	}
+	defer os.Remove(probe.Name())
+	if _, err := fmt.Fprintf(probe, "mysql-backup write check %s\n", opts.Run); err != nil {
+		probe.Close()
+		return results, fmt.Errorf("unable to write probe file: %v", err)
+	}
+	if err := probe.Close(); err != nil {
+		return results, fmt.Errorf("unable to write probe file: %v", err)
+	}
+	name := probePrefix + opts.Run.String()
+
+	var errs []error
+	for _, target := range opts.Targets {
+		check := checkTarget(ctx, target, name, probe.Name(), logger)
+		results.Targets = append(results.Targets, check)
+		if !check.Writable && !check.Skipped {
+			errs = append(errs, fmt.Errorf("target %s: %v", target.URL(), check.Err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// checkTarget write the probe file source to target as name, and remove it again
+func checkTarget(ctx context.Context, target storage.Storage, name, source string, logger *log.Entry) TargetCheck {
+	check := TargetCheck{URL: target.URL()}
+	if storage.IsStream(target) {
+		logger.Debugf("skipping check of stream target %s", target.URL())
+		check.Skipped = true
+		return check
+	}
+	if _, err := target.Push(ctx, name, source, logger); err != nil {
+		logger.Errorf("target %s cannot be written: %v", target.URL(), err)
+		check.Err = err
+		return check
+	}
+	check.Writable = true
+	if err := target.Remove(ctx, name, logger); err != nil {
+		logger.Warnf("target %s can be written, but the probe file %s could not be removed, so dumps cannot be pruned from it: %v", target.URL(), name, err)
+		check.Err = err
+		return check
+	}
+	check.Removed = true
+	logger.Infof("target %s can be written", target.URL())
+	return check
+}
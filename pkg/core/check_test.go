@@ -0,0 +1,75 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+	"github.com/databacker/mysql-backup/pkg/storage/stdio"
+)
+
+// writeOnly a storage whose credentials may write, but not list, and optionally not remove
+type writeOnly struct {
+	storage.Storage
+	noRemove bool
+}
+
+func (w writeOnly) ReadDir(ctx context.Context, dirname string, logger *log.Entry) ([]fs.FileInfo, error) {
+	return nil, errors.New("access denied")
+}
+
+func (w writeOnly) Remove(ctx context.Context, target string, logger *log.Entry) error {
+	if w.noRemove {
+		return errors.New("access denied")
+	}
+	return w.Storage.Remove(ctx, target, logger)
+}
+
+func TestCheckTargets(t *testing.T) {
+	writable, unremovable := t.TempDir(), t.TempDir()
+	missing := filepath.Join(t.TempDir(), "missing")
+	executor := &Executor{Logger: log.New()}
+	run := uuid.New()
+
+	results, err := executor.CheckTargets(context.Background(), CheckOptions{
+		Targets: []storage.Storage{
+			writeOnly{Storage: file.New(url.URL{Scheme: "file", Path: writable})},
+			writeOnly{Storage: file.New(url.URL{Scheme: "file", Path: unremovable}), noRemove: true},
+			file.New(url.URL{Scheme: "file", Path: missing}),
+			stdio.New(nil, nil),
+		},
+		Run: run,
+	})
+	// only the target that cannot be written is an error
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), missing)
+	require.Len(t, results.Targets, 4)
+
+	assert.True(t, results.Targets[0].Writable)
+	assert.True(t, results.Targets[0].Removed)
+	assert.NoError(t, results.Targets[0].Err)
+	entries, err := os.ReadDir(writable)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	assert.True(t, results.Targets[1].Writable)
+	assert.False(t, results.Targets[1].Removed)
+	assert.Error(t, results.Targets[1].Err)
+	assert.FileExists(t, filepath.Join(unremovable, probePrefix+run.String()))
+
+	assert.False(t, results.Targets[2].Writable)
+	assert.Error(t, results.Targets[2].Err)
+
+	assert.True(t, results.Targets[3].Skipped)
+}
@@ -0,0 +1,12 @@
+package core
+
+import (
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// CheckOptions which targets to check that dumps can be written to
+type CheckOptions struct {
+	Targets []storage.Storage
+	Run     uuid.UUID
+}
@@ -0,0 +1,25 @@
+package core
+
+import "time"
+
+// CheckResults lists results of the check of the targets.
+type CheckResults struct {
+	Start   time.Time
+	End     time.Time
+	Targets []TargetCheck
+}
+
+// TargetCheck the result of the check of a single target
+type TargetCheck struct {
+	// URL of the target
+	URL string
+	// Writable whether the probe file could be written to the target
+	Writable bool
+	// Removed whether the probe file could be removed again; a target that can be written but not removed from can
+	// store dumps, but cannot be pruned
+	Removed bool
+	// Skipped the target is a stream, such as stdout, which has nowhere to write the probe file
+	Skipped bool
+	// Err why the probe file could not be written or removed, if it could not
+	Err error
+}
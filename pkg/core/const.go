@@ -1,5 +1,19 @@
 package core
 
+import "time"
+
 const (
 	DefaultFilenamePattern = "db_backup_{{ .now }}.{{ .compression }}"
+	// DefaultSeparateTableFilenamePattern pattern for tables dumped to their own file,
+	// when the filename pattern does not include the table, with the label, if any, after a double underscore, as for
+	// DefaultLabelFilenamePattern
+	DefaultSeparateTableFilenamePattern = "db_backup_{{ .now }}_{{ if .server }}{{ .server }}_{{ end }}{{ .database }}.{{ .table }}{{ if .label }}__{{ .label }}{{ end }}.{{ .compression }}"
+	// DefaultServerFilenamePattern pattern for dumps of one of multiple servers,
+	// when the filename pattern does not include the server
+	DefaultServerFilenamePattern = "db_backup_{{ .now }}_{{ .server }}.{{ .compression }}"
+	// DefaultLabelFilenamePattern pattern for labelled dumps, when the filename pattern does not include the label.
+	// The label follows a double underscore, which a server name cannot contain, so that prune can tell them apart.
+	DefaultLabelFilenamePattern = "db_backup_{{ .now }}{{ if .server }}_{{ .server }}{{ end }}__{{ .label }}.{{ .compression }}"
+	// DefaultRestoreProgressInterval how often to log the progress of a restore
+	DefaultRestoreProgressInterval = 30 * time.Second
 )
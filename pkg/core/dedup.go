@@ -0,0 +1,299 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/databacker/mysql-backup/pkg/storage"
+)
+
+const (
+	// checksumIndexFilename name of the single index file on each target, recording the checksums of uploaded dumps,
+	// as earlier versions kept it. It is still read, but no longer written, as hosts that share a target would
+	// overwrite each other's entries.
+	checksumIndexFilename = ".mysql-backup-checksums.json"
+	// checksumEntryPrefix prefix of the index entry on each target for each checksum and compression, one small
+	// file each, so that hosts that share a target never write the same entry, unless they upload the same content
+	checksumEntryPrefix = ".mysql-backup-checksum-"
+	// checksumRefPrefix prefix of the reference on each target for a dump that was not uploaded, as the target
+	// already had the same content, recording which dump it is a duplicate of
+	checksumRefPrefix = ".mysql-backup-ref-"
+)
+
+// dumpVolatileRE lines in a dump that differ between runs, or between servers, even if the data has not changed,
+// all of them comments
+var dumpVolatileRE = regexp.MustCompile(`^-- (Dump completed on |Host: |Server version)`)
+
+type checksumIndex struct {
+	Entries []checksumEntry `json:"entries"`
+}
+
+type checksumEntry struct {
+	Checksum    string `json:"checksum"`
+	Compression string `json:"compression"`
+	Filename    string `json:"filename"`
+}
+
+// checksumRef a dump that was not uploaded, as it duplicates another on the target
+type checksumRef struct {
+	// Filename the name the dump would have had
+	Filename    string `json:"filename"`
+	DuplicateOf string `json:"duplicateOf"`
+	Checksum    string `json:"checksum"`
+	Compression string `json:"compression"`
+}
+
+// find the entry for a checksum and compression, nil if none
+func (c *checksumIndex) find(checksum, compression string) *checksumEntry {
+	for i, e := range c.Entries {
+		if e.Checksum == checksum && e.Compression == compression {
+			return &c.Entries[i]
+		}
+	}
+	return nil
+}
+
+// checksumEntryFilename the name on the target of the index entry for the checksum and compression
+func checksumEntryFilename(checksum, compression string) string {
+	return checksumEntryPrefix + checksum + "." + compression + ".json"
+}
+
+// checksumRefFilename the name on the target of the reference for the dump filename, which may be in a directory,
+// so it is hashed to keep the reference at the top of the target
+func checksumRefFilename(filename string) string {
+	return fmt.Sprintf("%s%x.json", checksumRefPrefix, sha256.Sum256([]byte(filename)))
+}
+
+// dumpChecksum calculate the checksum of the content of all of the dump files in dir.
+// It ignores the parts of the dump that change on every run, like the completion time, or with the server, like
+// its name, so that two dumps of the same data have the same checksum.
+func dumpChecksum(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read dump directory: %v", err)
+	}
+	// os.ReadDir returns the entries sorted by filename, so the order, and hence the checksum, is stable
+	h := sha256.New()
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return "", fmt.Errorf("failed to open dump file %s: %v", entry.Name(), err)
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1<<30)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if dumpVolatileRE.Match(line) {
+				continue
+			}
+			_, _ = h.Write(line)
+			_, _ = h.Write([]byte("\n"))
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return "", fmt.Errorf("failed to read dump file %s: %v", entry.Name(), err)
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// readChecksumIndex retrieve the single checksum index of earlier versions from the target. If there is no index,
+// or it cannot be retrieved, returns an empty one.
+func readChecksumIndex(ctx context.Context, t storage.Storage, tmpdir string, logger *log.Entry) checksumIndex {
+	var idx checksumIndex
+	if err := pullJSON(ctx, t, checksumIndexFilename, &idx, tmpdir, logger); err != nil {
+		logger.Debugf("no checksum index on target %s: %v", t.URL(), err)
+		return checksumIndex{}
+	}
+	return idx
+}
+
+// findChecksum the entry on the target for the checksum and compression, or, if there is none, in the single index
+// of earlier versions; nil if neither has one
+func findChecksum(ctx context.Context, t storage.Storage, checksum, compression, tmpdir string, logger *log.Entry) *checksumEntry {
+	var entry checksumEntry
+	err := pullJSON(ctx, t, checksumEntryFilename(checksum, compression), &entry, tmpdir, logger)
+	if err == nil && entry.Filename != "" {
+		return &entry
+	}
+	logger.Debugf("no checksum index entry for %s on target %s: %v", checksum, t.URL(), err)
+	idx := readChecksumIndex(ctx, t, tmpdir, logger)
+	return idx.find(checksum, compression)
+}
+
+// readChecksumRef the reference on the target for the dump filename, if it was not uploaded as a duplicate
+func readChecksumRef(ctx context.Context, t storage.Storage, filename, tmpdir string, logger *log.Entry) (*checksumRef, error) {
+	var ref checksumRef
+	if err := pullJSON(ctx, t, checksumRefFilename(filename), &ref, tmpdir, logger); err != nil {
+		return nil, err
+	}
+	// the name is hashed, so make sure it is the reference for this dump
+	if ref.Filename != filename || ref.DuplicateOf == "" {
+		return nil, fmt.Errorf("reference for %s is for %s", filename, ref.Filename)
+	}
+	return &ref, nil
+}
+
+// pullJSON retrieve the JSON file name from the target into v
+func pullJSON(ctx context.Context, t storage.Storage, name string, v any, tmpdir string, logger *log.Entry) error {
+	local := filepath.Join(tmpdir, name)
+	defer os.Remove(local)
+	if _, err := t.Pull(ctx, name, local, logger); err != nil {
+		return err
+	}
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return nil
+}
+
+// pushJSON save v to the target as the JSON file name
+func pushJSON(ctx context.Context, t storage.Storage, name string, v any, tmpdir string, logger *log.Entry) error {
+	local := filepath.Join(tmpdir, name)
+	defer os.Remove(local)
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", name, err)
+	}
+	if err := os.WriteFile(local, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	if _, err := t.Push(ctx, name, local, logger); err != nil {
+		return fmt.Errorf("failed to push %s: %v", name, err)
+	}
+	return nil
+}
+
+// targetHasFile check if the file exists on the target
+func targetHasFile(ctx context.Context, t storage.Storage, filename string, logger *log.Entry) bool {
+	files, err := t.ReadDir(ctx, path.Dir(filename), logger)
+	if err != nil {
+		return false
+	}
+	base := path.Base(filename)
+	for _, f := range files {
+		if f.Name() == base {
+			return true
+		}
+	}
+	return false
+}
+
+// deduplicate whether to check for duplicates on the target; never on a stream, which keeps nothing to check
+func deduplicate(t storage.Storage, skipDuplicates bool) bool {
+	if storage.IsStream(t) {
+		return false
+	}
+	if skipDuplicates {
+		return true
+	}
+	d, ok := t.(storage.Deduplicator)
+	return ok && d.Deduplicate()
+}
+
+// uploadDeduplicated push the file to the target, unless the target already has a dump with the same checksum,
+// in which case it aliases to the existing one, if the target supports it, or skips the upload entirely, recording
+// a reference to the existing one. Returns the name of the existing dump that it duplicates, if any.
+func uploadDeduplicated(ctx context.Context, t storage.Storage, targetFilename, source, checksum, compression, tmpdir string, logger *log.Entry) (duplicateOf string, copied int64, err error) {
+	if existing := findChecksum(ctx, t, checksum, compression, tmpdir, logger); existing != nil && existing.Filename != targetFilename && targetHasFile(ctx, t, existing.Filename, logger) {
+		linker, ok := t.(storage.Linker)
+		if !ok {
+			ref := checksumRef{Filename: targetFilename, DuplicateOf: existing.Filename, Checksum: checksum, Compression: compression}
+			if err := pushJSON(ctx, t, checksumRefFilename(targetFilename), ref, tmpdir, logger); err != nil {
+				// the content is on the target, only not under this name
+				logger.Warnf("unable to record %s as a duplicate of %s on target %s: %v", targetFilename, existing.Filename, t.URL(), err)
+			}
+			logger.Infof("dump identical to existing %s on target %s, not uploading", existing.Filename, t.URL())
+			return existing.Filename, 0, nil
+		}
+		err := linker.Link(ctx, targetFilename, existing.Filename, logger)
+		if err == nil {
+			logger.Infof("dump identical to existing %s on target %s, linked instead of uploading", existing.Filename, t.URL())
+			return existing.Filename, 0, nil
+		}
+		// e.g. the filesystem does not support links; just upload it
+		logger.Warnf("unable to link %s to existing %s on target %s, uploading: %v", targetFilename, existing.Filename, t.URL(), err)
+	}
+	copied, err = t.Push(ctx, targetFilename, source, logger)
+	if err != nil {
+		return "", copied, fmt.Errorf("failed to push file: %v", err)
+	}
+	// only after the dump is complete on the target, so that an entry always refers to a whole dump
+	entry := checksumEntry{Checksum: checksum, Compression: compression, Filename: targetFilename}
+	if err := pushJSON(ctx, t, checksumEntryFilename(checksum, compression), entry, tmpdir, logger); err != nil {
+		// the dump itself is uploaded, so do not fail; the worst case is it is uploaded again next time
+		logger.Warnf("unable to update checksum index on target %s: %v", t.URL(), err)
+	}
+	return "", copied, nil
+}
+
+// duplicateDump a dump on a target that is not stored in full, but depends on another dump with the same content
+type duplicateDump struct {
+	// name the name on the target that holds it: its reference, or its symlink
+	name string
+	// filename the name of the dump
+	filename    string
+	duplicateOf string
+}
+
+// readDuplicates the dumps among files, as listed on the target, that depend on another: those stored as a
+// reference, and those stored as a link that depends on the file it links to, if the target has such links.
+// A reference that cannot be read is skipped, as it cannot be restored either.
+func readDuplicates(ctx context.Context, t storage.Storage, files []fs.FileInfo, logger *log.Entry) ([]duplicateDump, error) {
+	var (
+		duplicates []duplicateDump
+		tmpdir     string
+	)
+	resolver, canResolve := t.(storage.LinkResolver)
+	for _, fileInfo := range files {
+		name := fileInfo.Name()
+		switch {
+		case strings.HasPrefix(path.Base(name), checksumRefPrefix):
+			if tmpdir == "" {
+				var err error
+				if tmpdir, err = os.MkdirTemp("", "mysql-backup-prune-"); err != nil {
+					return nil, fmt.Errorf("failed to create temporary directory: %v", err)
+				}
+				defer os.RemoveAll(tmpdir)
+			}
+			var ref checksumRef
+			if err := pullJSON(ctx, t, name, &ref, tmpdir, logger); err != nil {
+				logger.Warnf("ignoring unreadable duplicate reference %s on target %s: %v", name, t.URL(), err)
+				continue
+			}
+			if ref.Filename == "" || ref.DuplicateOf == "" {
+				logger.Warnf("ignoring incomplete duplicate reference %s on target %s", name, t.URL())
+				continue
+			}
+			duplicates = append(duplicates, duplicateDump{name: name, filename: ref.Filename, duplicateOf: ref.DuplicateOf})
+		case canResolve && fileInfo.Mode()&fs.ModeSymlink != 0:
+			existing, err := resolver.LinkTarget(ctx, name, logger)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read link %s: %v", name, err)
+			}
+			if existing != "" {
+				duplicates = append(duplicates, duplicateDump{name: name, filename: name, duplicateOf: existing})
+			}
+		}
+	}
+	return duplicates, nil
+}
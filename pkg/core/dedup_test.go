@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpChecksum(t *testing.T) {
+	dump := func(completed string) string {
+		dir := t.TempDir()
+		content := "-- MySQL dump\n-- Host: " + completed + "    Database: db1\nCREATE TABLE t1 (id int);\nINSERT INTO t1 VALUES (1);\n-- Dump completed on " + completed + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "db1_"+completed+".sql"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	first, err := dumpChecksum(dump("2024-01-01T00:00:00Z"))
+	assert.NoError(t, err)
+	second, err := dumpChecksum(dump("2024-01-02T00:00:00Z"))
+	assert.NoError(t, err)
+	assert.Equal(t, first, second, "checksum should ignore the completion time and host")
+
+	changed := t.TempDir()
+	if err := os.WriteFile(filepath.Join(changed, "db1.sql"), []byte("INSERT INTO t1 VALUES (2);\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	third, err := dumpChecksum(changed)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, third, "checksum should change with content")
+}
+
+func TestUploadDeduplicated(t *testing.T) {
+	targetDir, tmpdir := t.TempDir(), t.TempDir()
+	target := file.New(url.URL{Scheme: "file", Path: targetDir})
+	logger := log.NewEntry(log.New())
+	source := filepath.Join(tmpdir, "source.tgz")
+	if err := os.WriteFile(source, []byte("dump"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// first upload goes through as normal
+	dup, copied, err := uploadDeduplicated(context.Background(), target, "first.tgz", source, "abc", "tgz", tmpdir, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "", dup)
+	assert.Equal(t, int64(4), copied)
+
+	// identical content is aliased to the first
+	dup, copied, err = uploadDeduplicated(context.Background(), target, "second.tgz", source, "abc", "tgz", tmpdir, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "first.tgz", dup)
+	assert.Equal(t, int64(0), copied)
+	link, err := os.Readlink(filepath.Join(targetDir, "second.tgz"))
+	assert.NoError(t, err)
+	assert.Equal(t, "first.tgz", link)
+
+	// once the original is gone, it is uploaded again
+	if err := os.Remove(filepath.Join(targetDir, "first.tgz")); err != nil {
+		t.Fatal(err)
+	}
+	dup, _, err = uploadDeduplicated(context.Background(), target, "third.tgz", source, "abc", "tgz", tmpdir, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "", dup)
+	assert.FileExists(t, filepath.Join(targetDir, "third.tgz"))
+}
+
+func TestUploadDeduplicatedHardLinks(t *testing.T) {
+	targetDir, tmpdir := t.TempDir(), t.TempDir()
+	target := file.New(url.URL{Scheme: "file", Path: targetDir}, file.WithHardLinks())
+	assert.True(t, deduplicate(target, false), "hard linking target should always deduplicate")
+	logger := log.NewEntry(log.New())
+	source := filepath.Join(tmpdir, "source.tgz")
+	if err := os.WriteFile(source, []byte("dump"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := uploadDeduplicated(context.Background(), target, "first.tgz", source, "abc", "tgz", tmpdir, logger)
+	assert.NoError(t, err)
+	dup, _, err := uploadDeduplicated(context.Background(), target, "second.tgz", source, "abc", "tgz", tmpdir, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "first.tgz", dup)
+
+	// a hard link is a regular file, which survives removing the original
+	fi, err := os.Lstat(filepath.Join(targetDir, "second.tgz"))
+	assert.NoError(t, err)
+	assert.True(t, fi.Mode().IsRegular())
+	if err := os.Remove(filepath.Join(targetDir, "first.tgz")); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(targetDir, "second.tgz"))
+	assert.NoError(t, err)
+	assert.Equal(t, "dump", string(content))
+}
+
+// unlinkable a storage that cannot link, as most remote ones cannot
+type unlinkable struct {
+	storage.Storage
+}
+
+func TestUploadDeduplicatedReference(t *testing.T) {
+	targetDir, tmpdir := t.TempDir(), t.TempDir()
+	target := unlinkable{file.New(url.URL{Scheme: "file", Path: targetDir})}
+	logger := log.NewEntry(log.New())
+	ctx := context.Background()
+	source := filepath.Join(tmpdir, "source.tgz")
+	if err := os.WriteFile(source, []byte("dump"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := uploadDeduplicated(ctx, target, "host1.tgz", source, "abc", "tgz", tmpdir, logger)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(targetDir, checksumEntryFilename("abc", "tgz")))
+
+	// a duplicate, e.g. from another host, is not uploaded, but recorded
+	dup, copied, err := uploadDeduplicated(ctx, target, "host2.tgz", source, "abc", "tgz", tmpdir, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "host1.tgz", dup)
+	assert.Equal(t, int64(0), copied)
+	assert.NoFileExists(t, filepath.Join(targetDir, "host2.tgz"))
+	ref, err := readChecksumRef(ctx, target, "host2.tgz", tmpdir, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "host1.tgz", ref.DuplicateOf)
+	_, err = readChecksumRef(ctx, target, "host1.tgz", tmpdir, logger)
+	assert.Error(t, err)
+
+	// other compressions are other content
+	dup, _, err = uploadDeduplicated(ctx, target, "host2.tbz2", source, "abc", "tbz2", tmpdir, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "", dup)
+}
+
+func TestFindChecksumLegacyIndex(t *testing.T) {
+	targetDir, tmpdir := t.TempDir(), t.TempDir()
+	target := file.New(url.URL{Scheme: "file", Path: targetDir})
+	logger := log.NewEntry(log.New())
+	legacy := `{"entries":[{"checksum":"abc","compression":"tgz","filename":"old.tgz"}]}`
+	if err := os.WriteFile(filepath.Join(targetDir, checksumIndexFilename), []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entry := findChecksum(context.Background(), target, "abc", "tgz", tmpdir, logger)
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, "old.tgz", entry.Filename)
+	}
+	assert.Nil(t, findChecksum(context.Background(), target, "def", "tgz", tmpdir, logger))
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/databacker/mysql-backup/pkg/compression"
+)
+
+// readDictionaries the contents of each of the compression dictionary files
+func readDictionaries(filenames []string) ([][]byte, error) {
+	dictionaries := make([][]byte, 0, len(filenames))
+	for _, filename := range filenames {
+		dict, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read compression dictionary: %v", err)
+		}
+		dictionaries = append(dictionaries, dict)
+	}
+	return dictionaries, nil
+}
+
+// withDictionary the compressors, with those that are zstd compressing with the dictionary in filename. Fails
+// if none is zstd, rather than silently ignore the dictionary.
+func withDictionary(compressors []compression.Compressor, filename string) ([]compression.Compressor, error) {
+	dictionaries, err := readDictionaries([]string{filename})
+	if err != nil {
+		return nil, err
+	}
+	var (
+		result = make([]compression.Compressor, 0, len(compressors))
+		used   bool
+	)
+	for _, c := range compressors {
+		_, zstd := c.(*compression.ZstdCompressor)
+		used = used || zstd
+		if c, err = compression.WithDictionaries(c, dictionaries...); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		result = append(result, c)
+	}
+	if !used {
+		return nil, fmt.Errorf("compression dictionary %s can only be used with zstd compression", filename)
+	}
+	return result, nil
+}
@@ -0,0 +1,29 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/databacker/mysql-backup/pkg/compression"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithDictionary(t *testing.T) {
+	dict := filepath.Join(t.TempDir(), "raw.dict")
+	if err := os.WriteFile(dict, []byte("not a trained dictionary"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// missing file
+	_, err := withDictionary([]compression.Compressor{&compression.ZstdCompressor{}}, filepath.Join(t.TempDir(), "missing.dict"))
+	assert.ErrorContains(t, err, "failed to read compression dictionary")
+
+	// no zstd compressor to use it
+	_, err = withDictionary([]compression.Compressor{&compression.GzipCompressor{}, &compression.NoneCompressor{}}, dict)
+	assert.ErrorContains(t, err, "can only be used with zstd compression")
+
+	// not in the zstd dictionary format
+	_, err = withDictionary([]compression.Compressor{&compression.GzipCompressor{}, &compression.ZstdCompressor{}}, dict)
+	assert.ErrorContains(t, err, "invalid zstd dictionary")
+}
@@ -1,37 +1,75 @@
 package core
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"text/template"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/databacker/mysql-backup/pkg/archive"
+	"github.com/databacker/mysql-backup/pkg/compression"
 	"github.com/databacker/mysql-backup/pkg/database"
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/storage/upload"
+	"github.com/databacker/mysql-backup/pkg/tracing"
+	"github.com/databacker/mysql-backup/pkg/util"
 )
 
-// Dump run a single dump, based on the provided opts
-func (e *Executor) Dump(opts DumpOptions) (DumpResults, error) {
-	results := DumpResults{Start: time.Now()}
+// serverNameRE characters not allowed in a server name in a filename
+var serverNameRE = regexp.MustCompile(`[^A-Za-z0-9-]`)
+
+// labelRE a valid label
+var labelRE = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// noCompression the compression of a dump that is not worth compressing, a plain tar archive
+var noCompression compression.Compressor = &compression.NoneCompressor{}
+
+// ValidateLabel check the label of a dump, which is part of the filename, so may have only letters, digits and '-'.
+// Unlike the server name, it is not changed to fit, as prune and restore select dumps by it.
+func ValidateLabel(label string) error {
+	if label != "" && !labelRE.MatchString(label) {
+		return fmt.Errorf("invalid label %q, must be letters, digits and '-'", label)
+	}
+	return nil
+}
+
+// Dump run a single dump, based on the provided opts. Cancelling ctx aborts the dump and any uploads.
+func (e *Executor) Dump(ctx context.Context, opts DumpOptions) (results DumpResults, err error) {
+	results.Start = time.Now()
+	// set on every return, which requires the named results
 	defer func() { results.End = time.Now() }()
 
 	targets := opts.Targets
 	safechars := opts.Safechars
 	dbnames := opts.DBNames
-	dbconn := opts.DBConn
 	compressor := opts.Compressor
 	compact := opts.Compact
 	suppressUseDatabase := opts.SuppressUseDatabase
 	maxAllowedPacket := opts.MaxAllowedPacket
-	filenamePattern := opts.FilenamePattern
 	logger := e.Logger.WithField("run", opts.Run.String())
 	logger.Level = e.Logger.Level
 
+	ctx, span := tracing.Start(ctx, "dump", attribute.String("run", opts.Run.String()), attribute.String("server", opts.Server), attribute.String("label", opts.Label))
+	defer func() { tracing.End(span, err) }()
+	// after everything else but the span, so that the report has how the run went, whether it succeeded or not
+	if opts.Report.History > 0 {
+		defer func() { updateReports(ctx, opts, results, err, logger) }()
+	}
+
 	now := time.Now()
 	results.Time = now
 
@@ -42,27 +80,133 @@ func (e *Executor) Dump(opts DumpOptions) (DumpResults, error) {
 	}
 	results.Timestamp = timepart
 
-	// sourceFilename: file that the uploader looks for when performing the upload
-	// targetFilename: the remote file that is actually uploaded
-	sourceFilename := fmt.Sprintf("db_backup_%s.%s", timepart, compressor.Extension())
-	targetFilename, err := ProcessFilenamePattern(filenamePattern, now, timepart, compressor.Extension())
+	server := serverNameRE.ReplaceAllString(opts.Server, "-")
+	if err := ValidateLabel(opts.Label); err != nil {
+		return results, permanent(err)
+	}
+	if err := database.ValidateChanges(opts.SkipUnchanged); err != nil {
+		return results, permanent(err)
+	}
+	// the fingerprint of the last dump is kept in the state file
+	if opts.SkipUnchanged != "" && opts.StateFile == "" {
+		return results, permanent(errors.New("skipping unchanged dumps requires a state file"))
+	}
+	if err := ValidatePriority(opts.Priority); err != nil {
+		return results, permanent(err)
+	}
+	if err := database.ValidateSkipSetCharset(opts.SkipSetCharset, opts.DBConn.Charset); err != nil {
+		return results, permanent(err)
+	}
+	if err := ValidateMaxDumpSize(opts.MaxDumpSize); err != nil {
+		return results, permanent(err)
+	}
+	if opts.DBConn.Collation != "" {
+		if err := database.ValidateCollation(opts.DBConn.Charset, opts.DBConn.Collation); err != nil {
+			return results, permanent(err)
+		}
+	}
+
+	// tables that are dumped to their own files, rather than to the main dump
+	separateTables, err := parseSeparateTables(opts.SeparateTables)
 	if err != nil {
-		return results, fmt.Errorf("failed to process filename pattern: %v", err)
+		return results, permanent(err)
+	}
+	ignoreTables := map[string][]string{}
+	for _, st := range separateTables {
+		ignoreTables[st.schema] = append(ignoreTables[st.schema], st.table)
 	}
 
+	// the dump is compressed once for each compression in use: the default, and any that targets override it with
+	compressors := []compression.Compressor{compressor}
+	for _, t := range targets {
+		c := targetCompressor(t, opts)
+		if !slices.ContainsFunc(compressors, func(existing compression.Compressor) bool { return existing.Extension() == c.Extension() }) {
+			compressors = append(compressors, c)
+		}
+	}
+	if opts.CompressionDictionary != "" {
+		if compressors, err = withDictionary(compressors, opts.CompressionDictionary); err != nil {
+			return results, permanent(err)
+		}
+	}
+	for i, c := range compressors {
+		if compressors[i], err = compression.WithThreads(c, opts.CompressionThreads); err != nil {
+			return results, permanent(err)
+		}
+		if opts.AutoCompressionLevel == nil {
+			if compressors[i], err = compression.WithLevel(compressors[i], opts.CompressionLevel); err != nil {
+				return results, permanent(err)
+			}
+		}
+	}
+	// the files of the dump in each compression, by extension, the main dump first, followed by the separate tables
+	filesByExt, latestByExt, err := dumpFilenamesByExt(opts, separateTables, now, timepart, server, compressors)
+	if err != nil {
+		return results, permanent(err)
+	}
+	// and as named on each target with a filename pattern of its own, which must be valid too
+	for _, t := range targets {
+		ext := targetCompressor(t, opts).Extension()
+		if _, err := targetFiles(t, opts, filesByExt[ext], separateTables, now, timepart, server, ext); err != nil {
+			return results, permanent(err)
+		}
+	}
+	// sourceFilename: file in the default compression, which the pre- and post-backup scripts are given
+	sourceFilename := filesByExt[compressor.Extension()][0].source
+
+	// the whole dump, compression and uploads included, runs at it
+	lowerPriority(opts.Priority, logger)
+
+	// before anything is dumped, so that a dump that overlaps another does not load the database as well
+	if opts.Lock.File != "" {
+		release, err := acquireLock(ctx, opts.Lock, opts.Run.String(), logger)
+		if err != nil {
+			return results, err
+		}
+		defer release()
+	}
+	// uploads that an earlier run left unfinished are completed first; they are of earlier dumps, so this one goes
+	// on whether or not they can be
+	for _, t := range targets {
+		if r, ok := t.(storage.Resumer); ok {
+			resumed, err := r.Resume(ctx, logger)
+			for _, name := range resumed {
+				logger.Infof("completed unfinished upload of %s to %s", name, t.URL())
+			}
+			if err != nil {
+				logger.Warnf("unable to resume all unfinished uploads to %s: %v", t.URL(), err)
+			}
+		}
+	}
+	// from a replica, if there is one that is up to date, to spare the primary
+	dbconn, fromReplica, err := dumpConnection(ctx, opts, logger)
+	if err != nil {
+		return results, err
+	}
+	if fromReplica {
+		results.Replica = dbconn.Host
+		span.SetAttributes(attribute.String("replica", dbconn.Host))
+	}
+
+	// every temporary file and directory of the run, which hold the plaintext dump, are created in root
+	root, removeRoot, err := tmpRoot(opts.Tmp, opts.Run.String())
+	if err != nil {
+		return results, err
+	}
+	defer removeRoot()
 	// create a temporary working directory
-	tmpdir, err := os.MkdirTemp("", "databacker_backup")
+	tmpdir, err := os.MkdirTemp(root, "databacker_backup")
 	if err != nil {
 		return results, fmt.Errorf("failed to make temporary working directory: %v", err)
 	}
 	defer os.RemoveAll(tmpdir)
 	// execute pre-backup scripts if any
-	if err := preBackup(timepart, path.Join(tmpdir, sourceFilename), tmpdir, opts.PreBackupScripts, logger.Level == log.DebugLevel); err != nil {
+	if err := preBackup(ctx, opts.Run.String(), timepart, path.Join(tmpdir, sourceFilename), tmpdir, opts.PreBackupScripts, opts.ScriptsExec, logger.Level == log.DebugLevel); err != nil {
 		return results, fmt.Errorf("error running pre-restore: %v", err)
 	}
 
 	// do the dump(s)
-	workdir, err := os.MkdirTemp("", "databacker_cache")
+	workdir, err := os.MkdirTemp(root, "databacker_cache")
 	if err != nil {
 		return results, fmt.Errorf("failed to make temporary cache directory: %v", err)
 	}
@@ -72,98 +216,760 @@ func (e *Executor) Dump(opts DumpOptions) (DumpResults, error) {
 
 	// do we split the output by schema, or one big dump file?
 	if len(dbnames) == 0 {
-		if dbnames, err = database.GetSchemas(dbconn); err != nil {
+		if dbnames, err = database.GetSchemas(ctx, dbconn, opts.IncludeSystemDatabases); err != nil {
+			// the same credentials are rejected however many times they are tried
+			if database.AccessDenied(err) {
+				return results, permanent(fmt.Errorf("failed to list database schemas: %v", err))
+			}
 			return results, fmt.Errorf("failed to list database schemas: %v", err)
 		}
 	}
+	dbnames = slices.DeleteFunc(dbnames, func(s string) bool { return slices.Contains(opts.Exclude, s) })
+	results.Databases = dbnames
+	for _, schema := range database.WhereDatabases(opts.Where) {
+		if !slices.Contains(dbnames, schema) {
+			return results, permanent(fmt.Errorf("where clause for a table of database %s, which is not dumped", schema))
+		}
+	}
+	for _, schema := range database.PartitionDatabases(opts.Partitions) {
+		if !slices.Contains(dbnames, schema) {
+			return results, permanent(fmt.Errorf("partitions for a table of database %s, which is not dumped", schema))
+		}
+	}
+	// the main dump has all of the databases, which are only known now
+	for ext := range filesByExt {
+		filesByExt[ext][0].databases = dbnames
+	}
+	// the state of previous runs, to report the time since the last success, and to tell whether anything changed
+	var state *runState
+	stateServer := opts.Server
+	if stateServer == "" {
+		// the primary, even if dumped from a replica, which has the same data
+		stateServer = opts.DBConn.Host
+	}
+	if opts.StateFile != "" {
+		if state, err = readState(opts.StateFile); err != nil {
+			// not fatal, we just cannot report on previous runs
+			logger.Warnf("unable to read state, starting afresh: %v", err)
+		}
+		results.PreviousSuccess = map[string]time.Time{}
+	}
+	// a dump of data that has not changed since the last one is skipped; a stream, though, expects a dump
+	var current *fingerprint
+	if opts.SkipUnchanged != "" && !slices.ContainsFunc(targets, storage.IsStream) {
+		value, err := database.Fingerprint(ctx, dbconn, opts.SkipUnchanged, dbnames)
+		if err != nil {
+			// not fatal, we just dump as usual
+			logger.Warnf("unable to detect changes by %s, dumping as usual: %v", opts.SkipUnchanged, err)
+		} else {
+			current = &fingerprint{Server: stateServer, Label: opts.Label, Method: opts.SkipUnchanged, Value: value, Time: now}
+			if previous := state.findFingerprint(stateServer, opts.Label); previous != nil && previous.Method == current.Method && previous.Value == current.Value {
+				logger.Infof("no change detected by %s since the dump at %s, skipping the dump", opts.SkipUnchanged, previous.Time.Format(time.RFC3339))
+				results.Unchanged = true
+				span.SetAttributes(attribute.Bool("unchanged", true))
+				if opts.LinkUnchanged {
+					results.Uploads = linkUnchanged(ctx, targets, opts, filesByExt, previous.Files, now, timepart, server, logger)
+				}
+				return results, nil
+			}
+		}
+	}
+	// the level of each compression depends on the size of the databases, which are only known now
+	if opts.AutoCompressionLevel != nil {
+		if compressors, err = autoCompressionLevels(ctx, dbconn, dbnames, compressors, *opts.AutoCompressionLevel, logger); err != nil {
+			return results, permanent(err)
+		}
+	}
+	// shared by all of the files of the dump, including the separate tables
+	budget := newDumpBudget(opts.MaxDumpSize)
 	for _, s := range dbnames {
 		outFile := path.Join(workdir, fmt.Sprintf("%s_%s.sql", s, timepart))
-		f, err := os.Create(outFile)
+		f, err := createTmp(outFile, opts.Tmp.Private)
 		if err != nil {
 			return results, fmt.Errorf("failed to create dump file '%s': %v", outFile, err)
 		}
 		dw = append(dw, database.DumpWriter{
-			Schemas: []string{s},
-			Writer:  f,
+			Schemas:      []string{s},
+			IgnoreTables: ignoreTables[s],
+			Writer:       budget.writer(f),
 		})
 	}
+	// each separate table gets its own working directory, so that it is archived on its own
+	for i, st := range separateTables {
+		tableWorkdir, err := os.MkdirTemp(root, "databacker_cache")
+		if err != nil {
+			return results, fmt.Errorf("failed to make temporary cache directory: %v", err)
+		}
+		defer os.RemoveAll(tableWorkdir)
+		separateTables[i].workdir = tableWorkdir
+		outFile := path.Join(tableWorkdir, fmt.Sprintf("%s.%s_%s.sql", st.schema, st.table, timepart))
+		f, err := createTmp(outFile, opts.Tmp.Private)
+		if err != nil {
+			return results, fmt.Errorf("failed to create dump file '%s': %v", outFile, err)
+		}
+		dw = append(dw, database.DumpWriter{
+			Schemas: []string{st.schema},
+			Tables:  []string{st.table},
+			Writer:  budget.writer(f),
+		})
+	}
+	span.SetAttributes(attribute.StringSlice("databases", dbnames))
 	results.DumpStart = time.Now()
-	if err := database.Dump(dbconn, database.DumpOpts{
-		Compact:             compact,
-		SuppressUseDatabase: suppressUseDatabase,
-		MaxAllowedPacket:    maxAllowedPacket,
-	}, dw); err != nil {
+	dumpCtx, dumpSpan := tracing.Start(ctx, "dump.databases", attribute.StringSlice("databases", dbnames))
+	err = database.Dump(dumpCtx, dbconn, database.DumpOpts{
+		Compact:                   compact,
+		SuppressUseDatabase:       suppressUseDatabase,
+		MaxAllowedPacket:          maxAllowedPacket,
+		RowsPerInsert:             opts.RowsPerInsert,
+		SkipExtendedInsert:        opts.SkipExtendedInsert,
+		HexBlob:                   opts.HexBlob,
+		SkipSetCharset:            opts.SkipSetCharset,
+		ObjectTypes:               opts.ObjectTypes,
+		ConsistentAcrossDatabases: opts.ConsistentAcrossDatabases,
+		Where:                     opts.Where,
+		Partitions:                opts.Partitions,
+		OrderByPrimary:            opts.OrderByPrimary,
+		SkipTzUtc:                 opts.SkipTzUtc,
+	}, dw)
+	tracing.End(dumpSpan, err)
+	// a dump that is too large now is as large when retried, so is not retried; nothing has been uploaded yet, and
+	// what was written is removed with the working directories
+	if exceeded, written := budget.exceeded(); exceeded {
+		logger.Errorf("aborted the dump after writing %s, as it exceeds the maximum dump size of %s", util.FormatSize(written), util.FormatSize(opts.MaxDumpSize))
+		span.SetAttributes(attribute.Int64("dump.bytes_before_abort", written))
+		return results, permanent(fmt.Errorf("dump aborted after writing %s, exceeding the maximum dump size of %s", util.FormatSize(written), util.FormatSize(opts.MaxDumpSize)))
+	}
+	if err != nil {
 		return results, fmt.Errorf("failed to dump database: %v", err)
 	}
 	results.DumpEnd = time.Now()
 
-	// create my tar writer to archive it all together
-	// WRONG: THIS WILL CAUSE IT TO TRY TO LOOP BACK ON ITSELF
-	outFile := path.Join(tmpdir, sourceFilename)
-	f, err := os.OpenFile(outFile, os.O_CREATE|os.O_WRONLY, 0o644)
-	if err != nil {
-		return results, fmt.Errorf("failed to open output file '%s': %v", outFile, err)
+	workdirs := []string{workdir}
+	for _, st := range separateTables {
+		workdirs = append(workdirs, st.workdir)
 	}
-	defer f.Close()
-	cw, err := compressor.Compress(f)
-	if err != nil {
-		return results, fmt.Errorf("failed to create compressor: %v", err)
+	// compressing data that is compressed already, such as in blobs, takes time for nothing, so if a sample of
+	// the dump hardly compresses, it is archived without compression, for every target
+	var stored bool
+	if opts.SkipCompressionIfIncompressible && slices.ContainsFunc(compressors, func(c compression.Compressor) bool { return c.Extension() != noCompression.Extension() }) {
+		ratio, skip, err := incompressible(workdirs, logger)
+		if err != nil {
+			// not fatal, we just compress as usual
+			logger.Warnf("unable to sample the dump to check whether it compresses, compressing as usual: %v", err)
+		}
+		if ratio > 0 {
+			span.SetAttributes(attribute.Float64("compression.sample_ratio", ratio))
+		}
+		if skip {
+			stored = true
+			compressors = []compression.Compressor{noCompression}
+			if filesByExt, latestByExt, err = dumpFilenamesByExt(opts, separateTables, now, timepart, server, compressors); err != nil {
+				return results, permanent(err)
+			}
+			filesByExt[noCompression.Extension()][0].databases = dbnames
+			sourceFilename = filesByExt[noCompression.Extension()][0].source
+		}
 	}
-	if err := archive.Tar(workdir, cw); err != nil {
-		return results, fmt.Errorf("error creating the compressed archive: %v", err)
+
+	// checksum the content before it is archived, as the archive and compression add timestamps
+	var checksum string
+	if slices.ContainsFunc(targets, func(t storage.Storage) bool { return deduplicate(t, opts.SkipDuplicates) }) {
+		if checksum, err = dumpChecksum(workdir); err != nil {
+			// not fatal, we just upload as usual
+			logger.Warnf("unable to calculate dump checksum, uploading without duplicate check: %v", err)
+		}
+	}
+
+	// create my tar writer to archive it all together, in each compression at once
+	if opts.KeepSQL != "" {
+		name := "db_backup_" + timepart
+		if server != "" {
+			name += "_" + server
+		}
+		if opts.Label != "" {
+			name += "__" + opts.Label
+		}
+		// only a local convenience, so the dump itself goes on
+		if err := keepSQL(workdirs, opts.KeepSQL, name); err != nil {
+			logger.Warnf("unable to keep uncompressed copy of the dump: %v", err)
+		} else {
+			logger.Debugf("kept uncompressed copy of the dump in %s", filepath.Join(opts.KeepSQL, name))
+		}
+	}
+	for i, dir := range workdirs {
+		outputs := make([]compressedFile, 0, len(compressors))
+		for _, c := range compressors {
+			outputs = append(outputs, compressedFile{path: path.Join(tmpdir, filesByExt[c.Extension()][i].source), compressor: c})
+		}
+		if err := compressWorkdir(ctx, dir, outputs, opts.Tmp.Private); err != nil {
+			return results, err
+		}
 	}
-	// we need to close it explicitly before moving ahead
-	f.Close()
 
 	// execute post-backup scripts if any
-	if err := postBackup(timepart, path.Join(tmpdir, sourceFilename), tmpdir, opts.PostBackupScripts, logger.Level == log.DebugLevel); err != nil {
+	if err := postBackup(ctx, opts.Run.String(), timepart, path.Join(tmpdir, sourceFilename), tmpdir, opts.PostBackupScripts, opts.ScriptsExec, logger.Level == log.DebugLevel); err != nil {
 		return results, fmt.Errorf("error running pre-restore: %v", err)
 	}
 
 	// upload to each destination
-	for _, t := range targets {
+	for ext, files := range filesByExt {
+		files[0].checksum = checksum
+		// after post-processing, so they describe the files as uploaded; only for reporting, so not fatal
+		for i := range files {
+			if files[i].size, files[i].sha256, err = fileSHA256(filepath.Join(tmpdir, files[i].source)); err != nil {
+				logger.Warnf("unable to calculate checksum of %s: %v", files[i].source, err)
+			}
+		}
+		filesByExt[ext] = files
+	}
+	// upload the dump to the target t, which gets the files of the compression ext, the i-th of them being file
+	uploadTo := func(ctx context.Context, t storage.Storage, ext string, i int, file uploadFile, latestFilename string) (err error) {
 		uploadResult := UploadResult{Target: t.URL(), Start: time.Now()}
-		targetCleanFilename := t.Clean(targetFilename)
-		logger.Debugf("uploading via protocol %s from %s to %s", t.Protocol(), sourceFilename, targetCleanFilename)
-		copied, err := t.Push(targetCleanFilename, filepath.Join(tmpdir, sourceFilename), logger)
+		info := upload.Info{Time: now, Server: server, Label: opts.Label, Databases: file.databases}
+		targetCleanFilename, err := targetPath(t, file.target, info)
 		if err != nil {
-			return results, fmt.Errorf("failed to push file: %v", err)
+			return err
+		}
+		logger.Debugf("uploading via protocol %s from %s to %s", t.Protocol(), file.source, targetCleanFilename)
+		var copied int64
+		ctx, span := tracing.Start(ctx, "upload", attribute.String("target.type", t.Protocol()), attribute.String("target.url", tracing.RedactURL(t.URL())),
+			attribute.String("filename", targetCleanFilename), attribute.Int64("bytes", file.size), attribute.StringSlice("databases", file.databases))
+		defer func() { tracing.End(span, err) }()
+		// tell the target what it is storing, for targets that label it
+		ctx = upload.NewContext(ctx, info)
+		if file.checksum != "" && deduplicate(t, opts.SkipDuplicates) {
+			uploadResult.DuplicateOf, copied, err = uploadDeduplicated(ctx, t, targetCleanFilename, filepath.Join(tmpdir, file.source), file.checksum, ext, tmpdir, logger)
+			if err != nil {
+				return err
+			}
+			if uploadResult.DuplicateOf != "" {
+				span.SetAttributes(attribute.String("duplicate_of", uploadResult.DuplicateOf))
+			}
+		} else if copied, err = t.Push(ctx, targetCleanFilename, filepath.Join(tmpdir, file.source), logger); err != nil {
+			return fmt.Errorf("failed to push file: %v", err)
 		}
 		logger.Debugf("completed copying %d bytes", copied)
+		if verifyUploads(t, opts) {
+			if file.sha256 == "" {
+				// the local file could not be read to checksum it, so there is nothing to compare with
+				logger.Warnf("unable to verify upload of %s to %s, as the dump has no checksum", targetCleanFilename, t.URL())
+			} else if err := verifyUpload(ctx, t, targetCleanFilename, file.size, file.sha256, logger); err != nil {
+				return err
+			}
+		}
 		uploadResult.Filename = targetCleanFilename
+		uploadResult.Size, uploadResult.SHA256 = file.size, file.sha256
 		uploadResult.End = time.Now()
 		results.Uploads = append(results.Uploads, uploadResult)
+		// only the main dump has the alias, and only where it is kept; the dump itself succeeded, so it is not fatal
+		if i == 0 && latestFilename != "" && !storage.IsStream(t) {
+			if err := updateLatest(ctx, t, t.Clean(latestFilename), uploadResult, filepath.Join(tmpdir, file.source), logger); err != nil {
+				logger.Warnf("unable to update %s on target %s: %v", latestFilename, t.URL(), err)
+			}
+		}
+		return nil
+	}
+	// each target that times out fails on its own, after the dump is uploaded to the others
+	var timedOut []error
+	for _, t := range targets {
+		ext := targetCompressor(t, opts).Extension()
+		if stored {
+			ext = noCompression.Extension()
+		}
+		files, latestFilename := filesByExt[ext], latestByExt[ext]
+		if files, err = targetFiles(t, opts, files, separateTables, now, timepart, server, ext); err != nil {
+			return results, permanent(err)
+		}
+		timeouts := opts.TargetTimeouts[t.URL()]
+		targetCtx := upload.WithConnectTimeout(ctx, timeouts.Connect)
+		var targetErr error
+		for i, file := range files {
+			fileCtx, cancel := targetCtx, context.CancelFunc(func() {})
+			if timeouts.Upload > 0 {
+				fileCtx, cancel = context.WithTimeout(targetCtx, timeouts.Upload)
+			}
+			err := uploadTo(fileCtx, t, ext, i, file, latestFilename)
+			cancel()
+			if err == nil {
+				continue
+			}
+			if timeouts == (TargetTimeouts{}) || !targetTimedOut(ctx, fileCtx, err) {
+				return results, err
+			}
+			logger.Errorf("upload of %s to %s timed out, continuing with the other targets: %v", file.target, t.URL(), err)
+			targetErr = fmt.Errorf("target %s: %v", t.URL(), err)
+			break
+		}
+		if targetErr != nil {
+			timedOut = append(timedOut, targetErr)
+			continue
+		}
+		if state != nil {
+			if previous := state.find(t.URL(), stateServer); previous != nil {
+				results.PreviousSuccess[t.URL()] = previous.Time
+				logger.Infof("previous successful dump to %s was %s ago", t.URL(), time.Since(previous.Time).Round(time.Second))
+			}
+			state.set(t.URL(), stateServer, time.Now())
+			if err := writeState(opts.StateFile, state); err != nil {
+				logger.Warnf("unable to record successful dump in state file: %v", err)
+			}
+		}
+		if current != nil {
+			// the main dump is the first uploaded to each target, or the one it duplicates
+			if i := slices.IndexFunc(results.Uploads, func(u UploadResult) bool { return u.Target == t.URL() }); i >= 0 {
+				if current.Files == nil {
+					current.Files = map[string]string{}
+				}
+				current.Files[t.URL()] = results.Uploads[i].Filename
+				if results.Uploads[i].DuplicateOf != "" {
+					current.Files[t.URL()] = results.Uploads[i].DuplicateOf
+				}
+			}
+		}
+	}
+	if len(timedOut) > 0 {
+		return results, fmt.Errorf("upload timed out to %d of %d targets: %v", len(timedOut), len(targets), errors.Join(timedOut...))
+	}
+	// only once the dump is on every target, so that the next one is not skipped for a dump that is missing
+	if current != nil && state != nil {
+		state.setFingerprint(*current)
+		if err := writeState(opts.StateFile, state); err != nil {
+			logger.Warnf("unable to record fingerprint of the dump in state file: %v", err)
+		}
 	}
 
 	return results, nil
 }
 
+// targetPath the name of the file name on the target t, in the folder of the dump in info, for targets that keep
+// each dump in a folder of its own, e.g. by date
+func targetPath(t storage.Storage, name string, info upload.Info) (string, error) {
+	name = t.Clean(name)
+	if p, ok := t.(storage.Partitioner); ok {
+		folder, err := p.Partition(info)
+		if err != nil {
+			return "", fmt.Errorf("failed to get folder for %s on target %s: %v", name, t.URL(), err)
+		}
+		if folder != "" {
+			name = path.Join(folder, name)
+		}
+	}
+	return name, nil
+}
+
+// linkUnchanged point the name the main dump would have had on each target at the previous dump there, in
+// previous by target URL, as the dump is skipped as unchanged, for targets that can link. Only for convenience,
+// so failures are only logged. Returns the links made.
+func linkUnchanged(ctx context.Context, targets []storage.Storage, opts DumpOptions, filesByExt map[string][]uploadFile, previous map[string]string, now time.Time, timepart, server string, logger *log.Entry) []UploadResult {
+	var links []UploadResult
+	for _, t := range targets {
+		existing := previous[t.URL()]
+		linker, ok := t.(storage.Linker)
+		if existing == "" || !ok {
+			logger.Debugf("no link to the previous dump on target %s", t.URL())
+			continue
+		}
+		ext := targetCompressor(t, opts).Extension()
+		// only the main dump, so without the separate tables
+		files, err := targetFiles(t, opts, filesByExt[ext][:1], nil, now, timepart, server, ext)
+		if err != nil {
+			logger.Warnf("unable to link to the previous dump %s on target %s: %v", existing, t.URL(), err)
+			continue
+		}
+		file := files[0]
+		start := time.Now()
+		name, err := targetPath(t, file.target, upload.Info{Time: now, Server: server, Label: opts.Label, Databases: file.databases})
+		if err == nil {
+			err = linker.Link(ctx, name, existing, logger)
+		}
+		if err != nil {
+			logger.Warnf("unable to link to the previous dump %s on target %s: %v", existing, t.URL(), err)
+			continue
+		}
+		logger.Debugf("linked %s to the previous dump %s on target %s", name, existing, t.URL())
+		links = append(links, UploadResult{Target: t.URL(), Filename: name, DuplicateOf: existing, Start: start, End: time.Now()})
+	}
+	return links
+}
+
+// targetTimedOut whether the upload to a target failed with err as the target took too long, to connect or to
+// upload, with uploadCtx, rather than the dump being cancelled with ctx
+func targetTimedOut(ctx, uploadCtx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(uploadCtx.Err(), context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// compressWorkdir archive and compress workdir into each of the outputs, in a span of its own
+func compressWorkdir(ctx context.Context, workdir string, outputs []compressedFile, private bool) (err error) {
+	exts := make([]string, 0, len(outputs))
+	for _, out := range outputs {
+		exts = append(exts, out.compressor.Extension())
+	}
+	_, span := tracing.Start(ctx, "dump.compress", attribute.StringSlice("compression", exts))
+	defer func() { tracing.End(span, err) }()
+	if err := archiveAndCompress(workdir, outputs, private); err != nil {
+		return err
+	}
+	// the size in the default compression, which is first
+	if info, err := os.Stat(outputs[0].path); err == nil {
+		span.SetAttributes(attribute.Int64("bytes", info.Size()))
+	}
+	return nil
+}
+
+// compressedFile an output file of an archive, and its compression
+type compressedFile struct {
+	path       string
+	compressor compression.Compressor
+}
+
+// archiveAndCompress tar up all of the files in workdir and compress them into each of the outputs. The
+// archive is only created once, and the stream is split to each compressor. If private, the outputs are
+// readable only by the user.
+func archiveAndCompress(workdir string, outputs []compressedFile, private bool) error {
+	var mode os.FileMode = 0o644
+	if private {
+		mode = 0o600
+	}
+	tee := &teeCompressor{}
+	// archive.Tar closes the writer when done, but not if it fails before starting
+	defer tee.Close()
+	for _, out := range outputs {
+		f, err := os.OpenFile(out.path, os.O_CREATE|os.O_WRONLY, mode)
+		if err != nil {
+			return fmt.Errorf("failed to open output file '%s': %v", out.path, err)
+		}
+		tee.files = append(tee.files, f)
+		cw, err := out.compressor.Compress(f)
+		if err != nil {
+			return fmt.Errorf("failed to create compressor: %v", err)
+		}
+		tee.compressors = append(tee.compressors, cw)
+	}
+	if err := archive.Tar(workdir, tee); err != nil {
+		return fmt.Errorf("error creating the compressed archive: %v", err)
+	}
+	// we need to close it explicitly before moving ahead
+	return tee.Close()
+}
+
+// teeCompressor writes to each of its compressors, and on close, closes each compressor, followed by
+// the file to which it writes
+type teeCompressor struct {
+	compressors []io.WriteCloser
+	files       []*os.File
+	closed      bool
+	closeErr    error
+}
+
+func (t *teeCompressor) Write(p []byte) (int, error) {
+	for _, c := range t.compressors {
+		if _, err := c.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close close everything, once; later calls return the result of the first
+func (t *teeCompressor) Close() error {
+	if t.closed {
+		return t.closeErr
+	}
+	t.closed = true
+	for _, c := range t.compressors {
+		if err := c.Close(); err != nil && t.closeErr == nil {
+			t.closeErr = fmt.Errorf("failed to finish compression: %v", err)
+		}
+	}
+	for _, f := range t.files {
+		if err := f.Close(); err != nil && t.closeErr == nil {
+			t.closeErr = fmt.Errorf("failed to close output file: %v", err)
+		}
+	}
+	return t.closeErr
+}
+
+type uploadFile struct {
+	source string
+	target string
+	// checksum of the dump content, if checking for duplicates
+	checksum string
+	// databases in the file
+	databases []string
+	// size and sha256 of the file itself, as uploaded
+	size   int64
+	sha256 string
+}
+
+// fileSHA256 the size and hex-encoded SHA-256 checksum of the file
+func fileSHA256(filename string) (int64, string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type separateTable struct {
+	schema  string
+	table   string
+	workdir string
+}
+
+// targetCompressor the compression for the target, which can override the default compression
+func targetCompressor(t storage.Storage, opts DumpOptions) compression.Compressor {
+	if c, ok := opts.TargetCompressors[t.URL()]; ok && c != nil {
+		return c
+	}
+	return opts.Compressor
+}
+
+// targetFiles the files of the dump in the compression ext, files, as named on the target t: by its own filename
+// pattern, if it has one, and otherwise as they are
+func targetFiles(t storage.Storage, opts DumpOptions, files []uploadFile, separateTables []separateTable, now time.Time, timepart, server, ext string) ([]uploadFile, error) {
+	pattern := opts.TargetFilenamePatterns[t.URL()]
+	if pattern == "" {
+		return files, nil
+	}
+	opts.FilenamePattern = pattern
+	named, _, err := dumpFilenames(opts, separateTables, now, timepart, server, ext)
+	if err != nil {
+		return nil, fmt.Errorf("target %s: %v", t.URL(), err)
+	}
+	renamed := slices.Clone(files)
+	for i := range renamed {
+		renamed[i].target = named[i].target
+	}
+	return renamed, nil
+}
+
+// dumpFilenamesByExt the files of the dump in each of the compressors, by extension, as for dumpFilenames, along with
+// the name of the latest alias in each
+func dumpFilenamesByExt(opts DumpOptions, separateTables []separateTable, now time.Time, timepart, server string, compressors []compression.Compressor) (map[string][]uploadFile, map[string]string, error) {
+	filesByExt := map[string][]uploadFile{}
+	latestByExt := map[string]string{}
+	for _, c := range compressors {
+		files, latest, err := dumpFilenames(opts, separateTables, now, timepart, server, c.Extension())
+		if err != nil {
+			return nil, nil, err
+		}
+		filesByExt[c.Extension()] = files
+		latestByExt[c.Extension()] = latest
+	}
+	return filesByExt, latestByExt, nil
+}
+
+// incompressible whether the dump in workdirs compresses so little that it is not worth compressing, from a sample
+// of it, along with the ratio to which the sample compresses; 0 if there was nothing to sample
+func incompressible(workdirs []string, logger *log.Entry) (float64, bool, error) {
+	var paths []string
+	for _, dir := range workdirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to list dump files: %v", err)
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				paths = append(paths, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	ratio, sampled, err := compression.SampleRatio(paths)
+	if err != nil || sampled == 0 {
+		return 0, false, err
+	}
+	if ratio > compression.DefaultIncompressibleRatio {
+		logger.Infof("sample of %s of the dump compresses to %.0f%% of its size, more than %.0f%%, so not compressing it", util.FormatSize(sampled), ratio*100, compression.DefaultIncompressibleRatio*100)
+		return ratio, true, nil
+	}
+	logger.Infof("sample of %s of the dump compresses to %.0f%% of its size, so compressing it", util.FormatSize(sampled), ratio*100)
+	return ratio, false, nil
+}
+
+// dumpFilenames the files of the dump for the compression with extension ext: the main dump first, followed by
+// each of the separate tables, along with the name of the latest alias, if any
+func dumpFilenames(opts DumpOptions, separateTables []separateTable, now time.Time, timepart, server, ext string) ([]uploadFile, string, error) {
+	filenamePattern := opts.FilenamePattern
+	// sourceFilename: file that the uploader looks for when performing the upload
+	// targetFilename: the remote file that is actually uploaded
+	sourceFilename := fmt.Sprintf("db_backup_%s.%s", timepart, ext)
+	mainVars := filenameVars{server: server, label: opts.Label}
+	// pattern: the pattern of the main dump, which falls back to the defaults below
+	pattern := filenamePattern
+	targetFilename, err := processFilenamePattern(pattern, now, timepart, ext, mainVars)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to process filename pattern: %v", err)
+	}
+	// if the pattern does not distinguish servers, fall back to the default that does
+	if server != "" {
+		withoutServer, err := processFilenamePattern(pattern, now, timepart, ext, filenameVars{label: opts.Label})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to process filename pattern: %v", err)
+		}
+		if withoutServer == targetFilename {
+			pattern = DefaultServerFilenamePattern
+			if targetFilename, err = processFilenamePattern(pattern, now, timepart, ext, mainVars); err != nil {
+				return nil, "", fmt.Errorf("failed to process filename pattern: %v", err)
+			}
+		}
+	}
+	// likewise for the label, which must be in the filename for prune and restore to find the dumps with it
+	if opts.Label != "" {
+		withoutLabel, err := processFilenamePattern(pattern, now, timepart, ext, filenameVars{server: server})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to process filename pattern: %v", err)
+		}
+		if withoutLabel == targetFilename {
+			if targetFilename, err = processFilenamePattern(DefaultLabelFilenamePattern, now, timepart, ext, mainVars); err != nil {
+				return nil, "", fmt.Errorf("failed to process filename pattern: %v", err)
+			}
+		}
+	}
+	files := []uploadFile{{source: sourceFilename, target: targetFilename}}
+
+	for _, st := range separateTables {
+		sourceName := fmt.Sprintf("db_backup_%s_%s.%s.%s", timepart, st.schema, st.table, ext)
+		vars := filenameVars{server: server, label: opts.Label, database: st.schema, table: st.table}
+		targetName, err := processFilenamePattern(filenamePattern, now, timepart, ext, vars)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to process filename pattern: %v", err)
+		}
+		withoutTable, err := processFilenamePattern(filenamePattern, now, timepart, ext, filenameVars{server: server, label: opts.Label})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to process filename pattern: %v", err)
+		}
+		// if the pattern does not distinguish tables, fall back to the default that does
+		if targetName == withoutTable || targetName == targetFilename {
+			if targetName, err = processFilenamePattern(DefaultSeparateTableFilenamePattern, now, timepart, ext, vars); err != nil {
+				return nil, "", fmt.Errorf("failed to process filename pattern: %v", err)
+			}
+		}
+		files = append(files, uploadFile{source: sourceName, target: targetName, databases: []string{st.schema}})
+	}
+
+	// the alias that always refers to the latest dump, if any
+	var latestFilename string
+	if opts.Latest != "" {
+		if latestFilename, err = processFilenamePattern(opts.Latest, now, timepart, ext, mainVars); err != nil {
+			return nil, "", fmt.Errorf("failed to process latest pattern: %v", err)
+		}
+	}
+	return files, latestFilename, nil
+}
+
+// autoCompressionLevels each of the compressors at the level for the estimated size of a dump of the databases.
+// If the size cannot be estimated, they compress at their default levels.
+func autoCompressionLevels(ctx context.Context, dbconn database.Connection, dbnames []string, compressors []compression.Compressor, auto compression.AutoLevel, logger *log.Entry) ([]compression.Compressor, error) {
+	size, err := database.EstimateSize(ctx, dbconn, dbnames)
+	if err != nil {
+		logger.Warnf("unable to estimate dump size, compressing at the default level: %v", err)
+		return compressors, nil
+	}
+	leveled := make([]compression.Compressor, 0, len(compressors))
+	for _, c := range compressors {
+		level := auto.Level(c, size)
+		lc, err := compression.WithLevel(c, level)
+		if err != nil {
+			return nil, err
+		}
+		if level != 0 {
+			logger.Infof("compressing %s at level %d, for estimated dump size %s", c.Extension(), level, util.FormatSize(size))
+		}
+		leveled = append(leveled, lc)
+	}
+	return leveled, nil
+}
+
+// parseSeparateTables parse a list of tables in the format "<database>.<table>"
+func parseSeparateTables(tables []string) ([]separateTable, error) {
+	var separate []separateTable
+	for _, t := range tables {
+		parts := strings.SplitN(t, ".", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid separate table %q, must be in the format <database>.<table>", t)
+		}
+		separate = append(separate, separateTable{schema: parts[0], table: parts[1]})
+	}
+	return separate, nil
+}
+
 // run pre-backup scripts, if they exist
-func preBackup(timestamp, dumpfile, dumpdir, preBackupDir string, debug bool) error {
+func preBackup(ctx context.Context, run, timestamp, dumpfile, dumpdir, preBackupDir string, wrapper []string, debug bool) error {
 	// construct any additional environment
 	env := map[string]string{
 		"NOW":           timestamp,
 		"DUMPFILE":      dumpfile,
 		"DUMPDIR":       dumpdir,
 		"DB_DUMP_DEBUG": fmt.Sprintf("%v", debug),
+		"RUN_ID":        run,
 	}
-	return runScripts(preBackupDir, env)
+	ctx, span := tracing.Start(ctx, "dump.pre-backup", attribute.String("scripts", preBackupDir))
+	err := runScripts(ctx, preBackupDir, env, wrapper)
+	tracing.End(span, err)
+	return err
 }
 
-func postBackup(timestamp, dumpfile, dumpdir, postBackupDir string, debug bool) error {
+func postBackup(ctx context.Context, run, timestamp, dumpfile, dumpdir, postBackupDir string, wrapper []string, debug bool) error {
 	// construct any additional environment
 	env := map[string]string{
 		"NOW":           timestamp,
 		"DUMPFILE":      dumpfile,
 		"DUMPDIR":       dumpdir,
 		"DB_DUMP_DEBUG": fmt.Sprintf("%v", debug),
+		"RUN_ID":        run,
 	}
-	return runScripts(postBackupDir, env)
+	// the scripts, which may e.g. encrypt the dump, get a span of their own
+	ctx, span := tracing.Start(ctx, "dump.post-backup", attribute.String("scripts", postBackupDir))
+	err := runScripts(ctx, postBackupDir, env, wrapper)
+	tracing.End(span, err)
+	return err
 }
 
 // ProcessFilenamePattern takes a template pattern and processes it with the current time.
 // Passes the timestamp as a string, because it sometimes gets changed for safechars.
 func ProcessFilenamePattern(pattern string, now time.Time, timestamp, ext string) (string, error) {
+	return processFilenamePattern(pattern, now, timestamp, ext, filenameVars{})
+}
+
+// ValidateFilenamePattern check that the filename pattern is a valid template, which gives a dump a filename
+func ValidateFilenamePattern(pattern string) error {
+	name, err := ProcessFilenamePattern(pattern, time.Now(), "2006-01-02T15:04:05Z", "tgz")
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("filename pattern %q gives an empty filename", pattern)
+	}
+	return nil
+}
+
+// filenameVars values available to a filename pattern in addition to the time and compression
+type filenameVars struct {
+	// server the name of the server, when dumping multiple servers
+	server string
+	// label the label of the dump, if any
+	label string
+	// database and table for dumps of individual tables
+	database string
+	table    string
+}
+
+// processFilenamePattern same as ProcessFilenamePattern, but also makes the server, label, database and table
+// available to the pattern.
+func processFilenamePattern(pattern string, now time.Time, timestamp, ext string, vars filenameVars) (string, error) {
 	if pattern == "" {
 		pattern = DefaultFilenamePattern
 	}
@@ -181,6 +987,10 @@ func ProcessFilenamePattern(pattern string, now time.Time, timestamp, ext string
 		"minute":      now.Format("04"),
 		"second":      now.Format("05"),
 		"compression": ext,
+		"server":      vars.server,
+		"label":       vars.label,
+		"database":    vars.database,
+		"table":       vars.table,
 	}); err != nil {
 		return "", fmt.Errorf("failed to execute filename pattern: %v", err)
 	}
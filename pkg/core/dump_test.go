@@ -0,0 +1,190 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/databacker/mysql-backup/pkg/archive"
+	"github.com/databacker/mysql-backup/pkg/compression"
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveAndCompress(t *testing.T) {
+	workdir, tmpdir := t.TempDir(), t.TempDir()
+	content := "CREATE TABLE t1 (id int);\n"
+	require.NoError(t, os.WriteFile(filepath.Join(workdir, "db1.sql"), []byte(content), 0o644))
+
+	// the same archive in every compression
+	compressors := []compression.Compressor{&compression.GzipCompressor{}, &compression.Bzip2Compressor{}, &compression.NoneCompressor{}}
+	var outputs []compressedFile
+	for _, c := range compressors {
+		outputs = append(outputs, compressedFile{path: filepath.Join(tmpdir, "dump."+c.Extension()), compressor: c})
+	}
+	require.NoError(t, archiveAndCompress(workdir, outputs, false))
+
+	for _, out := range outputs {
+		t.Run(out.compressor.Extension(), func(t *testing.T) {
+			f, err := os.Open(out.path)
+			require.NoError(t, err)
+			defer f.Close()
+			r, err := out.compressor.Uncompress(f)
+			require.NoError(t, err)
+			dir := t.TempDir()
+			require.NoError(t, archive.Untar(r, dir))
+			b, err := os.ReadFile(filepath.Join(dir, "db1.sql"))
+			require.NoError(t, err)
+			assert.Equal(t, content, string(b))
+		})
+	}
+}
+
+func TestDumpFilenames(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC)
+	timepart := now.Format(time.RFC3339)
+	tests := []struct {
+		name     string
+		opts     DumpOptions
+		server   string
+		expected string
+		// table the name of the separate table app.events
+		table string
+	}{
+		{"default", DumpOptions{}, "", "db_backup_2021-01-01T00:30:00Z.tgz", "db_backup_2021-01-01T00:30:00Z_app.events.tgz"},
+		{"server", DumpOptions{}, "db1", "db_backup_2021-01-01T00:30:00Z_db1.tgz", "db_backup_2021-01-01T00:30:00Z_db1_app.events.tgz"},
+		{"label", DumpOptions{Label: "pre-deploy"}, "", "db_backup_2021-01-01T00:30:00Z__pre-deploy.tgz", "db_backup_2021-01-01T00:30:00Z_app.events__pre-deploy.tgz"},
+		{"server and label", DumpOptions{Label: "pre-deploy"}, "db1", "db_backup_2021-01-01T00:30:00Z_db1__pre-deploy.tgz", "db_backup_2021-01-01T00:30:00Z_db1_app.events__pre-deploy.tgz"},
+		{"pattern with label", DumpOptions{Label: "nightly", FilenamePattern: "{{ .label }}/{{ .year }}.{{ .compression }}"}, "", "nightly/2021.tgz", "db_backup_2021-01-01T00:30:00Z_app.events__nightly.tgz"},
+		{"pattern without label", DumpOptions{Label: "nightly", FilenamePattern: "{{ .year }}.{{ .compression }}"}, "", "db_backup_2021-01-01T00:30:00Z__nightly.tgz", "db_backup_2021-01-01T00:30:00Z_app.events__nightly.tgz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, _, err := dumpFilenames(tt.opts, []separateTable{{schema: "app", table: "events"}}, now, timepart, tt.server, "tgz")
+			require.NoError(t, err)
+			require.Len(t, files, 2)
+			assert.Equal(t, tt.expected, files[0].target)
+			assert.Equal(t, tt.table, files[1].target)
+			// prune must recognize the default names, and the label of the separate table
+			table, ok := parseBackupFilename(files[1].target)
+			require.True(t, ok)
+			assert.Equal(t, tt.opts.Label, table.label)
+			if tt.opts.FilenamePattern == "" {
+				matches := filenameRE.FindStringSubmatch(files[0].target)
+				require.NotNil(t, matches)
+				assert.Equal(t, tt.server, matches[7])
+				assert.Equal(t, tt.opts.Label, matches[8])
+			}
+		})
+	}
+}
+
+func TestTargetFiles(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC)
+	timepart := now.Format(time.RFC3339)
+	dated := file.New(url.URL{Scheme: "file", Path: "/dated"})
+	flat := file.New(url.URL{Scheme: "file", Path: "/flat"})
+	opts := DumpOptions{TargetFilenamePatterns: map[string]string{dated.URL(): "{{ .year }}/{{ .month }}/db_{{ .now }}.{{ .compression }}"}}
+	separateTables := []separateTable{{schema: "app", table: "events"}}
+	files, _, err := dumpFilenames(opts, separateTables, now, timepart, "", "tgz")
+	require.NoError(t, err)
+	files[0].databases = []string{"app"}
+
+	// a target without a pattern of its own gets the files as they are
+	named, err := targetFiles(flat, opts, files, separateTables, now, timepart, "", "tgz")
+	require.NoError(t, err)
+	assert.Equal(t, files, named)
+
+	named, err = targetFiles(dated, opts, files, separateTables, now, timepart, "", "tgz")
+	require.NoError(t, err)
+	assert.Equal(t, []uploadFile{
+		{source: files[0].source, target: "2021/01/db_2021-01-01T00:30:00Z.tgz", databases: []string{"app"}},
+		// the pattern does not distinguish the table, so it falls back to the default that does
+		{source: files[1].source, target: "db_backup_2021-01-01T00:30:00Z_app.events.tgz", databases: []string{"app"}},
+	}, named)
+	// the files themselves are left as they are, for the other targets
+	assert.Equal(t, "db_backup_2021-01-01T00:30:00Z.tgz", files[0].target)
+
+	opts.TargetFilenamePatterns[dated.URL()] = "{{ .now"
+	_, err = targetFiles(dated, opts, files, separateTables, now, timepart, "", "tgz")
+	assert.Error(t, err)
+}
+
+func TestTargetTimedOut(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		uploadCtx context.Context
+		err       error
+		timedOut  bool
+	}{
+		{"upload deadline", context.Background(), expired, errors.New("failed to push file: context deadline exceeded"), true},
+		{"connect timeout", context.Background(), context.Background(), &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, true},
+		{"other error", context.Background(), context.Background(), errors.New("access denied"), false},
+		{"dump cancelled", cancelled, cancelled, context.Canceled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.timedOut, targetTimedOut(tt.ctx, tt.uploadCtx, tt.err))
+		})
+	}
+}
+
+func TestIncompressible(t *testing.T) {
+	logger := log.NewEntry(log.New())
+	text, random, empty := t.TempDir(), t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(text, "db1.sql"), bytes.Repeat([]byte("INSERT INTO `t1` VALUES (1,'abc');\n"), 10000), 0o644))
+	blobs := make([]byte, 1<<20)
+	_, _ = rand.Read(blobs)
+	require.NoError(t, os.WriteFile(filepath.Join(random, "db1.sql"), blobs, 0o644))
+
+	ratio, skip, err := incompressible([]string{text}, logger)
+	require.NoError(t, err)
+	assert.False(t, skip)
+	assert.Less(t, ratio, compression.DefaultIncompressibleRatio)
+
+	ratio, skip, err = incompressible([]string{random}, logger)
+	require.NoError(t, err)
+	assert.True(t, skip)
+	assert.Greater(t, ratio, compression.DefaultIncompressibleRatio)
+
+	ratio, skip, err = incompressible([]string{empty}, logger)
+	require.NoError(t, err)
+	assert.False(t, skip)
+	assert.Zero(t, ratio)
+}
+
+func TestLinkUnchanged(t *testing.T) {
+	targetDir := t.TempDir()
+	target := file.New(url.URL{Scheme: "file", Path: targetDir})
+	other := file.New(url.URL{Scheme: "file", Path: t.TempDir()})
+	logger := log.NewEntry(log.New())
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "db_backup_1.tgz"), []byte("dump"), 0o644))
+
+	opts := DumpOptions{Compressor: &compression.GzipCompressor{}}
+	filesByExt := map[string][]uploadFile{"tgz": {{source: "db_backup_2.tgz", target: "db_backup_2.tgz"}}}
+	// the other target has no previous dump to link to
+	links := linkUnchanged(context.Background(), []storage.Storage{target, other}, opts, filesByExt, map[string]string{target.URL(): "db_backup_1.tgz"}, time.Now(), "2024-01-01T02:00:00Z", "", logger)
+	if assert.Len(t, links, 1) {
+		assert.Equal(t, target.URL(), links[0].Target)
+		assert.Equal(t, "db_backup_2.tgz", links[0].Filename)
+		assert.Equal(t, "db_backup_1.tgz", links[0].DuplicateOf)
+	}
+	b, err := os.ReadFile(filepath.Join(targetDir, "db_backup_2.tgz"))
+	require.NoError(t, err)
+	assert.Equal(t, "dump", string(b))
+}
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"time"
+
 	"github.com/databacker/mysql-backup/pkg/compression"
 	"github.com/databacker/mysql-backup/pkg/database"
 	"github.com/databacker/mysql-backup/pkg/storage"
@@ -8,17 +10,132 @@ import (
 )
 
 type DumpOptions struct {
-	Targets             []storage.Storage
-	Safechars           bool
-	DBNames             []string
-	DBConn              database.Connection
-	Compressor          compression.Compressor
-	Exclude             []string
-	PreBackupScripts    string
-	PostBackupScripts   string
+	Targets           []storage.Storage
+	Safechars         bool
+	DBNames           []string
+	DBConn            database.Connection
+	Compressor        compression.Compressor
+	Exclude           []string
+	PreBackupScripts  string
+	PostBackupScripts string
+	// ScriptsExec the command, with its arguments, that runs each of the pre- and post-backup scripts, e.g. docker
+	// exec -i db sh -s to run them in the database container, rather than run them directly; the script is on its
+	// stdin, after an export of each of the environment variables of the scripts
+	ScriptsExec         []string
 	Compact             bool
 	SuppressUseDatabase bool
 	MaxAllowedPacket    int
 	Run                 uuid.UUID
 	FilenamePattern     string
+	// SeparateTables tables, in the format <database>.<table>, to dump to their own files
+	SeparateTables []string
+	// Server name of the server, to distinguish its dumps from those of other servers when dumping
+	// more than one; available to the filename pattern as {{ .server }}
+	Server string
+	// SkipDuplicates do not upload a dump if the target already has one with identical content
+	SkipDuplicates bool
+	// IncludeSystemDatabases when DBNames is empty, dump the system databases information_schema,
+	// performance_schema, sys and mysql along with all the others
+	IncludeSystemDatabases bool
+	// StateFile local file in which to record each successful dump to each target, so that the next run can
+	// report how long it has been since; empty to not record
+	StateFile string
+	// Latest filename pattern of an alias, e.g. latest.{{ .compression }}, to point at the most recent dump on each
+	// target after it is uploaded; empty for no alias
+	Latest string
+	// TargetCompressors compression for each target, by its URL, that overrides Compressor. Each distinct
+	// compression compresses the dump once more.
+	TargetCompressors map[string]compression.Compressor
+	// TargetFilenamePatterns filename pattern for each target, by its URL, that overrides FilenamePattern, e.g.
+	// to keep the dumps in folders by date on one target, and flat on another
+	TargetFilenamePatterns map[string]string
+	// CompressionDictionary path to a zstd dictionary with which to compress, when the compression is zstd;
+	// empty for none
+	CompressionDictionary string
+	// HexBlob dump binary columns as hex literals, like mysqldump --hex-blob, so they restore byte for byte
+	// whatever the character sets
+	HexBlob bool
+	// ObjectTypes the types of object to dump in each database, of database.ObjectTables and
+	// database.ObjectViews; all if empty
+	ObjectTypes []string
+	// KeepSQL local directory in which to keep an uncompressed copy of the SQL files of each dump, in a
+	// directory of their own, as well as uploading it compressed; empty to not keep one
+	KeepSQL string
+	// MaxDumpSize the most bytes that the uncompressed SQL files of the dump may take together; a dump that grows
+	// beyond it is aborted as it is written, before anything is uploaded. 0 for no limit.
+	MaxDumpSize int64
+	// ConsistentAcrossDatabases dump all of the databases, and the separate tables, in a single transaction, so
+	// that they are consistent with each other, and not only each within itself
+	ConsistentAcrossDatabases bool
+	// VerifyUpload read back each upload to every target, and fail if it is not the same size, or, where the
+	// target has a checksum, content, as the local file
+	VerifyUpload bool
+	// TargetVerifyUploads targets, by URL, to read back uploads to, as with VerifyUpload, but only for those
+	TargetVerifyUploads map[string]bool
+	// RowsPerInsert the most rows in each INSERT statement, to tune restores of very wide or narrow tables; 0
+	// for as many as fit in MaxAllowedPacket
+	RowsPerInsert int
+	// SkipExtendedInsert one row per INSERT statement, for the most compatible, but slowest, restore
+	SkipExtendedInsert bool
+	// Where WHERE clauses, by table in the format "<database>.<table>", to dump only some of the rows of those
+	// tables, e.g. only the recent ones; the databases must be dumped
+	Where map[string]string
+	// Tmp where and how to create the temporary files of the dump
+	Tmp TmpOptions
+	// CompressionThreads how many goroutines compress the dump at once, for gzip and zstd; 0 for the default
+	// of the compression, which is one for gzip
+	CompressionThreads int
+	// Label names the kind of dump, e.g. nightly or pre-deploy, so that dumps of each kind can be told apart and
+	// pruned with their own retention; part of the filename, and available to patterns as {{ .label }}
+	Label string
+	// CompressionLevel the level at which to compress, in the scale of each compression in use; 0 for the default
+	// of the compression. Ignored if AutoCompressionLevel is set.
+	CompressionLevel int
+	// AutoCompressionLevel choose the level of each compression by the estimated size of the databases, from
+	// information_schema, rather than CompressionLevel; nil to not choose
+	AutoCompressionLevel *compression.AutoLevel
+	// Lock a lock file to hold for the dump, so that it does not run at once with another; no lock if File is empty
+	Lock LockOptions
+	// TargetTimeouts how long the operations on each target, by URL, may take. A target that times out fails,
+	// and the dump is still uploaded to the others, before the dump fails.
+	TargetTimeouts map[string]TargetTimeouts
+	// Replica a read replica of DBConn from which to dump, to spare the primary the load; nil to dump from DBConn
+	Replica *ReplicaOptions
+	// SkipCompressionIfIncompressible sample the dump before compressing it, and if the sample hardly compresses,
+	// e.g. as the tables hold blobs that are compressed already, archive it without compression for every target
+	SkipCompressionIfIncompressible bool
+	// Partitions partitions, by table in the format "<database>.<table>", to dump only those partitions of those
+	// partitioned tables, e.g. the recent ones of a table partitioned by time; a restore replaces only those
+	// partitions, and keeps the others. The databases must be dumped.
+	Partitions map[string][]string
+	// Report keep a report of the recent runs on each target, whether they succeeded or not; none if its
+	// History is 0
+	Report ReportOptions
+	// SkipUnchanged skip the dump if the method, one of the database change detection methods, detects no change
+	// in the databases since the last dump of the server with the label, as recorded in StateFile, which it
+	// requires; empty to dump every time
+	SkipUnchanged string
+	// LinkUnchanged when a dump is skipped as unchanged, link the name it would have had on each target to the
+	// last dump, on targets that can link, so that there is a dump of each run
+	LinkUnchanged bool
+	// Priority the lower CPU and I/O priority at which to dump, which applies to the whole process from then on
+	Priority PriorityOptions
+	// SkipSetCharset do not set the character set in which the dump is written, like mysqldump --skip-set-charset,
+	// so that it is restored in that of the restore; DBConn must not set one
+	SkipSetCharset bool
+	// OrderByPrimary dump the rows of each table in the order of its primary key, like mysqldump
+	// --order-by-primary, so that dumps of the same data are byte for byte the same
+	OrderByPrimary bool
+	// SkipTzUtc dump TIMESTAMP values in the time zone of the server, like mysqldump --skip-tz-utc, rather than in
+	// UTC, which the dump sets for the restore, so that they restore the same on a server in another time zone
+	SkipTzUtc bool
+}
+
+// TargetTimeouts how long the operations on a target may take, so that a slow target does not hold up the dump
+type TargetTimeouts struct {
+	// Connect how long to connect to the target, for targets that connect to a server, SMB and S3; 0 for no limit
+	Connect time.Duration
+	// Upload how long the upload of each file of the dump to the target may take, including checking for a
+	// duplicate and verifying it; 0 for no limit
+	Upload time.Duration
 }
@@ -10,13 +10,27 @@ type DumpResults struct {
 	Timestamp string
 	DumpStart time.Time
 	DumpEnd   time.Time
-	Uploads   []UploadResult
+	// Databases the databases dumped
+	Databases []string
+	// Replica the address of the replica from which they were dumped, if they were not dumped from the primary
+	Replica string
+	Uploads []UploadResult
+	// Unchanged whether the dump was skipped, as the databases had not changed since the last one
+	Unchanged bool
+	// PreviousSuccess for each target URL, when the previous successful dump of the same server to it
+	// finished, if recorded in the state file
+	PreviousSuccess map[string]time.Time
 }
 
 // UploadResult lists results of an individual upload
 type UploadResult struct {
-	Target string
+	Target   string
 	Filename string
-	Start time.Time
-	End time.Time
+	Start    time.Time
+	End      time.Time
+	// DuplicateOf the existing dump on the target with identical content, if the upload was skipped
+	DuplicateOf string
+	// Size and SHA256 of the dump file, hex-encoded, if they could be calculated
+	Size   int64
+	SHA256 string
 }
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/databacker/mysql-backup/pkg/archive"
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/tracing"
+)
+
+// Fetch download a dump from the target to a local path, without restoring it, e.g. for offline analysis. The
+// dump is chosen as for Restore. Cancelling ctx aborts the fetch.
+func (e *Executor) Fetch(ctx context.Context, opts FetchOptions) (results FetchResults, err error) {
+	results.Start = time.Now()
+	defer func() { results.End = time.Now() }()
+	logger := e.Logger.WithField("run", opts.Run.String())
+	logger.Level = e.Logger.Level
+
+	ctx, span := tracing.Start(ctx, "fetch", attribute.String("run", opts.Run.String()), attribute.String("target.type", opts.Target.Protocol()), attribute.String("target.url", tracing.RedactURL(opts.Target.URL())))
+	defer func() { tracing.End(span, err) }()
+
+	logger.Info("beginning fetch")
+	// a stream has no files to choose from, and can be read as it is
+	if storage.IsStream(opts.Target) {
+		return results, fmt.Errorf("cannot fetch from a stream, such as stdin")
+	}
+	file, err := chooseDump(ctx, opts.Target, opts.TargetFile, opts.Newest, opts.Label, opts.Offset, "fetching", logger)
+	if err != nil {
+		return results, err
+	}
+	if file == "" {
+		return results, fmt.Errorf("no file to fetch")
+	}
+	results.File = file
+	span.SetAttributes(attribute.String("filename", file))
+
+	dest := opts.Path
+	if dest == "" {
+		dest = "."
+	}
+	extract := opts.Uncompress && !opts.Raw
+	if extract {
+		if err := os.MkdirAll(dest, 0o755); err != nil {
+			return results, fmt.Errorf("unable to create directory %s: %v", dest, err)
+		}
+	} else if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		name := path.Base(file)
+		if opts.Uncompress {
+			name = uncompressedName(name)
+		}
+		dest = filepath.Join(dest, name)
+	}
+	// downloaded beside where it is written, rather than in the temporary directory, so that the dump is only
+	// ever where it was asked to be, and a fetch that fails does not leave a partial file there
+	workParent := filepath.Dir(dest)
+	if extract {
+		workParent = dest
+	}
+	work, err := os.MkdirTemp(workParent, ".databacker_fetch_")
+	if err != nil {
+		return results, fmt.Errorf("unable to create temporary working directory: %v", err)
+	}
+	defer os.RemoveAll(work)
+	downloadFile := filepath.Join(work, "fetchfile")
+	logger.Debugf("fetching via %s protocol, to %s", opts.Target.Protocol(), dest)
+
+	copied, duplicateOf, err := pullDump(ctx, opts.Target, file, downloadFile, work, logger)
+	if err != nil {
+		return results, err
+	}
+	if duplicateOf != "" {
+		logger.Infof("%s was not uploaded, as it is identical to %s, pulled that instead", file, duplicateOf)
+	}
+	logger.Debugf("completed copying %d bytes", copied)
+	// only for reporting, so not fatal
+	if results.Size, results.SHA256, err = fileSHA256(downloadFile); err != nil {
+		logger.Warnf("unable to calculate checksum of %s: %v", file, err)
+	}
+
+	if !opts.Uncompress {
+		if err := os.Rename(downloadFile, dest); err != nil {
+			return results, fmt.Errorf("unable to write %s: %v", dest, err)
+		}
+		results.Path = dest
+		logger.Infof("fetched %s to %s", file, dest)
+		return results, nil
+	}
+
+	f, err := os.Open(downloadFile)
+	if err != nil {
+		return results, fmt.Errorf("unable to read the temporary download file: %v", err)
+	}
+	defer f.Close()
+	compressor, err := dumpCompressor(f, file, opts.Compressor, opts.CompressionDictionaries, logger)
+	if err != nil {
+		return results, err
+	}
+	results.Compression = compressor.Extension()
+	cr, err := compressor.Uncompress(f)
+	if err != nil {
+		return results, fmt.Errorf("unable to create an uncompressor: %v", err)
+	}
+	if extract {
+		if err := archive.Untar(cr, dest); err != nil {
+			return results, fmt.Errorf("error extracting the file: %v", err)
+		}
+	} else {
+		sqlFile := filepath.Join(work, "fetchfile.sql")
+		if err := uncompressTo(cr, sqlFile, false); err != nil {
+			return results, fmt.Errorf("error extracting the file: %v", err)
+		}
+		if err := os.Rename(sqlFile, dest); err != nil {
+			return results, fmt.Errorf("unable to write %s: %v", dest, err)
+		}
+	}
+	results.Path = dest
+	logger.Infof("fetched %s, uncompressed, to %s", file, dest)
+	return results, nil
+}
+
+// uncompressedName the name of the single compressed SQL dump name, once uncompressed, without the extension
+// of its compression
+func uncompressedName(name string) string {
+	for _, ext := range []string{".gz", ".bz2", ".zst"} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name + ".sql"
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/databacker/mysql-backup/pkg/compression"
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+	"github.com/databacker/mysql-backup/pkg/storage/stdio"
+)
+
+func TestFetch(t *testing.T) {
+	targetDir, workdir := t.TempDir(), t.TempDir()
+	content := "CREATE TABLE t1 (id int);\n"
+	require.NoError(t, os.WriteFile(filepath.Join(workdir, "db1.sql"), []byte(content), 0o644))
+	older, newer := "db_backup_2026-10-13T02:00:00Z.tgz", "db_backup_2026-10-14T02:00:00Z.tgz"
+	for _, name := range []string{older, newer} {
+		require.NoError(t, archiveAndCompress(workdir, []compressedFile{{path: filepath.Join(targetDir, name), compressor: &compression.GzipCompressor{}}}, false))
+	}
+	// a single SQL dump, e.g. from mysqldump
+	f, err := os.Create(filepath.Join(targetDir, "legacy.sql.gz"))
+	require.NoError(t, err)
+	w, err := (&compression.GzipCompressor{}).Compress(f)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	target := file.New(url.URL{Scheme: "file", Path: targetDir})
+	executor := &Executor{Logger: log.New()}
+
+	t.Run("as it is", func(t *testing.T) {
+		dir := t.TempDir()
+		results, err := executor.Fetch(context.Background(), FetchOptions{Target: target, TargetFile: "db_backup_*.tgz", Newest: true, Path: dir, Run: uuid.New()})
+		require.NoError(t, err)
+		assert.Equal(t, newer, results.File)
+		assert.Equal(t, filepath.Join(dir, newer), results.Path)
+		size, checksum, err := fileSHA256(filepath.Join(targetDir, newer))
+		require.NoError(t, err)
+		assert.Equal(t, size, results.Size)
+		assert.Equal(t, checksum, results.SHA256)
+		// nothing but the dump is left behind
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+	t.Run("to a file", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "latest.tgz")
+		results, err := executor.Fetch(context.Background(), FetchOptions{Target: target, TargetFile: older, Path: out, Run: uuid.New()})
+		require.NoError(t, err)
+		assert.Equal(t, out, results.Path)
+		_, err = os.Stat(out)
+		assert.NoError(t, err)
+	})
+	t.Run("uncompressed", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "extracted")
+		results, err := executor.Fetch(context.Background(), FetchOptions{Target: target, TargetFile: newer, Path: dir, Uncompress: true, Run: uuid.New()})
+		require.NoError(t, err)
+		assert.Equal(t, "tgz", results.Compression)
+		b, err := os.ReadFile(filepath.Join(dir, "db1.sql"))
+		require.NoError(t, err)
+		assert.Equal(t, content, string(b))
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+	t.Run("raw uncompressed", func(t *testing.T) {
+		dir := t.TempDir()
+		results, err := executor.Fetch(context.Background(), FetchOptions{Target: target, TargetFile: "legacy.sql.gz", Path: dir, Uncompress: true, Raw: true, Run: uuid.New()})
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, "legacy.sql"), results.Path)
+		b, err := os.ReadFile(results.Path)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(b))
+	})
+	t.Run("missing", func(t *testing.T) {
+		_, err := executor.Fetch(context.Background(), FetchOptions{Target: target, TargetFile: "missing.tgz", Path: t.TempDir(), Run: uuid.New()})
+		assert.Error(t, err)
+	})
+	t.Run("stdin", func(t *testing.T) {
+		_, err := executor.Fetch(context.Background(), FetchOptions{Target: stdio.New(nil, nil), TargetFile: stdio.Name, Path: t.TempDir(), Run: uuid.New()})
+		assert.ErrorContains(t, err, "cannot fetch from a stream")
+	})
+}
+
+func TestUncompressedName(t *testing.T) {
+	assert.Equal(t, "legacy.sql", uncompressedName("legacy.sql.gz"))
+	assert.Equal(t, "legacy.sql", uncompressedName("legacy.sql.bz2"))
+	assert.Equal(t, "legacy.sql", uncompressedName("legacy.sql.zst"))
+	assert.Equal(t, "legacy.sql", uncompressedName("legacy"))
+}
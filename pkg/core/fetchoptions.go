@@ -0,0 +1,34 @@
+package core
+
+import (
+	"github.com/databacker/mysql-backup/pkg/compression"
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// FetchOptions which dump to download from a target, without restoring it, and where to write it
+type FetchOptions struct {
+	Target     storage.Storage
+	TargetFile string
+	// Newest TargetFile is a pattern, as for NewestMatching, and the newest file that matches it is fetched
+	Newest bool
+	// Label fetch the newest dump on the target with this label, as by NewestWithLabel, rather than TargetFile,
+	// which must be empty
+	Label string
+	// Offset fetch the dump this many older than the newest, as for RestoreOptions
+	Offset int
+	// Path where to write the dump: a file, or an existing directory in which to write it with its own name.
+	// With Uncompress, and not Raw, the directory into which to extract the files of the dump, which is created
+	// if it does not exist. The current directory if empty.
+	Path string
+	// Uncompress the dump as it is written, rather than write it as it is on the target
+	Uncompress bool
+	// Raw the file is a single compressed SQL dump, e.g. from another tool, rather than an archive created by
+	// Dump, so that with Uncompress it is written as a single SQL file
+	Raw bool
+	// Compressor the compression of the dump, with Uncompress, if it cannot be detected from the file
+	Compressor compression.Compressor
+	// CompressionDictionaries paths to the zstd dictionaries that the file may have been compressed with
+	CompressionDictionaries []string
+	Run                     uuid.UUID
+}
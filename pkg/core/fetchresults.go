@@ -0,0 +1,18 @@
+package core
+
+import "time"
+
+// FetchResults lists results of the fetch.
+type FetchResults struct {
+	Start time.Time
+	End   time.Time
+	// File the file that was fetched, which with Newest or Label is the one that was found
+	File string
+	// Size and SHA256 of the dump file, hex-encoded, as pulled from the target
+	Size   int64
+	SHA256 string
+	// Compression the extension of the compression with which the file was uncompressed, with Uncompress
+	Compression string
+	// Path the file that was written or, for an archive with Uncompress, the directory it was extracted into
+	Path string
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// keepSQL copy the uncompressed SQL files of a dump, from each of the working directories, to a new directory
+// name in dir, which is created if it does not exist
+func keepSQL(workdirs []string, dir, name string) error {
+	dest := filepath.Join(dir, name)
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", dest, err)
+	}
+	for _, workdir := range workdirs {
+		entries, err := os.ReadDir(workdir)
+		if err != nil {
+			return fmt.Errorf("failed to read dump directory %s: %v", workdir, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".sql" {
+				continue
+			}
+			if err := copyFile(filepath.Join(workdir, entry.Name()), filepath.Join(dest, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyFile copy the file source to target, replacing it if it exists
+func copyFile(source, target string) error {
+	from, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", source, err)
+	}
+	defer from.Close()
+	to, err := os.Create(target)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", target, err)
+	}
+	if _, err := io.Copy(to, from); err != nil {
+		to.Close()
+		return fmt.Errorf("failed to copy %s to %s: %v", source, target, err)
+	}
+	return to.Close()
+}
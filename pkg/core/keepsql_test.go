@@ -0,0 +1,35 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepSQL(t *testing.T) {
+	workdir, tableWorkdir, dir := t.TempDir(), t.TempDir(), t.TempDir()
+	for name, content := range map[string]string{
+		filepath.Join(workdir, "db1_now.sql"):                "CREATE TABLE a;",
+		filepath.Join(workdir, "notes.txt"):                  "not a dump",
+		filepath.Join(tableWorkdir, "db1.countries_now.sql"): "CREATE TABLE countries;",
+	} {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the directory is created below one that need not exist yet
+	assert.NoError(t, keepSQL([]string{workdir, tableWorkdir}, filepath.Join(dir, "kept"), "db_backup_now"))
+	entries, err := os.ReadDir(filepath.Join(dir, "kept", "db_backup_now"))
+	assert.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"db1_now.sql", "db1.countries_now.sql"}, names)
+	content, err := os.ReadFile(filepath.Join(dir, "kept", "db_backup_now", "db1_now.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE a;", string(content))
+}
@@ -0,0 +1,31 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/databacker/mysql-backup/pkg/storage"
+)
+
+// updateLatest point the alias on the target at the dump that was just uploaded, or at the
+// existing dump it duplicates. Targets that cannot alias get a full copy of the dump in source.
+func updateLatest(ctx context.Context, t storage.Storage, alias string, upload UploadResult, source string, logger *log.Entry) error {
+	existing := upload.Filename
+	if upload.DuplicateOf != "" {
+		existing = upload.DuplicateOf
+	}
+	if aliaser, ok := t.(storage.Aliaser); ok {
+		if err := aliaser.Alias(ctx, alias, existing, logger); err != nil {
+			return fmt.Errorf("failed to alias %s to %s: %v", alias, existing, err)
+		}
+		logger.Debugf("pointed %s at %s on target %s", alias, existing, t.URL())
+		return nil
+	}
+	if _, err := t.Push(ctx, alias, source, logger); err != nil {
+		return fmt.Errorf("failed to push %s: %v", alias, err)
+	}
+	logger.Debugf("copied %s to %s on target %s", existing, alias, t.URL())
+	return nil
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateLatest(t *testing.T) {
+	targetDir, tmpdir := t.TempDir(), t.TempDir()
+	target := file.New(url.URL{Scheme: "file", Path: targetDir})
+	logger := log.NewEntry(log.New())
+	source := filepath.Join(tmpdir, "source.tgz")
+	if err := os.WriteFile(source, []byte("dump"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"first.tgz", "second.tgz"} {
+		if _, err := target.Push(context.Background(), name, source, logger); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the alias is created, and then replaced by the next dump
+	assert.NoError(t, updateLatest(context.Background(), target, "latest.tgz", UploadResult{Filename: "first.tgz"}, source, logger))
+	link, err := os.Readlink(filepath.Join(targetDir, "latest.tgz"))
+	assert.NoError(t, err)
+	assert.Equal(t, "first.tgz", link)
+
+	assert.NoError(t, updateLatest(context.Background(), target, "latest.tgz", UploadResult{Filename: "second.tgz"}, source, logger))
+	link, err = os.Readlink(filepath.Join(targetDir, "latest.tgz"))
+	assert.NoError(t, err)
+	assert.Equal(t, "second.tgz", link)
+
+	// a duplicate that was not stored points at the dump it duplicates
+	assert.NoError(t, updateLatest(context.Background(), target, "latest.tgz", UploadResult{Filename: "third.tgz", DuplicateOf: "first.tgz"}, source, logger))
+	link, err = os.Readlink(filepath.Join(targetDir, "latest.tgz"))
+	assert.NoError(t, err)
+	assert.Equal(t, "first.tgz", link)
+}
@@ -0,0 +1,203 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultLockStale how old a lock may be before it is taken to be left by a dump that crashed, if its process
+// cannot be checked
+const DefaultLockStale = 24 * time.Hour
+
+// lockPollInterval how often to check whether the lock held by another dump is released, while waiting for it
+var lockPollInterval = time.Second
+
+// LockOptions a lock file, so that two dumps, e.g. from cron jobs that overlap, do not run at once
+type LockOptions struct {
+	// File local path of the lock file; empty for no lock
+	File string
+	// Wait how long to wait for a lock held by another dump to be released; 0 to fail at once
+	Wait time.Duration
+	// Stale how old a lock may be before it is taken to be left by a dump that crashed, even if its process
+	// cannot be checked, e.g. as it is on another host; 0 for never
+	Stale time.Duration
+}
+
+// heldLocks the runs of this process that hold a lock, so that a lock with the ID of this process, but held by
+// none of them, is known to be left by an earlier process with the same ID
+var heldLocks = struct {
+	sync.Mutex
+	runs map[string]bool
+}{runs: map[string]bool{}}
+
+// holdsLock whether run, of this process, holds a lock
+func holdsLock(run string) bool {
+	heldLocks.Lock()
+	defer heldLocks.Unlock()
+	return heldLocks.runs[run]
+}
+
+// setHoldsLock record whether run, of this process, holds a lock
+func setHoldsLock(run string, held bool) {
+	heldLocks.Lock()
+	defer heldLocks.Unlock()
+	if held {
+		heldLocks.runs[run] = true
+	} else {
+		delete(heldLocks.runs, run)
+	}
+}
+
+// lockHolder the dump that holds a lock, as recorded in the lock file
+type lockHolder struct {
+	PID      int    `json:"pid"`
+	Hostname string `json:"hostname"`
+	// Started when the process started, as by processStart, if it can be found
+	Started string    `json:"started,omitempty"`
+	Run     string    `json:"run"`
+	Time    time.Time `json:"time"`
+}
+
+// stale why the lock of the holder was left by a dump that is no longer running, on hostname, which is what
+// this one, run, is on; empty if it might still be
+func (h lockHolder) stale(hostname, run string, maxAge time.Duration) string {
+	// a process can only be checked on the same host
+	if h.PID > 0 && h.Hostname == hostname {
+		switch {
+		case h.PID == os.Getpid() && h.Run != run && !holdsLock(h.Run):
+			// e.g. a restarted container, whose process has the same ID as the one before it
+			return fmt.Sprintf("process %d is this one, which does not hold it", h.PID)
+		case !processAlive(h.PID):
+			return fmt.Sprintf("process %d is not running", h.PID)
+		case h.Started != "":
+			if started := processStart(h.PID); started != "" && started != h.Started {
+				return fmt.Sprintf("process %d is another one, started since", h.PID)
+			}
+		}
+	}
+	if maxAge > 0 && time.Since(h.Time) > maxAge {
+		return fmt.Sprintf("it is older than %s", maxAge)
+	}
+	return ""
+}
+
+func (h lockHolder) String() string {
+	return fmt.Sprintf("run %s, process %d on %s, since %s", h.Run, h.PID, h.Hostname, h.Time.UTC().Format(time.RFC3339))
+}
+
+// acquireLock create the lock file, waiting up to opts.Wait for any other dump that holds it, and taking it over
+// if that dump crashed. Returns the function with which to release it.
+func acquireLock(ctx context.Context, opts LockOptions, run string, logger *log.Entry) (func(), error) {
+	hostname, _ := os.Hostname()
+	holder := lockHolder{PID: os.Getpid(), Hostname: hostname, Started: processStart(os.Getpid()), Run: run, Time: time.Now()}
+	b, err := json.Marshal(holder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode lock: %v", err)
+	}
+	deadline := time.Now().Add(opts.Wait)
+	waiting := false
+	for {
+		err := createLock(opts.File, b)
+		if err == nil {
+			logger.Debugf("acquired lock file %s", opts.File)
+			setHoldsLock(run, true)
+			return func() {
+				releaseLock(opts.File, run, logger)
+				setHoldsLock(run, false)
+			}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock file %s: %v", opts.File, err)
+		}
+		held, err := readLock(opts.File)
+		if errors.Is(err, fs.ErrNotExist) {
+			// released since it was created
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// two dumps that find the same stale lock at once might both remove it, one after the other creates its
+		// own; which is so unlikely, for dumps started minutes apart, that it is not guarded against
+		if reason := held.stale(hostname, run, opts.Stale); reason != "" {
+			logger.Warnf("removing stale lock file %s of %s, as %s", opts.File, held, reason)
+			if err := os.Remove(opts.File); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("failed to remove stale lock file %s: %v", opts.File, err)
+			}
+			continue
+		}
+		if !time.Now().Before(deadline) {
+			return nil, permanent(fmt.Errorf("another dump holds the lock file %s, %s", opts.File, held))
+		}
+		if !waiting {
+			logger.Infof("waiting up to %s for the lock file %s, held by %s", time.Until(deadline).Round(time.Second), opts.File, held)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(min(lockPollInterval, time.Until(deadline))):
+		}
+	}
+}
+
+// createLock create the lock file with the holder b, failing with fs.ErrExist if it exists
+func createLock(filename string, b []byte) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(filename)
+		return err
+	}
+	return f.Close()
+}
+
+// readLock read the holder of the lock file. A file that cannot be parsed, e.g. as its dump crashed while writing
+// it, is held by no process, since it was last modified.
+func readLock(filename string) (lockHolder, error) {
+	var holder lockHolder
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return holder, err
+	}
+	if err := json.Unmarshal(b, &holder); err != nil {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return holder, err
+		}
+		return lockHolder{Time: info.ModTime()}, nil
+	}
+	return holder, nil
+}
+
+// releaseLock remove the lock file, if it is still held by run, and not taken over as stale by another dump
+func releaseLock(filename, run string, logger *log.Entry) {
+	held, err := readLock(filename)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		logger.Warnf("lock file %s was removed while the dump held it", filename)
+		return
+	case err != nil:
+		logger.Warnf("unable to read lock file %s to release it: %v", filename, err)
+		return
+	case held.Run != run:
+		logger.Warnf("lock file %s was taken over by %s while the dump held it", filename, held)
+		return
+	}
+	if err := os.Remove(filename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Warnf("unable to remove lock file %s: %v", filename, err)
+		return
+	}
+	logger.Debugf("released lock file %s", filename)
+}
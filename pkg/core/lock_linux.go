@@ -0,0 +1,38 @@
+//go:build linux
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// processStart when the process pid started, as the boot of the host and the clock ticks since it, so that a process
+// that reuses the ID of one that crashed, e.g. after a restart of its container, is not taken for it; empty if the
+// process cannot be found
+func processStart(pid int) string {
+	bootID, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return ""
+	}
+	// the command, in parentheses, may itself contain spaces and parentheses, so the fields are after the last;
+	// the start time is the 22nd field, of which the state, after the command, is the 3rd
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return ""
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 20 {
+		return ""
+	}
+	if _, err := strconv.ParseUint(fields[19], 10, 64); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(bootID)) + ":" + fields[19]
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package core
+
+// processStart when the process pid started can only be found on Linux, so a process that reuses the ID of one
+// that crashed is taken for it, until the lock is stale by its age
+func processStart(pid int) string {
+	return ""
+}
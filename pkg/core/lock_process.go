@@ -0,0 +1,15 @@
+//go:build !windows
+
+package core
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive whether the process pid is running; signal 0 checks for it without signalling it
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	// a process of another user is running, but may not be signalled
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeLockHolder(t *testing.T, filename string, holder lockHolder) {
+	b, err := json.Marshal(holder)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filename, b, 0o644))
+}
+
+func TestAcquireLock(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewEntry(log.New())
+	hostname, _ := os.Hostname()
+	lockPollInterval = 10 * time.Millisecond
+
+	t.Run("held and released", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "dump.lock")
+		release, err := acquireLock(ctx, LockOptions{File: filename}, "run1", logger)
+		require.NoError(t, err)
+		held, err := readLock(filename)
+		require.NoError(t, err)
+		assert.Equal(t, "run1", held.Run)
+		assert.Equal(t, os.Getpid(), held.PID)
+
+		_, err = acquireLock(ctx, LockOptions{File: filename}, "run2", logger)
+		assert.ErrorContains(t, err, "another dump holds the lock file")
+		assert.False(t, Retryable(err))
+
+		release()
+		assert.NoFileExists(t, filename)
+		release2, err := acquireLock(ctx, LockOptions{File: filename}, "run2", logger)
+		require.NoError(t, err)
+		release2()
+	})
+	t.Run("wait for release", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "dump.lock")
+		release, err := acquireLock(ctx, LockOptions{File: filename}, "run1", logger)
+		require.NoError(t, err)
+		time.AfterFunc(50*time.Millisecond, release)
+		release2, err := acquireLock(ctx, LockOptions{File: filename, Wait: 5 * time.Second}, "run2", logger)
+		require.NoError(t, err)
+		release2()
+	})
+	t.Run("wait cancelled", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "dump.lock")
+		release, err := acquireLock(ctx, LockOptions{File: filename}, "run1", logger)
+		require.NoError(t, err)
+		defer release()
+		cancelled, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = acquireLock(cancelled, LockOptions{File: filename, Wait: time.Minute}, "run2", logger)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+	t.Run("stale process", func(t *testing.T) {
+		cmd := exec.Command("true")
+		require.NoError(t, cmd.Run())
+		filename := filepath.Join(t.TempDir(), "dump.lock")
+		writeLockHolder(t, filename, lockHolder{PID: cmd.Process.Pid, Hostname: hostname, Run: "crashed", Time: time.Now()})
+		release, err := acquireLock(ctx, LockOptions{File: filename}, "run1", logger)
+		require.NoError(t, err)
+		release()
+	})
+	t.Run("same process", func(t *testing.T) {
+		// e.g. left by the dump of a container before it restarted, whose process had the same ID as this one
+		filename := filepath.Join(t.TempDir(), "dump.lock")
+		writeLockHolder(t, filename, lockHolder{PID: os.Getpid(), Hostname: hostname, Started: processStart(os.Getpid()), Run: "crashed", Time: time.Now()})
+		release, err := acquireLock(ctx, LockOptions{File: filename, Stale: DefaultLockStale}, "run1", logger)
+		require.NoError(t, err)
+		release()
+	})
+	t.Run("reused process id", func(t *testing.T) {
+		cmd := exec.Command("sleep", "10")
+		require.NoError(t, cmd.Start())
+		defer func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		}()
+		pid := cmd.Process.Pid
+		started := processStart(pid)
+		if started == "" {
+			t.Skip("the start time of a process cannot be found on this platform")
+		}
+		filename := filepath.Join(t.TempDir(), "dump.lock")
+		writeLockHolder(t, filename, lockHolder{PID: pid, Hostname: hostname, Started: started, Run: "other", Time: time.Now()})
+		_, err := acquireLock(ctx, LockOptions{File: filename, Stale: DefaultLockStale}, "run1", logger)
+		assert.ErrorContains(t, err, "another dump holds the lock file", "the process that holds it is running")
+
+		// the crashed dump had the same ID, but started at another time
+		writeLockHolder(t, filename, lockHolder{PID: pid, Hostname: hostname, Started: started + "0", Run: "crashed", Time: time.Now()})
+		release, err := acquireLock(ctx, LockOptions{File: filename, Stale: DefaultLockStale}, "run1", logger)
+		require.NoError(t, err)
+		release()
+	})
+	t.Run("process on another host", func(t *testing.T) {
+		cmd := exec.Command("true")
+		require.NoError(t, cmd.Run())
+		filename := filepath.Join(t.TempDir(), "dump.lock")
+		writeLockHolder(t, filename, lockHolder{PID: cmd.Process.Pid, Hostname: hostname + "-other", Run: "other", Time: time.Now()})
+		_, err := acquireLock(ctx, LockOptions{File: filename, Stale: time.Hour}, "run1", logger)
+		assert.ErrorContains(t, err, "another dump holds the lock file")
+	})
+	t.Run("stale age", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "dump.lock")
+		writeLockHolder(t, filename, lockHolder{PID: os.Getpid(), Hostname: hostname + "-other", Run: "old", Time: time.Now().Add(-2 * time.Hour)})
+		release, err := acquireLock(ctx, LockOptions{File: filename, Stale: time.Hour}, "run1", logger)
+		require.NoError(t, err)
+		release()
+	})
+	t.Run("unparseable", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "dump.lock")
+		require.NoError(t, os.WriteFile(filename, nil, 0o644))
+		old := time.Now().Add(-2 * time.Hour)
+		require.NoError(t, os.Chtimes(filename, old, old))
+		release, err := acquireLock(ctx, LockOptions{File: filename, Stale: time.Hour}, "run1", logger)
+		require.NoError(t, err)
+		release()
+	})
+	t.Run("taken over", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "dump.lock")
+		release, err := acquireLock(ctx, LockOptions{File: filename}, "run1", logger)
+		require.NoError(t, err)
+		writeLockHolder(t, filename, lockHolder{PID: os.Getpid(), Hostname: hostname, Run: "run2", Time: time.Now()})
+		release()
+		// not removed, as it is no longer that of run1
+		assert.FileExists(t, filename)
+	})
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package core
+
+import (
+	"os"
+)
+
+// processAlive whether the process pid is running; on windows, it can only be found if it is
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
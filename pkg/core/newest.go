@@ -0,0 +1,171 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/databacker/mysql-backup/pkg/storage"
+)
+
+// globChars the characters that make a part of a path.Match pattern match more than itself
+const globChars = `*?[\`
+
+// NewestMatching the name of the newest file on target that matches pattern, as by path.Match, e.g.
+// backups/db1/*.sql.gz; if several are as new, the last by name. Storage that is a storage.Lister is listed by
+// the part of the pattern before its first wildcard, so the wildcards can be anywhere; other storage is listed a
+// directory at a time, so they can only be in the filename.
+func NewestMatching(ctx context.Context, target storage.Storage, pattern string, logger *log.Entry) (string, error) {
+	return NthNewestMatching(ctx, target, pattern, 0, logger)
+}
+
+// NthNewestMatching the name of the file on target that matches pattern that is offset files older than the
+// newest, as by NewestMatching, e.g. 1 for the second newest, when the newest is no good.
+func NthNewestMatching(ctx context.Context, target storage.Storage, pattern string, offset int, logger *log.Entry) (string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "", fmt.Errorf("invalid pattern %s: %v", pattern, err)
+	}
+	if err := ValidateOffset(offset); err != nil {
+		return "", err
+	}
+	var (
+		files []fs.FileInfo
+		dir   string
+		err   error
+	)
+	if lister, ok := target.(storage.Lister); ok {
+		prefix := pattern
+		if i := strings.IndexAny(pattern, globChars); i >= 0 {
+			prefix = pattern[:i]
+		}
+		files, err = lister.List(ctx, prefix, logger)
+	} else {
+		dir = path.Dir(pattern)
+		if strings.ContainsAny(dir, globChars) {
+			return "", fmt.Errorf("invalid pattern %s: %s storage can only match wildcards in the filename", pattern, target.Protocol())
+		}
+		files, err = target.ReadDir(ctx, dir, logger)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to list files on %s: %v", target.URL(), err)
+	}
+	var matches []fileWithTime
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		name := file.Name()
+		if dir != "" && dir != "." {
+			name = path.Join(dir, name)
+		}
+		if ok, _ := path.Match(pattern, name); !ok {
+			continue
+		}
+		matches = append(matches, fileWithTime{filename: name, filetime: file.ModTime()})
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no file on %s matches %s", target.URL(), pattern)
+	}
+	if offset >= len(matches) {
+		return "", fmt.Errorf("only %d files on %s match %s, so none is %d older than the newest", len(matches), target.URL(), pattern, offset)
+	}
+	return newestFirst(matches)[offset].filename, nil
+}
+
+// NewestWithLabel the name of the newest dump on target with label, by the time in its filename, which must be in
+// the default format, as for prune; if several are as new, e.g. of different servers, the last by name.
+func NewestWithLabel(ctx context.Context, target storage.Storage, label string, logger *log.Entry) (string, error) {
+	if label == "" {
+		return "", fmt.Errorf("label is required")
+	}
+	return NthNewestWithLabel(ctx, target, label, 0, logger)
+}
+
+// NthNewestWithLabel the name of the dump on target with label that is offset dumps older than the newest, as by
+// NewestWithLabel, e.g. 1 for the second newest, when the newest is no good. With an empty label, of the dumps
+// without a label, as for prune.
+func NthNewestWithLabel(ctx context.Context, target storage.Storage, label string, offset int, logger *log.Entry) (string, error) {
+	if label != "" {
+		if err := ValidateLabel(label); err != nil {
+			return "", err
+		}
+	}
+	if err := ValidateOffset(offset); err != nil {
+		return "", err
+	}
+	files, err := target.ReadDir(ctx, ".", logger)
+	if err != nil {
+		return "", fmt.Errorf("failed to list files on %s: %v", target.URL(), err)
+	}
+	var dumps []fileWithTime
+	partitioned := storage.IsPartitioned(target)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		f, ok := parseTargetFilename(file.Name(), partitioned)
+		// only main dumps, not their separate tables, which have no label
+		if !ok || f.label != label || f.table != "" {
+			continue
+		}
+		dumps = append(dumps, f)
+	}
+	kind := "with label " + label
+	if label == "" {
+		kind = "without a label"
+	}
+	switch {
+	case len(dumps) == 0 && label != "":
+		return "", fmt.Errorf("no dump on %s has label %s", target.URL(), label)
+	case len(dumps) == 0:
+		return "", fmt.Errorf("no dump on %s is without a label", target.URL())
+	case offset >= len(dumps):
+		return "", fmt.Errorf("only %d dumps on %s %s, so none is %d older than the newest", len(dumps), target.URL(), kind, offset)
+	}
+	return newestFirst(dumps)[offset].filename, nil
+}
+
+// ValidateOffset check how many files older than the newest to choose, which must not be negative
+func ValidateOffset(offset int) error {
+	if offset < 0 {
+		return fmt.Errorf("invalid offset %d, must be at least 0", offset)
+	}
+	return nil
+}
+
+// newestFirst sort files by their time, the newest first, and if several are as new, the last by name first
+func newestFirst(files []fileWithTime) []fileWithTime {
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].filetime.Equal(files[j].filetime) {
+			return files[i].filetime.After(files[j].filetime)
+		}
+		return files[i].filename > files[j].filename
+	})
+	return files
+}
+
+// ListDumps the files at the top of target, newest first, by modification time, and then by name, for choosing one
+// to restore. Directories and the files that mysql-backup keeps for itself, whose names start with a ".", e.g.
+// the checksum index, are left out.
+func ListDumps(ctx context.Context, target storage.Storage, logger *log.Entry) ([]fs.FileInfo, error) {
+	files, err := target.ReadDir(ctx, ".", logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files on %s: %v", target.URL(), err)
+	}
+	files = slices.DeleteFunc(files, func(f fs.FileInfo) bool {
+		return f.IsDir() || strings.HasPrefix(f.Name(), ".")
+	})
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].ModTime().Equal(files[j].ModTime()) {
+			return files[i].ModTime().After(files[j].ModTime())
+		}
+		return files[i].Name() > files[j].Name()
+	})
+	return files, nil
+}
@@ -0,0 +1,226 @@
+package core
+
+import (
+	"context"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// listerStorage a file storage that lists by prefix across directories, as S3 does
+type listerStorage struct {
+	*file.File
+	dir string
+}
+
+func (l listerStorage) List(ctx context.Context, prefix string, logger *log.Entry) ([]fs.FileInfo, error) {
+	var files []fs.FileInfo
+	err := filepath.Walk(l.dir, func(p string, info fs.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, _ := filepath.Rel(l.dir, p)
+		if strings.HasPrefix(name, prefix) {
+			files = append(files, s3LikeFileInfo{FileInfo: info, name: name})
+		}
+		return nil
+	})
+	return files, err
+}
+
+type s3LikeFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (s s3LikeFileInfo) Name() string { return s.name }
+
+func TestNewestMatching(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	files := map[string]time.Time{
+		"backups/db1/2024-01-01.sql.gz": now.Add(-2 * time.Hour),
+		"backups/db1/2024-01-02.sql.gz": now.Add(-time.Hour),
+		"backups/db1/2024-01-03.tgz":    now,
+		"backups/db2/2024-01-04.sql.gz": now.Add(time.Hour),
+	}
+	for name, modTime := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("dump"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	target := file.New(url.URL{Scheme: "file", Path: dir})
+	lister := listerStorage{File: target, dir: dir}
+	logger := log.NewEntry(log.New())
+
+	tests := []struct {
+		name    string
+		lister  bool
+		pattern string
+		offset  int
+		want    string
+		err     bool
+	}{
+		{"in directory", false, "backups/db1/*.sql.gz", 0, "backups/db1/2024-01-02.sql.gz", false},
+		{"wildcard directory", false, "backups/*/*.sql.gz", 0, "", true},
+		{"no match", false, "backups/db1/*.sql.bz2", 0, "", true},
+		{"invalid pattern", false, "backups/db1/[", 0, "", true},
+		{"lister in directory", true, "backups/db1/*.sql.gz", 0, "backups/db1/2024-01-02.sql.gz", false},
+		{"lister wildcard directory", true, "backups/*/*.sql.gz", 0, "backups/db2/2024-01-04.sql.gz", false},
+		{"lister any extension", true, "backups/db1/2024-*", 0, "backups/db1/2024-01-03.tgz", false},
+		{"offset", false, "backups/db1/*.sql.gz", 1, "backups/db1/2024-01-01.sql.gz", false},
+		{"lister offset", true, "backups/*/*.sql.gz", 2, "backups/db1/2024-01-01.sql.gz", false},
+		{"offset past oldest", false, "backups/db1/*.sql.gz", 2, "", true},
+		{"negative offset", false, "backups/db1/*.sql.gz", -1, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				got string
+				err error
+			)
+			if tt.lister {
+				got, err = NthNewestMatching(context.Background(), lister, tt.pattern, tt.offset, logger)
+			} else {
+				got, err = NthNewestMatching(context.Background(), target, tt.pattern, tt.offset, logger)
+			}
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewestWithLabel(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"db_backup_2024-01-01T00:00:00Z__pre-deploy.tgz",
+		"db_backup_2024-01-02T00:00:00Z__pre-deploy.tgz",
+		"db_backup_2024-01-02T00:00:00Z_db1__pre-deploy.tgz",
+		"db_backup_2024-01-03T00:00:00Z__nightly.tgz",
+		"db_backup_2024-01-04T00:00:00Z.tgz",
+		"other__pre-deploy.tgz",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("dump"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	target := file.New(url.URL{Scheme: "file", Path: dir})
+	logger := log.NewEntry(log.New())
+
+	tests := []struct {
+		name  string
+		label string
+		want  string
+		err   string
+	}{
+		{"newest by filename, last by name", "pre-deploy", "db_backup_2024-01-02T00:00:00Z_db1__pre-deploy.tgz", ""},
+		{"other label", "nightly", "db_backup_2024-01-03T00:00:00Z__nightly.tgz", ""},
+		{"no dump with label", "weekly", "", "no dump on file://" + dir + " has label weekly"},
+		{"invalid label", "pre_deploy", "", `invalid label "pre_deploy", must be letters, digits and '-'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewestWithLabel(context.Background(), target, tt.label, logger)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNthNewestWithLabel(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"db_backup_2024-01-01T00:00:00Z__pre-deploy.tgz",
+		"db_backup_2024-01-02T00:00:00Z__pre-deploy.tgz",
+		"db_backup_2024-01-03T00:00:00Z__pre-deploy.tgz",
+		"db_backup_2024-01-03T00:00:00Z.tgz",
+		"db_backup_2024-01-04T00:00:00Z.tgz",
+		"db_backup_2024-01-04T00:00:00Z_db1.users.tgz",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("dump"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	target := file.New(url.URL{Scheme: "file", Path: dir})
+	logger := log.NewEntry(log.New())
+
+	tests := []struct {
+		name   string
+		label  string
+		offset int
+		want   string
+		err    string
+	}{
+		{"newest", "pre-deploy", 0, "db_backup_2024-01-03T00:00:00Z__pre-deploy.tgz", ""},
+		{"second newest", "pre-deploy", 1, "db_backup_2024-01-02T00:00:00Z__pre-deploy.tgz", ""},
+		{"without a label", "", 1, "db_backup_2024-01-03T00:00:00Z.tgz", ""},
+		{"past oldest", "pre-deploy", 3, "", "only 3 dumps on file://" + dir + " with label pre-deploy, so none is 3 older than the newest"},
+		{"negative", "pre-deploy", -1, "", "invalid offset -1, must be at least 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NthNewestWithLabel(context.Background(), target, tt.label, tt.offset, logger)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestListDumps(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for _, name := range []string{"old.tgz", "newest.tgz", "same-b.tgz", "same-a.tgz", ".mysql-backup-checksums.json"} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte("dump"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-time.Hour)
+		switch name {
+		case "old.tgz":
+			mtime = now.Add(-48 * time.Hour)
+		case "newest.tgz":
+			mtime = now
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	target := file.New(url.URL{Scheme: "file", Path: dir})
+	files, err := ListDumps(context.Background(), target, log.NewEntry(log.New()))
+	assert.NoError(t, err)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	assert.Equal(t, []string{"newest.tgz", "same-b.tgz", "same-a.tgz", "old.tgz"}, names)
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// patternVars the regular expression that matches each of the values that a filename pattern can have
+var patternVars = map[string]string{
+	"now":         `\d{4}-\d{2}-\d{2}T\d{2}[:-]\d{2}[:-]\d{2}Z`,
+	"year":        `\d{4}`,
+	"month":       `\d{2}`,
+	"day":         `\d{2}`,
+	"hour":        `\d{2}`,
+	"minute":      `\d{2}`,
+	"second":      `\d{2}`,
+	"compression": `\w+`,
+	"server":      `[A-Za-z0-9-]+`,
+	"label":       `[A-Za-z0-9-]+`,
+	"database":    `[^./]+`,
+	"table":       `[^./]+`,
+}
+
+// patternTokenRE a value of the filename pattern, as substituted by patternMatcher, to be replaced by its
+// regular expression
+var patternTokenRE = regexp.MustCompile("\x00([a-z]+)\x00")
+
+// patternRE a regular expression that matches the filenames of one form of a filename pattern, along with the
+// name of the value in each of its submatches
+type patternRE struct {
+	re   *regexp.Regexp
+	vars []string
+}
+
+// patternMatcher matches the filenames that a filename pattern gives the dumps, to find them by that pattern
+// rather than the default
+type patternMatcher struct {
+	res []patternRE
+}
+
+// newPatternMatcher a matcher of the filenames of pattern. Those of dumps with and without a server, label and
+// separate table can differ, e.g. with {{ if .label }}, so it matches each of those forms. The pattern must
+// include the time of the dump, as {{ .now }}, or at least {{ .year }}, for it to tell how old each dump is.
+func newPatternMatcher(pattern string) (*patternMatcher, error) {
+	tmpl, err := template.New("filename").Parse(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse filename pattern: %v", err)
+	}
+	m := &patternMatcher{}
+	seen := map[string]bool{}
+	for _, server := range []bool{false, true} {
+		for _, label := range []bool{false, true} {
+			for _, table := range []bool{false, true} {
+				values := map[string]string{}
+				for name := range patternVars {
+					values[name] = "\x00" + name + "\x00"
+				}
+				if !server {
+					values["server"] = ""
+				}
+				if !label {
+					values["label"] = ""
+				}
+				if !table {
+					values["database"], values["table"] = "", ""
+				}
+				var buf strings.Builder
+				if err := tmpl.Execute(&buf, values); err != nil {
+					return nil, fmt.Errorf("failed to execute filename pattern: %v", err)
+				}
+				if seen[buf.String()] {
+					continue
+				}
+				seen[buf.String()] = true
+				p := newPatternRE(buf.String())
+				if !slices.Contains(p.vars, "now") && !slices.Contains(p.vars, "year") {
+					return nil, fmt.Errorf("filename pattern %q has no time of the dump, as .now or .year", pattern)
+				}
+				m.res = append(m.res, p)
+			}
+		}
+	}
+	return m, nil
+}
+
+// newPatternRE the regular expression that matches the filenames of the pattern as executed with a token for
+// each value, by which each token is replaced
+func newPatternRE(executed string) patternRE {
+	var (
+		expr strings.Builder
+		vars []string
+		last int
+	)
+	expr.WriteString("^")
+	for _, loc := range patternTokenRE.FindAllStringSubmatchIndex(executed, -1) {
+		name := executed[loc[2]:loc[3]]
+		expr.WriteString(regexp.QuoteMeta(executed[last:loc[0]]))
+		expr.WriteString("(" + patternVars[name] + ")")
+		vars = append(vars, name)
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(executed[last:]))
+	expr.WriteString("$")
+	return patternRE{re: regexp.MustCompile(expr.String()), vars: vars}
+}
+
+// parse the time, server, label and table of a dump from its filename, if it is named by the pattern, else false
+func (m *patternMatcher) parse(filename string) (fileWithTime, bool) {
+	for _, p := range m.res {
+		matches := p.re.FindStringSubmatch(filename)
+		if matches == nil {
+			continue
+		}
+		values := map[string]string{}
+		for i, name := range p.vars {
+			// the first, where a value is in the pattern more than once
+			if _, ok := values[name]; !ok {
+				values[name] = matches[i+1]
+			}
+		}
+		filetime, ok := patternTime(values)
+		if !ok {
+			continue
+		}
+		f := fileWithTime{filename: filename, filetime: filetime, server: values["server"], label: values["label"]}
+		if values["table"] != "" {
+			f.table = values["server"] + values["database"] + "." + values["table"]
+		}
+		return f, true
+	}
+	return fileWithTime{}, false
+}
+
+// parseTarget parse the filename of a dump on a target, as by parseTargetFilename, by the pattern: the whole of
+// it, which can have folders of its own, or if the target is partitioned, the last part of it
+func (m *patternMatcher) parseTarget(filename string, partitioned bool) (fileWithTime, bool) {
+	if f, ok := m.parse(filename); ok || !partitioned {
+		return f, ok
+	}
+	f, ok := m.parse(path.Base(filename))
+	f.filename = filename
+	return f, ok
+}
+
+// patternTime the time of a dump from the values of its filename: its .now, or else its .year and whichever of
+// the others it has
+func patternTime(values map[string]string) (time.Time, bool) {
+	if now, ok := values["now"]; ok {
+		filetime, err := time.Parse(time.RFC3339, now[:13]+":"+now[14:16]+":"+now[17:])
+		return filetime, err == nil
+	}
+	part := func(name, fallback string) string {
+		if v, ok := values[name]; ok {
+			return v
+		}
+		return fallback
+	}
+	filetime, err := time.Parse(time.RFC3339, fmt.Sprintf("%s-%s-%sT%s:%s:%sZ", values["year"], part("month", "01"), part("day", "01"), part("hour", "00"), part("minute", "00"), part("second", "00")))
+	return filetime, err == nil
+}
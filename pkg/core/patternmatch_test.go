@@ -0,0 +1,52 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatternMatcher(t *testing.T) {
+	dumped := time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		pattern  string
+		filename string
+		expected fileWithTime
+		ok       bool
+	}{
+		{"now", "prod-{{ .now }}.{{ .compression }}", "prod-2021-01-01T00:30:00Z.tgz", fileWithTime{filetime: dumped}, true},
+		{"safechars", "prod-{{ .now }}.{{ .compression }}", "prod-2021-01-01T00-30-00Z.tgz", fileWithTime{filetime: dumped}, true},
+		{"folders by date", "{{ .year }}/{{ .month }}/{{ .day }}/db_{{ .hour }}{{ .minute }}.{{ .compression }}", "2021/01/01/db_0030.tbz2", fileWithTime{filetime: dumped}, true},
+		{"only the date", "db_{{ .year }}{{ .month }}{{ .day }}.{{ .compression }}", "db_20210101.tgz", fileWithTime{filetime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}, true},
+		{"server and label", "{{ .server }}/{{ .now }}{{ if .label }}-{{ .label }}{{ end }}.{{ .compression }}", "db1/2021-01-01T00:30:00Z-nightly.tgz", fileWithTime{filetime: dumped, server: "db1", label: "nightly"}, true},
+		{"without label", "{{ .server }}/{{ .now }}{{ if .label }}-{{ .label }}{{ end }}.{{ .compression }}", "db1/2021-01-01T00:30:00Z.tgz", fileWithTime{filetime: dumped, server: "db1"}, true},
+		{"separate table", "{{ .now }}{{ if .table }}_{{ .database }}.{{ .table }}{{ end }}.{{ .compression }}", "2021-01-01T00:30:00Z_app.events.tgz", fileWithTime{filetime: dumped, table: "app.events"}, true},
+		{"other name", "prod-{{ .now }}.{{ .compression }}", "staging-2021-01-01T00:30:00Z.tgz", fileWithTime{}, false},
+		{"invalid time", "db_{{ .year }}{{ .month }}{{ .day }}.{{ .compression }}", "db_20211301.tgz", fileWithTime{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newPatternMatcher(tt.pattern)
+			require.NoError(t, err)
+			f, ok := m.parse(tt.filename)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				tt.expected.filename = tt.filename
+				assert.Equal(t, tt.expected, f)
+			}
+		})
+	}
+}
+
+func TestPatternMatcherInvalid(t *testing.T) {
+	_, err := newPatternMatcher("{{ .now")
+	assert.Error(t, err)
+	_, err = newPatternMatcher("latest.{{ .compression }}")
+	assert.EqualError(t, err, `filename pattern "latest.{{ .compression }}" has no time of the dump, as .now or .year`)
+	// the time must be in every form of the pattern, else the dumps of that form cannot be pruned
+	_, err = newPatternMatcher("{{ if .label }}{{ .label }}{{ else }}{{ .now }}{{ end }}.{{ .compression }}")
+	assert.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// IONiceIdle the idle I/O scheduling class, which gets the disk only when no other process wants it
+	IONiceIdle = "idle"
+	// IONiceBestEffort the best-effort I/O scheduling class, at its lowest priority
+	IONiceBestEffort = "best-effort"
+
+	// maxNice the lowest CPU priority, as for nice
+	maxNice = 19
+)
+
+// errPriorityUnsupported the platform has no way to lower the priority of the process
+var errPriorityUnsupported = errors.New("lowering priority is not supported on this platform")
+
+// PriorityOptions the lower CPU and I/O priority at which to dump, so that a dump competes less with the
+// database for the host. It applies to the whole process, and to the scripts and programs it runs, and
+// cannot be raised again once lowered.
+type PriorityOptions struct {
+	// Nice the niceness at which to run, from 1 to 19, the lowest priority, as for nice; 0 to leave it as it is
+	Nice int
+	// IONice the I/O scheduling class in which to run, IONiceIdle or IONiceBestEffort; empty to leave it as it is
+	IONice string
+}
+
+// ValidatePriority check the CPU and I/O priority at which to dump
+func ValidatePriority(opts PriorityOptions) error {
+	if opts.Nice < 0 || opts.Nice > maxNice {
+		return fmt.Errorf("invalid nice %d, must be from 0 to %d", opts.Nice, maxNice)
+	}
+	switch opts.IONice {
+	case "", IONiceIdle, IONiceBestEffort:
+		return nil
+	default:
+		return fmt.Errorf("invalid ionice %q, must be one of: %s, %s", opts.IONice, IONiceIdle, IONiceBestEffort)
+	}
+}
+
+// lowerPriority lower the priority of the process as set by opts. A dump at the usual priority is better than
+// none, so failures, including on platforms that cannot, are only logged.
+func lowerPriority(opts PriorityOptions, logger *log.Entry) {
+	if opts == (PriorityOptions{}) {
+		return
+	}
+	err := setPriority(opts)
+	switch {
+	case errors.Is(err, errPriorityUnsupported):
+		logger.Infof("skipped lowering priority to nice %d, ionice %q: %v", opts.Nice, opts.IONice, err)
+	case err != nil:
+		logger.Warnf("unable to lower priority to nice %d, ionice %q: %v", opts.Nice, opts.IONice, err)
+	default:
+		logger.Debugf("lowered priority to nice %d, ionice %q", opts.Nice, opts.IONice)
+	}
+}
@@ -0,0 +1,60 @@
+//go:build linux
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+const (
+	// ioprioWhoProcess ioprio_set of a single thread, IOPRIO_WHO_PROCESS
+	ioprioWhoProcess = 1
+	// ioprioClassShift the bits of the level below the class in an I/O priority
+	ioprioClassShift = 13
+	// ioprioClassBestEffort and ioprioClassIdle the I/O scheduling classes, IOPRIO_CLASS_BE and IOPRIO_CLASS_IDLE
+	ioprioClassBestEffort = 2
+	ioprioClassIdle       = 3
+	// ioprioLowestLevel the lowest priority within the best-effort class
+	ioprioLowestLevel = 7
+)
+
+// setPriority lower the CPU and I/O priority of each thread of the process. On Linux both are of each thread,
+// not of the process; as threads inherit them from the thread that creates them, so does every later thread.
+func setPriority(opts PriorityOptions) error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return fmt.Errorf("unable to list threads: %v", err)
+	}
+	var ioprio uintptr
+	switch opts.IONice {
+	case IONiceIdle:
+		ioprio = ioprioClassIdle << ioprioClassShift
+	case IONiceBestEffort:
+		ioprio = ioprioClassBestEffort<<ioprioClassShift | ioprioLowestLevel
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if opts.Nice > 0 {
+			// the raw priority is 20 minus the niceness; one that is already nicer is left, as it cannot be raised
+			prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, tid)
+			if err == nil && 20-prio < opts.Nice {
+				err = syscall.Setpriority(syscall.PRIO_PROCESS, tid, opts.Nice)
+			}
+			if err != nil {
+				return fmt.Errorf("unable to set nice of thread %d: %v", tid, err)
+			}
+		}
+		if ioprio != 0 {
+			if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprio); errno != 0 {
+				return fmt.Errorf("unable to set ionice of thread %d: %v", tid, errno)
+			}
+		}
+	}
+	return nil
+}
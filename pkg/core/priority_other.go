@@ -0,0 +1,8 @@
+//go:build !linux
+
+package core
+
+// setPriority lowering priority is only supported on Linux
+func setPriority(opts PriorityOptions) error {
+	return errPriorityUnsupported
+}
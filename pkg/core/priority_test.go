@@ -0,0 +1,16 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePriority(t *testing.T) {
+	assert.NoError(t, ValidatePriority(PriorityOptions{}))
+	assert.NoError(t, ValidatePriority(PriorityOptions{Nice: 19, IONice: IONiceIdle}))
+	assert.NoError(t, ValidatePriority(PriorityOptions{Nice: 5, IONice: IONiceBestEffort}))
+	assert.Error(t, ValidatePriority(PriorityOptions{Nice: -5}))
+	assert.Error(t, ValidatePriority(PriorityOptions{Nice: 20}))
+	assert.Error(t, ValidatePriority(PriorityOptions{IONice: "realtime"}))
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/tracing"
+)
+
+// protectedPrefix prefix of the marker on each target for a dump that is protected from pruning. As for a checksum
+// reference, the rest of the name is the hash of the name of the dump, which may be in a directory, so that the
+// marker is at the top of the target, and the prune finds it in the listing that it reads anyway.
+const protectedPrefix = ".mysql-backup-protected-"
+
+// protectedMarker the content of the marker for a protected dump, for whoever reads it; only its name matters to
+// the prune
+type protectedMarker struct {
+	Filename  string    `json:"filename"`
+	Protected time.Time `json:"protected"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// protectedFilename the name on the target of the marker for the dump filename
+func protectedFilename(filename string) string {
+	return fmt.Sprintf("%s%x.json", protectedPrefix, sha256.Sum256([]byte(filename)))
+}
+
+// Protect mark a dump on a target as protected, so that no prune removes it, whatever the retention policy, or,
+// with Unprotect, remove the mark, so that it is pruned as any other. The dump is chosen as for Restore.
+func (e *Executor) Protect(ctx context.Context, opts ProtectOptions) (err error) {
+	logger := e.Logger.WithField("run", opts.Run.String())
+	logger.Level = e.Logger.Level
+	ctx, span := tracing.Start(ctx, "protect", attribute.String("run", opts.Run.String()), attribute.Bool("unprotect", opts.Unprotect), attribute.String("target.type", opts.Target.Protocol()), attribute.String("target.url", tracing.RedactURL(opts.Target.URL())))
+	defer func() { tracing.End(span, err) }()
+
+	verb := "protecting"
+	if opts.Unprotect {
+		verb = "unprotecting"
+	}
+	// a stream keeps no dumps to protect
+	if storage.IsStream(opts.Target) {
+		return fmt.Errorf("cannot protect a dump on a stream, such as stdout")
+	}
+	file, err := chooseDump(ctx, opts.Target, opts.TargetFile, opts.Newest, opts.Label, 0, verb, logger)
+	if err != nil {
+		return err
+	}
+	if file == "" {
+		return fmt.Errorf("no dump to protect")
+	}
+	span.SetAttributes(attribute.String("filename", file))
+	marker := protectedFilename(file)
+
+	if opts.Unprotect {
+		// the dump itself need not still be there, e.g. if it was removed by hand
+		if !targetHasFile(ctx, opts.Target, marker, logger) {
+			logger.Infof("dump %s on target %s is not protected", file, opts.Target.URL())
+			return nil
+		}
+		if err := opts.Target.Remove(ctx, marker, logger); err != nil {
+			return fmt.Errorf("failed to remove protection of %s: %v", file, err)
+		}
+		logger.Infof("dump %s on target %s is no longer protected, and is pruned as any other", file, opts.Target.URL())
+		return nil
+	}
+
+	if !targetHasFile(ctx, opts.Target, file, logger) {
+		if !targetHasFile(ctx, opts.Target, checksumRefFilename(file), logger) {
+			return fmt.Errorf("dump %s not found on target %s", file, opts.Target.URL())
+		}
+		logger.Warnf("dump %s was not uploaded, as it duplicates another dump, which is not protected with it", file)
+	}
+	tmpdir, err := os.MkdirTemp("", "databacker_protect")
+	if err != nil {
+		return fmt.Errorf("failed to make temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	if err := pushJSON(ctx, opts.Target, marker, protectedMarker{Filename: file, Protected: time.Now().UTC(), Reason: opts.Reason}, tmpdir, logger); err != nil {
+		return fmt.Errorf("failed to protect %s: %v", file, err)
+	}
+	logger.Infof("dump %s on target %s is protected from pruning", file, opts.Target.URL())
+	return nil
+}
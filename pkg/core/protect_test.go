@@ -0,0 +1,72 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+	"github.com/databacker/mysql-backup/pkg/storage/stdio"
+)
+
+func TestProtect(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC)
+	filenames := []string{
+		"db_backup_2020-12-29T00:00:00Z.gz", "db_backup_2020-12-30T00:00:00Z.gz",
+		"db_backup_2020-12-31T00:00:00Z.gz", "db_backup_2021-01-01T00:00:00Z.gz",
+		"db_backup_2020-12-28T00:00:00Z__pre-migration.gz",
+	}
+	dir := t.TempDir()
+	for _, filename := range filenames {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, filename), nil, 0o644))
+	}
+	target := file.New(url.URL{Scheme: "file", Path: dir})
+	logger := log.New()
+	logger.Out = io.Discard
+	executor := Executor{Logger: logger}
+	ctx := context.Background()
+
+	require.NoError(t, executor.Protect(ctx, ProtectOptions{Target: target, TargetFile: filenames[0], Reason: "known good", Run: uuid.New()}))
+	b, err := os.ReadFile(filepath.Join(dir, protectedFilename(filenames[0])))
+	require.NoError(t, err)
+	var marker protectedMarker
+	require.NoError(t, json.Unmarshal(b, &marker))
+	assert.Equal(t, filenames[0], marker.Filename)
+	assert.Equal(t, "known good", marker.Reason)
+	// the newest with a label
+	require.NoError(t, executor.Protect(ctx, ProtectOptions{Target: target, Label: "pre-migration", Run: uuid.New()}))
+	assert.FileExists(t, filepath.Join(dir, protectedFilename(filenames[4])))
+
+	// the protected dump is neither removed nor counted, so the 2 most recent others are kept
+	require.NoError(t, executor.Prune(ctx, PruneOptions{Targets: []storage.Storage{target}, KeepLast: 2, Now: now}))
+	assert.FileExists(t, filepath.Join(dir, filenames[0]))
+	assert.NoFileExists(t, filepath.Join(dir, filenames[1]))
+	assert.FileExists(t, filepath.Join(dir, filenames[2]))
+	assert.FileExists(t, filepath.Join(dir, filenames[3]))
+
+	// once unprotected, it is pruned as any other
+	require.NoError(t, executor.Protect(ctx, ProtectOptions{Target: target, TargetFile: filenames[0], Unprotect: true, Run: uuid.New()}))
+	assert.NoFileExists(t, filepath.Join(dir, protectedFilename(filenames[0])))
+	require.NoError(t, executor.Prune(ctx, PruneOptions{Targets: []storage.Storage{target}, KeepLast: 2, Now: now}))
+	assert.NoFileExists(t, filepath.Join(dir, filenames[0]))
+	// unprotecting what is not protected does nothing
+	assert.NoError(t, executor.Protect(ctx, ProtectOptions{Target: target, TargetFile: filenames[0], Unprotect: true, Run: uuid.New()}))
+
+	t.Run("missing", func(t *testing.T) {
+		assert.ErrorContains(t, executor.Protect(ctx, ProtectOptions{Target: target, TargetFile: "db_backup_2020-01-01T00:00:00Z.gz", Run: uuid.New()}), "not found")
+	})
+	t.Run("stream", func(t *testing.T) {
+		assert.ErrorContains(t, executor.Protect(ctx, ProtectOptions{Target: stdio.New(nil, nil), TargetFile: filenames[2], Run: uuid.New()}), "stream")
+	})
+}
@@ -0,0 +1,22 @@
+package core
+
+import (
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// ProtectOptions which dump on a target to protect from pruning, or to no longer protect
+type ProtectOptions struct {
+	Target     storage.Storage
+	TargetFile string
+	// Newest TargetFile is a pattern, as for NewestMatching, and the newest file that matches it is protected
+	Newest bool
+	// Label protect the newest dump on the target with this label, as by NewestWithLabel, rather than TargetFile,
+	// which must be empty
+	Label string
+	// Reason why the dump is protected, e.g. "before the 2.0 migration", recorded with it for whoever reads it
+	Reason string
+	// Unprotect remove the protection of the dump, so that it is pruned as any other, rather than protect it
+	Unprotect bool
+	Run       uuid.UUID
+}
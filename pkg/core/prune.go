@@ -1,43 +1,106 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"path"
 	"regexp"
 	"slices"
 	"strconv"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/tracing"
 )
 
-// filenameRE is a regular expression to match a backup filename
-var filenameRE = regexp.MustCompile(`^db_backup_(\d{4})-(\d{2})-(\d{2})T(\d{2})[:-](\d{2})[:-](\d{2})Z\.\w+$`)
+// filenameRE is a regular expression to match a backup filename, optionally with the name of the server
+// when dumping multiple servers, and the label of the dump after a double underscore
+var filenameRE = regexp.MustCompile(`^db_backup_(\d{4})-(\d{2})-(\d{2})T(\d{2})[:-](\d{2})[:-](\d{2})Z(?:_([A-Za-z0-9-]+))?(?:__([A-Za-z0-9-]+))?\.\w+$`)
+
+// separateTableFilenameRE is a regular expression to match the filename of a separate table of a backup, whose
+// <database>.<table> follows the time, with the name of the server before it when dumping multiple servers, and
+// the label of the dump after it, after a double underscore
+var separateTableFilenameRE = regexp.MustCompile(`^db_backup_(\d{4})-(\d{2})-(\d{2})T(\d{2})[:-](\d{2})[:-](\d{2})Z_([^./]+\.[^./]+?)(?:__([A-Za-z0-9-]+))?\.\w+$`)
 
 // Prune prune older backups
-func (e *Executor) Prune(opts PruneOptions) error {
+func (e *Executor) Prune(ctx context.Context, opts PruneOptions) (err error) {
 	logger := e.Logger.WithField("run", opts.Run.String())
 	logger.Level = e.Logger.Level
+	ctx, span := tracing.Start(ctx, "prune", attribute.String("run", opts.Run.String()), attribute.String("label", opts.Label), attribute.Bool("dry_run", opts.DryRun))
+	defer func() { tracing.End(span, err) }()
 	logger.Info("beginning prune")
-	var (
-		candidates []string
-		now        = opts.Now
-	)
+	now := opts.Now
 	if now.IsZero() {
 		now = time.Now()
 	}
-	retainHours, err1 := convertToHours(opts.Retention)
-	retainCount, err2 := convertToCount(opts.Retention)
-	if err1 != nil && err2 != nil {
-		return fmt.Errorf("invalid retention string: %s", opts.Retention)
+	defaultPolicy := PrunePolicy{Retention: opts.Retention, KeepLast: opts.KeepLast, KeepWithin: opts.KeepWithin}
+	keepLast, keepHours, defaultErr := retentionPolicy(defaultPolicy)
+	// the default policy need only be valid for the targets that do not have their own, and with policies for
+	// particular targets, there need not be one at all, in which case the other targets are not pruned
+	if defaultErr != nil && len(opts.TargetPolicies) == 0 {
+		return defaultErr
 	}
+	skipOthers := defaultPolicy == PrunePolicy{}
 	if len(opts.Targets) == 0 {
 		return errors.New("no targets")
 	}
+	if err := ValidateLabel(opts.Label); err != nil {
+		return err
+	}
+	// check the policy of every target before removing anything from any of them
+	type policy struct {
+		keepLast, keepHours int
+		skip                bool
+		// matcher the filename pattern of the target, if it has one of its own
+		matcher *patternMatcher
+	}
+	policies := make([]policy, len(opts.Targets))
+	for i, target := range opts.Targets {
+		var matcher *patternMatcher
+		if pattern := opts.TargetFilenamePatterns[target.URL()]; pattern != "" {
+			if matcher, err = newPatternMatcher(pattern); err != nil {
+				return fmt.Errorf("target %s: %v", target.URL(), err)
+			}
+		}
+		targetPolicy, ok := opts.TargetPolicies[target.URL()]
+		switch {
+		case ok:
+			keepLast, keepHours, err := retentionPolicy(targetPolicy)
+			if err != nil {
+				return fmt.Errorf("target %s: %v", target.URL(), err)
+			}
+			policies[i] = policy{keepLast: keepLast, keepHours: keepHours, matcher: matcher}
+		case skipOthers:
+			policies[i] = policy{skip: true}
+		case defaultErr != nil:
+			return defaultErr
+		default:
+			policies[i] = policy{keepLast: keepLast, keepHours: keepHours, matcher: matcher}
+		}
+	}
 
-	for _, target := range opts.Targets {
-		var pruned int
+	for i, target := range opts.Targets {
+		var (
+			candidates []string
+			pruned     int
+			keepLast   = policies[i].keepLast
+			keepHours  = policies[i].keepHours
+		)
+		if policies[i].skip {
+			logger.Debugf("not pruning target %s, which has no retention policy", target)
+			continue
+		}
+		if storage.IsStream(target) {
+			logger.Debugf("not pruning target %s, which is a stream", target.URL())
+			continue
+		}
 
 		logger.Debugf("pruning target %s", target)
-		files, err := target.ReadDir(".", logger)
+		files, err := target.ReadDir(ctx, ".", logger)
 		if err != nil {
 			return fmt.Errorf("failed to read directory: %v", err)
 		}
@@ -45,78 +108,159 @@ func (e *Executor) Prune(opts PruneOptions) error {
 		// create a slice with the filenames and their calculated times - these are *not* the timestamp times, but the times calculated from the filenames
 		var filesWithTimes []fileWithTime
 
+		// the markers of the protected dumps are at the top of the target, so in the listing wherever the dumps are
+		listed := map[string]bool{}
 		for _, fileInfo := range files {
-			filename := fileInfo.Name()
-			matches := filenameRE.FindStringSubmatch(filename)
-			if matches == nil {
+			listed[fileInfo.Name()] = true
+		}
+		partitioned := storage.IsPartitioned(target)
+		// parse the name of a dump, and check that it is one to prune
+		parse := func(filename string) (fileWithTime, bool) {
+			f, ok := parseTargetFilename(filename, partitioned)
+			// those named by the pattern of the target, as well as those named by the default, e.g. from before
+			// the target had a pattern, or those that the pattern cannot name, such as of one of several servers
+			if matcher := policies[i].matcher; matcher != nil && !ok {
+				f, ok = matcher.parseTarget(filename, partitioned)
+			}
+			if !ok {
 				logger.Debugf("ignoring filename that is not standard backup pattern: %s", filename)
-				continue
+				return f, false
+			}
+			// only the dumps with the label are pruned, so that each label can have its own retention
+			if f.label != opts.Label {
+				logger.Debugf("ignoring file %s, which does not have label %q", filename, opts.Label)
+				return f, false
+			}
+			// a protected dump is never removed, nor counted, so that it does not take the place of another
+			if listed[protectedFilename(f.filename)] {
+				logger.Debugf("ignoring file %s, which is protected", filename)
+				return f, false
 			}
 			logger.Debugf("checking filename that is standard backup pattern: %s", filename)
-
-			// Parse the date from the filename
-			year, month, day, hour, minute, second := matches[1], matches[2], matches[3], matches[4], matches[5], matches[6]
-			dateTimeStr := fmt.Sprintf("%s-%s-%sT%s:%s:%sZ", year, month, day, hour, minute, second)
-			filetime, err := time.Parse(time.RFC3339, dateTimeStr)
-			if err != nil {
-				logger.Debugf("Error parsing date from filename %s: %v; ignoring", filename, err)
+			return f, true
+		}
+		// the dumps that are only a reference to, or a symlink to, an identical dump, which must be kept with them
+		duplicates, err := readDuplicates(ctx, target, files, logger)
+		if err != nil {
+			return fmt.Errorf("failed to read duplicate dumps on target %s: %v", target.URL(), err)
+		}
+		for _, fileInfo := range files {
+			if f, ok := parse(fileInfo.Name()); ok {
+				filesWithTimes = append(filesWithTimes, f)
+			}
+		}
+		// a dump stored as a reference is not listed under its own name, so it is pruned by removing its reference
+		for _, d := range duplicates {
+			if d.name == d.filename {
 				continue
 			}
-			filesWithTimes = append(filesWithTimes, fileWithTime{
-				filename: filename,
-				filetime: filetime,
-			})
+			if f, ok := parse(d.filename); ok {
+				f.filename = d.name
+				filesWithTimes = append(filesWithTimes, f)
+			}
 		}
 
-		switch {
-		case retainHours > 0:
-			// if we had retainHours, we go through all of the files and find any whose timestamp is older than now-retainHours
-			for _, f := range filesWithTimes {
-				// Check if the file is within 'retain' hours from 'now'
-				age := now.Sub(f.filetime).Hours()
-				if age < float64(retainHours) {
-					logger.Debugf("file %s is %f hours old", f.filename, age)
-					logger.Debugf("keeping file %s", f.filename)
-					continue
-				}
-				logger.Debugf("Adding candidate file: %s", f.filename)
-				candidates = append(candidates, f.filename)
+		// sort all of the files by timestamp, most recent first, so the first keepLast are the ones to keep by count
+		slices.SortFunc(filesWithTimes, func(i, j fileWithTime) int {
+			switch {
+			case i.filetime.After(j.filetime):
+				return -1
+			case i.filetime.Before(j.filetime):
+				return 1
 			}
-		case retainCount > 0:
-			// if we had retainCount, we sort all of the files by timestamp, and add to the list all except the retainCount most recent
-			slices.SortFunc(filesWithTimes, func(i, j fileWithTime) int {
-				switch {
-				case i.filetime.Before(j.filetime):
-					return -1
-				case i.filetime.After(j.filetime):
-					return 1
-				}
-				return 0
-			})
-			slices.Reverse(filesWithTimes)
-			if retainCount >= len(filesWithTimes) {
-				for i := 0 + retainCount; i < len(filesWithTimes); i++ {
-					logger.Debugf("Adding candidate file %s:", filesWithTimes[i].filename)
-					candidates = append(candidates, filesWithTimes[i].filename)
+			return 0
+		})
+		// a file is kept if any of the policies keeps it. The count is per server, and per separate table, so
+		// that each server, and each table, keeps its own most recent backups, whatever else is on the target.
+		counts := map[string]int{}
+		for _, f := range filesWithTimes {
+			// a server name has no '.', and a table always has one, so they cannot be confused
+			group := f.server + f.table
+			i := counts[group]
+			counts[group]++
+			age := now.Sub(f.filetime).Hours()
+			switch {
+			case age < 0:
+				// never remove a file from the future; either it or our clock is wrong
+				logger.Warnf("file %s is dated after the current time %s, possible clock skew; keeping", f.filename, now.Format(time.RFC3339))
+				continue
+			case keepLast > 0 && i < keepLast:
+				logger.Debugf("keeping file %s, one of the %d most recent", f.filename, keepLast)
+				continue
+			case keepHours > 0 && age < float64(keepHours):
+				logger.Debugf("keeping file %s, %f hours old", f.filename, age)
+				continue
+			}
+			logger.Debugf("Adding candidate file: %s", f.filename)
+			candidates = append(candidates, f.filename)
+		}
+
+		// a dump that a reference or symlink that is kept depends on is kept too, however old, and so are those of
+		// other labels, which are not pruned here, else the duplicates would be left with nothing to restore. A
+		// symlink can be to another, so repeat until every dump that a kept one depends on is kept.
+		removing := map[string]bool{}
+		for _, filename := range candidates {
+			removing[filename] = true
+		}
+		for kept := true; kept; {
+			kept = false
+			for _, d := range duplicates {
+				if !removing[d.name] && removing[d.duplicateOf] {
+					logger.Debugf("keeping file %s, as the kept %s is a duplicate of it", d.duplicateOf, d.filename)
+					delete(removing, d.duplicateOf)
+					kept = true
 				}
 			}
-		default:
-			return fmt.Errorf("invalid retention string: %s", opts.Retention)
 		}
+		candidates = slices.DeleteFunc(candidates, func(filename string) bool { return !removing[filename] })
 
 		// we have the list, remove them all
 		for _, filename := range candidates {
-			if err := target.Remove(filename, logger); err != nil {
+			if opts.DryRun {
+				logger.Infof("dry run: would remove file %s from target %s", filename, target.URL())
+				continue
+			}
+			if err := target.Remove(ctx, filename, logger); err != nil {
 				return fmt.Errorf("failed to remove file %s: %v", filename, err)
 			}
 			pruned++
 		}
 		logger.Debugf("pruning %d files from target %s", pruned, target)
+		span.AddEvent("pruned target", trace.WithAttributes(attribute.String("target.type", target.Protocol()), attribute.String("target.url", tracing.RedactURL(target.URL())),
+			attribute.Int("candidates", len(candidates)), attribute.Int("removed", pruned)))
 	}
 
 	return nil
 }
 
+// retentionPolicy get the number of most recent files to keep, and the age in hours within which to keep files,
+// from the policy. Either may be 0, meaning that policy does not apply, but not both.
+func retentionPolicy(opts PrunePolicy) (keepLast, keepHours int, err error) {
+	if opts.Retention != "" {
+		if opts.KeepLast != 0 || opts.KeepWithin != "" {
+			return 0, 0, errors.New("retention cannot be combined with keep-last or keep-within")
+		}
+		retainHours, err1 := convertToHours(opts.Retention)
+		retainCount, err2 := convertToCount(opts.Retention)
+		if (err1 != nil && err2 != nil) || (retainHours <= 0 && retainCount <= 0) {
+			return 0, 0, fmt.Errorf("invalid retention string: %s", opts.Retention)
+		}
+		return retainCount, retainHours, nil
+	}
+	if opts.KeepLast < 0 {
+		return 0, 0, fmt.Errorf("invalid keep-last: %d", opts.KeepLast)
+	}
+	if opts.KeepWithin != "" {
+		if keepHours, err = convertToHours(opts.KeepWithin); err != nil || keepHours <= 0 {
+			return 0, 0, fmt.Errorf("invalid keep-within: %s", opts.KeepWithin)
+		}
+	}
+	if opts.KeepLast == 0 && keepHours == 0 {
+		return 0, 0, fmt.Errorf("invalid retention string: %s", opts.Retention)
+	}
+	return opts.KeepLast, keepHours, nil
+}
+
 // convertToHours takes a string with format "<integer><unit>" and converts it to hours.
 // The unit can be 'h' (hours), 'd' (days), 'w' (weeks), 'm' (months), 'y' (years).
 // Assumes 30 days in a month and 365 days in a year for conversion.
@@ -177,4 +321,44 @@ func convertToCount(input string) (int, error) {
 type fileWithTime struct {
 	filename string
 	filetime time.Time
+	// server the server the backup is of, if the filename includes it
+	server string
+	// label the label of the backup, if any
+	label string
+	// table the <database>.<table> of a separate table, preceded by its server, if any; empty for a main dump
+	table string
+}
+
+// parseBackupFilename the time, server and label of a backup from its filename, or the time and table of a
+// separate table, which must be in the default format, else false. The time is the one in the filename, not
+// that on the target.
+func parseBackupFilename(filename string) (fileWithTime, bool) {
+	if matches := filenameRE.FindStringSubmatch(filename); matches != nil {
+		filetime, ok := filenameTime(matches)
+		return fileWithTime{filename: filename, filetime: filetime, server: matches[7], label: matches[8]}, ok
+	}
+	if matches := separateTableFilenameRE.FindStringSubmatch(filename); matches != nil {
+		filetime, ok := filenameTime(matches)
+		return fileWithTime{filename: filename, filetime: filetime, label: matches[8], table: matches[7]}, ok
+	}
+	return fileWithTime{}, false
+}
+
+// parseTargetFilename parse the filename of a backup on a target, as by parseBackupFilename. If the target is
+// partitioned, the backups are in folders, e.g. by date, so only the last part of the filename is parsed, and the
+// whole is kept, so that it can be removed.
+func parseTargetFilename(filename string, partitioned bool) (fileWithTime, bool) {
+	if !partitioned {
+		return parseBackupFilename(filename)
+	}
+	f, ok := parseBackupFilename(path.Base(filename))
+	f.filename = filename
+	return f, ok
+}
+
+// filenameTime the time in the first six of the submatches of a backup filename
+func filenameTime(matches []string) (time.Time, bool) {
+	year, month, day, hour, minute, second := matches[1], matches[2], matches[3], matches[4], matches[5], matches[6]
+	filetime, err := time.Parse(time.RFC3339, fmt.Sprintf("%s-%s-%sT%s:%s:%sZ", year, month, day, hour, minute, second))
+	return filetime, err == nil
 }
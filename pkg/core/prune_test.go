@@ -1,17 +1,24 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/url"
 	"os"
+	"path/filepath"
 	"slices"
 	"testing"
 	"time"
 
 	"github.com/databacker/mysql-backup/pkg/storage"
 	"github.com/databacker/mysql-backup/pkg/storage/credentials"
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+	"github.com/databacker/mysql-backup/pkg/storage/upload"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConvertToHours(t *testing.T) {
@@ -93,6 +100,80 @@ func TestPrune(t *testing.T) {
 		{"2 days safe names", PruneOptions{Retention: "2d", Now: now}, safefilenames, safefilenames[0:6], nil},
 		// 3 weeks - file[13] is 504h+30m = 504.5h, so it should be pruned
 		{"3 weeks safe names", PruneOptions{Retention: "3w", Now: now}, safefilenames, safefilenames[0:13], nil},
+		// count - keep the 3 most recent
+		{"3 count", PruneOptions{Retention: "3c", Now: now}, filenames, filenames[0:3], nil},
+		// combined - whichever of count or age keeps more
+		{"keep last more than within", PruneOptions{KeepLast: 7, KeepWithin: "1h", Now: now}, filenames, filenames[0:7], nil},
+		{"keep within more than last", PruneOptions{KeepLast: 1, KeepWithin: "2d", Now: now}, filenames, filenames[0:6], nil},
+		{"keep last only", PruneOptions{KeepLast: 2, Now: now}, filenames, filenames[0:2], nil},
+		{"retention with keep last", PruneOptions{Retention: "1h", KeepLast: 2, Now: now}, nil, nil, fmt.Errorf("retention cannot be combined with keep-last or keep-within")},
+		{"invalid keep within", PruneOptions{KeepWithin: "2x", Now: now}, nil, nil, fmt.Errorf("invalid keep-within: 2x")},
+		// counts are per server
+		{"count per server", PruneOptions{Retention: "1c", Now: now}, []string{
+			"db_backup_2020-12-30T00:00:00Z_db1.gz", "db_backup_2020-12-31T00:00:00Z_db1.gz",
+			"db_backup_2020-12-30T00:00:00Z_db2.gz", "db_backup_2020-12-31T00:00:00Z_db2.gz",
+		}, []string{"db_backup_2020-12-31T00:00:00Z_db1.gz", "db_backup_2020-12-31T00:00:00Z_db2.gz"}, nil},
+		// counts are per separate table, apart from the main dumps and from the other tables, of the same database or another
+		{"count per separate table", PruneOptions{Retention: "1c", Now: now}, []string{
+			"db_backup_2020-12-30T00:00:00Z.gz", "db_backup_2020-12-31T00:00:00Z.gz",
+			"db_backup_2020-12-30T00:00:00Z_app.users.gz", "db_backup_2020-12-31T00:00:00Z_app.users.gz",
+			"db_backup_2020-12-29T00:00:00Z_app.orders.gz", "db_backup_2020-12-30T00:00:00Z_app.orders.gz",
+			"db_backup_2020-12-28T00:00:00Z_billing.invoices.gz",
+			"db_backup_2020-12-30T00:00:00Z_db1_app.users.gz", "db_backup_2020-12-31T00:00:00Z_db1_app.users.gz",
+			"db_backup_2020-12-30T00:00:00Z_db1.gz",
+		}, []string{
+			"db_backup_2020-12-31T00:00:00Z.gz",
+			"db_backup_2020-12-31T00:00:00Z_app.users.gz",
+			"db_backup_2020-12-30T00:00:00Z_app.orders.gz",
+			"db_backup_2020-12-28T00:00:00Z_billing.invoices.gz",
+			"db_backup_2020-12-31T00:00:00Z_db1_app.users.gz",
+			"db_backup_2020-12-30T00:00:00Z_db1.gz",
+		}, nil},
+		// by age, separate tables are pruned like the main dumps
+		{"age of separate tables", PruneOptions{Retention: "1d", Now: now}, []string{
+			"db_backup_2020-12-29T00:00:00Z_app.users.gz", "db_backup_2020-12-31T12:00:00Z_app.users.gz",
+			"db_backup_2020-12-29T00:00:00Z_billing.invoices.gz",
+		}, []string{"db_backup_2020-12-31T12:00:00Z_app.users.gz"}, nil},
+		// only the dumps with the label are pruned, each server counted apart
+		{"label", PruneOptions{Retention: "1c", Label: "pre-deploy", Now: now}, []string{
+			"db_backup_2020-12-29T00:00:00Z.gz", "db_backup_2020-12-30T00:00:00Z.gz",
+			"db_backup_2020-12-29T00:00:00Z__pre-deploy.gz", "db_backup_2020-12-30T00:00:00Z__pre-deploy.gz",
+			"db_backup_2020-12-29T00:00:00Z_db1__pre-deploy.gz", "db_backup_2020-12-30T00:00:00Z_db1__pre-deploy.gz",
+			"db_backup_2020-12-29T00:00:00Z__nightly.gz",
+		}, []string{
+			"db_backup_2020-12-29T00:00:00Z.gz", "db_backup_2020-12-30T00:00:00Z.gz",
+			"db_backup_2020-12-30T00:00:00Z__pre-deploy.gz", "db_backup_2020-12-30T00:00:00Z_db1__pre-deploy.gz",
+			"db_backup_2020-12-29T00:00:00Z__nightly.gz",
+		}, nil},
+		// the separate tables of labelled dumps have the label too, and are pruned with them, not without a label
+		{"label of separate tables", PruneOptions{Retention: "1c", Label: "nightly", Now: now}, []string{
+			"db_backup_2020-12-29T00:00:00Z__nightly.gz", "db_backup_2020-12-30T00:00:00Z__nightly.gz",
+			"db_backup_2020-12-29T00:00:00Z_app.users__nightly.gz", "db_backup_2020-12-30T00:00:00Z_app.users__nightly.gz",
+			"db_backup_2020-12-29T00:00:00Z_db1_app.users__nightly.gz", "db_backup_2020-12-30T00:00:00Z_db1_app.users__nightly.gz",
+			"db_backup_2020-12-29T00:00:00Z_app.users.gz", "db_backup_2020-12-30T00:00:00Z_app.users.gz",
+		}, []string{
+			"db_backup_2020-12-30T00:00:00Z__nightly.gz",
+			"db_backup_2020-12-30T00:00:00Z_app.users__nightly.gz",
+			"db_backup_2020-12-30T00:00:00Z_db1_app.users__nightly.gz",
+			"db_backup_2020-12-29T00:00:00Z_app.users.gz", "db_backup_2020-12-30T00:00:00Z_app.users.gz",
+		}, nil},
+		{"no label of separate tables", PruneOptions{Retention: "1c", Now: now}, []string{
+			"db_backup_2020-12-29T00:00:00Z_app.users__nightly.gz", "db_backup_2020-12-30T00:00:00Z_app.users__nightly.gz",
+			"db_backup_2020-12-29T00:00:00Z_app.users.gz", "db_backup_2020-12-30T00:00:00Z_app.users.gz",
+		}, []string{
+			"db_backup_2020-12-29T00:00:00Z_app.users__nightly.gz", "db_backup_2020-12-30T00:00:00Z_app.users__nightly.gz",
+			"db_backup_2020-12-30T00:00:00Z_app.users.gz",
+		}, nil},
+		// without a label, only the dumps without one are pruned
+		{"no label", PruneOptions{Retention: "1c", Now: now}, []string{
+			"db_backup_2020-12-29T00:00:00Z.gz", "db_backup_2020-12-30T00:00:00Z.gz",
+			"db_backup_2020-12-29T00:00:00Z__pre-deploy.gz",
+		}, []string{"db_backup_2020-12-30T00:00:00Z.gz", "db_backup_2020-12-29T00:00:00Z__pre-deploy.gz"}, nil},
+		{"invalid label", PruneOptions{Retention: "1c", Label: "pre.deploy", Now: now}, []string{"db_backup_2020-12-29T00:00:00Z.gz"}, []string{"db_backup_2020-12-29T00:00:00Z.gz"}, fmt.Errorf(`invalid label "pre.deploy", must be letters, digits and '-'`)},
+		// dry run removes nothing
+		{"dry run", PruneOptions{Retention: "1h", DryRun: true, Now: now}, filenames, filenames, nil},
+		// files dated in the future are never removed
+		{"future file", PruneOptions{Retention: "1h", Now: now}, append([]string{"db_backup_2030-01-01T00:00:00Z.gz"}, filenames...), []string{"db_backup_2030-01-01T00:00:00Z.gz", filenames[0]}, nil},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -124,7 +205,7 @@ func TestPrune(t *testing.T) {
 			executor := Executor{
 				Logger: logger,
 			}
-			err := executor.Prune(tt.opts)
+			err := executor.Prune(context.Background(), tt.opts)
 			switch {
 			case (err == nil && tt.err != nil) || (err != nil && tt.err == nil):
 				t.Errorf("expected error %v, got %v", tt.err, err)
@@ -141,9 +222,240 @@ func TestPrune(t *testing.T) {
 			for _, file := range files {
 				afterFiles = append(afterFiles, file.Name())
 			}
+			// clone before sorting, as afterFiles shares its backing array with the other test cases
+			expected := slices.Clone(tt.afterFiles)
 			slices.Sort(afterFiles)
-			slices.Sort(tt.afterFiles)
-			assert.ElementsMatch(t, tt.afterFiles, afterFiles)
+			slices.Sort(expected)
+			assert.ElementsMatch(t, expected, afterFiles)
 		})
 	}
 }
+
+func TestPruneTargetPolicies(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC)
+	filenames := []string{
+		"db_backup_2020-12-29T00:00:00Z.gz", "db_backup_2020-12-30T00:00:00Z.gz",
+		"db_backup_2020-12-31T00:00:00Z.gz", "db_backup_2021-01-01T00:00:00Z.gz",
+	}
+	var (
+		targets []storage.Storage
+		dirs    []string
+	)
+	for i := 0; i < 2; i++ {
+		workDir := t.TempDir()
+		for _, filename := range filenames {
+			if err := os.WriteFile(fmt.Sprintf("%s/%s", workDir, filename), nil, 0644); err != nil {
+				t.Fatalf("failed to create file %s: %v", filename, err)
+			}
+		}
+		store, err := storage.ParseURL(fmt.Sprintf("file://%s", workDir), credentials.Creds{})
+		if err != nil {
+			t.Fatalf("failed to parse url: %v", err)
+		}
+		targets = append(targets, store)
+		dirs = append(dirs, workDir)
+	}
+	logger := log.New()
+	logger.Out = io.Discard
+	executor := Executor{Logger: logger}
+
+	// an invalid policy for one target fails before anything is removed from any of them
+	err := executor.Prune(context.Background(), PruneOptions{Targets: targets, Retention: "1h", Now: now, TargetPolicies: map[string]PrunePolicy{
+		targets[1].URL(): {KeepWithin: "2x"},
+	}})
+	assert.Error(t, err)
+
+	// with no default policy, a target without its own is not pruned
+	err = executor.Prune(context.Background(), PruneOptions{Targets: targets, Now: now, TargetPolicies: map[string]PrunePolicy{
+		targets[1].URL(): {KeepLast: 3},
+	}})
+	assert.NoError(t, err)
+	files, err := os.ReadDir(dirs[0])
+	assert.NoError(t, err)
+	assert.Len(t, files, len(filenames))
+
+	// the second target keeps its own 3 most recent, the first only those within the default 1 hour
+	err = executor.Prune(context.Background(), PruneOptions{Targets: targets, Retention: "1h", Now: now, TargetPolicies: map[string]PrunePolicy{
+		targets[1].URL(): {KeepLast: 3},
+	}})
+	assert.NoError(t, err)
+	for i, expected := range [][]string{filenames[3:], filenames[1:]} {
+		files, err := os.ReadDir(dirs[i])
+		if err != nil {
+			t.Fatalf("failed to read directory: %v", err)
+		}
+		var afterFiles []string
+		for _, file := range files {
+			afterFiles = append(afterFiles, file.Name())
+		}
+		assert.ElementsMatch(t, expected, afterFiles, "target %d", i)
+	}
+}
+
+func TestPruneTargetFilenamePatterns(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC)
+	filenames := []string{
+		"prod-2020-12-29T00:00:00Z.gz", "prod-2020-12-30T00:00:00Z.gz", "prod-2021-01-01T00:00:00Z.gz",
+		"db_backup_2020-12-28T00:00:00Z.gz", "latest.gz",
+	}
+	var (
+		targets []storage.Storage
+		dirs    []string
+	)
+	for i := 0; i < 2; i++ {
+		workDir := t.TempDir()
+		for _, filename := range filenames {
+			require.NoError(t, os.WriteFile(filepath.Join(workDir, filename), nil, 0o644))
+		}
+		targets = append(targets, file.New(url.URL{Scheme: "file", Path: workDir}))
+		dirs = append(dirs, workDir)
+	}
+	logger := log.New()
+	logger.Out = io.Discard
+	executor := Executor{Logger: logger}
+
+	// a pattern without the time of the dump fails before anything is removed from any of the targets
+	err := executor.Prune(context.Background(), PruneOptions{Targets: targets, Retention: "2c", Now: now, TargetFilenamePatterns: map[string]string{
+		targets[1].URL(): "prod.{{ .compression }}",
+	}})
+	assert.Error(t, err)
+
+	// the second target finds its dumps by its pattern, as well as by the default; the first only by the default
+	err = executor.Prune(context.Background(), PruneOptions{Targets: targets, Retention: "2c", Now: now, TargetFilenamePatterns: map[string]string{
+		targets[1].URL(): "prod-{{ .now }}.{{ .compression }}",
+	}})
+	assert.NoError(t, err)
+	for i, expected := range [][]string{filenames, {"prod-2020-12-30T00:00:00Z.gz", "prod-2021-01-01T00:00:00Z.gz", "latest.gz"}} {
+		files, err := os.ReadDir(dirs[i])
+		require.NoError(t, err)
+		var afterFiles []string
+		for _, file := range files {
+			afterFiles = append(afterFiles, file.Name())
+		}
+		assert.ElementsMatch(t, expected, afterFiles, "target %d", i)
+	}
+}
+
+// partitionedStorage a file storage that keeps each dump in a folder for its date, and lists every folder at once, as
+// S3 with a prefix does
+type partitionedStorage struct {
+	listerStorage
+}
+
+func (p partitionedStorage) ReadDir(ctx context.Context, dirname string, logger *log.Entry) ([]fs.FileInfo, error) {
+	return p.List(ctx, "", logger)
+}
+
+func (p partitionedStorage) Partition(info upload.Info) (string, error) {
+	return info.Time.Format("2006/01/02"), nil
+}
+
+func (p partitionedStorage) Partitioned() bool { return true }
+
+func TestPrunePartitioned(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC)
+	dir := t.TempDir()
+	names := []string{
+		"2020/12/29/db_backup_2020-12-29T00:00:00Z.gz",
+		"2020/12/30/db_backup_2020-12-30T00:00:00Z.gz",
+		"2020/12/31/db_backup_2020-12-31T00:00:00Z.gz",
+		"2020/12/31/db_backup_2020-12-31T00:00:00Z__pre-deploy.gz",
+		"2020/12/31/not-a-backup.gz",
+		"latest.gz",
+	}
+	for _, name := range names {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, nil, 0o644))
+	}
+	target := partitionedStorage{listerStorage{File: file.New(url.URL{Scheme: "file", Path: dir}), dir: dir}}
+	logger := log.New()
+	logger.Out = io.Discard
+	executor := Executor{Logger: logger}
+	require.NoError(t, executor.Prune(context.Background(), PruneOptions{Targets: []storage.Storage{target}, Retention: "2c", Now: now}))
+
+	for _, name := range names {
+		if name == "2020/12/29/db_backup_2020-12-29T00:00:00Z.gz" {
+			assert.NoFileExists(t, filepath.Join(dir, name))
+		} else {
+			assert.FileExists(t, filepath.Join(dir, name))
+		}
+	}
+}
+
+func TestPruneDuplicates(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC)
+	const (
+		first  = "db_backup_2020-12-29T00:00:00Z.gz"
+		second = "db_backup_2020-12-30T00:00:00Z.gz"
+		third  = "db_backup_2020-12-31T00:00:00Z.gz"
+	)
+	logger := log.New()
+	logger.Out = io.Discard
+	executor := Executor{Logger: logger}
+
+	t.Run("symlinks", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			links      map[string]string
+			keepWithin string
+			removed    []string
+		}{
+			// the first is older than the policy keeps, but the kept third is a link to it
+			{"kept link", map[string]string{second: first, third: first}, "2d", []string{second}},
+			// the third is a link to the second, which is a link to the first, so all are needed
+			{"chain of links", map[string]string{second: first, third: second}, "2d", nil},
+			{"no kept link", map[string]string{second: first, third: first}, "1h", []string{first, second, third}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				dir := t.TempDir()
+				require.NoError(t, os.WriteFile(filepath.Join(dir, first), []byte("dump"), 0o644))
+				for link, existing := range tt.links {
+					require.NoError(t, os.Symlink(existing, filepath.Join(dir, link)))
+				}
+				target := file.New(url.URL{Scheme: "file", Path: dir})
+				require.NoError(t, executor.Prune(context.Background(), PruneOptions{Targets: []storage.Storage{target}, KeepWithin: tt.keepWithin, Now: now}))
+				for _, name := range []string{first, second, third} {
+					_, err := os.Lstat(filepath.Join(dir, name))
+					if slices.Contains(tt.removed, name) {
+						assert.True(t, os.IsNotExist(err), "%s should be removed", name)
+					} else {
+						assert.NoError(t, err, "%s should be kept", name)
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("references", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			keepWithin string
+			removed    []string
+		}{
+			// the reference for the second is pruned; that for the third is kept, and so is the first, which it names
+			{"kept reference", "2d", []string{checksumRefFilename(second)}},
+			{"no kept reference", "1h", []string{first, checksumRefFilename(second), checksumRefFilename(third)}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				dir, tmpdir := t.TempDir(), t.TempDir()
+				require.NoError(t, os.WriteFile(filepath.Join(dir, first), []byte("dump"), 0o644))
+				target := unlinkable{file.New(url.URL{Scheme: "file", Path: dir})}
+				for _, name := range []string{second, third} {
+					ref := checksumRef{Filename: name, DuplicateOf: first, Checksum: "abc", Compression: "gz"}
+					require.NoError(t, pushJSON(context.Background(), target, checksumRefFilename(name), ref, tmpdir, log.NewEntry(logger)))
+				}
+				require.NoError(t, executor.Prune(context.Background(), PruneOptions{Targets: []storage.Storage{target}, KeepWithin: tt.keepWithin, Now: now}))
+				for _, name := range []string{first, checksumRefFilename(second), checksumRefFilename(third)} {
+					if slices.Contains(tt.removed, name) {
+						assert.NoFileExists(t, filepath.Join(dir, name))
+					} else {
+						assert.FileExists(t, filepath.Join(dir, name))
+					}
+				}
+			})
+		}
+	})
+}
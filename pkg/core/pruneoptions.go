@@ -8,8 +8,33 @@ import (
 )
 
 type PruneOptions struct {
-	Targets   []storage.Storage
+	Targets []storage.Storage
+	// Retention a single retention policy, either by age, e.g. 30d, or by count, e.g. 7c.
+	// Cannot be combined with KeepLast or KeepWithin.
 	Retention string
-	Now       time.Time
-	Run       uuid.UUID
+	// KeepLast keep at least this many of the most recent backups
+	KeepLast int
+	// KeepWithin keep all backups within this age, e.g. 30d. Combined with KeepLast,
+	// a backup is kept if either policy keeps it.
+	KeepWithin string
+	// TargetPolicies retention policies for particular targets, by their URL, that override Retention, KeepLast
+	// and KeepWithin
+	TargetPolicies map[string]PrunePolicy
+	// TargetFilenamePatterns the filename pattern of the dumps on particular targets, by their URL, as in
+	// DumpOptions, by which to find them, as well as by the default
+	TargetFilenamePatterns map[string]string
+	// Label prune only the backups with this label, e.g. nightly, which are kept according to the policies as if
+	// there were no others; if empty, only the backups without a label
+	Label string
+	// DryRun log the backups that would be removed, without removing them
+	DryRun bool
+	Now    time.Time
+	Run    uuid.UUID
+}
+
+// PrunePolicy a retention policy for a target, with the same meaning as in PruneOptions
+type PrunePolicy struct {
+	Retention  string
+	KeepLast   int
+	KeepWithin string
 }
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/databacker/mysql-backup/pkg/database"
+)
+
+// ReplicaOptions a read replica from which to dump, rather than the primary, as long as it is not too far behind
+type ReplicaOptions struct {
+	// DBConn the connection to the replica
+	DBConn database.Connection
+	// MaxLag the most that the replica may be behind its source for the dump to use it; 0 for any amount, as
+	// long as it is replicating
+	MaxLag time.Duration
+	// Fallback dump from the primary if the replica cannot be used; otherwise the dump fails
+	Fallback bool
+}
+
+// replicaLag how far the replica is behind its source; replaced in tests
+var replicaLag = database.ReplicaLag
+
+// dumpConnection the connection from which to dump: the replica, if there is one and it is replicating with no
+// more than the maximum lag, or else the primary, if it may fall back to it. replica is whether it is the replica.
+func dumpConnection(ctx context.Context, opts DumpOptions, logger *log.Entry) (conn database.Connection, replica bool, err error) {
+	if opts.Replica == nil {
+		return opts.DBConn, false, nil
+	}
+	host := opts.Replica.DBConn.Host
+	lag, err := replicaLag(ctx, opts.Replica.DBConn)
+	if err == nil && opts.Replica.MaxLag > 0 && lag > opts.Replica.MaxLag {
+		err = fmt.Errorf("it is %s behind, more than the maximum of %s", lag, opts.Replica.MaxLag)
+	}
+	switch {
+	case err == nil:
+		logger.Infof("dumping from replica %s, which is %s behind", host, lag)
+		return opts.Replica.DBConn, true, nil
+	case opts.Replica.Fallback:
+		logger.Warnf("dumping from the primary, as unable to dump from replica %s: %v", host, err)
+		return opts.DBConn, false, nil
+	}
+	return opts.DBConn, false, fmt.Errorf("unable to dump from replica %s: %v", host, err)
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databacker/mysql-backup/pkg/database"
+)
+
+func TestDumpConnection(t *testing.T) {
+	defer func(f func(context.Context, database.Connection) (time.Duration, error)) { replicaLag = f }(replicaLag)
+	logger := log.NewEntry(log.New())
+	primary := database.Connection{Host: "primary"}
+	replica := database.Connection{Host: "replica"}
+	tests := []struct {
+		name        string
+		replica     *ReplicaOptions
+		lag         time.Duration
+		lagErr      error
+		wantHost    string
+		wantReplica bool
+		err         bool
+	}{
+		{"no replica", nil, 0, nil, "primary", false, false},
+		{"replica within lag", &ReplicaOptions{DBConn: replica, MaxLag: time.Minute}, 10 * time.Second, nil, "replica", true, false},
+		{"replica any lag", &ReplicaOptions{DBConn: replica}, time.Hour, nil, "replica", true, false},
+		{"replica lags", &ReplicaOptions{DBConn: replica, MaxLag: time.Minute}, time.Hour, nil, "primary", false, true},
+		{"replica lags fallback", &ReplicaOptions{DBConn: replica, MaxLag: time.Minute, Fallback: true}, time.Hour, nil, "primary", false, false},
+		{"replication stopped", &ReplicaOptions{DBConn: replica}, 0, database.ErrReplicationStopped, "primary", false, true},
+		{"replication stopped fallback", &ReplicaOptions{DBConn: replica, Fallback: true}, 0, database.ErrReplicationStopped, "primary", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replicaLag = func(ctx context.Context, conn database.Connection) (time.Duration, error) {
+				assert.Equal(t, "replica", conn.Host)
+				return tt.lag, tt.lagErr
+			}
+			conn, fromReplica, err := dumpConnection(context.Background(), DumpOptions{DBConn: primary, Replica: tt.replica}, logger)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantHost, conn.Host)
+			assert.Equal(t, tt.wantReplica, fromReplica)
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/util"
+)
+
+const (
+	// ReportText the format of a plain text report, report.txt
+	ReportText = "text"
+	// ReportHTML the format of an HTML report, report.html
+	ReportHTML = "html"
+
+	// reportHistoryFilename name of the history of runs on each target, from which the report is generated
+	reportHistoryFilename = ".mysql-backup-report.json"
+)
+
+// ReportOptions how to keep a report of the recent runs on each target, for those without access to the logs
+// or monitoring
+type ReportOptions struct {
+	// History the most runs that the report lists, the newest first; 0 for no report
+	History int
+	// Format of the report, ReportText or ReportHTML; ReportText if empty
+	Format string
+}
+
+// ValidateReport check the history and format of a report
+func ValidateReport(opts ReportOptions) error {
+	if opts.History < 0 {
+		return fmt.Errorf("invalid report history %d, must not be negative", opts.History)
+	}
+	switch opts.Format {
+	case "", ReportText, ReportHTML:
+		return nil
+	default:
+		return fmt.Errorf("invalid report format %q, must be one of: %s, %s", opts.Format, ReportText, ReportHTML)
+	}
+}
+
+// reportFilename the name of the report on each target in the format
+func reportFilename(format string) string {
+	if format == ReportHTML {
+		return "report.html"
+	}
+	return "report.txt"
+}
+
+// reportHistory the runs recorded on a target, the newest first
+type reportHistory struct {
+	Runs []reportRun `json:"runs"`
+}
+
+// reportRun one run of a dump, as it went for the target
+type reportRun struct {
+	Run       string       `json:"run"`
+	Server    string       `json:"server,omitempty"`
+	Label     string       `json:"label,omitempty"`
+	Start     time.Time    `json:"start"`
+	End       time.Time    `json:"end"`
+	Databases []string     `json:"databases,omitempty"`
+	Files     []reportFile `json:"files,omitempty"`
+	// Unchanged whether the dump was skipped, as the databases had not changed since the last one
+	Unchanged bool `json:"unchanged,omitempty"`
+	// Error why the run failed, empty if it succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// reportFile one file of a run uploaded to the target
+type reportFile struct {
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	DuplicateOf string `json:"duplicateOf,omitempty"`
+}
+
+// Status of the run, for the report
+func (r reportRun) Status() string {
+	if r.Error != "" {
+		return "FAILED"
+	}
+	if r.Unchanged {
+		return "unchanged"
+	}
+	return "success"
+}
+
+// Duration of the run, for the report
+func (r reportRun) Duration() time.Duration {
+	return r.End.Sub(r.Start).Round(time.Second)
+}
+
+// add the run, as the newest, keeping at most history runs
+func (h *reportHistory) add(run reportRun, history int) {
+	h.Runs = append([]reportRun{run}, h.Runs...)
+	if len(h.Runs) > history {
+		h.Runs = h.Runs[:history]
+	}
+}
+
+// newReportRun the run of the dump with results, as it went for the target, failed with err if not nil
+func newReportRun(opts DumpOptions, results DumpResults, target string, end time.Time, err error) reportRun {
+	run := reportRun{
+		Run:       opts.Run.String(),
+		Server:    opts.Server,
+		Label:     opts.Label,
+		Start:     results.Start,
+		End:       end,
+		Databases: results.Databases,
+		Unchanged: results.Unchanged,
+	}
+	if run.Server == "" {
+		run.Server = opts.DBConn.Host
+	}
+	for _, u := range results.Uploads {
+		if u.Target == target {
+			run.Files = append(run.Files, reportFile{Filename: u.Filename, Size: u.Size, DuplicateOf: u.DuplicateOf})
+		}
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	return run
+}
+
+// updateReports record the run on each target, and replace the report there with one of the recent runs. The
+// dump is done, whether or not any report can be updated, so failures are only logged.
+func updateReports(ctx context.Context, opts DumpOptions, results DumpResults, dumpErr error, logger *log.Entry) {
+	tmpdir, err := os.MkdirTemp(opts.Tmp.Path, "databacker_report")
+	if err != nil {
+		logger.Warnf("unable to update reports: failed to make temporary directory: %v", err)
+		return
+	}
+	defer os.RemoveAll(tmpdir)
+	end := time.Now()
+	for _, t := range opts.Targets {
+		// a stream keeps nothing to report on
+		if storage.IsStream(t) {
+			continue
+		}
+		run := newReportRun(opts, results, t.URL(), end, dumpErr)
+		if err := updateReport(ctx, t, run, opts.Report, tmpdir, logger); err != nil {
+			logger.Warnf("unable to update report on target %s: %v", t.URL(), err)
+		}
+	}
+}
+
+// updateReport add the run to the history on the target, and replace the report there
+func updateReport(ctx context.Context, t storage.Storage, run reportRun, opts ReportOptions, tmpdir string, logger *log.Entry) error {
+	var history reportHistory
+	// the first report has no history yet, and one that cannot be read is started afresh
+	if err := pullJSON(ctx, t, reportHistoryFilename, &history, tmpdir, logger); err != nil {
+		logger.Debugf("no report history on target %s: %v", t.URL(), err)
+		history = reportHistory{}
+	}
+	history.add(run, opts.History)
+	if err := pushJSON(ctx, t, reportHistoryFilename, history, tmpdir, logger); err != nil {
+		return err
+	}
+	name := reportFilename(opts.Format)
+	b, err := renderReport(history, opts)
+	if err != nil {
+		return err
+	}
+	local := filepath.Join(tmpdir, name)
+	defer os.Remove(local)
+	if err := os.WriteFile(local, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	if _, err := t.Push(ctx, name, local, logger); err != nil {
+		return fmt.Errorf("failed to push %s: %v", name, err)
+	}
+	logger.Debugf("updated %s on target %s", name, t.URL())
+	return nil
+}
+
+// reportFuncs the functions of the report templates
+var reportFuncs = map[string]any{
+	"size": util.FormatSize,
+	"time": func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+	"join": strings.Join,
+}
+
+var reportTextTemplate = template.Must(template.New("report").Funcs(reportFuncs).Parse(`mysql-backup report: the last {{ len .History.Runs }} runs, of at most {{ .Max }}, the newest first
+{{ range .History.Runs }}
+{{ time .Start }}  {{ .Status }}  {{ .Server }}{{ if .Label }}  label {{ .Label }}{{ end }}
+  run        {{ .Run }}
+  duration   {{ .Duration }}
+{{- if .Databases }}
+  databases  {{ join .Databases ", " }}
+{{- end }}
+{{- range .Files }}
+  file       {{ .Filename }}  {{ size .Size }}{{ if .DuplicateOf }}  duplicate of {{ .DuplicateOf }}{{ end }}
+{{- end }}
+{{- if .Error }}
+  error      {{ .Error }}
+{{- end }}
+{{ end }}`))
+
+var reportHTMLTemplate = htmltemplate.Must(htmltemplate.New("report").Funcs(reportFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>mysql-backup report</title>
+</head>
+<body>
+<h1>mysql-backup report</h1>
+<p>The last {{ len .History.Runs }} runs, of at most {{ .Max }}, the newest first.</p>
+<table border="1">
+<tr><th>Start</th><th>Status</th><th>Server</th><th>Label</th><th>Duration</th><th>Databases</th><th>Files</th><th>Error</th><th>Run</th></tr>
+{{- range .History.Runs }}
+<tr><td>{{ time .Start }}</td><td>{{ .Status }}</td><td>{{ .Server }}</td><td>{{ .Label }}</td><td>{{ .Duration }}</td><td>{{ join .Databases ", " }}</td><td>
+{{- range $i, $f := .Files }}{{ if $i }}<br>{{ end }}{{ $f.Filename }} ({{ size $f.Size }}{{ if $f.DuplicateOf }}, duplicate of {{ $f.DuplicateOf }}{{ end }}){{ end -}}
+</td><td>{{ .Error }}</td><td>{{ .Run }}</td></tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
+
+// renderReport the report of the runs in history, in the format of opts
+func renderReport(history reportHistory, opts ReportOptions) ([]byte, error) {
+	data := struct {
+		History reportHistory
+		Max     int
+	}{history, opts.History}
+	var buf bytes.Buffer
+	var err error
+	if opts.Format == ReportHTML {
+		err = reportHTMLTemplate.Execute(&buf, data)
+	} else {
+		err = reportTextTemplate.Execute(&buf, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to render report: %v", err)
+	}
+	return buf.Bytes(), nil
+}
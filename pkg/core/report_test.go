@@ -0,0 +1,78 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/databacker/mysql-backup/pkg/database"
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+)
+
+func TestUpdateReports(t *testing.T) {
+	logger := log.NewEntry(log.New())
+	start := time.Date(2026, 10, 14, 2, 0, 0, 0, time.UTC)
+	tests := []struct {
+		format   string
+		filename string
+		contains []string
+	}{
+		{"", "report.txt", []string{"the last 2 runs, of at most 2", "2026-10-14T04:00:00Z  FAILED  db1", "error      failed to dump database: access denied", "file       db_backup_2026-10-14T03:00:00Z.tgz  1.5 KiB"}},
+		{ReportHTML, "report.html", []string{"<td>FAILED</td>", "failed to dump database: access denied", "db_backup_2026-10-14T03:00:00Z.tgz (1.5 KiB)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			targetDir := t.TempDir()
+			target := file.New(url.URL{Scheme: "file", Path: targetDir})
+			opts := DumpOptions{
+				Targets: []storage.Storage{target},
+				DBConn:  database.Connection{Host: "db1"},
+				Report:  ReportOptions{History: 2, Format: tt.format},
+			}
+			for i, dumpErr := range []error{nil, nil, errors.New("failed to dump database: access denied")} {
+				opts.Run = uuid.New()
+				runStart := start.Add(time.Duration(i) * time.Hour)
+				results := DumpResults{Start: runStart, Databases: []string{"app"}}
+				if dumpErr == nil {
+					name := "db_backup_" + runStart.Format(time.RFC3339) + ".tgz"
+					results.Uploads = []UploadResult{{Target: target.URL(), Filename: name, Size: 1536}, {Target: "file:///other", Filename: "other.tgz"}}
+				}
+				updateReports(context.Background(), opts, results, dumpErr, logger)
+			}
+
+			b, err := os.ReadFile(filepath.Join(targetDir, tt.filename))
+			require.NoError(t, err)
+			for _, s := range tt.contains {
+				assert.Contains(t, string(b), s)
+			}
+			// only the newest runs are kept, and only the files uploaded to this target
+			assert.NotContains(t, string(b), "02:00:00Z")
+			assert.NotContains(t, string(b), "other.tgz")
+
+			var history reportHistory
+			require.NoError(t, pullJSON(context.Background(), target, reportHistoryFilename, &history, t.TempDir(), logger))
+			if assert.Len(t, history.Runs, 2) {
+				assert.Equal(t, "failed to dump database: access denied", history.Runs[0].Error)
+				assert.Empty(t, history.Runs[1].Error)
+				assert.Equal(t, "db1", history.Runs[1].Server)
+			}
+		})
+	}
+}
+
+func TestValidateReport(t *testing.T) {
+	assert.NoError(t, ValidateReport(ReportOptions{}))
+	assert.NoError(t, ValidateReport(ReportOptions{History: 10, Format: ReportHTML}))
+	assert.Error(t, ValidateReport(ReportOptions{History: -1}))
+	assert.Error(t, ValidateReport(ReportOptions{History: 10, Format: "pdf"}))
+}
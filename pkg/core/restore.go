@@ -1,13 +1,22 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/databacker/mysql-backup/pkg/archive"
+	"github.com/databacker/mysql-backup/pkg/compression"
 	"github.com/databacker/mysql-backup/pkg/database"
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/tracing"
+	"github.com/databacker/mysql-backup/pkg/util"
 )
 
 const (
@@ -16,53 +25,109 @@ const (
 	tmpRestoreFile = "/tmp/restorefile"
 )
 
-// Restore restore a specific backup into the database
-func (e *Executor) Restore(opts RestoreOptions) error {
+// Restore restore a specific backup into the database. Cancelling ctx aborts the restore.
+func (e *Executor) Restore(ctx context.Context, opts RestoreOptions) (results RestoreResults, err error) {
+	results.Start = time.Now()
+	defer func() { results.End = time.Now() }()
 	logger := e.Logger.WithField("run", opts.Run.String())
 	logger.Level = e.Logger.Level
 
+	ctx, span := tracing.Start(ctx, "restore", attribute.String("run", opts.Run.String()), attribute.String("target.type", opts.Target.Protocol()), attribute.String("target.url", tracing.RedactURL(opts.Target.URL())))
+	defer func() { tracing.End(span, err) }()
+
 	logger.Info("beginning restore")
+	// before anything is downloaded, let alone dropped
+	if err := database.ValidateDropAllowed(opts.DropBeforeRestore, opts.DropAllowed); err != nil {
+		return results, err
+	}
+	if err := ValidateRestoreConcurrency(opts.Concurrency); err != nil {
+		return results, err
+	}
+	if err := database.ValidateGTIDMode(opts.GTIDMode); err != nil {
+		return results, err
+	}
+	file, err := chooseDump(ctx, opts.Target, opts.TargetFile, opts.Newest, opts.Label, opts.Offset, "restoring", logger)
+	if err != nil {
+		return results, err
+	}
+	opts.TargetFile = file
+	results.File = opts.TargetFile
+	span.SetAttributes(attribute.String("filename", opts.TargetFile))
 	// execute pre-restore scripts if any
-	if err := preRestore(opts.Target.URL()); err != nil {
-		return fmt.Errorf("error running pre-restore: %v", err)
+	if err := preRestore(ctx, opts.Run.String(), opts.Target.URL()); err != nil {
+		return results, fmt.Errorf("error running pre-restore: %v", err)
 	}
 
-	logger.Debugf("restoring via %s protocol, temporary file location %s", opts.Target.Protocol(), tmpRestoreFile)
+	// every temporary file and directory of the run, which hold the plaintext dump, are created in root
+	root, removeRoot, err := tmpRoot(opts.Tmp, opts.Run.String())
+	if err != nil {
+		return results, err
+	}
+	defer removeRoot()
+	downloadFile := tmpRestoreFile
+	if opts.Tmp != (TmpOptions{}) {
+		downloadFile = path.Join(root, path.Base(tmpRestoreFile))
+	}
+	logger.Debugf("restoring via %s protocol, temporary file location %s", opts.Target.Protocol(), downloadFile)
 
-	copied, err := opts.Target.Pull(opts.TargetFile, tmpRestoreFile, logger)
+	pullCtx, pullSpan := tracing.Start(ctx, "restore.pull", attribute.String("filename", opts.TargetFile))
+	copied, duplicateOf, err := pullDump(pullCtx, opts.Target, opts.TargetFile, downloadFile, root, logger)
+	if duplicateOf != "" {
+		logger.Infof("%s was not uploaded, as it is identical to %s, pulled that instead", opts.TargetFile, duplicateOf)
+		pullSpan.SetAttributes(attribute.String("duplicate_of", duplicateOf))
+	}
+	pullSpan.SetAttributes(attribute.Int64("bytes", copied))
+	tracing.End(pullSpan, err)
 	if err != nil {
-		return fmt.Errorf("failed to pull target %s: %v", opts.Target, err)
+		return results, err
 	}
 	logger.Debugf("completed copying %d bytes", copied)
+	// only for reporting, so not fatal
+	if results.Size, results.SHA256, err = fileSHA256(downloadFile); err != nil {
+		logger.Warnf("unable to calculate checksum of %s: %v", opts.TargetFile, err)
+	}
 
 	// successfully download file, now restore it
-	tmpdir, err := os.MkdirTemp("", "restore")
+	tmpdir, err := os.MkdirTemp(root, "restore")
 	if err != nil {
-		return fmt.Errorf("unable to create temporary working directory: %v", err)
+		return results, fmt.Errorf("unable to create temporary working directory: %v", err)
 	}
 	defer os.RemoveAll(tmpdir)
-	f, err := os.Open(tmpRestoreFile)
+	f, err := os.Open(downloadFile)
 	if f == nil {
-		return fmt.Errorf("unable to read the temporary download file: %v", err)
+		return results, fmt.Errorf("unable to read the temporary download file: %v", err)
 	}
 	defer f.Close()
-	os.Remove(tmpRestoreFile)
+	os.Remove(downloadFile)
 
-	// create my tar reader to put the files in the directory
-	cr, err := opts.Compressor.Uncompress(f)
+	compressor, err := dumpCompressor(f, opts.TargetFile, opts.Compressor, opts.CompressionDictionaries, logger)
 	if err != nil {
-		return fmt.Errorf("unable to create an uncompressor: %v", err)
+		return results, err
 	}
-	if err := archive.Untar(cr, tmpdir); err != nil {
-		return fmt.Errorf("error extracting the file: %v", err)
+	results.Compression = compressor.Extension()
+	cr, err := compressor.Uncompress(f)
+	if err != nil {
+		return results, fmt.Errorf("unable to create an uncompressor: %v", err)
+	}
+	if opts.Raw {
+		// a single SQL dump, so just uncompress it into the directory
+		if err := uncompressTo(cr, path.Join(tmpdir, "restore.sql"), opts.Tmp.Private); err != nil {
+			return results, fmt.Errorf("error extracting the file: %v", err)
+		}
+	} else {
+		// create my tar reader to put the files in the directory
+		if err := archive.Untar(cr, tmpdir); err != nil {
+			return results, fmt.Errorf("error extracting the file: %v", err)
+		}
 	}
 
 	// run through each file and apply it
 	files, err := os.ReadDir(tmpdir)
 	if err != nil {
-		return fmt.Errorf("failed to find extracted files to restore: %v", err)
+		return results, fmt.Errorf("failed to find extracted files to restore: %v", err)
 	}
 	readers := make([]io.ReadSeeker, 0)
+	var names []string
 	for _, f := range files {
 		// ignore directories
 		if f.IsDir() {
@@ -74,31 +139,277 @@ func (e *Executor) Restore(opts RestoreOptions) error {
 		}
 		defer file.Close()
 		readers = append(readers, file)
+		names = append(names, f.Name())
+	}
+	restoreOpts := database.RestoreOpts{Force: opts.Force, DropBeforeRestore: opts.DropBeforeRestore, DropAllowed: opts.DropAllowed, Concurrency: opts.Concurrency, NormalizeLineEndings: opts.NormalizeLineEndings, GTIDMode: opts.GTIDMode, VerifyRowCounts: opts.VerifyRowCounts}
+	if opts.ProgressInterval > 0 {
+		restoreOpts.ProgressInterval = opts.ProgressInterval
+		restoreOpts.Progress = func(p database.RestoreProgress) {
+			var percent int64
+			if p.Total > 0 {
+				percent = p.Bytes * 100 / p.Total
+			}
+			logger.Infof("restore progress: %s of %s read (%d%%), %d statements applied", util.FormatSize(p.Bytes), util.FormatSize(p.Total), percent, p.Statements)
+		}
+	}
+	logger.Debugf("restoring to %s", opts.DBConn.Redacted())
+	applyCtx, applySpan := tracing.Start(ctx, "restore.apply", attribute.StringSlice("files", names))
+	restored, err := database.Restore(applyCtx, opts.DBConn, restoreOpts, opts.DatabasesMap, readers)
+	applySpan.SetAttributes(attribute.Int("statements", restored.Statements), attribute.Int("failed", len(restored.Failed)))
+	tracing.End(applySpan, err)
+	results.Statements, results.Failed = restored.Statements, len(restored.Failed)
+	if restored.GTIDConflict != "" {
+		logger.Warnf("the restore is likely to fail to set GTID_PURGED: %s; restore with GTID mode %s or %s to avoid it", restored.GTIDConflict, database.GTIDStrip, database.GTIDReset)
+	}
+	if restored.GTIDReset {
+		logger.Warn("reset the binary logs and GTIDs of the server, so that it can take the GTID_PURGED of the dump")
+	}
+	for _, name := range restored.Dropped {
+		logger.Infof("dropped database %s before restoring it", name)
+	}
+	results.Files = restoreFileResults(names, restored)
+	if len(results.Files) > 1 {
+		logRestoreFiles(results.Files, opts.Concurrency, restored.Concurrent, logger)
+	}
+	if err != nil {
+		return results, fmt.Errorf("failed to restore database: %v", err)
+	}
+	if len(restored.Failed) > 0 {
+		for _, failed := range restored.Failed {
+			logger.Debugf("failed statement: %s", failed.Statement)
+			logger.Warnf("statement failed to restore: %v", failed.Err)
+		}
+		logger.Warnf("restore completed with %d of %d statements failed", len(restored.Failed), restored.Statements)
 	}
-	if err := database.Restore(opts.DBConn, opts.DatabasesMap, readers); err != nil {
-		return fmt.Errorf("failed to restore database: %v", err)
+	if opts.VerifyRowCounts {
+		results.RowCounts = rowCountResults(restored.RowCounts)
+		if err := checkRowCounts(results.RowCounts, logger); err != nil {
+			return results, err
+		}
 	}
 
 	// execute post-restore scripts if any
-	if err := postRestore(opts.Target.URL()); err != nil {
-		return fmt.Errorf("error running post-restove: %v", err)
+	if err := postRestore(ctx, opts.Run.String(), opts.Target.URL()); err != nil {
+		return results, fmt.Errorf("error running post-restove: %v", err)
+	}
+	return results, nil
+}
+
+// ValidateRestoreConcurrency check the number of files to restore at once, which must not be negative
+func ValidateRestoreConcurrency(concurrency int) error {
+	if concurrency < 0 {
+		return fmt.Errorf("invalid restore concurrency %d, must be at least 0", concurrency)
 	}
 	return nil
 }
 
+// restoreFileResults the result of each of the files named names, in the same order as the readers of restored
+func restoreFileResults(names []string, restored database.RestoreResults) []RestoreFileResult {
+	var files []RestoreFileResult
+	for i, r := range restored.Readers {
+		file := RestoreFileResult{
+			Name:       names[i],
+			Databases:  r.Databases,
+			Statements: r.Statements,
+			Failed:     len(r.Failed),
+			Skipped:    r.Skipped,
+		}
+		if r.Err != nil {
+			file.Error = r.Err.Error()
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// rowCountResults the row counts of the tables verified in restored
+func rowCountResults(counts []database.TableRowCount) []RowCountResult {
+	var results []RowCountResult
+	for _, c := range counts {
+		r := RowCountResult{Database: c.Database, Table: c.Table, Expected: c.Expected, Actual: c.Actual}
+		if c.Err != nil {
+			r.Error = c.Err.Error()
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// checkRowCounts log each of the tables whose rows differ from those that the dump records, failing if any do
+func checkRowCounts(counts []RowCountResult, logger *log.Entry) error {
+	if len(counts) == 0 {
+		logger.Warn("unable to verify row counts, as the dump records none, e.g. as it is not by dump, or only of tables dumped in part")
+		return nil
+	}
+	var mismatched int
+	for _, c := range counts {
+		switch {
+		case c.Error != "":
+			logger.Errorf("unable to count the rows of table %s.%s: %s", c.Database, c.Table, c.Error)
+		case c.Actual != c.Expected:
+			logger.Errorf("table %s.%s has %d rows once restored, the dump records %d", c.Database, c.Table, c.Actual, c.Expected)
+		default:
+			continue
+		}
+		mismatched++
+	}
+	if mismatched > 0 {
+		return fmt.Errorf("row counts of %d of %d tables differ from the dump", mismatched, len(counts))
+	}
+	logger.Infof("verified the row counts of %d tables", len(counts))
+	return nil
+}
+
+// logRestoreFiles log the outcome of each of the files restored, as a summary
+func logRestoreFiles(files []RestoreFileResult, concurrency int, concurrent bool, logger *log.Entry) {
+	if concurrency > 1 && !concurrent {
+		logger.Infof("restored the files one at a time, as they do not each restore different databases")
+	}
+	for _, f := range files {
+		switch {
+		case f.Error != "":
+			logger.Warnf("file %s failed to restore: %s", f.Name, f.Error)
+		case f.Skipped:
+			logger.Warnf("file %s not restored, as an earlier file failed", f.Name)
+		default:
+			logger.Infof("file %s restored: %d statements, %d failed", f.Name, f.Statements, f.Failed)
+		}
+	}
+}
+
+// chooseDump the file on target to act on, as the gerund verb, e.g. restoring, says: targetFile, or with newest
+// the newest file that matches it as a pattern, as by NewestMatching, or with label the newest dump with the
+// label, as by NewestWithLabel, for which targetFile must be empty. With offset, the file that many older than
+// the newest instead, of the dumps without a label if there is no targetFile or label.
+func chooseDump(ctx context.Context, target storage.Storage, targetFile string, newest bool, label string, offset int, verb string, logger *log.Entry) (string, error) {
+	if err := ValidateOffset(offset); err != nil {
+		return "", err
+	}
+	older := ""
+	if offset > 0 {
+		older = fmt.Sprintf("%d older than ", offset)
+	}
+	switch {
+	case label != "":
+		if targetFile != "" || newest {
+			return "", fmt.Errorf("%s the newest dump with label %s, so cannot give a file as well", verb, label)
+		}
+		file, err := NthNewestWithLabel(ctx, target, label, offset, logger)
+		if err != nil {
+			return "", err
+		}
+		logger.Infof("%s %s, %sthe newest dump with label %s", verb, file, older, label)
+		return file, nil
+	case newest:
+		file, err := NthNewestMatching(ctx, target, targetFile, offset, logger)
+		if err != nil {
+			return "", err
+		}
+		logger.Infof("%s %s, %sthe newest file that matches %s", verb, file, older, targetFile)
+		return file, nil
+	case offset > 0 && targetFile != "":
+		return "", fmt.Errorf("%s %s, so cannot give an offset as well, except with a label or a pattern with newest", verb, targetFile)
+	case offset > 0:
+		file, err := NthNewestWithLabel(ctx, target, "", offset, logger)
+		if err != nil {
+			return "", err
+		}
+		logger.Infof("%s %s, %sthe newest dump without a label", verb, file, older)
+		return file, nil
+	}
+	return targetFile, nil
+}
+
+// pullDump pull the dump file from target to local or, if it was not uploaded as the target already had it, the
+// dump that it duplicates, using tmpdir for the reference to it. Returns the bytes copied, and the name of the
+// dump that it duplicates, if it was pulled instead.
+func pullDump(ctx context.Context, target storage.Storage, file, local, tmpdir string, logger *log.Entry) (int64, string, error) {
+	copied, err := target.Pull(ctx, file, local, logger)
+	if err == nil {
+		return copied, "", nil
+	}
+	ref, refErr := readChecksumRef(ctx, target, file, tmpdir, logger)
+	if refErr != nil {
+		return copied, "", fmt.Errorf("failed to pull target %s: %v", target, err)
+	}
+	copied, err = target.Pull(ctx, ref.DuplicateOf, local, logger)
+	if err != nil {
+		return copied, ref.DuplicateOf, fmt.Errorf("failed to pull target %s: %v", target, err)
+	}
+	return copied, ref.DuplicateOf, nil
+}
+
+// dumpCompressor the compressor for the dump in f, named filename, as by detectCompressor, with the zstd
+// dictionaries in the files dictionaryFiles, which only zstd uses, but which may be given for an older dump in
+// another compression
+func dumpCompressor(f io.ReadSeeker, filename string, configured compression.Compressor, dictionaryFiles []string, logger *log.Entry) (compression.Compressor, error) {
+	compressor, err := detectCompressor(f, filename, configured, logger)
+	if err != nil {
+		return nil, fmt.Errorf("file %s: %v", filename, err)
+	}
+	dictionaries, err := readDictionaries(dictionaryFiles)
+	if err != nil {
+		return nil, err
+	}
+	return compression.WithDictionaries(compressor, dictionaries...)
+}
+
+// detectCompressor the compressor for the file in f, named filename, regardless of what the compression
+// is supposed to be, so that renamed or mislabelled dumps still restore. It uses, in order, the header of
+// the file, the extension of filename, and then the configured compressor. Unless detected from the
+// header, checks that the file really is in that compression, to fail clearly rather than mid-stream.
+func detectCompressor(f io.ReadSeeker, filename string, configured compression.Compressor, logger *log.Entry) (compression.Compressor, error) {
+	detected, err := compression.Detect(f)
+	if err != nil {
+		return nil, err
+	}
+	if detected != nil {
+		if configured != nil && detected.Extension() != configured.Extension() {
+			logger.Infof("file is compressed as %s, not the configured %s, restoring as %s", detected.Extension(), configured.Extension(), detected.Extension())
+		}
+		return detected, nil
+	}
+	compressor := compression.ForFilename(filename)
+	if compressor == nil {
+		compressor = configured
+	}
+	if compressor == nil {
+		return nil, fmt.Errorf("unable to determine the compression")
+	}
+	if err := compression.Verify(compressor, f); err != nil {
+		return nil, err
+	}
+	return compressor, nil
+}
+
+// uncompressTo write the uncompressed stream to the file at outFile, readable only by the user if private
+func uncompressTo(r io.Reader, outFile string, private bool) error {
+	out, err := createTmp(outFile, private)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 // run pre-restore scripts, if they exist
-func preRestore(target string) error {
+func preRestore(ctx context.Context, run, target string) error {
 	// construct any additional environment
 	env := map[string]string{
 		"DB_RESTORE_TARGET": target,
+		"RUN_ID":            run,
 	}
-	return runScripts(preRestoreDir, env)
+	return runScripts(ctx, preRestoreDir, env, nil)
 }
 
-func postRestore(target string) error {
+func postRestore(ctx context.Context, run, target string) error {
 	// construct any additional environment
 	env := map[string]string{
 		"DB_RESTORE_TARGET": target,
+		"RUN_ID":            run,
 	}
-	return runScripts(postRestoreDir, env)
+	return runScripts(ctx, postRestoreDir, env, nil)
 }
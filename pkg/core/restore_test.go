@@ -0,0 +1,49 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databacker/mysql-backup/pkg/database"
+)
+
+func TestRestoreFileResults(t *testing.T) {
+	restored := database.RestoreResults{
+		Readers: []database.ReaderResult{
+			{Databases: []string{"app"}, Statements: 10, Failed: []database.StatementError{{Statement: "x", Err: errors.New("bad")}}},
+			{Databases: []string{"other"}, Statements: 2, Err: errors.New("connection lost")},
+			{Skipped: true},
+		},
+	}
+	files := restoreFileResults([]string{"app.sql", "other.sql", "third.sql"}, restored)
+	assert.Equal(t, []RestoreFileResult{
+		{Name: "app.sql", Databases: []string{"app"}, Statements: 10, Failed: 1},
+		{Name: "other.sql", Databases: []string{"other"}, Statements: 2, Error: "connection lost"},
+		{Name: "third.sql", Skipped: true},
+	}, files)
+}
+
+func TestValidateRestoreConcurrency(t *testing.T) {
+	assert.NoError(t, ValidateRestoreConcurrency(0))
+	assert.NoError(t, ValidateRestoreConcurrency(4))
+	assert.Error(t, ValidateRestoreConcurrency(-1))
+}
+
+func TestCheckRowCounts(t *testing.T) {
+	logger := log.NewEntry(log.New())
+	counts := rowCountResults([]database.TableRowCount{
+		{Database: "app", Table: "users", Expected: 2, Actual: 2},
+		{Database: "app", Table: "orders", Expected: 5, Actual: 4},
+		{Database: "app", Table: "gone", Expected: 1, Err: errors.New("table doesn't exist")},
+	})
+	assert.False(t, counts[0].Mismatched())
+	assert.True(t, counts[1].Mismatched())
+	assert.Equal(t, "table doesn't exist", counts[2].Error)
+	assert.EqualError(t, checkRowCounts(counts, logger), "row counts of 2 of 3 tables differ from the dump")
+	assert.NoError(t, checkRowCounts(counts[:1], logger))
+	// a dump that records none has nothing to verify
+	assert.NoError(t, checkRowCounts(nil, logger))
+}
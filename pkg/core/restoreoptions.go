@@ -1,6 +1,8 @@
 package core
 
 import (
+	"time"
+
 	"github.com/databacker/mysql-backup/pkg/compression"
 	"github.com/databacker/mysql-backup/pkg/database"
 	"github.com/databacker/mysql-backup/pkg/storage"
@@ -14,4 +16,41 @@ type RestoreOptions struct {
 	DatabasesMap map[string]string
 	Compressor   compression.Compressor
 	Run          uuid.UUID
+	// Force continue past statements that fail to restore, reporting them at the end
+	Force bool
+	// Raw the file is a single compressed SQL dump, e.g. from another tool, rather than an archive
+	// created by Dump
+	Raw bool
+	// CompressionDictionaries paths to the zstd dictionaries that the file may have been compressed with
+	CompressionDictionaries []string
+	// ProgressInterval how often to log how far the restore has got; 0 to not log progress
+	ProgressInterval time.Duration
+	// Newest TargetFile is a pattern, as for NewestMatching, and the newest file that matches it is restored
+	Newest bool
+	// Tmp where and how to create the temporary files of the restore
+	Tmp TmpOptions
+	// DropBeforeRestore drop each database that the dump uses before restoring it, for a clean restore; only
+	// those in DropAllowed may be dropped
+	DropBeforeRestore bool
+	// DropAllowed the databases, after renaming, that DropBeforeRestore may drop
+	DropAllowed []string
+	// Label restore the newest dump on the target with this label, as by NewestWithLabel, rather than TargetFile,
+	// which must be empty
+	Label string
+	// Offset restore the dump this many older than the newest, e.g. 1 for the second newest, when the newest is no
+	// good: with Label, of the dumps with the label; with Newest, of the files that match TargetFile; with
+	// neither, and no TargetFile, of the dumps without a label
+	Offset int
+	// Concurrency how many of the files in the dump to restore at once, if each is of databases that none of the
+	// others are, e.g. the file per database of a dump by Dump; 0 or 1 to restore one at a time
+	Concurrency int
+	// NormalizeLineEndings convert the line endings of the SQL in the dump, CRLF or a lone CR, to LF as it is
+	// restored, e.g. of dumps written on Windows
+	NormalizeLineEndings bool
+	// GTIDMode how to handle the GTID_PURGED of a dump, e.g. from mysqldump, one of database.GTIDWarn,
+	// database.GTIDStrip or database.GTIDReset; empty to restore it as it is without checking
+	GTIDMode string
+	// VerifyRowCounts once restored, compare the rows of each table with those that the dump records it dumped,
+	// failing the restore if any differ. Only dumps by Dump record them, and only of tables dumped whole.
+	VerifyRowCounts bool
 }
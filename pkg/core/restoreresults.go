@@ -0,0 +1,54 @@
+package core
+
+import "time"
+
+// RestoreResults lists results of the restore.
+type RestoreResults struct {
+	Start time.Time
+	End   time.Time
+	// File the file that was restored, which with Newest is the one that matched
+	File string
+	// Size and SHA256 of the dump file, hex-encoded, as pulled from the target
+	Size   int64
+	SHA256 string
+	// Compression the extension of the compression with which the file was restored
+	Compression string
+	// Statements the number of statements run, and Failed the number of those that failed, with Force
+	Statements int
+	Failed     int
+	// Files the result of each of the files in the dump, e.g. one per database, in the order they were read
+	Files []RestoreFileResult
+	// RowCounts the rows of each table that the dump records, and that it has once restored, with VerifyRowCounts
+	RowCounts []RowCountResult
+}
+
+// RowCountResult the rows of a table that the dump records it dumped, and that it has once restored
+type RowCountResult struct {
+	// Database the database of the table, after renaming
+	Database string
+	Table    string
+	Expected int64
+	Actual   int64
+	// Error why the table could not be counted, e.g. it was not restored
+	Error string
+}
+
+// Mismatched whether the table could not be counted, or has other than the rows that the dump records
+func (r RowCountResult) Mismatched() bool {
+	return r.Error != "" || r.Actual != r.Expected
+}
+
+// RestoreFileResult the result of restoring one of the files in the dump
+type RestoreFileResult struct {
+	// Name the name of the file in the dump
+	Name string
+	// Databases the databases, after renaming, that the file uses; only found when restoring concurrently
+	Databases []string
+	// Statements the number of statements run, and Failed the number of those that failed, with Force
+	Statements int
+	Failed     int
+	// Error why the file did not restore, with its transaction rolled back; empty if it did
+	Error string
+	// Skipped not restored, as an earlier file failed
+	Skipped bool
+}
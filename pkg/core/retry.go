@@ -0,0 +1,62 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryOptions how to retry a run that fails
+type RetryOptions struct {
+	// Attempts how many more times to try a run that fails with a retryable error; 0 to not retry
+	Attempts int
+	// Delay how long to wait before each retry
+	Delay time.Duration
+}
+
+// permanentError an error that fails the same way however many times it is retried, e.g. from invalid options
+type permanentError struct {
+	err error
+}
+
+func (p permanentError) Error() string {
+	return p.err.Error()
+}
+
+func (p permanentError) Unwrap() error {
+	return p.err
+}
+
+// permanent mark err as not worth retrying
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// Retryable whether a run that failed with err might succeed if tried again. It might not if it was
+// cancelled, or if the cause is in the configuration, such as an invalid option, or credentials that the
+// database rejects, rather than in reaching the database or targets.
+func Retryable(err error) bool {
+	var p permanentError
+	return err != nil && !errors.As(err, &p) && !errors.Is(err, context.Canceled)
+}
+
+// WithRetries run fn, and then again, up to opts.Attempts more times, for as long as it fails with an error
+// that is Retryable. Returns the error of the last attempt.
+func WithRetries(ctx context.Context, opts RetryOptions, logger *log.Entry, fn func() error) error {
+	err := fn()
+	for attempt := 1; attempt <= opts.Attempts && Retryable(err) && ctx.Err() == nil; attempt++ {
+		logger.Warnf("run failed, retrying in %s, attempt %d of %d: %v", opts.Delay, attempt, opts.Attempts, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(opts.Delay):
+		}
+		err = fn()
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRetries(t *testing.T) {
+	errTransient := errors.New("connection refused")
+	tests := []struct {
+		name     string
+		attempts int
+		errs     []error
+		calls    int
+		wantErr  error
+	}{
+		{"success", 2, []error{nil}, 1, nil},
+		{"no retries", 0, []error{errTransient, nil}, 1, errTransient},
+		{"succeeds on retry", 2, []error{errTransient, errTransient, nil}, 3, nil},
+		{"gives up", 2, []error{errTransient, errTransient, errTransient, nil}, 3, errTransient},
+		{"permanent", 2, []error{permanent(errTransient), nil}, 1, errTransient},
+		{"wrapped permanent", 2, []error{fmt.Errorf("error running dump: %w", permanent(errTransient)), nil}, 1, errTransient},
+		{"cancelled", 2, []error{context.Canceled, nil}, 1, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			err := WithRetries(context.Background(), RetryOptions{Attempts: tt.attempts, Delay: time.Millisecond}, log.NewEntry(log.New()), func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			assert.Equal(t, tt.calls, calls)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
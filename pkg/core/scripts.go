@@ -1,13 +1,21 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
+	"sort"
+	"strings"
 )
 
-func runScripts(dir string, env map[string]string) error {
+// runScripts run each executable file in dir, with the environment of mysql-backup plus env. With wrapper, each
+// file is run by the wrapper instead, e.g. docker exec -i db sh -s to run it in another container: the wrapper is
+// given env too, and the file on its stdin, after an export of each of env, so that a shell reading it there has
+// the same environment.
+func runScripts(ctx context.Context, dir string, env map[string]string, wrapper []string) error {
 	files, err := os.ReadDir(dir)
 	// if the directory does not exist, do not worry about it
 	if err != nil && os.IsNotExist(err) {
@@ -27,11 +35,44 @@ func runScripts(dir string, env map[string]string) error {
 		for k, v := range env {
 			envSlice = append(envSlice, fmt.Sprintf("%s=%s", k, v))
 		}
-		cmd := exec.Command(path.Join(dir, f.Name()))
-		cmd.Env = envSlice
-		if err := cmd.Run(); err != nil {
+		script := path.Join(dir, f.Name())
+		if len(wrapper) > 0 {
+			err = runWrapped(ctx, wrapper, script, env, envSlice)
+		} else {
+			cmd := exec.CommandContext(ctx, script)
+			cmd.Env = envSlice
+			err = cmd.Run()
+		}
+		if err != nil {
 			return fmt.Errorf("error running file %s: %v", f.Name(), err)
 		}
 	}
 	return nil
 }
+
+// runWrapped run the script by the wrapper, with the script on its stdin after the exports of env
+func runWrapped(ctx context.Context, wrapper []string, script string, env map[string]string, envSlice []string) error {
+	in, err := os.Open(script)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	cmd := exec.CommandContext(ctx, wrapper[0], wrapper[1:]...)
+	cmd.Env = envSlice
+	cmd.Stdin = io.MultiReader(strings.NewReader(shellExports(env)), in)
+	return cmd.Run()
+}
+
+// shellExports the shell statements that export each of env, in order by name, for a script run by a wrapper
+func shellExports(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "export %s='%s'\n", k, strings.ReplaceAll(env[k], "'", `'\''`))
+	}
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreBackupEnvironment(t *testing.T) {
+	dir, out := t.TempDir(), filepath.Join(t.TempDir(), "env")
+	script := "#!/bin/sh\necho \"$RUN_ID $NOW $DUMPFILE\" > " + out + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "env.sh"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := preBackup(context.Background(), "5b4e0a3c-8a2d-4b5e-9d3f-2f1c7a0e6b11", "2024-01-01T02:00:00Z", "/tmp/dump.sql", "/tmp", dir, nil, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "5b4e0a3c-8a2d-4b5e-9d3f-2f1c7a0e6b11 2024-01-01T02:00:00Z /tmp/dump.sql\n", string(b))
+}
+
+func TestPreBackupWrapper(t *testing.T) {
+	dir, out := t.TempDir(), filepath.Join(t.TempDir(), "env")
+	// not run directly, as it is not a shell script with a shebang, but read by the shell of the wrapper
+	script := "echo \"$RUN_ID $DUMPFILE\" > " + out + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "env.sh"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	wrapper := []string{"env", "-i", "sh", "-s"}
+	if err := preBackup(context.Background(), "5b4e0a3c-8a2d-4b5e-9d3f-2f1c7a0e6b11", "2024-01-01T02:00:00Z", "/tmp/it's dump.sql", "/tmp", dir, wrapper, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the environment is cleared by env -i, so it came from the exports
+	assert.Equal(t, "5b4e0a3c-8a2d-4b5e-9d3f-2f1c7a0e6b11 /tmp/it's dump.sql\n", string(b))
+}
+
+func TestShellExports(t *testing.T) {
+	assert.Equal(t, "export A='1'\nexport B='it'\\''s'\n", shellExports(map[string]string{"B": "it's", "A": "1"}))
+}
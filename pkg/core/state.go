@@ -0,0 +1,116 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// runState state kept between runs in the state file, to report how long it has been since the
+// previous successful dump, and to skip dumps of data that has not changed since
+type runState struct {
+	LastSuccess  []lastSuccess `json:"lastSuccess"`
+	Fingerprints []fingerprint `json:"fingerprints,omitempty"`
+}
+
+// lastSuccess when the last successful dump of a server to a target finished
+type lastSuccess struct {
+	Target string    `json:"target"`
+	Server string    `json:"server,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// fingerprint the data of the databases of a server when they were last dumped with a label, to tell whether
+// they have changed since
+type fingerprint struct {
+	Server string `json:"server,omitempty"`
+	Label  string `json:"label,omitempty"`
+	// Method how the data was fingerprinted, one of the database change detection methods
+	Method string    `json:"method"`
+	Value  string    `json:"value"`
+	Time   time.Time `json:"time"`
+	// Files the main dump on each target, by URL, to point dumps that are skipped at
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// find the last success for a target and server, nil if none
+func (s *runState) find(target, server string) *lastSuccess {
+	for i, l := range s.LastSuccess {
+		if l.Target == target && l.Server == server {
+			return &s.LastSuccess[i]
+		}
+	}
+	return nil
+}
+
+// set the last success for a target and server, replacing any existing one
+func (s *runState) set(target, server string, t time.Time) {
+	if l := s.find(target, server); l != nil {
+		l.Time = t
+		return
+	}
+	s.LastSuccess = append(s.LastSuccess, lastSuccess{Target: target, Server: server, Time: t})
+}
+
+// findFingerprint the fingerprint of the last dump of a server with a label, nil if none
+func (s *runState) findFingerprint(server, label string) *fingerprint {
+	for i, f := range s.Fingerprints {
+		if f.Server == server && f.Label == label {
+			return &s.Fingerprints[i]
+		}
+	}
+	return nil
+}
+
+// setFingerprint set the fingerprint of the last dump of its server with its label, replacing any existing one
+func (s *runState) setFingerprint(f fingerprint) {
+	if existing := s.findFingerprint(f.Server, f.Label); existing != nil {
+		*existing = f
+		return
+	}
+	s.Fingerprints = append(s.Fingerprints, f)
+}
+
+// readState read the state file; a file that does not exist yet is empty state
+func readState(filename string) (*runState, error) {
+	state := &runState{}
+	b, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read state file: %v", err)
+	}
+	if err := json.Unmarshal(b, state); err != nil {
+		return &runState{}, fmt.Errorf("failed to parse state file %s: %v", filename, err)
+	}
+	return state, nil
+}
+
+// writeState write the state file, replacing it in one step, so that an interrupted write does not
+// leave it corrupt
+func writeState(filename string, state *runState) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %v", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		return fmt.Errorf("failed to replace state file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestState(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+	first := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+
+	// no file yet is empty state
+	state, err := readState(filename)
+	require.NoError(t, err)
+	assert.Nil(t, state.find("file:///backups", "db1"))
+
+	state.set("file:///backups", "db1", first)
+	state.set("s3://bucket/backups", "db1", first)
+	state.set("file:///backups", "db2", first)
+	require.NoError(t, writeState(filename, state))
+
+	state, err = readState(filename)
+	require.NoError(t, err)
+	state.set("file:///backups", "db1", second)
+	require.NoError(t, writeState(filename, state))
+
+	state, err = readState(filename)
+	require.NoError(t, err)
+	assert.Equal(t, []lastSuccess{
+		{Target: "file:///backups", Server: "db1", Time: second},
+		{Target: "s3://bucket/backups", Server: "db1", Time: first},
+		{Target: "file:///backups", Server: "db2", Time: first},
+	}, state.LastSuccess)
+
+	// a corrupt file is an error, with empty state to start afresh
+	require.NoError(t, os.WriteFile(filename, []byte("not json"), 0o600))
+	state, err = readState(filename)
+	assert.Error(t, err)
+	assert.Empty(t, state.LastSuccess)
+}
+
+func TestStateFingerprints(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+	first := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	state, err := readState(filename)
+	require.NoError(t, err)
+	assert.Nil(t, state.findFingerprint("db1", ""))
+
+	state.setFingerprint(fingerprint{Server: "db1", Method: "update-time", Value: "a", Time: first, Files: map[string]string{"file:///backups": "db_backup_1.tgz"}})
+	state.setFingerprint(fingerprint{Server: "db1", Label: "nightly", Method: "update-time", Value: "b", Time: first})
+	state.setFingerprint(fingerprint{Server: "db1", Method: "binlog", Value: "c", Time: first.Add(time.Hour)})
+	require.NoError(t, writeState(filename, state))
+
+	state, err = readState(filename)
+	require.NoError(t, err)
+	// one for each server and label, the last one set
+	assert.Len(t, state.Fingerprints, 2)
+	if f := state.findFingerprint("db1", ""); assert.NotNil(t, f) {
+		assert.Equal(t, fingerprint{Server: "db1", Method: "binlog", Value: "c", Time: first.Add(time.Hour)}, *f)
+	}
+	if f := state.findFingerprint("db1", "nightly"); assert.NotNil(t, f) {
+		assert.Equal(t, "b", f.Value)
+	}
+}
@@ -1,10 +1,12 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/robfig/cron/v3"
@@ -15,6 +17,16 @@ type TimerOptions struct {
 	Cron      string
 	Begin     string
 	Frequency int
+	// TriggerListen address on which to listen for HTTP requests to trigger an immediate run, e.g. ":8080".
+	// Empty to not listen.
+	TriggerListen string
+	// RunOnStart run once immediately, in addition to the schedule
+	RunOnStart bool
+	// Blackout windows, in the format of ValidateBlackout, in which scheduled runs, and the run on start, are
+	// skipped
+	Blackout []string
+	// TriggerOverridesBlackout run triggered runs even in a blackout window, rather than skip them too
+	TriggerOverridesBlackout bool
 }
 
 type Update struct {
@@ -56,14 +68,19 @@ func Timer(opts TimerOptions) (<-chan Update, error) {
 		}
 	}
 
-	// if delayMins is 0, this will do nothing, so it does not hurt
-	time.Sleep(delay)
-
 	c := make(chan Update)
 	go func(opts TimerOptions) {
 		// when this goroutine ends, close the channel
 		defer close(c)
 
+		// wait for the receiver, so the run at startup is not skipped, as a later one is while a run is in progress
+		if opts.RunOnStart && !opts.Once {
+			c <- Update{}
+		}
+
+		// if delayMins is 0, this will do nothing, so it does not hurt
+		time.Sleep(delay)
+
 		// if once, ignore all delays and go
 		if opts.Once {
 			sendTimer(c, true)
@@ -150,10 +167,57 @@ func waitForBeginTime(begin string, from time.Time) (time.Duration, error) {
 	return delay, nil
 }
 
+// cronParser standard 5-field cron, with an optional seconds field first, as well as descriptors such as @daily
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// cronFields the names of the fields of a cron expression with seconds; without, it starts at the minute
+var cronFields = []string{"second", "minute", "hour", "day of month", "month", "day of week"}
+
+// ValidateCron check that cronExpr is a valid cron expression, either standard 5-field cron, or 6-field with seconds
+// first. If it is not, the error names the field that is invalid.
+func ValidateCron(cronExpr string) error {
+	_, err := parseCron(cronExpr)
+	return err
+}
+
+// parseCron parse the cron expression, naming the invalid field if it fails
+func parseCron(cronExpr string) (cron.Schedule, error) {
+	sched, err := cronParser.Parse(cronExpr)
+	if err == nil {
+		return sched, nil
+	}
+	fields := strings.Fields(cronExpr)
+	// a time zone applies to the whole expression, so it is not one of the fields
+	if len(fields) > 0 && (strings.HasPrefix(fields[0], "TZ=") || strings.HasPrefix(fields[0], "CRON_TZ=")) {
+		fields = fields[1:]
+	}
+	switch {
+	case len(fields) > 0 && strings.HasPrefix(fields[0], "@"):
+		return nil, err
+	case len(fields) == 7:
+		return nil, fmt.Errorf("%v; the year field of Quartz-style cron is not supported", err)
+	case len(fields) != 5 && len(fields) != 6:
+		return nil, err
+	}
+	// find the field at fault by parsing each on its own, with every other field matching anything
+	names := cronFields[len(cronFields)-len(fields):]
+	for i, field := range fields {
+		probe := make([]string, len(fields))
+		for j := range probe {
+			probe[j] = "*"
+		}
+		probe[i] = field
+		if _, fieldErr := cronParser.Parse(strings.Join(probe, " ")); fieldErr != nil {
+			return nil, fmt.Errorf("invalid %s field %q: %v", names[i], field, fieldErr)
+		}
+	}
+	return nil, err
+}
+
 // waitForCron given the current time and a cron string, calculate the Duration
 // until the next time we will match the cron
 func waitForCron(cronExpr string, from time.Time) (time.Duration, error) {
-	sched, err := cron.ParseStandard(cronExpr)
+	sched, err := parseCron(cronExpr)
 	if err != nil {
 		return time.Duration(0), err
 	}
@@ -163,21 +227,85 @@ func waitForCron(cronExpr string, from time.Time) (time.Duration, error) {
 	return next.Sub(from), nil
 }
 
-// Timer runs a command on a timer
-func (e *Executor) Timer(timerOpts TimerOptions, cmd func() error) error {
+type triggerKey struct{}
+
+// TriggeredBy how the run whose context is ctx was triggered outside of the schedule, one of "http" or "signal";
+// empty for a run on the schedule
+func TriggeredBy(ctx context.Context) string {
+	source, _ := ctx.Value(triggerKey{}).(string)
+	return source
+}
+
+// Timer runs a command on a timer, until the schedule ends or ctx is cancelled.
+// Each run is passed a context derived from ctx, from which TriggeredBy tells how it was started.
+func (e *Executor) Timer(ctx context.Context, timerOpts TimerOptions, cmd func(ctx context.Context) error) error {
 	c, err := Timer(timerOpts)
 	if err != nil {
 		e.Logger.Errorf("error creating timer: %v", err)
 		os.Exit(1)
 	}
-	// block and wait for it
-	for update := range c {
-		if err := cmd(); err != nil {
-			return fmt.Errorf("error running command: %w", err)
+	// a single run has no schedule to trigger outside of
+	if timerOpts.Once {
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case update, ok := <-c:
+				if !ok {
+					return nil
+				}
+				if err := cmd(ctx); err != nil {
+					return fmt.Errorf("error running command: %w", err)
+				}
+				if update.Last {
+					return nil
+				}
+			}
 		}
-		if update.Last {
-			break
+	}
+
+	blackout, err := parseBlackout(timerOpts.Blackout)
+	if err != nil {
+		return err
+	}
+	triggers, stop, err := startTriggers(timerOpts, e.Logger)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	// block and wait for it
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case update, ok := <-c:
+			if !ok {
+				return nil
+			}
+			if window, in := inBlackout(blackout, time.Now()); in {
+				e.Logger.Infof("skipping scheduled run, in blackout window %s", window)
+				continue
+			}
+			if err := cmd(ctx); err != nil {
+				return fmt.Errorf("error running command: %w", err)
+			}
+			if update.Last {
+				return nil
+			}
+		case t := <-triggers:
+			if window, in := inBlackout(blackout, time.Now()); in && !timerOpts.TriggerOverridesBlackout {
+				e.Logger.Infof("skipping run triggered by %s, in blackout window %s", t.source, window)
+				t.done <- fmt.Errorf("%w %s", errBlackout, window)
+				continue
+			}
+			// a failed triggered run is reported to whoever triggered it, but does not end the schedule
+			e.Logger.Infof("running triggered by %s", t.source)
+			err := cmd(context.WithValue(ctx, triggerKey{}, t.source))
+			if err != nil {
+				e.Logger.Errorf("triggered run failed: %v", err)
+			}
+			t.done <- err
 		}
 	}
-	return nil
 }
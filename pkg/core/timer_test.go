@@ -20,6 +20,14 @@ func TestWaitForCron(t *testing.T) {
 		{"current minute but seconds in", "1 * * * *", "2018-10-10T10:01:10Z", 59*time.Minute + 50*time.Second, nil}, // this line tests that we use the current minute, and not wait for "-10"
 		{"midnight next day", "0 0 * * *", "2021-11-30T10:00:00Z", 14 * time.Hour, nil},
 		{"first day next month in next year", "0 0 1 * *", "2020-12-30T10:00:00Z", 14*time.Hour + 24*time.Hour, nil}, // this line tests that we can handle rolling month correctly
+		{"seconds field", "30 1 * * * *", "2018-10-10T10:00:00Z", 1*time.Minute + 30*time.Second, nil},
+		{"every 15 seconds", "*/15 * * * * *", "2018-10-10T10:00:20Z", 10 * time.Second, nil},
+		{"quartz any day of month", "0 0 0 ? * MON", "2018-10-10T10:00:00Z", 4*24*time.Hour + 14*time.Hour, nil},
+		{"descriptor", "@daily", "2018-10-10T10:00:00Z", 14 * time.Hour, nil},
+		{"invalid minute", "70 * * * *", "2018-10-10T10:00:00Z", 0, fmt.Errorf(`invalid minute field "70": end of range (70) above maximum (59): 70`)},
+		{"quartz year", "0 0 0 * * ? 2030", "2018-10-10T10:00:00Z", 0, fmt.Errorf("expected 5 to 6 fields, found 7: [0 0 0 * * ? 2030]; the year field of Quartz-style cron is not supported")},
+		{"invalid hour", "0 0 25 * * *", "2018-10-10T10:00:00Z", 0, fmt.Errorf(`invalid hour field "25": end of range (25) above maximum (23): 25`)},
+		{"invalid day of week", "0 0 * * FOO", "2018-10-10T10:00:00Z", 0, fmt.Errorf(`invalid day of week field "FOO": failed to parse int from FOO: strconv.Atoi: parsing "FOO": invalid syntax`)},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -73,3 +81,21 @@ func TestWaitForBeginTime(t *testing.T) {
 		})
 	}
 }
+
+func TestTimerRunOnStart(t *testing.T) {
+	// the first scheduled run is a day away, so the only update is the one at startup
+	c, err := Timer(TimerOptions{Begin: "+1440", Frequency: 1440, RunOnStart: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the receiver is not ready yet, which must not skip the run at startup
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case update := <-c:
+		if update.Last {
+			t.Error("run at startup is the last update, expected the schedule to continue")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no run at startup")
+	}
+}
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"fmt"
+	"os"
+)
+
+// TmpOptions where and how to create the temporary files of a run, which hold the dump uncompressed, and
+// before any encryption by the post-backup scripts
+type TmpOptions struct {
+	// Path directory in which to create the temporary files, e.g. an encrypted tmpfs; the system default if empty
+	Path string
+	// Private create every temporary file of a run readable only by the user running it, in a directory of
+	// its own, which is removed at the end of the run
+	Private bool
+}
+
+// tmpRoot the directory in which to create the temporary files and directories of the run, and a function
+// to remove it at the end of the run. Unless the files are private, it is the directory in the options.
+func tmpRoot(opts TmpOptions, run string) (string, func(), error) {
+	if !opts.Private {
+		return opts.Path, func() {}, nil
+	}
+	// MkdirTemp creates it with mode 0700, whatever the umask, and never reuses an existing directory, which
+	// someone else might be able to read
+	dir, err := os.MkdirTemp(opts.Path, "databacker_"+run+"_")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to make private temporary directory: %v", err)
+	}
+	return dir, func() { _ = os.RemoveAll(dir) }, nil
+}
+
+// createTmp create the temporary file name, readable only by the user if private, rather than as the umask allows
+func createTmp(name string, private bool) (*os.File, error) {
+	if !private {
+		return os.Create(name)
+	}
+	return os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTmpRoot(t *testing.T) {
+	t.Run("not private", func(t *testing.T) {
+		base := t.TempDir()
+		root, remove, err := tmpRoot(TmpOptions{Path: base}, "run")
+		require.NoError(t, err)
+		assert.Equal(t, base, root)
+		remove()
+		assert.DirExists(t, base, "not private, so the directory is not removed")
+	})
+	t.Run("private", func(t *testing.T) {
+		base := t.TempDir()
+		root, remove, err := tmpRoot(TmpOptions{Path: base, Private: true}, "run")
+		require.NoError(t, err)
+		assert.Equal(t, base, filepath.Dir(root))
+		info, err := os.Stat(root)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+
+		f, err := createTmp(filepath.Join(root, "dump.sql"), true)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		info, err = os.Stat(f.Name())
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		remove()
+		assert.NoDirExists(t, root)
+	})
+	t.Run("missing path", func(t *testing.T) {
+		_, _, err := tmpRoot(TmpOptions{Path: filepath.Join(t.TempDir(), "missing"), Private: true}, "run")
+		assert.Error(t, err)
+	})
+}
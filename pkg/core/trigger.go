@@ -0,0 +1,102 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	triggerPath = "/trigger"
+)
+
+// trigger a request to run the activity immediately, outside of the schedule.
+// The result of the run is sent to done.
+type trigger struct {
+	source string
+	done   chan error
+}
+
+// startTriggers start listening for out-of-band triggers, via signal and, if configured, via HTTP.
+// Triggers that arrive while a run is in progress are rejected, rather than queued.
+// Returns the channel on which triggers are sent, and a function to stop listening.
+func startTriggers(opts TimerOptions, logger *log.Logger) (<-chan trigger, func(), error) {
+	c := make(chan trigger)
+
+	// send a trigger, but do not block if a run is in progress
+	send := func(source string) (chan error, bool) {
+		t := trigger{source: source, done: make(chan error, 1)}
+		select {
+		case c <- t:
+			return t.done, true
+		default:
+			return nil, false
+		}
+	}
+
+	sigs := make(chan os.Signal, 1)
+	notifyTrigger(sigs)
+	go func() {
+		for range sigs {
+			logger.Info("received trigger signal")
+			if _, ok := send("signal"); !ok {
+				logger.Warn("run already in progress, ignoring trigger signal")
+			}
+		}
+	}()
+
+	var server *http.Server
+	if opts.TriggerListen != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc(triggerPath, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			logger.Infof("received trigger request from %s", r.RemoteAddr)
+			done, ok := send("http")
+			if !ok {
+				logger.Warn("run already in progress, rejecting trigger request")
+				http.Error(w, "run already in progress, trigger rejected", http.StatusConflict)
+				return
+			}
+			if err := <-done; err != nil {
+				if errors.Is(err, errBlackout) {
+					http.Error(w, fmt.Sprintf("run skipped: %v", err), http.StatusServiceUnavailable)
+					return
+				}
+				http.Error(w, fmt.Sprintf("run failed: %v", err), http.StatusInternalServerError)
+				return
+			}
+			_, _ = fmt.Fprintln(w, "run complete")
+		})
+		ln, err := net.Listen("tcp", opts.TriggerListen)
+		if err != nil {
+			signal.Stop(sigs)
+			close(sigs)
+			return nil, nil, fmt.Errorf("unable to listen for triggers on %s: %w", opts.TriggerListen, err)
+		}
+		server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Errorf("trigger server failed: %v", err)
+			}
+		}()
+	}
+	stop := func() {
+		signal.Stop(sigs)
+		close(sigs)
+		if server != nil {
+			_ = server.Shutdown(context.Background())
+		}
+	}
+	return c, stop, nil
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package core
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyTrigger relay the signals that trigger an immediate run to c
+func notifyTrigger(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package core
+
+import (
+	"os"
+)
+
+// notifyTrigger windows has no SIGUSR1, so there is no signal trigger
+func notifyTrigger(c chan<- os.Signal) {}
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/databacker/mysql-backup/pkg/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// verifyUploads whether to read back each upload to the target, to check that it is complete
+func verifyUploads(t storage.Storage, opts DumpOptions) bool {
+	// a stream keeps nothing to read back
+	if storage.IsStream(t) {
+		return false
+	}
+	return opts.VerifyUpload || opts.TargetVerifyUploads[t.URL()]
+}
+
+// verifyUpload check that the file the target stored as name has the size, and the checksum, if the target can
+// provide one, of the file that was uploaded
+func verifyUpload(ctx context.Context, t storage.Storage, name string, size int64, checksum string, logger *log.Entry) error {
+	v, ok := t.(storage.Verifier)
+	if !ok {
+		return fmt.Errorf("target %s cannot verify uploads", t.URL())
+	}
+	storedSize, storedChecksum, err := v.Stored(ctx, name, logger)
+	if err != nil {
+		return fmt.Errorf("failed to verify upload of %s to %s: %v", name, t.URL(), err)
+	}
+	if storedSize != size {
+		return fmt.Errorf("upload of %s to %s is incomplete: stored %d bytes, expected %d", name, t.URL(), storedSize, size)
+	}
+	if storedChecksum != "" && storedChecksum != checksum {
+		return fmt.Errorf("upload of %s to %s is corrupt: stored checksum %s, expected %s", name, t.URL(), storedChecksum, checksum)
+	}
+	logger.Debugf("verified upload of %s to %s, %d bytes", name, t.URL(), storedSize)
+	return nil
+}
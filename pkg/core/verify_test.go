@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/storage/file"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyUpload(t *testing.T) {
+	src, dir := t.TempDir(), t.TempDir()
+	source := filepath.Join(src, "dump.tgz")
+	if err := os.WriteFile(source, []byte("complete dump content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	size, checksum, err := fileSHA256(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := file.New(url.URL{Scheme: "file", Path: dir})
+	logger := log.NewEntry(log.New())
+
+	tests := []struct {
+		name    string
+		stored  string
+		target  storage.Storage
+		wantErr string
+	}{
+		{"complete", "complete dump content", store, ""},
+		{"truncated", "complete dump", store, "is incomplete"},
+		{"corrupt", "complete dump CONTENT", store, "is corrupt"},
+		{"missing", "", store, "failed to verify upload"},
+		// only has the methods of storage.Storage, so it cannot verify
+		{"cannot verify", "complete dump content", struct{ storage.Storage }{store}, "cannot verify uploads"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(dir, "dump.tgz")
+			_ = os.Remove(target)
+			if tt.stored != "" {
+				if err := os.WriteFile(target, []byte(tt.stored), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := verifyUpload(context.Background(), tt.target, "dump.tgz", size, checksum, logger)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/databacker/mysql-backup/pkg/database"
+)
+
+// DefaultWaitInterval how long to wait between each check of whether a database server is ready, unless another
+// is given
+const DefaultWaitInterval = 2 * time.Second
+
+// pingDatabase check whether the server accepts queries; replaced in tests
+var pingDatabase = database.Ping
+
+// WaitOptions how long to wait for the database servers to be ready, before the first run
+type WaitOptions struct {
+	// DBConns the servers for which to wait
+	DBConns []database.Connection
+	// Timeout how long to wait for all of the servers, altogether; 0 to not wait
+	Timeout time.Duration
+	// Interval how long to wait between each check; DefaultWaitInterval if 0
+	Interval time.Duration
+}
+
+// WaitForDatabase wait until each of the servers accepts queries, checking each with SELECT 1 until it succeeds,
+// e.g. for a database that starts at the same time, and so takes longer to be ready. Fails at once for a server
+// that is up but rejects the connection, e.g. its credentials, since it is misconfigured rather than not ready,
+// and once the timeout has passed.
+func (e *Executor) WaitForDatabase(ctx context.Context, opts WaitOptions) error {
+	if opts.Timeout <= 0 {
+		return nil
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultWaitInterval
+	}
+	deadline := time.Now().Add(opts.Timeout)
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	for _, dbconn := range opts.DBConns {
+		for attempt := 1; ; attempt++ {
+			err := pingDatabase(ctx, dbconn)
+			if err == nil {
+				e.Logger.Debugf("database %s is ready", dbconn.Host)
+				break
+			}
+			if !database.Unavailable(err) {
+				return fmt.Errorf("database %s is misconfigured: %w", dbconn.Host, err)
+			}
+			if time.Until(deadline) < interval {
+				return fmt.Errorf("database %s was not ready after %s: %w", dbconn.Host, opts.Timeout, err)
+			}
+			e.Logger.Infof("waiting for database %s to be ready, checking again in %s, attempt %d: %v", dbconn.Host, interval, attempt, err)
+			select {
+			case <-ctx.Done():
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					return fmt.Errorf("database %s was not ready after %s: %w", dbconn.Host, opts.Timeout, err)
+				}
+				return ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	mysql "github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databacker/mysql-backup/pkg/database"
+)
+
+func TestWaitForDatabase(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	denied := &mysql.MySQLError{Number: 1045, Message: "Access denied for user 'user'@'%'"}
+	db1 := database.Connection{Host: "db1"}
+	db2 := database.Connection{Host: "db2"}
+	tests := []struct {
+		name    string
+		opts    WaitOptions
+		errs    map[string][]error
+		pings   map[string]int
+		wantErr string
+	}{
+		{"not waiting", WaitOptions{DBConns: []database.Connection{db1}}, nil, map[string]int{}, ""},
+		{"ready", WaitOptions{DBConns: []database.Connection{db1}, Timeout: time.Second, Interval: time.Millisecond}, map[string][]error{"db1": {nil}}, map[string]int{"db1": 1}, ""},
+		{"ready once up", WaitOptions{DBConns: []database.Connection{db1}, Timeout: time.Second, Interval: time.Millisecond}, map[string][]error{"db1": {refused, refused, nil}}, map[string]int{"db1": 3}, ""},
+		{"each server", WaitOptions{DBConns: []database.Connection{db1, db2}, Timeout: time.Second, Interval: time.Millisecond}, map[string][]error{"db1": {nil}, "db2": {refused, nil}}, map[string]int{"db1": 1, "db2": 2}, ""},
+		{"misconfigured", WaitOptions{DBConns: []database.Connection{db1}, Timeout: time.Second, Interval: time.Millisecond}, map[string][]error{"db1": {denied, nil}}, map[string]int{"db1": 1}, "database db1 is misconfigured: Error 1045: Access denied for user 'user'@'%'"},
+		{"not ready", WaitOptions{DBConns: []database.Connection{db1}, Timeout: 30 * time.Millisecond, Interval: 20 * time.Millisecond}, map[string][]error{"db1": {refused, refused, refused}}, map[string]int{"db1": 2}, "database db1 was not ready after 30ms: dial tcp: connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pings := map[string]int{}
+			pingDatabase = func(ctx context.Context, dbconn database.Connection) error {
+				pings[dbconn.Host]++
+				return tt.errs[dbconn.Host][pings[dbconn.Host]-1]
+			}
+			defer func() { pingDatabase = database.Ping }()
+
+			e := &Executor{Logger: log.New()}
+			err := e.WaitForDatabase(context.Background(), tt.opts)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.pings, pings)
+		})
+	}
+}
+
+func TestWaitForDatabaseCancelled(t *testing.T) {
+	pingDatabase = func(ctx context.Context, dbconn database.Connection) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	}
+	defer func() { pingDatabase = database.Ping }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	e := &Executor{Logger: log.New()}
+	err := e.WaitForDatabase(ctx, WaitOptions{DBConns: []database.Connection{{Host: "db1"}}, Timeout: time.Minute, Interval: time.Millisecond})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	mysql "github.com/go-sql-driver/mysql"
+)
+
+const (
+	// ChangesUpdateTime detect changes by the create and update times of the tables in information_schema
+	ChangesUpdateTime = "update-time"
+	// ChangesChecksum detect changes by CHECKSUM TABLE of each base table, which reads every row
+	ChangesChecksum = "checksum"
+	// ChangesBinlog detect changes by the position in the binary log of the server, which any write moves
+	ChangesBinlog = "binlog"
+)
+
+// ValidateChanges check the method of detecting changes, empty for none
+func ValidateChanges(method string) error {
+	switch method {
+	case "", ChangesUpdateTime, ChangesChecksum, ChangesBinlog:
+		return nil
+	default:
+		return fmt.Errorf("invalid change detection %q, must be one of: %s, %s, %s", method, ChangesUpdateTime, ChangesChecksum, ChangesBinlog)
+	}
+}
+
+// Fingerprint a summary of the data of the databases schemas, by method, which is the same as long as
+// they have not changed, as far as the method can tell
+func Fingerprint(ctx context.Context, dbconn Connection, method string, schemas []string) (string, error) {
+	dbconn, err := dbconn.WithDefaultsFile()
+	if err != nil {
+		return "", err
+	}
+	db, err := sql.Open("mysql", dbconn.MySQL())
+	if err != nil {
+		return "", fmt.Errorf("failed to open connection to database: %v", err)
+	}
+	defer db.Close()
+
+	h := sha256.New()
+	// the databases themselves, so that one that is added or removed is a change too
+	_, _ = fmt.Fprintf(h, "%s\n%s\n", method, strings.Join(schemas, ","))
+	switch method {
+	case ChangesUpdateTime:
+		err = dbconn.metadataQuery(ctx, func(ctx context.Context) error {
+			return updateTimes(ctx, db, schemas, h)
+		})
+	case ChangesChecksum:
+		err = checksums(ctx, dbconn, db, schemas, h)
+	case ChangesBinlog:
+		err = dbconn.metadataQuery(ctx, func(ctx context.Context) error {
+			return binlogPosition(ctx, db, h)
+		})
+	default:
+		err = ValidateChanges(method)
+	}
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// tablesQuery the query of the tables of schemas in information_schema, for the columns, and its arguments
+func tablesQuery(columns string, schemas []string) (string, []any) {
+	args := make([]any, 0, len(schemas))
+	for _, schema := range schemas {
+		args = append(args, schema)
+	}
+	return "SELECT " + columns + " FROM information_schema.tables WHERE table_schema IN (?" + strings.Repeat(", ?", len(schemas)-1) + ") ORDER BY table_schema, table_name", args
+}
+
+// updateTimes write the create and update times of each table of schemas to w, with their names, so that a
+// table that is added or removed is a change too
+func updateTimes(ctx context.Context, db *sql.DB, schemas []string, w io.Writer) error {
+	if len(schemas) == 0 {
+		return nil
+	}
+	query, args := tablesQuery("table_schema, table_name, table_type, COALESCE(CAST(create_time AS CHAR), ''), COALESCE(CAST(update_time AS CHAR), '')", schemas)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("could not get table update times: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var schema, table, tableType, created, updated string
+		if err := rows.Scan(&schema, &table, &tableType, &created, &updated); err != nil {
+			return fmt.Errorf("error getting table update time: %w", err)
+		}
+		_, _ = fmt.Fprintf(w, "%s.%s %s %s %s\n", schema, table, tableType, created, updated)
+	}
+	return rows.Err()
+}
+
+// checksums write the checksum of each base table of schemas to w, along with the names of the views
+func checksums(ctx context.Context, dbconn Connection, db *sql.DB, schemas []string, w io.Writer) error {
+	if len(schemas) == 0 {
+		return nil
+	}
+	var tables, views []string
+	err := dbconn.metadataQuery(ctx, func(ctx context.Context) error {
+		tables, views = nil, nil
+		query, args := tablesQuery("table_schema, table_name, table_type", schemas)
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("could not get tables: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var schema, table, tableType string
+			if err := rows.Scan(&schema, &table, &tableType); err != nil {
+				return fmt.Errorf("error getting table: %w", err)
+			}
+			name := "`" + strings.ReplaceAll(schema, "`", "``") + "`.`" + strings.ReplaceAll(table, "`", "``") + "`"
+			if tableType == "BASE TABLE" {
+				tables = append(tables, name)
+			} else {
+				views = append(views, name)
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return err
+	}
+	for _, v := range views {
+		_, _ = fmt.Fprintf(w, "%s VIEW\n", v)
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+	// reads every row, so it is not limited by the timeout of metadata queries
+	rows, err := db.QueryContext(ctx, "CHECKSUM TABLE "+strings.Join(tables, ", "))
+	if err != nil {
+		return fmt.Errorf("could not checksum tables: %w", err)
+	}
+	defer rows.Close()
+	var lines []string
+	for rows.Next() {
+		var table string
+		var checksum sql.NullString
+		if err := rows.Scan(&table, &checksum); err != nil {
+			return fmt.Errorf("error getting table checksum: %w", err)
+		}
+		// NULL if the table does not exist any more, which is a change too
+		lines = append(lines, fmt.Sprintf("%s %s %t\n", table, checksum.String, checksum.Valid))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	sort.Strings(lines)
+	for _, l := range lines {
+		_, _ = io.WriteString(w, l)
+	}
+	return nil
+}
+
+// binlogPosition write the current binary log file and position of the server to w
+func binlogPosition(ctx context.Context, db *sql.DB, w io.Writer) error {
+	// SHOW BINARY LOG STATUS replaces SHOW MASTER STATUS in MySQL 8.2 and later, which removes it in 8.4
+	file, position, err := binlogStatus(ctx, db, "SHOW BINARY LOG STATUS")
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlSyntaxError {
+		file, position, err = binlogStatus(ctx, db, "SHOW MASTER STATUS")
+	}
+	if err != nil {
+		return fmt.Errorf("could not get binary log position: %w", err)
+	}
+	_, _ = fmt.Fprintf(w, "%s %s\n", file, position)
+	return nil
+}
+
+// binlogStatus the binary log file and position of the status from query
+func binlogStatus(ctx context.Context, db *sql.DB, query string) (file, position string, err error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return "", "", err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", "", err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", "", err
+		}
+		return "", "", errors.New("binary logging is not enabled")
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return "", "", err
+	}
+	for i, column := range columns {
+		switch column {
+		case "File":
+			file = values[i].String
+		case "Position":
+			position = values[i].String
+		}
+	}
+	if file == "" {
+		return "", "", errors.New("binary log status has no File")
+	}
+	return file, position, nil
+}
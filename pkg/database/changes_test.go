@@ -0,0 +1,20 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateChanges(t *testing.T) {
+	for _, method := range []string{"", ChangesUpdateTime, ChangesChecksum, ChangesBinlog} {
+		assert.NoError(t, ValidateChanges(method), method)
+	}
+	assert.Error(t, ValidateChanges("gtid"))
+}
+
+func TestTablesQuery(t *testing.T) {
+	query, args := tablesQuery("table_name", []string{"shop", "crm"})
+	assert.Equal(t, "SELECT table_name FROM information_schema.tables WHERE table_schema IN (?, ?) ORDER BY table_schema, table_name", query)
+	assert.Equal(t, []any{"shop", "crm"}, args)
+}
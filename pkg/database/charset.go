@@ -0,0 +1,73 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultCharset the character set of connections, unless set otherwise
+const DefaultCharset = "utf8mb4"
+
+// clientCharsets the character sets that MySQL accepts for a client connection, from SHOW CHARACTER SET.
+// ucs2, utf16, utf16le and utf32 are not among them, as the server cannot use them for a client.
+var clientCharsets = []string{
+	"armscii8", "ascii", "big5", "binary", "cp1250", "cp1251", "cp1256", "cp1257", "cp850", "cp852", "cp866",
+	"cp932", "dec8", "eucjpms", "euckr", "gb18030", "gb2312", "gbk", "geostd8", "greek", "hebrew", "hp8",
+	"keybcs2", "koi8r", "koi8u", "latin1", "latin2", "latin5", "latin7", "macce", "macroman", "sjis", "swe7",
+	"tis620", "ujis", "utf8", "utf8mb3", "utf8mb4",
+}
+
+// ValidateCharset check that charset is a character set that can be used for a connection
+func ValidateCharset(charset string) error {
+	if !slices.Contains(clientCharsets, strings.ToLower(charset)) {
+		return fmt.Errorf("invalid character set %q, must be one of: %s", charset, strings.Join(clientCharsets, ", "))
+	}
+	return nil
+}
+
+// collationName the form of the name of a collation, which is set in SET NAMES as it is
+var collationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// ValidateCollation check that collation is a collation of charset, DefaultCharset if empty, by its name, which
+// starts with that of its character set, e.g. utf8mb4_0900_ai_ci of utf8mb4
+func ValidateCollation(charset, collation string) error {
+	name := strings.ToLower(collation)
+	if !collationName.MatchString(name) {
+		return fmt.Errorf("invalid collation %q", collation)
+	}
+	charset = strings.ToLower(charset)
+	if charset == "" {
+		charset = DefaultCharset
+	}
+	if charset == "binary" {
+		if name != "binary" {
+			return fmt.Errorf("collation %s is not of character set %s, whose only collation is binary", collation, charset)
+		}
+		return nil
+	}
+	prefixes := []string{charset + "_"}
+	// utf8 is an alias of utf8mb3, whose collations are named with either
+	switch charset {
+	case "utf8":
+		prefixes = append(prefixes, "utf8mb3_")
+	case "utf8mb3":
+		prefixes = append(prefixes, "utf8_")
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("collation %s is not of character set %s", collation, charset)
+}
+
+// ValidateSkipSetCharset check that a dump that does not set the character set in which it is written is not
+// written in one chosen for it, which a restore could not then tell
+func ValidateSkipSetCharset(skip bool, charset string) error {
+	if skip && charset != "" {
+		return fmt.Errorf("cannot skip setting the character set of the dump when dumping in character set %s, as a restore could not tell that it is in it", charset)
+	}
+	return nil
+}
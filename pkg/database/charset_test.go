@@ -0,0 +1,72 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCharset(t *testing.T) {
+	for _, charset := range []string{"utf8mb4", "latin1", "UTF8MB4", "binary"} {
+		assert.NoError(t, ValidateCharset(charset), charset)
+	}
+	// unknown, and server-only
+	for _, charset := range []string{"utf-8", "", "utf16", "ucs2"} {
+		assert.Error(t, ValidateCharset(charset), charset)
+	}
+}
+
+func TestValidateCollation(t *testing.T) {
+	tests := []struct {
+		charset   string
+		collation string
+		valid     bool
+	}{
+		{"utf8mb4", "utf8mb4_0900_ai_ci", true},
+		{"", "utf8mb4_unicode_ci", true},
+		{"latin1", "LATIN1_SWEDISH_CI", true},
+		{"utf8", "utf8mb3_general_ci", true},
+		{"utf8mb3", "utf8_general_ci", true},
+		{"binary", "binary", true},
+		{"latin1", "utf8mb4_0900_ai_ci", false},
+		{"", "latin1_swedish_ci", false},
+		// utf8 is not a prefix of utf8mb4
+		{"utf8", "utf8mb4_bin", false},
+		{"binary", "latin1_bin", false},
+		{"utf8mb4", "utf8mb4_bin; DROP TABLE t1", false},
+		{"utf8mb4", "", false},
+	}
+	for _, tt := range tests {
+		err := ValidateCollation(tt.charset, tt.collation)
+		if tt.valid {
+			assert.NoError(t, err, tt.collation)
+		} else {
+			assert.Error(t, err, tt.collation)
+		}
+	}
+}
+
+func TestValidateSkipSetCharset(t *testing.T) {
+	assert.NoError(t, ValidateSkipSetCharset(false, ""))
+	assert.NoError(t, ValidateSkipSetCharset(false, "latin1"))
+	assert.NoError(t, ValidateSkipSetCharset(true, ""))
+	assert.Error(t, ValidateSkipSetCharset(true, "latin1"))
+}
+
+func TestConnectionCharset(t *testing.T) {
+	tests := []struct {
+		charset   string
+		collation string
+		want      string
+	}{
+		{"", "", DefaultCharset},
+		{"latin1", "", "latin1"},
+		{"", "utf8mb4_unicode_ci", DefaultCharset + " COLLATE utf8mb4_unicode_ci"},
+	}
+	for _, tt := range tests {
+		config, err := mysql.ParseDSN(Connection{Host: "localhost", Port: 3306, Charset: tt.charset, Collation: tt.collation}.MySQL())
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, config.Params["charset"])
+	}
+}
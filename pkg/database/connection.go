@@ -1,17 +1,59 @@
 package database
 
 import (
+	"context"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"net"
 	"strings"
+	"time"
 
 	mysql "github.com/go-sql-driver/mysql"
 )
 
+// retryDelay how long to wait before the first retry of a metadata query; each further retry waits longer
+var retryDelay = time.Second
+
+const (
+	// TLSRequired encrypt the connection, verifying the certificate of the server against the system roots
+	TLSRequired = "true"
+	// TLSSkipVerify encrypt the connection, without verifying the certificate of the server
+	TLSSkipVerify = "skip-verify"
+	// TLSPreferred encrypt the connection if the server supports it, without verifying its certificate
+	TLSPreferred = "preferred"
+	// TLSDisabled do not encrypt the connection, the same as empty
+	TLSDisabled = "false"
+)
+
 type Connection struct {
 	User string
 	Pass string
 	Host string
 	Port int
+	// ConnectTimeout how long to wait to establish each connection; 0 for the driver default
+	ConnectTimeout time.Duration
+	// QueryTimeout how long to wait for each metadata query, e.g. listing the databases; 0 for no limit.
+	// Does not apply to dumps or restores, which can take as long as they need.
+	QueryTimeout time.Duration
+	// MaxRetries how many times to retry a metadata query that fails with a transient connection error
+	MaxRetries int
+	// DefaultsFile a MySQL option file, e.g. ~/.my.cnf, from which to read the user, password, host and port
+	// that are not set explicitly
+	DefaultsFile string
+	// Charset character set of the connection, in which statements and data are sent; DefaultCharset if empty
+	Charset string
+	// Collation collation of the connection, which must be one of Charset; the default of Charset if empty
+	Collation string
+	// MaxAllowedPacket the largest packet that the client sends, and so the largest statement of a restore, in
+	// bytes; 0 for the driver default of 64MiB. The server's max_allowed_packet must allow it too.
+	MaxAllowedPacket int
+	// TLS whether and how to encrypt the connection, one of TLSRequired, TLSSkipVerify, TLSPreferred or
+	// TLSDisabled; unencrypted if empty. Ignored for a unix socket.
+	TLS string
+	// timeZone the time zone of the session, e.g. +00:00, in which TIMESTAMP values are read and written; the
+	// server's time_zone if empty. Set by Dump, rather than configured.
+	timeZone string
 }
 
 func (c Connection) MySQL() string {
@@ -26,5 +68,97 @@ func (c Connection) MySQL() string {
 		config.Addr = fmt.Sprintf("%s:%d", c.Host, c.Port)
 	}
 	config.ParseTime = true
+	config.Timeout = c.ConnectTimeout
+	// the driver sets the charset parameter verbatim with SET NAMES, so that it can carry the collation too
+	names := c.charset()
+	if c.Collation != "" {
+		names += " COLLATE " + c.Collation
+	}
+	config.Params = map[string]string{"charset": names}
+	// set with SET on each connection, as any other parameter, which must be quoted as a value of SQL
+	if c.timeZone != "" {
+		config.Params["time_zone"] = "'" + c.timeZone + "'"
+	}
+	if c.MaxAllowedPacket > 0 {
+		config.MaxAllowedPacket = c.MaxAllowedPacket
+	}
+	if c.TLS != "" && config.Net == "tcp" {
+		config.TLSConfig = c.TLS
+	}
 	return config.FormatDSN()
 }
+
+// Redacted the DSN of the connection, as from MySQL, with the password, if any, replaced by xxxxx, for logging
+func (c Connection) Redacted() string {
+	if c.Pass != "" {
+		c.Pass = "xxxxx"
+	}
+	return c.MySQL()
+}
+
+// ValidateMaxAllowedPacket check the largest packet that the client may send, which must not be negative
+func ValidateMaxAllowedPacket(size int) error {
+	if size < 0 {
+		return fmt.Errorf("invalid max allowed packet %d, must be at least 0", size)
+	}
+	return nil
+}
+
+// ValidateTLS check the TLS mode of a connection, which must be empty or one of the known modes
+func ValidateTLS(mode string) error {
+	switch mode {
+	case "", TLSRequired, TLSSkipVerify, TLSPreferred, TLSDisabled:
+		return nil
+	}
+	return fmt.Errorf("invalid tls %q, must be one of: %s, %s, %s, %s", mode, TLSRequired, TLSSkipVerify, TLSPreferred, TLSDisabled)
+}
+
+// charset the character set of the connection
+func (c Connection) charset() string {
+	if c.Charset == "" {
+		return DefaultCharset
+	}
+	return c.Charset
+}
+
+// metadataQuery run the metadata query fn, limited to the query timeout, retrying up to MaxRetries times
+// if it fails with a transient error
+func (c Connection) metadataQuery(ctx context.Context, fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = c.withQueryTimeout(ctx, fn)
+		if err == nil || attempt >= c.MaxRetries || ctx.Err() != nil || !transient(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryDelay * time.Duration(attempt+1)):
+		}
+	}
+}
+
+func (c Connection) withQueryTimeout(ctx context.Context, fn func(ctx context.Context) error) error {
+	if c.QueryTimeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.QueryTimeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// transient whether err is a connection error or timeout that might succeed if tried again
+func transient(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netErr)
+}
+
+// AccessDenied whether err is the server rejecting the credentials, or their access to a database, which no
+// retry can fix
+func AccessDenied(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && (mysqlErr.Number == 1044 || mysqlErr.Number == 1045)
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadataQuery(t *testing.T) {
+	retryDelay = time.Millisecond
+	permanent := errors.New("access denied")
+	tests := []struct {
+		name       string
+		conn       Connection
+		errs       []error
+		wantErr    error
+		wantCalled int
+	}{
+		{"success", Connection{MaxRetries: 2}, []error{nil}, nil, 1},
+		{"no retries", Connection{}, []error{driver.ErrBadConn, nil}, driver.ErrBadConn, 1},
+		{"retry transient", Connection{MaxRetries: 2}, []error{driver.ErrBadConn, driver.ErrBadConn, nil}, nil, 3},
+		{"retries exhausted", Connection{MaxRetries: 1}, []error{driver.ErrBadConn, driver.ErrBadConn, nil}, driver.ErrBadConn, 2},
+		{"no retry permanent", Connection{MaxRetries: 2}, []error{permanent, nil}, permanent, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called int
+			err := tt.conn.metadataQuery(context.Background(), func(ctx context.Context) error {
+				called++
+				return tt.errs[called-1]
+			})
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantCalled, called)
+		})
+	}
+}
+
+func TestMetadataQueryTimeout(t *testing.T) {
+	retryDelay = time.Millisecond
+	var called int
+	conn := Connection{QueryTimeout: 10 * time.Millisecond, MaxRetries: 1}
+	err := conn.metadataQuery(context.Background(), func(ctx context.Context) error {
+		called++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	// a query that times out is retried
+	assert.Equal(t, 2, called)
+}
+
+func TestMySQL(t *testing.T) {
+	conn := Connection{User: "user", Pass: "secret", Host: "db", Port: 3306}
+	assert.Equal(t, "user:secret@tcp(db:3306)/?parseTime=true&charset=utf8mb4", conn.MySQL())
+	assert.Equal(t, "user:xxxxx@tcp(db:3306)/?parseTime=true&charset=utf8mb4", conn.Redacted())
+	conn.MaxAllowedPacket = 1 << 30
+	assert.Equal(t, "user:secret@tcp(db:3306)/?parseTime=true&maxAllowedPacket=1073741824&charset=utf8mb4", conn.MySQL())
+	conn.timeZone = utcTimeZone
+	assert.Equal(t, "user:secret@tcp(db:3306)/?parseTime=true&maxAllowedPacket=1073741824&charset=utf8mb4&time_zone=%27%2B00%3A00%27", conn.MySQL())
+}
+
+func TestMySQLTLS(t *testing.T) {
+	conn := Connection{User: "user", Host: "db", Port: 3306, TLS: TLSSkipVerify}
+	assert.Equal(t, "user@tcp(db:3306)/?parseTime=true&tls=skip-verify&charset=utf8mb4", conn.MySQL())
+	// a unix socket is local, so never encrypted
+	conn.Host = "/var/run/mysqld/mysqld.sock"
+	assert.Equal(t, "user@unix(/var/run/mysqld/mysqld.sock)/?parseTime=true&charset=utf8mb4", conn.MySQL())
+
+	assert.NoError(t, ValidateTLS(""))
+	assert.NoError(t, ValidateTLS(TLSRequired))
+	assert.Error(t, ValidateTLS("required"))
+}
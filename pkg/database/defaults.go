@@ -0,0 +1,118 @@
+package database
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const defaultPort = 3306
+
+// defaultsSections the sections of a MySQL option file that are read, in order; a later section
+// overrides an earlier one, as mysqldump itself does
+var defaultsSections = []string{"client", "mysqldump"}
+
+// WithDefaultsFile the connection with any of user, password, host and port that are not set explicitly
+// filled in from the MySQL option file DefaultsFile, e.g. ~/.my.cnf, the same way as
+// mysqldump --defaults-extra-file. Explicit settings always take precedence over the file.
+// If there is no DefaultsFile, the connection is returned unchanged, other than the default port.
+func (c Connection) WithDefaultsFile() (Connection, error) {
+	if c.DefaultsFile != "" {
+		opts, err := readDefaultsFile(c.DefaultsFile)
+		if err != nil {
+			return c, err
+		}
+		if c.User == "" {
+			c.User = opts["user"]
+		}
+		if c.Pass == "" {
+			c.Pass = opts["password"]
+		}
+		if c.Host == "" {
+			c.Host = opts["host"]
+		}
+		// as with the mysql client, the socket is used when the host is not set, or is localhost
+		if socket := opts["socket"]; socket != "" && (c.Host == "" || c.Host == "localhost") {
+			c.Host = socket
+		}
+		if c.Port == 0 && opts["port"] != "" {
+			port, err := strconv.Atoi(opts["port"])
+			if err != nil {
+				return c, fmt.Errorf("invalid port %q in defaults file %s", opts["port"], c.DefaultsFile)
+			}
+			c.Port = port
+		}
+	}
+	if c.Port == 0 {
+		c.Port = defaultPort
+	}
+	return c, nil
+}
+
+// readDefaultsFile read the options in the defaultsSections of a MySQL option file. Directives, such
+// as !include, are not followed.
+func readDefaultsFile(filename string) (map[string]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open defaults file: %v", err)
+	}
+	defer f.Close()
+
+	var (
+		opts    = map[string]string{}
+		section string
+		byName  = map[string]map[string]string{}
+		scanner = bufio.NewScanner(f)
+	)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "", line[0] == '#', line[0] == ';', line[0] == '!':
+			continue
+		case line[0] == '[':
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("invalid section at line %d of defaults file %s", lineNo, filename)
+			}
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		// option names can use - and _ interchangeably
+		key = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "_", "-")
+		value, err := optionValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s at line %d of defaults file %s: %v", key, lineNo, filename, err)
+		}
+		if byName[section] == nil {
+			byName[section] = map[string]string{}
+		}
+		byName[section][key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read defaults file: %v", err)
+	}
+	for _, s := range defaultsSections {
+		for k, v := range byName[s] {
+			opts[k] = v
+		}
+	}
+	return opts, nil
+}
+
+// optionValue the value of an option, without quotes or a trailing comment, and with escape
+// sequences replaced
+func optionValue(value string) (string, error) {
+	if value != "" && (value[0] == '"' || value[0] == '\'') {
+		end := strings.IndexByte(value[1:], value[0])
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quote")
+		}
+		value = value[1 : end+1]
+	} else if i := strings.Index(value, "#"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	replacer := strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\r`, "\r", `\b`, "\b", `\s`, " ", `\"`, `"`, `\'`, "'", `\\`, `\`)
+	return replacer.Replace(value), nil
+}
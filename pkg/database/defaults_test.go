@@ -0,0 +1,60 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDefaultsFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "my.cnf")
+	require.NoError(t, os.WriteFile(filename, []byte(`# credentials for backups
+[mysql]
+user = ignored
+
+[client]
+user = backup
+password = "s3cr#t"
+host=db.example.com
+port = 3307 # non-standard
+
+[mysqldump]
+password = 'dump\\pass'
+quick
+!includedir /etc/mysql/conf.d/
+`), 0o600))
+	socketFile := filepath.Join(dir, "socket.cnf")
+	require.NoError(t, os.WriteFile(socketFile, []byte("[client]\nuser=backup\nsocket=/var/run/mysqld/mysqld.sock\n"), 0o600))
+	badPort := filepath.Join(dir, "badport.cnf")
+	require.NoError(t, os.WriteFile(badPort, []byte("[client]\nport=abc\n"), 0o600))
+
+	tests := []struct {
+		name    string
+		conn    Connection
+		want    Connection
+		wantErr bool
+	}{
+		{"no file", Connection{Host: "abc"}, Connection{Host: "abc", Port: defaultPort}, false},
+		{"from file", Connection{DefaultsFile: filename}, Connection{User: "backup", Pass: `dump\pass`, Host: "db.example.com", Port: 3307, DefaultsFile: filename}, false},
+		{"explicit precedence", Connection{User: "root", Host: "abc", Port: 3306, DefaultsFile: filename}, Connection{User: "root", Pass: `dump\pass`, Host: "abc", Port: 3306, DefaultsFile: filename}, false},
+		{"socket", Connection{DefaultsFile: socketFile}, Connection{User: "backup", Host: "/var/run/mysqld/mysqld.sock", Port: defaultPort, DefaultsFile: socketFile}, false},
+		{"explicit host over socket", Connection{Host: "abc", DefaultsFile: socketFile}, Connection{User: "backup", Host: "abc", Port: defaultPort, DefaultsFile: socketFile}, false},
+		{"missing file", Connection{DefaultsFile: filepath.Join(dir, "missing.cnf")}, Connection{}, true},
+		{"invalid port", Connection{DefaultsFile: badPort}, Connection{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.conn.WithDefaultsFile()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ValidateDropAllowed check the databases that a restore that drops them first may drop. They must be set
+// whenever drop is, so that dropping is always confirmed by naming the databases, and none may be a system
+// database.
+func ValidateDropAllowed(drop bool, allowed []string) error {
+	if !drop {
+		if len(allowed) > 0 {
+			return fmt.Errorf("databases that may be dropped are set, but not dropping before restore")
+		}
+		return nil
+	}
+	if len(allowed) == 0 {
+		return fmt.Errorf("dropping before restore requires the databases that may be dropped")
+	}
+	for _, name := range allowed {
+		if slices.Contains(excludeSchemaList, strings.ToLower(name)) {
+			return fmt.Errorf("system database %s may not be dropped", name)
+		}
+	}
+	return nil
+}
+
+// restoreDatabases the databases that the SQL in the readers uses, after renaming with databasesMap, in the
+// order in which they are first used, and which of them it creates itself. Leaves the readers at the start.
+func restoreDatabases(readers []io.ReadSeeker, databasesMap map[string]string) (names []string, created map[string]bool, err error) {
+	created = map[string]bool{}
+	rename := func(name string) string {
+		if newName, ok := databasesMap[name]; ok {
+			return newName
+		}
+		return name
+	}
+	for _, r := range readers {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			var name string
+			if m := createRegex.FindStringSubmatch(line); m != nil {
+				name = rename(m[3])
+				// only if it is created before it is used
+				if !slices.Contains(names, name) {
+					created[name] = true
+				}
+			} else if m := useRegex.FindStringSubmatch(line); m != nil {
+				name = rename(m[2])
+			} else {
+				continue
+			}
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, nil, fmt.Errorf("unable to read restore file: %v", err)
+		}
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, nil, fmt.Errorf("unable to rewind restore file: %v", err)
+		}
+	}
+	return names, created, nil
+}
+
+// dropDatabases drop each of the databases that the readers use, and create again those that they do not create
+// themselves, so that the restore starts from empty databases. Fails without dropping any if one is not in
+// allowed. Returns the databases dropped.
+func dropDatabases(ctx context.Context, db *sql.DB, readers []io.ReadSeeker, databasesMap map[string]string, allowed []string) ([]string, error) {
+	names, created, err := restoreDatabases(readers, databasesMap)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("dropping before restore, but the dump does not name any database to drop")
+	}
+	for _, name := range names {
+		if !slices.Contains(allowed, name) {
+			return nil, fmt.Errorf("dropping before restore, but database %s is not one of the databases that may be dropped", name)
+		}
+	}
+	var dropped []string
+	for _, name := range names {
+		if _, err := db.ExecContext(ctx, "DROP DATABASE IF EXISTS "+quoteName(name)); err != nil {
+			return dropped, fmt.Errorf("failed to drop database %s: %v", name, err)
+		}
+		dropped = append(dropped, name)
+		// the dump creates it with its own character set and collation
+		if created[name] {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, "CREATE DATABASE "+quoteName(name)); err != nil {
+			return dropped, fmt.Errorf("failed to create database %s: %v", name, err)
+		}
+	}
+	return dropped, nil
+}
+
+// quoteName quote a database name for SQL
+func quoteName(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDropAllowed(t *testing.T) {
+	tests := []struct {
+		drop    bool
+		allowed []string
+		err     bool
+	}{
+		{false, nil, false},
+		{true, []string{"app"}, false},
+		{true, []string{"app", "app_test"}, false},
+		{true, nil, true},
+		{false, []string{"app"}, true},
+		{true, []string{"app", "mysql"}, true},
+		{true, []string{"Sys"}, true},
+	}
+	for _, tt := range tests {
+		err := ValidateDropAllowed(tt.drop, tt.allowed)
+		if tt.err {
+			assert.Error(t, err, "drop %v, allowed %v", tt.drop, tt.allowed)
+		} else {
+			assert.NoError(t, err, "drop %v, allowed %v", tt.drop, tt.allowed)
+		}
+	}
+}
+
+func TestRestoreDatabases(t *testing.T) {
+	first := strings.NewReader("CREATE DATABASE /*!32312 IF NOT EXISTS*/ `app` /*!40100 DEFAULT CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci */ /*!80016 DEFAULT ENCRYPTION='N' */;\n" +
+		"USE `app`;\n" +
+		"DROP TABLE IF EXISTS `users`;\n")
+	second := strings.NewReader("USE `other`;\n" +
+		"INSERT INTO `t` VALUES ('USE `notadatabase`;');\n" +
+		"USE `app`;\n")
+	readers := []io.ReadSeeker{first, second}
+
+	names, created, err := restoreDatabases(readers, map[string]string{"app": "app_copy"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app_copy", "other"}, names)
+	assert.Equal(t, map[string]bool{"app_copy": true}, created)
+
+	// left at the start, to be restored
+	b, err := io.ReadAll(first)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(b), "CREATE DATABASE"))
+}
+
+func TestQuoteName(t *testing.T) {
+	assert.Equal(t, "`app`", quoteName("app"))
+	assert.Equal(t, "`a``b`", quoteName("a`b"))
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -11,9 +12,39 @@ type DumpOpts struct {
 	Compact             bool
 	SuppressUseDatabase bool
 	MaxAllowedPacket    int
+	// RowsPerInsert the most rows in each INSERT statement; 1 for one per row, 0 for as many as fit in
+	// MaxAllowedPacket
+	RowsPerInsert int
+	// SkipExtendedInsert one row per INSERT statement, like mysqldump --skip-extended-insert, whatever RowsPerInsert
+	SkipExtendedInsert bool
+	// HexBlob dump binary columns as hex literals, rather than as escaped strings
+	HexBlob bool
+	// ObjectTypes the types of object to dump, of ObjectTables and ObjectViews; all if empty
+	ObjectTypes []string
+	// ConsistentAcrossDatabases dump all of the schemas in a single transaction, so that they are consistent
+	// with each other, rather than each in its own
+	ConsistentAcrossDatabases bool
+	// Where WHERE clauses, by "<database>.<table>", to dump only some of the rows of those tables
+	Where map[string]string
+	// Partitions partitions, by "<database>.<table>", to dump only those partitions of those tables, which a
+	// restore then replaces, keeping the others
+	Partitions map[string][]string
+	// SkipSetCharset do not set the character set in which the dump is written, like mysqldump --skip-set-charset,
+	// so that it is restored in that of the restore
+	SkipSetCharset bool
+	// OrderByPrimary dump the rows of each table in the order of its primary key, like mysqldump --order-by-primary,
+	// so that dumps of the same data are the same
+	OrderByPrimary bool
+	// SkipTzUtc dump TIMESTAMP values in the time zone of the server, and do not set the time zone of the restore,
+	// like mysqldump --skip-tz-utc, rather than dump and restore them in UTC
+	SkipTzUtc bool
 }
 
-func Dump(dbconn Connection, opts DumpOpts, writers []DumpWriter) error {
+// utcTimeZone the time zone in which TIMESTAMP values are dumped, unless SkipTzUtc, as the dump sets it for the
+// restore
+const utcTimeZone = "+00:00"
+
+func Dump(ctx context.Context, dbconn Connection, opts DumpOpts, writers []DumpWriter) error {
 
 	// TODO: dump data for each writer:
 	// per schema
@@ -22,6 +53,29 @@ func Dump(dbconn Connection, opts DumpOpts, writers []DumpWriter) error {
 	//    mysqldump -A $MYSQLDUMP_OPTS
 	// all at once limited to some databases
 	//    mysqldump --databases $DB_NAMES $MYSQLDUMP_OPTS
+	dbconn, err := dbconn.WithDefaultsFile()
+	if err != nil {
+		return err
+	}
+	// every connection reads the TIMESTAMP values in UTC, in which the dump restores them
+	if !opts.SkipTzUtc {
+		dbconn.timeZone = utcTimeZone
+	}
+	// a single read only transaction for every schema of every writer, so they all see the same snapshot
+	var tx *sql.Tx
+	if opts.ConsistentAcrossDatabases {
+		db, err := sql.Open("mysql", dbconn.MySQL())
+		if err != nil {
+			return fmt.Errorf("failed to open connection to database: %v", err)
+		}
+		defer db.Close()
+		if tx, err = db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}); err != nil {
+			return fmt.Errorf("failed to begin transaction: %v", err)
+		}
+		defer func() {
+			_ = tx.Rollback()
+		}()
+	}
 	for _, writer := range writers {
 		db, err := sql.Open("mysql", dbconn.MySQL())
 		if err != nil {
@@ -33,12 +87,26 @@ func Dump(dbconn Connection, opts DumpOpts, writers []DumpWriter) error {
 				Out:                 writer.Writer,
 				Connection:          db,
 				Schema:              schema,
+				Tables:              writer.Tables,
+				IgnoreTables:        writer.IgnoreTables,
 				Host:                dbconn.Host,
 				Compact:             opts.Compact,
 				SuppressUseDatabase: opts.SuppressUseDatabase,
 				MaxAllowedPacket:    opts.MaxAllowedPacket,
+				RowsPerInsert:       rowsPerInsert(opts),
+				HexBlob:             opts.HexBlob,
+				ConnectionCharset:   dbconn.charset(),
+				ConnectionCollation: dbconn.Collation,
+				SkipBaseTables:      !includesObjectType(opts.ObjectTypes, ObjectTables),
+				SkipViews:           !includesObjectType(opts.ObjectTypes, ObjectViews),
+				Where:               whereFor(opts.Where, schema),
+				Partitions:          partitionsFor(opts.Partitions, schema),
+				SkipSetCharset:      opts.SkipSetCharset,
+				OrderByPrimary:      opts.OrderByPrimary,
+				SkipTzUtc:           opts.SkipTzUtc,
+				Tx:                  tx,
 			}
-			if err := dumper.Dump(); err != nil {
+			if err := dumper.Dump(ctx); err != nil {
 				return fmt.Errorf("failed to dump database %s: %v", schema, err)
 			}
 		}
@@ -6,5 +6,9 @@ import (
 
 type DumpWriter struct {
 	Schemas []string
-	Writer  io.Writer
+	// Tables if set, limit the dump to only these tables in the schemas
+	Tables []string
+	// IgnoreTables tables in the schemas to leave out of the dump
+	IgnoreTables []string
+	Writer       io.Writer
 }
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	mysql "github.com/go-sql-driver/mysql"
+)
+
+const (
+	// GTIDWarn check whether the server can take the GTID_PURGED of the dump, and report it if not, but restore
+	// the dump as it is
+	GTIDWarn = "warn"
+	// GTIDStrip restore the dump without its GTID_PURGED statements, leaving the GTIDs of the server as they are
+	GTIDStrip = "strip"
+	// GTIDReset reset the binary logs and GTIDs of the server before restoring, if it could not otherwise take
+	// the GTID_PURGED of the dump
+	GTIDReset = "reset"
+
+	// mysqlUnknownSystemVariable the error of a server without the variable, e.g. gtid_mode on MariaDB
+	mysqlUnknownSystemVariable = 1193
+)
+
+// gtidPurgedRegex the statement of a dump, e.g. by mysqldump, that sets the GTIDs of the server to those of the
+// dump. mysqldump 8.0 and later adds to them, rather than replacing them, with a '+' in a versioned comment.
+var gtidPurgedRegex = regexp.MustCompile(`(?ims)^\s*SET\s+@@GLOBAL\.GTID_PURGED\s*=\s*(/\*!\d+\s*'\+'\s*\*/)?\s*'([^']*)'\s*;`)
+
+// ValidateGTIDMode check how to handle the GTIDs of a dump, empty to restore it as it is without checking
+func ValidateGTIDMode(mode string) error {
+	switch mode {
+	case "", GTIDWarn, GTIDStrip, GTIDReset:
+		return nil
+	default:
+		return fmt.Errorf("invalid GTID mode %q, must be one of: %s, %s, %s", mode, GTIDWarn, GTIDStrip, GTIDReset)
+	}
+}
+
+// dumpGTIDPurged the GTIDs that the SQL in the readers sets as purged, and whether it adds them to those of the
+// server, rather than replacing them; empty if it sets none. Leaves the readers at the start.
+func dumpGTIDPurged(readers []io.ReadSeeker) (gtids string, add bool, err error) {
+	for _, r := range readers {
+		scanner := bufio.NewScanner(r)
+		var current string
+		for scanner.Scan() && gtids == "" {
+			line := scanner.Text()
+			current += line + "\n"
+			if line == "" || line[len(line)-1] != ';' {
+				continue
+			}
+			if m := gtidPurgedRegex.FindStringSubmatch(current); m != nil {
+				gtids, add = strings.Join(strings.Fields(m[2]), ""), m[1] != ""
+			}
+			current = ""
+		}
+		if err := scanner.Err(); err != nil {
+			return "", false, fmt.Errorf("unable to read restore file: %v", err)
+		}
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return "", false, fmt.Errorf("unable to rewind restore file: %v", err)
+		}
+		if gtids != "" {
+			break
+		}
+	}
+	return gtids, add, nil
+}
+
+// gtidConflict why the server cannot take the GTIDs of a dump, as set by dumpGTIDPurged, and whether resetting
+// its GTIDs would let it; empty if it can
+func gtidConflict(ctx context.Context, db *sql.DB, gtids string, add bool) (string, bool, error) {
+	var mode, executed string
+	err := db.QueryRowContext(ctx, "SELECT @@GLOBAL.gtid_mode, @@GLOBAL.gtid_executed").Scan(&mode, &executed)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlUnknownSystemVariable {
+		return "the dump sets GTID_PURGED, but the server does not have MySQL GTIDs, e.g. it is MariaDB", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("could not get GTID state of server: %v", err)
+	}
+	if strings.EqualFold(mode, "OFF") {
+		return "the dump sets GTID_PURGED, but GTIDs are off on the server, with gtid_mode OFF", false, nil
+	}
+	executed = strings.Join(strings.Fields(executed), "")
+	if executed == "" {
+		return "", false, nil
+	}
+	if !add {
+		return fmt.Sprintf("the dump replaces GTID_PURGED, but the server has already executed GTIDs %s", executed), true, nil
+	}
+	// the GTIDs of the dump that the server has executed already, which it may not add again
+	var overlap string
+	if err := db.QueryRowContext(ctx, "SELECT GTID_SUBTRACT(?, GTID_SUBTRACT(?, @@GLOBAL.gtid_executed))", gtids, gtids).Scan(&overlap); err != nil {
+		return "", false, fmt.Errorf("could not compare GTIDs of dump with server: %v", err)
+	}
+	if overlap != "" {
+		return fmt.Sprintf("the dump adds to GTID_PURGED, but the server has already executed GTIDs %s of it", overlap), true, nil
+	}
+	return "", false, nil
+}
+
+// resetGTIDs reset the binary logs and GTIDs of the server, so that it can take those of any dump
+func resetGTIDs(ctx context.Context, db *sql.DB) error {
+	// RESET BINARY LOGS AND GTIDS replaces RESET MASTER in MySQL 8.2 and later, which removes it in 8.4
+	_, err := db.ExecContext(ctx, "RESET BINARY LOGS AND GTIDS")
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlSyntaxError {
+		_, err = db.ExecContext(ctx, "RESET MASTER")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reset GTIDs of server: %v", err)
+	}
+	return nil
+}
+
+// checkGTIDs check whether the server can take the GTIDs that the SQL in the readers sets, by mode, resetting
+// those of the server if the mode is GTIDReset and that would let it. Returns why it cannot, if it still
+// cannot, and whether the server was reset.
+func checkGTIDs(ctx context.Context, db *sql.DB, mode string, readers []io.ReadSeeker) (conflict string, reset bool, err error) {
+	if mode != GTIDWarn && mode != GTIDReset {
+		return "", false, nil
+	}
+	gtids, add, err := dumpGTIDPurged(readers)
+	if err != nil || gtids == "" {
+		return "", false, err
+	}
+	conflict, resettable, err := gtidConflict(ctx, db, gtids, add)
+	if err != nil || conflict == "" || mode != GTIDReset {
+		return conflict, false, err
+	}
+	if !resettable {
+		return "", false, fmt.Errorf("cannot reset GTIDs for the restore: %s; restore with GTID mode %s instead", conflict, GTIDStrip)
+	}
+	if err := resetGTIDs(ctx, db); err != nil {
+		return "", false, err
+	}
+	return "", true, nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateGTIDMode(t *testing.T) {
+	for _, mode := range []string{"", GTIDWarn, GTIDStrip, GTIDReset} {
+		assert.NoError(t, ValidateGTIDMode(mode), mode)
+	}
+	assert.Error(t, ValidateGTIDMode("off"))
+}
+
+func TestDumpGTIDPurged(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		gtids string
+		add   bool
+	}{
+		{"none", []string{"USE `app`;\nINSERT INTO `t` VALUES (1);\n"}, "", false},
+		{"replaces", []string{"SET @@GLOBAL.GTID_PURGED='3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5';\nUSE `app`;\n"}, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5", false},
+		{"adds", []string{"--\n-- GTID state at the beginning of the backup\n--\n\nSET @@GLOBAL.GTID_PURGED=/*!80000 '+'*/ '3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5';\n"}, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5", true},
+		{"over lines", []string{"SET @@GLOBAL.GTID_PURGED=/*!80000 '+'*/ '3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,\n4e11fa47-71ca-11e1-9e33-c80aa9429562:1-3';\n"}, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,4e11fa47-71ca-11e1-9e33-c80aa9429562:1-3", true},
+		{"second file", []string{"USE `app`;\n", "set @@global.gtid_purged='3e11fa47-71ca-11e1-9e33-c80aa9429562:1';\n"}, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1", false},
+		{"in data", []string{"INSERT INTO `t` VALUES ('SET @@GLOBAL.GTID_PURGED=\\'x\\';');\n"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var readers []io.ReadSeeker
+			for _, f := range tt.files {
+				readers = append(readers, strings.NewReader(f))
+			}
+			gtids, add, err := dumpGTIDPurged(readers)
+			require.NoError(t, err)
+			assert.Equal(t, tt.gtids, gtids)
+			assert.Equal(t, tt.add, add)
+			// left at the start, to be restored
+			b, err := io.ReadAll(readers[0])
+			require.NoError(t, err)
+			assert.Equal(t, tt.files[0], string(b))
+		})
+	}
+}
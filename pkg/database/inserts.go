@@ -0,0 +1,23 @@
+package database
+
+import "fmt"
+
+// ValidateRowsPerInsert check the most rows in each INSERT statement, 0 for as many as fit, and whether to skip
+// extended inserts, i.e. one row per INSERT, which only agrees with 0 or 1 rows per insert
+func ValidateRowsPerInsert(rows int, skipExtendedInsert bool) error {
+	if rows < 0 {
+		return fmt.Errorf("invalid rows per insert %d, must be at least 1, or 0 for as many as fit", rows)
+	}
+	if skipExtendedInsert && rows > 1 {
+		return fmt.Errorf("rows per insert %d cannot be used when skipping extended inserts, which have one row each", rows)
+	}
+	return nil
+}
+
+// rowsPerInsert the most rows in each INSERT statement of the dump, for the options
+func rowsPerInsert(opts DumpOpts) int {
+	if opts.SkipExtendedInsert {
+		return 1
+	}
+	return opts.RowsPerInsert
+}
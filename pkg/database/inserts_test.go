@@ -0,0 +1,37 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRowsPerInsert(t *testing.T) {
+	tests := []struct {
+		rows int
+		skip bool
+		err  bool
+	}{
+		{0, false, false},
+		{1, false, false},
+		{500, false, false},
+		{0, true, false},
+		{1, true, false},
+		{500, true, true},
+		{-1, false, true},
+	}
+	for _, tt := range tests {
+		err := ValidateRowsPerInsert(tt.rows, tt.skip)
+		if tt.err {
+			assert.Error(t, err, "%d rows, skip %v", tt.rows, tt.skip)
+		} else {
+			assert.NoError(t, err, "%d rows, skip %v", tt.rows, tt.skip)
+		}
+	}
+}
+
+func TestRowsPerInsert(t *testing.T) {
+	assert.Equal(t, 0, rowsPerInsert(DumpOpts{}))
+	assert.Equal(t, 500, rowsPerInsert(DumpOpts{RowsPerInsert: 500}))
+	assert.Equal(t, 1, rowsPerInsert(DumpOpts{SkipExtendedInsert: true}))
+}
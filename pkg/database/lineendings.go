@@ -0,0 +1,54 @@
+package database
+
+import (
+	"io"
+)
+
+// lineEndingReader reads the SQL of r with its line endings, CRLF or a lone CR, normalized to LF, e.g. of a dump
+// written on Windows
+type lineEndingReader struct {
+	r io.ReadSeeker
+	// cr whether the last byte read was a CR, already written as an LF, so that an LF that follows it is dropped
+	cr bool
+}
+
+// newLineEndingReaders wrap each of readers to normalize its line endings
+func newLineEndingReaders(readers []io.ReadSeeker) []io.ReadSeeker {
+	normalized := make([]io.ReadSeeker, 0, len(readers))
+	for _, r := range readers {
+		normalized = append(normalized, &lineEndingReader{r: r})
+	}
+	return normalized
+}
+
+func (l *lineEndingReader) Read(p []byte) (int, error) {
+	for {
+		n, err := l.r.Read(p)
+		// normalized in place, as it is never longer
+		w := 0
+		for _, b := range p[:n] {
+			switch {
+			case b == '\r':
+				p[w] = '\n'
+				w++
+				l.cr = true
+			case b == '\n' && l.cr:
+				l.cr = false
+			default:
+				p[w] = b
+				w++
+				l.cr = false
+			}
+		}
+		// a read of only the LF of a CRLF is nothing, so read on rather than return nothing
+		if w > 0 || err != nil || n == 0 {
+			return w, err
+		}
+	}
+}
+
+// Seek in r, which is only ever to its start or end, where no CR has been read
+func (l *lineEndingReader) Seek(offset int64, whence int) (int64, error) {
+	l.cr = false
+	return l.r.Seek(offset, whence)
+}
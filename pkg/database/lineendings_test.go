@@ -0,0 +1,42 @@
+package database
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineEndingReader(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{"lf", "USE `a`;\nSELECT 1;\n", "USE `a`;\nSELECT 1;\n"},
+		{"crlf", "USE `a`;\r\nSELECT 1;\r\n", "USE `a`;\nSELECT 1;\n"},
+		{"cr", "USE `a`;\rSELECT 1;\r", "USE `a`;\nSELECT 1;\n"},
+		{"mixed", "USE `a`;\r\n\rSELECT 1;\n\r\n", "USE `a`;\n\nSELECT 1;\n\n"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// one byte at a time, so that each CRLF is split across reads
+			r := &lineEndingReader{r: struct {
+				io.Reader
+				io.Seeker
+			}{iotest.OneByteReader(strings.NewReader(tt.in)), strings.NewReader(tt.in)}}
+			b, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, tt.out, string(b))
+
+			r = &lineEndingReader{r: strings.NewReader(tt.in)}
+			b, err = io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, tt.out, string(b))
+		})
+	}
+}
@@ -19,7 +19,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"io"
+	"sort"
 	"text/template"
 	"time"
 )
@@ -30,14 +32,29 @@ Data struct to configure dump behavior
 	Out:              Stream to wite to
 	Connection:       Database connection to dump
 	IgnoreTables:     Mark sensitive tables to ignore
+	Tables:           Limit the dump to only these tables, if any are set
 	MaxAllowedPacket: Sets the largest packet size to use in backups
+	RowsPerInsert:    The most rows in each INSERT statement, 1 for a statement per row, like mysqldump --skip-extended-insert; 0 for as many as fit in MaxAllowedPacket
 	LockTables:       Lock all tables for the duration of the dump
+	HexBlob:          Dump binary columns as hex literals, like mysqldump --hex-blob
+	ConnectionCharset: Character set of the connection, in which the dump is written; the database default if empty
+	ConnectionCollation: Collation of the connection, which SET NAMES sets with the character set; its default if empty
+	SkipSetCharset:   Do not write SET NAMES for the connection character set, nor set the client character set around each table, like mysqldump --skip-set-charset
+	SkipBaseTables:   Do not dump base tables, e.g. to dump only the views
+	SkipViews:        Do not dump views
+	Where:            WHERE clauses, by table, to dump only some of the rows of those tables; each must be a base table of the schema
+	Partitions:       Partitions, by table, to dump only those partitions of those tables, which a restore then replaces, keeping the others; each must be a base table of the schema
+	OrderByPrimary:   Dump the rows of each table ordered by its primary key, or else its first unique index of NOT NULL columns, like mysqldump --order-by-primary, so that the same data is dumped the same way
+	SkipTzUtc:        Do not set the time zone of the restore to UTC, like mysqldump --skip-tz-utc, for a dump whose TIMESTAMP values are in the time zone of the server rather than in UTC
+	Tx:               Dump in this transaction, e.g. one shared with the dumps of other schemas, so that they are consistent with each other, rather than in one of its own; the caller ends it
 */
 type Data struct {
 	Out                 io.Writer
 	Connection          *sql.DB
 	IgnoreTables        []string
+	Tables              []string
 	MaxAllowedPacket    int
+	RowsPerInsert       int
 	LockTables          bool
 	Schema              string
 	Compact             bool
@@ -45,6 +62,17 @@ type Data struct {
 	SuppressUseDatabase bool
 	Charset             string
 	Collation           string
+	HexBlob             bool
+	ConnectionCharset   string
+	ConnectionCollation string
+	SkipSetCharset      bool
+	SkipBaseTables      bool
+	SkipViews           bool
+	Where               map[string]string
+	Partitions          map[string][]string
+	OrderByPrimary      bool
+	SkipTzUtc           bool
+	Tx                  *sql.Tx
 
 	tx         *sql.Tx
 	headerTmpl *template.Template
@@ -60,6 +88,14 @@ type metaData struct {
 	Database      string
 	Charset       string
 	Collation     string
+	// ConnectionCharset character set in which the dump is written, which the restore must use to read it
+	ConnectionCharset string
+	// ConnectionCollation collation of the connection, if not the default of its character set
+	ConnectionCollation string
+	// SetCharset whether the dump sets the character set in which it is written
+	SetCharset bool
+	// TzUtc whether the dump sets the time zone of the restore to UTC, the time zone of its TIMESTAMP values
+	TzUtc bool
 }
 
 const (
@@ -76,12 +112,16 @@ const headerTmpl = `-- Go SQL Dump {{ .DumpVersion }}
 -- ------------------------------------------------------
 -- Server version	{{ .ServerVersion }}
 
+{{ if .SetCharset -}}
 /*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;
 /*!40101 SET @OLD_CHARACTER_SET_RESULTS=@@CHARACTER_SET_RESULTS */;
 /*!40101 SET @OLD_COLLATION_CONNECTION=@@COLLATION_CONNECTION */;
-/*!50503 SET NAMES {{ .Charset }} */;
+/*!50503 SET NAMES {{ .ConnectionCharset }}{{ if .ConnectionCollation }} COLLATE {{ .ConnectionCollation }}{{ end }} */;
+{{ end -}}
+{{ if .TzUtc -}}
 /*!40103 SET @OLD_TIME_ZONE=@@TIME_ZONE */;
 /*!40103 SET TIME_ZONE='+00:00' */;
+{{ end -}}
 /*!40014 SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0 */;
 /*!40014 SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0 */;
 /*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;
@@ -98,14 +138,18 @@ CREATE DATABASE /*!32312 IF NOT EXISTS*/ ` + "`{{.Database}}`" + ` /*!40100 DEFA
 USE ` + "`{{.Database}}`;"
 
 // takes a *metaData
-const footerTmpl = `/*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;
+const footerTmpl = `{{ if .TzUtc -}}
+/*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;
 
+{{ end -}}
 /*!40101 SET SQL_MODE=@OLD_SQL_MODE */;
 /*!40014 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS */;
 /*!40014 SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS */;
+{{ if .SetCharset -}}
 /*!40101 SET CHARACTER_SET_CLIENT=@OLD_CHARACTER_SET_CLIENT */;
 /*!40101 SET CHARACTER_SET_RESULTS=@OLD_CHARACTER_SET_RESULTS */;
 /*!40101 SET COLLATION_CONNECTION=@OLD_COLLATION_CONNECTION */;
+{{ end -}}
 /*!40111 SET SQL_NOTES=@OLD_SQL_NOTES */;
 
 -- Dump completed on {{ .CompleteTime }}`
@@ -114,8 +158,8 @@ const footerTmplCompact = ``
 
 const nullType = "NULL"
 
-// Dump data using struct
-func (data *Data) Dump() error {
+// Dump data using struct. Cancelling ctx aborts the dump.
+func (data *Data) Dump(ctx context.Context) error {
 	meta := metaData{
 		DumpVersion: Version,
 		Host:        data.Host,
@@ -130,19 +174,27 @@ func (data *Data) Dump() error {
 		return err
 	}
 
-	if err := data.selectSchema(); err != nil {
-		return err
-	}
+	if data.Tx != nil {
+		// the schema must be selected on the connection of the transaction, which the caller began
+		data.tx = data.Tx
+		if _, err := data.tx.ExecContext(ctx, "USE "+esc(data.Schema)); err != nil {
+			return err
+		}
+	} else {
+		if err := data.selectSchema(ctx); err != nil {
+			return err
+		}
 
-	// Start the read only transaction and defer the rollback until the end
-	// This way the database will have the exact state it did at the begining of
-	// the backup and nothing can be accidentally committed
-	if err := data.begin(); err != nil {
-		return err
+		// Start the read only transaction and defer the rollback until the end
+		// This way the database will have the exact state it did at the begining of
+		// the backup and nothing can be accidentally committed
+		if err := data.begin(ctx); err != nil {
+			return err
+		}
+		defer func() {
+			_ = data.rollback()
+		}()
 	}
-	defer func() {
-		_ = data.rollback()
-	}()
 
 	if err := data.getCharsetCollections(); err != nil {
 		return err
@@ -161,8 +213,8 @@ func (data *Data) Dump() error {
 		return err
 	}
 
-	// Lock all tables before dumping if present
-	if data.LockTables && len(tables) > 0 {
+	// Lock all tables before dumping if present; not in a shared transaction, which LOCK TABLES would commit
+	if data.LockTables && data.Tx == nil && len(tables) > 0 {
 		var b bytes.Buffer
 		b.WriteString("LOCK TABLES ")
 		for index, table := range tables {
@@ -172,7 +224,7 @@ func (data *Data) Dump() error {
 			b.WriteString("`" + table.Name() + "` READ /*!32311 LOCAL */")
 		}
 
-		if _, err := data.Connection.Exec(b.String()); err != nil {
+		if _, err := data.Connection.ExecContext(ctx, b.String()); err != nil {
 			return err
 		}
 
@@ -182,6 +234,9 @@ func (data *Data) Dump() error {
 	}
 
 	for _, name := range tables {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if err := data.dumpTable(name); err != nil {
 			return err
 		}
@@ -197,18 +252,18 @@ func (data *Data) Dump() error {
 // MARK: - Private methods
 
 // selectSchema selects a specific schema to use
-func (data *Data) selectSchema() error {
+func (data *Data) selectSchema(ctx context.Context) error {
 	if data.Schema == "" {
 		return errors.New("cannot select schema when one is not provided")
 	}
-	_, err := data.Connection.Exec("USE `" + data.Schema + "`")
+	_, err := data.Connection.ExecContext(ctx, "USE `"+data.Schema+"`")
 	return err
 }
 
 // begin starts a read only transaction that will be whatever the database was
-// when it was called
-func (data *Data) begin() (err error) {
-	data.tx, err = data.Connection.BeginTx(context.Background(), &sql.TxOptions{
+// when it was called. Every query in the transaction aborts when ctx is cancelled.
+func (data *Data) begin(ctx context.Context) (err error) {
+	data.tx, err = data.Connection.BeginTx(ctx, &sql.TxOptions{
 		Isolation: sql.LevelRepeatableRead,
 		ReadOnly:  true,
 	})
@@ -272,11 +327,17 @@ func (data *Data) getTables() ([]Table, error) {
 	}
 	defer rows.Close()
 
+	// base tables of the schema, whether or not they are dumped, to check that the WHERE clauses and partitions
+	// are for them
+	baseTables := map[string]bool{}
 	for rows.Next() {
 		var tableName, tableType sql.NullString
 		if err := rows.Scan(&tableName, &tableType); err != nil {
 			return nil, err
 		}
+		if tableName.Valid && tableType.String == "BASE TABLE" {
+			baseTables[tableName.String] = true
+		}
 		if !tableName.Valid || data.isIgnoredTable(tableName.String) {
 			continue
 		}
@@ -287,14 +348,40 @@ func (data *Data) getTables() ([]Table, error) {
 		}
 		switch tableType.String {
 		case "VIEW":
-			tables = append(tables, &view{baseTable: table})
+			if !data.SkipViews {
+				tables = append(tables, &view{baseTable: table})
+			}
 		case "BASE TABLE":
-			tables = append(tables, &table)
+			if !data.SkipBaseTables {
+				tables = append(tables, &table)
+			}
 		default:
 			return nil, errors.New("unknown table type: " + tableType.String)
 		}
 	}
-	return tables, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var unknown []string
+	for name := range data.Where {
+		if !baseTables[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("WHERE clause for tables that are not base tables of database %s: %v", data.Schema, unknown)
+	}
+	for name := range data.Partitions {
+		if !baseTables[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("partitions for tables that are not base tables of database %s: %v", data.Schema, unknown)
+	}
+	return tables, nil
 }
 
 func (data *Data) getCharsetCollections() error {
@@ -325,7 +412,15 @@ func (data *Data) isIgnoredTable(name string) bool {
 			return true
 		}
 	}
-	return false
+	if len(data.Tables) == 0 {
+		return false
+	}
+	for _, item := range data.Tables {
+		if item == name {
+			return false
+		}
+	}
+	return true
 }
 
 func (meta *metaData) updateMetadata(data *Data) (err error) {
@@ -334,6 +429,13 @@ func (meta *metaData) updateMetadata(data *Data) (err error) {
 	meta.ServerVersion = serverVersion.String
 	meta.Collation = data.Collation
 	meta.Charset = data.Charset
+	meta.ConnectionCharset = data.ConnectionCharset
+	meta.ConnectionCollation = data.ConnectionCollation
+	meta.SetCharset = !data.SkipSetCharset
+	meta.TzUtc = !data.SkipTzUtc
+	if meta.ConnectionCharset == "" {
+		meta.ConnectionCharset = data.Charset
+	}
 	return
 }
 
@@ -56,6 +56,10 @@ type baseTable struct {
 	rows     *sql.Rows
 	database string
 	values   []interface{}
+	// rowCount how many rows have been dumped so far
+	rowCount int64
+	// orderBy the escaped columns by which the rows are ordered, with OrderByPrimary; empty if not ordered
+	orderBy string
 }
 
 func (table *baseTable) Name() string {
@@ -83,7 +87,51 @@ func (table *baseTable) CreateSQL() ([]string, error) {
 		return nil, errors.New("returned table is not the same as requested table")
 	}
 
-	return []string{strings.TrimSpace(tableSQL.String)}, nil
+	createSQL := strings.TrimSpace(tableSQL.String)
+	// only some partitions are dumped, so the restore must keep the table, and the others, if it is there
+	if table.Partitioned() {
+		createSQL = strings.Replace(createSQL, "CREATE TABLE ", "CREATE TABLE IF NOT EXISTS ", 1)
+	}
+	return []string{createSQL}, nil
+}
+
+// Partitioned whether only some partitions of the table are dumped
+func (table *baseTable) Partitioned() bool {
+	return len(table.data.Partitions[table.name]) > 0
+}
+
+// Counted whether all of the rows of the table are dumped, rather than those of a WHERE clause or of some
+// partitions, so that a restore can check that the table has the RowCount
+func (table *baseTable) Counted() bool {
+	_, where := table.data.Where[table.name]
+	return !where && !table.Partitioned()
+}
+
+// RowCount how many rows of the table were dumped, once Stream is done
+func (table *baseTable) RowCount() int64 {
+	return table.rowCount
+}
+
+// SetCharset whether to set the client character set around the CREATE TABLE, as mysqldump does
+func (table *baseTable) SetCharset() bool {
+	return !table.data.SkipSetCharset
+}
+
+// PartitionList the escaped partitions of the table that are dumped, separated by commas
+func (table *baseTable) PartitionList() string {
+	names := make([]string, 0, len(table.data.Partitions[table.name]))
+	for _, p := range table.data.Partitions[table.name] {
+		names = append(names, esc(p))
+	}
+	return strings.Join(names, ",")
+}
+
+// intoName the table to INSERT into, limited to the partitions that are dumped, if only some are
+func (table *baseTable) intoName() string {
+	if table.Partitioned() {
+		return esc(table.Name()) + " PARTITION (" + table.PartitionList() + ")"
+	}
+	return esc(table.Name())
 }
 
 func (table *baseTable) initColumnData() error {
@@ -142,8 +190,93 @@ func (table *baseTable) columnsList() string {
 	return "`" + strings.Join(table.cols, "`, `") + "`"
 }
 
+// initOrderBy find the columns of the primary key of the table or, if it has none, of its first unique index
+// whose columns are all NOT NULL, as mysqldump --order-by-primary does. A table with neither is not ordered.
+func (table *baseTable) initOrderBy() error {
+	keyInfo, err := table.data.tx.Query("SHOW KEYS FROM " + esc(table.Name()))
+	if err != nil {
+		return err
+	}
+	defer keyInfo.Close()
+
+	cols, err := keyInfo.Columns()
+	if err != nil {
+		return err
+	}
+	keyIndex, nonUniqueIndex, columnIndex, nullIndex := -1, -1, -1, -1
+	for i, col := range cols {
+		switch strings.ToLower(col) {
+		case "key_name":
+			keyIndex = i
+		case "non_unique":
+			nonUniqueIndex = i
+		case "column_name":
+			columnIndex = i
+		case "null":
+			nullIndex = i
+		}
+	}
+	if keyIndex < 0 || nonUniqueIndex < 0 || columnIndex < 0 || nullIndex < 0 {
+		return errors.New("database key information is malformed")
+	}
+
+	info := make([]sql.NullString, len(cols))
+	scans := make([]interface{}, len(cols))
+	for i := range info {
+		scans[i] = &info[i]
+	}
+	// the keys in the order the server lists them, the primary key first, with the columns of each in order
+	var keys []string
+	columns := map[string][]string{}
+	usable := map[string]bool{}
+	for keyInfo.Next() {
+		if err := keyInfo.Scan(scans...); err != nil {
+			return err
+		}
+		key := info[keyIndex].String
+		if _, ok := usable[key]; !ok {
+			keys = append(keys, key)
+			usable[key] = info[nonUniqueIndex].String == "0"
+		}
+		// an expression in a functional index has no column, and a NULL in a column breaks the tie of no other
+		if !info[columnIndex].Valid || info[nullIndex].String == "YES" {
+			usable[key] = false
+		}
+		columns[key] = append(columns[key], info[columnIndex].String)
+	}
+	if err := keyInfo.Err(); err != nil {
+		return err
+	}
+	chosen := ""
+	if usable["PRIMARY"] {
+		chosen = "PRIMARY"
+	} else {
+		for _, key := range keys {
+			if usable[key] {
+				chosen = key
+				break
+			}
+		}
+	}
+	if chosen == "" {
+		return nil
+	}
+	escaped := make([]string, 0, len(columns[chosen]))
+	for _, col := range columns[chosen] {
+		escaped = append(escaped, esc(col))
+	}
+	table.orderBy = strings.Join(escaped, ", ")
+	return nil
+}
+
 func (table *baseTable) Init() error {
-	return table.initColumnData()
+	if err := table.initColumnData(); err != nil {
+		return err
+	}
+	if table.data.OrderByPrimary {
+		return table.initOrderBy()
+	}
+	return nil
 }
 
 func (table *baseTable) Start() error {
@@ -157,7 +290,14 @@ func (table *baseTable) Start() error {
 	}
 
 	var err error
-	table.rows, err = table.data.tx.Query("SELECT " + table.columnsList() + " FROM " + esc(table.Name()))
+	query := "SELECT " + table.columnsList() + " FROM " + table.intoName()
+	if where, ok := table.data.Where[table.Name()]; ok {
+		query += " WHERE " + where
+	}
+	if table.orderBy != "" {
+		query += " ORDER BY " + table.orderBy
+	}
+	table.rows, err = table.data.tx.Query(query)
 	if err != nil {
 		return err
 	}
@@ -276,9 +416,12 @@ func (table *baseTable) RowBuffer() *bytes.Buffer {
 				b.WriteString(nullType)
 			}
 		case *sql.RawBytes:
-			if len(*s) == 0 {
+			switch {
+			case len(*s) == 0:
 				b.WriteString(nullType)
-			} else {
+			case table.data.HexBlob:
+				fmt.Fprintf(&b, "0x%X", []byte(*s))
+			default:
 				fmt.Fprintf(&b, "_binary '%s'", sanitize(string(*s)))
 			}
 		case *NullDate:
@@ -306,26 +449,33 @@ func (table *baseTable) Stream() <-chan string {
 	valueOut := make(chan string, 1)
 	go func() {
 		defer close(valueOut)
-		var insert bytes.Buffer
+		var (
+			insert bytes.Buffer
+			rows   int
+		)
 
 		for table.Next() {
 			b := table.RowBuffer()
-			// Truncate our insert if it won't fit
-			if insert.Len() != 0 && insert.Len()+b.Len() > table.data.MaxAllowedPacket-1 {
+			// Truncate our insert if it won't fit, or already has as many rows as it may
+			full := table.data.RowsPerInsert > 0 && rows >= table.data.RowsPerInsert
+			if insert.Len() != 0 && (full || insert.Len()+b.Len() > table.data.MaxAllowedPacket-1) {
 				_, _ = insert.WriteString(";")
 				valueOut <- insert.String()
 				insert.Reset()
+				rows = 0
 			}
 
 			if insert.Len() == 0 {
 				_, _ = fmt.Fprint(&insert, strings.Join(
 					// extra "" at the end so we get an extra whitespace as needed
-					[]string{"INSERT", "INTO", esc(table.Name()), "(" + table.columnsList() + ")", "VALUES", ""},
+					[]string{"INSERT", "INTO", table.intoName(), "(" + table.columnsList() + ")", "VALUES", ""},
 					" "))
 			} else {
 				_, _ = insert.WriteString(",")
 			}
 			_, _ = b.WriteTo(&insert)
+			rows++
+			table.rowCount++
 		}
 		if insert.Len() != 0 {
 			_, _ = insert.WriteString(";")
@@ -384,11 +534,32 @@ const tableTmpl = `
 -- Table structure for table {{ esc .Name }}
 --
 
+{{ if .Partitioned -}}
+{{ if .SetCharset -}}
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+{{ end -}}
+{{ index .CreateSQL 0 }};
+{{- if .SetCharset }}
+/*!40101 SET character_set_client = @saved_cs_client */;
+{{- end }}
+
+--
+-- Only partitions {{ .PartitionList }} of table {{ esc .Name }}, which replace those in it
+--
+
+ALTER TABLE {{ esc .Name }} TRUNCATE PARTITION {{ .PartitionList }};
+{{- else -}}
 DROP TABLE IF EXISTS {{ esc .Name }};
+{{ if .SetCharset -}}
 /*!40101 SET @saved_cs_client     = @@character_set_client */;
 /*!50503 SET character_set_client = utf8mb4 */;
+{{ end -}}
 {{ index .CreateSQL 0 }};
+{{- if .SetCharset }}
 /*!40101 SET character_set_client = @saved_cs_client */;
+{{- end }}
+{{- end }}
 
 --
 -- Dumping data for table {{ esc .Name }}
@@ -401,12 +572,20 @@ LOCK TABLES {{ esc .Name }} WRITE;
 {{ end -}}
 /*!40000 ALTER TABLE {{ esc .Name }} ENABLE KEYS */;
 UNLOCK TABLES;
+{{- if .Counted }}
+-- Rows dumped for table {{ esc .Name }}: {{ .RowCount }}
+{{- end }}
 `
 
 const tableTmplCompact = `
+{{ if .SetCharset -}}
 /*!40101 SET @saved_cs_client     = @@character_set_client */;
 /*!50503 SET character_set_client = utf8mb4 */;
+{{ end -}}
 {{ index .CreateSQL 0 }};
+{{ if .SetCharset -}}
 /*!40101 SET character_set_client = @saved_cs_client */;
-{{ range $value := .Stream }}{{- $value }}{{ end -}}
+{{ end -}}
+{{ if .Partitioned }}ALTER TABLE {{ esc .Name }} TRUNCATE PARTITION {{ .PartitionList }};{{ "\n" }}{{ end }}
+{{- range $value := .Stream }}{{- $value }}{{ end -}}
 `
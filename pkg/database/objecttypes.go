@@ -0,0 +1,42 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ObjectTables base tables, with their data
+	ObjectTables = "tables"
+	// ObjectViews view definitions
+	ObjectViews = "views"
+	// objectRoutines stored procedures and functions, which are not dumped; named only to give a clear error
+	objectRoutines = "routines"
+)
+
+// ValidateObjectTypes check that each of types is a type of object that can be dumped
+func ValidateObjectTypes(types []string) error {
+	for _, t := range types {
+		switch strings.ToLower(t) {
+		case ObjectTables, ObjectViews:
+		case objectRoutines:
+			return fmt.Errorf("invalid object type %q, routines are not dumped", t)
+		default:
+			return fmt.Errorf("invalid object type %q, must be one of: %s, %s", t, ObjectTables, ObjectViews)
+		}
+	}
+	return nil
+}
+
+// includesObjectType whether types, as validated by ValidateObjectTypes, includes t. Empty types include all.
+func includesObjectType(types []string, t string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, item := range types {
+		if strings.EqualFold(item, t) {
+			return true
+		}
+	}
+	return false
+}
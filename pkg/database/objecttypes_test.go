@@ -0,0 +1,34 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateObjectTypes(t *testing.T) {
+	tests := []struct {
+		types []string
+		err   bool
+	}{
+		{nil, false},
+		{[]string{"views"}, false},
+		{[]string{"tables", "Views"}, false},
+		{[]string{"routines"}, true},
+		{[]string{"views", "indexes"}, true},
+	}
+	for _, tt := range tests {
+		err := ValidateObjectTypes(tt.types)
+		if tt.err {
+			assert.Error(t, err, tt.types)
+		} else {
+			assert.NoError(t, err, tt.types)
+		}
+	}
+}
+
+func TestIncludesObjectType(t *testing.T) {
+	assert.True(t, includesObjectType(nil, ObjectTables))
+	assert.True(t, includesObjectType([]string{"VIEWS"}, ObjectViews))
+	assert.False(t, includesObjectType([]string{"views"}, ObjectTables))
+}
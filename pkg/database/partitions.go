@@ -0,0 +1,76 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ParsePartitions parse partitions of tables in the format "<database>.<table>=<partition>,<partition>...", e.g.
+// from --partitions, into a map of partition names by "<database>.<table>"
+func ParsePartitions(selections []string) (map[string][]string, error) {
+	if len(selections) == 0 {
+		return nil, nil
+	}
+	partitions := make(map[string][]string, len(selections))
+	for _, s := range selections {
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid partitions %q, must be in the format <database>.<table>=<partition>,<partition>...", s)
+		}
+		table := strings.TrimSpace(parts[0])
+		for _, p := range strings.Split(parts[1], ",") {
+			if p = strings.TrimSpace(p); p != "" && !slices.Contains(partitions[table], p) {
+				partitions[table] = append(partitions[table], p)
+			}
+		}
+		if partitions[table] == nil {
+			partitions[table] = []string{}
+		}
+	}
+	return partitions, ValidatePartitions(partitions)
+}
+
+// ValidatePartitions check that each key of partitions is a table in the format "<database>.<table>", with at
+// least one partition, none of them empty
+func ValidatePartitions(partitions map[string][]string) error {
+	for table, names := range partitions {
+		if _, _, ok := splitTable(table); !ok {
+			return fmt.Errorf("invalid partitions table %q, must be in the format <database>.<table>", table)
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("no partitions for table %s", table)
+		}
+		for _, name := range names {
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("empty partition name for table %s", table)
+			}
+		}
+	}
+	return nil
+}
+
+// PartitionDatabases the databases of the tables in partitions, as validated by ValidatePartitions
+func PartitionDatabases(partitions map[string][]string) []string {
+	var databases []string
+	for table := range partitions {
+		if schema, _, ok := splitTable(table); ok && !slices.Contains(databases, schema) {
+			databases = append(databases, schema)
+		}
+	}
+	return databases
+}
+
+// partitionsFor the partitions of partitions, by table name, for the tables of schema
+func partitionsFor(partitions map[string][]string, schema string) map[string][]string {
+	var names map[string][]string
+	for t, p := range partitions {
+		if s, table, ok := splitTable(t); ok && s == schema {
+			if names == nil {
+				names = map[string][]string{}
+			}
+			names[table] = p
+		}
+	}
+	return names
+}
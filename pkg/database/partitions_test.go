@@ -0,0 +1,44 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePartitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		selections []string
+		partitions map[string][]string
+		err        bool
+	}{
+		{"none", nil, nil, false},
+		{"one", []string{"shop.events=p2026_10"}, map[string][]string{"shop.events": {"p2026_10"}}, false},
+		{"several partitions", []string{"shop.events = p2026_09, p2026_10,p2026_09"}, map[string][]string{"shop.events": {"p2026_09", "p2026_10"}}, false},
+		{"several tables", []string{"shop.events=p1", "crm.logs=p2,p3"}, map[string][]string{"shop.events": {"p1"}, "crm.logs": {"p2", "p3"}}, false},
+		{"no partitions", []string{"shop.events"}, nil, true},
+		{"empty partitions", []string{"shop.events=, "}, nil, true},
+		{"no database", []string{"events=p1"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			partitions, err := ParsePartitions(tt.selections)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.partitions, partitions)
+		})
+	}
+}
+
+func TestPartitionsFor(t *testing.T) {
+	partitions := map[string][]string{"shop.events": {"p1", "p2"}, "shop.logs": {"p3"}, "crm.events": {"p4"}}
+	assert.Equal(t, map[string][]string{"events": {"p1", "p2"}, "logs": {"p3"}}, partitionsFor(partitions, "shop"))
+	assert.Equal(t, map[string][]string{"events": {"p4"}}, partitionsFor(partitions, "crm"))
+	assert.Nil(t, partitionsFor(partitions, "other"))
+	assert.ElementsMatch(t, []string{"shop", "crm"}, PartitionDatabases(partitions))
+	assert.Error(t, ValidatePartitions(map[string][]string{"shop.events": {"p1", " "}}))
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	mysql "github.com/go-sql-driver/mysql"
+)
+
+const (
+	// mysqlTooManyConnections the error number of a server that has no connection to spare
+	mysqlTooManyConnections = 1040
+	// mysqlShutdown the error number of a server that is shutting down, e.g. the temporary one that the
+	// official images run to initialize the data directory, before the real one starts
+	mysqlShutdown = 1053
+)
+
+// Ping check that the server accepts connections and queries, with SELECT 1, limited to the query timeout
+func Ping(ctx context.Context, dbconn Connection) error {
+	dbconn, err := dbconn.WithDefaultsFile()
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open("mysql", dbconn.MySQL())
+	if err != nil {
+		return fmt.Errorf("failed to open connection to database: %v", err)
+	}
+	defer db.Close()
+
+	return dbconn.withQueryTimeout(ctx, func(ctx context.Context) error {
+		var one int
+		return db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+	})
+}
+
+// Unavailable whether err, from connecting to a server, is because it is not up yet, e.g. it refused the
+// connection or closed it, so that it might succeed once the server is up. It is not if the server is up, but
+// rejects the connection, e.g. its credentials, or the settings of the connection are invalid, which no amount
+// of waiting can fix.
+func Unavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlTooManyConnections || mysqlErr.Number == mysqlShutdown
+	}
+	return transient(err) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
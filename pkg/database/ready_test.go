@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	mysql "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnavailable(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		unavailable bool
+	}{
+		{"none", nil, false},
+		{"refused", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{"unknown host", &net.DNSError{Err: "no such host", Name: "db", IsNotFound: true}, true},
+		{"closed", io.ErrUnexpectedEOF, true},
+		{"timeout", context.DeadlineExceeded, true},
+		{"too many connections", &mysql.MySQLError{Number: mysqlTooManyConnections, Message: "Too many connections"}, true},
+		{"shutting down", fmt.Errorf("error: %w", &mysql.MySQLError{Number: mysqlShutdown, Message: "Server shutdown in progress"}), true},
+		{"access denied", &mysql.MySQLError{Number: 1045, Message: "Access denied for user 'user'@'%'"}, false},
+		{"defaults file", errors.New("unable to read defaults file"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.unavailable, Unavailable(tt.err))
+		})
+	}
+}
+
+func TestPingNotListening(t *testing.T) {
+	// a port on which nothing listens, as of a server that has not started yet
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	err = Ping(context.Background(), Connection{Host: "127.0.0.1", Port: port, User: "user"})
+	assert.Error(t, err)
+	assert.True(t, Unavailable(err), "unavailable: %v", err)
+}
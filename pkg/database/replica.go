@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	mysql "github.com/go-sql-driver/mysql"
+)
+
+var (
+	// ErrNotReplica the server has no replication configured
+	ErrNotReplica = errors.New("server is not a replica")
+	// ErrReplicationStopped the replica is not replicating, so it may be any amount behind its source
+	ErrReplicationStopped = errors.New("replication is not running")
+)
+
+// mysqlSyntaxError the error number of a statement that the server does not understand
+const mysqlSyntaxError = 1064
+
+// ReplicaLag how far the replica dbconn is behind its source, as it reports itself. Fails with ErrNotReplica if it
+// has no replication configured, and ErrReplicationStopped if replication is not running.
+func ReplicaLag(ctx context.Context, dbconn Connection) (time.Duration, error) {
+	dbconn, err := dbconn.WithDefaultsFile()
+	if err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("mysql", dbconn.MySQL())
+	if err != nil {
+		return 0, fmt.Errorf("failed to open connection to database: %v", err)
+	}
+	defer db.Close()
+
+	var lag time.Duration
+	err = dbconn.metadataQuery(ctx, func(ctx context.Context) error {
+		// SHOW REPLICA STATUS is only in MySQL 8.0.22 and later, and MariaDB 10.5.1 and later
+		status, err := replicaStatus(ctx, db, "SHOW REPLICA STATUS")
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlSyntaxError {
+			status, err = replicaStatus(ctx, db, "SHOW SLAVE STATUS")
+		}
+		if err != nil {
+			return fmt.Errorf("could not get replica status: %w", err)
+		}
+		lag, err = parseReplicaLag(status)
+		return err
+	})
+	return lag, err
+}
+
+// replicaStatus the columns of the first row of the replica status from query, by name; nil if there is none
+func replicaStatus(ctx context.Context, db *sql.DB, query string) (map[string]sql.NullString, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	status := make(map[string]sql.NullString, len(columns))
+	for i, column := range columns {
+		status[column] = values[i]
+	}
+	return status, nil
+}
+
+// parseReplicaLag the lag in the replica status, in either the current column name or the one before
+// MySQL 8.0.22; it is NULL when replication is not running
+func parseReplicaLag(status map[string]sql.NullString) (time.Duration, error) {
+	if status == nil {
+		return 0, ErrNotReplica
+	}
+	seconds, ok := status["Seconds_Behind_Source"]
+	if !ok {
+		seconds, ok = status["Seconds_Behind_Master"]
+	}
+	if !ok {
+		return 0, errors.New("replica status has no Seconds_Behind_Source")
+	}
+	if !seconds.Valid {
+		return 0, ErrReplicationStopped
+	}
+	n, err := strconv.ParseInt(seconds.String, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Seconds_Behind_Source %q: %v", seconds.String, err)
+	}
+	return time.Duration(n) * time.Second, nil
+}
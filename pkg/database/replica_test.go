@@ -0,0 +1,40 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReplicaLag(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  map[string]sql.NullString
+		lag     time.Duration
+		wantErr error
+		err     bool
+	}{
+		{"not a replica", nil, 0, ErrNotReplica, true},
+		{"current column", map[string]sql.NullString{"Seconds_Behind_Source": {String: "42", Valid: true}}, 42 * time.Second, nil, false},
+		{"column before 8.0.22", map[string]sql.NullString{"Seconds_Behind_Master": {String: "0", Valid: true}}, 0, nil, false},
+		{"stopped", map[string]sql.NullString{"Seconds_Behind_Source": {}}, 0, ErrReplicationStopped, true},
+		{"no column", map[string]sql.NullString{"Replica_IO_Running": {String: "Yes", Valid: true}}, 0, nil, true},
+		{"invalid", map[string]sql.NullString{"Seconds_Behind_Source": {String: "soon", Valid: true}}, 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lag, err := parseReplicaLag(tt.status)
+			if !tt.err {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.lag, lag)
+				return
+			}
+			assert.Error(t, err)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"sync"
+	"time"
 )
 
 var (
@@ -14,55 +16,329 @@ var (
 	createRegex = regexp.MustCompile(`(?i)^(CREATE\s+DATABASE\s*(\/\*.*\*\/\s*)?` + "`" + `)([^\s]+)(` + "`" + `\s*(\s*\/\*.*\*\/\s*)?\s*;$)`)
 )
 
-func Restore(dbconn Connection, databasesMap map[string]string, readers []io.ReadSeeker) error {
+type RestoreOpts struct {
+	// Force continue past statements that fail, rather than aborting the restore.
+	// The failed statements are listed in the results.
+	Force bool
+	// Progress called with how far the restore has got, at most once every ProgressInterval; nil to not report
+	Progress         func(RestoreProgress)
+	ProgressInterval time.Duration
+	// DropBeforeRestore drop each database that the restore uses before restoring it, so that no tables or
+	// other objects that are not in the dump are left behind. Only the databases in DropAllowed may be dropped.
+	DropBeforeRestore bool
+	// DropAllowed the databases, after renaming, that DropBeforeRestore may drop
+	DropAllowed []string
+	// Concurrency how many of the readers to restore at once, each in its own transaction, if each uses databases
+	// that none of the others do, e.g. the file per database of a dump; 0 or 1 to restore one at a time
+	Concurrency int
+	// NormalizeLineEndings convert the line endings of the readers, CRLF or a lone CR, to LF as they are read,
+	// e.g. of dumps written on Windows
+	NormalizeLineEndings bool
+	// GTIDMode how to handle the GTID_PURGED of the readers, e.g. from mysqldump, one of GTIDWarn, GTIDStrip or
+	// GTIDReset; empty to restore it as it is without checking
+	GTIDMode string
+	// VerifyRowCounts once restored, count the rows of each table whose rows the readers record, as dumps by Dump
+	// do, into the RowCounts of the results. Counting scans each table, so takes a while for large ones.
+	VerifyRowCounts bool
+}
+
+// RestoreProgress how far a restore has got
+type RestoreProgress struct {
+	// Bytes of SQL read so far, out of Total, which are after decompression
+	Bytes int64
+	Total int64
+	// Statements number of statements applied so far, including any that failed
+	Statements int
+}
+
+// RestoreResults results of a restore
+type RestoreResults struct {
+	// Statements number of statements applied, including any that failed
+	Statements int
+	// Failed statements that failed, only when restoring with Force
+	Failed []StatementError
+	// Dropped databases dropped before restoring, with DropBeforeRestore
+	Dropped []string
+	// Readers the result of each reader, in the same order
+	Readers []ReaderResult
+	// Concurrent whether the readers were restored at once, which needs Concurrency and independent readers
+	Concurrent bool
+	// GTIDConflict why the server cannot take the GTID_PURGED of the readers, with GTIDWarn
+	GTIDConflict string
+	// GTIDReset whether the GTIDs of the server were reset before restoring, with GTIDReset
+	GTIDReset bool
+	// RowCounts the rows of each table that the readers record, and that it has once restored, with VerifyRowCounts
+	RowCounts []TableRowCount
+}
+
+// ReaderResult the result of restoring one reader
+type ReaderResult struct {
+	// Databases the databases, after renaming, that the reader uses; only found when restoring concurrently
+	Databases []string
+	// Statements number of statements applied, including any that failed
+	Statements int
+	// Failed statements that failed, only when restoring with Force
+	Failed []StatementError
+	// Err why the reader did not restore; its transaction was rolled back
+	Err error
+	// Skipped not restored, as an earlier reader failed
+	Skipped bool
+	// RowCounts the rows of each table that the reader records, with VerifyRowCounts
+	RowCounts []TableRowCount
+}
+
+// StatementError a single statement that failed to restore
+type StatementError struct {
+	Statement string
+	Err       error
+}
+
+func (s StatementError) Error() string {
+	return s.Err.Error()
+}
+
+func Restore(ctx context.Context, dbconn Connection, opts RestoreOpts, databasesMap map[string]string, readers []io.ReadSeeker) (RestoreResults, error) {
+	var results RestoreResults
+	dbconn, err := dbconn.WithDefaultsFile()
+	if err != nil {
+		return results, err
+	}
 	db, err := sql.Open("mysql", dbconn.MySQL())
 	if err != nil {
-		return fmt.Errorf("failed to open connection to database: %v", err)
+		return results, fmt.Errorf("failed to open connection to database: %v", err)
 	}
 	defer db.Close()
 
-	// load data into database by reading from each reader
-	ctx := context.Background()
+	// the total size, for progress
+	var total int64
 	for _, r := range readers {
-		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		size, err := r.Seek(0, io.SeekEnd)
 		if err != nil {
-			return fmt.Errorf("failed to restore database: %w", err)
-		}
-		scanner := bufio.NewScanner(r)
-		var current string
-		for scanner.Scan() {
-			line := scanner.Text()
-			if line == "" {
-				continue
+			return results, fmt.Errorf("unable to determine size of restore file: %v", err)
+		}
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return results, fmt.Errorf("unable to rewind restore file: %v", err)
+		}
+		total += size
+	}
+	if opts.NormalizeLineEndings {
+		readers = newLineEndingReaders(readers)
+	}
+	// before anything is dropped, so that a restore that cannot go ahead changes nothing
+	if results.GTIDConflict, results.GTIDReset, err = checkGTIDs(ctx, db, opts.GTIDMode, readers); err != nil {
+		return results, err
+	}
+	if opts.DropBeforeRestore {
+		if results.Dropped, err = dropDatabases(ctx, db, readers, databasesMap, opts.DropAllowed); err != nil {
+			return results, err
+		}
+	}
+	p := &restoreProgress{total: total, interval: opts.ProgressInterval, report: opts.Progress, last: time.Now()}
+	results.Readers = make([]ReaderResult, len(readers))
+
+	if opts.Concurrency > 1 && len(readers) > 1 {
+		var independent bool
+		if independent, err = independentReaders(readers, databasesMap, results.Readers); err != nil {
+			return results, err
+		}
+		if independent {
+			results.Concurrent = true
+			return restoreConcurrently(ctx, db, opts, databasesMap, readers, p, results)
+		}
+	}
+
+	// load data into database by reading from each reader
+	for i, r := range readers {
+		rr := &results.Readers[i]
+		restoreReader(ctx, db, opts, databasesMap, r, p, rr)
+		results.Statements += rr.Statements
+		results.Failed = append(results.Failed, rr.Failed...)
+		if rr.Err != nil {
+			// the rest depend on this one, so are not restored
+			for j := i + 1; j < len(readers); j++ {
+				results.Readers[j].Skipped = true
 			}
-			current += line + "\n"
-			if line[len(line)-1] != ';' {
-				continue
+			return results, fmt.Errorf("failed to restore database: %w", rr.Err)
+		}
+	}
+	if opts.VerifyRowCounts {
+		results.RowCounts = verifyRowCounts(ctx, db, readerRowCounts(results.Readers))
+	}
+
+	return results, nil
+}
+
+// readerRowCounts the row counts that all of the readers record
+func readerRowCounts(readers []ReaderResult) []TableRowCount {
+	var counts []TableRowCount
+	for _, rr := range readers {
+		counts = append(counts, rr.RowCounts...)
+	}
+	return counts
+}
+
+// restoreConcurrently restore the readers with up to opts.Concurrency at once. As they use different databases,
+// each is restored even if another fails.
+func restoreConcurrently(ctx context.Context, db *sql.DB, opts RestoreOpts, databasesMap map[string]string, readers []io.ReadSeeker, p *restoreProgress, results RestoreResults) (RestoreResults, error) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.Concurrency)
+	for i, r := range readers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r io.ReadSeeker, rr *ReaderResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			restoreReader(ctx, db, opts, databasesMap, r, p, rr)
+		}(r, &results.Readers[i])
+	}
+	wg.Wait()
+	var failed int
+	var firstErr error
+	for _, rr := range results.Readers {
+		results.Statements += rr.Statements
+		results.Failed = append(results.Failed, rr.Failed...)
+		if rr.Err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = rr.Err
 			}
-			// if we have the line that sets the database, and we need to replace, replace it
-			if createRegex.MatchString(current) {
-				dbName := createRegex.FindStringSubmatch(current)[3]
-				if newName, ok := databasesMap[dbName]; ok {
-					current = createRegex.ReplaceAllString(current, fmt.Sprintf("${1}%s${4}", newName))
-				}
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("failed to restore database: %d of %d files failed, the first: %w", failed, len(readers), firstErr)
+	}
+	if opts.VerifyRowCounts {
+		results.RowCounts = verifyRowCounts(ctx, db, readerRowCounts(results.Readers))
+	}
+	return results, nil
+}
+
+// independentReaders whether each of the readers uses only databases that none of the others do, and so can be
+// restored at the same time as them. A reader that names no database, e.g. a dump without USE statements, uses
+// whichever the connection does, so is never independent. Sets the databases of each in results. Leaves the
+// readers at the start.
+func independentReaders(readers []io.ReadSeeker, databasesMap map[string]string, results []ReaderResult) (bool, error) {
+	independent := true
+	used := map[string]bool{}
+	for i, r := range readers {
+		names, _, err := restoreDatabases([]io.ReadSeeker{r}, databasesMap)
+		if err != nil {
+			return false, err
+		}
+		results[i].Databases = names
+		if len(names) == 0 {
+			independent = false
+		}
+		for _, name := range names {
+			if used[name] {
+				independent = false
 			}
-			if useRegex.MatchString(current) {
-				dbName := useRegex.FindStringSubmatch(current)[2]
-				if newName, ok := databasesMap[dbName]; ok {
-					current = useRegex.ReplaceAllString(current, fmt.Sprintf("${1}%s${3}", newName))
-				}
+			used[name] = true
+		}
+	}
+	return independent, nil
+}
+
+// restoreReader restore the SQL in r, in a single transaction, into rr
+func restoreReader(ctx context.Context, db *sql.DB, opts RestoreOpts, databasesMap map[string]string, r io.Reader, p *restoreProgress, rr *ReaderResult) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		rr.Err = err
+		return
+	}
+	cr := &countingReader{r: r, progress: p}
+	scanner := bufio.NewScanner(cr)
+	var current string
+	var counter *rowCounter
+	if opts.VerifyRowCounts {
+		counter = &rowCounter{databasesMap: databasesMap}
+		defer func() { rr.RowCounts = counter.counts }()
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if counter != nil {
+			counter.line(line)
+		}
+		current += line + "\n"
+		if line[len(line)-1] != ';' {
+			continue
+		}
+		// if we have the line that sets the database, and we need to replace, replace it
+		if createRegex.MatchString(current) {
+			dbName := createRegex.FindStringSubmatch(current)[3]
+			if newName, ok := databasesMap[dbName]; ok {
+				current = createRegex.ReplaceAllString(current, fmt.Sprintf("${1}%s${4}", newName))
 			}
-			// we hit a break, so we have the entire transaction
-			if _, err := tx.Exec(current); err != nil {
-				_ = tx.Rollback()
-				return fmt.Errorf("failed to restore database: %w", err)
+		}
+		if useRegex.MatchString(current) {
+			dbName := useRegex.FindStringSubmatch(current)[2]
+			if newName, ok := databasesMap[dbName]; ok {
+				current = useRegex.ReplaceAllString(current, fmt.Sprintf("${1}%s${3}", newName))
 			}
+		}
+		// we hit a break, so we have the entire transaction
+		if opts.GTIDMode == GTIDStrip && gtidPurgedRegex.MatchString(current) {
 			current = ""
+			continue
 		}
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("failed to restore database: %w", err)
+		rr.Statements++
+		if _, err := tx.ExecContext(ctx, current); err != nil {
+			// even with force, a cancelled restore stops
+			if !opts.Force || ctx.Err() != nil {
+				_ = tx.Rollback()
+				rr.Err = err
+				return
+			}
+			rr.Failed = append(rr.Failed, StatementError{Statement: current, Err: err})
 		}
+		current = ""
+		p.statement()
+	}
+	if err := tx.Commit(); err != nil {
+		rr.Err = err
+	}
+}
+
+// restoreProgress how far a restore of any number of readers at once has got, reported at most once every interval
+type restoreProgress struct {
+	total    int64
+	interval time.Duration
+	report   func(RestoreProgress)
+
+	mu         sync.Mutex
+	bytes      int64
+	statements int
+	last       time.Time
+}
+
+func (p *restoreProgress) read(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bytes += int64(n)
+}
+
+// statement count a statement applied, and report progress if it is time to
+func (p *restoreProgress) statement() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.statements++
+	if p.report != nil && time.Since(p.last) >= p.interval {
+		p.report(RestoreProgress{Bytes: p.bytes, Total: p.total, Statements: p.statements})
+		p.last = time.Now()
 	}
+}
+
+// countingReader counts the bytes read through it into the progress
+type countingReader struct {
+	r        io.Reader
+	progress *restoreProgress
+}
 
-	return nil
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.progress.read(n)
+	return n, err
 }
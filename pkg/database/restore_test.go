@@ -0,0 +1,44 @@
+package database
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndependentReaders(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        []string
+		databasesMap map[string]string
+		independent  bool
+		databases    [][]string
+	}{
+		{"separate databases", []string{"USE `app`;\n", "CREATE DATABASE `other`;\nUSE `other`;\n"}, nil, true, [][]string{{"app"}, {"other"}}},
+		{"same database", []string{"USE `app`;\n", "USE `other`;\nUSE `app`;\n"}, nil, false, [][]string{{"app"}, {"other", "app"}}},
+		{"renamed to the same", []string{"USE `app`;\n", "USE `other`;\n"}, map[string]string{"other": "app"}, false, [][]string{{"app"}, {"app"}}},
+		{"no database", []string{"USE `app`;\n", "INSERT INTO `t` VALUES (1);\n"}, nil, false, [][]string{{"app"}, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var readers []io.ReadSeeker
+			for _, f := range tt.files {
+				readers = append(readers, strings.NewReader(f))
+			}
+			results := make([]ReaderResult, len(readers))
+			independent, err := independentReaders(readers, tt.databasesMap, results)
+			require.NoError(t, err)
+			assert.Equal(t, tt.independent, independent)
+			for i, r := range results {
+				assert.Equal(t, tt.databases[i], r.Databases)
+			}
+			// left at the start, to be restored
+			b, err := io.ReadAll(readers[0])
+			require.NoError(t, err)
+			assert.Equal(t, tt.files[0], string(b))
+		})
+	}
+}
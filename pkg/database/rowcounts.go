@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strconv"
+)
+
+// rowCountRegex the comment with which a dump records how many rows of a table it dumped
+var rowCountRegex = regexp.MustCompile("^-- Rows dumped for table `([^`]+)`: (\\d+)$")
+
+// TableRowCount how many rows of a table a dump records that it dumped, and, once verified, how many the table
+// has after the restore
+type TableRowCount struct {
+	// Database the database of the table, after renaming
+	Database string
+	Table    string
+	// Expected the rows that the dump records
+	Expected int64
+	// Actual the rows of the table after the restore, once verified
+	Actual int64
+	// Err why the rows of the table could not be counted, e.g. it was not restored
+	Err error
+}
+
+// rowCounter the row counts that a reader records, found as it is read line by line, in the database of the last
+// USE before each
+type rowCounter struct {
+	databasesMap map[string]string
+	database     string
+	counts       []TableRowCount
+}
+
+// line look for a USE or a row count in the line
+func (r *rowCounter) line(line string) {
+	if m := useRegex.FindStringSubmatch(line); m != nil {
+		r.database = m[2]
+		if newName, ok := r.databasesMap[r.database]; ok {
+			r.database = newName
+		}
+		return
+	}
+	m := rowCountRegex.FindStringSubmatch(line)
+	// a table in no known database would be counted in whichever the connection uses
+	if m == nil || r.database == "" {
+		return
+	}
+	expected, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return
+	}
+	r.counts = append(r.counts, TableRowCount{Database: r.database, Table: m[1], Expected: expected})
+}
+
+// verifyRowCounts count the rows of each of the tables in counts, as restored, returning them with their Actual
+// rows, or why they could not be counted
+func verifyRowCounts(ctx context.Context, db *sql.DB, counts []TableRowCount) []TableRowCount {
+	verified := make([]TableRowCount, 0, len(counts))
+	for _, c := range counts {
+		c.Err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM `"+c.Database+"`.`"+c.Table+"`").Scan(&c.Actual)
+		verified = append(verified, c)
+	}
+	return verified
+}
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRowCounter(t *testing.T) {
+	dump := strings.Join([]string{
+		"-- Rows dumped for table `orphan`: 3",
+		"USE `app`;",
+		"INSERT INTO `users` VALUES (1),(2);",
+		"-- Rows dumped for table `users`: 2",
+		"USE `logs`;",
+		"-- Rows dumped for table `events`: 0",
+		"-- Rows dumped for table `bad`: many",
+	}, "\n")
+	r := &rowCounter{databasesMap: map[string]string{"logs": "logs_copy"}}
+	for _, line := range strings.Split(dump, "\n") {
+		r.line(line)
+	}
+	assert.Equal(t, []TableRowCount{
+		{Database: "app", Table: "users", Expected: 2},
+		{Database: "logs_copy", Table: "events", Expected: 0},
+	}, r.counts)
+}
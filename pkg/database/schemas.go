@@ -1,8 +1,10 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 )
 
 var (
@@ -16,33 +18,78 @@ func init() {
 	}
 }
 
-func GetSchemas(dbconn Connection) ([]string, error) {
+// GetSchemas list the databases in the server, excluding the system databases information_schema,
+// performance_schema, sys and mysql unless includeSystem is set
+func GetSchemas(ctx context.Context, dbconn Connection, includeSystem bool) ([]string, error) {
+	dbconn, err := dbconn.WithDefaultsFile()
+	if err != nil {
+		return nil, err
+	}
 	db, err := sql.Open("mysql", dbconn.MySQL())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open connection to database: %v", err)
 	}
 	defer db.Close()
 
-	// TODO: get list of schemas
-	// mysql -h $DB_SERVER -P $DB_PORT $DBUSER $DBPASS -N -e 'show databases'
-	rows, err := db.Query("show databases")
-	if err != nil {
-		return nil, fmt.Errorf("could not get schemas: %v", err)
-	}
-	defer rows.Close()
-
-	names := []string{}
-	for rows.Next() {
-		var name string
-		err := rows.Scan(&name)
+	var names []string
+	err = dbconn.metadataQuery(ctx, func(ctx context.Context) error {
+		// mysql -h $DB_SERVER -P $DB_PORT $DBUSER $DBPASS -N -e 'show databases'
+		rows, err := db.QueryContext(ctx, "show databases")
 		if err != nil {
-			return nil, fmt.Errorf("error getting database name: %v", err)
+			return fmt.Errorf("could not get schemas: %w", err)
 		}
-		if _, ok := excludeSchemas[name]; ok {
-			continue
+		defer rows.Close()
+
+		names = []string{}
+		for rows.Next() {
+			var name string
+			err := rows.Scan(&name)
+			if err != nil {
+				return fmt.Errorf("error getting database name: %w", err)
+			}
+			if _, ok := excludeSchemas[name]; ok && !includeSystem {
+				continue
+			}
+			names = append(names, name)
 		}
-		names = append(names, name)
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
-
 	return names, nil
 }
+
+// EstimateSize the size in bytes of the data and indexes of the tables in schemas, from information_schema, as
+// an estimate of the size of a dump of them. For InnoDB, the table sizes are themselves estimates.
+func EstimateSize(ctx context.Context, dbconn Connection, schemas []string) (int64, error) {
+	if len(schemas) == 0 {
+		return 0, nil
+	}
+	dbconn, err := dbconn.WithDefaultsFile()
+	if err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("mysql", dbconn.MySQL())
+	if err != nil {
+		return 0, fmt.Errorf("failed to open connection to database: %v", err)
+	}
+	defer db.Close()
+
+	args := make([]any, 0, len(schemas))
+	for _, schema := range schemas {
+		args = append(args, schema)
+	}
+	query := "SELECT COALESCE(SUM(data_length + index_length), 0) FROM information_schema.tables WHERE table_schema IN (?" + strings.Repeat(", ?", len(schemas)-1) + ")"
+	var size int64
+	err = dbconn.metadataQuery(ctx, func(ctx context.Context) error {
+		if err := db.QueryRowContext(ctx, query, args...).Scan(&size); err != nil {
+			return fmt.Errorf("could not estimate database size: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ParseWhere parse WHERE clauses in the format "<database>.<table>=<clause>", e.g. from --where, into a map
+// of clauses by "<database>.<table>". The clause is everything after the first "=", so it can contain more.
+func ParseWhere(clauses []string) (map[string]string, error) {
+	if len(clauses) == 0 {
+		return nil, nil
+	}
+	where := make(map[string]string, len(clauses))
+	for _, c := range clauses {
+		parts := strings.SplitN(c, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid where clause %q, must be in the format <database>.<table>=<clause>", c)
+		}
+		where[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return where, ValidateWhere(where)
+}
+
+// ValidateWhere check that each key of where is a table in the format "<database>.<table>", with a clause
+func ValidateWhere(where map[string]string) error {
+	for table, clause := range where {
+		if _, _, ok := splitTable(table); !ok {
+			return fmt.Errorf("invalid where table %q, must be in the format <database>.<table>", table)
+		}
+		if strings.TrimSpace(clause) == "" {
+			return fmt.Errorf("empty where clause for table %s", table)
+		}
+	}
+	return nil
+}
+
+// WhereDatabases the databases of the tables in where, as validated by ValidateWhere
+func WhereDatabases(where map[string]string) []string {
+	var databases []string
+	for table := range where {
+		if schema, _, ok := splitTable(table); ok && !slices.Contains(databases, schema) {
+			databases = append(databases, schema)
+		}
+	}
+	return databases
+}
+
+// whereFor the clauses of where, by table name, for the tables of schema
+func whereFor(where map[string]string, schema string) map[string]string {
+	var clauses map[string]string
+	for t, clause := range where {
+		if s, table, ok := splitTable(t); ok && s == schema {
+			if clauses == nil {
+				clauses = map[string]string{}
+			}
+			clauses[table] = clause
+		}
+	}
+	return clauses
+}
+
+// splitTable split "<database>.<table>" into its database and table
+func splitTable(table string) (schema, name string, ok bool) {
+	parts := strings.SplitN(table, ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWhere(t *testing.T) {
+	tests := []struct {
+		name    string
+		clauses []string
+		where   map[string]string
+		err     bool
+	}{
+		{"none", nil, nil, false},
+		{"one", []string{"shop.orders=created_at > NOW() - INTERVAL 30 DAY"}, map[string]string{"shop.orders": "created_at > NOW() - INTERVAL 30 DAY"}, false},
+		{"equals in clause", []string{"shop.orders = status='open'"}, map[string]string{"shop.orders": "status='open'"}, false},
+		{"several", []string{"shop.orders=id > 10", "crm.events=id < 5"}, map[string]string{"shop.orders": "id > 10", "crm.events": "id < 5"}, false},
+		{"no clause", []string{"shop.orders"}, nil, true},
+		{"empty clause", []string{"shop.orders= "}, nil, true},
+		{"no database", []string{"orders=id > 10"}, nil, true},
+		{"no table", []string{"shop.=id > 10"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, err := ParseWhere(tt.clauses)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.where, where)
+		})
+	}
+}
+
+func TestWhereFor(t *testing.T) {
+	where := map[string]string{"shop.orders": "id > 10", "shop.events": "id < 5", "crm.orders": "id = 1"}
+	assert.Equal(t, map[string]string{"orders": "id > 10", "events": "id < 5"}, whereFor(where, "shop"))
+	assert.Equal(t, map[string]string{"orders": "id = 1"}, whereFor(where, "crm"))
+	assert.Nil(t, whereFor(where, "other"))
+	assert.ElementsMatch(t, []string{"shop", "crm"}, WhereDatabases(where))
+}
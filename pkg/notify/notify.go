@@ -0,0 +1,92 @@
+// Package notify sends notifications of the outcome of each run, e.g. a dump or a prune,
+// to any number of providers.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	OperationDump  = "dump"
+	OperationPrune = "prune"
+)
+
+// Event the outcome of a single operation. Every provider is sent the same event, and decides
+// how to present it.
+type Event struct {
+	// Run the ID of the run in which the operation took place
+	Run uuid.UUID
+	// Operation what was run, one of the Operation* constants
+	Operation string
+	// Server the database server, if any
+	Server string
+	// Databases the databases involved, if known
+	Databases []string
+	Start     time.Time
+	End       time.Time
+	// Err why the operation failed, nil on success
+	Err error
+	// Trigger how the run was started outside of the schedule, e.g. "http" or "signal"; empty if on schedule
+	Trigger string
+	// PreviousSuccess when the previous successful operation finished, if known. With several targets,
+	// the earliest of them, so that the time since is the longest gap.
+	PreviousSuccess time.Time
+}
+
+// Success whether the operation succeeded
+func (e Event) Success() bool {
+	return e.Err == nil
+}
+
+// EarliestSuccess the earliest of the previous successes of each target, zero if there are none
+func EarliestSuccess(previous map[string]time.Time) time.Time {
+	var earliest time.Time
+	for _, t := range previous {
+		if earliest.IsZero() || t.Before(earliest) {
+			earliest = t
+		}
+	}
+	return earliest
+}
+
+// Summary a concise, single-line description of the event, for providers that send plain text
+func (e Event) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "mysql-backup %s", e.Operation)
+	if len(e.Databases) > 0 {
+		fmt.Fprintf(&b, " of %s", strings.Join(e.Databases, ", "))
+	}
+	if e.Server != "" {
+		fmt.Fprintf(&b, " on %s", e.Server)
+	}
+	if !e.Success() {
+		fmt.Fprintf(&b, " failed: %v", e.Err)
+		return b.String()
+	}
+	b.WriteString(" succeeded")
+	if !e.Start.IsZero() && !e.End.IsZero() {
+		fmt.Fprintf(&b, " in %s", e.End.Sub(e.Start).Round(time.Second))
+	}
+	return b.String()
+}
+
+// Notifier a provider to which events are sent
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// Send send the event to each of the notifiers. A notifier that fails is logged, but does not stop
+// the others, nor fail the operation that it is reporting.
+func Send(ctx context.Context, notifiers []Notifier, e Event, logger *log.Entry) {
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, e); err != nil {
+			logger.Warnf("unable to send notification: %v", err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultPushgatewayJob the job label under which the metrics are pushed, unless another is given
+const DefaultPushgatewayJob = "mysql-backup"
+
+// pushgatewayLabelRE a valid Prometheus label name
+var pushgatewayLabelRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Pushgateway pushes the metrics of each event to a Prometheus Pushgateway, for runs that are too short-lived,
+// e.g. from cron, to be scraped. The metrics of each server are in a group of their own, and those of each
+// operation have names of their own, so that each push replaces only the metrics of the previous one of the same.
+type Pushgateway struct {
+	url      string
+	job      string
+	instance string
+	labels   map[string]string
+	client   *http.Client
+	// now the time of the push, for the events that have no end
+	now func() time.Time
+}
+
+// PushgatewayOption an option for NewPushgateway
+type PushgatewayOption func(*Pushgateway)
+
+// WithPushgatewayJob push the metrics under the job label, rather than DefaultPushgatewayJob
+func WithPushgatewayJob(job string) PushgatewayOption {
+	return func(p *Pushgateway) {
+		p.job = job
+	}
+}
+
+// WithPushgatewayInstance push the metrics under the instance label, e.g. the host that runs the dumps
+func WithPushgatewayInstance(instance string) PushgatewayOption {
+	return func(p *Pushgateway) {
+		p.instance = instance
+	}
+}
+
+// WithPushgatewayLabels push the metrics with more labels in their grouping key, e.g. the environment
+func WithPushgatewayLabels(labels map[string]string) PushgatewayOption {
+	return func(p *Pushgateway) {
+		p.labels = labels
+	}
+}
+
+// WithPushgatewayClient use the given HTTP client, rather than the default
+func WithPushgatewayClient(client *http.Client) PushgatewayOption {
+	return func(p *Pushgateway) {
+		p.client = client
+	}
+}
+
+// NewPushgateway create a notifier that pushes the metrics of each event to the Pushgateway at gatewayURL
+func NewPushgateway(gatewayURL string, opts ...PushgatewayOption) *Pushgateway {
+	p := &Pushgateway{
+		url:    strings.TrimSuffix(gatewayURL, "/"),
+		job:    DefaultPushgatewayJob,
+		client: http.DefaultClient,
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// ValidatePushgatewayLabels check that each of the labels has a valid Prometheus label name, and is not one
+// that the grouping key of the metrics already has
+func ValidatePushgatewayLabels(labels map[string]string) error {
+	for name := range labels {
+		if !pushgatewayLabelRE.MatchString(name) {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		switch name {
+		case "job", "instance", "server":
+			return fmt.Errorf("label %s is set by mysql-backup, and cannot be given", name)
+		}
+	}
+	return nil
+}
+
+// Notify push the metrics of the event. They are added with POST, so that a failure, which has no time of the
+// last success, keeps the one of the previous push.
+func (p *Pushgateway) Notify(ctx context.Context, e Event) error {
+	// sent as soon as the operation finishes, so that the time of the push is when it finished
+	if e.End.IsZero() {
+		e.End = p.now()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.groupURL(e), bytes.NewReader(pushgatewayMetrics(e)))
+	if err != nil {
+		return fmt.Errorf("error creating pushgateway request: %v", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error pushing metrics to %s: %v", p.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("error pushing metrics to %s: %s %s", p.url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// groupURL the URL of the group of the metrics of the event: by job, instance, the extra labels and the server,
+// each as a label of the path
+func (p *Pushgateway) groupURL(e Event) string {
+	var b strings.Builder
+	b.WriteString(p.url)
+	b.WriteString("/metrics")
+	writeLabel := func(name, value string) {
+		// a value that is empty or has a slash cannot be in the path as it is
+		if value == "" || strings.Contains(value, "/") {
+			fmt.Fprintf(&b, "/%s@base64/%s", name, base64.RawURLEncoding.EncodeToString([]byte(value)))
+			if value == "" {
+				b.WriteString("=")
+			}
+			return
+		}
+		fmt.Fprintf(&b, "/%s/%s", name, url.PathEscape(value))
+	}
+	writeLabel("job", p.job)
+	if p.instance != "" {
+		writeLabel("instance", p.instance)
+	}
+	names := make([]string, 0, len(p.labels))
+	for name := range p.labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeLabel(name, p.labels[name])
+	}
+	if e.Server != "" {
+		writeLabel("server", e.Server)
+	}
+	return b.String()
+}
+
+// pushgatewayMetrics the metrics of the event, in the Prometheus text format, named by its operation, e.g.
+// mysql_backup_dump_success
+func pushgatewayMetrics(e Event) []byte {
+	var b bytes.Buffer
+	prefix := "mysql_backup_" + e.Operation
+	gauge := func(name, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s_%s %s\n# TYPE %s_%s gauge\n%s_%s %g\n", prefix, name, help, prefix, name, prefix, name, value)
+	}
+	success := 0.0
+	if e.Success() {
+		success = 1
+	}
+	gauge("success", "whether the last "+e.Operation+" succeeded, 1, or failed, 0", success)
+	gauge("last_run_timestamp_seconds", "when the last "+e.Operation+" finished, as a unix time", unixSeconds(e.End))
+	if e.Success() {
+		gauge("last_success_timestamp_seconds", "when the last successful "+e.Operation+" finished, as a unix time", unixSeconds(e.End))
+	}
+	if !e.Start.IsZero() {
+		gauge("duration_seconds", "how long the last "+e.Operation+" took", e.End.Sub(e.Start).Seconds())
+	}
+	if e.Success() && len(e.Databases) > 0 {
+		gauge("databases", "how many databases the last successful "+e.Operation+" included", float64(len(e.Databases)))
+	}
+	return b.Bytes()
+}
+
+// unixSeconds t as the seconds since the unix epoch, with a fraction
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
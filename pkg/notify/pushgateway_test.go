@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushgatewayNotify(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		opts    []PushgatewayOption
+		event   Event
+		status  int
+		path    string
+		metrics string
+		err     string
+	}{
+		{"success", nil, Event{Operation: OperationDump, Server: "db1", Databases: []string{"app", "users"}, Start: start, End: start.Add(12 * time.Second)}, http.StatusOK, "/metrics/job/mysql-backup/server/db1", `# HELP mysql_backup_dump_success whether the last dump succeeded, 1, or failed, 0
+# TYPE mysql_backup_dump_success gauge
+mysql_backup_dump_success 1
+# HELP mysql_backup_dump_last_run_timestamp_seconds when the last dump finished, as a unix time
+# TYPE mysql_backup_dump_last_run_timestamp_seconds gauge
+mysql_backup_dump_last_run_timestamp_seconds 1.704074412e+09
+# HELP mysql_backup_dump_last_success_timestamp_seconds when the last successful dump finished, as a unix time
+# TYPE mysql_backup_dump_last_success_timestamp_seconds gauge
+mysql_backup_dump_last_success_timestamp_seconds 1.704074412e+09
+# HELP mysql_backup_dump_duration_seconds how long the last dump took
+# TYPE mysql_backup_dump_duration_seconds gauge
+mysql_backup_dump_duration_seconds 12
+# HELP mysql_backup_dump_databases how many databases the last successful dump included
+# TYPE mysql_backup_dump_databases gauge
+mysql_backup_dump_databases 2
+`, ""},
+		{"failure", nil, Event{Operation: OperationDump, Server: "db1", Databases: []string{"app"}, Start: start, End: start.Add(3 * time.Second), Err: errors.New("connection refused")}, http.StatusOK, "/metrics/job/mysql-backup/server/db1", `# HELP mysql_backup_dump_success whether the last dump succeeded, 1, or failed, 0
+# TYPE mysql_backup_dump_success gauge
+mysql_backup_dump_success 0
+# HELP mysql_backup_dump_last_run_timestamp_seconds when the last dump finished, as a unix time
+# TYPE mysql_backup_dump_last_run_timestamp_seconds gauge
+mysql_backup_dump_last_run_timestamp_seconds 1.704074403e+09
+# HELP mysql_backup_dump_duration_seconds how long the last dump took
+# TYPE mysql_backup_dump_duration_seconds gauge
+mysql_backup_dump_duration_seconds 3
+`, ""},
+		{"no end", nil, Event{Operation: OperationPrune}, http.StatusOK, "/metrics/job/mysql-backup", `# HELP mysql_backup_prune_success whether the last prune succeeded, 1, or failed, 0
+# TYPE mysql_backup_prune_success gauge
+mysql_backup_prune_success 1
+# HELP mysql_backup_prune_last_run_timestamp_seconds when the last prune finished, as a unix time
+# TYPE mysql_backup_prune_last_run_timestamp_seconds gauge
+mysql_backup_prune_last_run_timestamp_seconds 1.7040744e+09
+# HELP mysql_backup_prune_last_success_timestamp_seconds when the last successful prune finished, as a unix time
+# TYPE mysql_backup_prune_last_success_timestamp_seconds gauge
+mysql_backup_prune_last_success_timestamp_seconds 1.7040744e+09
+`, ""},
+		{"grouping key", []PushgatewayOption{WithPushgatewayJob("backups"), WithPushgatewayInstance("cron1"), WithPushgatewayLabels(map[string]string{"env": "prod", "team": "", "path": "a/b"})}, Event{Operation: OperationPrune, Server: "db1"}, http.StatusOK, "/metrics/job/backups/instance/cron1/env/prod/path@base64/YS9i/team@base64/=/server/db1", "", ""},
+		{"rejected", nil, Event{Operation: OperationPrune}, http.StatusBadRequest, "/metrics/job/mysql-backup", "", ": 400 Bad Request invalid metric"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				path    string
+				metrics string
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "text/plain; version=0.0.4", r.Header.Get("Content-Type"))
+				path = r.URL.EscapedPath()
+				b, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				metrics = string(b)
+				w.WriteHeader(tt.status)
+				if tt.status != http.StatusOK {
+					_, _ = w.Write([]byte("invalid metric\n"))
+				}
+			}))
+			defer server.Close()
+
+			p := NewPushgateway(server.URL+"/", tt.opts...)
+			p.now = func() time.Time { return start }
+			err := p.Notify(context.Background(), tt.event)
+			if tt.err != "" {
+				// the error names the gateway, the URL of which is only known once it is started
+				require.EqualError(t, err, "error pushing metrics to "+server.URL+tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.path, path)
+			if tt.metrics != "" {
+				assert.Equal(t, tt.metrics, metrics)
+			}
+		})
+	}
+}
+
+func TestValidatePushgatewayLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		err    string
+	}{
+		{"none", nil, ""},
+		{"valid", map[string]string{"env": "prod", "_team2": "db"}, ""},
+		{"invalid name", map[string]string{"2env": "prod"}, `invalid label name "2env"`},
+		{"reserved", map[string]string{"server": "db1"}, "label server is set by mysql-backup, and cannot be given"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePushgatewayLabels(tt.labels)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
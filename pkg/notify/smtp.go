@@ -0,0 +1,346 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SMTPTLSNone plain SMTP, with no encryption
+	SMTPTLSNone = "none"
+	// SMTPTLSStartTLS upgrade the connection with STARTTLS; the usual for port 587
+	SMTPTLSStartTLS = "starttls"
+	// SMTPTLSImplicit connect with TLS from the start; the usual for port 465
+	SMTPTLSImplicit = "tls"
+
+	eventAttachmentName = "mysql-backup-event.json"
+)
+
+// SMTP sends notifications as email through an SMTP server
+type SMTP struct {
+	host               string
+	port               int
+	from               string
+	to                 []string
+	username           string
+	password           string
+	tlsMode            string
+	insecureSkipVerify bool
+	html               bool
+	onlyOnFailure      bool
+	attachEvent        bool
+}
+
+// SMTPOption an option for NewSMTP
+type SMTPOption func(*SMTP)
+
+// WithSMTPAuth authenticate to the server with the given username and password
+func WithSMTPAuth(username, password string) SMTPOption {
+	return func(s *SMTP) {
+		s.username = username
+		s.password = password
+	}
+}
+
+// WithSMTPTLS how to secure the connection, one of SMTPTLSNone, SMTPTLSStartTLS, SMTPTLSImplicit;
+// the default is SMTPTLSStartTLS
+func WithSMTPTLS(mode string) SMTPOption {
+	return func(s *SMTP) {
+		s.tlsMode = mode
+	}
+}
+
+// WithSMTPInsecureSkipVerify do not verify the server's TLS certificate
+func WithSMTPInsecureSkipVerify() SMTPOption {
+	return func(s *SMTP) {
+		s.insecureSkipVerify = true
+	}
+}
+
+// WithSMTPHTML send the summary as HTML, rather than plain text
+func WithSMTPHTML() SMTPOption {
+	return func(s *SMTP) {
+		s.html = true
+	}
+}
+
+// WithSMTPOnlyOnFailure send email only for operations that failed
+func WithSMTPOnlyOnFailure() SMTPOption {
+	return func(s *SMTP) {
+		s.onlyOnFailure = true
+	}
+}
+
+// WithSMTPAttachEvent attach the details of the event, as JSON
+func WithSMTPAttachEvent() SMTPOption {
+	return func(s *SMTP) {
+		s.attachEvent = true
+	}
+}
+
+// ValidSMTPTLS whether mode is a valid TLS mode for WithSMTPTLS
+func ValidSMTPTLS(mode string) bool {
+	switch mode {
+	case SMTPTLSNone, SMTPTLSStartTLS, SMTPTLSImplicit:
+		return true
+	}
+	return false
+}
+
+// NewSMTP create a notifier that emails from to each of to, through the SMTP server at host:port
+func NewSMTP(host string, port int, from string, to []string, opts ...SMTPOption) *SMTP {
+	s := &SMTP{
+		host:    host,
+		port:    port,
+		from:    from,
+		to:      to,
+		tlsMode: SMTPTLSStartTLS,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Notify email the event
+func (s *SMTP) Notify(ctx context.Context, e Event) error {
+	if s.onlyOnFailure && e.Success() {
+		return nil
+	}
+	msg, err := s.message(e, time.Now())
+	if err != nil {
+		return fmt.Errorf("error creating email: %v", err)
+	}
+	if err := s.send(ctx, msg); err != nil {
+		return fmt.Errorf("error sending email via %s: %v", s.host, err)
+	}
+	return nil
+}
+
+func (s *SMTP) send(ctx context.Context, msg []byte) error {
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	tlsConfig := &tls.Config{ServerName: s.host, InsecureSkipVerify: s.insecureSkipVerify} //nolint:gosec // explicitly requested by the user
+	var (
+		conn net.Conn
+		err  error
+	)
+	if s.tlsMode == SMTPTLSImplicit {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if s.tlsMode == SMTPTLSStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %v", err)
+		}
+	}
+	if s.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("authentication failed: %v", err)
+		}
+	}
+	if err := c.Mail(s.from); err != nil {
+		return err
+	}
+	for _, to := range s.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message the full email for the event, including headers
+func (s *SMTP) message(e Event, now time.Time) ([]byte, error) {
+	status := "succeeded"
+	if !e.Success() {
+		status = "failed"
+	}
+	subject := fmt.Sprintf("mysql-backup %s %s", e.Operation, status)
+	if e.Server != "" {
+		subject = fmt.Sprintf("mysql-backup %s on %s %s", e.Operation, e.Server, status)
+	}
+
+	var body bytes.Buffer
+	contentType := "text/plain; charset=utf-8"
+	if s.html {
+		contentType = "text/html; charset=utf-8"
+		if err := htmlReport.Execute(&body, reportFields(e)); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, f := range reportFields(e) {
+			fmt.Fprintf(&body, "%s: %s\r\n", f.Name, f.Value)
+		}
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	if !s.attachEvent {
+		fmt.Fprintf(&msg, "Content-Type: %s\r\n\r\n", contentType)
+		msg.Write(body.Bytes())
+		return msg.Bytes(), nil
+	}
+
+	attachment, err := json.MarshalIndent(eventJSON(e), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	mw := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(body.Bytes()); err != nil {
+		return nil, err
+	}
+	part, err = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"application/json"},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", eventAttachmentName)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// base64 lines in email are limited to 76 characters
+	encoded := base64.StdEncoding.EncodeToString(attachment)
+	for len(encoded) > 0 {
+		n := min(len(encoded), 76)
+		if _, err := fmt.Fprintf(part, "%s\r\n", encoded[:n]); err != nil {
+			return nil, err
+		}
+		encoded = encoded[n:]
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+type reportField struct {
+	Name  string
+	Value string
+}
+
+// reportFields the details of the event to report, in order
+func reportFields(e Event) []reportField {
+	status := "succeeded"
+	if !e.Success() {
+		status = "failed"
+	}
+	fields := []reportField{{"Operation", e.Operation}, {"Status", status}}
+	if e.Server != "" {
+		fields = append(fields, reportField{"Server", e.Server})
+	}
+	if len(e.Databases) > 0 {
+		fields = append(fields, reportField{"Databases", strings.Join(e.Databases, ", ")})
+	}
+	if !e.Start.IsZero() {
+		fields = append(fields, reportField{"Start", e.Start.Format(time.RFC3339)})
+	}
+	if !e.Start.IsZero() && !e.End.IsZero() {
+		fields = append(fields, reportField{"Duration", e.End.Sub(e.Start).Round(time.Second).String()})
+	}
+	if !e.Success() {
+		fields = append(fields, reportField{"Error", e.Err.Error()})
+	}
+	trigger := e.Trigger
+	if trigger == "" {
+		trigger = "schedule"
+	}
+	fields = append(fields, reportField{"Trigger", trigger})
+	if !e.PreviousSuccess.IsZero() {
+		fields = append(fields, reportField{"Previous success", e.PreviousSuccess.Format(time.RFC3339)})
+		if !e.End.IsZero() {
+			fields = append(fields, reportField{"Since previous success", e.End.Sub(e.PreviousSuccess).Round(time.Second).String()})
+		}
+	}
+	return append(fields, reportField{"Run", e.Run.String()})
+}
+
+var htmlReport = template.Must(template.New("report").Parse(`<html><body><table>
+{{- range . }}
+<tr><th align="left">{{ .Name }}</th><td>{{ .Value }}</td></tr>
+{{- end }}
+</table></body></html>
+`))
+
+type eventDetails struct {
+	Run       string    `json:"run"`
+	Operation string    `json:"operation"`
+	Success   bool      `json:"success"`
+	Server    string    `json:"server,omitempty"`
+	Databases []string  `json:"databases,omitempty"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Error     string    `json:"error,omitempty"`
+	Trigger   string    `json:"trigger"`
+	// PreviousSuccess and SinceSuccessSeconds are omitted if there is no previous success
+	PreviousSuccess     *time.Time `json:"previousSuccess,omitempty"`
+	SinceSuccessSeconds *int64     `json:"sinceSuccessSeconds,omitempty"`
+}
+
+// eventJSON the event in a form that can be marshalled to JSON
+func eventJSON(e Event) eventDetails {
+	d := eventDetails{
+		Run:       e.Run.String(),
+		Operation: e.Operation,
+		Success:   e.Success(),
+		Server:    e.Server,
+		Databases: e.Databases,
+		Start:     e.Start,
+		End:       e.End,
+		Trigger:   e.Trigger,
+	}
+	if e.Err != nil {
+		d.Error = e.Err.Error()
+	}
+	if d.Trigger == "" {
+		d.Trigger = "schedule"
+	}
+	if !e.PreviousSuccess.IsZero() {
+		previous := e.PreviousSuccess
+		since := int64(e.End.Sub(previous).Seconds())
+		d.PreviousSuccess, d.SinceSuccessSeconds = &previous, &since
+	}
+	return d
+}
@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMTP a minimal SMTP server that accepts a single connection and returns the message data
+func fakeSMTP(t *testing.T) (port int, data <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 localhost ESMTP\r\n")
+		var msg strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				fmt.Fprint(conn, "250 localhost\r\n")
+			case cmd == "DATA":
+				fmt.Fprint(conn, "354 go ahead\r\n")
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					msg.WriteString(l)
+				}
+				ch <- msg.String()
+				fmt.Fprint(conn, "250 ok\r\n")
+			case cmd == "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprint(conn, "250 ok\r\n")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, ch
+}
+
+func TestSMTPNotify(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	success := Event{Operation: OperationDump, Server: "db1", Databases: []string{"app"}, Start: start, End: start.Add(3 * time.Second)}
+	triggered := Event{Operation: OperationDump, Start: start, End: start.Add(3 * time.Second), Trigger: "http", PreviousSuccess: start.Add(-24 * time.Hour)}
+	failure := Event{Operation: OperationDump, Server: "db1", Databases: []string{"app"}, Start: start, End: start.Add(3 * time.Second), Err: errors.New("connection <refused>")}
+	tests := []struct {
+		name     string
+		opts     []SMTPOption
+		event    Event
+		sent     bool
+		contains []string
+	}{
+		{"plain success", nil, success, true, []string{"Subject: mysql-backup dump on db1 succeeded", "Content-Type: text/plain", "Databases: app\r\n", "Duration: 3s\r\n", "Trigger: schedule\r\n"}},
+		{"previous success", nil, triggered, true, []string{"Trigger: http\r\n", "Previous success: 2023-12-31T02:00:00Z\r\n", "Since previous success: 24h0m3s\r\n"}},
+		{"plain failure", nil, failure, true, []string{"Subject: mysql-backup dump on db1 failed", "Error: connection <refused>\r\n"}},
+		{"html failure", []SMTPOption{WithSMTPHTML()}, failure, true, []string{"Content-Type: text/html", "<th align=\"left\">Error</th><td>connection &lt;refused&gt;</td>"}},
+		{"attach event", []SMTPOption{WithSMTPAttachEvent()}, failure, true, []string{"Content-Type: multipart/mixed; boundary=", "Content-Disposition: attachment; filename=\"mysql-backup-event.json\""}},
+		{"only failure on success", []SMTPOption{WithSMTPOnlyOnFailure()}, success, false, nil},
+		{"only failure on failure", []SMTPOption{WithSMTPOnlyOnFailure()}, failure, true, []string{"Subject: mysql-backup dump on db1 failed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, data := fakeSMTP(t)
+			opts := append([]SMTPOption{WithSMTPTLS(SMTPTLSNone)}, tt.opts...)
+			s := NewSMTP("127.0.0.1", port, "backup@example.com", []string{"ops@example.com", "audit@example.com"}, opts...)
+			require.NoError(t, s.Notify(context.Background(), tt.event))
+			if !tt.sent {
+				select {
+				case <-data:
+					t.Fatal("unexpected email sent")
+				default:
+				}
+				return
+			}
+			msg := <-data
+			assert.Contains(t, msg, "From: backup@example.com\r\n")
+			assert.Contains(t, msg, "To: ops@example.com, audit@example.com\r\n")
+			for _, c := range tt.contains {
+				assert.Contains(t, msg, c)
+			}
+		})
+	}
+}
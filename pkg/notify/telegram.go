@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const defaultTelegramAPI = "https://api.telegram.org"
+
+// Telegram sends notifications as messages from a Telegram bot to a chat
+type Telegram struct {
+	token  string
+	chatID string
+	api    string
+	client *http.Client
+}
+
+// TelegramOption an option for NewTelegram
+type TelegramOption func(*Telegram)
+
+// WithTelegramAPI use the given Bot API base URL, rather than the default https://api.telegram.org
+func WithTelegramAPI(api string) TelegramOption {
+	return func(t *Telegram) {
+		t.api = api
+	}
+}
+
+// WithTelegramClient use the given HTTP client, rather than the default
+func WithTelegramClient(client *http.Client) TelegramOption {
+	return func(t *Telegram) {
+		t.client = client
+	}
+}
+
+// NewTelegram create a notifier that sends a message to chatID, using the bot with the given token
+func NewTelegram(token, chatID string, opts ...TelegramOption) *Telegram {
+	t := &Telegram{
+		token:  token,
+		chatID: chatID,
+		api:    defaultTelegramAPI,
+		client: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+type telegramMessage struct {
+	ChatID string `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+// Notify send the summary of the event as a message
+func (t *Telegram) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(telegramMessage{ChatID: t.chatID, Text: e.Summary()})
+	if err != nil {
+		return fmt.Errorf("error encoding telegram message: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/bot%s/sendMessage", t.api, t.token), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating telegram request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// the request URL includes the bot token, which must not end up in the logs
+		return fmt.Errorf("error sending telegram message to chat %s", t.chatID)
+	}
+	defer resp.Body.Close()
+	var result telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || !result.OK {
+		if result.Description != "" {
+			return fmt.Errorf("error sending telegram message to chat %s: %s", t.chatID, result.Description)
+		}
+		return fmt.Errorf("error sending telegram message to chat %s: %s", t.chatID, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelegramNotify(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		event    Event
+		status   int
+		response string
+		message  string
+		err      string
+	}{
+		{"success", Event{Operation: OperationDump, Server: "db1", Databases: []string{"app", "users"}, Start: start, End: start.Add(12 * time.Second)}, http.StatusOK, `{"ok":true}`, "mysql-backup dump of app, users on db1 succeeded in 12s", ""},
+		{"failure", Event{Operation: OperationDump, Server: "db1", Databases: []string{"app"}, Err: errors.New("connection refused")}, http.StatusOK, `{"ok":true}`, "mysql-backup dump of app on db1 failed: connection refused", ""},
+		{"rejected", Event{Operation: OperationPrune}, http.StatusBadRequest, `{"ok":false,"description":"Bad Request: chat not found"}`, "mysql-backup prune succeeded", "error sending telegram message to chat 12345: Bad Request: chat not found"},
+		{"not json", Event{Operation: OperationPrune}, http.StatusBadGateway, `bad gateway`, "mysql-backup prune succeeded", "error sending telegram message to chat 12345: 502 Bad Gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received telegramMessage
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "/botsecret/sendMessage", r.URL.Path)
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			err := NewTelegram("secret", "12345", WithTelegramAPI(server.URL)).Notify(context.Background(), tt.event)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, telegramMessage{ChatID: "12345", Text: tt.message}, received)
+		})
+	}
+}
@@ -0,0 +1,188 @@
+// Package restore restores a backup from a configuration, for use as a library, with no
+// command-line parsing or global state.
+package restore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/databacker/mysql-backup/pkg/backup"
+	"github.com/databacker/mysql-backup/pkg/compression"
+	"github.com/databacker/mysql-backup/pkg/config"
+	"github.com/databacker/mysql-backup/pkg/core"
+	"github.com/databacker/mysql-backup/pkg/database"
+	"github.com/databacker/mysql-backup/pkg/storage"
+	"github.com/databacker/mysql-backup/pkg/storage/credentials"
+)
+
+const defaultCompression = "gzip"
+
+// Options what to restore
+type Options struct {
+	// Target the name of a target in the configuration, or the URL of a target
+	Target string
+	// File the dump file to restore, relative to the target
+	File string
+	// DatabasesMap restore each database in the dump to the mapped database, rather than the original
+	DatabasesMap map[string]string
+	// Raw the file is a single compressed SQL dump, e.g. from another tool, rather than an archive
+	// created by a backup
+	Raw bool
+	// Newest File is a pattern, e.g. backups/db1/*.sql.gz, and the newest file that matches it is restored
+	Newest bool
+	// Label restore the newest dump with this label, instead of File, which must be empty
+	Label string
+	// Offset restore the dump this many older than the newest, e.g. 1 for the second newest: with Label, of the
+	// dumps with the label; with Newest, of the files that match File; with neither, and no File, of the dumps
+	// without a label
+	Offset int
+}
+
+type options struct {
+	logger *log.Logger
+}
+
+// Option an option for Run
+type Option func(*options)
+
+// WithLogger log to the given logger; the default is to discard all logs
+func WithLogger(logger *log.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// Run restore the dump file in opts to the database in cfg. Cancelling ctx aborts the restore.
+func Run(ctx context.Context, cfg config.ConfigSpec, opts Options, runOpts ...Option) error {
+	o := options{}
+	for _, opt := range runOpts {
+		opt(&o)
+	}
+	logger := o.logger
+	if logger == nil {
+		logger = log.New()
+		logger.SetOutput(io.Discard)
+	}
+	if opts.File == "" && opts.Label == "" && opts.Offset == 0 {
+		return fmt.Errorf("no file to restore")
+	}
+
+	var (
+		store storage.Storage
+		err   error
+	)
+	if target, ok := cfg.Targets[opts.Target]; ok {
+		if store, err = target.Storage.Storage(); err != nil {
+			return fmt.Errorf("error creating storage for target %s: %v", opts.Target, err)
+		}
+	} else if store, err = storage.ParseURL(opts.Target, credentials.Creds{}); err != nil {
+		return fmt.Errorf("target %s not found in configuration, and is not a valid url: %v", opts.Target, err)
+	}
+
+	compressionAlgo := cfg.Dump.Compression
+	if compressionAlgo == "" {
+		compressionAlgo = defaultCompression
+	}
+	compressor, err := compression.GetCompressor(compressionAlgo)
+	if err != nil {
+		return fmt.Errorf("failure to get compression '%s': %v", compressionAlgo, err)
+	}
+
+	progressInterval := time.Duration(cfg.Restore.ProgressInterval)
+	if progressInterval == 0 {
+		progressInterval = core.DefaultRestoreProgressInterval
+	}
+
+	dbconn := Connection(cfg.Database, cfg.Restore.Database)
+	if err := database.ValidateTLS(dbconn.TLS); err != nil {
+		return err
+	}
+	if cfg.Restore.CharacterSet != "" {
+		if err := database.ValidateCharset(cfg.Restore.CharacterSet); err != nil {
+			return err
+		}
+		dbconn.Charset = cfg.Restore.CharacterSet
+	}
+	if cfg.Restore.Collation != "" {
+		if err := database.ValidateCollation(cfg.Restore.CharacterSet, cfg.Restore.Collation); err != nil {
+			return err
+		}
+		dbconn.Collation = cfg.Restore.Collation
+	}
+	if err := database.ValidateMaxAllowedPacket(cfg.Restore.MaxAllowedPacket); err != nil {
+		return err
+	}
+	dbconn.MaxAllowedPacket = cfg.Restore.MaxAllowedPacket
+
+	if err := database.ValidateDropAllowed(cfg.Restore.DropBeforeRestore, cfg.Restore.DropAllowed); err != nil {
+		return err
+	}
+	if err := core.ValidateRestoreConcurrency(cfg.Restore.Concurrency); err != nil {
+		return err
+	}
+	if err := database.ValidateGTIDMode(cfg.Restore.GTIDMode); err != nil {
+		return err
+	}
+
+	executor := &core.Executor{Logger: logger}
+	_, err = executor.Restore(ctx, core.RestoreOptions{
+		Target:                  store,
+		TargetFile:              opts.File,
+		DBConn:                  dbconn,
+		DatabasesMap:            opts.DatabasesMap,
+		Compressor:              compressor,
+		Run:                     uuid.New(),
+		Force:                   cfg.Restore.Force,
+		Raw:                     opts.Raw,
+		Newest:                  opts.Newest,
+		CompressionDictionaries: cfg.Restore.CompressionDictionaries,
+		ProgressInterval:        progressInterval,
+		Tmp:                     core.TmpOptions{Path: cfg.Restore.TmpPath, Private: cfg.Restore.PrivateTmp},
+		DropBeforeRestore:       cfg.Restore.DropBeforeRestore,
+		DropAllowed:             cfg.Restore.DropAllowed,
+		Label:                   opts.Label,
+		Offset:                  opts.Offset,
+		Concurrency:             cfg.Restore.Concurrency,
+		NormalizeLineEndings:    cfg.Restore.NormalizeLineEndings,
+		GTIDMode:                cfg.Restore.GTIDMode,
+		VerifyRowCounts:         cfg.Restore.VerifyRowCounts,
+	})
+	return err
+}
+
+// Connection the database connection to restore to: that of the database configuration db, with each of the
+// settings of the restore database that is set in place of its own
+func Connection(db config.Database, restore config.RestoreDatabase) database.Connection {
+	conn := backup.Connection(db)
+	if restore.Server != "" {
+		conn.Host = restore.Server
+	}
+	if restore.Port != 0 {
+		conn.Port = restore.Port
+	}
+	if restore.Credentials.Username != "" {
+		conn.User = restore.Credentials.Username
+	}
+	if restore.Credentials.Password != "" {
+		conn.Pass = restore.Credentials.Password
+	}
+	if restore.TLS != "" {
+		conn.TLS = restore.TLS
+	}
+	if restore.ConnectTimeout != 0 {
+		conn.ConnectTimeout = time.Duration(restore.ConnectTimeout)
+	}
+	if restore.DefaultsFile != "" {
+		conn.DefaultsFile = restore.DefaultsFile
+		// the port in the file, if any, rather than the default
+		if restore.Port == 0 && db.Port == 0 {
+			conn.Port = 0
+		}
+	}
+	return conn
+}
@@ -0,0 +1,95 @@
+package restore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	"github.com/databacker/mysql-backup/pkg/config"
+	"github.com/databacker/mysql-backup/pkg/database"
+)
+
+const testConfig = `
+database:
+  server: abc
+  port: 3307
+  credentials:
+    username: user
+    password: pass
+targets:
+  local:
+    type: file
+    url: file:///backups
+`
+
+func TestRunValidation(t *testing.T) {
+	var cfg config.ConfigSpec
+	if err := yaml.Unmarshal([]byte(testConfig), &cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	invalidCharset := func(cfg config.ConfigSpec) config.ConfigSpec {
+		cfg.Restore.CharacterSet = "utf 8"
+		return cfg
+	}
+	tests := []struct {
+		name string
+		cfg  func(cfg config.ConfigSpec) config.ConfigSpec
+		opts Options
+		err  string
+	}{
+		{"no file, label or offset", nil, Options{Target: "local"}, "no file to restore"},
+		{"unknown target", nil, Options{Target: "other", File: "db.tgz"}, "target other not found in configuration"},
+		{"invalid compression", func(cfg config.ConfigSpec) config.ConfigSpec {
+			cfg.Dump.Compression = "rar"
+			return cfg
+		}, Options{Target: "local", File: "db.tgz"}, "failure to get compression"},
+		// each of a file, a label or an offset is enough to get past the check, to the next one
+		{"file", invalidCharset, Options{Target: "local", File: "db.tgz"}, "invalid character set"},
+		{"label", invalidCharset, Options{Target: "local", Label: "nightly"}, "invalid character set"},
+		{"offset", invalidCharset, Options{Target: "file:///other", Offset: 1}, "invalid character set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cfg
+			if tt.cfg != nil {
+				c = tt.cfg(cfg)
+			}
+			err := Run(context.Background(), c, tt.opts)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestConnection(t *testing.T) {
+	db := config.Database{
+		Server:         "abc",
+		Credentials:    config.DBCredentials{Username: "user", Password: "pass"},
+		ConnectTimeout: config.Duration(5 * time.Second),
+	}
+	tests := []struct {
+		name     string
+		db       config.Database
+		restore  config.RestoreDatabase
+		expected database.Connection
+	}{
+		{"database", db, config.RestoreDatabase{},
+			database.Connection{Host: "abc", Port: 3306, User: "user", Pass: "pass", ConnectTimeout: 5 * time.Second}},
+		{"restore database", db, config.RestoreDatabase{Server: "def", Port: 3307, Credentials: config.DBCredentials{Password: "other"}, TLS: "true"},
+			database.Connection{Host: "def", Port: 3307, User: "user", Pass: "other", TLS: "true", ConnectTimeout: 5 * time.Second}},
+		{"restore connect timeout", db, config.RestoreDatabase{ConnectTimeout: config.Duration(time.Minute)},
+			database.Connection{Host: "abc", Port: 3306, User: "user", Pass: "pass", ConnectTimeout: time.Minute}},
+		// the port in the defaults file, rather than the default port
+		{"restore defaults file", db, config.RestoreDatabase{DefaultsFile: "/etc/restore.cnf"},
+			database.Connection{Host: "abc", User: "user", Pass: "pass", ConnectTimeout: 5 * time.Second, DefaultsFile: "/etc/restore.cnf"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Connection(tt.db, tt.restore))
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package b2
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultAPI = "https://api.backblazeb2.com"
+	apiVersion = "/b2api/v2/"
+)
+
+// apiError an error returned by the B2 native API
+type apiError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// expiredAuth whether err is because the authorization token has expired, after which it must authorize again
+func expiredAuth(err error) bool {
+	var e *apiError
+	return errors.As(err, &e) && e.Status == http.StatusUnauthorized && (e.Code == "expired_auth_token" || e.Code == "bad_auth_token")
+}
+
+// account the result of authorizing with the key, which all of the other calls use
+type account struct {
+	AccountID           string `json:"accountId"`
+	AuthorizationToken  string `json:"authorizationToken"`
+	APIURL              string `json:"apiUrl"`
+	DownloadURL         string `json:"downloadUrl"`
+	RecommendedPartSize int64  `json:"recommendedPartSize"`
+	MinimumPartSize     int64  `json:"absoluteMinimumPartSize"`
+	Allowed             struct {
+		BucketID   string `json:"bucketId"`
+		BucketName string `json:"bucketName"`
+	} `json:"allowed"`
+}
+
+// file a file as listed by the B2 API
+type file struct {
+	FileID          string `json:"fileId"`
+	FileName        string `json:"fileName"`
+	Action          string `json:"action"`
+	ContentLength   int64  `json:"contentLength"`
+	UploadTimestamp int64  `json:"uploadTimestamp"`
+}
+
+type uploadURL struct {
+	UploadURL          string `json:"uploadUrl"`
+	AuthorizationToken string `json:"authorizationToken"`
+}
+
+// client a client of the B2 native API for a single bucket, which authorizes on first use
+type client struct {
+	api            string
+	keyID          string
+	applicationKey string
+	bucketName     string
+	httpClient     *http.Client
+
+	mu       sync.Mutex
+	account  *account
+	bucketID string
+}
+
+// authorize with the key, and find the bucket, unless already authorized
+func (c *client) authorize(ctx context.Context) (*account, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.account != nil {
+		return c.account, c.bucketID, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.api, "/")+apiVersion+"b2_authorize_account", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.SetBasicAuth(c.keyID, c.applicationKey)
+	var acct account
+	if err := c.do(req, &acct); err != nil {
+		return nil, "", fmt.Errorf("failed to authorize: %v", err)
+	}
+	// a key restricted to a bucket is not allowed to list the buckets, but already says which it is
+	bucketID := acct.Allowed.BucketID
+	if bucketID == "" || acct.Allowed.BucketName != c.bucketName {
+		var buckets struct {
+			Buckets []struct {
+				BucketID   string `json:"bucketId"`
+				BucketName string `json:"bucketName"`
+			} `json:"buckets"`
+		}
+		if err := c.post(ctx, acct.APIURL, acct.AuthorizationToken, "b2_list_buckets", map[string]string{"accountId": acct.AccountID, "bucketName": c.bucketName}, &buckets); err != nil {
+			return nil, "", fmt.Errorf("failed to find bucket %s: %v", c.bucketName, err)
+		}
+		if len(buckets.Buckets) == 0 {
+			return nil, "", fmt.Errorf("bucket %s not found", c.bucketName)
+		}
+		bucketID = buckets.Buckets[0].BucketID
+	}
+	c.account, c.bucketID = &acct, bucketID
+	return c.account, c.bucketID, nil
+}
+
+// call the API operation with the request body, decoding the response into result. If the authorization has
+// expired, it authorizes again and retries once.
+func (c *client) call(ctx context.Context, operation string, body any, result any) error {
+	acct, _, err := c.authorize(ctx)
+	if err != nil {
+		return err
+	}
+	err = c.post(ctx, acct.APIURL, acct.AuthorizationToken, operation, body, result)
+	if !expiredAuth(err) {
+		return err
+	}
+	c.mu.Lock()
+	c.account = nil
+	c.mu.Unlock()
+	if acct, _, err = c.authorize(ctx); err != nil {
+		return err
+	}
+	return c.post(ctx, acct.APIURL, acct.AuthorizationToken, operation, body, result)
+}
+
+func (c *client) post(ctx context.Context, apiURL, token, operation string, body any, result any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+apiVersion+operation, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", token)
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, result)
+}
+
+// do send the request, decoding a successful response into result, and an unsuccessful one into an apiError
+func (c *client) do(req *http.Request, result any) error {
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		e := &apiError{Status: res.StatusCode}
+		if err := json.NewDecoder(res.Body).Decode(e); err != nil || e.Code == "" {
+			e.Code, e.Message = "error", res.Status
+		}
+		return e
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// upload the content, of size bytes, as the file name, in a single request
+func (c *client) upload(ctx context.Context, name string, content io.ReadSeeker, size int64) error {
+	_, bucketID, err := c.authorize(ctx)
+	if err != nil {
+		return err
+	}
+	var u uploadURL
+	if err := c.call(ctx, "b2_get_upload_url", map[string]string{"bucketId": bucketID}, &u); err != nil {
+		return fmt.Errorf("failed to get upload URL: %v", err)
+	}
+	checksum, err := sha1Hex(content, size)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.UploadURL, io.NewSectionReader(readerAt{content}, 0, size))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Authorization", u.AuthorizationToken)
+	req.Header.Set("X-Bz-File-Name", encodeName(name))
+	req.Header.Set("Content-Type", "b2/x-auto")
+	req.Header.Set("X-Bz-Content-Sha1", checksum)
+	return c.do(req, nil)
+}
+
+// uploadLarge upload the content, of size bytes, as the file name, in parts of partSize bytes, so that a file
+// larger than a single upload allows can be stored, and each part is checked on its own. Cancels the file if
+// any part fails, so that the parts do not linger in the bucket.
+func (c *client) uploadLarge(ctx context.Context, name string, content io.ReadSeeker, size, partSize int64) (err error) {
+	_, bucketID, err := c.authorize(ctx)
+	if err != nil {
+		return err
+	}
+	var started file
+	if err := c.call(ctx, "b2_start_large_file", map[string]string{"bucketId": bucketID, "fileName": name, "contentType": "b2/x-auto"}, &started); err != nil {
+		return fmt.Errorf("failed to start large file: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			// not on ctx, which may be why it failed
+			_ = c.call(context.Background(), "b2_cancel_large_file", map[string]string{"fileId": started.FileID}, nil)
+		}
+	}()
+	var u uploadURL
+	if err := c.call(ctx, "b2_get_upload_part_url", map[string]string{"fileId": started.FileID}, &u); err != nil {
+		return fmt.Errorf("failed to get upload part URL: %v", err)
+	}
+	var checksums []string
+	for part, offset := 1, int64(0); offset < size; part, offset = part+1, offset+partSize {
+		n := partSize
+		if size-offset < n {
+			n = size - offset
+		}
+		section := io.NewSectionReader(readerAt{content}, offset, n)
+		checksum, err := sha1Hex(section, n)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.UploadURL, section)
+		if err != nil {
+			return err
+		}
+		req.ContentLength = n
+		req.Header.Set("Authorization", u.AuthorizationToken)
+		req.Header.Set("X-Bz-Part-Number", strconv.Itoa(part))
+		req.Header.Set("X-Bz-Content-Sha1", checksum)
+		if err := c.do(req, nil); err != nil {
+			return fmt.Errorf("failed to upload part %d: %v", part, err)
+		}
+		checksums = append(checksums, checksum)
+	}
+	if err := c.call(ctx, "b2_finish_large_file", map[string]any{"fileId": started.FileID, "partSha1Array": checksums}, nil); err != nil {
+		return fmt.Errorf("failed to finish large file: %v", err)
+	}
+	return nil
+}
+
+// download the file name to w
+func (c *client) download(ctx context.Context, name string, w io.Writer) (int64, error) {
+	acct, _, err := c.authorize(ctx)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, acct.DownloadURL+"/file/"+url.PathEscape(c.bucketName)+"/"+encodeName(name), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", acct.AuthorizationToken)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		e := &apiError{Status: res.StatusCode}
+		if err := json.NewDecoder(res.Body).Decode(e); err != nil || e.Code == "" {
+			e.Code, e.Message = "error", res.Status
+		}
+		return 0, e
+	}
+	return io.Copy(w, res.Body)
+}
+
+// list the files whose names start with prefix, in any directory below it, a page at a time
+func (c *client) list(ctx context.Context, prefix string) ([]file, error) {
+	_, bucketID, err := c.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		files []file
+		start string
+	)
+	for {
+		body := map[string]any{"bucketId": bucketID, "prefix": prefix, "maxFileCount": 1000}
+		if start != "" {
+			body["startFileName"] = start
+		}
+		var page struct {
+			Files        []file  `json:"files"`
+			NextFileName *string `json:"nextFileName"`
+		}
+		if err := c.call(ctx, "b2_list_file_names", body, &page); err != nil {
+			return nil, fmt.Errorf("failed to list files: %v", err)
+		}
+		files = append(files, page.Files...)
+		if page.NextFileName == nil || *page.NextFileName == "" {
+			return files, nil
+		}
+		start = *page.NextFileName
+	}
+}
+
+// remove every version of the file name, so that it no longer takes any space in the bucket
+func (c *client) remove(ctx context.Context, name string) error {
+	_, bucketID, err := c.authorize(ctx)
+	if err != nil {
+		return err
+	}
+	var (
+		versions  []file
+		startName = name
+		startID   string
+	)
+	for {
+		body := map[string]any{"bucketId": bucketID, "prefix": name, "startFileName": startName, "maxFileCount": 1000}
+		if startID != "" {
+			body["startFileId"] = startID
+		}
+		var page struct {
+			Files        []file  `json:"files"`
+			NextFileName *string `json:"nextFileName"`
+			NextFileID   *string `json:"nextFileId"`
+		}
+		if err := c.call(ctx, "b2_list_file_versions", body, &page); err != nil {
+			return fmt.Errorf("failed to list versions: %v", err)
+		}
+		for _, f := range page.Files {
+			if f.FileName == name {
+				versions = append(versions, f)
+			}
+		}
+		if page.NextFileName == nil || *page.NextFileName != name || page.NextFileID == nil {
+			break
+		}
+		startName, startID = *page.NextFileName, *page.NextFileID
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("file %s not found", name)
+	}
+	for _, v := range versions {
+		if err := c.call(ctx, "b2_delete_file_version", map[string]string{"fileName": v.FileName, "fileId": v.FileID}, nil); err != nil {
+			return fmt.Errorf("failed to delete version %s: %v", v.FileID, err)
+		}
+	}
+	return nil
+}
+
+// encodeName percent-encode a file name for a header or URL, as B2 requires, leaving the / between directories
+func encodeName(name string) string {
+	parts := strings.Split(name, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+// sha1Hex the SHA1 checksum of the first size bytes of r, in hex, which B2 requires of every upload, leaving
+// r back at the start
+func sha1Hex(r io.ReadSeeker, size int64) (string, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	if _, err := io.CopyN(h, r, size); err != nil {
+		return "", err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readerAt read from a ReadSeeker at an offset, e.g. an os.File, which is already an io.ReaderAt, or a section
+type readerAt struct {
+	r io.ReadSeeker
+}
+
+func (r readerAt) ReadAt(p []byte, off int64) (int, error) {
+	if ra, ok := r.r.(io.ReaderAt); ok {
+		return ra.ReadAt(p, off)
+	}
+	if _, err := r.r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(r.r, p)
+}
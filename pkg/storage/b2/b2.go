@@ -0,0 +1,208 @@
+package b2
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// B2 a Backblaze B2 bucket, reached with the native B2 API, rather than its S3-compatible API,
+// so that large dumps are uploaded in parts, each checked on its own, and every version of a
+// removed file is deleted.
+type B2 struct {
+	url            url.URL
+	keyID          string
+	applicationKey string
+	api            string
+	client         *client
+}
+
+type Option func(b *B2)
+
+// WithKeyID the ID of the application key to authorize with
+func WithKeyID(keyID string) Option {
+	return func(b *B2) {
+		b.keyID = keyID
+	}
+}
+
+// WithApplicationKey the application key to authorize with
+func WithApplicationKey(applicationKey string) Option {
+	return func(b *B2) {
+		b.applicationKey = applicationKey
+	}
+}
+
+// WithAPI the URL of the B2 API to authorize with, rather than https://api.backblazeb2.com; mainly for testing
+func WithAPI(api string) Option {
+	return func(b *B2) {
+		b.api = api
+	}
+}
+
+// New a B2 storage for the URL b2://bucket/path
+func New(u url.URL, opts ...Option) *B2 {
+	b := &B2{url: u, api: defaultAPI}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.client = &client{
+		api:            b.api,
+		keyID:          b.keyID,
+		applicationKey: b.applicationKey,
+		bucketName:     u.Hostname(),
+		httpClient:     http.DefaultClient,
+	}
+	return b
+}
+
+func (b *B2) Pull(ctx context.Context, source, target string, logger *log.Entry) (int64, error) {
+	f, err := os.Create(target)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create target restore file %q, %v", target, err)
+	}
+	defer f.Close()
+
+	n, err := b.client.download(ctx, b.key(source), f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to download file, %v", err)
+	}
+	return n, nil
+}
+
+func (b *B2) Push(ctx context.Context, target, source string, logger *log.Entry) (int64, error) {
+	f, err := os.Open(source)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read input file %q, %v", source, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read input file %q, %v", source, err)
+	}
+	acct, _, err := b.client.authorize(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	key, size := b.key(target), info.Size()
+	// B2 recommends uploading anything larger than the recommended part size in parts, and needs at least
+	// two parts for a large file
+	if partSize := acct.RecommendedPartSize; partSize > 0 && size > partSize {
+		logger.Debugf("uploading %s in parts of %d bytes", key, partSize)
+		err = b.client.uploadLarge(ctx, key, f, size, partSize)
+	} else {
+		err = b.client.upload(ctx, key, f, size)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to upload file, %v", err)
+	}
+	return size, nil
+}
+
+// Stored the size of the stored file. B2 has no SHA256 of a file, and already checks the SHA1 of each upload,
+// or each part of a large one, so there is no checksum.
+func (b *B2) Stored(ctx context.Context, name string, logger *log.Entry) (int64, string, error) {
+	key := b.key(name)
+	files, err := b.client.list(ctx, key)
+	if err != nil {
+		return 0, "", err
+	}
+	for _, f := range files {
+		if f.FileName == key {
+			return f.ContentLength, "", nil
+		}
+	}
+	return 0, "", fmt.Errorf("failed to get file %s: not found", key)
+}
+
+func (b *B2) Clean(filename string) string {
+	return filename
+}
+
+func (b *B2) Protocol() string {
+	return "b2"
+}
+
+func (b *B2) URL() string {
+	return b.url.String()
+}
+
+func (b *B2) ReadDir(ctx context.Context, dirname string, logger *log.Entry) ([]fs.FileInfo, error) {
+	// list relative to the path in the URL, the same way as Push and Pull, so the names returned
+	// can be passed back to Pull and Remove
+	prefix := b.key(dirname)
+	if prefix != "" {
+		prefix += "/"
+	}
+	return b.listFiles(ctx, prefix, prefix)
+}
+
+// List the files whose names, relative to the path in the URL, start with prefix, in any directory below it.
+// The names returned are relative to the path in the URL, so they can be passed back to Pull and Remove.
+func (b *B2) List(ctx context.Context, prefix string, logger *log.Entry) ([]fs.FileInfo, error) {
+	base := b.key("")
+	if base != "" {
+		base += "/"
+	}
+	return b.listFiles(ctx, base+strings.TrimPrefix(prefix, "/"), base)
+}
+
+// listFiles list every file whose name starts with prefix, named relative to trim
+func (b *B2) listFiles(ctx context.Context, prefix, trim string) ([]fs.FileInfo, error) {
+	list, err := b.client.list(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var files []fs.FileInfo
+	for _, f := range list {
+		if f.Action != "upload" {
+			continue
+		}
+		files = append(files, &b2FileInfo{
+			name:         strings.TrimPrefix(f.FileName, trim),
+			lastModified: time.UnixMilli(f.UploadTimestamp),
+			size:         f.ContentLength,
+		})
+	}
+	return files, nil
+}
+
+// Remove every version of the file, as B2 keeps earlier versions of a file, and hiding it would free no space
+func (b *B2) Remove(ctx context.Context, target string, logger *log.Entry) error {
+	if err := b.client.remove(ctx, b.key(target)); err != nil {
+		return fmt.Errorf("failed to delete file, %v", err)
+	}
+	return nil
+}
+
+// key get the name of the file in the bucket for a name relative to the path in the URL
+func (b *B2) key(name string) string {
+	// B2 file names do not start with a /
+	key := strings.Trim(path.Join(b.url.Path, name), "/")
+	if key == "." {
+		return ""
+	}
+	return key
+}
+
+type b2FileInfo struct {
+	name         string
+	lastModified time.Time
+	size         int64
+}
+
+func (b b2FileInfo) Name() string       { return b.name }
+func (b b2FileInfo) Size() int64        { return b.size }
+func (b b2FileInfo) Mode() os.FileMode  { return 0 } // Not applicable in B2
+func (b b2FileInfo) ModTime() time.Time { return b.lastModified }
+func (b b2FileInfo) IsDir() bool        { return false } // Not applicable in B2
+func (b b2FileInfo) Sys() interface{}   { return nil }   // Not applicable in B2
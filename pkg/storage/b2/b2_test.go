@@ -0,0 +1,335 @@
+package b2
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeB2 a minimal B2 native API for a single bucket, keeping every version of every file
+type fakeB2 struct {
+	*httptest.Server
+	partSize int64
+
+	mu       sync.Mutex
+	nextID   int
+	versions []fakeFile
+	large    map[string]*fakeLarge
+	// authorizations how many times the key was authorized
+	authorizations int
+	// expire the next call with this token, to check that the client authorizes again
+	expire string
+}
+
+type fakeFile struct {
+	id, name string
+	content  []byte
+}
+
+type fakeLarge struct {
+	name  string
+	parts map[int][]byte
+}
+
+func newFakeB2(t *testing.T, partSize int64) *fakeB2 {
+	f := &fakeB2{partSize: partSize, large: map[string]*fakeLarge{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeB2) token() string {
+	return "token" + strconv.Itoa(f.authorizations)
+}
+
+func (f *fakeB2) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fail := func(status int, code string) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(apiError{Status: status, Code: code, Message: code})
+	}
+	reply := func(v any) {
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	op := strings.TrimPrefix(r.URL.Path, apiVersion)
+	if op == "b2_authorize_account" {
+		if user, pass, _ := r.BasicAuth(); user != "keyid" || pass != "appkey" {
+			fail(http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		f.authorizations++
+		reply(map[string]any{
+			"accountId":               "account",
+			"authorizationToken":      f.token(),
+			"apiUrl":                  f.URL,
+			"downloadUrl":             f.URL,
+			"recommendedPartSize":     f.partSize,
+			"absoluteMinimumPartSize": 1,
+		})
+		return
+	}
+	if r.Header.Get("Authorization") != f.token() {
+		fail(http.StatusUnauthorized, "bad_auth_token")
+		return
+	}
+	if f.expire == f.token() {
+		f.expire = ""
+		fail(http.StatusUnauthorized, "expired_auth_token")
+		return
+	}
+
+	// uploads and downloads are not JSON
+	switch {
+	case op == "upload":
+		content, _ := io.ReadAll(r.Body)
+		if sum := sha1.Sum(content); hex.EncodeToString(sum[:]) != r.Header.Get("X-Bz-Content-Sha1") {
+			fail(http.StatusBadRequest, "bad_request")
+			return
+		}
+		name, _ := url.PathUnescape(r.Header.Get("X-Bz-File-Name"))
+		f.add(name, content)
+		reply(map[string]any{})
+		return
+	case strings.HasPrefix(op, "upload_part/"):
+		content, _ := io.ReadAll(r.Body)
+		if sum := sha1.Sum(content); hex.EncodeToString(sum[:]) != r.Header.Get("X-Bz-Content-Sha1") {
+			fail(http.StatusBadRequest, "bad_request")
+			return
+		}
+		part, _ := strconv.Atoi(r.Header.Get("X-Bz-Part-Number"))
+		f.large[strings.TrimPrefix(op, "upload_part/")].parts[part] = content
+		reply(map[string]any{})
+		return
+	case strings.HasPrefix(r.URL.Path, "/file/bucket/"):
+		name := strings.TrimPrefix(r.URL.Path, "/file/bucket/")
+		for i := len(f.versions) - 1; i >= 0; i-- {
+			if f.versions[i].name == name {
+				_, _ = w.Write(f.versions[i].content)
+				return
+			}
+		}
+		fail(http.StatusNotFound, "not_found")
+		return
+	}
+
+	var body map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	switch op {
+	case "b2_list_buckets":
+		reply(map[string]any{"buckets": []map[string]string{{"bucketId": "bucketid", "bucketName": "bucket"}}})
+	case "b2_get_upload_url":
+		reply(uploadURL{UploadURL: f.URL + apiVersion + "upload", AuthorizationToken: f.token()})
+	case "b2_start_large_file":
+		f.nextID++
+		id := "large" + strconv.Itoa(f.nextID)
+		f.large[id] = &fakeLarge{name: body["fileName"].(string), parts: map[int][]byte{}}
+		reply(file{FileID: id, FileName: body["fileName"].(string)})
+	case "b2_get_upload_part_url":
+		reply(uploadURL{UploadURL: f.URL + apiVersion + "upload_part/" + body["fileId"].(string), AuthorizationToken: f.token()})
+	case "b2_finish_large_file":
+		l := f.large[body["fileId"].(string)]
+		var content []byte
+		for i := range body["partSha1Array"].([]any) {
+			content = append(content, l.parts[i+1]...)
+		}
+		delete(f.large, body["fileId"].(string))
+		f.add(l.name, content)
+		reply(map[string]any{})
+	case "b2_cancel_large_file":
+		delete(f.large, body["fileId"].(string))
+		reply(map[string]any{})
+	case "b2_list_file_names":
+		// the latest version of each name, one name to a page, to check paging
+		latest := map[string]fakeFile{}
+		for _, v := range f.versions {
+			if strings.HasPrefix(v.name, body["prefix"].(string)) {
+				latest[v.name] = v
+			}
+		}
+		var names []string
+		for name := range latest {
+			if start, _ := body["startFileName"].(string); name >= start {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		page := map[string]any{"files": []file{}}
+		if len(names) > 0 {
+			v := latest[names[0]]
+			page["files"] = []file{{FileID: v.id, FileName: v.name, Action: "upload", ContentLength: int64(len(v.content)), UploadTimestamp: 1700000000000}}
+		}
+		if len(names) > 1 {
+			page["nextFileName"] = names[1]
+		}
+		reply(page)
+	case "b2_list_file_versions":
+		var files []file
+		for _, v := range f.versions {
+			if strings.HasPrefix(v.name, body["prefix"].(string)) {
+				files = append(files, file{FileID: v.id, FileName: v.name, Action: "upload"})
+			}
+		}
+		reply(map[string]any{"files": files})
+	case "b2_delete_file_version":
+		for i, v := range f.versions {
+			if v.id == body["fileId"].(string) {
+				f.versions = append(f.versions[:i], f.versions[i+1:]...)
+				break
+			}
+		}
+		reply(map[string]any{})
+	default:
+		fail(http.StatusNotFound, "not_found")
+	}
+}
+
+func (f *fakeB2) add(name string, content []byte) {
+	f.nextID++
+	f.versions = append(f.versions, fakeFile{id: "file" + strconv.Itoa(f.nextID), name: name, content: content})
+}
+
+func (f *fakeB2) content(name string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var contents []string
+	for _, v := range f.versions {
+		if v.name == name {
+			contents = append(contents, string(v.content))
+		}
+	}
+	return contents
+}
+
+func newTestB2(fake *fakeB2) *B2 {
+	return New(url.URL{Scheme: "b2", Host: "bucket", Path: "/backups"}, WithKeyID("keyid"), WithApplicationKey("appkey"), WithAPI(fake.URL))
+}
+
+func writeFile(t *testing.T, content string) string {
+	filename := filepath.Join(t.TempDir(), "dump.tgz")
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0o600))
+	return filename
+}
+
+func TestPush(t *testing.T) {
+	logger := log.NewEntry(log.New())
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"small", "abc"},
+		{"exactly one part", "abcdefghij"},
+		{"large", "abcdefghijklmnopqrstuvwxy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeB2(t, 10)
+			b := newTestB2(fake)
+			n, err := b.Push(context.Background(), "db_backup.tgz", writeFile(t, tt.content), logger)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(tt.content)), n)
+			assert.Equal(t, []string{tt.content}, fake.content("backups/db_backup.tgz"))
+			assert.Empty(t, fake.large, "unfinished large files")
+
+			size, checksum, err := b.Stored(context.Background(), "db_backup.tgz", logger)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(tt.content)), size)
+			assert.Empty(t, checksum)
+
+			target := filepath.Join(t.TempDir(), "restore.tgz")
+			n, err = b.Pull(context.Background(), "db_backup.tgz", target, logger)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(tt.content)), n)
+			restored, err := os.ReadFile(target)
+			require.NoError(t, err)
+			assert.Equal(t, tt.content, string(restored))
+		})
+	}
+}
+
+func TestReadDirAndList(t *testing.T) {
+	logger := log.NewEntry(log.New())
+	fake := newFakeB2(t, 100)
+	fake.add("backups/db_backup_2024-01-01.tgz", []byte("a"))
+	fake.add("backups/db_backup_2024-01-02.tgz", []byte("bb"))
+	fake.add("backups/db1/db_backup_2024-01-03.tgz", []byte("ccc"))
+	fake.add("other/db_backup_2024-01-04.tgz", []byte("dddd"))
+	b := newTestB2(fake)
+
+	names := func(files []os.FileInfo) map[string]int64 {
+		m := map[string]int64{}
+		for _, f := range files {
+			m[f.Name()] = f.Size()
+		}
+		return m
+	}
+	files, err := b.ReadDir(context.Background(), ".", logger)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		"db_backup_2024-01-01.tgz":     1,
+		"db_backup_2024-01-02.tgz":     2,
+		"db1/db_backup_2024-01-03.tgz": 3,
+	}, names(files))
+
+	files, err = b.ReadDir(context.Background(), "db1", logger)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"db_backup_2024-01-03.tgz": 3}, names(files))
+
+	files, err = b.List(context.Background(), "db_backup_2024-01-0", logger)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"db_backup_2024-01-01.tgz": 1, "db_backup_2024-01-02.tgz": 2}, names(files))
+}
+
+func TestRemove(t *testing.T) {
+	logger := log.NewEntry(log.New())
+	fake := newFakeB2(t, 100)
+	fake.add("backups/db_backup.tgz", []byte("old"))
+	fake.add("backups/db_backup.tgz", []byte("new"))
+	fake.add("backups/db_backup.tgz.1", []byte("other"))
+	b := newTestB2(fake)
+
+	require.NoError(t, b.Remove(context.Background(), "db_backup.tgz", logger))
+	assert.Empty(t, fake.content("backups/db_backup.tgz"), "every version removed")
+	assert.Equal(t, []string{"other"}, fake.content("backups/db_backup.tgz.1"))
+
+	assert.Error(t, b.Remove(context.Background(), "db_backup.tgz", logger))
+}
+
+func TestExpiredAuthorization(t *testing.T) {
+	logger := log.NewEntry(log.New())
+	fake := newFakeB2(t, 100)
+	fake.add("backups/db_backup.tgz", []byte("a"))
+	b := newTestB2(fake)
+
+	_, err := b.ReadDir(context.Background(), ".", logger)
+	require.NoError(t, err)
+	fake.expire = fake.token()
+	files, err := b.ReadDir(context.Background(), ".", logger)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, 2, fake.authorizations)
+}
+
+func TestBadKey(t *testing.T) {
+	fake := newFakeB2(t, 100)
+	b := New(url.URL{Scheme: "b2", Host: "bucket"}, WithKeyID("keyid"), WithApplicationKey("wrong"), WithAPI(fake.URL))
+	_, err := b.ReadDir(context.Background(), ".", log.NewEntry(log.New()))
+	assert.ErrorContains(t, err, fmt.Sprintf("%d", http.StatusUnauthorized))
+}
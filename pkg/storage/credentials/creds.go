@@ -3,6 +3,7 @@ package credentials
 type Creds struct {
 	SMB SMBCreds
 	AWS AWSCreds
+	B2  B2Creds
 }
 
 type SMBCreds struct {
@@ -17,4 +18,13 @@ type AWSCreds struct {
 	Endpoint        string
 	PathStyle       bool
 	Region          string
+	// Proxy URL of the HTTP proxy for requests to S3, overriding the environment
+	Proxy string
+	// ResumeDir local directory in which to keep large uploads in progress, so that they can be resumed
+	ResumeDir string
+}
+
+type B2Creds struct {
+	KeyID          string
+	ApplicationKey string
 }
@@ -0,0 +1,260 @@
+package exec
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	osexec "os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The operations that the program is run with, as its first argument after any configured arguments
+const (
+	OperationPush   = "push"
+	OperationPull   = "pull"
+	OperationList   = "list"
+	OperationRemove = "remove"
+)
+
+const (
+	// ExitNotFound the exit code of the program when the file or directory does not exist
+	ExitNotFound = 3
+	// stderrLimit how much of the end of what the program writes to stderr to include in an error
+	stderrLimit = 1024
+)
+
+// Exec a storage backed by an external program, for the URL exec:///path/to/program, so that any store can
+// be used without building it in. The program is run once for each operation, as
+//
+//	program [args...] <operation> <name>
+//
+// with the environment of mysql-backup, plus any configured, plus:
+//
+//	EXEC_OPERATION  the operation: push, pull, list or remove
+//	EXEC_NAME       the name of the file, or directory for list, relative to the root of the store
+//	EXEC_URL        the URL of the target
+//	EXEC_SIZE       for push, the size of the file in bytes
+//
+// The operations are:
+//
+//	push    store the file read from stdin as name
+//	pull    write the file name to stdout
+//	list    write the files in the directory name, "." for the root, to stdout, one to a line, as
+//	        <size in bytes>\t<modification time in RFC3339>\t<name relative to the directory>;
+//	        blank lines are ignored
+//	remove  remove the file name
+//
+// Exit code 0 is success, and 3 that the file or directory does not exist, which is an empty directory for
+// list, and success for remove, as the file is gone already; any other is failure, with the end of stderr in
+// the error. Except for pull and list, stdout is ignored; stderr is logged at debug level.
+type Exec struct {
+	url     url.URL
+	program string
+	args    []string
+	env     map[string]string
+}
+
+type Option func(e *Exec)
+
+// WithArgs arguments to pass to the program before the operation, e.g. the bucket to use
+func WithArgs(args ...string) Option {
+	return func(e *Exec) {
+		e.args = args
+	}
+}
+
+// WithEnv environment variables to set for the program, in addition to those of mysql-backup
+func WithEnv(env map[string]string) Option {
+	return func(e *Exec) {
+		e.env = env
+	}
+}
+
+// New an exec storage for the URL exec:///path/to/program
+func New(u url.URL, opts ...Option) *Exec {
+	e := &Exec{url: u, program: u.Path}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Validate check that the URL names the program to run, by path, and nothing else
+func Validate(u url.URL) error {
+	if u.Host != "" || u.Path == "" || u.Path == "/" {
+		return fmt.Errorf("invalid exec url %q, must be exec:///path/to/program", u.String())
+	}
+	return nil
+}
+
+func (e *Exec) Pull(ctx context.Context, source, target string, logger *log.Entry) (int64, error) {
+	f, err := os.Create(target)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create target restore file %q, %v", target, err)
+	}
+	defer f.Close()
+	counter := &countingWriter{w: f}
+	if err := e.run(ctx, OperationPull, source, nil, nil, counter, logger); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, fmt.Errorf("failed to pull file %s: not found", source)
+		}
+		return 0, fmt.Errorf("failed to pull file %s, %v", source, err)
+	}
+	return counter.n, nil
+}
+
+func (e *Exec) Push(ctx context.Context, target, source string, logger *log.Entry) (int64, error) {
+	f, err := os.Open(source)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read input file %q, %v", source, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read input file %q, %v", source, err)
+	}
+	env := map[string]string{"EXEC_SIZE": strconv.FormatInt(info.Size(), 10)}
+	if err := e.run(ctx, OperationPush, target, env, f, nil, logger); err != nil {
+		return 0, fmt.Errorf("failed to push file %s, %v", target, err)
+	}
+	return info.Size(), nil
+}
+
+func (e *Exec) Clean(filename string) string {
+	return filename
+}
+
+func (e *Exec) Protocol() string {
+	return "exec"
+}
+
+func (e *Exec) URL() string {
+	return e.url.String()
+}
+
+func (e *Exec) ReadDir(ctx context.Context, dirname string, logger *log.Entry) ([]fs.FileInfo, error) {
+	var out bytes.Buffer
+	if err := e.run(ctx, OperationList, dirname, nil, nil, &out, logger); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list directory %s, %v", dirname, err)
+	}
+	return parseList(&out)
+}
+
+func (e *Exec) Remove(ctx context.Context, target string, logger *log.Entry) error {
+	if err := e.run(ctx, OperationRemove, target, nil, nil, nil, logger); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove file %s, %v", target, err)
+	}
+	return nil
+}
+
+// run run the program for the operation on name, with stdin and stdout, either of which may be nil. Returns an
+// error that is fs.ErrNotExist if the program exits with ExitNotFound.
+func (e *Exec) run(ctx context.Context, operation, name string, env map[string]string, stdin io.Reader, stdout io.Writer, logger *log.Entry) error {
+	args := append(append([]string{}, e.args...), operation, name)
+	cmd := osexec.CommandContext(ctx, e.program, args...)
+	envSlice := os.Environ()
+	for k, v := range e.env {
+		envSlice = append(envSlice, fmt.Sprintf("%s=%s", k, v))
+	}
+	// after the configured environment, so that those are always set by the protocol
+	envSlice = append(envSlice,
+		"EXEC_OPERATION="+operation,
+		"EXEC_NAME="+name,
+		"EXEC_URL="+e.url.String(),
+	)
+	for k, v := range env {
+		envSlice = append(envSlice, fmt.Sprintf("%s=%s", k, v))
+	}
+	cmd.Env = envSlice
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	logger.Debugf("running %s %s %s", e.program, operation, name)
+	err := cmd.Run()
+	if stderr.Len() > 0 {
+		logger.Debugf("%s %s %s stderr: %s", e.program, operation, name, stderr.String())
+	}
+	if err == nil {
+		return nil
+	}
+	var exitErr *osexec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == ExitNotFound {
+		return fs.ErrNotExist
+	}
+	msg := stderr.Bytes()
+	if len(msg) > stderrLimit {
+		msg = msg[len(msg)-stderrLimit:]
+	}
+	if s := strings.TrimSpace(string(msg)); s != "" {
+		return fmt.Errorf("%v: %s", err, s)
+	}
+	return err
+}
+
+// parseList parse the output of the list operation
+func parseList(r io.Reader) ([]fs.FileInfo, error) {
+	var files []fs.FileInfo
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		parts := strings.SplitN(text, "\t", 3)
+		if len(parts) != 3 || parts[2] == "" {
+			return nil, fmt.Errorf("invalid list line %d %q, must be <size>\\t<time>\\t<name>", line, text)
+		}
+		size, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid size in list line %d %q", line, text)
+		}
+		modTime, err := time.Parse(time.RFC3339, parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid time in list line %d %q, must be RFC3339: %v", line, text, err)
+		}
+		files = append(files, &execFileInfo{name: parts[2], size: size, lastModified: modTime})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read list: %v", err)
+	}
+	return files, nil
+}
+
+// countingWriter count the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type execFileInfo struct {
+	name         string
+	lastModified time.Time
+	size         int64
+}
+
+func (e execFileInfo) Name() string       { return e.name }
+func (e execFileInfo) Size() int64        { return e.size }
+func (e execFileInfo) Mode() os.FileMode  { return 0 } // Not known to the program
+func (e execFileInfo) ModTime() time.Time { return e.lastModified }
+func (e execFileInfo) IsDir() bool        { return false }
+func (e execFileInfo) Sys() interface{}   { return nil }
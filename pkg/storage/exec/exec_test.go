@@ -0,0 +1,156 @@
+package exec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/databacker/mysql-backup/pkg/util"
+)
+
+// plugin a program that stores files in the directory $STORE, following the protocol
+const plugin = `#!/bin/sh
+set -e
+dir="$1"; op="$2"; name="$3"
+[ "$dir" = --store ] || { echo "missing --store" >&2; exit 1; }
+[ "$op" = "$EXEC_OPERATION" ] && [ "$name" = "$EXEC_NAME" ] || { echo "env mismatch" >&2; exit 1; }
+case "$op" in
+push)
+	cat > "$STORE/$name"
+	[ "$(wc -c < "$STORE/$name" | tr -d ' ')" = "$EXEC_SIZE" ] || { echo "size mismatch" >&2; exit 1; }
+	;;
+pull)
+	[ -f "$STORE/$name" ] || exit 3
+	cat "$STORE/$name"
+	;;
+list)
+	[ -d "$STORE/$name" ] || exit 3
+	for f in "$STORE/$name"/*; do
+		[ -f "$f" ] || continue
+		printf '%s\t%s\t%s\n' "$(wc -c < "$f" | tr -d ' ')" 2024-01-02T03:04:05Z "$(basename "$f")"
+	done
+	;;
+remove)
+	[ -f "$STORE/$name" ] || exit 3
+	rm "$STORE/$name"
+	;;
+*)
+	echo "unknown operation $op" >&2
+	exit 1
+	;;
+esac
+`
+
+func TestExec(t *testing.T) {
+	dir := t.TempDir()
+	program := filepath.Join(dir, "plugin")
+	require.NoError(t, os.WriteFile(program, []byte(plugin), 0o755))
+	store := filepath.Join(dir, "store")
+	require.NoError(t, os.Mkdir(store, 0o755))
+	source := filepath.Join(dir, "dump.tgz")
+	require.NoError(t, os.WriteFile(source, []byte("dump contents"), 0o644))
+
+	u, err := util.SmartParse("exec://" + program)
+	require.NoError(t, err)
+	require.NoError(t, Validate(*u))
+	e := New(*u, WithArgs("--store"), WithEnv(map[string]string{"STORE": store}))
+	ctx := context.Background()
+	logger := log.NewEntry(log.New())
+
+	n, err := e.Push(ctx, "a.tgz", source, logger)
+	require.NoError(t, err)
+	assert.Equal(t, int64(13), n)
+
+	files, err := e.ReadDir(ctx, ".", logger)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "a.tgz", files[0].Name())
+	assert.Equal(t, int64(13), files[0].Size())
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), files[0].ModTime().UTC())
+
+	target := filepath.Join(dir, "restore.tgz")
+	n, err = e.Pull(ctx, "a.tgz", target, logger)
+	require.NoError(t, err)
+	assert.Equal(t, int64(13), n)
+	b, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "dump contents", string(b))
+
+	_, err = e.Pull(ctx, "missing.tgz", target, logger)
+	assert.ErrorContains(t, err, "not found")
+
+	require.NoError(t, e.Remove(ctx, "a.tgz", logger))
+	// already gone
+	require.NoError(t, e.Remove(ctx, "a.tgz", logger))
+
+	files, err = e.ReadDir(ctx, "missing", logger)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	_, err = e.Push(ctx, "a.tgz", source, logger)
+	require.NoError(t, err)
+	bad := New(*u, WithEnv(map[string]string{"STORE": store}))
+	_, err = bad.Push(ctx, "b.tgz", source, logger)
+	assert.ErrorContains(t, err, "missing --store")
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		name  string
+		list  string
+		files []string
+		err   string
+	}{
+		{"empty", "", nil, ""},
+		{"files", "1\t2024-01-02T03:04:05Z\ta.gz\n\n22\t2024-01-02T03:04:05+01:00\tb c.gz\r\n", []string{"a.gz", "b c.gz"}, ""},
+		{"missing name", "1\t2024-01-02T03:04:05Z\n", nil, "invalid list line 1"},
+		{"bad size", "x\t2024-01-02T03:04:05Z\ta.gz\n", nil, "invalid size"},
+		{"bad time", "1\t2024-01-02\ta.gz\n", nil, "invalid time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := parseList(strings.NewReader(tt.list))
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			var names []string
+			for _, f := range files {
+				names = append(names, f.Name())
+			}
+			assert.Equal(t, tt.files, names)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"exec:///usr/local/bin/store", false},
+		{"exec://host/usr/local/bin/store", true},
+		{"exec:///", true},
+		{"exec://", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := util.SmartParse(tt.url)
+			require.NoError(t, err)
+			err = Validate(*u)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package file
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io"
 	"io/fs"
 	"net/url"
@@ -11,21 +15,112 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	defaultFileMode os.FileMode = 0o666
+	// noOwner leave the owner or group unchanged
+	noOwner = -1
+)
+
 type File struct {
-	url  url.URL
-	path string
+	url     url.URL
+	path    string
+	mode    os.FileMode
+	modeSet bool // the mode was given, so is set explicitly, even if it is the default
+	dirMode os.FileMode
+	uid     int
+	gid     int
+	// hardLinks link duplicate dumps with hard links, rather than symlinks
+	hardLinks bool
+}
+
+type Option func(f *File)
+
+// WithMode set the permissions of the dump files written
+func WithMode(mode os.FileMode) Option {
+	return func(f *File) {
+		f.mode = mode
+		f.modeSet = true
+	}
+}
+
+// WithDirMode create the destination directory, and any parents, if they do not exist, with
+// the given permissions. Without it, a missing directory is an error, so that an unmounted volume
+// is not silently written to.
+func WithDirMode(mode os.FileMode) Option {
+	return func(f *File) {
+		f.dirMode = mode
+	}
 }
 
-func New(u url.URL) *File {
-	return &File{u, u.Path}
+// WithOwner set the owner and group of the dump files written. Use -1 for either to leave it unchanged.
+func WithOwner(uid, gid int) Option {
+	return func(f *File) {
+		f.uid = uid
+		f.gid = gid
+	}
 }
 
-func (f *File) Pull(source, target string, logger *log.Entry) (int64, error) {
-	return copyFile(path.Join(f.path, source), target)
+// WithHardLinks when a dump is identical to an existing one, hard link it to the existing one, rather than
+// storing it again. Implies checking every dump for duplicates on this target.
+func WithHardLinks() Option {
+	return func(f *File) {
+		f.hardLinks = true
+	}
+}
+
+func New(u url.URL, opts ...Option) *File {
+	f := &File{url: u, path: u.Path, mode: defaultFileMode, uid: noOwner, gid: noOwner}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
-func (f *File) Push(target, source string, logger *log.Entry) (int64, error) {
-	return copyFile(source, filepath.Join(f.path, target))
+func (f *File) Pull(ctx context.Context, source, target string, logger *log.Entry) (int64, error) {
+	return copyFile(ctx, path.Join(f.path, source), target, defaultFileMode)
+}
+
+func (f *File) Push(ctx context.Context, target, source string, logger *log.Entry) (int64, error) {
+	to := filepath.Join(f.path, target)
+	if f.dirMode != 0 {
+		if err := os.MkdirAll(filepath.Dir(to), f.dirMode); err != nil {
+			return 0, fmt.Errorf("failed to create directory for %s: %v", to, err)
+		}
+	}
+	n, err := copyFile(ctx, source, to, f.mode)
+	if err != nil {
+		return n, err
+	}
+	// the mode on create is subject to the umask, so set it explicitly
+	if f.modeSet {
+		if err := os.Chmod(to, f.mode); err != nil {
+			return n, fmt.Errorf("failed to set mode on %s: %v", to, err)
+		}
+	}
+	if f.uid != noOwner || f.gid != noOwner {
+		if err := os.Chown(to, f.uid, f.gid); err != nil {
+			return n, fmt.Errorf("failed to set owner on %s: %v", to, err)
+		}
+	}
+	return n, nil
+}
+
+// Stored the size and checksum of the stored file, read back in full
+func (f *File) Stored(ctx context.Context, name string, logger *log.Entry) (int64, string, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, "", err
+	}
+	in, err := os.Open(filepath.Join(f.path, name))
+	if err != nil {
+		return 0, "", err
+	}
+	defer in.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, in)
+	if err != nil {
+		return n, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
 }
 
 func (f *File) Clean(filename string) string {
@@ -40,8 +135,10 @@ func (f *File) URL() string {
 	return f.url.String()
 }
 
-func (f *File) ReadDir(dirname string, logger *log.Entry) ([]fs.FileInfo, error) {
-
+func (f *File) ReadDir(ctx context.Context, dirname string, logger *log.Entry) ([]fs.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	entries, err := os.ReadDir(filepath.Join(f.path, dirname))
 	if err != nil {
 		return nil, err
@@ -57,23 +154,116 @@ func (f *File) ReadDir(dirname string, logger *log.Entry) ([]fs.FileInfo, error)
 	return files, nil
 }
 
-func (f *File) Remove(target string, logger *log.Entry) error {
+func (f *File) Remove(ctx context.Context, target string, logger *log.Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return os.Remove(filepath.Join(f.path, target))
 }
 
-// copyFile copy a file from to as efficiently as possible
-func copyFile(from, to string) (int64, error) {
+// Deduplicate check every dump for duplicates if hard linking
+func (f *File) Deduplicate() bool {
+	return f.hardLinks
+}
+
+// Link create target as a link to the existing file. With hard links, the new file shares
+// the content of the existing one, and is unaffected if the existing one is removed. Otherwise, it is a
+// symlink, relative, so that it keeps working if the whole directory is moved.
+func (f *File) Link(ctx context.Context, target, existing string, logger *log.Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	linkPath := filepath.Join(f.path, target)
+	if f.hardLinks {
+		return os.Link(filepath.Join(f.path, existing), linkPath)
+	}
+	rel, err := filepath.Rel(filepath.Dir(linkPath), filepath.Join(f.path, existing))
+	if err != nil {
+		return err
+	}
+	return os.Symlink(rel, linkPath)
+}
+
+// LinkTarget the file, relative to the path of the target, to which name is a symlink, or empty if it is not one.
+// A hard link does not depend on the file it was linked to, so it is not one.
+func (f *File) LinkTarget(ctx context.Context, name string, logger *log.Entry) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	linkPath := filepath.Join(f.path, name)
+	info, err := os.Lstat(linkPath)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return "", nil
+	}
+	dest, err := os.Readlink(linkPath)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(filepath.Dir(linkPath), dest)
+	}
+	rel, err := filepath.Rel(f.path, dest)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Alias point alias at the existing file with a relative symlink. The symlink is created under a temporary
+// name and renamed over any existing alias, so that the alias always refers to a complete dump.
+func (f *File) Alias(ctx context.Context, alias, existing string, logger *log.Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	aliasPath := filepath.Join(f.path, alias)
+	rel, err := filepath.Rel(filepath.Dir(aliasPath), filepath.Join(f.path, existing))
+	if err != nil {
+		return err
+	}
+	tmpPath := aliasPath + ".tmp"
+	_ = os.Remove(tmpPath)
+	if err := os.Symlink(rel, tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, aliasPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// copyFile copy a file from to as efficiently as possible, stopping if the context is cancelled
+func copyFile(ctx context.Context, from, to string, perm os.FileMode) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 	src, err := os.Open(from)
 	if err != nil {
 		return 0, err
 	}
 	defer src.Close()
 
-	dst, err := os.Create(to)
+	dst, err := os.OpenFile(to, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
 		return 0, err
 	}
 	defer dst.Close()
-	n, err := io.Copy(dst, src)
+	n, err := io.Copy(dst, &contextReader{ctx: ctx, r: src})
 	return n, err
 }
+
+// contextReader a reader that fails once its context is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
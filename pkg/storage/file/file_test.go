@@ -0,0 +1,57 @@
+package file
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPush(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		opts    []Option
+		mode    os.FileMode
+		dirMode os.FileMode
+		err     bool
+	}{
+		{"mode", "dump.tgz", []Option{WithMode(0o600)}, 0o600, 0, false},
+		// explicitly the default, which the umask would otherwise reduce
+		{"default mode set", "dump.tgz", []Option{WithMode(0o666)}, 0o666, 0, false},
+		{"dir mode", "daily/db/dump.tgz", []Option{WithMode(0o640), WithDirMode(0o750)}, 0o640, 0o750, false},
+		{"missing dir without dir mode", "daily/db/dump.tgz", []Option{WithMode(0o640)}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "source")
+			require.NoError(t, os.WriteFile(source, []byte("dump"), 0o600))
+			root := filepath.Join(dir, "target")
+			require.NoError(t, os.Mkdir(root, 0o755))
+
+			f := New(url.URL{Scheme: "file", Path: root}, tt.opts...)
+			n, err := f.Push(context.Background(), tt.target, source, log.NewEntry(log.New()))
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, int64(4), n)
+			info, err := os.Stat(filepath.Join(root, tt.target))
+			require.NoError(t, err)
+			assert.Equal(t, tt.mode, info.Mode().Perm())
+			if tt.dirMode != 0 {
+				info, err := os.Stat(filepath.Dir(filepath.Join(root, tt.target)))
+				require.NoError(t, err)
+				assert.True(t, info.IsDir())
+				assert.Equal(t, tt.dirMode, info.Mode().Perm())
+			}
+		})
+	}
+}
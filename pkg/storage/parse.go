@@ -3,7 +3,9 @@ package storage
 import (
 	"fmt"
 
+	"github.com/databacker/mysql-backup/pkg/storage/b2"
 	"github.com/databacker/mysql-backup/pkg/storage/credentials"
+	"github.com/databacker/mysql-backup/pkg/storage/exec"
 	"github.com/databacker/mysql-backup/pkg/storage/file"
 	"github.com/databacker/mysql-backup/pkg/storage/s3"
 	"github.com/databacker/mysql-backup/pkg/storage/smb"
@@ -51,7 +53,30 @@ func ParseURL(url string, creds credentials.Creds) (Storage, error) {
 		if creds.AWS.PathStyle {
 			opts = append(opts, s3.WithPathStyle())
 		}
+		if creds.AWS.Proxy != "" {
+			if err := s3.ValidateProxy(creds.AWS.Proxy); err != nil {
+				return nil, err
+			}
+			opts = append(opts, s3.WithProxy(creds.AWS.Proxy))
+		}
+		if creds.AWS.ResumeDir != "" {
+			opts = append(opts, s3.WithResume(creds.AWS.ResumeDir, 0))
+		}
 		store = s3.New(*u, opts...)
+	case "b2":
+		opts := []b2.Option{}
+		if creds.B2.KeyID != "" {
+			opts = append(opts, b2.WithKeyID(creds.B2.KeyID))
+		}
+		if creds.B2.ApplicationKey != "" {
+			opts = append(opts, b2.WithApplicationKey(creds.B2.ApplicationKey))
+		}
+		store = b2.New(*u, opts...)
+	case "exec":
+		if err := exec.Validate(*u); err != nil {
+			return nil, err
+		}
+		store = exec.New(*u)
 	default:
 		return nil, fmt.Errorf("unknown url protocol: %s", u.Scheme)
 	}
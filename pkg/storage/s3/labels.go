@@ -0,0 +1,175 @@
+package s3
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/databacker/mysql-backup/pkg/storage/upload"
+)
+
+const (
+	maxTags           = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+	maxMetadataSize   = 2048
+)
+
+var (
+	// tagRE characters allowed in tag keys and values
+	tagRE = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]*$`)
+	// metadataKeyRE characters allowed in user-defined metadata keys, which are sent as HTTP headers
+	metadataKeyRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+// ValidateContentType check that tmpl is a valid template for the content type of uploaded objects
+func ValidateContentType(tmpl string) error {
+	return validateTemplates(map[string]string{"contentType": tmpl}, validateContentTypeValue)
+}
+
+// ValidateMetadata check that metadata are valid keys and value templates for user-defined object metadata
+func ValidateMetadata(metadata map[string]string) error {
+	for k := range metadata {
+		if !metadataKeyRE.MatchString(k) {
+			return fmt.Errorf("invalid metadata key %q, must be letters, digits, '.', '_' and '-'", k)
+		}
+	}
+	return validateTemplates(metadata, validateMetadataValue)
+}
+
+// ValidateTags check that tags are valid keys and value templates for object tags
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("at most %d tags allowed, found %d", maxTags, len(tags))
+	}
+	for k := range tags {
+		if err := validateTag(k, "", true); err != nil {
+			return err
+		}
+	}
+	return validateTemplates(tags, func(key, value string) error {
+		return validateTag(key, value, false)
+	})
+}
+
+// validateTemplates check that each value is a template that parses and, if it is constant, that
+// it is valid according to validate; the result of other templates is only known at upload
+func validateTemplates(templates map[string]string, validate func(key, value string) error) error {
+	for k, v := range templates {
+		if _, err := parseTemplate(v); err != nil {
+			return fmt.Errorf("invalid template for %s: %v", k, err)
+		}
+		if !strings.Contains(v, "{{") {
+			if err := validate(k, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateTag(key, value string, keyOnly bool) error {
+	if l := utf8.RuneCountInString(key); l == 0 || l > maxTagKeyLength {
+		return fmt.Errorf("invalid tag key %q, must be 1 to %d characters", key, maxTagKeyLength)
+	}
+	if strings.HasPrefix(strings.ToLower(key), "aws:") {
+		return fmt.Errorf("invalid tag key %q, the aws: prefix is reserved", key)
+	}
+	if !tagRE.MatchString(key) {
+		return fmt.Errorf("invalid tag key %q, must be letters, digits, spaces and + - = . _ : / @", key)
+	}
+	if keyOnly {
+		return nil
+	}
+	if utf8.RuneCountInString(value) > maxTagValueLength {
+		return fmt.Errorf("invalid value for tag %s, must be at most %d characters", key, maxTagValueLength)
+	}
+	if !tagRE.MatchString(value) {
+		return fmt.Errorf("invalid value %q for tag %s, must be letters, digits, spaces and + - = . _ : / @", value, key)
+	}
+	return nil
+}
+
+func validateContentTypeValue(_, value string) error {
+	if _, _, err := mime.ParseMediaType(value); err != nil {
+		return fmt.Errorf("invalid content type %q: %v", value, err)
+	}
+	return nil
+}
+
+func validateMetadataValue(key, value string) error {
+	for _, r := range value {
+		if r < ' ' || r > '~' {
+			return fmt.Errorf("invalid value %q for metadata %s, must be printable ASCII", value, key)
+		}
+	}
+	return nil
+}
+
+func parseTemplate(tmpl string) (*template.Template, error) {
+	return template.New("label").Funcs(upload.Funcs).Option("missingkey=error").Parse(tmpl)
+}
+
+// render render each template with info, checking each result with validate
+func render(templates map[string]string, info upload.Info, validate func(key, value string) error) (map[string]string, error) {
+	if len(templates) == 0 {
+		return nil, nil
+	}
+	rendered := make(map[string]string, len(templates))
+	for k, v := range templates {
+		t, err := parseTemplate(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for %s: %v", k, err)
+		}
+		if rendered[k], err = upload.Render(t, info); err != nil {
+			return nil, fmt.Errorf("failed to render template for %s: %v", k, err)
+		}
+		if err := validate(k, rendered[k]); err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// labels the content type, metadata and tagging header for an upload of the dump in info
+func (s *S3) labels(info upload.Info) (contentType string, metadata map[string]string, tagging string, err error) {
+	if s.contentType != "" {
+		ct, err := render(map[string]string{"contentType": s.contentType}, info, validateContentTypeValue)
+		if err != nil {
+			return "", nil, "", err
+		}
+		contentType = ct["contentType"]
+	}
+	if metadata, err = render(s.metadata, info, validateMetadataValue); err != nil {
+		return "", nil, "", err
+	}
+	size := 0
+	for k, v := range metadata {
+		size += len(k) + len(v)
+	}
+	if size > maxMetadataSize {
+		return "", nil, "", fmt.Errorf("metadata is %d bytes, more than the maximum of %d", size, maxMetadataSize)
+	}
+	tags, err := render(s.tags, info, func(key, value string) error {
+		return validateTag(key, value, false)
+	})
+	if err != nil {
+		return "", nil, "", err
+	}
+	// S3 takes the tags as a URL-encoded query string; sort them so it is stable
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, url.QueryEscape(k)+"="+url.QueryEscape(tags[k]))
+	}
+	return contentType, metadata, strings.Join(values, "&"), nil
+}
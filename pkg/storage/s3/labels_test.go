@@ -0,0 +1,72 @@
+package s3
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/databacker/mysql-backup/pkg/storage/upload"
+)
+
+func TestValidateTags(t *testing.T) {
+	tooMany := map[string]string{}
+	for _, k := range strings.Split("a b c d e f g h i j k", " ") {
+		tooMany[k] = "v"
+	}
+	tests := []struct {
+		name string
+		tags map[string]string
+		err  string
+	}{
+		{"none", nil, ""},
+		{"valid", map[string]string{"retention": "daily", "created": "{{ .date }}", "db": `{{ join .databases "+" }}`}, ""},
+		{"too many", tooMany, "at most 10 tags allowed, found 11"},
+		{"reserved prefix", map[string]string{"aws:foo": "bar"}, `invalid tag key "aws:foo", the aws: prefix is reserved`},
+		{"invalid key", map[string]string{"a,b": "bar"}, `invalid tag key "a,b", must be letters, digits, spaces and + - = . _ : / @`},
+		{"invalid value", map[string]string{"a": "b,c"}, `invalid value "b,c" for tag a, must be letters, digits, spaces and + - = . _ : / @`},
+		{"value too long", map[string]string{"a": strings.Repeat("x", 257)}, "invalid value for tag a, must be at most 256 characters"},
+		{"invalid template", map[string]string{"a": "{{ .date"}, "invalid template for a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTags(tt.tags)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateMetadataAndContentType(t *testing.T) {
+	assert.NoError(t, ValidateMetadata(map[string]string{"x-source": "mysql-backup", "server": "{{ .server }}"}))
+	assert.ErrorContains(t, ValidateMetadata(map[string]string{"bad key": "v"}), `invalid metadata key "bad key"`)
+	assert.ErrorContains(t, ValidateMetadata(map[string]string{"k": "café"}), "must be printable ASCII")
+	assert.NoError(t, ValidateContentType("application/gzip"))
+	assert.NoError(t, ValidateContentType(`application/{{ "gzip" }}`))
+	assert.ErrorContains(t, ValidateContentType("not a type"), "invalid content type")
+}
+
+func TestLabels(t *testing.T) {
+	s := New(url.URL{Scheme: "s3", Host: "bucket"},
+		WithContentType("application/gzip"),
+		WithMetadata(map[string]string{"databases": `{{ join .databases "," }}`}),
+		WithTags(map[string]string{"created": "{{ .date }}", "database": "{{ .database }}", "kind": "daily backup"}),
+	)
+	info := upload.Info{Time: time.Date(2024, 3, 5, 23, 30, 0, 0, time.UTC), Databases: []string{"app"}}
+	contentType, metadata, tagging, err := s.labels(info)
+	require.NoError(t, err)
+	assert.Equal(t, "application/gzip", contentType)
+	assert.Equal(t, map[string]string{"databases": "app"}, metadata)
+	assert.Equal(t, "created=2024-03-05&database=app&kind=daily+backup", tagging)
+
+	// a template that renders an invalid value fails the upload
+	s = New(url.URL{Scheme: "s3", Host: "bucket"}, WithTags(map[string]string{"dbs": `{{ join .databases "," }}`}))
+	_, _, _, err = s.labels(upload.Info{Databases: []string{"a", "b"}})
+	assert.ErrorContains(t, err, `invalid value "a,b" for tag dbs`)
+}
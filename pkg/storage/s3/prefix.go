@@ -0,0 +1,63 @@
+package s3
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/databacker/mysql-backup/pkg/storage/upload"
+)
+
+// WithPrefix keep each dump in a folder below the path in the URL, rendered for the dump from the template tmpl
+// with upload.Render, e.g. {{ .year }}/{{ .month }}/{{ .day }}. Check it first with ValidatePrefix.
+func WithPrefix(tmpl string) Option {
+	return func(s *S3) {
+		s.prefix = tmpl
+	}
+}
+
+// ValidatePrefix check that tmpl is a valid template for the folder of each dump. It is rendered for a sample
+// dump, so that a prefix that could never be valid, whatever the dump, fails now rather than at upload.
+func ValidatePrefix(tmpl string) error {
+	if _, err := parseTemplate(tmpl); err != nil {
+		return fmt.Errorf("invalid template for prefix: %v", err)
+	}
+	sample := upload.Info{Time: time.Now(), Server: "server", Label: "label", Databases: []string{"database"}}
+	_, err := render(map[string]string{"prefix": tmpl}, sample, validatePrefixValue)
+	return err
+}
+
+// Partition the folder, relative to the path in the URL, in which to keep the dump in info; empty if there is no
+// prefix. Empty segments, e.g. from a {{ .server }} when dumping a single server, and leading and trailing '/',
+// are removed, so that the key never has "//", which some services reject.
+func (s *S3) Partition(info upload.Info) (string, error) {
+	if s.prefix == "" {
+		return "", nil
+	}
+	if info.Time.IsZero() {
+		info.Time = time.Now()
+	}
+	rendered, err := render(map[string]string{"prefix": s.prefix}, info, validatePrefixValue)
+	if err != nil {
+		return "", err
+	}
+	segments := strings.Split(rendered["prefix"], "/")
+	segments = slices.DeleteFunc(segments, func(segment string) bool { return segment == "" || segment == "." })
+	return strings.Join(segments, "/"), nil
+}
+
+// Partitioned whether each dump is kept in a folder of its own, and so is listed below the top
+func (s *S3) Partitioned() bool {
+	return s.prefix != ""
+}
+
+// validatePrefixValue check that a rendered prefix stays below the path in the URL
+func validatePrefixValue(_, value string) error {
+	for _, segment := range strings.Split(value, "/") {
+		if segment == ".." {
+			return fmt.Errorf("invalid prefix %q, must not have a '..' segment", value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databacker/mysql-backup/pkg/storage/upload"
+)
+
+func TestValidatePrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		err    bool
+	}{
+		{"date", "{{ .year }}/{{ .month }}/{{ .day }}", false},
+		{"constant", "mysql/backups", false},
+		{"leading and trailing slash", "/{{ .date }}/", false},
+		{"invalid template", "{{ .year ", true},
+		{"unknown field", "{{ .week }}", true},
+		{"parent", "../{{ .year }}", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePrefix(tt.prefix)
+			if tt.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPartition(t *testing.T) {
+	info := upload.Info{Time: time.Date(2024, 6, 1, 2, 0, 0, 0, time.UTC), Label: "nightly"}
+	tests := []struct {
+		name     string
+		prefix   string
+		expected string
+		err      bool
+	}{
+		{"none", "", "", false},
+		{"date", "{{ .year }}/{{ .month }}/{{ .day }}", "2024/06/01", false},
+		{"slashes removed", "/{{ .label }}//{{ .date }}/", "nightly/2024-06-01", false},
+		{"empty segment", "{{ .server }}/{{ .year }}", "2024", false},
+		{"parent", "{{ .label }}/..", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &S3{}
+			WithPrefix(tt.prefix)(s)
+			assert.Equal(t, tt.prefix != "", s.Partitioned())
+			folder, err := s.Partition(info)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, folder)
+		})
+	}
+}
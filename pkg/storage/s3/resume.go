@@ -0,0 +1,390 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultAbandonAfter how long after it started an interrupted upload is abandoned, and aborted, if it is not
+// resumed before then
+const DefaultAbandonAfter = 7 * 24 * time.Hour
+
+// resumePartSize the size of each part of a resumable upload, unless the file is so large that it needs bigger
+// parts to stay within the most parts that S3 allows; a file no bigger than one part is uploaded whole
+var resumePartSize = manager.MinUploadPartSize
+
+// resumeState an upload in progress, as recorded in the resume directory, so that it can be resumed after it is
+// interrupted
+type resumeState struct {
+	// URL of the target to which it is uploaded
+	URL      string `json:"url"`
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	UploadID string `json:"uploadID"`
+	Size     int64  `json:"size"`
+	PartSize int64  `json:"partSize"`
+	// Checksum whether each part has a CRC32 checksum, which S3 requires with object lock
+	Checksum bool         `json:"checksum"`
+	Started  time.Time    `json:"started"`
+	Parts    []resumePart `json:"parts"`
+}
+
+// resumePart a part of the upload that is complete
+type resumePart struct {
+	Number int32  `json:"number"`
+	ETag   string `json:"etag"`
+	CRC32  string `json:"crc32,omitempty"`
+}
+
+// WithResume upload files bigger than a single part so that an upload that is interrupted, e.g. as the container
+// is restarted, can be resumed by the next run, with Resume. Until it completes, each such upload, along with a
+// copy of the file, is kept in dir. An interrupted upload that is not resumed within abandonAfter of when it
+// started, or DefaultAbandonAfter if 0, is aborted.
+func WithResume(dir string, abandonAfter time.Duration) Option {
+	return func(s *S3) {
+		if abandonAfter == 0 {
+			abandonAfter = DefaultAbandonAfter
+		}
+		s.resumeDir = dir
+		s.abandonAfter = abandonAfter
+	}
+}
+
+// partSize the size of each part of a resumable upload of size bytes
+func partSize(size int64) int64 {
+	// rounded up, so that the parts cover the whole file
+	minimum := (size + int64(manager.MaxUploadParts) - 1) / int64(manager.MaxUploadParts)
+	return max(resumePartSize, minimum)
+}
+
+// resumePaths the state file, and the copy of the file, of an upload of key to the target
+func (s *S3) resumePaths(key string) (statePath, dataPath string) {
+	h := sha256.Sum256([]byte(s.URL() + "\x00" + key))
+	name := hex.EncodeToString(h[:16])
+	return filepath.Join(s.resumeDir, name+".json"), filepath.Join(s.resumeDir, name+".data")
+}
+
+// pushResumable upload the file source, of size bytes, as described by input, a part at a time, recording each
+// part as it completes, so that the upload can be resumed if it is interrupted
+func (s *S3) pushResumable(ctx context.Context, client *s3.Client, input *s3.PutObjectInput, source string, size int64, logger *log.Entry) error {
+	if err := os.MkdirAll(s.resumeDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create resume directory %s: %v", s.resumeDir, err)
+	}
+	state := &resumeState{
+		URL:      s.URL(),
+		Bucket:   aws.ToString(input.Bucket),
+		Key:      aws.ToString(input.Key),
+		Size:     size,
+		PartSize: partSize(size),
+		Checksum: input.ChecksumAlgorithm != "",
+		Started:  time.Now(),
+	}
+	statePath, dataPath := s.resumePaths(state.Key)
+	// the file is removed with the rest of the dump when the run ends, so a copy is kept until the upload completes
+	if err := keepCopy(source, dataPath); err != nil {
+		return fmt.Errorf("failed to keep copy of %s to resume its upload: %v", source, err)
+	}
+	created, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:                    input.Bucket,
+		Key:                       input.Key,
+		ContentType:               input.ContentType,
+		Metadata:                  input.Metadata,
+		Tagging:                   input.Tagging,
+		ObjectLockMode:            input.ObjectLockMode,
+		ObjectLockRetainUntilDate: input.ObjectLockRetainUntilDate,
+		ChecksumAlgorithm:         input.ChecksumAlgorithm,
+	})
+	if err != nil {
+		os.Remove(dataPath)
+		return fmt.Errorf("failed to start upload: %v", err)
+	}
+	state.UploadID = aws.ToString(created.UploadId)
+	if err := writeResumeState(statePath, state); err != nil {
+		os.Remove(dataPath)
+		return err
+	}
+	logger.Debugf("uploading %s in parts of %d bytes, resumable with upload ID %s", state.Key, state.PartSize, state.UploadID)
+	return s.uploadParts(ctx, client, state, statePath, dataPath, logger)
+}
+
+// uploadParts upload each part of the upload in state that is not yet complete, and complete it
+func (s *S3) uploadParts(ctx context.Context, client *s3.Client, state *resumeState, statePath, dataPath string, logger *log.Entry) error {
+	f, err := os.Open(dataPath)
+	if err != nil {
+		return fmt.Errorf("failed to read the file to upload: %v", err)
+	}
+	defer f.Close()
+	count := int32((state.Size + state.PartSize - 1) / state.PartSize)
+	for n := int32(1); n <= count; n++ {
+		if slices.ContainsFunc(state.Parts, func(p resumePart) bool { return p.Number == n }) {
+			continue
+		}
+		offset := int64(n-1) * state.PartSize
+		length := min(state.PartSize, state.Size-offset)
+		input := &s3.UploadPartInput{
+			Bucket:        aws.String(state.Bucket),
+			Key:           aws.String(state.Key),
+			UploadId:      aws.String(state.UploadID),
+			PartNumber:    aws.Int32(n),
+			Body:          io.NewSectionReader(f, offset, length),
+			ContentLength: aws.Int64(length),
+		}
+		if state.Checksum {
+			input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+		}
+		out, err := client.UploadPart(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to upload part %d of %d: %v", n, count, err)
+		}
+		state.Parts = append(state.Parts, resumePart{Number: n, ETag: aws.ToString(out.ETag), CRC32: aws.ToString(out.ChecksumCRC32)})
+		// resuming lists the parts that S3 has, so a part that is not recorded is only uploaded again
+		if err := writeResumeState(statePath, state); err != nil {
+			logger.Warnf("unable to record upload of part %d of %s: %v", n, state.Key, err)
+		}
+	}
+	slices.SortFunc(state.Parts, func(a, b resumePart) int { return int(a.Number - b.Number) })
+	parts := make([]types.CompletedPart, 0, len(state.Parts))
+	for _, p := range state.Parts {
+		part := types.CompletedPart{PartNumber: aws.Int32(p.Number), ETag: aws.String(p.ETag)}
+		if p.CRC32 != "" {
+			part.ChecksumCRC32 = aws.String(p.CRC32)
+		}
+		parts = append(parts, part)
+	}
+	if _, err := client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(state.Bucket),
+		Key:             aws.String(state.Key),
+		UploadId:        aws.String(state.UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	}); err != nil {
+		return fmt.Errorf("failed to complete upload: %v", err)
+	}
+	removeResume(statePath, dataPath, logger)
+	return nil
+}
+
+// Resume complete the uploads to the target that an earlier run left unfinished, e.g. as it was interrupted, and
+// abort those abandoned: those that it did not resume within the abandon period, and any others that were started
+// before it, such as by a run whose resume directory was lost. Returns the names of the files whose uploads it
+// completed, relative to the URL. Does nothing unless uploads are resumable, as by WithResume.
+func (s *S3) Resume(ctx context.Context, logger *log.Entry) ([]string, error) {
+	if s.resumeDir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(s.resumeDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read resume directory %s: %v", s.resumeDir, err)
+	}
+	client, err := s.getClient(ctx, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AWS client: %v", err)
+	}
+	var (
+		resumed []string
+		errs    []error
+		// uploads with local state, which are not aborted as abandoned until their own abandon period ends
+		known = map[string]bool{}
+	)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		state, err := readResumeState(filepath.Join(s.resumeDir, entry.Name()))
+		if err != nil {
+			logger.Warnf("ignoring unreadable upload state %s: %v", entry.Name(), err)
+			continue
+		}
+		// the directory may be shared by targets
+		if state.URL != s.URL() {
+			continue
+		}
+		known[state.UploadID] = true
+		statePath, dataPath := s.resumePaths(state.Key)
+		if time.Since(state.Started) > s.abandonAfter {
+			logger.Warnf("aborting upload of %s, started %s, which was not resumed within %s", state.Key, state.Started.Format(time.RFC3339), s.abandonAfter)
+			if err := abortUpload(ctx, client, state.Bucket, state.Key, state.UploadID); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			removeResume(statePath, dataPath, logger)
+			continue
+		}
+		logger.Infof("resuming upload of %s, started %s", state.Key, state.Started.Format(time.RFC3339))
+		if err := s.resume(ctx, client, state, statePath, dataPath, logger); err != nil {
+			errs = append(errs, fmt.Errorf("failed to resume upload of %s: %v", state.Key, err))
+			continue
+		}
+		resumed = append(resumed, strings.TrimPrefix(strings.TrimPrefix(state.Key, s.key("")), "/"))
+	}
+	if err := s.abortAbandoned(ctx, client, known, logger); err != nil {
+		errs = append(errs, err)
+	}
+	return resumed, errors.Join(errs...)
+}
+
+// resume the upload in state, uploading the parts that S3 does not have
+func (s *S3) resume(ctx context.Context, client *s3.Client, state *resumeState, statePath, dataPath string, logger *log.Entry) error {
+	if _, err := os.Stat(dataPath); err != nil {
+		// without the file, it can never complete
+		if err := abortUpload(ctx, client, state.Bucket, state.Key, state.UploadID); err != nil {
+			return err
+		}
+		removeResume(statePath, dataPath, logger)
+		return fmt.Errorf("the copy of the file to upload is missing, so the upload is aborted: %v", err)
+	}
+	// what S3 has is what counts, whatever was recorded
+	var parts []resumePart
+	input := &s3.ListPartsInput{Bucket: aws.String(state.Bucket), Key: aws.String(state.Key), UploadId: aws.String(state.UploadID)}
+	for {
+		out, err := client.ListParts(ctx, input)
+		var noSuchUpload *types.NoSuchUpload
+		if errors.As(err, &noSuchUpload) {
+			removeResume(statePath, dataPath, logger)
+			return fmt.Errorf("the upload no longer exists, e.g. as a lifecycle rule aborted it")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list uploaded parts: %v", err)
+		}
+		for _, p := range out.Parts {
+			// a part of the wrong size, e.g. cut short, is uploaded again
+			if aws.ToInt64(p.Size) != min(state.PartSize, state.Size-int64(aws.ToInt32(p.PartNumber)-1)*state.PartSize) {
+				continue
+			}
+			parts = append(parts, resumePart{Number: aws.ToInt32(p.PartNumber), ETag: aws.ToString(p.ETag), CRC32: aws.ToString(p.ChecksumCRC32)})
+		}
+		if !aws.ToBool(out.IsTruncated) {
+			break
+		}
+		input.PartNumberMarker = out.NextPartNumberMarker
+	}
+	state.Parts = parts
+	logger.Debugf("upload %s of %s has %d parts already", state.UploadID, state.Key, len(parts))
+	return s.uploadParts(ctx, client, state, statePath, dataPath, logger)
+}
+
+// abortAbandoned abort the uploads to the target, other than the known ones, that started longer ago than the
+// abandon period, as no upload takes that long
+func (s *S3) abortAbandoned(ctx context.Context, client *s3.Client, known map[string]bool, logger *log.Entry) error {
+	prefix := s.key("")
+	if prefix != "" {
+		prefix += "/"
+	}
+	input := &s3.ListMultipartUploadsInput{Bucket: aws.String(s.url.Hostname()), Prefix: aws.String(prefix)}
+	var errs []error
+	for {
+		out, err := client.ListMultipartUploads(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to list uploads in progress: %v", err)
+		}
+		for _, u := range out.Uploads {
+			id, key, initiated := aws.ToString(u.UploadId), aws.ToString(u.Key), aws.ToTime(u.Initiated)
+			if known[id] || time.Since(initiated) <= s.abandonAfter {
+				continue
+			}
+			logger.Infof("aborting abandoned upload of %s, started %s", key, initiated.Format(time.RFC3339))
+			if err := abortUpload(ctx, client, s.url.Hostname(), key, id); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if !aws.ToBool(out.IsTruncated) {
+			break
+		}
+		input.KeyMarker, input.UploadIdMarker = out.NextKeyMarker, out.NextUploadIdMarker
+	}
+	return errors.Join(errs...)
+}
+
+// abortUpload abort the upload, so that S3 no longer keeps, and charges for, its parts
+func abortUpload(ctx context.Context, client *s3.Client, bucket, key, uploadID string) error {
+	_, err := client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	var noSuchUpload *types.NoSuchUpload
+	if err != nil && !errors.As(err, &noSuchUpload) {
+		return fmt.Errorf("failed to abort upload of %s: %v", key, err)
+	}
+	return nil
+}
+
+// keepCopy keep a copy of source at dest, as a hard link, if they are on the same filesystem, or else in full
+func keepCopy(source, dest string) error {
+	os.Remove(dest)
+	if err := os.Link(source, dest); err == nil {
+		return nil
+	}
+	from, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+	// the dump may be private
+	to, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(to, from); err != nil {
+		to.Close()
+		os.Remove(dest)
+		return err
+	}
+	return to.Close()
+}
+
+// writeResumeState write the state to path, replacing it in one step, so that it is never left half written
+func writeResumeState(path string, state *resumeState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload state: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("failed to write upload state: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write upload state: %v", err)
+	}
+	return nil
+}
+
+func readResumeState(path string) (*resumeState, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state resumeState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, err
+	}
+	if state.UploadID == "" || state.PartSize <= 0 {
+		return nil, errors.New("incomplete upload state")
+	}
+	return &state, nil
+}
+
+// removeResume remove the state and the copy of the file of an upload that is complete or aborted
+func removeResume(statePath, dataPath string, logger *log.Entry) {
+	for _, p := range []string{statePath, dataPath} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logger.Warnf("unable to remove %s: %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 an S3 server whose uploads of a part fail while failPart is set
+type fakeS3 struct {
+	backend  *s3mem.Backend
+	server   *httptest.Server
+	mu       sync.Mutex
+	failPart string
+	parts    map[string]int
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	f := &fakeS3{backend: s3mem.New(), parts: map[string]int{}}
+	require.NoError(t, f.backend.CreateBucket("mybucket"))
+	handler := gofakes3.New(f.backend).Server()
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if part := r.URL.Query().Get("partNumber"); part != "" && r.Method == http.MethodPut {
+			f.mu.Lock()
+			fail := part == f.failPart
+			if !fail {
+				f.parts[part]++
+			}
+			f.mu.Unlock()
+			if fail {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeS3) store(t *testing.T, resumeDir string) *S3 {
+	u, err := url.Parse("s3://mybucket/backups")
+	require.NoError(t, err)
+	return New(*u, WithEndpoint(f.server.URL), WithPathStyle(), WithRegion("us-east-1"),
+		WithAccessKeyId("key"), WithSecretAccessKey("secret"), WithResume(resumeDir, 0))
+}
+
+func (f *fakeS3) object(t *testing.T, key string) []byte {
+	obj, err := f.backend.GetObject("mybucket", key, nil)
+	require.NoError(t, err)
+	defer obj.Contents.Close()
+	b, err := io.ReadAll(obj.Contents)
+	require.NoError(t, err)
+	return b
+}
+
+func TestPartSize(t *testing.T) {
+	assert.Equal(t, resumePartSize, partSize(1))
+	assert.Equal(t, resumePartSize, partSize(10*resumePartSize))
+	// bigger parts, to stay within 10000 of them
+	size := 20000 * resumePartSize
+	assert.Equal(t, 2*resumePartSize, partSize(size))
+	assert.Equal(t, 2*resumePartSize+1, partSize(size+1))
+}
+
+func TestResume(t *testing.T) {
+	defer func(size int64) { resumePartSize = size }(resumePartSize)
+	resumePartSize = 1024
+	ctx := context.Background()
+	logger := log.NewEntry(log.New())
+	content := make([]byte, 3*1024+100)
+	_, _ = rand.Read(content)
+	source := filepath.Join(t.TempDir(), "dump.tgz")
+	require.NoError(t, os.WriteFile(source, content, 0o600))
+
+	t.Run("interrupted and resumed", func(t *testing.T) {
+		f := newFakeS3(t)
+		dir := t.TempDir()
+		s := f.store(t, dir)
+		f.failPart = "3"
+		_, err := s.Push(ctx, "dump.tgz", source, logger)
+		require.Error(t, err)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 2, "state and copy of the file are kept")
+
+		// the next run resumes it, even once the dump itself is gone
+		f.failPart = ""
+		resumed, err := f.store(t, dir).Resume(ctx, logger)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"dump.tgz"}, resumed)
+		assert.True(t, bytes.Equal(content, f.object(t, "backups/dump.tgz")))
+		assert.Equal(t, map[string]int{"1": 1, "2": 1, "3": 1, "4": 1}, f.parts, "parts already uploaded are not uploaded again")
+		entries, err = os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+	t.Run("completed at once", func(t *testing.T) {
+		f := newFakeS3(t)
+		dir := t.TempDir()
+		copied, err := f.store(t, dir).Push(ctx, "dump.tgz", source, logger)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), copied)
+		assert.True(t, bytes.Equal(content, f.object(t, "backups/dump.tgz")))
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+	t.Run("small file uploaded whole", func(t *testing.T) {
+		f := newFakeS3(t)
+		dir := t.TempDir()
+		small := filepath.Join(t.TempDir(), "small.tgz")
+		require.NoError(t, os.WriteFile(small, content[:100], 0o600))
+		_, err := f.store(t, dir).Push(ctx, "small.tgz", small, logger)
+		require.NoError(t, err)
+		assert.Empty(t, f.parts)
+		assert.Equal(t, content[:100], f.object(t, "backups/small.tgz"))
+	})
+	t.Run("abandoned", func(t *testing.T) {
+		f := newFakeS3(t)
+		dir := t.TempDir()
+		s := f.store(t, dir)
+		f.failPart = "2"
+		_, err := s.Push(ctx, "dump.tgz", source, logger)
+		require.Error(t, err)
+		// another that this target knows nothing of
+		client, err := s.getClient(ctx, logger)
+		require.NoError(t, err)
+		_, err = client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String("mybucket"), Key: aws.String("backups/other.tgz")})
+		require.NoError(t, err)
+
+		time.Sleep(10 * time.Millisecond)
+		s.abandonAfter = time.Millisecond
+		resumed, err := s.Resume(ctx, logger)
+		require.NoError(t, err)
+		assert.Empty(t, resumed)
+		uploads, err := client.ListMultipartUploads(ctx, &s3.ListMultipartUploadsInput{Bucket: aws.String("mybucket")})
+		require.NoError(t, err)
+		assert.Empty(t, uploads.Uploads)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+	t.Run("other target", func(t *testing.T) {
+		f := newFakeS3(t)
+		dir := t.TempDir()
+		f.failPart = "2"
+		_, err := f.store(t, dir).Push(ctx, "dump.tgz", source, logger)
+		require.Error(t, err)
+		u, err := url.Parse("s3://mybucket/other")
+		require.NoError(t, err)
+		other := New(*u, WithEndpoint(f.server.URL), WithPathStyle(), WithRegion("us-east-1"),
+			WithAccessKeyId("key"), WithSecretAccessKey("secret"), WithResume(dir, 0))
+		resumed, err := other.Resume(ctx, logger)
+		require.NoError(t, err)
+		assert.Empty(t, resumed)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 2)
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"io/fs"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
@@ -11,11 +13,15 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/databacker/mysql-backup/pkg/storage/upload"
 )
 
 type S3 struct {
@@ -27,6 +33,25 @@ type S3 struct {
 	endpoint        string
 	accessKeyId     string
 	secretAccessKey string
+	profile         string
+	// objectLockMode and objectLockRetain, if set, lock every uploaded object for the retention period
+	objectLockMode   types.ObjectLockMode
+	objectLockRetain time.Duration
+	// contentType, metadata and tags templates for the labels on every uploaded object
+	contentType string
+	metadata    map[string]string
+	tags        map[string]string
+	// proxy URL of the HTTP proxy for every request, overriding HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	proxy *url.URL
+	// accelerate and dualStack use the AWS endpoints for S3 Transfer Acceleration, and for IPv4 and IPv6
+	accelerate bool
+	dualStack  bool
+	// resumeDir, if set, directory in which to keep uploads in progress, so that they can be resumed, until
+	// abandonAfter from when they started
+	resumeDir    string
+	abandonAfter time.Duration
+	// prefix, if set, template for the folder in which to keep each dump, e.g. {{ .year }}/{{ .month }}
+	prefix string
 }
 
 type Option func(s *S3)
@@ -57,6 +82,122 @@ func WithSecretAccessKey(secretAccessKey string) Option {
 	}
 }
 
+func WithProfile(profile string) Option {
+	return func(s *S3) {
+		s.profile = profile
+	}
+}
+
+// WithObjectLock lock uploaded objects using S3 Object Lock, with the given mode,
+// either "governance" or "compliance", until retain from the time of upload.
+// The bucket must have object lock enabled.
+func WithObjectLock(mode string, retain time.Duration) Option {
+	return func(s *S3) {
+		s.objectLockMode = types.ObjectLockMode(strings.ToUpper(mode))
+		s.objectLockRetain = retain
+	}
+}
+
+// WithContentType set the content type of uploaded objects to the template tmpl, rendered with upload.Render.
+// Check it first with ValidateContentType.
+func WithContentType(tmpl string) Option {
+	return func(s *S3) {
+		s.contentType = tmpl
+	}
+}
+
+// WithMetadata set user-defined metadata on uploaded objects, each value a template rendered with upload.Render.
+// Check them first with ValidateMetadata.
+func WithMetadata(metadata map[string]string) Option {
+	return func(s *S3) {
+		s.metadata = metadata
+	}
+}
+
+// WithTags tag uploaded objects, each value a template rendered with upload.Render.
+// Check them first with ValidateTags.
+func WithTags(tags map[string]string) Option {
+	return func(s *S3) {
+		s.tags = tags
+	}
+}
+
+// WithProxy send every request, for uploads and restores alike, through the HTTP proxy at proxy, e.g.
+// http://proxy.example.com:3128, rather than the proxy, if any, from HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+// Check it first with ValidateProxy.
+func WithProxy(proxy string) Option {
+	return func(s *S3) {
+		s.proxy, _ = url.Parse(proxy)
+	}
+}
+
+// WithAccelerate use S3 Transfer Acceleration, which routes requests through the nearest AWS edge location, for
+// faster transfers over long distances. The bucket must have acceleration enabled. Check it first with
+// ValidateEndpointOptions.
+func WithAccelerate(accelerate bool) Option {
+	return func(s *S3) {
+		s.accelerate = accelerate
+	}
+}
+
+// WithDualStack use the AWS dual-stack endpoints, which accept both IPv4 and IPv6. Check it first with
+// ValidateEndpointOptions.
+func WithDualStack(dualStack bool) Option {
+	return func(s *S3) {
+		s.dualStack = dualStack
+	}
+}
+
+// ValidateEndpointOptions check that acceleration and dual-stack, which only AWS provides, are not combined with a
+// custom endpoint, e.g. of another S3-compatible service, and that acceleration is used only as AWS allows: not with
+// path-style addressing, and not for a bucket with a '.' in its name.
+func ValidateEndpointOptions(bucket, endpoint string, pathStyle, accelerate, dualStack bool) error {
+	if endpoint != "" {
+		if accelerate {
+			return fmt.Errorf("transfer acceleration is only for AWS, so cannot be combined with custom endpoint %s", endpoint)
+		}
+		if dualStack {
+			return fmt.Errorf("dual-stack is only for AWS endpoints, so cannot be combined with custom endpoint %s", endpoint)
+		}
+	}
+	if accelerate {
+		if pathStyle {
+			return fmt.Errorf("transfer acceleration cannot be combined with path-style addressing")
+		}
+		if strings.Contains(bucket, ".") {
+			return fmt.Errorf("transfer acceleration is not available for bucket %s, whose name contains '.'", bucket)
+		}
+	}
+	return nil
+}
+
+// ValidateProxy check that proxy is the URL of a proxy, with a scheme of http, https or socks5, and a host
+func ValidateProxy(proxy string) error {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return fmt.Errorf("invalid proxy: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("invalid proxy %s: scheme must be one of: http, https, socks5", u.Redacted())
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid proxy %s: no host", u.Redacted())
+	}
+	return nil
+}
+
+// ValidObjectLockMode checks if the provided object lock mode is one that is supported.
+func ValidObjectLockMode(mode string) bool {
+	for _, m := range types.ObjectLockModeGovernance.Values() {
+		if string(m) == strings.ToUpper(mode) {
+			return true
+		}
+	}
+	return false
+}
+
 func New(u url.URL, opts ...Option) *S3 {
 	s := &S3{url: u}
 	for _, opt := range opts {
@@ -65,9 +206,9 @@ func New(u url.URL, opts ...Option) *S3 {
 	return s
 }
 
-func (s *S3) Pull(source, target string, logger *log.Entry) (int64, error) {
+func (s *S3) Pull(ctx context.Context, source, target string, logger *log.Entry) (int64, error) {
 	// get the s3 client
-	client, err := s.getClient(logger)
+	client, err := s.getClient(ctx, logger)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get AWS client: %v", err)
 	}
@@ -85,7 +226,7 @@ func (s *S3) Pull(source, target string, logger *log.Entry) (int64, error) {
 	defer f.Close()
 
 	// Write the contents of S3 Object to the file
-	n, err := downloader.Download(context.TODO(), f, &s3.GetObjectInput{
+	n, err := downloader.Download(ctx, f, &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(path),
 	})
@@ -95,9 +236,9 @@ func (s *S3) Pull(source, target string, logger *log.Entry) (int64, error) {
 	return n, nil
 }
 
-func (s *S3) Push(target, source string, logger *log.Entry) (int64, error) {
+func (s *S3) Push(ctx context.Context, target, source string, logger *log.Entry) (int64, error) {
 	// get the s3 client
-	client, err := s.getClient(logger)
+	client, err := s.getClient(ctx, logger)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get AWS client: %v", err)
 	}
@@ -118,18 +259,103 @@ func (s *S3) Push(target, source string, logger *log.Entry) (int64, error) {
 	// For some services, that is ok, but for others, it causes issues.
 	key = strings.TrimPrefix(path.Join(key, target), "/")
 
-	// Write the contents of the file to the S3 object
-	_, err = uploader.Upload(context.TODO(), &s3.PutObjectInput{
+	input := &s3.PutObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 		Body:   countingReader,
-	})
+	}
+	info, _ := upload.FromContext(ctx)
+	if info.Time.IsZero() {
+		info.Time = time.Now()
+	}
+	contentType, metadata, tagging, err := s.labels(info)
+	if err != nil {
+		return 0, fmt.Errorf("failed to label object %s: %v", key, err)
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	input.Metadata = metadata
+	if tagging != "" {
+		input.Tagging = aws.String(tagging)
+	}
+	if s.objectLockMode != "" {
+		if err := checkObjectLock(ctx, client, bucket); err != nil {
+			return 0, err
+		}
+		retainUntil := time.Now().Add(s.objectLockRetain)
+		input.ObjectLockMode = s.objectLockMode
+		input.ObjectLockRetainUntilDate = &retainUntil
+		// S3 requires an integrity checksum on any upload with object lock headers
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+		logger.Debugf("locking object %s in mode %s until %s", key, s.objectLockMode, retainUntil.Format(time.RFC3339))
+	}
+
+	// large files can be resumed if the upload is interrupted
+	if s.resumeDir != "" {
+		if info, err := f.Stat(); err == nil && info.Size() > partSize(info.Size()) {
+			if err := s.pushResumable(ctx, client, input, source, info.Size(), logger); err != nil {
+				return 0, fmt.Errorf("failed to upload file, %v", err)
+			}
+			return info.Size(), nil
+		}
+	}
+
+	// Write the contents of the file to the S3 object
+	_, err = uploader.Upload(ctx, input)
 	if err != nil {
 		return 0, fmt.Errorf("failed to upload file, %v", err)
 	}
 	return countingReader.Bytes(), nil
 }
 
+// Alias point alias at the existing object by copying it within the bucket, replacing any existing alias.
+// The copy keeps the content type, metadata and tags of the existing object, and is locked like any upload.
+func (s *S3) Alias(ctx context.Context, alias, existing string, logger *log.Entry) error {
+	client, err := s.getClient(ctx, logger)
+	if err != nil {
+		return fmt.Errorf("failed to get AWS client: %v", err)
+	}
+	bucket := s.url.Hostname()
+	source := bucket + "/" + s.key(existing)
+	parts := strings.Split(source, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(s.key(alias)),
+		CopySource: aws.String(strings.Join(parts, "/")),
+	}
+	if s.objectLockMode != "" {
+		retainUntil := time.Now().Add(s.objectLockRetain)
+		input.ObjectLockMode = s.objectLockMode
+		input.ObjectLockRetainUntilDate = &retainUntil
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+	}
+	if _, err := client.CopyObject(ctx, input); err != nil {
+		return fmt.Errorf("failed to copy object, %v", err)
+	}
+	return nil
+}
+
+// Stored the size of the stored object. S3 has no SHA256 of the whole of an object uploaded in parts, and already
+// checks the integrity of each part as it is uploaded, so there is no checksum.
+func (s *S3) Stored(ctx context.Context, name string, logger *log.Entry) (int64, string, error) {
+	client, err := s.getClient(ctx, logger)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get AWS client: %v", err)
+	}
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.url.Hostname()),
+		Key:    aws.String(s.key(name)),
+	})
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get object %s: %v", s.key(name), err)
+	}
+	return aws.ToInt64(head.ContentLength), "", nil
+}
+
 func (s *S3) Clean(filename string) string {
 	return filename
 }
@@ -142,43 +368,73 @@ func (s *S3) URL() string {
 	return s.url.String()
 }
 
-func (s *S3) ReadDir(dirname string, logger *log.Entry) ([]fs.FileInfo, error) {
+func (s *S3) ReadDir(ctx context.Context, dirname string, logger *log.Entry) ([]fs.FileInfo, error) {
 	// get the s3 client
-	client, err := s.getClient(logger)
+	client, err := s.getClient(ctx, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get AWS client: %v", err)
 	}
 
-	// Call ListObjectsV2 with your bucket and prefix
-	result, err := client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{Bucket: aws.String(s.url.Hostname()), Prefix: aws.String(dirname)})
+	// list relative to the path in the URL, the same way as Push and Pull, so the names returned
+	// can be passed back to Pull and Remove
+	prefix := s.key(dirname)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return s.listObjects(ctx, client, prefix, prefix)
+}
+
+// List the files whose names, relative to the path in the URL, start with prefix, in any directory below it.
+// Unlike ReadDir, the prefix need not be a directory, e.g. backups/db1/2024- lists backups/db1/2024-01-01.tgz.
+// The names returned are relative to the path in the URL, so they can be passed back to Pull and Remove.
+func (s *S3) List(ctx context.Context, prefix string, logger *log.Entry) ([]fs.FileInfo, error) {
+	client, err := s.getClient(ctx, logger)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list objects, %v", err)
+		return nil, fmt.Errorf("failed to get AWS client: %v", err)
 	}
 
-	// Convert s3.Object to fs.FileInfo
-	var files []fs.FileInfo
-	for _, item := range result.Contents {
-		files = append(files, &s3FileInfo{
-			name:         *item.Key,
-			lastModified: *item.LastModified,
-			size:         *item.Size,
-		})
+	// not s.key(prefix), which would drop a trailing /, and with it the distinction between backups/db1/ and
+	// backups/db1, which also lists backups/db10/
+	base := s.key("")
+	if base != "" {
+		base += "/"
 	}
+	return s.listObjects(ctx, client, base+strings.TrimPrefix(prefix, "/"), base)
+}
 
+// listObjects list every object whose key starts with prefix, a page at a time, named relative to trim
+func (s *S3) listObjects(ctx context.Context, client *s3.Client, prefix, trim string) ([]fs.FileInfo, error) {
+	var files []fs.FileInfo
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String(s.url.Hostname()), Prefix: aws.String(prefix)})
+	for paginator.HasMorePages() {
+		result, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects, %v", err)
+		}
+		// Convert s3.Object to fs.FileInfo
+		for _, item := range result.Contents {
+			files = append(files, &s3FileInfo{
+				name:         strings.TrimPrefix(*item.Key, trim),
+				lastModified: *item.LastModified,
+				size:         *item.Size,
+			})
+		}
+	}
 	return files, nil
 }
 
-func (s *S3) Remove(target string, logger *log.Entry) error {
+func (s *S3) Remove(ctx context.Context, target string, logger *log.Entry) error {
 	// Get the AWS client
-	client, err := s.getClient(logger)
+	client, err := s.getClient(ctx, logger)
 	if err != nil {
 		return fmt.Errorf("failed to get AWS client: %v", err)
 	}
 
 	// Call DeleteObject with your bucket and the key of the object you want to delete
-	_, err = client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.url.Hostname()),
-		Key:    aws.String(target),
+		Key:    aws.String(s.key(target)),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to delete object, %v", err)
@@ -187,7 +443,31 @@ func (s *S3) Remove(target string, logger *log.Entry) error {
 	return nil
 }
 
-func (s *S3) getClient(logger *log.Entry) (*s3.Client, error) {
+// key get the object key for a name relative to the path in the URL
+func (s *S3) key(name string) string {
+	// S3 always prepends a /, so if it already has one, it would become //
+	key := strings.Trim(path.Join(s.url.Path, name), "/")
+	if key == "." {
+		return ""
+	}
+	return key
+}
+
+// checkObjectLock check that the bucket has object lock enabled, so that locking uploads can work
+func checkObjectLock(ctx context.Context, client *s3.Client, bucket string) error {
+	result, err := client.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("object lock requested, but unable to get object lock configuration for bucket %s, it may not have object lock enabled: %v", bucket, err)
+	}
+	if result.ObjectLockConfiguration == nil || result.ObjectLockConfiguration.ObjectLockEnabled != types.ObjectLockEnabledEnabled {
+		return fmt.Errorf("object lock requested, but bucket %s does not have object lock enabled", bucket)
+	}
+	return nil
+}
+
+func (s *S3) getClient(ctx context.Context, logger *log.Entry) (*s3.Client, error) {
 	// Get the AWS config
 	var configOpts []func(*config.LoadOptions) error // global client options
 	if logger.Level == log.TraceLevel {
@@ -196,6 +476,9 @@ func (s *S3) getClient(logger *log.Entry) (*s3.Client, error) {
 	if s.region != "" {
 		configOpts = append(configOpts, config.WithRegion(s.region))
 	}
+	if s.profile != "" {
+		configOpts = append(configOpts, config.WithSharedConfigProfile(s.profile))
+	}
 	if s.accessKeyId != "" {
 		configOpts = append(configOpts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
 			s.accessKeyId,
@@ -203,7 +486,26 @@ func (s *S3) getClient(logger *log.Entry) (*s3.Client, error) {
 			"",
 		)))
 	}
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
+	// without an explicit proxy, the default client already uses the one from the environment
+	httpClient := awshttp.NewBuildableClient()
+	if s.proxy != nil {
+		httpClient = httpClient.WithTransportOptions(func(tr *http.Transport) {
+			tr.Proxy = http.ProxyURL(s.proxy)
+		})
+	}
+	// connecting, including the TLS handshake, can be limited to less than the whole upload
+	timeout := upload.ConnectTimeout(ctx)
+	if timeout > 0 {
+		httpClient = httpClient.WithDialerOptions(func(d *net.Dialer) {
+			d.Timeout = timeout
+		}).WithTransportOptions(func(tr *http.Transport) {
+			tr.TLSHandshakeTimeout = timeout
+		})
+	}
+	if s.proxy != nil || timeout > 0 {
+		configOpts = append(configOpts, config.WithHTTPClient(httpClient))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx,
 		configOpts...,
 	)
 	if err != nil {
@@ -227,6 +529,20 @@ func (s *S3) getClient(logger *log.Entry) (*s3.Client, error) {
 			},
 		)
 	}
+	if s.accelerate {
+		s3opts = append(s3opts,
+			func(o *s3.Options) {
+				o.UseAccelerate = true
+			},
+		)
+	}
+	if s.dualStack {
+		s3opts = append(s3opts,
+			func(o *s3.Options) {
+				o.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+			},
+		)
+	}
 
 	// Create a new S3 service client
 	return s3.NewFromConfig(cfg, s3opts...), nil
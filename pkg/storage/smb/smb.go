@@ -1,16 +1,22 @@
 package smb
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/cloudsoda/go-smb2"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/databacker/mysql-backup/pkg/storage/upload"
 )
 
 const (
@@ -50,12 +56,12 @@ func New(u url.URL, opts ...Option) *SMB {
 	return s
 }
 
-func (s *SMB) Pull(source, target string, logger *log.Entry) (int64, error) {
+func (s *SMB) Pull(ctx context.Context, source, target string, logger *log.Entry) (int64, error) {
 	var (
 		copied int64
 		err    error
 	)
-	err = s.exec(s.url, func(fs *smb2.Share, sharepath string) error {
+	err = s.exec(ctx, s.url, func(fs *smb2.Share, sharepath string) error {
 		smbFilename := fmt.Sprintf("%s%c%s", sharepath, smb2.PathSeparator, filepath.Base(strings.ReplaceAll(target, ":", "-")))
 
 		to, err := os.Create(target)
@@ -74,13 +80,19 @@ func (s *SMB) Pull(source, target string, logger *log.Entry) (int64, error) {
 	return copied, err
 }
 
-func (s *SMB) Push(target, source string, logger *log.Entry) (int64, error) {
+func (s *SMB) Push(ctx context.Context, target, source string, logger *log.Entry) (int64, error) {
 	var (
 		copied int64
 		err    error
 	)
-	err = s.exec(s.url, func(fs *smb2.Share, sharepath string) error {
+	err = s.exec(ctx, s.url, func(fs *smb2.Share, sharepath string) error {
 		smbFilename := fmt.Sprintf("%s%c%s", sharepath, smb2.PathSeparator, target)
+		// create any missing directories on the way to the file, like mkdir -p
+		if dir := parentDir(sharepath, target); dir != "" {
+			if err := fs.MkdirAll(dir, 0o755); err != nil {
+				return fmt.Errorf("failed to create directory %s: %v", dir, err)
+			}
+		}
 		from, err := os.Open(source)
 		if err != nil {
 			return err
@@ -97,6 +109,30 @@ func (s *SMB) Push(target, source string, logger *log.Entry) (int64, error) {
 	return copied, err
 }
 
+// Stored the size and checksum of the stored file, read back in full from the share, so that a write that the
+// share acknowledged but did not complete is caught
+func (s *SMB) Stored(ctx context.Context, name string, logger *log.Entry) (int64, string, error) {
+	var (
+		size     int64
+		checksum string
+	)
+	err := s.exec(ctx, s.url, func(fs *smb2.Share, sharepath string) error {
+		smbFilename := fmt.Sprintf("%s%c%s", sharepath, smb2.PathSeparator, name)
+		from, err := fs.Open(smbFilename)
+		if err != nil {
+			return err
+		}
+		defer from.Close()
+		h := sha256.New()
+		if size, err = io.Copy(h, from); err != nil {
+			return err
+		}
+		checksum = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	return size, checksum, err
+}
+
 func (s *SMB) Clean(filename string) string {
 	return strings.ReplaceAll(filename, ":", "-")
 }
@@ -109,45 +145,44 @@ func (s *SMB) URL() string {
 	return s.url.String()
 }
 
-func (s *SMB) ReadDir(dirname string, logger *log.Entry) ([]os.FileInfo, error) {
+func (s *SMB) ReadDir(ctx context.Context, dirname string, logger *log.Entry) ([]os.FileInfo, error) {
 	var (
 		err   error
 		infos []os.FileInfo
 	)
-	err = s.exec(s.url, func(fs *smb2.Share, sharepath string) error {
+	err = s.exec(ctx, s.url, func(fs *smb2.Share, sharepath string) error {
 		infos, err = fs.ReadDir(sharepath)
 		return err
 	})
 	return infos, err
 }
 
-func (s *SMB) Remove(target string, logger *log.Entry) error {
-	return s.exec(s.url, func(fs *smb2.Share, sharepath string) error {
-		smbFilename := fmt.Sprintf("%s%c%s", sharepath, smb2.PathSeparator, filepath.Base(strings.ReplaceAll(target, ":", "-")))
+func (s *SMB) Remove(ctx context.Context, target string, logger *log.Entry) error {
+	return s.exec(ctx, s.url, func(fs *smb2.Share, sharepath string) error {
+		smbFilename := fmt.Sprintf("%s%c%s", sharepath, smb2.PathSeparator, strings.ReplaceAll(target, ":", "-"))
 		return fs.Remove(smbFilename)
 	})
 }
 
-func (s *SMB) exec(u url.URL, command func(fs *smb2.Share, sharepath string) error) error {
-	var (
-		username, password, domain string
-	)
-
+func (s *SMB) exec(ctx context.Context, u url.URL, command func(fs *smb2.Share, sharepath string) error) error {
 	hostname, port, path := u.Hostname(), u.Port(), u.Path
 	// set default port
 	if port == "" {
 		port = defaultSMBPort
 	}
-	host := fmt.Sprintf("%s:%s", hostname, port)
+	host := net.JoinHostPort(hostname, port)
 	share, sharepath := parseSMBPath(path)
-	if s.username == "" && u.User != nil {
-		username = u.User.Username()
-		password, _ = u.User.Password()
-	}
+	username, password, domain := s.credentials(u)
 
-	username, domain = parseSMBDomain(username)
-
-	conn, err := net.Dial("tcp", host)
+	// connecting, and setting up the session, can be limited to less than the whole operation
+	connectCtx := ctx
+	if timeout := upload.ConnectTimeout(ctx); timeout > 0 {
+		var cancel context.CancelFunc
+		connectCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(connectCtx, "tcp", host)
 	if err != nil {
 		return err
 	}
@@ -161,7 +196,7 @@ func (s *SMB) exec(u url.URL, command func(fs *smb2.Share, sharepath string) err
 		},
 	}
 
-	smbConn, err := d.Dial(conn)
+	smbConn, err := d.DialContext(connectCtx, conn)
 	if err != nil {
 		return err
 	}
@@ -176,11 +211,26 @@ func (s *SMB) exec(u url.URL, command func(fs *smb2.Share, sharepath string) err
 	defer func() {
 		_ = fs.Umount()
 	}()
-	return command(fs, sharepath)
+	// all operations on the share abort when the context is cancelled
+	return command(fs.WithContext(ctx), sharepath)
+}
+
+// credentials the username, password and domain with which to connect: those set by the options, or else the
+// userinfo of u, which url.Parse has already percent-decoded. The domain can be in the username, as DOMAIN;user.
+func (s *SMB) credentials(u url.URL) (username, password, domain string) {
+	username, password = s.username, s.password
+	if username == "" && u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	username, domain = parseSMBDomain(username)
+	if s.domain != "" {
+		domain = s.domain
+	}
+	return username, password, domain
 }
 
 // parseSMBDomain parse a username to get an SMB domain
-// nolint: unused
 func parseSMBDomain(username string) (user, domain string) {
 	parts := strings.SplitN(username, ";", 2)
 	if len(parts) < 2 {
@@ -190,6 +240,16 @@ func parseSMBDomain(username string) (user, domain string) {
 	return parts[1], parts[0]
 }
 
+// parentDir the directory, relative to the share, that contains target, or "" if it is the root of the share
+func parentDir(sharepath, target string) string {
+	dir := path.Dir(path.Join(sharepath, strings.ReplaceAll(target, `\`, "/")))
+	dir = strings.Trim(dir, "/")
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
 // parseSMBPath parse an smb path into its constituent parts
 func parseSMBPath(path string) (share, sharepath string) {
 	sep := "/"
@@ -0,0 +1,121 @@
+package stdio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Name the target that is stdout, for a dump, or stdin, for a restore
+const Name = "-"
+
+// Stdio the standard output, to which a dump writes its one file, or the standard input, from which a restore
+// reads the one file to restore, for the target "-", so that dumps can be piped to and from other programs.
+// Each can be written or read only once, as it is a single stream.
+type Stdio struct {
+	in  io.Reader
+	out io.Writer
+
+	mu   sync.Mutex
+	used string
+}
+
+// New a stream that reads from in and writes to out, either of which may be nil, if it is only for a restore, or
+// for a dump, respectively
+func New(in io.Reader, out io.Writer) *Stdio {
+	return &Stdio{in: in, out: out}
+}
+
+// use mark the stream as used for name, failing if it already was
+func (s *Stdio) use(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used != "" {
+		return fmt.Errorf("the stream already has %s, so cannot have %s too", s.used, name)
+	}
+	s.used = name
+	return nil
+}
+
+func (s *Stdio) Pull(ctx context.Context, source, target string, logger *log.Entry) (int64, error) {
+	if s.in == nil {
+		return 0, fmt.Errorf("cannot read %s from stdout", source)
+	}
+	if err := s.use(source); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create target restore file %q, %v", target, err)
+	}
+	defer f.Close()
+	n, err := io.Copy(f, &ctxReader{ctx: ctx, r: s.in})
+	if err != nil {
+		return n, fmt.Errorf("failed to read stdin: %v", err)
+	}
+	return n, nil
+}
+
+func (s *Stdio) Push(ctx context.Context, target, source string, logger *log.Entry) (int64, error) {
+	if s.out == nil {
+		return 0, fmt.Errorf("cannot write %s to stdin", target)
+	}
+	if err := s.use(target); err != nil {
+		return 0, err
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read input file %q, %v", source, err)
+	}
+	defer f.Close()
+	logger.Debugf("writing %s to stdout", target)
+	n, err := io.Copy(s.out, &ctxReader{ctx: ctx, r: f})
+	if err != nil {
+		return n, fmt.Errorf("failed to write stdout: %v", err)
+	}
+	return n, nil
+}
+
+func (s *Stdio) Clean(filename string) string {
+	return filename
+}
+
+func (s *Stdio) Protocol() string {
+	return "stdio"
+}
+
+func (s *Stdio) URL() string {
+	return Name
+}
+
+func (s *Stdio) ReadDir(ctx context.Context, dirname string, logger *log.Entry) ([]fs.FileInfo, error) {
+	return nil, fmt.Errorf("cannot list a stream")
+}
+
+func (s *Stdio) Remove(ctx context.Context, target string, logger *log.Entry) error {
+	return fmt.Errorf("cannot remove %s from a stream", target)
+}
+
+// Stream always, as it is
+func (s *Stdio) Stream() bool {
+	return true
+}
+
+// ctxReader stop reading once ctx is cancelled, so a cancelled dump or restore does not wait for the rest of
+// the stream
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
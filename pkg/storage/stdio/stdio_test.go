@@ -0,0 +1,63 @@
+package stdio
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPush(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "dump.tgz")
+	require.NoError(t, os.WriteFile(source, []byte("dump contents"), 0o644))
+	ctx := context.Background()
+	logger := log.NewEntry(log.New())
+
+	var out bytes.Buffer
+	s := New(nil, &out)
+	n, err := s.Push(ctx, "a.tgz", source, logger)
+	require.NoError(t, err)
+	assert.Equal(t, int64(13), n)
+	assert.Equal(t, "dump contents", out.String())
+
+	// the stream has the one file only
+	_, err = s.Push(ctx, "b.tgz", source, logger)
+	assert.ErrorContains(t, err, "already has a.tgz")
+	assert.Equal(t, "dump contents", out.String())
+
+	_, err = s.Pull(ctx, "a.tgz", filepath.Join(dir, "restore.tgz"), logger)
+	assert.ErrorContains(t, err, "cannot read")
+}
+
+func TestPull(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "restore.tgz")
+	ctx := context.Background()
+	logger := log.NewEntry(log.New())
+
+	s := New(strings.NewReader("dump contents"), nil)
+	n, err := s.Pull(ctx, Name, target, logger)
+	require.NoError(t, err)
+	assert.Equal(t, int64(13), n)
+	b, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "dump contents", string(b))
+
+	_, err = s.Pull(ctx, Name, target, logger)
+	assert.Error(t, err)
+
+	_, err = s.Push(ctx, "a.tgz", target, logger)
+	assert.ErrorContains(t, err, "cannot write")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = New(strings.NewReader("dump contents"), nil).Pull(cancelled, Name, target, logger)
+	assert.ErrorContains(t, err, context.Canceled.Error())
+}
@@ -1,18 +1,101 @@
 package storage
 
 import (
+	"context"
 	"io/fs"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/databacker/mysql-backup/pkg/storage/upload"
 )
 
+// Storage a place to store dumps. Every method that does any I/O takes a context, and aborts
+// when the context is cancelled.
 type Storage interface {
 	Protocol() string
 	URL() string
 	Clean(filename string) string
-	Push(target, source string, logger *log.Entry) (int64, error)
-	Pull(source, target string, logger *log.Entry) (int64, error)
-	ReadDir(dirname string, logger *log.Entry) ([]fs.FileInfo, error)
+	Push(ctx context.Context, target, source string, logger *log.Entry) (int64, error)
+	Pull(ctx context.Context, source, target string, logger *log.Entry) (int64, error)
+	ReadDir(ctx context.Context, dirname string, logger *log.Entry) ([]fs.FileInfo, error)
 	// Remove remove a particular file
-	Remove(target string, logger *log.Entry) error
+	Remove(ctx context.Context, target string, logger *log.Entry) error
+}
+
+// Lister is implemented by storage that can list files by the prefix of their names, rather than a
+// directory at a time.
+type Lister interface {
+	// List the files whose names, relative to the URL, start with prefix, in any directory below it
+	List(ctx context.Context, prefix string, logger *log.Entry) ([]fs.FileInfo, error)
+}
+
+// Linker is implemented by storage that can alias a new name to an existing file,
+// without copying the content again.
+type Linker interface {
+	// Link make target refer to the same content as the existing file
+	Link(ctx context.Context, target, existing string, logger *log.Entry) error
+}
+
+// LinkResolver is implemented by storage whose links depend on the file they link to, as a symlink does, so that
+// the file must be kept for as long as any link to it is.
+type LinkResolver interface {
+	// LinkTarget the file, relative to the URL, to which name links, or empty if name is not such a link
+	LinkTarget(ctx context.Context, name string, logger *log.Entry) (string, error)
+}
+
+// Deduplicator is implemented by storage that can choose to always link duplicate dumps to the existing
+// copy, rather than store them again, even if skipping duplicates is not enabled for the dump.
+type Deduplicator interface {
+	// Deduplicate whether to link duplicate dumps
+	Deduplicate() bool
+}
+
+// Verifier is implemented by storage that can read back what it stored, to check that an upload is complete.
+type Verifier interface {
+	// Stored the size of the stored file, and its SHA256 checksum in hex, if the storage can provide it, or
+	// empty if it cannot
+	Stored(ctx context.Context, name string, logger *log.Entry) (size int64, sha256 string, err error)
+}
+
+// Aliaser is implemented by storage that can point a fixed name, such as latest.tgz, at an existing
+// file, replacing whatever the name pointed at before.
+type Aliaser interface {
+	// Alias make alias refer to the same content as the existing file, replacing any existing alias
+	Alias(ctx context.Context, alias, existing string, logger *log.Entry) error
+}
+
+// Streamer is implemented by storage that is a single stream, such as stdout, rather than a place that keeps
+// files, so it holds just the one dump, and cannot be listed, deduplicated, aliased or pruned.
+type Streamer interface {
+	// Stream whether the storage is a single stream
+	Stream() bool
+}
+
+// IsStream whether the storage is a single stream, as by Streamer
+func IsStream(s Storage) bool {
+	streamer, ok := s.(Streamer)
+	return ok && streamer.Stream()
+}
+
+// Resumer is implemented by storage that can resume uploads that an earlier run left unfinished, e.g. as its
+// container was restarted, rather than uploading them again from the start.
+type Resumer interface {
+	// Resume complete the unfinished uploads, and clean up those that are abandoned. Returns the names of the
+	// files whose uploads it completed.
+	Resume(ctx context.Context, logger *log.Entry) ([]string, error)
+}
+
+// Partitioner is implemented by storage that can keep each dump in a folder of its own, e.g. one for each date,
+// for lifecycle rules by prefix, rather than at the top.
+type Partitioner interface {
+	// Partition the folder, relative to the URL, in which to keep the dump in info; empty to keep it at the top
+	Partition(info upload.Info) (string, error)
+	// Partitioned whether the storage keeps dumps in folders, so that listing it finds them below the top
+	Partitioned() bool
+}
+
+// IsPartitioned whether the storage keeps dumps in folders, as by Partitioner
+func IsPartitioned(s Storage) bool {
+	p, ok := s.(Partitioner)
+	return ok && p.Partitioned()
 }
@@ -0,0 +1,89 @@
+// Package upload describes the dump being pushed to a storage target, for storage that labels what it
+// stores, e.g. with object tags, and how long the target may take to connect.
+package upload
+
+import (
+	"context"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Info the dump being pushed
+type Info struct {
+	// Time when the dump was taken
+	Time time.Time
+	// Server the name of the database server, if dumping more than one
+	Server string
+	// Label the label of the dump, if any
+	Label string
+	// Databases the databases in the dump
+	Databases []string
+}
+
+type infoKey struct{}
+
+// NewContext a context that carries info, for the storage target to which it is passed
+func NewContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, infoKey{}, info)
+}
+
+// FromContext the info in ctx, if any
+func FromContext(ctx context.Context) (Info, bool) {
+	info, ok := ctx.Value(infoKey{}).(Info)
+	return info, ok
+}
+
+type connectTimeoutKey struct{}
+
+// WithConnectTimeout a context with which storage that connects to a server, such as SMB and S3, gives up connecting
+// after d, rather than waiting for the whole upload to time out; d of 0 for no limit
+func WithConnectTimeout(ctx context.Context, d time.Duration) context.Context {
+	if d <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, connectTimeoutKey{}, d)
+}
+
+// ConnectTimeout how long storage may take to connect, as set by WithConnectTimeout; 0 for no limit
+func ConnectTimeout(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(connectTimeoutKey{}).(time.Duration)
+	return d
+}
+
+// Funcs the functions available to templates rendered with Render
+var Funcs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// Render render tmpl with the info as its data. The template can use:
+//
+//   - {{ .now }}: the time of the dump, in RFC3339 format
+//   - {{ .date }}: the date of the dump, in YYYY-MM-DD format
+//   - {{ .year }}, {{ .month }}, {{ .day }}: parts of the date of the dump
+//   - {{ .server }}: the name of the database server, if dumping more than one
+//   - {{ .label }}: the label of the dump, if any
+//   - {{ .database }}: the database, if the dump contains just one
+//   - {{ .databases }}: the list of databases, e.g. {{ join .databases "-" }}
+func Render(tmpl *template.Template, info Info) (string, error) {
+	var database string
+	if len(info.Databases) == 1 {
+		database = info.Databases[0]
+	}
+	t := info.Time.UTC()
+	var b strings.Builder
+	if err := tmpl.Execute(&b, map[string]any{
+		"now":       t.Format(time.RFC3339),
+		"date":      t.Format(time.DateOnly),
+		"year":      t.Format("2006"),
+		"month":     t.Format("01"),
+		"day":       t.Format("02"),
+		"server":    info.Server,
+		"label":     info.Label,
+		"database":  database,
+		"databases": info.Databases,
+	}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
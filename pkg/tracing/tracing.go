@@ -0,0 +1,110 @@
+// Package tracing traces dumps, uploads, restores and prunes with OpenTelemetry, exporting the spans with OTLP
+// over HTTP. Until Setup is called, spans are started on the default no-op provider, so they cost next to nothing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "github.com/databacker/mysql-backup"
+	// DefaultServiceName the service.name of the spans, if none is given
+	DefaultServiceName = "mysql-backup"
+)
+
+// Options where to export the spans, and how to identify them
+type Options struct {
+	// Endpoint URL of the OTLP/HTTP collector, e.g. http://otel-collector:4318; the path defaults to /v1/traces.
+	// http:// sends the spans unencrypted.
+	Endpoint string
+	// Headers sent with each export, e.g. for authentication
+	Headers map[string]string
+	// ServiceName the service.name of the spans; defaults to DefaultServiceName
+	ServiceName string
+	// Version the service.version of the spans
+	Version string
+}
+
+// Setup export all spans to the OTLP endpoint of opts. Returns the function with which to flush any spans not
+// yet exported, and to stop exporting, before exiting.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tracing endpoint %s: %v", opts.Endpoint, err)
+	}
+	exporterOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	switch u.Scheme {
+	case "http":
+		exporterOpts = append(exporterOpts, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("invalid tracing endpoint %s: scheme must be http or https", opts.Endpoint)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid tracing endpoint %s: no host", opts.Endpoint)
+	}
+	if u.Path != "" && u.Path != "/" {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithURLPath(u.Path))
+	}
+	if len(opts.Headers) > 0 {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithHeaders(opts.Headers))
+	}
+	exporter, err := otlptracehttp.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create tracing exporter: %v", err)
+	}
+
+	serviceName := opts.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	attrs := []attribute.KeyValue{semconv.ServiceName(serviceName)}
+	if opts.Version != "" {
+		attrs = append(attrs, semconv.ServiceVersion(opts.Version))
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, attrs...))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create tracing resource: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start a span called name, as a child of the span in ctx, if any
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End the span, recording err, if not nil, as its error
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// RedactURL u without any password, for an attribute of a span
+func RedactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.User == nil {
+		return u
+	}
+	return parsed.Redacted()
+}
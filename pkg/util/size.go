@@ -0,0 +1,46 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sizeRE a size, e.g. 500MB, after converting to upper case
+var sizeRE = regexp.MustCompile(`^(\d+)\s*([KMGT]?)(?:I?B)?$`)
+
+// sizeShifts the power of 2 of each unit of a size
+var sizeShifts = map[string]uint{"": 0, "K": 10, "M": 20, "G": 30, "T": 40}
+
+// ParseSize parse a size in bytes, with an optional unit of K, M, G or T, each 1024 times the one before, e.g.
+// 500MB or 20GiB; B and iB after the unit are optional
+func ParseSize(size string) (int64, error) {
+	matches := sizeRE.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(size)))
+	if matches == nil {
+		return 0, fmt.Errorf("invalid size %q, must be a number with an optional unit of K, M, G or T, e.g. 500MB", size)
+	}
+	n, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %v", size, err)
+	}
+	shift := sizeShifts[matches[2]]
+	if n > (1<<63-1)>>shift {
+		return 0, fmt.Errorf("invalid size %q: too large", size)
+	}
+	return n << shift, nil
+}
+
+// FormatSize n bytes in the largest unit in which it is at least 1, e.g. 1.5 GiB
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
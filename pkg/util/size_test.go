@@ -0,0 +1,56 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size     string
+		expected int64
+		err      bool
+	}{
+		{"0", 0, false},
+		{"1024", 1024, false},
+		{"100B", 100, false},
+		{"500K", 500 << 10, false},
+		{"500MB", 500 << 20, false},
+		{"20GiB", 20 << 30, false},
+		{"2 tb", 2 << 40, false},
+		{"1.5GB", 0, true},
+		{"-1GB", 0, true},
+		{"1PB", 0, true},
+		{"GB", 0, true},
+		{"99999999999T", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			n, err := ParseSize(tt.size)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, n)
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 * 1024 * 1024, "5.0 MiB"},
+		{3*1024*1024*1024 + 512*1024*1024, "3.5 GiB"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, FormatSize(tt.bytes))
+	}
+}
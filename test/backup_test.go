@@ -59,6 +59,8 @@ var dumpFilterRegex = []*regexp.Regexp{
 	regexp.MustCompile(`(?i)^\s*-- MySQL dump .*$`),
 	regexp.MustCompile(`(?i)^\s*-- Go SQL dump .*$`),
 	regexp.MustCompile(`(?i)^\s*-- Dump completed on .*`),
+	// only in our dumps, for restores to verify the row counts
+	regexp.MustCompile(`(?i)^\s*-- Rows dumped for table .*`),
 }
 
 type containerPort struct {
@@ -639,8 +641,8 @@ func runTest(t *testing.T, opts testOptions) {
 			executor.SetLogger(log.New())
 
 			var results core.DumpResults
-			if err := executor.Timer(timerOpts, func() error {
-				ret, err := executor.Dump(opts.dumpOptions)
+			if err := executor.Timer(context.Background(), timerOpts, func(ctx context.Context) error {
+				ret, err := executor.Dump(ctx, opts.dumpOptions)
 				results = ret
 				return err
 			}); err != nil {